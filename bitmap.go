@@ -0,0 +1,72 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"strings"
+)
+
+// GlyphBitmap returns the bitmap image of glyph `gid` for rendering at `ppem` pixels per em, along with its
+// format: "png" for CBDT images and the graphic type of sbix images such as "png", "jpg" or "tiff".
+// The image of the smallest strike with at least `ppem` is returned, or of the largest strike if there is no
+// such strike. The sbix table takes precedence over the CBDT table. Returns nil data if `gid` has no bitmap
+// image and an ErrRequiredTableMissing error for the CBLC table if `f` has no bitmap tables.
+func (f *Font) GlyphBitmap(gid GlyphIndex, ppem uint16) ([]byte, string, error) {
+	switch {
+	case f.sbix != nil:
+		var best []byte
+		var bestPpem uint16
+		for i := range f.sbix.strikes {
+			s := &f.sbix.strikes[i]
+			gd := s.glyphData(gid)
+			if gd == nil || !betterStrike(s.ppem, bestPpem, ppem, best == nil) {
+				continue
+			}
+			best = gd
+			bestPpem = s.ppem
+		}
+		if best == nil {
+			return nil, "", nil
+		}
+		return best[sbixGlyphHeaderSize:], strings.TrimSpace(sbixGraphicType(best)), nil
+	case f.cbdt != nil:
+		var best []byte
+		var bestFormat, bestPpem uint16
+		for i := range f.cbdt.strikes {
+			s := &f.cbdt.strikes[i]
+			data, imageFormat := s.glyphData(gid)
+			if data == nil || !betterStrike(uint16(s.ppemY), bestPpem, ppem, best == nil) {
+				continue
+			}
+			best = data
+			bestFormat = imageFormat
+			bestPpem = uint16(s.ppemY)
+		}
+		if best == nil {
+			return nil, "", nil
+		}
+		img, err := cbdtImage(best, bestFormat)
+		if err != nil {
+			return nil, "", err
+		}
+		return img, "png", nil
+	}
+	logger.Debugf("GlyphBitmap requires a sbix or CBLC/CBDT table")
+	return nil, "", ErrRequiredTableMissing{Tag: "CBLC"}
+}
+
+// betterStrike returns true if a strike of `strikePpem` is a better match for rendering at `ppem` than the best
+// strike so far of `bestPpem`: the smallest strike with at least `ppem`, or the largest strike otherwise.
+func betterStrike(strikePpem, bestPpem, ppem uint16, first bool) bool {
+	switch {
+	case first:
+		return true
+	case bestPpem >= ppem:
+		return strikePpem >= ppem && strikePpem < bestPpem
+	default:
+		return strikePpem > bestPpem
+	}
+}
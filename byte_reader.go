@@ -7,10 +7,10 @@ package unitype
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"io"
-
-	"github.com/sirupsen/logrus"
+	"sync"
 )
 
 // byteReader encapsulates io.ReadSeeker with buffering and provides methods to read binary data as
@@ -19,15 +19,49 @@ import (
 type byteReader struct {
 	rs     io.ReadSeeker
 	reader *bufio.Reader
+	size   int64  // size of the data in bytes, -1 if unknown.
+	mapped []byte // the data of `rs` if memory mapped, referenced by readAt without copying.
 }
 
 func newByteReader(rs io.ReadSeeker) *byteReader {
 	return &byteReader{
 		rs:     rs,
 		reader: bufio.NewReader(rs),
+		size:   seekerSize(rs),
 	}
 }
 
+// seekerSize returns the size of the data of `rs` in bytes, or -1 if it cannot be determined. The offset of `rs`
+// is left unchanged.
+func seekerSize(rs io.ReadSeeker) int64 {
+	cur, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	_, err = rs.Seek(cur, io.SeekStart)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// checkRemaining returns io.ErrUnexpectedEOF if fewer than `n` bytes remain after the current offset of `r`. It is
+// used to check lengths and counts read from the font data before allocating for them.
+func (r byteReader) checkRemaining(n int64) error {
+	if n < 0 {
+		return io.ErrUnexpectedEOF
+	}
+	if r.size >= 0 && n > r.size-r.Offset() {
+		logger.Debugf("Length %d exceeds the remaining data (%d bytes)", n, r.size-r.Offset())
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
 // Offset returns current offset position of `r`.
 func (r byteReader) Offset() int64 {
 	offset, _ := r.rs.Seek(0, io.SeekCurrent)
@@ -35,16 +69,66 @@ func (r byteReader) Offset() int64 {
 	return offset
 }
 
-// SeekTo seeks to offset.
+// SeekTo seeks to offset. Offsets within the buffered data are reached by discarding the data before them,
+// otherwise the buffer is refilled from `offset` of the underlying data.
 func (r *byteReader) SeekTo(offset int64) error {
+	if cur := r.Offset(); offset >= cur && offset-cur <= int64(r.reader.Buffered()) {
+		_, err := r.reader.Discard(int(offset - cur))
+		return err
+	}
 	_, err := r.rs.Seek(offset, io.SeekStart)
 	if err != nil {
 		return err
 	}
-	r.reader = bufio.NewReader(r.rs)
+	r.reader.Reset(r.rs)
 	return nil
 }
 
+// readAt reads `length` bytes at `offset` of the data of `r`. The data is read positionally without changing the
+// offset of `r` if it supports io.ReaderAt, which is safe for concurrent use. Otherwise `r` seeks to `offset`
+// while holding `mu`.
+func (r *byteReader) readAt(mu *sync.Mutex, offset int64, length int) ([]byte, error) {
+	if length < 0 || (r.size >= 0 && (offset < 0 || int64(length) > r.size-offset)) {
+		logger.Debugf("Range %d (%d bytes) exceeds the data (%d bytes)", offset, length, r.size)
+		return nil, io.ErrUnexpectedEOF
+	}
+	if r.mapped != nil {
+		return r.mapped[offset : offset+int64(length) : offset+int64(length)], nil
+	}
+	if ra, ok := r.rs.(io.ReaderAt); ok {
+		data := make([]byte, length)
+		n, err := ra.ReadAt(data, offset)
+		if n < length {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return data, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = r.readBytes(&data, length)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// detach detaches `r` from its data, which is then empty.
+func (r *byteReader) detach() {
+	r.rs = bytes.NewReader(nil)
+	r.reader = bufio.NewReader(r.rs)
+	r.size = 0
+	r.mapped = nil
+}
+
 // Skip skips over `n` bytes.
 func (r *byteReader) Skip(n int) error {
 	_, err := r.reader.Discard(n)
@@ -53,8 +137,12 @@ func (r *byteReader) Skip(n int) error {
 
 // readBytes reads bytes straight from `r`.
 func (r *byteReader) readBytes(bp *[]byte, length int) error {
+	err := r.checkRemaining(int64(length))
+	if err != nil {
+		return err
+	}
 	*bp = make([]byte, length)
-	_, err := io.ReadFull(r.reader, *bp)
+	_, err = io.ReadFull(r.reader, *bp)
 	if err != nil {
 		return err
 	}
@@ -64,50 +152,63 @@ func (r *byteReader) readBytes(bp *[]byte, length int) error {
 
 // readSlice reads a series of values into `slice` from `r` (big endian).
 func (r *byteReader) readSlice(slice interface{}, length int) error {
+	var size int64
+	switch slice.(type) {
+	case *[]uint8:
+		size = 1
+	case *[]uint16, *[]int16, *[]offset16:
+		size = 2
+	default:
+		size = 4
+	}
+	err := r.checkRemaining(size * int64(length))
+	if err != nil {
+		return err
+	}
+
+	// The values are read at once and decoded from the data read.
+	data := make([]byte, size*int64(length))
+	_, err = io.ReadFull(r.reader, data)
+	if err != nil {
+		return err
+	}
+
 	switch t := slice.(type) {
 	case *[]uint8:
-		for i := 0; i < length; i++ {
-			val, err := r.readUint8()
-			if err != nil {
-				return err
-			}
-			*t = append(*t, val)
-		}
+		*t = append(*t, data...)
 	case *[]uint16:
-		for i := 0; i < length; i++ {
-			val, err := r.readUint16()
-			if err != nil {
-				return err
-			}
-			*t = append(*t, val)
+		vals := append(*t, make([]uint16, length)...)
+		for i := range vals[len(*t):] {
+			vals[len(*t)+i] = binary.BigEndian.Uint16(data[2*i:])
 		}
+		*t = vals
 	case *[]int16:
-		for i := 0; i < length; i++ {
-			val, err := r.readInt16()
-			if err != nil {
-				return err
-			}
-			*t = append(*t, val)
+		vals := append(*t, make([]int16, length)...)
+		for i := range vals[len(*t):] {
+			vals[len(*t)+i] = int16(binary.BigEndian.Uint16(data[2*i:]))
 		}
+		*t = vals
+	case *[]uint32:
+		vals := append(*t, make([]uint32, length)...)
+		for i := range vals[len(*t):] {
+			vals[len(*t)+i] = binary.BigEndian.Uint32(data[4*i:])
+		}
+		*t = vals
 	case *[]offset16:
-		for i := 0; i < length; i++ {
-			val, err := r.readOffset16()
-			if err != nil {
-				return err
-			}
-			*t = append(*t, val)
+		vals := append(*t, make([]offset16, length)...)
+		for i := range vals[len(*t):] {
+			vals[len(*t)+i] = offset16(binary.BigEndian.Uint16(data[2*i:]))
 		}
+		*t = vals
 	case *[]offset32:
-		for i := 0; i < length; i++ {
-			val, err := r.readOffset32()
-			if err != nil {
-				return err
-			}
-			*t = append(*t, val)
+		vals := append(*t, make([]offset32, length)...)
+		for i := range vals[len(*t):] {
+			vals[len(*t)+i] = offset32(binary.BigEndian.Uint32(data[4*i:]))
 		}
+		*t = vals
 
 	default:
-		logrus.Errorf("Unsupported type: %T (readSlice)", t)
+		logger.Debugf("Unsupported type: %T (readSlice)", t)
 		return errTypeCheck
 	}
 	return nil
@@ -201,6 +302,12 @@ func (r byteReader) read(fields ...interface{}) error {
 				return err
 			}
 			*t = val
+		case *uint24:
+			val, err := r.readUint24()
+			if err != nil {
+				return err
+			}
+			*t = val
 		case *uint32:
 			val, err := r.readUint32()
 			if err != nil {
@@ -209,97 +316,119 @@ func (r byteReader) read(fields ...interface{}) error {
 			*t = val
 
 		default:
-			logrus.Errorf("Unsupported type: %T (read)", t)
+			logger.Debugf("Unsupported type: %T (read)", t)
 			return errTypeCheck
 		}
 	}
 	return nil
 }
 
-func (r byteReader) readF2dot14() (f2dot14, error) {
-	b := make([]byte, 2)
-	_, err := io.ReadFull(r.reader, b)
-	if err != nil {
-		return 0, err
+// next returns the next `n` bytes of `r` and advances past them. The bytes are those buffered by `r`, valid until
+// the next read, so reading does not allocate. `n` must not exceed the buffer size. As io.ReadFull, returns
+// io.EOF if no bytes are left and io.ErrUnexpectedEOF if fewer than `n` bytes are left.
+func (r byteReader) next(n int) ([]byte, error) {
+	b, err := r.reader.Peek(n)
+	if len(b) < n {
+		if len(b) > 0 && err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
 	}
-	u16 := binary.BigEndian.Uint16(b)
-	return f2dot14(u16), nil
+	_, err = r.reader.Discard(n)
+	return b, err
+}
+
+func (r byteReader) readF2dot14() (f2dot14, error) {
+	val, err := r.readUint16()
+	return f2dot14(val), err
 }
 
 func (r byteReader) readFixed() (fixed, error) {
-	var val fixed
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint32()
+	return fixed(val), err
 }
 
 func (r byteReader) readFword() (fword, error) {
-	var val fword
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint16()
+	return fword(val), err
 }
 
 func (r byteReader) readUint8() (uint8, error) {
-	var val uint8
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
 }
 
 func (r byteReader) readUint16() (uint16, error) {
-	var val uint16
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
 }
 
 func (r byteReader) readInt8() (int8, error) {
-	var val int8
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint8()
+	return int8(val), err
 }
 
 func (r byteReader) readInt16() (int16, error) {
-	var val int16
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint16()
+	return int16(val), err
 }
 
 func (r byteReader) readInt32() (int32, error) {
-	var val int32
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint32()
+	return int32(val), err
+}
+
+func (r byteReader) readUint24() (uint24, error) {
+	b, err := r.next(3)
+	if err != nil {
+		return 0, err
+	}
+	return uint24(b[0])<<16 | uint24(b[1])<<8 | uint24(b[2]), nil
 }
 
 func (r byteReader) readUint32() (uint32, error) {
-	var val uint32
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
 }
 
 func (r byteReader) readTag() (tag, error) {
 	var val tag
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	b, err := r.next(4)
+	if err != nil {
+		return val, err
+	}
+	copy(val[:], b)
+	return val, nil
 }
 
 func (r byteReader) readUfword() (ufword, error) {
-	var val ufword
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint16()
+	return ufword(val), err
 }
 
 func (r byteReader) readLongdatetime() (longdatetime, error) {
-	var val longdatetime
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return longdatetime(binary.BigEndian.Uint64(b)), nil
 }
 
 func (r byteReader) readOffset16() (offset16, error) {
-	var val offset16
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint16()
+	return offset16(val), err
 }
 
 func (r byteReader) readOffset32() (offset32, error) {
-	var val offset32
-	err := binary.Read(r.reader, binary.BigEndian, &val)
-	return val, err
+	val, err := r.readUint32()
+	return offset32(val), err
 }
@@ -9,8 +9,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
-
-	"github.com/sirupsen/logrus"
 )
 
 // byteWriter encapsulates io.Writer and provides methods to write binary data as fit for truetype fonts.
@@ -19,6 +17,7 @@ type byteWriter struct {
 	w          io.Writer
 	len        int64
 	flushedLen int64 // total length that has been flushed (written to w).
+	flushSize  int   // if > 0, writeBytes flushes the buffer once it holds at least flushSize bytes.
 
 	buffer bytes.Buffer
 }
@@ -48,44 +47,107 @@ func (w *byteWriter) bufferedLen() int {
 
 // checksum returns the checksum of the current buffer.
 func (w *byteWriter) checksum() uint32 {
-	var sum uint32
-
-	data := w.buffer.Bytes()
+	return tableChecksum(w.buffer.Bytes())
+}
 
-	if len(data) < 60 {
-		logrus.Debugf("Data: % X", data)
+// tableChecksum returns the checksum of table `data`: the sum of its big-endian 32-bit words, with the data
+// padded with zeros to a multiple of 4 bytes.
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	n := len(data) &^ 3
+	for i := 0; i < n; i += 4 {
+		sum += binary.BigEndian.Uint32(data[i:])
 	}
-	logrus.Debugf("Data length: %d", len(data))
-	sum = 0
-
-	for i := 0; i < len(data); i += 4 {
-		a := i
-		b := i + 4
-		if b > len(data) {
-			b = len(data)
-		}
+	if n < len(data) {
+		var last [4]byte
+		copy(last[:], data[n:])
+		sum += binary.BigEndian.Uint32(last[:])
+	}
+	return sum
+}
 
-		dup := make([]byte, 4)
-		copy(dup, data[a:b])
+// checksumWriter passes the data written to it through to `w`, computing the length and the checksum of the
+// data written since the last reset as it goes, see tableChecksum.
+type checksumWriter struct {
+	w     io.Writer
+	n     int64   // bytes written since the last reset.
+	total int64   // bytes written in total.
+	sum   uint32  // sum of the complete words written since the last reset.
+	tail  [4]byte // bytes of the incomplete last word.
+}
 
-		if b-a < 4 {
-			for j := 0; j < b-a; j++ {
-				dup = append(dup, 0) //
-			}
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.total += int64(n)
+	b := p[:n]
+	for len(b) > 0 && c.n%4 != 0 {
+		c.tail[c.n%4] = b[0]
+		b = b[1:]
+		c.n++
+		if c.n%4 == 0 {
+			c.sum += binary.BigEndian.Uint32(c.tail[:])
+			c.tail = [4]byte{}
 		}
+	}
+	for len(b) >= 4 {
+		c.sum += binary.BigEndian.Uint32(b)
+		b = b[4:]
+		c.n += 4
+	}
+	for _, v := range b {
+		c.tail[c.n%4] = v
+		c.n++
+	}
+	return n, err
+}
 
-		val := binary.BigEndian.Uint32(dup)
-		sum += val
+// checksum returns the checksum of the data written since the last reset.
+func (c *checksumWriter) checksum() uint32 {
+	if c.n%4 != 0 {
+		return c.sum + binary.BigEndian.Uint32(c.tail[:])
 	}
+	return c.sum
+}
 
-	return sum
+// pad writes zeros up to a multiple of 4 bytes since the last reset.
+func (c *checksumWriter) pad() error {
+	if pad := c.n % 4; pad != 0 {
+		_, err := c.Write(make([]byte, 4-pad))
+		return err
+	}
+	return nil
 }
 
-// writeBytes writes the bytes straight to the buffer.
+// reset starts the length and checksum computation anew, such as for the next table.
+func (c *checksumWriter) reset() {
+	c.n = 0
+	c.sum = 0
+	c.tail = [4]byte{}
+}
+
+// flushPadded pads the buffer with zeros to a multiple of 4 bytes, as tables are aligned to 4 byte
+// boundaries in the font file, and flushes it.
+func (w *byteWriter) flushPadded() error {
+	if pad := w.buffer.Len() % 4; pad != 0 {
+		err := w.writeBytes(make([]byte, 4-pad))
+		if err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+// writeBytes writes the bytes straight to the buffer, flushing it if it exceeds the flush size.
 func (w *byteWriter) writeBytes(b []byte) error {
 	n, err := w.buffer.Write(b)
 	w.len += int64(n)
-	return err
+	if err != nil {
+		return err
+	}
+	if w.flushSize > 0 && w.buffer.Len() >= w.flushSize {
+		return w.flush()
+	}
+	return nil
 }
 
 func (w *byteWriter) writeSlice(slice interface{}) error {
@@ -136,7 +198,7 @@ func (w *byteWriter) writeSlice(slice interface{}) error {
 		}
 
 	default:
-		logrus.Errorf("Write type check error: %T (slice)", t)
+		logger.Debugf("Write type check error: %T (slice)", t)
 		return errTypeCheck
 	}
 	return nil
@@ -191,6 +253,11 @@ func (w *byteWriter) write(fields ...interface{}) error {
 			if err != nil {
 				return err
 			}
+		case uint24:
+			err := w.writeUint24(t)
+			if err != nil {
+				return err
+			}
 		case uint32:
 			err := w.writeUint32(t)
 			if err != nil {
@@ -203,7 +270,7 @@ func (w *byteWriter) write(fields ...interface{}) error {
 			}
 
 		default:
-			logrus.Errorf("Write type check error: %T", t)
+			logger.Debugf("Write type check error: %T", t)
 			return errTypeCheck
 		}
 	}
@@ -274,6 +341,15 @@ func (w *byteWriter) writeInt16(vals ...int16) error {
 	return nil
 }
 
+func (w *byteWriter) writeUint24(val uint24) error {
+	_, err := w.buffer.Write([]byte{byte(val >> 16), byte(val >> 8), byte(val)})
+	if err != nil {
+		return err
+	}
+	w.len += 3
+	return nil
+}
+
 func (w *byteWriter) writeUint32(val uint32) error {
 	err := binary.Write(&w.buffer, binary.BigEndian, val)
 	if err != nil {
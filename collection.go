@@ -0,0 +1,267 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ttcHeader represents the header of a TrueType collection (ttcf).
+// Each font in the collection has its own offset table and table records, whereas the table data
+// can be shared between the fonts. Table offsets are from the start of the collection.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otff#font-collections
+type ttcHeader struct {
+	ttcTag       tag
+	majorVersion uint16
+	minorVersion uint16
+	numFonts     uint32
+	offsetTables []offset32 // offsets of the offset tables of the fonts.
+}
+
+func parseTTCHeader(r *byteReader) (*ttcHeader, error) {
+	h := &ttcHeader{}
+	err := r.read(&h.ttcTag, &h.majorVersion, &h.minorVersion, &h.numFonts)
+	if err != nil {
+		return nil, err
+	}
+	if h.ttcTag.String() != "ttcf" {
+		logger.Debugf("Invalid collection tag: %s", h.ttcTag.String())
+		return nil, errTypeCheck
+	}
+	// Limit to what the font data could possibly hold to avoid excessive allocation.
+	if h.numFonts > 0xFFFF {
+		logger.Debugf("Number of fonts in collection out of range: %d", h.numFonts)
+		return nil, errRangeCheck
+	}
+	err = r.readSlice(&h.offsetTables, int(h.numFonts))
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ParseCollection parses all fonts of the TrueType collection (.ttc) in `rs`. The returned fonts are
+// independent of each other and behave like fonts loaded by Parse, e.g. they can be subset and written
+// out as standalone .ttf files.
+// For convenience, a single TrueType font is returned as a collection of one font.
+func ParseCollection(rs io.ReadSeeker) ([]*Font, error) {
+	h, err := parseCollectionHeader(rs)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		fnt, err := Parse(rs)
+		if err != nil {
+			return nil, err
+		}
+		return []*Font{fnt}, nil
+	}
+
+	fonts := make([]*Font, len(h.offsetTables))
+	for i, offset := range h.offsetTables {
+		fonts[i], err = parseCollectionFont(rs, int64(offset), ParseOptions{})
+		if err != nil {
+			logger.Debugf("Error parsing font %d of collection: %v", i, err)
+			return nil, err
+		}
+	}
+	return fonts, nil
+}
+
+// ParseCollectionFile parses all fonts of the TrueType collection given by `filePath`.
+// See ParseCollection.
+func ParseCollectionFile(filePath string) ([]*Font, error) {
+	// Loaded in memory as the file remains the source of the table data, see Font.TableBytes.
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCollection(bytes.NewReader(data))
+}
+
+// ParseCollectionFont parses the font at `index` of the TrueType collection in `rs`, without loading the
+// other fonts of the collection. A single TrueType font is treated as a collection of one font.
+func ParseCollectionFont(rs io.ReadSeeker, index int) (*Font, error) {
+	h, err := parseCollectionHeader(rs)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		if index != 0 {
+			logger.Debugf("Font index out of range: %d (single font)", index)
+			return nil, errRangeCheck
+		}
+		return Parse(rs)
+	}
+
+	if index < 0 || index >= len(h.offsetTables) {
+		logger.Debugf("Font index out of range: %d (%d fonts)", index, len(h.offsetTables))
+		return nil, errRangeCheck
+	}
+	return parseCollectionFont(rs, int64(h.offsetTables[index]), ParseOptions{})
+}
+
+// parseCollectionHeader identifies the font format of `rs` and parses the collection header.
+// Returns a nil header if `rs` contains a single TrueType font.
+func parseCollectionHeader(rs io.ReadSeeker) (*ttcHeader, error) {
+	format, sig, err := sniffReader(rs)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case fontFormatCollection:
+	case fontFormatTrueType, fontFormatCFF:
+		return nil, nil
+	case fontFormatUnknown:
+		return nil, newUnsupportedSfntVersionError(sig)
+	default:
+		return nil, fmt.Errorf("unsupported font format: %s", format)
+	}
+
+	return parseTTCHeader(newByteReader(rs))
+}
+
+// parseCollectionFont parses the font with the offset table at `offset` in the collection `rs` with options
+// `opts`.
+func parseCollectionFont(rs io.ReadSeeker, offset int64, opts ParseOptions) (*Font, error) {
+	r := newByteReader(rs)
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig uint32
+	err = r.read(&sig)
+	if err != nil {
+		return nil, err
+	}
+	switch format := sniffFormat(sig); format {
+	case fontFormatTrueType, fontFormatCFF:
+	case fontFormatUnknown:
+		return nil, newUnsupportedSfntVersionError(sig)
+	default:
+		return nil, fmt.Errorf("unsupported font format in collection: %s", format)
+	}
+	err = r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	fnt, err := parseFontWithOptions(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newParsedFont(r, fnt), nil
+}
+
+// collectionTable represents the data of a table in a collection being written, shared by all fonts
+// with byte-equal data for the table.
+type collectionTable struct {
+	data     []byte
+	checksum uint32
+	offset   int64
+}
+
+// WriteCollection writes `fonts` to `w` as a TrueType collection (.ttc). Tables with identical data
+// across the fonts, such as cvt, fpgm or name, are stored once and shared by the fonts.
+// The checksum adjustment in the head table of each font is computed for the font written as a
+// standalone font, as it is not meaningful within a collection.
+func WriteCollection(w io.Writer, fonts []*Font) error {
+	if len(fonts) == 0 {
+		// Without fonts none of the tables are present, starting with the head table.
+		logger.Debugf("No fonts to write to collection")
+		return ErrRequiredTableMissing{Tag: "head"}
+	}
+
+	// Write each font standalone and collect the tables, sharing tables with equal data.
+	dirs := make([]*tableRecords, len(fonts))
+	ots := make([][]byte, len(fonts))
+	dirTables := make([][]*collectionTable, len(fonts)) // table of each record in dirs.
+	shared := map[string][]*collectionTable{}
+	var tables []*collectionTable
+	for i, fnt := range fonts {
+		sfnt, err := fnt.writeSfnt()
+		if err != nil {
+			return err
+		}
+		ots[i] = sfnt.data[:12]
+		dirs[i] = sfnt.trec
+
+		for _, tr := range sfnt.trec.list {
+			tdata := sfnt.tableData(tr)
+
+			var t *collectionTable
+			name := tr.tableTag.String()
+			for _, st := range shared[name] {
+				if st.checksum == tr.checksum && bytes.Equal(st.data, tdata) {
+					t = st
+					break
+				}
+			}
+			if t == nil {
+				t = &collectionTable{data: tdata, checksum: tr.checksum}
+				shared[name] = append(shared[name], t)
+				tables = append(tables, t)
+			} else {
+				logger.Debugf("Sharing table %s of font %d", name, i)
+			}
+			dirTables[i] = append(dirTables[i], t)
+		}
+	}
+
+	// Layout: header, table directories of the fonts and the table data, aligned to 4 bytes.
+	offset := int64(12 + 4*len(fonts))
+	dirOffsets := make([]offset32, len(fonts))
+	for i, trec := range dirs {
+		dirOffsets[i] = offset32(offset)
+		offset += int64(12 + 16*len(trec.list))
+	}
+	for _, t := range tables {
+		offset = (offset + 3) &^ 3
+		t.offset = offset
+		offset += int64(len(t.data))
+	}
+
+	bw := newByteWriter(w)
+	err := bw.write(makeTag("ttcf"), uint16(1), uint16(0), uint32(len(fonts)))
+	if err != nil {
+		return err
+	}
+	err = bw.writeSlice(dirOffsets)
+	if err != nil {
+		return err
+	}
+	for i, trec := range dirs {
+		err = bw.writeBytes(ots[i])
+		if err != nil {
+			return err
+		}
+		for j, tr := range trec.list {
+			tr.offset = offset32(dirTables[i][j].offset)
+			err = tr.write(bw)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range tables {
+		for bw.len%4 != 0 {
+			err = bw.writeBytes([]byte{0})
+			if err != nil {
+				return err
+			}
+		}
+		err = bw.writeBytes(t.data)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.flush()
+}
@@ -0,0 +1,176 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rebaseFontDirectory returns the offset table and table records of font `data` with the table offsets
+// moved by `delta`.
+func rebaseFontDirectory(data []byte, delta uint32) []byte {
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	dir := append([]byte(nil), data[:12+16*numTables]...)
+	for i := 0; i < numTables; i++ {
+		off := dir[12+16*i+8 : 12+16*i+12]
+		binary.BigEndian.PutUint32(off, binary.BigEndian.Uint32(off)+delta)
+	}
+	return dir
+}
+
+// buildTestCollection builds a collection of `fonts`, followed by a font that shares all tables with the
+// first font.
+func buildTestCollection(fonts ...[]byte) []byte {
+	numFonts := len(fonts) + 1
+	headerLen := 12 + 4*numFonts
+
+	var body bytes.Buffer
+	var offsets []uint32
+	for _, data := range fonts {
+		base := uint32(headerLen + body.Len())
+		offsets = append(offsets, base)
+		body.Write(rebaseFontDirectory(data, base))
+		numTables := int(binary.BigEndian.Uint16(data[4:6]))
+		body.Write(data[12+16*numTables:])
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	offsets = append(offsets, uint32(headerLen+body.Len()))
+	body.Write(rebaseFontDirectory(fonts[0], offsets[0]))
+
+	var buf bytes.Buffer
+	buf.WriteString("ttcf")
+	binary.Write(&buf, binary.BigEndian, []uint16{1, 0})
+	binary.Write(&buf, binary.BigEndian, uint32(numFonts))
+	binary.Write(&buf, binary.BigEndian, offsets)
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func TestParseCollection(t *testing.T) {
+	freeSans, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	roboto, err := ioutil.ReadFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	ttc := buildTestCollection(freeSans, roboto)
+
+	// Parse and ParseDataURI load the first font.
+	fnt, err := Parse(bytes.NewReader(ttc))
+	require.NoError(t, err)
+	numGlyphs, _ := fnt.NumGlyphs()
+	assert.Equal(t, 3726, numGlyphs)
+	fnt, err = ParseDataURI("data:font/collection;base64," + base64.StdEncoding.EncodeToString(ttc))
+	require.NoError(t, err)
+	numGlyphs, _ = fnt.NumGlyphs()
+	assert.Equal(t, 3726, numGlyphs)
+	invalid := [][]byte{
+		[]byte("ttcf\x00\x01\x00\x00"),                 // truncated header.
+		[]byte("ttcf\x00\x01\x00\x00\x00\x00\x00\x00"), // no fonts.
+	}
+	for _, data := range invalid {
+		_, err = Parse(bytes.NewReader(data))
+		assert.Error(t, err)
+	}
+
+	fonts, err := ParseCollection(bytes.NewReader(ttc))
+	require.NoError(t, err)
+	require.Len(t, fonts, 3)
+
+	expected := []int{3726, 1294, 3726}
+	for i, fnt := range fonts {
+		numGlyphs, _ := fnt.NumGlyphs()
+		assert.Equal(t, expected[i], numGlyphs, "font %d", i)
+
+		// Written out as a standalone font.
+		var buf bytes.Buffer
+		require.NoError(t, fnt.Write(&buf))
+		require.NoError(t, ValidateBytes(buf.Bytes()))
+		standalone, err := parseTestBytes(buf.Bytes())
+		require.NoError(t, err)
+		numGlyphs, _ = standalone.NumGlyphs()
+		assert.Equal(t, expected[i], numGlyphs, "font %d", i)
+	}
+
+	fnt, err = ParseCollectionFont(bytes.NewReader(ttc), 1)
+	require.NoError(t, err)
+	gid, ok := fnt.LookupRune('A')
+	require.True(t, ok)
+	subfnt, err := fnt.SubsetKeepRunes([]rune("A"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, subfnt.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	_, _, _, _, empty, err := subfnt.GlyphBBox(gid)
+	require.NoError(t, err)
+	assert.False(t, empty)
+
+	_, err = ParseCollectionFont(bytes.NewReader(ttc), 3)
+	assert.Equal(t, errRangeCheck, err)
+	_, err = ParseCollectionFont(bytes.NewReader(ttc), -1)
+	assert.Equal(t, errRangeCheck, err)
+
+	// Single fonts are treated as a collection of one font.
+	fonts, err = ParseCollection(bytes.NewReader(freeSans))
+	require.NoError(t, err)
+	require.Len(t, fonts, 1)
+	_, err = ParseCollectionFont(bytes.NewReader(freeSans), 1)
+	assert.Equal(t, errRangeCheck, err)
+}
+
+func TestWriteCollection(t *testing.T) {
+	freeSans, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	roboto, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	subset, err := freeSans.SubsetKeepRunes([]rune("abc"))
+	require.NoError(t, err)
+	// Reload as subsetting modifies the glyph data of the original.
+	freeSans, err = ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fonts := []*Font{freeSans, roboto, subset}
+
+	var standalone [][]byte
+	standaloneSize := 0
+	for _, fnt := range fonts {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.Write(&buf))
+		standalone = append(standalone, buf.Bytes())
+		standaloneSize += buf.Len()
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCollection(&buf, fonts))
+	assert.True(t, buf.Len() < standaloneSize)
+
+	parsed, err := ParseCollection(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, parsed, 3)
+	for i, fnt := range parsed {
+		for _, tr := range fnt.trec.list {
+			assert.Zero(t, tr.offset%4, "font %d table %s", i, tr.tableTag.String())
+		}
+
+		var fbuf bytes.Buffer
+		require.NoError(t, fnt.Write(&fbuf))
+		assert.Equal(t, standalone[i], fbuf.Bytes(), "font %d", i)
+	}
+
+	// Tables shared between the font and its subset.
+	for _, table := range []string{"name", "cvt", "GSUB", "GPOS"} {
+		assert.Equal(t, parsed[0].trec.trMap[table].offset, parsed[2].trec.trMap[table].offset, table)
+	}
+	assert.NotEqual(t, parsed[0].trec.trMap["glyf"].offset, parsed[2].trec.trMap["glyf"].offset)
+
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "head"}, WriteCollection(&buf, nil))
+}
@@ -0,0 +1,68 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"image/color"
+)
+
+// ForegroundPaletteIndex is the palette index of color layers that are drawn with the text foreground color
+// rather than a palette color.
+const ForegroundPaletteIndex = 0xFFFF
+
+// ColorLayer represents a layer of a color glyph: the glyph drawn and the index of its color in the palette.
+type ColorLayer struct {
+	GlyphIndex   GlyphIndex
+	PaletteIndex uint16 // ForegroundPaletteIndex for the text foreground color.
+}
+
+// ColorLayers returns the layers of the color glyph `gid` as defined in the COLR table, in order from
+// bottom to top. Returns nil if `gid` is not a color glyph, in which case it is rendered as a regular glyph.
+func (f *Font) ColorLayers(gid GlyphIndex) []ColorLayer {
+	if f.colr == nil {
+		return nil
+	}
+	layers := f.colr.glyphLayers(gid)
+	if len(layers) == 0 {
+		return nil
+	}
+	colorLayers := make([]ColorLayer, len(layers))
+	for i, l := range layers {
+		colorLayers[i] = ColorLayer{GlyphIndex: l.glyphID, PaletteIndex: l.paletteIndex}
+	}
+	return colorLayers
+}
+
+// ColorPalettes returns the color palettes of `f` as defined in the CPAL table. The palette indices of the
+// color layers index into the palettes, the first palette is the default. Returns nil if `f` has no palettes.
+func (f *Font) ColorPalettes() [][]color.NRGBA {
+	if f.cpal == nil {
+		return nil
+	}
+	palettes := make([][]color.NRGBA, len(f.cpal.palettes))
+	for i, palette := range f.cpal.palettes {
+		palettes[i] = make([]color.NRGBA, len(palette))
+		for j, c := range palette {
+			palettes[i][j] = color.NRGBA{R: c.red, G: c.green, B: c.blue, A: c.alpha}
+		}
+	}
+	return palettes
+}
+
+// GlyphSVG returns the SVG document defining the color glyph `gid` as per the SVG table, decompressed if gzip
+// compressed. A document may define several glyphs, the element of `gid` has the id "glyph<gid>", e.g.
+// "glyph12". Returns nil if `gid` is not an SVG glyph and an error if `f` has no SVG table.
+func (f *Font) GlyphSVG(gid GlyphIndex) ([]byte, error) {
+	if f.svg == nil {
+		logger.Debugf("GlyphSVG requires an SVG table")
+		return nil, ErrRequiredTableMissing{Tag: "SVG"}
+	}
+	doc := f.svg.glyphDoc(gid)
+	if doc == nil {
+		return nil, nil
+	}
+	return svgDecompress(doc)
+}
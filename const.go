@@ -9,8 +9,9 @@ import "errors"
 
 var (
 	errTypeCheck      = errors.New("type check error")
-	errRangeCheck     = errors.New("range check error")
+	errRangeCheck     = rangeCheckError{}
 	errInvalidContext = errors.New("invalid context")
 	errRequiredField  = errors.New("required field missing")
 	errNilReceiver    = errors.New("receiver pointer not initialized")
+	errNoGlyphNames   = errors.New("glyph names not available")
 )
@@ -0,0 +1,258 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FontDiff is the difference between two fonts A and B as computed by Diff. It is empty if the fonts are equal
+// as written.
+type FontDiff struct {
+	// OnlyInA and OnlyInB are the tags of the tables contained in only one of the fonts.
+	OnlyInA []string
+	OnlyInB []string
+	// ChangedTables are the tags of the tables contained in both fonts whose data differs as written, ignoring
+	// the checksumAdjustment field of the head table.
+	ChangedTables []string
+	// Fields are the differences of the fields of the head, hhea, maxp, OS/2 and post tables.
+	Fields []FieldDiff
+	// NumGlyphsA and NumGlyphsB are the number of glyphs of the fonts.
+	NumGlyphsA int
+	NumGlyphsB int
+	// Glyphs are the glyphs whose data in the glyf table differs in length.
+	Glyphs []GlyphDiff
+	// Advances are the glyphs whose advance width in the hmtx table differs.
+	Advances []AdvanceDiff
+	// Runes are the runes mapped to different glyphs by the cmap tables, or by only one of them.
+	Runes []RuneDiff
+}
+
+// FieldDiff is a field of a table that differs between two fonts. The field is named as in the OpenType
+// specification, e.g. "unitsPerEm" of the "head" table. The values are nil if the table is missing.
+type FieldDiff struct {
+	Table string
+	Field string
+	A     interface{}
+	B     interface{}
+}
+
+// GlyphDiff is a glyph whose data differs in length between two fonts.
+type GlyphDiff struct {
+	GID     GlyphIndex
+	LengthA int
+	LengthB int
+}
+
+// AdvanceDiff is a glyph whose advance width differs between two fonts.
+type AdvanceDiff struct {
+	GID GlyphIndex
+	A   uint16
+	B   uint16
+}
+
+// RuneDiff is a rune mapped differently by two fonts. InA and InB are false if the rune is not covered by the
+// respective font.
+type RuneDiff struct {
+	Rune rune
+	A    GlyphIndex
+	InA  bool
+	B    GlyphIndex
+	InB  bool
+}
+
+// Diff returns the differences between the fonts `a` and `b`, for finding out what an operation such as Subset
+// changed. The glyphs are compared by glyph index, so fonts whose glyphs were renumbered differ in all glyphs
+// following the first one renumbered. The per-glyph differences are limited to the glyphs contained in both
+// fonts, the difference in the number of glyphs is given by NumGlyphsA and NumGlyphsB.
+func Diff(a, b *Font) (*FontDiff, error) {
+	if a == nil || b == nil {
+		return nil, errors.New("nil font")
+	}
+
+	d := &FontDiff{}
+	err := d.diffTables(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []struct {
+		tag  string
+		a, b interface{}
+	}{
+		{"head", a.head, b.head},
+		{"hhea", a.hhea, b.hhea},
+		{"maxp", a.maxp, b.maxp},
+		{"OS/2", a.os2, b.os2},
+		{"post", a.post, b.post},
+	}
+	for _, t := range tables {
+		d.diffFields(t.tag, inspectFields(t.a), inspectFields(t.b))
+	}
+
+	d.NumGlyphsA, _ = a.NumGlyphs()
+	d.NumGlyphsB, _ = b.NumGlyphs()
+	numGlyphs := d.NumGlyphsA
+	if d.NumGlyphsB < numGlyphs {
+		numGlyphs = d.NumGlyphsB
+	}
+	if a.glyf != nil && b.glyf != nil {
+		for gid := 0; gid < numGlyphs && gid < len(a.glyf.descs) && gid < len(b.glyf.descs); gid++ {
+			lenA, lenB := a.glyf.descs[gid].size(), b.glyf.descs[gid].size()
+			if lenA != lenB {
+				d.Glyphs = append(d.Glyphs, GlyphDiff{GID: GlyphIndex(gid), LengthA: lenA, LengthB: lenB})
+			}
+		}
+	}
+	if a.hmtx != nil && b.hmtx != nil {
+		for gid := 0; gid < numGlyphs; gid++ {
+			advA := a.hmtx.getMetric(GlyphIndex(gid)).advanceWidth
+			advB := b.hmtx.getMetric(GlyphIndex(gid)).advanceWidth
+			if advA != advB {
+				d.Advances = append(d.Advances, AdvanceDiff{GID: GlyphIndex(gid), A: advA, B: advB})
+			}
+		}
+	}
+
+	d.diffRunes(a.runeLookupMap(), b.runeLookupMap())
+	return d, nil
+}
+
+// diffTables compares the tables of `a` and `b` as written.
+func (d *FontDiff) diffTables(a, b *Font) error {
+	sa, err := a.writeSfnt()
+	if err != nil {
+		return err
+	}
+	sb, err := b.writeSfnt()
+	if err != nil {
+		return err
+	}
+
+	for _, tr := range sa.trec.list {
+		tag := tr.tableTag.String()
+		trb, has := sb.trec.trMap[tag]
+		if !has {
+			d.OnlyInA = append(d.OnlyInA, tag)
+			continue
+		}
+		dataA, dataB := sa.tableData(tr), sb.tableData(trb)
+		if tag == "head" && len(dataA) >= 12 && len(dataB) >= 12 {
+			// Ignore checksumAdjustment, which differs whenever any table differs.
+			dataA = append(append([]byte(nil), dataA[:8]...), dataA[12:]...)
+			dataB = append(append([]byte(nil), dataB[:8]...), dataB[12:]...)
+		}
+		if !bytes.Equal(dataA, dataB) {
+			d.ChangedTables = append(d.ChangedTables, tag)
+		}
+	}
+	for _, tr := range sb.trec.list {
+		tag := tr.tableTag.String()
+		if _, has := sa.trec.trMap[tag]; !has {
+			d.OnlyInB = append(d.OnlyInB, tag)
+		}
+	}
+	return nil
+}
+
+// diffFields compares the fields `a` and `b` of table `tag`, either of which is nil if the table is missing.
+func (d *FontDiff) diffFields(tag string, a, b inspectObject) {
+	fields := a
+	if fields == nil {
+		fields = b
+	}
+	for i, field := range fields {
+		var valA, valB interface{}
+		if a != nil {
+			valA = a[i].value
+		}
+		if b != nil {
+			valB = b[i].value
+		}
+		if !reflect.DeepEqual(valA, valB) {
+			d.Fields = append(d.Fields, FieldDiff{Table: tag, Field: field.name, A: valA, B: valB})
+		}
+	}
+}
+
+// diffRunes compares the rune maps `a` and `b`.
+func (d *FontDiff) diffRunes(a, b map[rune]GlyphIndex) {
+	for r, gidA := range a {
+		gidB, has := b[r]
+		if !has || gidA != gidB {
+			d.Runes = append(d.Runes, RuneDiff{Rune: r, A: gidA, InA: true, B: gidB, InB: has})
+		}
+	}
+	for r, gidB := range b {
+		if _, has := a[r]; !has {
+			d.Runes = append(d.Runes, RuneDiff{Rune: r, B: gidB, InB: true})
+		}
+	}
+	sort.Slice(d.Runes, func(i, j int) bool {
+		return d.Runes[i].Rune < d.Runes[j].Rune
+	})
+}
+
+// Empty returns true if `d` has no differences.
+func (d *FontDiff) Empty() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.ChangedTables) == 0 && len(d.Fields) == 0 &&
+		d.NumGlyphsA == d.NumGlyphsB && len(d.Glyphs) == 0 && len(d.Advances) == 0 && len(d.Runes) == 0
+}
+
+// String returns the differences of `d`, one per line.
+func (d *FontDiff) String() string {
+	var b strings.Builder
+	if len(d.OnlyInA) > 0 {
+		fmt.Fprintf(&b, "tables only in a: %s\n", strings.Join(d.OnlyInA, ", "))
+	}
+	if len(d.OnlyInB) > 0 {
+		fmt.Fprintf(&b, "tables only in b: %s\n", strings.Join(d.OnlyInB, ", "))
+	}
+	if len(d.ChangedTables) > 0 {
+		fmt.Fprintf(&b, "tables changed: %s\n", strings.Join(d.ChangedTables, ", "))
+	}
+	for _, fd := range d.Fields {
+		fmt.Fprintf(&b, "%s.%s: %s != %s\n", fd.Table, fd.Field, formatDiffValue(fd.A), formatDiffValue(fd.B))
+	}
+	if d.NumGlyphsA != d.NumGlyphsB {
+		fmt.Fprintf(&b, "number of glyphs: %d != %d\n", d.NumGlyphsA, d.NumGlyphsB)
+	}
+	for _, gd := range d.Glyphs {
+		fmt.Fprintf(&b, "glyph %d: length %d != %d\n", gd.GID, gd.LengthA, gd.LengthB)
+	}
+	for _, ad := range d.Advances {
+		fmt.Fprintf(&b, "glyph %d: advance %d != %d\n", ad.GID, ad.A, ad.B)
+	}
+	for _, rd := range d.Runes {
+		fmt.Fprintf(&b, "rune %q (U+%04X): %s != %s\n", rd.Rune, rd.Rune,
+			formatDiffGlyph(rd.A, rd.InA), formatDiffGlyph(rd.B, rd.InB))
+	}
+	return b.String()
+}
+
+// formatDiffValue formats field value `v` for FontDiff.String. Long lists such as glyph names are summarized.
+func formatDiffValue(v interface{}) string {
+	if v == nil {
+		return "missing"
+	}
+	if values, ok := v.([]interface{}); ok && len(values) > 16 {
+		return fmt.Sprintf("[%d values]", len(values))
+	}
+	return fmt.Sprint(v)
+}
+
+// formatDiffGlyph formats the glyph `gid` a rune maps to for FontDiff.String.
+func formatDiffGlyph(gid GlyphIndex, has bool) string {
+	if !has {
+		return "missing"
+	}
+	return fmt.Sprintf("glyph %d", gid)
+}
@@ -0,0 +1,76 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	t.Run("Equal", func(t *testing.T) {
+		d, err := Diff(fnt, &Font{font: fnt.font.clone()})
+		require.NoError(t, err)
+		assert.True(t, d.Empty(), d.String())
+		assert.Equal(t, "", d.String())
+		assert.Equal(t, 3726, d.NumGlyphsA)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		gid, has := fnt.LookupRune('A')
+		require.True(t, has)
+		modified := &Font{font: fnt.font.clone()}
+		modified.hmtx.hMetrics[gid].advanceWidth += 10
+		modified.head.unitsPerEm = 2048
+
+		d, err := Diff(fnt, modified)
+		require.NoError(t, err)
+		assert.False(t, d.Empty())
+		assert.Equal(t, []string{"head", "hmtx"}, d.ChangedTables)
+		assert.Equal(t, []FieldDiff{{Table: "head", Field: "unitsPerEm", A: uint64(1000), B: uint64(2048)}}, d.Fields)
+		advance, err := fnt.GlyphAdvance(gid)
+		require.NoError(t, err)
+		assert.Equal(t, []AdvanceDiff{{GID: gid, A: advance, B: advance + 10}}, d.Advances)
+		assert.Empty(t, d.Glyphs)
+		assert.Empty(t, d.Runes)
+		assert.Contains(t, d.String(), "head.unitsPerEm: 1000 != 2048\n")
+		assert.Contains(t, d.String(), "tables changed: head, hmtx\n")
+	})
+
+	t.Run("Subset", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepRunes([]rune("AB"))
+		require.NoError(t, err)
+		err = subfnt.PruneTables("GSUB")
+		require.NoError(t, err)
+
+		d, err := Diff(fnt, subfnt)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"GSUB"}, d.OnlyInA)
+		assert.Empty(t, d.OnlyInB)
+		assert.Contains(t, d.ChangedTables, "glyf")
+		assert.Contains(t, d.ChangedTables, "maxp")
+		assert.Equal(t, 3726, d.NumGlyphsA)
+		assert.Equal(t, subfnt.maxp.numGlyphs, uint16(d.NumGlyphsB))
+		assert.Contains(t, d.String(), "tables only in a: GSUB\n")
+
+		// The runes kept map to the same glyphs, as the glyph indices are kept.
+		gid, has := fnt.LookupRune('A')
+		require.True(t, has)
+		for _, rd := range d.Runes {
+			assert.NotEqual(t, 'A', rd.Rune)
+			assert.NotEqual(t, 'B', rd.Rune)
+			assert.True(t, rd.InA)
+			assert.False(t, rd.InB)
+		}
+		assert.Contains(t, d.String(), "rune 'C' (U+0043): glyph ")
+		assert.Equal(t, gid, subfnt.runeLookupMap()['A'])
+	})
+}
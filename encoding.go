@@ -9,8 +9,6 @@ import (
 	"encoding/binary"
 	"unicode/utf8"
 
-	"github.com/sirupsen/logrus"
-
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/japanese"
@@ -77,6 +75,10 @@ const (
 func getCmapEncoding(platformID, encodingID int) cmapEncoding {
 	switch platformID {
 	case platformIDUnicode:
+		if encodingID == 4 || encodingID == 6 {
+			// Unicode full repertoire.
+			return cmapEncodingUCS4
+		}
 		return cmapEncodingUCS2
 	case platformIDMacintosh:
 		return cmapEncodingMacRoman
@@ -99,7 +101,7 @@ func getCmapEncoding(platformID, encodingID int) cmapEncoding {
 			return cmapEncodingUCS4
 		}
 	}
-	logrus.Debugf("Unsupported: PlatformID=%d, EncodingID=%d", platformID, encodingID)
+	logger.Debugf("Unsupported: PlatformID=%d, EncodingID=%d", platformID, encodingID)
 
 	return cmapEncodingUnsupported
 }
@@ -148,7 +150,7 @@ func (e cmapEncoding) GetRuneDecoder() runeDecoder {
 	}
 
 	if d == nil {
-		logrus.Debugf("ERROR: Unsupported encoding (%d) - returning charcodes as runes", e)
+		logger.Debugf("ERROR: Unsupported encoding (%d) - returning charcodes as runes", e)
 		d = unicode.UTF8.NewDecoder()
 		charcodeBytes = 1
 	}
@@ -177,7 +179,7 @@ func (d runeDecoder) ToBytes(charcode uint32) []byte {
 	case 4:
 		binary.BigEndian.PutUint32(b, charcode)
 	default:
-		logrus.Debugf("ERROR: Unsupported number of bytes per charcode: %d", d.charcodeBytes)
+		logger.Debugf("ERROR: Unsupported number of bytes per charcode: %d", d.charcodeBytes)
 		return []byte{0}
 	}
 
@@ -189,7 +191,7 @@ func (d runeDecoder) DecodeRune(b []byte) rune {
 	// Get decoded bytes (the decoder decodes to UTF8 byte format).
 	decoded, err := d.Bytes(b)
 	if err != nil {
-		logrus.Debugf("Decoding error: %v", err)
+		logger.Debugf("Decoding error: %v", err)
 	}
 
 	// TODO(gunnsth): Benchmark utf8.DecodeRune vs string().
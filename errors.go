@@ -0,0 +1,191 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The errors returned by the package can be distinguished with errors.Is and errors.As, e.g. to tell fonts
+// that do not cover a rune from corrupt fonts:
+//
+//	var notFound unitype.ErrRuneNotFound
+//	if errors.As(err, &notFound) {
+//		// notFound.Rune is not covered by the font.
+//	} else if errors.Is(err, unitype.ErrInvalidOffset) {
+//		// The font data is corrupt.
+//	}
+
+// ErrInvalidOffset is matched by the errors of offsets and lengths in the font data that point outside of the
+// data, such as truncated tables or glyph locations beyond the glyf table.
+var ErrInvalidOffset = errors.New("invalid offset")
+
+// ErrLimitExceeded is matched by the errors of fonts exceeding the resource limits of ParseOptions, such as
+// tables larger than MaxTableSize.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// ErrRequiredTableMissing is the error returned when a table required by an operation is missing.
+type ErrRequiredTableMissing struct {
+	Tag string
+}
+
+func (e ErrRequiredTableMissing) Error() string {
+	return fmt.Sprintf("required table missing: %s", e.Tag)
+}
+
+// ErrRuneNotFound is the error returned when a rune is not covered by a font.
+type ErrRuneNotFound struct {
+	Rune rune
+}
+
+func (e ErrRuneNotFound) Error() string {
+	return fmt.Sprintf("rune not found: %q (U+%04X)", e.Rune, e.Rune)
+}
+
+// ErrSubsettingNotAllowed is the error returned when subsetting a font whose embedding permissions do not
+// allow subsetting, see Font.EmbeddingPermissions and SubsetOptions.IgnoreEmbeddingPermissions.
+type ErrSubsettingNotAllowed struct {
+	// FsType is the fsType field of the OS/2 table of the font.
+	FsType uint16
+}
+
+func (e ErrSubsettingNotAllowed) Error() string {
+	return fmt.Sprintf("subsetting not allowed by embedding permissions (fsType 0x%04X)", e.FsType)
+}
+
+// ErrUnsupportedSfntVersion is the error returned when parsing font data whose sfnt version (the signature in the
+// first 4 bytes) is not supported, such as the PostScript Type 1 fonts in an sfnt wrapper of old Macintosh
+// systems ('typ1') or data that is not a font at all.
+type ErrUnsupportedSfntVersion struct {
+	Version uint32
+	// Tag is the version as a 4 character tag, e.g. "typ1", or empty if the version is not printable.
+	Tag string
+}
+
+// newUnsupportedSfntVersionError returns an ErrUnsupportedSfntVersion for the sfnt version `version`.
+func newUnsupportedSfntVersionError(version uint32) ErrUnsupportedSfntVersion {
+	e := ErrUnsupportedSfntVersion{Version: version}
+	var t tag
+	binary.BigEndian.PutUint32(t[:], version)
+	for _, c := range t {
+		if c < 0x20 || c > 0x7E {
+			return e
+		}
+	}
+	e.Tag = t.String()
+	return e
+}
+
+func (e ErrUnsupportedSfntVersion) Error() string {
+	if e.Version == signatureType1 {
+		return "unsupported font format: PostScript Type 1 outlines (sfnt version 'typ1')"
+	}
+	return fmt.Sprintf("unsupported font format: unknown signature 0x%08X", e.Version)
+}
+
+// ErrCFFOutlinesUnsupported is the error returned by operations that are not supported for fonts with CFF
+// outlines (sfnt version 'OTTO'), such as editing or scaling the glyphs.
+var ErrCFFOutlinesUnsupported = errors.New("CFF outlines not supported")
+
+// ErrChecksumMismatch is the error returned by validation when the checksum of a table does not match its
+// data. The Tag is empty when the checksum of the whole font (checksumAdjustment of the head table) is wrong.
+type ErrChecksumMismatch struct {
+	Tag string
+}
+
+func (e ErrChecksumMismatch) Error() string {
+	if e.Tag == "" {
+		return "file checksum mismatch"
+	}
+	return fmt.Sprintf("checksum incorrect: %s", e.Tag)
+}
+
+// offsetError is an error of an offset or length out of range, it matches ErrInvalidOffset.
+type offsetError struct {
+	msg string
+	err error // underlying error, may be nil.
+}
+
+// newOffsetError returns an offsetError with the message formatted from `format` and `a`.
+func newOffsetError(format string, a ...interface{}) error {
+	return &offsetError{msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *offsetError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("%v: %s", ErrInvalidOffset, e.msg)
+	}
+	return fmt.Sprintf("%v: %s: %v", ErrInvalidOffset, e.msg, e.err)
+}
+
+// Is returns true for ErrInvalidOffset.
+func (e *offsetError) Is(target error) bool {
+	return target == ErrInvalidOffset
+}
+
+// Unwrap returns the underlying error of `e`.
+func (e *offsetError) Unwrap() error {
+	return e.err
+}
+
+// rangeCheckError is the error of data out of range, such as truncated or corrupt font data, it matches
+// ErrInvalidOffset.
+type rangeCheckError struct{}
+
+func (rangeCheckError) Error() string {
+	return "range check error"
+}
+
+// Is returns true for ErrInvalidOffset.
+func (rangeCheckError) Is(target error) bool {
+	return target == ErrInvalidOffset
+}
+
+// contextError is an error with the context it occurred in, such as the tag of the table being parsed.
+type contextError struct {
+	context string
+	err     error
+}
+
+func (e *contextError) Error() string {
+	return fmt.Sprintf("%s: %v", e.context, e.err)
+}
+
+// Unwrap returns the underlying error of `e`.
+func (e *contextError) Unwrap() error {
+	return e.err
+}
+
+// wrapParseError returns `err`, an error parsing `what` with the reader at `offset`, wrapped with `what` as context.
+// Errors caused by reading past the end of the data are wrapped as ErrInvalidOffset errors.
+func wrapParseError(what string, offset int64, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = &offsetError{msg: fmt.Sprintf("data truncated at offset 0x%x", offset), err: err}
+	}
+	return &contextError{context: what, err: err}
+}
+
+// limitError is an error of a font exceeding a resource limit, it matches ErrLimitExceeded.
+type limitError struct {
+	msg string
+}
+
+// newLimitError returns a limitError with the message formatted from `format` and `a`.
+func newLimitError(format string, a ...interface{}) error {
+	return &limitError{msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrLimitExceeded, e.msg)
+}
+
+// Is returns true for ErrLimitExceeded.
+func (e *limitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
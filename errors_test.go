@@ -0,0 +1,209 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrors(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err := ParseBytes(data)
+	require.NoError(t, err)
+
+	t.Run("InvalidOffset", func(t *testing.T) {
+		_, err := ParseBytes(data[:len(data)/2])
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+
+		_, err = ParseBytes(data[:len(data)-100])
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+
+		// Glyph locations beyond the glyf table.
+		bad := append([]byte(nil), data...)
+		locaOffset := fnt.trec.trMap["loca"].offset
+		for i := 4; i < 8; i++ {
+			bad[int(locaOffset)+i] = 0xFF
+		}
+		err = ValidateBytes(bad)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+
+		// Truncated WOFF and WOFF2 data.
+		subfnt, err := fnt.SubsetKeepRunes([]rune("abc"))
+		require.NoError(t, err)
+		var woff, woff2 bytes.Buffer
+		require.NoError(t, subfnt.WriteWOFF(&woff))
+		require.NoError(t, subfnt.WriteWOFF2(&woff2))
+		for _, b := range [][]byte{woff.Bytes(), woff2.Bytes()} {
+			_, err = ParseBytes(b[:len(b)-1])
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+		}
+	})
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		bad[fnt.trec.trMap["name"].offset+20]++
+		err := ValidateBytes(bad)
+		require.Error(t, err)
+		var mismatch ErrChecksumMismatch
+		require.True(t, errors.As(err, &mismatch), "%v", err)
+		assert.Equal(t, "", mismatch.Tag)
+
+		// With the file checksum fixed.
+		report, err := ValidateBytesDetailed(bad)
+		require.NoError(t, err)
+		binary.BigEndian.PutUint32(bad[fnt.trec.trMap["head"].offset+8:], report.ExpectedChecksumAdjustment)
+		err = ValidateBytes(bad)
+		require.True(t, errors.As(err, &mismatch), "%v", err)
+		assert.Equal(t, ErrChecksumMismatch{Tag: "name"}, mismatch)
+		assert.False(t, errors.Is(err, ErrInvalidOffset))
+	})
+
+	t.Run("RuneNotFound", func(t *testing.T) {
+		_, err := fnt.SubsetKeepRunesStrict([]rune("ab中c"))
+		var notFound ErrRuneNotFound
+		require.True(t, errors.As(err, &notFound), "%v", err)
+		assert.Equal(t, '中', notFound.Rune)
+		assert.EqualError(t, err, `rune not found: '中' (U+4E2D)`)
+
+		subfnt, err := fnt.SubsetKeepRunesStrict([]rune("abc"))
+		require.NoError(t, err)
+		assert.True(t, subfnt.CoversRune('c'))
+	})
+
+	t.Run("RequiredTableMissing", func(t *testing.T) {
+		nomaxp := &Font{font: fnt.font.clone()}
+		nomaxp.maxp = nil
+		_, _, err := nomaxp.Subset([]GlyphIndex{1})
+		assert.True(t, errors.Is(err, ErrRequiredTableMissing{Tag: "maxp"}), "%v", err)
+		_, err = nomaxp.SubsetFirst(1)
+		var missing ErrRequiredTableMissing
+		require.True(t, errors.As(err, &missing), "%v", err)
+		assert.Equal(t, "maxp", missing.Tag)
+
+		// Tables required for parsing, renamed in the table directory.
+		for _, tag := range []string{"maxp", "hhea", "loca"} {
+			bad := append([]byte(nil), data...)
+			for i, tr := range fnt.trec.list {
+				if tr.tableTag.String() == tag {
+					copy(bad[12+16*i:], "zzzz")
+				}
+			}
+			_, err := ParseBytes(bad)
+			require.True(t, errors.As(err, &missing), "%s: %v", tag, err)
+			assert.Equal(t, tag, missing.Tag)
+		}
+
+		// Tables required for validation.
+		err = (&font{}).validate(nil)
+		require.True(t, errors.As(err, &missing), "%v", err)
+		assert.Equal(t, "head", missing.Tag)
+		nohmtx := &Font{font: fnt.font.clone()}
+		nohmtx.hmtx = nil
+		err = nohmtx.ValidateHhea()
+		require.True(t, errors.As(err, &missing), "%v", err)
+		assert.Equal(t, "hmtx", missing.Tag)
+
+		// Tables required by operations.
+		empty := &Font{font: &font{}}
+		_, instanceErr := empty.Instance(nil)
+		_, advanceErr := empty.GlyphAdvance(0)
+		_, _, _, _, _, bboxErr := empty.GlyphBBox(0)
+		_, outlineErr := empty.GlyphOutline(0)
+		_, svgErr := empty.GlyphSVG(0)
+		_, hvarErr := parseHvarData("VVAR", []byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+		_, _, bitmapErr := empty.GlyphBitmap(0, 16)
+		checks := []struct {
+			tag string
+			err error
+		}{
+			{"maxp", empty.RecomputeMaxp()},
+			{"hhea", empty.RecomputeHhea()},
+			{"OS/2", empty.RecomputeOS2Ranges()},
+			{"name", empty.ApplySubsetPrefix("ABCDEF+")},
+			{"fvar", instanceErr},
+			{"hmtx", advanceErr},
+			{"glyf", bboxErr},
+			{"glyf", outlineErr},
+			{"SVG", svgErr},
+			{"CBLC", bitmapErr},
+			{"VVAR", hvarErr},
+			{"head", WriteCollection(ioutil.Discard, nil)},
+		}
+		for _, c := range checks {
+			require.True(t, errors.As(c.err, &missing), "%s: %v", c.tag, c.err)
+			assert.Equal(t, c.tag, missing.Tag)
+		}
+	})
+}
+
+func TestParseErrorContext(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err := ParseBytes(data)
+	require.NoError(t, err)
+
+	// Segment count of the format 4 subtable.
+	cmapOffset := int64(fnt.trec.trMap["cmap"].offset)
+	var start int64
+	for _, enc := range fnt.cmap.encodingRecords {
+		offset := cmapOffset + int64(enc.offset)
+		if binary.BigEndian.Uint16(data[offset:]) == 4 {
+			start = offset
+			break
+		}
+	}
+	require.NotZero(t, start)
+	bad := append([]byte(nil), data...)
+	binary.BigEndian.PutUint16(bad[start+6:], 0)
+	_, err = ParseBytes(bad)
+	assert.EqualError(t, err, fmt.Sprintf("cmap: format 4 subtable at offset 0x%x: segment count 0 invalid", start))
+
+	// Truncated data.
+	tr := fnt.trec.trMap["glyf"]
+	_, err = ParseBytes(data[:tr.offset+100])
+	assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+	assert.EqualError(t, err, fmt.Sprintf("glyf: invalid offset: table at offset 0x%x with length %d outside data",
+		tr.offset, tr.length))
+
+	tr = fnt.trec.trMap["name"]
+	bad = append([]byte(nil), data...)
+	binary.BigEndian.PutUint16(bad[tr.offset+2:], 0xFFFF)
+	_, err = ParseBytes(bad)
+	assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+	assert.Regexp(t, `^name: invalid offset: data truncated at offset 0x[0-9a-f]+: EOF$`, err.Error())
+}
+
+func TestParseTrace(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	trace := fnt.ParseTrace()
+	require.Len(t, trace, len(fnt.trec.list))
+	assert.Equal(t, "head", trace[0].Tag)
+	assert.Equal(t, "maxp", trace[1].Tag)
+	tags := map[string]bool{}
+	for _, tt := range trace {
+		tr := fnt.trec.trMap[tt.Tag]
+		require.NotNil(t, tr, tt.Tag)
+		assert.Equal(t, int64(tr.offset), tt.Offset)
+		assert.Equal(t, int64(tr.length), tt.Length)
+		tags[tt.Tag] = true
+	}
+	assert.Len(t, tags, len(trace))
+}
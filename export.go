@@ -7,45 +7,235 @@ package unitype
 
 import (
 	"bytes"
-	"errors"
+	"encoding/binary"
+	"fmt"
 	"io"
-	"math"
+	"io/ioutil"
 	"os"
 	"sort"
-
-	"github.com/sirupsen/logrus"
+	"sync"
+	"unicode/utf8"
 )
 
 // Font wraps font for outside access.
+//
+// The methods reading a Font, such as LookupRune, GlyphAdvance, GlyphOutline, GlyphBBox, GlyphName and
+// TableBytes, are safe for concurrent use, including the glyph data loaded lazily (ParseOptions.LazyGlyphs).
+// The data parsed from is read positionally if it supports io.ReaderAt, as for ParseBytes, ParseFile and
+// ParseReaderAt, and under a lock otherwise. Methods modifying a Font, such as SetGlyph, SetNameRecord or
+// ScaleUnitsPerEm, and Write, which updates the loca table, must not be called concurrently with any other
+// method. Fonts derived from a Font, such as by Subset, are independent of it, except for the memory mapped
+// data of fonts parsed by ParseFileMmap.
 type Font struct {
-	br *byteReader
+	br   *byteReader
+	brMu *sync.Mutex // guards br, shared with the glyph data loaded lazily.
 	*font
+
+	cacheMu      sync.Mutex
+	runeMap      map[rune]GlyphIndex      // merged cmap for rune lookups, built on demand.
+	runeList     []rune                   // sorted runes of runeMap mapped to glyphs, built on demand.
+	glyphNameMap map[GlyphName]GlyphIndex // glyph name lookups, built on demand.
+
+	unmap func() error // unmaps the font data of fonts parsed by ParseFileMmap.
+
+	woffMetadata    []byte // extended metadata when loaded from WOFF or WOFF2.
+	woffPrivateData []byte // private data block when loaded from WOFF or WOFF2.
 }
 
 // Parse parses the truetype font from `rs` and returns a new Font.
+// Parse accepts sfnt fonts with TrueType outlines, OpenType fonts with CFF outlines ('OTTO')
+// and WOFF 1.0 and WOFF2 fonts. For TrueType collections (.ttc) the first font is returned,
+// see ParseCollection for the others. The format is identified from the signature at the start
+// of `rs`, a descriptive error is returned for unsupported formats.
 func Parse(rs io.ReadSeeker) (*Font, error) {
+	return ParseWithOptions(rs, ParseOptions{})
+}
+
+// ParseOptions represents options for parsing fonts.
+type ParseOptions struct {
+	// RepairLoca repairs invalid glyph data offsets in the loca table rather than failing: offsets beyond the
+	// glyf table are clamped to its end and glyphs with decreasing offsets are loaded as empty glyphs. The loca
+	// table is regenerated from the glyph data loaded. A loca table too short for maxp.numGlyphs is accepted with the
+	// glyphs not covered loaded as empty glyphs, see Font.Repair.
+	RepairLoca bool
+
+	// Lenient tolerates errors parsing the optional tables, such as a truncated name table or a corrupt post
+	// table: the table is left out as if absent and the error is recorded as a parse warning, see
+	// Font.ParseWarnings. Errors parsing the required tables (head, maxp and for TrueType outlines loca and glyf)
+	// are still returned, except for an invalid head magic number which is recorded as a warning, see Font.Repair.
+	Lenient bool
+
+	// MaxTableSize is the maximum size of a table in bytes, fonts with larger tables (compressed or not) are
+	// rejected. Defaults to DefaultMaxTableSize if 0.
+	MaxTableSize int64
+
+	// MaxNumGlyphs is the maximum number of glyphs, fonts with more glyphs are rejected. Defaults to 65535, the
+	// maximum number of glyphs of the maxp table, if 0.
+	MaxNumGlyphs int
+
+	// MaxCmapSegments is the maximum number of segments or groups of a cmap subtable, subtables with more are
+	// rejected. Defaults to DefaultMaxCmapSegments if 0.
+	MaxCmapSegments int
+
+	// LazyGlyphs defers reading the glyph data of the glyf table: only the locations of the glyphs are recorded
+	// when parsing and the data of each glyph is read from the font data parsed on first access, such as by
+	// GlyphOutline, Subset or Write. Reduces the memory used by large fonts when only the metadata or a few glyphs
+	// are needed. The font data must remain valid and unmodified while the Font is in use.
+	LazyGlyphs bool
+}
+
+// Default resource limits of ParseOptions.
+const (
+	DefaultMaxTableSize    = 256 << 20
+	DefaultMaxCmapSegments = 1 << 17
+)
+
+// maxTableSize returns the maximum table size of `opts`.
+func (opts ParseOptions) maxTableSize() int64 {
+	if opts.MaxTableSize <= 0 {
+		return DefaultMaxTableSize
+	}
+	return opts.MaxTableSize
+}
+
+// maxNumGlyphs returns the maximum number of glyphs of `opts`.
+func (opts ParseOptions) maxNumGlyphs() int {
+	if opts.MaxNumGlyphs <= 0 {
+		return 0xFFFF
+	}
+	return opts.MaxNumGlyphs
+}
+
+// maxCmapSegments returns the maximum number of segments of a cmap subtable of `opts`.
+func (opts ParseOptions) maxCmapSegments() int {
+	if opts.MaxCmapSegments <= 0 {
+		return DefaultMaxCmapSegments
+	}
+	return opts.MaxCmapSegments
+}
+
+// ParseWarning represents an error parsing a table that was tolerated in lenient mode.
+type ParseWarning struct {
+	Tag string // tag of the table left out, or of the required table with the error tolerated.
+	Err error
+}
+
+// String returns a description of `w`. The error includes the tag of the table.
+func (w ParseWarning) String() string {
+	return w.Err.Error()
+}
+
+// ParseWarnings returns the errors parsing tables that were tolerated when parsing `f` in lenient mode, the
+// tables of which were left out. Returns nil if `f` was parsed without errors.
+func (f *Font) ParseWarnings() []ParseWarning {
+	return append([]ParseWarning(nil), f.parseWarnings...)
+}
+
+// TableTrace represents the location of a table in the font data parsed, see Font.ParseTrace.
+type TableTrace struct {
+	Tag    string
+	Offset int64 // offset of the table in bytes.
+	Length int64 // length of the table in bytes.
+}
+
+// ParseTrace returns the locations of the tables of `f` in the order they were parsed, to help locating the data
+// of corrupt fonts. The offsets of fonts loaded from WOFF and WOFF2 files are in the decompressed font data.
+func (f *Font) ParseTrace() []TableTrace {
+	return append([]TableTrace(nil), f.parseTrace...)
+}
+
+// ParseWithOptions parses the font from `rs` with options `opts` and returns a new Font, as Parse.
+func ParseWithOptions(rs io.ReadSeeker, opts ParseOptions) (*Font, error) {
+	format, sig, err := sniffReader(rs)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case fontFormatTrueType, fontFormatCFF:
+	case fontFormatWOFF, fontFormatWOFF2:
+		data, err := ioutil.ReadAll(rs)
+		if err != nil {
+			return nil, err
+		}
+		if format == fontFormatWOFF {
+			return parseWOFFData(data, opts)
+		}
+		return parseWOFF2Data(data, opts)
+	case fontFormatCollection:
+		h, err := parseTTCHeader(newByteReader(rs))
+		if err != nil {
+			return nil, err
+		}
+		if len(h.offsetTables) == 0 {
+			logger.Debugf("Collection without fonts")
+			return nil, errRangeCheck
+		}
+		return parseCollectionFont(rs, int64(h.offsetTables[0]), opts)
+	case fontFormatUnknown:
+		return nil, newUnsupportedSfntVersionError(sig)
+	default:
+		return nil, fmt.Errorf("unsupported font format: %s", format)
+	}
+
 	r := newByteReader(rs)
 
-	fnt, err := parseFont(r)
+	fnt, err := parseFontWithOptions(r, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	return newParsedFont(r, fnt), nil
+}
+
+// newParsedFont returns the Font of `fnt` parsed from `br`. The glyph data loaded lazily is read from `br`
+// under the same lock as the table data.
+func newParsedFont(br *byteReader, fnt *font) *Font {
+	mu := &sync.Mutex{}
+	if fnt.glyf != nil {
+		for _, desc := range fnt.glyf.descs {
+			if desc.lazy != nil {
+				mu = desc.lazy.src.mu
+				break
+			}
+		}
+	}
 	return &Font{
-		br:   r,
+		br:   br,
+		brMu: mu,
 		font: fnt,
-	}, nil
+	}
+}
+
+// ParseBytes parses the font from `b` and returns a new Font. The font format is identified as by Parse.
+// The data is read directly from `b` without copying, so the returned Font may retain references to `b`:
+// `b` must not be modified while the Font is in use.
+func ParseBytes(b []byte) (*Font, error) {
+	if len(b) >= 4 {
+		switch sniffFormat(binary.BigEndian.Uint32(b)) {
+		case fontFormatWOFF:
+			return parseWOFFData(b, ParseOptions{})
+		case fontFormatWOFF2:
+			return parseWOFF2Data(b, ParseOptions{})
+		}
+	}
+	return Parse(bytes.NewReader(b))
+}
+
+// ParseReaderAt parses the font from the `size` bytes of `r` and returns a new Font, as Parse. Table data read
+// after parsing, such as by TableBytes, is read positionally from `r`, so `r` must remain valid and unmodified
+// while the Font is in use. Use ParseWithOptions with an io.SectionReader of `r` for parsing with options.
+func ParseReaderAt(r io.ReaderAt, size int64) (*Font, error) {
+	return Parse(io.NewSectionReader(r, 0, size))
 }
 
 // ParseFile parses the truetype font from file given by path.
 func ParseFile(filePath string) (*Font, error) {
-	f, err := os.Open(filePath)
+	// Loaded in memory as the file remains the source of the table data, see TableBytes.
+	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-
-	defer f.Close()
-	return Parse(f)
+	return Parse(bytes.NewReader(data))
 }
 
 // ValidateBytes validates the turetype font represented by the byte stream.
@@ -60,6 +250,31 @@ func ValidateBytes(b []byte) error {
 	return fnt.validate(br)
 }
 
+// ValidateBytesDetailed validates the truetype font represented by the byte stream and returns a report of
+// the checksums of the tables and of the whole font and of the findings of the structural checks, which are
+// not considered errors. The report covers missing required tables, checksum mismatches, invalid glyph data
+// offsets (loca), unordered cmap segments, metrics (hmtx) inconsistent with the number of glyphs and name
+// strings out of range.
+// An error is returned if the font cannot be parsed.
+func ValidateBytesDetailed(b []byte) (*ValidationReport, error) {
+	br := newByteReader(bytes.NewReader(b))
+	fnt, err := parseFontWithOptions(br, ParseOptions{RepairLoca: true})
+	if err != nil {
+		return nil, err
+	}
+	return fnt.validateDetailed(br)
+}
+
+// ValidateDetailed validates `f` as written by Write and returns a report of the findings, as
+// ValidateBytesDetailed. Use ValidateBytesDetailed to validate the data of a font file as is.
+func (f *Font) ValidateDetailed() (*ValidationReport, error) {
+	data, err := f.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return ValidateBytesDetailed(data)
+}
+
 // ValidateFile validates the truetype font given by `filePath`.
 func ValidateFile(filePath string) error {
 	f, err := os.Open(filePath)
@@ -80,184 +295,768 @@ func ValidateFile(filePath string) error {
 // GetCmap returns the specific cmap specified by `platformID` and platform-specific `encodingID`.
 // If not available, nil is returned. Used in PDF for decoding.
 func (f *Font) GetCmap(platformID, encodingID int) map[rune]GlyphIndex {
-	if f.cmap == nil {
+	subt := f.getCmapSubtable(platformID, encodingID)
+	if subt == nil {
 		return nil
 	}
+	return subt.cmap
+}
+
+// CmapID identifies a cmap subtable by its platform, platform-specific encoding and format.
+type CmapID struct {
+	PlatformID int
+	EncodingID int
+	Format     int
+}
+
+// GetBestCmap returns the rune to GID map of the most preferable cmap subtable of `f` along with
+// the identification of the chosen subtable. Unicode subtables are preferred, followed by the
+// Macintosh Roman and the Windows Symbol subtables. A full repertoire Unicode subtable, such as
+// format 12 (3,10), is chosen over the BMP-only subtables when it covers supplementary planes.
+// If the font has no usable cmap subtable, nil is returned.
+func (f *Font) GetBestCmap() (map[rune]GlyphIndex, CmapID) {
+	subts := f.cmapSubtablesByPreference()
+	if len(subts) == 0 {
+		return nil, CmapID{}
+	}
+	best := subts[0]
+	return best.cmap, CmapID{
+		PlatformID: best.platformID,
+		EncodingID: best.encodingID,
+		Format:     best.format,
+	}
+}
+
+// runeMaps returns the rune to GID maps of the cmap subtables of `f` in order of preference,
+// the first one being the map returned by GetBestCmap.
+func (f *Font) runeMaps() []map[rune]GlyphIndex {
+	var maps []map[rune]GlyphIndex
+	for _, subt := range f.cmapSubtablesByPreference() {
+		maps = append(maps, subt.cmap)
+	}
+	return maps
+}
+
+// runeLookupMap returns the merged rune to GID map of the cmap subtables of `f`. Each rune maps to
+// the GID of the first subtable containing it in the order of runeMaps. The codes 0xF000-0xF0FF of
+// a Windows Symbol (3,0) subtable are also mapped without the 0xF000 offset, as by convention symbol fonts
+// are addressed with the single byte codes. The map is built on first use and cached.
+func (f *Font) runeLookupMap() map[rune]GlyphIndex {
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
 
-	for _, subt := range f.cmap.subtables {
-		if subt.platformID == platformID && subt.encodingID == encodingID {
-			return subt.cmap
+	if f.runeMap != nil {
+		return f.runeMap
+	}
+	merged := map[rune]GlyphIndex{}
+	for _, cmap := range f.runeMaps() {
+		for r, gid := range cmap {
+			if _, has := merged[r]; !has {
+				merged[r] = gid
+			}
+		}
+	}
+	if subt := f.getCmapSubtable(3, 0); subt != nil {
+		for r, gid := range subt.cmap {
+			if r < 0xF000 || r > 0xF0FF {
+				continue
+			}
+			if _, has := merged[r-0xF000]; !has {
+				merged[r-0xF000] = gid
+			}
 		}
 	}
+	f.runeMap = merged
+	return merged
+}
 
-	return nil
+// IsSymbolic returns true if `f` is a symbol font, i.e. its characters are mapped by a Windows Symbol (3,0)
+// cmap subtable rather than a Unicode subtable. The characters of symbol fonts are looked up by their single
+// byte codes, e.g. LookupRune(0x41) for the code 0x41 mapped as 0xF041, and have no Unicode meaning.
+// PDF writers should set the Symbolic flag of the font descriptor for symbol fonts.
+func (f *Font) IsSymbolic() bool {
+	if f.getCmapSubtable(3, 0) == nil {
+		return false
+	}
+	for _, subt := range f.cmapSubtablesByPreference() {
+		if subt.platformID == platformIDUnicode || (subt.platformID == platformIDWindows && subt.encodingID != 0) {
+			return false
+		}
+	}
+	return true
 }
 
-// LookupRunes looks up each rune in `rune` and returns a matching slice of glyph indices.
-// When a rune is not found, a GID of 0 is used (notdef).
-func (f *Font) LookupRunes(runes []rune) []GlyphIndex {
-	var maps []map[rune]GlyphIndex
-	// Search order (3,1), (1,0), (0,3), (3,10).
-	maps = append(maps,
-		f.GetCmap(3, 1),
-		f.GetCmap(1, 0),
-		f.GetCmap(0, 3),
-		f.GetCmap(3, 10),
-	)
+// resetRuneLookupMap invalidates the cached rune lookup map, needed when the cmap of `f` is changed.
+func (f *Font) resetRuneLookupMap() {
+	f.cacheMu.Lock()
+	f.runeMap = nil
+	f.runeList = nil
+	f.cacheMu.Unlock()
+}
 
-	var indices []GlyphIndex
+// LookupRune returns the glyph index that `r` maps to. The cmap subtables are searched in the same
+// order as in SubsetKeepRunes, starting with the subtable returned by GetBestCmap. The codes below 0x100
+// are also looked up with the 0xF000 offset of symbol fonts, see IsSymbolic.
+// When `r` is not covered by the font, a GID of 0 (notdef) is returned with a false flag.
+func (f *Font) LookupRune(r rune) (GlyphIndex, bool) {
+	gid := f.runeLookupMap()[r]
+	return gid, gid != 0
+}
+
+// LookupRunes looks up each rune in `runes` and returns a matching slice of glyph indices.
+// When a rune is not found, a GID of 0 is used (notdef). The runes not covered by the font are
+// returned as well, in order of first occurrence in `runes`.
+func (f *Font) LookupRunes(runes []rune) ([]GlyphIndex, []rune) {
+	runeMap := f.runeLookupMap()
+
+	indices := make([]GlyphIndex, 0, len(runes))
+	var missing []rune
+	seen := map[rune]struct{}{}
 	for _, r := range runes {
-		index := GlyphIndex(0)
-		for _, cmap := range maps {
-			ind, has := cmap[r]
-			if has {
-				index = ind
-				break
+		gid := runeMap[r]
+		indices = append(indices, gid)
+		if gid != 0 {
+			continue
+		}
+		if _, has := seen[r]; !has {
+			seen[r] = struct{}{}
+			missing = append(missing, r)
+		}
+	}
+	return indices, missing
+}
+
+// CoversRune returns true if `r` maps to a glyph in `f`. The cmap subtables are searched in the
+// same order as in SubsetKeepRunes and a mapping to GID 0 (notdef) is not considered as covered.
+func (f *Font) CoversRune(r rune) bool {
+	_, found := f.LookupRune(r)
+	return found
+}
+
+// HasRune returns true if `r` maps to a glyph in `f`, as CoversRune. The lookup uses the merged cmap that is
+// built on first use and cached.
+func (f *Font) HasRune(r rune) bool {
+	return f.CoversRune(r)
+}
+
+// SupportedRunes returns the runes that map to a glyph in `f` in increasing order, i.e. the runes for which
+// HasRune returns true. The runes are deduplicated across the cmap subtables. For fonts with many runes such as
+// CJK fonts, RangeRunes avoids the copy of the runes.
+func (f *Font) SupportedRunes() []rune {
+	return append([]rune(nil), f.supportedRunes()...)
+}
+
+// CoverageCount returns the number of runes that map to a glyph in `f`, the length of SupportedRunes.
+func (f *Font) CoverageCount() int {
+	return len(f.supportedRunes())
+}
+
+// RangeRunes calls `fn` for each rune that maps to a glyph in `f` with the glyph it maps to, as looked up by
+// LookupRune. The runes are visited in increasing order as returned by SupportedRunes. Iteration stops if `fn`
+// returns false.
+func (f *Font) RangeRunes(fn func(r rune, gid GlyphIndex) bool) {
+	runeMap := f.runeLookupMap()
+	for _, r := range f.supportedRunes() {
+		if !fn(r, runeMap[r]) {
+			return
+		}
+	}
+}
+
+// supportedRunes returns the sorted runes of the merged cmap of `f` that map to a glyph other than notdef.
+// The runes are collected on first use and cached, the returned slice must not be modified.
+func (f *Font) supportedRunes() []rune {
+	runeMap := f.runeLookupMap()
+
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	if f.runeList != nil {
+		return f.runeList
+	}
+	runes := make([]rune, 0, len(runeMap))
+	for r, gid := range runeMap {
+		if gid != 0 {
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		return runes[i] < runes[j]
+	})
+	f.runeList = runes
+	return runes
+}
+
+// CoverageOf splits `runes` into the runes that are covered by `f` and the ones that are missing.
+// Useful for splitting text across fallback fonts. The order of `runes` is preserved in both slices.
+func (f *Font) CoverageOf(runes []rune) (covered, missing []rune) {
+	for _, r := range runes {
+		if _, found := f.LookupRune(r); found {
+			covered = append(covered, r)
+		} else {
+			missing = append(missing, r)
+		}
+	}
+	return covered, missing
+}
+
+// RangeCmap calls `fn` for each rune to GID mapping of the preferred Unicode cmap subtable of `f`,
+// searched in the same order as in SubsetKeepRunes. The runes are visited in increasing order.
+// Iteration stops if `fn` returns false.
+func (f *Font) RangeCmap(fn func(r rune, gid GlyphIndex) bool) {
+	for _, cmap := range f.runeMaps() {
+		if len(cmap) == 0 {
+			continue
+		}
+
+		runes := make([]rune, 0, len(cmap))
+		for r := range cmap {
+			runes = append(runes, r)
+		}
+		sort.Slice(runes, func(i, j int) bool {
+			return runes[i] < runes[j]
+		})
+
+		for _, r := range runes {
+			if !fn(r, cmap[r]) {
+				return
 			}
 		}
-		indices = append(indices, index)
+		return
 	}
-	logrus.Debugf("Runes: %+v %s", runes, string(runes))
-	logrus.Debugf("GIDs: %+v", indices)
-	return indices
+}
+
+// SetCmapFromMap replaces the cmap table of `f` with a table mapping the runes of `runeToGID`, e.g. to build
+// a cmap for glyphs that were renumbered. The table has a (3,1) format 4 subtable for the runes in the BMP and,
+// if any rune is beyond the BMP, a (3,10) format 12 subtable of all runes. The other subtables of the cmap,
+// such as Macintosh or format 14 subtables, are dropped.
+// An error is returned if a rune is not a valid Unicode code point, a glyph index is out of range or the
+// mappings do not fit in a format 4 subtable.
+func (f *Font) SetCmapFromMap(runeToGID map[rune]GlyphIndex) error {
+	for r, gid := range runeToGID {
+		if !utf8.ValidRune(r) {
+			return fmt.Errorf("invalid rune U+%04X", r)
+		}
+		if f.maxp != nil && int(gid) >= int(f.maxp.numGlyphs) {
+			return fmt.Errorf("rune %q maps to glyph %d out of range (%d glyphs)", r, gid, f.maxp.numGlyphs)
+		}
+	}
+
+	cmap, err := newUnicodeCmap(runeToGID)
+	if err != nil {
+		return err
+	}
+	f.cmap = cmap
+	f.markDirty("cmap")
+	f.resetRuneLookupMap()
+	return nil
+}
+
+// RunesForGlyph returns the runes that map to `gid` in any of the cmap subtables of `f`.
+// The runes of the preferred Unicode subtable come first (see GetBestCmap), followed by the runes
+// only found in the other subtables. Within each subtable the runes are in increasing order.
+// Returns nil if no rune maps to `gid`. Mappings to GID 0 (notdef) are ignored.
+func (f *Font) RunesForGlyph(gid GlyphIndex) []rune {
+	if gid == 0 {
+		return nil
+	}
+	return f.gidToRunes(func(g GlyphIndex) bool {
+		return g == gid
+	})[gid]
+}
+
+// GIDToRuneMap returns a map from each glyph index of `f` to the runes that map to it, as returned
+// by RunesForGlyph. More efficient than calling RunesForGlyph for every glyph when processing whole
+// fonts, e.g. for generating ToUnicode CMaps.
+func (f *Font) GIDToRuneMap() map[GlyphIndex][]rune {
+	return f.gidToRunes(func(g GlyphIndex) bool {
+		return true
+	})
+}
+
+// gidToRunes inverts the cmap subtables of `f` for the GIDs where `keep` returns true.
+func (f *Font) gidToRunes(keep func(gid GlyphIndex) bool) map[GlyphIndex][]rune {
+	gidRunes := map[GlyphIndex][]rune{}
+	seen := map[rune]map[GlyphIndex]bool{}
+	for _, subt := range f.cmapSubtablesAll() {
+		runes := make([]rune, 0, len(subt.cmap))
+		for r, gid := range subt.cmap {
+			if gid != 0 && keep(gid) {
+				runes = append(runes, r)
+			}
+		}
+		sort.Slice(runes, func(i, j int) bool {
+			return runes[i] < runes[j]
+		})
+
+		for _, r := range runes {
+			gid := subt.cmap[r]
+			if seen[r][gid] {
+				continue
+			}
+			if seen[r] == nil {
+				seen[r] = map[GlyphIndex]bool{}
+			}
+			seen[r][gid] = true
+			gidRunes[gid] = append(gidRunes[gid], r)
+		}
+	}
+	return gidRunes
+}
+
+// GetVariationGlyph returns the glyph index for the Unicode variation sequence consisting of `base`
+// followed by the variation selector `selector`, as specified by the format 14 cmap subtable.
+// Default variation sequences resolve to the glyph of `base` in the Unicode cmap.
+// Returns false if the variation sequence is not supported by the font.
+func (f *Font) GetVariationGlyph(base, selector rune) (GlyphIndex, bool) {
+	if f.cmap == nil {
+		return 0, false
+	}
+
+	for _, key := range f.cmap.subtableKeys {
+		t, ok := f.cmap.subtables[key].ctx.(cmapSubtableFormat14)
+		if !ok {
+			continue
+		}
+		gid, isDefault, found := t.lookup(base, selector)
+		if !found {
+			continue
+		}
+		if isDefault {
+			gid, _ = f.LookupRune(base)
+		}
+		return gid, gid != 0
+	}
+	return 0, false
+}
+
+// GlyphName returns the PostScript name of the glyph `gid` as specified by the post table.
+// The standard Macintosh names (post format 1.0), the custom names (format 2.0) and the reordered
+// standard names (format 2.5) are supported. For fonts with CFF outlines without glyph names in the post
+// table, the names are taken from the CFF charset. An error is returned if the font has no glyph names,
+// or if `gid` is out of range.
+func (f *Font) GlyphName(gid GlyphIndex) (string, error) {
+	if (f.post == nil || len(f.post.glyphNames) == 0) && f.cff != nil {
+		name, err := f.cff.glyphName(gid)
+		return string(name), err
+	}
+	if f.post == nil || len(f.post.glyphNames) == 0 {
+		return "", errNoGlyphNames
+	}
+	if int(gid) >= len(f.post.glyphNames) {
+		logger.Debugf("GID out of range: %d >= %d", gid, len(f.post.glyphNames))
+		return "", errRangeCheck
+	}
+	return string(f.post.glyphNames[gid]), nil
+}
+
+// GlyphIndexByName returns the glyph index of the glyph named `name` in the post table, or in the CFF
+// charset for fonts with CFF outlines without glyph names in the post table.
+// If several glyphs share the name, the lowest glyph index is returned.
+// Returns false if no glyph has the name or the font has no glyph names.
+func (f *Font) GlyphIndexByName(name string) (GlyphIndex, bool) {
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+
+	if f.glyphNameMap == nil {
+		f.glyphNameMap = map[GlyphName]GlyphIndex{}
+		var names []GlyphName
+		if f.post != nil {
+			names = f.post.glyphNames
+		}
+		if len(names) == 0 && f.cff != nil {
+			names = f.cff.glyphNames()
+		}
+		for i, gname := range names {
+			if _, has := f.glyphNameMap[gname]; !has && gname != "" {
+				f.glyphNameMap[gname] = GlyphIndex(i)
+			}
+		}
+	}
+	gid, has := f.glyphNameMap[GlyphName(name)]
+	return gid, has
+}
+
+// resetGlyphNameMap invalidates the cached glyph name map, needed when the post table of `f` is changed.
+func (f *Font) resetGlyphNameMap() {
+	f.cacheMu.Lock()
+	f.glyphNameMap = nil
+	f.cacheMu.Unlock()
+}
+
+// SubsetOptions controls the subsetting by SubsetWithOptions.
+type SubsetOptions struct {
+	// RetainGIDs maintains the GIDs of the kept glyphs, emptying the glyphs not kept and removing the glyphs
+	// following the highest GID kept, as SubsetKeepIndices. Otherwise the kept glyphs are renumbered densely in their original order, as Subset.
+	RetainGIDs bool
+	// IncludeNotdef keeps the outline of the glyph 0 (notdef). The glyph is always kept, as it is required
+	// by rasterizers as fallback, but with an empty outline unless IncludeNotdef is set.
+	IncludeNotdef bool
+	// PruneCmap drops the cmap table, e.g. for fonts embedded in PDF documents where the glyphs are
+	// referenced by GID.
+	PruneCmap bool
+	// StripHinting removes the TrueType hinting instructions, see StripHinting.
+	StripHinting bool
+	// DropNameTable drops the name table.
+	DropNameTable bool
+	// DropPostNames drops the glyph names of the post table, which is written as version 3.0, see also
+	// WriteOptions.DropGlyphNames. GlyphName returns an error for the subset font.
+	DropPostNames bool
+	// Closure also keeps the glyphs reachable through GSUB substitutions, see GlyphClosure.
+	Closure bool
+	// NoHmtxOptimization stores the advance width of every glyph in the hmtx table, rather than sharing the
+	// advance width of the last entry among the trailing glyphs of equal advance, for consumers that mishandle
+	// such glyphs.
+	NoHmtxOptimization bool
+	// IgnoreEmbeddingPermissions subsets fonts whose embedding permissions do not allow subsetting, e.g. when
+	// the legal owner granted permission. Otherwise an ErrSubsettingNotAllowed error is returned for them.
+	IgnoreEmbeddingPermissions bool
+	// KeepRawTables carries the tables that are not modelled and reference glyphs, such as GSUB, GPOS and GDEF,
+	// along verbatim when the glyphs are renumbered. Their glyph references are not updated, so they only
+	// remain valid if the consumer maps the GIDs itself. Otherwise these tables are dropped, see
+	// UnmodelledTables. They are always kept with RetainGIDs.
+	KeepRawTables bool
+}
+
+// SubsetWithOptions creates a subset of `f` including only the glyph indices `indices`, as controlled by
+// `opts`. Returns the new subsetted font and a map of the old to the new GIDs of the glyphs kept, which maps
+// the GIDs to themselves with RetainGIDs. The components of composite glyphs and the layer glyphs of color
+// glyphs (COLR) are always included. See SubsetKeepIndices and Subset for the handling of the tables.
+// An ErrSubsettingNotAllowed error is returned if the embedding permissions of `f` do not allow subsetting,
+// unless IgnoreEmbeddingPermissions is set. This applies to all the subsetting methods based on
+// SubsetWithOptions, such as SubsetKeepRunes and Subset.
+func (f *Font) SubsetWithOptions(indices []GlyphIndex, opts SubsetOptions) (*Font, map[GlyphIndex]GlyphIndex, error) {
+	if !opts.IgnoreEmbeddingPermissions && f.EmbeddingPermissions().NoSubsetting {
+		logger.Debugf("Embedding permissions do not allow subsetting (fsType 0x%04X)", f.os2.fsType)
+		return nil, nil, ErrSubsettingNotAllowed{FsType: f.os2.fsType}
+	}
+	if opts.Closure {
+		indices = f.GlyphClosure(indices)
+	}
+
+	var newf *Font
+	var oldnew map[GlyphIndex]GlyphIndex
+	var err error
+	if opts.RetainGIDs {
+		newf, oldnew, err = f.subsetRetainGIDs(indices)
+	} else {
+		newf, oldnew, err = f.subsetRenumber(indices, opts.KeepRawTables)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !opts.IncludeNotdef {
+		err = newf.emptyNotdef()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.StripHinting {
+		err = newf.StripHinting()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.PruneCmap {
+		newf.cmap = nil
+	}
+	if opts.DropNameTable {
+		newf.name = nil
+	}
+	if opts.DropPostNames && newf.post != nil {
+		newf.post = newf.post.withoutNames()
+	}
+	if opts.NoHmtxOptimization {
+		newf.expandHmtx()
+	}
+	return newf, oldnew, nil
+}
+
+// emptyNotdef replaces the outline of the glyph 0 (notdef) of `f` by an empty glyph.
+func (f *Font) emptyNotdef() error {
+	if f.glyf != nil && len(f.glyf.descs) > 0 {
+		// The glyph descriptions may be shared with other fonts, so replace rather than modify them.
+		descs := append([]*glyphDescription(nil), f.glyf.descs...)
+		descs[0] = &glyphDescription{}
+		f.glyf = &glyfTable{descs: descs}
+		err := f.updateLocaFormat()
+		if err != nil {
+			return err
+		}
+		f.updateHeadBBox()
+		f.recomputeMaxp()
+		f.recomputeHhea()
+	}
+	if f.cff != nil {
+		return f.setCFF(f.cff.stubGlyphs(func(gid GlyphIndex) bool {
+			return gid != 0
+		}))
+	}
+	return nil
 }
 
 // SubsetKeepRunes prunes data for all GIDs except the ones corresponding to `runes`.  The GIDs are
 // maintained. Typically reduces glyf table size significantly.
 func (f *Font) SubsetKeepRunes(runes []rune) (*Font, error) {
-	indices := f.LookupRunes(runes)
+	indices, _ := f.LookupRunes(runes)
 	return f.SubsetKeepIndices(indices)
 }
 
-// SubsetKeepIndices prunes data for all GIDs outside of `indices`. The GIDs are maintained.
-// This typically works well and is a simple way to prune most of the unnecessary data as the
-// glyf table is usually the biggest by far.
-func (f *Font) SubsetKeepIndices(indices []GlyphIndex) (*Font, error) {
-	newfnt := font{}
+// SubsetKeepRunesWithMap is like SubsetKeepRunes but also returns the GID that each rune of `runes`
+// resolved to. As the GIDs are maintained, the map applies to both `f` and the returned font.
+// Runes not covered by the font map to GID 0 (notdef).
+func (f *Font) SubsetKeepRunesWithMap(runes []rune) (*Font, map[rune]GlyphIndex, error) {
+	runeToGID := make(map[rune]GlyphIndex, len(runes))
+	indices := make([]GlyphIndex, 0, len(runes))
+	for _, r := range runes {
+		if _, has := runeToGID[r]; has {
+			continue
+		}
+		gid, _ := f.LookupRune(r)
+		runeToGID[r] = gid
+		indices = append(indices, gid)
+	}
 
-	// Expand the set of indices if any of the indices are composite
-	// glyphs depending on other glyphs.
-	gidIncludedMap := make(map[GlyphIndex]struct{}, len(indices))
-	for _, gid := range indices {
-		gidIncludedMap[gid] = struct{}{}
+	subfnt, err := f.SubsetKeepIndices(indices)
+	if err != nil {
+		return nil, nil, err
 	}
+	return subfnt, runeToGID, nil
+}
 
-	toscan := make([]GlyphIndex, 0, len(gidIncludedMap))
-	for gid := range gidIncludedMap {
-		toscan = append(toscan, gid)
+// SubsetKeepRunesSkipMissing is like SubsetKeepRunes but also returns the runes that are not covered
+// by `f`, in order of first occurrence in `runes`. The notdef glyph (GID 0) is kept so that missing runes
+// can be rendered with it.
+func (f *Font) SubsetKeepRunesSkipMissing(runes []rune) (*Font, []rune, error) {
+	indices, missing := f.LookupRunes(runes)
+	if len(missing) > 0 {
+		logger.Debugf("Runes not covered by font: %+v", missing)
 	}
 
-	// Find dependencies of core sets of glyph, and expand until have all relations.
-	for len(toscan) > 0 {
-		var newgids []GlyphIndex
-		for _, gid := range toscan {
-			components, err := f.glyf.GetComponents(gid)
-			if err != nil {
-				logrus.Debugf("Error getting components for %d", gid)
-				return nil, err
-			}
-			for _, gid := range components {
-				if _, has := gidIncludedMap[gid]; !has {
-					gidIncludedMap[gid] = struct{}{}
-					newgids = append(newgids, gid)
-				}
+	subfnt, err := f.SubsetKeepIndices(indices)
+	if err != nil {
+		return nil, nil, err
+	}
+	return subfnt, missing, nil
+}
+
+// SubsetKeepRunesStrict is like SubsetKeepRunes but returns an ErrRuneNotFound error for the first rune of
+// `runes` that is not covered by `f` rather than mapping it to the notdef glyph.
+func (f *Font) SubsetKeepRunesStrict(runes []rune) (*Font, error) {
+	indices, missing := f.LookupRunes(runes)
+	if len(missing) > 0 {
+		logger.Debugf("Runes not covered by font: %+v", missing)
+		return nil, ErrRuneNotFound{Rune: missing[0]}
+	}
+	return f.SubsetKeepIndices(indices)
+}
+
+// SubsetKeepRunesWithClosure is like SubsetKeepRunes but also keeps the glyphs reachable from the glyphs
+// of `runes` through GSUB substitutions (see GlyphClosure), such as contextual forms and ligatures, so that
+// text shaped with the subset font renders the same as with `f`.
+func (f *Font) SubsetKeepRunesWithClosure(runes []rune) (*Font, error) {
+	indices, _ := f.LookupRunes(runes)
+	return f.SubsetKeepIndicesWithClosure(indices)
+}
+
+// RuneRange represents the inclusive range of runes from Lo to Hi, e.g. a Unicode block.
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+// Predefined rune ranges for SubsetKeepRuneRanges. The ranges can be combined by appending them.
+var (
+	// LatinBasic covers the Basic Latin, Latin-1 Supplement and General Punctuation blocks.
+	LatinBasic = []RuneRange{{0x0000, 0x007F}, {0x0080, 0x00FF}, {0x2000, 0x206F}}
+	// LatinExtended covers LatinBasic and the Latin Extended-A, Latin Extended-B and Latin Extended
+	// Additional blocks.
+	LatinExtended = append(append([]RuneRange(nil), LatinBasic...),
+		RuneRange{0x0100, 0x017F}, RuneRange{0x0180, 0x024F}, RuneRange{0x1E00, 0x1EFF})
+	// Cyrillic covers the Cyrillic and Cyrillic Supplement blocks.
+	Cyrillic = []RuneRange{{0x0400, 0x04FF}, {0x0500, 0x052F}}
+	// Greek covers the Greek and Coptic and Greek Extended blocks.
+	Greek = []RuneRange{{0x0370, 0x03FF}, {0x1F00, 0x1FFF}}
+)
+
+// SubsetKeepRuneRanges is like SubsetKeepRunes but keeps the glyphs of the runes within `ranges`, e.g.
+// append(LatinBasic, Greek...). The ranges are matched against the runes covered by `f` (see SupportedRunes),
+// so code points that are not covered are skipped. The components of composite glyphs are kept as well.
+// An error is returned if a range has its Lo above its Hi.
+func (f *Font) SubsetKeepRuneRanges(ranges []RuneRange) (*Font, error) {
+	for _, rr := range ranges {
+		if rr.Lo > rr.Hi {
+			return nil, fmt.Errorf("invalid rune range U+%04X-U+%04X", rr.Lo, rr.Hi)
+		}
+	}
+	var indices []GlyphIndex
+	f.RangeRunes(func(r rune, gid GlyphIndex) bool {
+		for _, rr := range ranges {
+			if r >= rr.Lo && r <= rr.Hi {
+				indices = append(indices, gid)
+				break
 			}
 		}
-		toscan = newgids
+		return true
+	})
+	return f.SubsetKeepIndices(indices)
+}
+
+// SubsetKeepIndicesWithClosure is like SubsetKeepIndices but also keeps the glyphs reachable from
+// `indices` through GSUB substitutions (see GlyphClosure).
+func (f *Font) SubsetKeepIndicesWithClosure(indices []GlyphIndex) (*Font, error) {
+	newf, _, err := f.SubsetWithOptions(indices, SubsetOptions{RetainGIDs: true, IncludeNotdef: true, Closure: true})
+	return newf, err
+}
+
+// SubsetKeepIndices prunes data for all GIDs outside of `indices`. The GIDs are maintained.
+// This typically works well and is a simple way to prune most of the unnecessary data as the
+// glyf table is usually the biggest by far. For fonts with CFF outlines the charstrings of the
+// non-included glyphs are replaced by empty glyphs. The layer glyphs of included color glyphs (COLR) are kept
+// along with them, the bitmap images (sbix, CBDT) and SVG documents of non-included glyphs are removed.
+// The glyph 0 (notdef) is always kept as it is required by rasterizers as fallback. The glyphs following the
+// highest GID kept are removed, so that the loca, hmtx and post tables only cover the GIDs up to it, which matters
+// for large CJK fonts. E.g. PDF CIDFontType2 fonts with an identity CIDToGIDMap work with the subset font as long
+// as all GIDs referenced were kept.
+// SubsetKeepIndices is SubsetWithOptions with RetainGIDs and IncludeNotdef set.
+func (f *Font) SubsetKeepIndices(indices []GlyphIndex) (*Font, error) {
+	newf, _, err := f.SubsetWithOptions(indices, SubsetOptions{RetainGIDs: true, IncludeNotdef: true})
+	return newf, err
+}
+
+// subsetRetainGIDs creates a subset of `f` with the glyphs of `indices`, maintaining the GIDs, see
+// SubsetKeepIndices. Returns the subset font and the GIDs kept, mapped to themselves.
+func (f *Font) subsetRetainGIDs(indices []GlyphIndex) (*Font, map[GlyphIndex]GlyphIndex, error) {
+	newfnt := font{}
+
+	// Expand the set of indices if any of the indices are composite
+	// glyphs depending on other glyphs.
+	gidIncludedMap, err := f.subsetClosure(indices)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	newfnt.ot = &offsetTable{}
-	*newfnt.ot = *f.font.ot
+	newfnt.ot = f.font.ot.Clone()
 
-	newfnt.trec = &tableRecords{}
-	*newfnt.trec = *f.font.trec
+	newfnt.trec = f.font.trec.Clone()
 
 	if f.font.head != nil {
-		newfnt.head = &headTable{}
-		*newfnt.head = *f.font.head
+		newfnt.head = f.font.head.Clone()
 	}
 
 	if f.font.maxp != nil {
-		newfnt.maxp = &maxpTable{}
-		*newfnt.maxp = *f.font.maxp
+		newfnt.maxp = f.font.maxp.Clone()
 	}
 
 	if f.font.hhea != nil {
-		newfnt.hhea = &hheaTable{}
-		*newfnt.hhea = *f.font.hhea
+		newfnt.hhea = f.font.hhea.Clone()
 	}
 
 	if f.font.hmtx != nil {
-		newfnt.hmtx = &hmtxTable{}
-		*newfnt.hmtx = *f.font.hmtx
+		newfnt.hmtx = f.font.hmtx.Clone()
 		newfnt.optimizeHmtx()
 	}
 
-	if f.font.glyf != nil && f.font.loca != nil {
-		newfnt.loca = &locaTable{}
-		newfnt.glyf = &glyfTable{}
-		*newfnt.glyf = *f.font.glyf
+	if f.font.vhea != nil && f.font.vmtx != nil {
+		newfnt.vhea = f.font.vhea.Clone()
+		newfnt.vmtx = f.font.vmtx.Clone()
+		newfnt.optimizeVmtx()
+	}
 
+	if f.font.glyf != nil && f.font.loca != nil {
 		// Empty glyf contents for non-included glyphs.
-		for i := range newfnt.glyf.descs {
-			if _, has := gidIncludedMap[GlyphIndex(i)]; has {
+		newfnt.glyf = &glyfTable{descs: make([]*glyphDescription, len(f.font.glyf.descs))}
+		for i, desc := range f.font.glyf.descs {
+			if _, has := gidIncludedMap[GlyphIndex(i)]; !has {
+				newfnt.glyf.descs[i] = &glyphDescription{}
 				continue
 			}
-
-			newfnt.glyf.descs[i].raw = nil
+			newfnt.glyf.descs[i] = desc.Clone()
 		}
 
 		// Update loca offsets.
-		isShort := f.font.head.indexToLocFormat == 0
-		if isShort {
-			newfnt.loca.offsetsShort = make([]offset16, len(newfnt.glyf.descs)+1)
-			newfnt.loca.offsetsShort[0] = f.font.loca.offsetsShort[0]
-		} else {
-			newfnt.loca.offsetsLong = make([]offset32, len(newfnt.glyf.descs)+1)
-			newfnt.loca.offsetsLong[0] = f.font.loca.offsetsLong[0]
-		}
-		for i, desc := range newfnt.glyf.descs {
-			if isShort {
-				newfnt.loca.offsetsShort[i+1] = newfnt.loca.offsetsShort[i] + offset16(len(desc.raw))/2
-			} else {
-				newfnt.loca.offsetsLong[i+1] = newfnt.loca.offsetsLong[i] + offset32(len(desc.raw))
-			}
+		err := newfnt.updateLocaFormat()
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
 	if f.font.prep != nil {
-		newfnt.prep = &prepTable{}
-		*newfnt.prep = *f.font.prep
+		newfnt.prep = f.font.prep.Clone()
 	}
 
 	if f.font.cvt != nil {
-		newfnt.cvt = &cvtTable{}
-		*newfnt.cvt = *f.font.cvt
+		newfnt.cvt = f.font.cvt.Clone()
 	}
 
 	if f.font.fpgm != nil {
-		newfnt.fpgm = &fpgmTable{}
-		*newfnt.fpgm = *f.font.fpgm
+		newfnt.fpgm = f.font.fpgm.Clone()
 	}
 
 	if f.font.name != nil {
-		newfnt.name = &nameTable{}
-		*newfnt.name = *f.font.name
+		newfnt.name = f.font.name.Clone()
 	}
 
 	if f.font.os2 != nil {
-		newfnt.os2 = &os2Table{}
-		*newfnt.os2 = *f.font.os2
+		newfnt.os2 = f.font.os2.Clone()
 	}
 
 	if f.font.post != nil {
-		newfnt.post = &postTable{}
-		*newfnt.post = *f.font.post
+		newfnt.post = f.font.post.Clone()
+	}
+
+	// Tables that are not modelled are carried along as the GIDs are maintained.
+	newfnt.rawTables = append([]*rawTable(nil), f.font.rawTables...)
+	newfnt.kern = f.font.kern
+	newfnt.gpos = f.font.gpos
+	newfnt.gsub = f.font.gsub
+
+	newfnt.cpal = f.font.cpal
+	newfnt.fvar = f.font.fvar
+	newfnt.avar = f.font.avar
+	if f.font.gvar != nil {
+		// Drop the variations of non-included glyphs.
+		newfnt.setGvar(f.font.gvar.stubGlyphs(func(gid GlyphIndex) bool {
+			_, has := gidIncludedMap[gid]
+			return has
+		}))
+	}
+
+	// Drop the color glyphs, bitmap images and SVG documents of non-included glyphs (GIDs unchanged).
+	keep := make(map[GlyphIndex]GlyphIndex, len(gidIncludedMap))
+	for gid := range gidIncludedMap {
+		keep[gid] = gid
+	}
+	if f.font.colr != nil {
+		newfnt.setColr(f.font.colr.selectGlyphs(keep))
+	}
+	if f.font.sbix != nil {
+		newfnt.setSbix(f.font.sbix.selectGlyphs(keep, int(f.font.maxp.numGlyphs)))
+	}
+	if f.font.cbdt != nil {
+		newfnt.setCbdt(f.font.cbdt.selectGlyphs(keep))
+	}
+	if f.font.svg != nil {
+		svg, err := f.font.svg.selectGlyphs(keep)
+		if err != nil {
+			return nil, nil, err
+		}
+		newfnt.setSVG(svg)
+	}
+
+	if f.font.cff != nil {
+		// Empty the charstrings of non-included glyphs.
+		err = newfnt.setCFF(f.font.cff.stubGlyphs(func(gid GlyphIndex) bool {
+			_, has := gidIncludedMap[gid]
+			return has
+		}))
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
 	if f.font.cmap != nil {
-		newfnt.cmap = &cmapTable{}
-		*newfnt.cmap = *f.font.cmap
+		// Only retain mappings to the kept glyphs.
+		newfnt.cmap = f.font.cmap.remap(keep)
 	}
 
 	subfnt := &Font{
@@ -274,38 +1073,82 @@ func (f *Font) SubsetKeepIndices(indices []GlyphIndex) (*Font, error) {
 	}
 	// Trim font down to only maximum needed glyphs without changing order.
 	maxNeededNum := int(maxgid) + 1
-	return subfnt.SubsetFirst(maxNeededNum)
+	if newfnt.maxp != nil && maxNeededNum < int(newfnt.maxp.numGlyphs) {
+		subfnt, err = subfnt.SubsetFirst(maxNeededNum)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// Also needed when the last glyph is kept and the font is not trimmed.
+	subfnt.updateHeadBBox()
+	subfnt.recomputeMaxp()
+	subfnt.recomputeHhea()
+
+	subfnt.updateOS2Ranges(func(gid GlyphIndex) bool {
+		_, has := gidIncludedMap[gid]
+		return has
+	})
+	return subfnt, keep, nil
+}
+
+// subsetClosure returns the set of glyphs kept when subsetting to `indices`, including the glyph 0 (notdef),
+// the layer glyphs of color glyphs and the components of composite glyphs. Indices out of range are ignored.
+func (f *font) subsetClosure(indices []GlyphIndex) (map[GlyphIndex]struct{}, error) {
+	indices = append([]GlyphIndex{0}, indices...)
+	if f.colr != nil {
+		indices = f.colr.closure(indices)
+	}
+	if f.glyf != nil {
+		return f.glyf.componentClosure(indices)
+	}
+
+	numGlyphs := 0
+	if f.maxp != nil {
+		numGlyphs = int(f.maxp.numGlyphs)
+	}
+	gidIncludedMap := make(map[GlyphIndex]struct{}, len(indices))
+	for _, gid := range indices {
+		if int(gid) >= numGlyphs {
+			logger.Debugf("GID out of range (%d >= %d) - ignoring", gid, numGlyphs)
+			continue
+		}
+		gidIncludedMap[gid] = struct{}{}
+	}
+	return gidIncludedMap, nil
 }
 
 // SubsetFirst creates a subset of `f` limited to only the first `numGlyphs` glyphs.
 // Prunes out the glyphs from the previous font beyond that number.
 // NOTE: If any of the first numGlyphs depend on later glyphs, it can lead to incorrect rendering.
+// At least the glyph 0 (notdef) is always kept.
 func (f *Font) SubsetFirst(numGlyphs int) (*Font, error) {
+	if f.maxp == nil {
+		logger.Debugf("SubsetFirst requires the maxp table")
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
+	}
+	if numGlyphs < 1 {
+		numGlyphs = 1
+	}
 	if int(f.maxp.numGlyphs) <= numGlyphs {
-		logrus.Debugf("Attempting to subset font with same number of glyphs - Ignoring, returning same back")
-		return f, nil
+		logger.Debugf("Attempting to subset font with same number of glyphs - Ignoring, returning a copy")
+		return &Font{font: f.font.clone()}, nil
 	}
 	newfnt := font{}
 
-	newfnt.ot = &offsetTable{}
-	*newfnt.ot = *f.font.ot
+	newfnt.ot = f.font.ot.Clone()
 
-	newfnt.trec = &tableRecords{}
-	*newfnt.trec = *f.font.trec
+	newfnt.trec = f.font.trec.Clone()
 
 	if f.font.head != nil {
-		newfnt.head = &headTable{}
-		*newfnt.head = *f.font.head
+		newfnt.head = f.font.head.Clone()
 	}
 
 	if f.font.maxp != nil {
-		newfnt.maxp = &maxpTable{}
-		*newfnt.maxp = *f.font.maxp
+		newfnt.maxp = f.font.maxp.Clone()
 		newfnt.maxp.numGlyphs = uint16(numGlyphs)
 	}
 	if f.font.hhea != nil {
-		newfnt.hhea = &hheaTable{}
-		*newfnt.hhea = *f.font.hhea
+		newfnt.hhea = f.font.hhea.Clone()
 
 		if newfnt.hhea.numberOfHMetrics > uint16(numGlyphs) {
 			newfnt.hhea.numberOfHMetrics = uint16(numGlyphs)
@@ -313,8 +1156,7 @@ func (f *Font) SubsetFirst(numGlyphs int) (*Font, error) {
 	}
 
 	if f.font.hmtx != nil {
-		newfnt.hmtx = &hmtxTable{}
-		*newfnt.hmtx = *f.font.hmtx
+		newfnt.hmtx = f.font.hmtx.Clone()
 
 		if len(newfnt.hmtx.hMetrics) > numGlyphs {
 			newfnt.hmtx.hMetrics = newfnt.hmtx.hMetrics[0:numGlyphs]
@@ -329,57 +1171,63 @@ func (f *Font) SubsetFirst(numGlyphs int) (*Font, error) {
 		newfnt.optimizeHmtx()
 	}
 
+	if f.font.vhea != nil && f.font.vmtx != nil {
+		newfnt.vhea = f.font.vhea.Clone()
+		newfnt.vmtx = f.font.vmtx.Clone()
+
+		if len(newfnt.vmtx.vMetrics) > numGlyphs {
+			newfnt.vmtx.vMetrics = newfnt.vmtx.vMetrics[0:numGlyphs]
+			newfnt.vmtx.topSideBearings = nil
+			newfnt.vhea.numOfLongVerMetrics = uint16(numGlyphs)
+		} else {
+			numKeep := numGlyphs - len(newfnt.vmtx.vMetrics)
+			if numKeep > len(newfnt.vmtx.topSideBearings) {
+				numKeep = len(newfnt.vmtx.topSideBearings)
+			}
+			newfnt.vmtx.topSideBearings = newfnt.vmtx.topSideBearings[0:numKeep]
+		}
+		newfnt.optimizeVmtx()
+	}
+
 	if f.font.glyf != nil && f.font.loca != nil {
-		newfnt.loca = &locaTable{}
 		newfnt.glyf = &glyfTable{
-			descs: f.font.glyf.descs[0:numGlyphs],
+			descs: make([]*glyphDescription, numGlyphs),
+		}
+		for i, desc := range f.font.glyf.descs[:numGlyphs] {
+			newfnt.glyf.descs[i] = desc.Clone()
 		}
 		// Update loca offsets.
-		isShort := f.font.head.indexToLocFormat == 0
-		if isShort {
-			newfnt.loca.offsetsShort = make([]offset16, numGlyphs+1)
-			newfnt.loca.offsetsShort[0] = f.font.loca.offsetsShort[0]
-		} else {
-			newfnt.loca.offsetsLong = make([]offset32, numGlyphs+1)
-			newfnt.loca.offsetsLong[0] = f.font.loca.offsetsLong[0]
-		}
-		for i, desc := range newfnt.glyf.descs {
-			if isShort {
-				newfnt.loca.offsetsShort[i+1] = newfnt.loca.offsetsShort[i] + offset16(len(desc.raw))/2
-			} else {
-				newfnt.loca.offsetsLong[i+1] = newfnt.loca.offsetsLong[i] + offset32(len(desc.raw))
-			}
+		err := newfnt.updateLocaFormat()
+		if err != nil {
+			return nil, err
 		}
+		newfnt.updateHeadBBox()
+		newfnt.recomputeMaxp()
 	}
+	newfnt.recomputeHhea()
 
 	if f.font.prep != nil {
-		newfnt.prep = &prepTable{}
-		*newfnt.prep = *f.font.prep
+		newfnt.prep = f.font.prep.Clone()
 	}
 
 	if f.font.cvt != nil {
-		newfnt.cvt = &cvtTable{}
-		*newfnt.cvt = *f.font.cvt
+		newfnt.cvt = f.font.cvt.Clone()
 	}
 
 	if f.font.fpgm != nil {
-		newfnt.fpgm = &fpgmTable{}
-		*newfnt.fpgm = *f.font.fpgm
+		newfnt.fpgm = f.font.fpgm.Clone()
 	}
 
 	if f.font.name != nil {
-		newfnt.name = &nameTable{}
-		*newfnt.name = *f.font.name
+		newfnt.name = f.font.name.Clone()
 	}
 
 	if f.font.os2 != nil {
-		newfnt.os2 = &os2Table{}
-		*newfnt.os2 = *f.font.os2
+		newfnt.os2 = f.font.os2.Clone()
 	}
 
 	if f.font.post != nil {
-		newfnt.post = &postTable{}
-		*newfnt.post = *f.font.post
+		newfnt.post = f.font.post.Clone()
 
 		if newfnt.post.numGlyphs > 0 {
 			newfnt.post.numGlyphs = uint16(numGlyphs)
@@ -395,133 +1243,72 @@ func (f *Font) SubsetFirst(numGlyphs int) (*Font, error) {
 		}
 	}
 
-	if f.font.cmap != nil {
-		newfnt.cmap = &cmapTable{
-			version:   f.cmap.version,
-			subtables: map[string]*cmapSubtable{},
-		}
-
-		for _, name := range f.cmap.subtableKeys {
-			subt := f.cmap.subtables[name]
-			switch t := subt.ctx.(type) {
-			case cmapSubtableFormat0:
-				for i := range t.glyphIDArray {
-					if i > numGlyphs {
-						t.glyphIDArray[i] = 0
-					}
-				}
-			case cmapSubtableFormat4:
-				newt := cmapSubtableFormat4{}
-				// Generates a new table: going from glyph index 0 up to numGlyphs.
-				// Makes continous entries with deltas.
-				// Does not use glyphIDData, but only the deltas.  Can lead to many segments, but should not
-				// be too bad (especially since subsetting).
-				charcodes := make([]CharCode, 0, len(subt.charcodeToGID))
-				for cc, gid := range subt.charcodeToGID {
-					if int(gid) >= numGlyphs {
-						continue
-					}
-					charcodes = append(charcodes, cc)
-				}
-				sort.Slice(charcodes, func(i, j int) bool {
-					return charcodes[i] < charcodes[j]
-				})
-
-				segments := 0
-				i := 0
-				for i < len(charcodes) {
-					j := i + 1
-					for ; j < len(charcodes); j++ {
-						if int(charcodes[j]-charcodes[i]) != j-i ||
-							int(subt.charcodeToGID[charcodes[j]]-subt.charcodeToGID[charcodes[i]]) != j-i {
-							break
-						}
-					}
-					// from i:j-1 maps to subt.charcodes[i]:subt.charcodes[i]+j-i-1
-					startCode := uint16(charcodes[i])
-					endCode := uint16(charcodes[i]) + uint16(j-i-1)
-					idDelta := uint16(subt.charcodeToGID[charcodes[i]]) - uint16(charcodes[i])
-
-					newt.startCode = append(newt.startCode, startCode)
-					newt.endCode = append(newt.endCode, endCode)
-					newt.idDelta = append(newt.idDelta, idDelta)
-					newt.idRangeOffset = append(newt.idRangeOffset, 0)
-					segments++
-					i = j
-				}
-
-				if segments > 0 && newt.endCode[segments-1] < 65535 {
-					newt.endCode = append(newt.endCode, 65535)
-					newt.startCode = append(newt.startCode, 65535)
-					newt.idDelta = append(newt.idDelta, 1)
-					newt.idRangeOffset = append(newt.idRangeOffset, 0)
-					segments++
-				}
-
-				newt.length = uint16(2*8 + 2*4*segments)
-				newt.language = t.language
-				newt.segCountX2 = uint16(segments * 2)
-				newt.searchRange = 2 * uint16(math.Pow(2, math.Floor(math.Log2(float64(segments)))))
-				newt.entrySelector = uint16(math.Log2(float64(newt.searchRange) / 2.0))
-				newt.rangeShift = uint16(segments*2) - newt.searchRange
-				subt.ctx = newt
-			case cmapSubtableFormat6:
-				for i := range t.glyphIDArray {
-					if int(t.glyphIDArray[i]) >= numGlyphs {
-						t.glyphIDArray[i] = 0
-					}
-				}
-			case cmapSubtableFormat12:
-				newt := cmapSubtableFormat12{}
-				groups := 0
-
-				charcodes := make([]CharCode, 0, len(subt.charcodeToGID))
-				for cc, gid := range subt.charcodeToGID {
-					if int(gid) >= numGlyphs {
-						continue
-					}
-					charcodes = append(charcodes, cc)
-				}
-				sort.Slice(charcodes, func(i, j int) bool {
-					return charcodes[i] < charcodes[j]
-				})
-
-				i := 0
-				for i < len(charcodes) {
-					j := i + 1
-					for ; j < len(charcodes); j++ {
-						if int(charcodes[j]-charcodes[i]) != j-i ||
-							int(subt.charcodeToGID[charcodes[j]]-subt.charcodeToGID[charcodes[i]]) != j-i {
-							break
-						}
-					}
-					// from i:j-1 maps to subt.charcodes[i]:subt.charcodes[i]+j-i-1
-					startCharCode := uint32(charcodes[i])
-					endCharCode := uint32(charcodes[i]) + uint32(j-i-1)
-					startGlyphID := uint32(subt.charcodeToGID[charcodes[i]])
-
-					group := sequentialMapGroup{
-						startCharCode: startCharCode,
-						endCharCode:   endCharCode,
-						startGlyphID:  startGlyphID,
-					}
-					newt.groups = append(newt.groups, group)
-					groups++
-					i = j
-				}
+	// Tables that are not modelled are carried along as the GIDs are maintained, except those that
+	// depend on the number of glyphs.
+	for _, t := range f.font.rawTables {
+		if glyphCountTables[t.tableTag.String()] {
+			logger.Debugf("Dropping %s table as the number of glyphs changed", t.tableTag.String())
+			continue
+		}
+		newfnt.rawTables = append(newfnt.rawTables, t)
+	}
+	newfnt.kern = f.font.kern
+	newfnt.gpos = f.font.gpos
+	newfnt.gsub = f.font.gsub
 
-				newt.length = uint32(2*2 + 3*4 + groups*3*4)
-				newt.language = t.language
-				newt.numGroups = uint32(groups)
-				subt.ctx = newt
+	firstGIDs := make([]GlyphIndex, numGlyphs)
+	for i := range firstGIDs {
+		firstGIDs[i] = GlyphIndex(i)
+	}
+	if f.font.cff != nil {
+		newfnt.cff = f.font.cff
+		if len(f.font.cff.charStrings) > numGlyphs {
+			err := newfnt.setCFF(f.font.cff.selectGlyphs(firstGIDs))
+			if err != nil {
+				return nil, err
 			}
+		}
+	}
+	newfnt.cpal = f.font.cpal
+	newfnt.fvar = f.font.fvar
+	newfnt.avar = f.font.avar
+	if f.font.gvar != nil {
+		newfnt.gvar = f.font.gvar
+		if len(f.font.gvar.glyphData) > numGlyphs {
+			newfnt.setGvar(f.font.gvar.selectGlyphs(firstGIDs))
+		}
+	}
 
-			newfnt.cmap.subtableKeys = append(newfnt.cmap.subtableKeys, name)
-			newfnt.cmap.subtables[name] = subt
+	// Only retain mappings, color glyphs, bitmap images and SVG documents of the first numGlyphs glyphs
+	// (GIDs unchanged).
+	keep := make(map[GlyphIndex]GlyphIndex, numGlyphs)
+	for gid := 0; gid < numGlyphs; gid++ {
+		keep[GlyphIndex(gid)] = GlyphIndex(gid)
+	}
+	if f.font.cmap != nil {
+		newfnt.cmap = f.font.cmap.remap(keep)
+	}
+	if f.font.colr != nil {
+		newfnt.setColr(f.font.colr.selectGlyphs(keep))
+	}
+	if f.font.sbix != nil {
+		newfnt.setSbix(f.font.sbix.selectGlyphs(keep, numGlyphs))
+	}
+	if f.font.cbdt != nil {
+		newfnt.setCbdt(f.font.cbdt.selectGlyphs(keep))
+	}
+	if f.font.svg != nil {
+		svg, err := f.font.svg.selectGlyphs(keep)
+		if err != nil {
+			return nil, err
 		}
-		newfnt.cmap.numTables = uint16(len(newfnt.cmap.subtables))
+		newfnt.setSVG(svg)
 	}
 
+	newfnt.updateOS2Ranges(func(gid GlyphIndex) bool {
+		return int(gid) < numGlyphs
+	})
+
 	subfnt := &Font{
 		br:   nil,
 		font: &newfnt,
@@ -532,46 +1319,573 @@ func (f *Font) SubsetFirst(numGlyphs int) (*Font, error) {
 // Subset creates a subset of `f` including only glyph indices specified by `indices`.
 // Returns the new subsetted font, a map of old to new GlyphIndex to GlyphIndex as the removal
 // of glyphs requires reordering.
+// The glyph 0 (notdef), the components of composite glyphs and the layer glyphs of color glyphs (COLR) are
+// always included. The kept glyphs are renumbered densely in their original order, so that notdef remains
+// at index 0.
+// For fonts with CFF outlines the CharStrings, charset and FDSelect are rebuilt for the kept glyphs, the
+// global and local subrs are kept as is. Variable fonts keep the glyph variations (gvar) of the kept glyphs,
+// the metrics variations (HVAR, VVAR) are dropped in which case the phantom points of gvar apply.
+// The bitmap images (sbix, CBDT) and SVG documents of the kept glyphs are kept, fonts with only bitmap
+// glyphs are supported.
+// The other tables that are not modelled and reference glyphs, such as GSUB, GPOS and GDEF, are dropped as
+// the glyphs are renumbered, also when the glyphs are selected by GlyphClosure. Use SubsetWithOptions with
+// KeepRawTables to keep them verbatim, or RetainGIDs to keep them valid.
+// Subset is SubsetWithOptions with IncludeNotdef set.
 func (f *Font) Subset(indices []GlyphIndex) (newf *Font, oldnew map[GlyphIndex]GlyphIndex, err error) {
-	// TODO:
-	//     1. Make the new cmap for `runes` if `cmap` is nil, using the cmap table and make a []GlyphIndex
-	//        with the glyph indices to keep (index prior to subsetting).
-	//     2. Go through each table and leave only data for the glyph indices to be kept.
-	return nil, nil, errors.New("not implemented yet")
+	return f.SubsetWithOptions(indices, SubsetOptions{IncludeNotdef: true})
+}
+
+// subsetRenumber creates a subset of `f` with the glyphs of `indices`, renumbered densely, see Subset.
+// The unmodelled tables that reference glyphs are kept verbatim if `keepRaw` is set, otherwise dropped.
+func (f *Font) subsetRenumber(indices []GlyphIndex, keepRaw bool) (newf *Font, oldnew map[GlyphIndex]GlyphIndex, err error) {
+	if (f.glyf == nil && f.cff == nil && f.sbix == nil && f.cbdt == nil) || f.maxp == nil || f.head == nil {
+		logger.Debugf("Subset requires glyf, CFF or bitmap (sbix, CBDT), maxp and head tables")
+		switch {
+		case f.maxp == nil:
+			return nil, nil, ErrRequiredTableMissing{Tag: "maxp"}
+		case f.head == nil:
+			return nil, nil, ErrRequiredTableMissing{Tag: "head"}
+		}
+		return nil, nil, ErrRequiredTableMissing{Tag: "glyf"}
+	}
+
+	gidIncludedMap, err := f.subsetClosure(indices)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gids := make([]GlyphIndex, 0, len(gidIncludedMap))
+	for gid := range gidIncludedMap {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(i, j int) bool {
+		return gids[i] < gids[j]
+	})
+	oldnew = make(map[GlyphIndex]GlyphIndex, len(gids))
+	for i, gid := range gids {
+		oldnew[gid] = GlyphIndex(i)
+	}
+	numGlyphs := len(gids)
+
+	newfnt := font{}
+
+	newfnt.ot = f.font.ot.Clone()
+
+	newfnt.trec = f.font.trec.Clone()
+
+	newfnt.head = f.font.head.Clone()
+
+	newfnt.maxp = f.font.maxp.Clone()
+	newfnt.maxp.numGlyphs = uint16(numGlyphs)
+
+	if f.font.hhea != nil && f.font.hmtx != nil {
+		newfnt.hhea = f.font.hhea.Clone()
+
+		newfnt.hmtx = &hmtxTable{
+			hMetrics: make([]longHorMetric, numGlyphs),
+		}
+		for i, gid := range gids {
+			newfnt.hmtx.hMetrics[i] = f.font.hmtx.getMetric(gid)
+		}
+		newfnt.hhea.numberOfHMetrics = uint16(numGlyphs)
+		newfnt.optimizeHmtx()
+	}
+
+	if f.font.vhea != nil && f.font.vmtx != nil {
+		newfnt.vhea = f.font.vhea.Clone()
+
+		newfnt.vmtx = &vmtxTable{
+			vMetrics: make([]longVerMetric, numGlyphs),
+		}
+		for i, gid := range gids {
+			newfnt.vmtx.vMetrics[i] = f.font.vmtx.getMetric(gid)
+		}
+		newfnt.vhea.numOfLongVerMetrics = uint16(numGlyphs)
+		newfnt.optimizeVmtx()
+	}
+
+	if f.font.glyf != nil {
+		newfnt.glyf = &glyfTable{
+			descs: make([]*glyphDescription, numGlyphs),
+		}
+		for i, gid := range gids {
+			raw, err := f.font.glyf.descs[gid].remapComponents(oldnew)
+			if err != nil {
+				logger.Debugf("Error remapping components of glyph %d", gid)
+				return nil, nil, err
+			}
+			newfnt.glyf.descs[i] = &glyphDescription{raw: raw}
+		}
+		err = newfnt.updateLocaFormat()
+		if err != nil {
+			return nil, nil, err
+		}
+		newfnt.updateHeadBBox()
+		newfnt.recomputeMaxp()
+	}
+	newfnt.recomputeHhea()
+
+	if f.font.prep != nil {
+		newfnt.prep = f.font.prep.Clone()
+	}
+
+	if f.font.cvt != nil {
+		newfnt.cvt = f.font.cvt.Clone()
+	}
+
+	if f.font.fpgm != nil {
+		newfnt.fpgm = f.font.fpgm.Clone()
+	}
+
+	if f.font.name != nil {
+		newfnt.name = f.font.name.Clone()
+	}
+
+	if f.font.post != nil {
+		newfnt.post = f.font.post.Clone()
+		newfnt.post.glyphNameIndex = nil
+		newfnt.post.offsets = nil
+		if len(f.font.post.glyphNames) > 0 {
+			newfnt.post.glyphNames = make([]GlyphName, numGlyphs)
+			for i, gid := range gids {
+				if int(gid) < len(f.font.post.glyphNames) {
+					newfnt.post.glyphNames[i] = f.font.post.glyphNames[gid]
+				}
+			}
+		}
+		if newfnt.post.numGlyphs > 0 {
+			newfnt.post.numGlyphs = uint16(numGlyphs)
+		}
+	}
+
+	if f.font.cmap != nil {
+		newfnt.cmap = f.font.cmap.remap(oldnew)
+	}
+
+	// Tables that are not modelled are dropped as they may reference the renumbered glyphs, unless keepRaw is
+	// set, except for the tables that do not reference glyphs and the CFF, gvar, color and bitmap tables which
+	// are subsetted. The tables depending on the number of glyphs are dropped regardless.
+	var dropped []string
+	for _, t := range f.font.rawTables {
+		name := t.tableTag.String()
+		switch {
+		case glyphIndependentTables[name]:
+			newfnt.rawTables = append(newfnt.rawTables, t)
+		case name == "CFF" && f.font.cff != nil, name == "gvar" && f.font.gvar != nil,
+			name == "COLR" && f.font.colr != nil, name == "sbix" && f.font.sbix != nil,
+			(name == "CBLC" || name == "CBDT") && f.font.cbdt != nil, name == "SVG" && f.font.svg != nil:
+			// Subsetted below.
+		case keepRaw && !glyphCountTables[name]:
+			logger.Debugf("Keeping %s table verbatim although glyphs are renumbered", name)
+			newfnt.rawTables = append(newfnt.rawTables, t)
+		default:
+			dropped = append(dropped, name)
+		}
+	}
+	if len(dropped) > 0 {
+		logger.Debugf("Dropping %v tables as glyphs are renumbered", dropped)
+	}
+	newfnt.cpal = f.font.cpal
+	newfnt.fvar = f.font.fvar
+	newfnt.avar = f.font.avar
+	if f.font.gvar != nil {
+		newfnt.setGvar(f.font.gvar.selectGlyphs(gids))
+	}
+	if f.font.colr != nil {
+		newfnt.setColr(f.font.colr.selectGlyphs(oldnew))
+	}
+	if f.font.sbix != nil {
+		newfnt.setSbix(f.font.sbix.selectGlyphs(oldnew, numGlyphs))
+	}
+	if f.font.cbdt != nil {
+		newfnt.setCbdt(f.font.cbdt.selectGlyphs(oldnew))
+	}
+	if f.font.svg != nil {
+		svg, err := f.font.svg.selectGlyphs(oldnew)
+		if err != nil {
+			return nil, nil, err
+		}
+		newfnt.setSVG(svg)
+	}
+	if f.font.cff != nil {
+		err = newfnt.setCFF(f.font.cff.selectGlyphs(gids))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if f.font.os2 != nil {
+		newfnt.os2 = f.font.os2.Clone()
+		newfnt.updateOS2Ranges(func(gid GlyphIndex) bool {
+			return true
+		})
+	}
+
+	newf = &Font{
+		br:   nil,
+		font: &newfnt,
+	}
+	return newf, oldnew, nil
 }
 
 // PruneTables prunes font tables `tables` by name from font.
-// Currently supports: "cmap", "post", "name".
+// Currently supports: "cmap", "post", "name", "vhea" and "vmtx" (pruned together) and any of
+// the tables that are not modelled and carried along verbatim, such as "GSUB", "GPOS" or "kern"
+// (see UnmodelledTables). "CBLC" and "CBDT" are pruned together.
 func (f *Font) PruneTables(tables ...string) error {
 	for _, table := range tables {
 		switch table {
 		case "cmap":
 			f.cmap = nil
+			f.resetRuneLookupMap()
 		case "post":
 			f.post = nil
+			f.resetGlyphNameMap()
 		case "name":
 			f.name = nil
+		case "vhea", "vmtx":
+			// The vertical metrics tables depend on each other.
+			f.vhea = nil
+			f.vmtx = nil
+		default:
+			if !f.pruneRawTable(table) {
+				logger.Debugf("Table %s not present or not supported for pruning", table)
+			}
+			switch table {
+			case "kern":
+				f.kern = nil
+			case "GPOS":
+				f.gpos = nil
+			case "GSUB":
+				f.gsub = nil
+			case "CFF":
+				f.cff = nil
+			case "fvar":
+				f.fvar = nil
+			case "avar":
+				f.avar = nil
+			case "gvar":
+				f.gvar = nil
+			case "COLR":
+				f.colr = nil
+			case "CPAL":
+				f.cpal = nil
+			case "sbix":
+				f.sbix = nil
+			case "CBLC", "CBDT":
+				f.pruneRawTable("CBLC")
+				f.pruneRawTable("CBDT")
+				f.cbdt = nil
+			case "SVG":
+				f.svg = nil
+			}
 		}
 	}
 	return nil
 }
 
-// Optimize does some optimization such as reducing hmtx table.
+// UnmodelledTables returns the names of the tables of `f` that are not modelled by unitype, such as "GSUB",
+// "GPOS" or "gasp". These tables are written out verbatim. They are carried along by SubsetKeepIndices
+// and SubsetKeepRunes, except those depending on the number of glyphs (hdmx, LTSH), but dropped by Subset
+// as the glyphs are renumbered, unless SubsetOptions.KeepRawTables is set. The exceptions are the CFF, gvar, COLR, sbix, CBLC/CBDT and SVG tables,
+// which are subsetted along with the glyphs, and the tables that do not reference glyphs (fvar, avar, STAT, MVAR,
+// cvar, CPAL).
+// Use PruneTables to drop them explicitly.
+func (f *Font) UnmodelledTables() []string {
+	var names []string
+	for _, t := range f.rawTables {
+		names = append(names, t.tableTag.String())
+	}
+	return names
+}
+
+// TableTags returns the tags of the tables of `f`, in the order of the table directory of the font data `f` was
+// parsed from. Tables added since follow in tag order. The tags of fonts created from other fonts, such as by
+// Subset, are in tag order as in the table directory written.
+func (f *Font) TableTags() []string {
+	var tags []string
+	listed := map[string]bool{}
+	if f.br != nil && f.trec != nil {
+		for _, tr := range f.trec.list {
+			tag := tr.tableTag.String()
+			if f.hasTable(tag) && !listed[tag] {
+				tags = append(tags, tag)
+				listed[tag] = true
+			}
+		}
+	}
+	var added []string
+	for _, tag := range f.tableTags() {
+		if !listed[tag] {
+			added = append(added, tag)
+		}
+	}
+	sort.Strings(added)
+	return append(tags, added...)
+}
+
+// HasTable returns true if `f` contains the table `tag`, such as "GSUB" or "OS/2".
+func (f *Font) HasTable(tag string) bool {
+	return f.hasTable(tag)
+}
+
+// TableBytes returns the data of the table `tag` of `f`. Returns an ErrRequiredTableMissing error if `f` does
+// not contain the table.
+//
+// The data of the tables that are not modelled (see UnmodelledTables) is returned as is. The data of the modelled
+// tables is read again from the font data `f` was parsed from, so it is exactly the original data: modifications
+// such as by SetNameRecord are only reflected once written. For fonts created from other fonts, such as by Subset
+// or Instance, the modelled tables are serialized instead.
+func (f *Font) TableBytes(tag string) ([]byte, error) {
+	if !f.hasTable(tag) {
+		return nil, ErrRequiredTableMissing{Tag: tag}
+	}
+	if !modelledTables[tag] {
+		return append([]byte(nil), f.rawTableData(tag)...), nil
+	}
+
+	if f.br != nil && f.trec != nil {
+		if tr, has := f.trec.trMap[tag]; has {
+			data, err := f.br.readAt(f.brMu, int64(tr.offset), int(tr.length))
+			if err != nil {
+				return nil, wrapParseError(tag, int64(tr.offset), err)
+			}
+			return data, nil
+		}
+	}
+
+	s, err := f.writeSfnt()
+	if err != nil {
+		return nil, err
+	}
+	tr, has := s.trec.trMap[tag]
+	if !has {
+		return nil, ErrRequiredTableMissing{Tag: tag}
+	}
+	return s.data[int64(tr.offset) : int64(tr.offset)+int64(tr.length)], nil
+}
+
+// SetTableBytes adds the table `tag` with data `data` to `f`, or replaces it if present. The table is written as
+// is, with its offset, length and checksum in the table directory computed when `f` is written. Tables modelled by
+// unitype, such as "head" or "cmap", cannot be set. Tables with a derived model such as "GPOS" or "CFF" are parsed
+// again, so that e.g. KernPair reflects the new data.
+func (f *Font) SetTableBytes(tag string, data []byte) error {
+	if !validTableTag(tag) {
+		return fmt.Errorf("invalid table tag %q", tag)
+	}
+	if modelledTables[tag] {
+		return fmt.Errorf("table %s is modelled and cannot be set as raw data", tag)
+	}
+	f.setRawTableData(tag, append([]byte(nil), data...))
+	f.markDirty(tag)
+	f.parseDerivedTable(tag)
+	if tag == "CFF" {
+		f.resetGlyphNameMap()
+	}
+	return nil
+}
+
+// RemoveTable removes the table `tag` from `f`. Returns an ErrRequiredTableMissing error if `f` does not contain
+// the table. Of the modelled tables only "cmap", "post", "name", "vhea" and "vmtx" can be removed, see PruneTables.
+func (f *Font) RemoveTable(tag string) error {
+	if !f.hasTable(tag) {
+		return ErrRequiredTableMissing{Tag: tag}
+	}
+	switch tag {
+	case "cmap", "post", "name", "vhea", "vmtx":
+	default:
+		if modelledTables[tag] {
+			return fmt.Errorf("table %s cannot be removed", tag)
+		}
+	}
+	return f.PruneTables(tag)
+}
+
+// Optimize reduces the size of `f` without removing any glyphs. The optimization is lossless with respect
+// to glyph rendering and metrics:
+//   - compacts the hmtx and vmtx tables when trailing advances are equal,
+//   - removes padding bytes from the glyph data and picks the smallest loca format,
+//   - trims the post glyph names and stores each name only once,
+//   - drops cmap subtables that duplicate another subtable.
+//
+// The table directory is recomputed when the font is written.
 func (f *Font) Optimize() error {
+	f.markDirty()
 	f.optimizeHmtx()
+	f.optimizeVmtx()
+	f.trimGlyphPadding()
+	err := f.updateLocaFormat()
+	if err != nil {
+		return err
+	}
+	f.optimizePost()
+	f.resetGlyphNameMap()
+	f.optimizeCmap()
+	f.resetRuneLookupMap()
+	return nil
+}
+
+// StripHinting removes the TrueType hinting from `f`, giving a smaller unhinted font, e.g. for web or PDF
+// embedding. The prep, cvt and fpgm tables are removed along with the cvar, hdmx and VDMX tables that
+// depend on hinting, and the instructions are removed from all glyph descriptions. The maxp fields
+// describing the hinting requirements and the head flag for instructions altering advance widths are
+// cleared accordingly.
+func (f *Font) StripHinting() error {
+	f.markDirty()
+	f.prep = nil
+	f.cvt = nil
+	f.fpgm = nil
+	for _, table := range []string{"cvar", "hdmx", "VDMX"} {
+		f.pruneRawTable(table)
+	}
+
+	if f.glyf != nil {
+		// The glyph descriptions may be shared with other fonts, so replace rather than modify them.
+		descs := make([]*glyphDescription, len(f.glyf.descs))
+		for i, gd := range f.glyf.descs {
+			raw, err := gd.stripInstructions()
+			if err != nil {
+				logger.Debugf("Error stripping instructions of glyph %d", i)
+				return err
+			}
+			descs[i] = &glyphDescription{raw: raw}
+		}
+		f.glyf = &glyfTable{descs: descs}
+		err := f.updateLocaFormat()
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.maxp != nil {
+		f.maxp.maxZones = 1
+		f.maxp.maxTwilightPoints = 0
+		f.maxp.maxStorage = 0
+		f.maxp.maxFunctionDefs = 0
+		f.maxp.maxInstructionDefs = 0
+		f.maxp.maxStackElements = 0
+		f.maxp.maxSizeOfInstructions = 0
+	}
+	if f.head != nil {
+		// Bit 4: Instructions may alter advance width.
+		f.head.flags &^= 1 << 4
+	}
+	return nil
+}
+
+// RecomputeMaxp recomputes the glyph related maximums of the maxp table of `f` from the glyph outlines:
+// the maximum points and contours of simple and composite glyphs and the maximum number and nesting
+// depth of components. Needed after modifying glyphs so that the maxp table does not overstate or
+// understate the complexity of the font. The subsetting functions do this automatically.
+// An error is returned if the maxp table is missing.
+func (f *Font) RecomputeMaxp() error {
+	if f.maxp == nil {
+		return ErrRequiredTableMissing{Tag: "maxp"}
+	}
+	f.recomputeMaxp()
+	f.markDirty("maxp")
+	return nil
+}
+
+// RecomputeHhea recomputes the aggregate values of the hhea table of `f` from the hmtx and glyf tables:
+// advanceWidthMax, minLeftSideBearing, minRightSideBearing and xMaxExtent. Needed after modifying the
+// metrics or glyphs. The subsetting functions do this automatically.
+// An error is returned if the hhea or hmtx table is missing.
+func (f *Font) RecomputeHhea() error {
+	if f.hhea == nil {
+		return ErrRequiredTableMissing{Tag: "hhea"}
+	}
+	if f.hmtx == nil {
+		return ErrRequiredTableMissing{Tag: "hmtx"}
+	}
+	f.recomputeHhea()
+	f.markDirty("hhea")
+	return nil
+}
+
+// RecomputeOS2Ranges recomputes usFirstCharIndex, usLastCharIndex and the Unicode and code page range bits
+// of the OS/2 table of `f` from the runes mapped in the cmap table. Range bits are set for the blocks with at
+// least one rune mapped and cleared for the others. Useful after editing the cmap. The subsetting functions
+// do this automatically.
+// An error is returned if the OS/2 or cmap table is missing.
+func (f *Font) RecomputeOS2Ranges() error {
+	if f.os2 == nil {
+		return ErrRequiredTableMissing{Tag: "OS/2"}
+	}
+	if f.cmap == nil {
+		return ErrRequiredTableMissing{Tag: "cmap"}
+	}
+	f.updateOS2Ranges(func(gid GlyphIndex) bool {
+		return true
+	})
+	f.markDirty("OS/2")
 	return nil
 }
 
+// ValidateHhea checks whether the aggregate values of the hhea table of `f` (advanceWidthMax,
+// minLeftSideBearing, minRightSideBearing and xMaxExtent) agree with the hmtx and glyf tables.
+// The check is not part of ValidateFile as many fonts in the wild have slightly inaccurate values.
+// Returns an error describing the first mismatch found.
+func (f *Font) ValidateHhea() error {
+	return f.validateHhea()
+}
+
+// WriteOptions represents options for writing a font.
+type WriteOptions struct {
+	// EmptyDSIG replaces the DSIG table of a modified font by an empty DSIG table, which some tools expect,
+	// rather than dropping it. A font written unmodified keeps its original DSIG table regardless.
+	EmptyDSIG bool
+	// DropGlyphNames writes the post table as version 3.0 without glyph names, keeping the header fields such
+	// as italicAngle and underlinePosition. Glyph names are not needed e.g. for fonts embedded in PDF documents
+	// and can take up a considerable part of fonts with many glyphs.
+	DropGlyphNames bool
+	// ZeroModifiedDate writes the modified date of the head table as 0, so that the output only depends on
+	// the font data, such as for reproducible builds. The modified date of the font is kept.
+	ZeroModifiedDate bool
+	// PreserveTableOrder lays out the table data in the order of the font that was parsed rather than in the
+	// order recommended by the spec. The table records are sorted by tag regardless.
+	PreserveTableOrder bool
+	// KeepLayout reproduces the font data the font was parsed from as faithfully as possible, such as for
+	// round-trip tests or for changing single tables: the tables and the table records keep their order, and the
+	// tables not modified since parsed are copied verbatim along with the bytes following them up to the next
+	// table. Writing an unmodified font gives the data it was parsed from. The DSIG table is kept or dropped as
+	// without KeepLayout. The font is assembled in memory. Fonts that were not parsed, such as subset fonts, are
+	// written as without KeepLayout.
+	KeepLayout bool
+}
+
 // Write writes the font to `w`.
+// The digital signature (DSIG table) is dropped if any table is modified as it would no longer be valid.
+// The tables are streamed to `w` rather than buffered, with the table directory back-patched if `w` is an
+// io.WriteSeeker such as a file, or the tables written twice otherwise. Writing the same font always produces
+// the same bytes, see WriteOptions.ZeroModifiedDate for output that does not depend on the modified date.
 func (f *Font) Write(w io.Writer) error {
+	return f.WriteWithOptions(w, nil)
+}
+
+// WriteWithOptions writes the font to `w` with options `opts`, nil for the defaults.
+func (f *Font) WriteWithOptions(w io.Writer, opts *WriteOptions) error {
+	if opts != nil && opts.KeepLayout && f.br != nil && f.trec != nil {
+		return f.writeKeepLayout(w, opts)
+	}
 	bw := newByteWriter(w)
-	err := f.font.write(bw)
+	err := f.font.write(bw, opts)
 	if err != nil {
 		return err
 	}
 	return bw.flush()
 }
 
+// Bytes returns the font data of `f` as written by Write.
+func (f *Font) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	err := f.Write(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // WriteFile writes the font to `outPath`.
 func (f *Font) WriteFile(outPath string) error {
 	of, err := os.Create(outPath)
@@ -0,0 +1,1263 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimize(t *testing.T) {
+	testcases := []struct {
+		fontPath string
+	}{
+		{
+			"./testdata/FreeSans.ttf",
+		},
+		{
+			"./testdata/wts11.ttf",
+		},
+		{
+			"./testdata/roboto/Roboto-BoldItalic.ttf",
+		},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = fnt.Write(&buf)
+			require.NoError(t, err)
+			origSize := buf.Len()
+
+			orig, err := parseTestBytes(buf.Bytes())
+			require.NoError(t, err)
+
+			err = fnt.Optimize()
+			require.NoError(t, err)
+
+			buf.Reset()
+			err = fnt.Write(&buf)
+			require.NoError(t, err)
+			t.Logf("Size: %d -> %d", origSize, buf.Len())
+			assert.True(t, buf.Len() <= origSize)
+
+			err = ValidateBytes(buf.Bytes())
+			require.NoError(t, err)
+
+			optfnt, err := parseTestBytes(buf.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, orig.maxp.numGlyphs, optfnt.maxp.numGlyphs)
+
+			// Glyph outlines and metrics are unchanged.
+			for gid := 0; gid < int(orig.maxp.numGlyphs); gid++ {
+				origLen, err := orig.glyf.descs[gid].dataLen()
+				require.NoError(t, err)
+				optLen, err := optfnt.glyf.descs[gid].dataLen()
+				require.NoError(t, err)
+				require.Equal(t, orig.glyf.descs[gid].raw[:origLen], optfnt.glyf.descs[gid].raw[:optLen])
+
+				require.Equal(t, advanceWidth(orig.font, gid), advanceWidth(optfnt.font, gid))
+			}
+			for r, gid := range orig.GetCmap(3, 1) {
+				require.Equal(t, gid, optfnt.GetCmap(3, 1)[r])
+			}
+		})
+	}
+}
+
+// parseTestBytes parses the font in `b`.
+func parseTestBytes(b []byte) (*Font, error) {
+	return Parse(bytes.NewReader(b))
+}
+
+// advanceWidth returns the advance width of glyph `gid` in `f` according to the hmtx table.
+func advanceWidth(f *font, gid int) uint16 {
+	if gid < len(f.hmtx.hMetrics) {
+		return f.hmtx.hMetrics[gid].advanceWidth
+	}
+	return f.hmtx.hMetrics[len(f.hmtx.hMetrics)-1].advanceWidth
+}
+
+func TestCoverage(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	assert.True(t, fnt.CoversRune('a'))
+	assert.True(t, fnt.CoversRune('π'))
+	assert.False(t, fnt.CoversRune('中'))
+	assert.False(t, fnt.CoversRune(0x1F600))
+
+	covered, missing := fnt.CoverageOf([]rune("aπ中b😀"))
+	assert.Equal(t, []rune("aπb"), covered)
+	assert.Equal(t, []rune("中😀"), missing)
+}
+
+func TestSupportedRunes(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	assert.True(t, fnt.HasRune('a'))
+	assert.False(t, fnt.HasRune('中'))
+
+	runes := fnt.SupportedRunes()
+	require.NotEmpty(t, runes)
+	assert.Equal(t, len(runes), fnt.CoverageCount())
+	for i, r := range runes {
+		assert.True(t, fnt.HasRune(r), "%q", r)
+		if i > 0 {
+			assert.True(t, runes[i-1] < r)
+		}
+	}
+	// Every rune of the Unicode subtables is included once.
+	for r, gid := range fnt.GetCmap(3, 1) {
+		if gid != 0 {
+			assert.Equal(t, r, runes[sort.Search(len(runes), func(i int) bool { return runes[i] >= r })])
+		}
+	}
+
+	// The returned slice is a copy.
+	runes[0] = -1
+	assert.NotEqual(t, rune(-1), fnt.SupportedRunes()[0])
+
+	var ranged []rune
+	fnt.RangeRunes(func(r rune, gid GlyphIndex) bool {
+		expected, _ := fnt.LookupRune(r)
+		assert.Equal(t, expected, gid)
+		ranged = append(ranged, r)
+		return true
+	})
+	assert.Equal(t, fnt.SupportedRunes(), ranged)
+
+	count := 0
+	fnt.RangeRunes(func(r rune, gid GlyphIndex) bool {
+		count++
+		return count < 10
+	})
+	assert.Equal(t, 10, count)
+
+	// The cache follows changes of the cmap.
+	require.NoError(t, fnt.SetCmapFromMap(map[rune]GlyphIndex{'a': 1, 'b': 2}))
+	assert.Equal(t, []rune("ab"), fnt.SupportedRunes())
+	assert.Equal(t, 2, fnt.CoverageCount())
+
+	// CJK font.
+	cjk, err := ParseFile("./testdata/wts11.ttf")
+	require.NoError(t, err)
+	assert.True(t, cjk.HasRune('中'))
+	assert.Equal(t, len(cjk.SupportedRunes()), cjk.CoverageCount())
+}
+
+func TestRangeCmap(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	cmap := fnt.GetCmap(3, 1)
+	require.NotEmpty(t, cmap)
+
+	count := 0
+	prev := rune(-1)
+	fnt.RangeCmap(func(r rune, gid GlyphIndex) bool {
+		assert.True(t, r > prev)
+		assert.Equal(t, cmap[r], gid)
+		prev = r
+		count++
+		return true
+	})
+	assert.Equal(t, len(cmap), count)
+
+	count = 0
+	fnt.RangeCmap(func(r rune, gid GlyphIndex) bool {
+		count++
+		return count < 10
+	})
+	assert.Equal(t, 10, count)
+}
+
+func TestSubset(t *testing.T) {
+	testcases := []struct {
+		fontPath string
+		runes    []rune
+	}{
+		{"./testdata/FreeSans.ttf", []rune("Héllo wörld ÅŒ")},
+		{"./testdata/roboto/Roboto-BoldItalic.ttf", []rune("Héllo wörld ÅŒ")},
+		{"./testdata/wts11.ttf", []rune("中文字体")},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+
+			indices, _ := fnt.LookupRunes(tcase.runes)
+			subfnt, oldnew, err := fnt.Subset(indices)
+			require.NoError(t, err)
+
+			assert.Equal(t, GlyphIndex(0), oldnew[0])
+			for _, gid := range indices {
+				require.Contains(t, oldnew, gid)
+			}
+			require.Equal(t, len(oldnew), int(subfnt.maxp.numGlyphs))
+
+			var buf bytes.Buffer
+			err = subfnt.Write(&buf)
+			require.NoError(t, err)
+			err = ValidateBytes(buf.Bytes())
+			require.NoError(t, err)
+
+			newfnt, err := parseTestBytes(buf.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, len(oldnew), int(newfnt.maxp.numGlyphs))
+
+			for oldgid, newgid := range oldnew {
+				olddesc := fnt.glyf.descs[oldgid]
+				newdesc := newfnt.glyf.descs[newgid]
+				oldLen, err := olddesc.dataLen()
+				require.NoError(t, err)
+				newLen, err := newdesc.dataLen()
+				require.NoError(t, err)
+				require.Equal(t, oldLen, newLen)
+
+				oldComps, err := fnt.glyf.GetComponents(oldgid)
+				require.NoError(t, err)
+				newComps, err := newfnt.glyf.GetComponents(newgid)
+				require.NoError(t, err)
+				require.Equal(t, len(oldComps), len(newComps))
+				for i := range oldComps {
+					assert.Equal(t, oldnew[oldComps[i]], newComps[i])
+				}
+				if len(oldComps) == 0 {
+					assert.Equal(t, olddesc.raw[:oldLen], newdesc.raw[:newLen])
+				}
+
+				assert.Equal(t, advanceWidth(fnt.font, int(oldgid)), advanceWidth(newfnt.font, int(newgid)))
+			}
+
+			newIndices, _ := newfnt.LookupRunes(tcase.runes)
+			for i, gid := range indices {
+				assert.Equal(t, oldnew[gid], newIndices[i])
+			}
+		})
+	}
+}
+
+func TestSubsetKeepIndicesTrimsGlyphs(t *testing.T) {
+	fnt, err := ParseFile("./testdata/wts11.ttf")
+	require.NoError(t, err)
+	gids, missing := fnt.LookupRunes([]rune("中文字体"))
+	require.Empty(t, missing)
+	var maxgid GlyphIndex
+	for _, gid := range gids {
+		if gid > maxgid {
+			maxgid = gid
+		}
+	}
+	require.True(t, int(maxgid)+1 < int(fnt.maxp.numGlyphs))
+
+	subfnt, err := fnt.SubsetKeepIndices(gids)
+	require.NoError(t, err)
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+
+	// The glyphs following the highest GID kept are removed, the GIDs are maintained.
+	written, err := ParseBytes(data)
+	require.NoError(t, err)
+	numGlyphs := int(maxgid) + 1
+	assert.Equal(t, numGlyphs, int(written.maxp.numGlyphs))
+	assert.Len(t, written.glyf.descs, numGlyphs)
+	assert.Equal(t, numGlyphs+1, len(written.loca.offsetsShort)+len(written.loca.offsetsLong))
+	assert.True(t, int(written.hhea.numberOfHMetrics) <= numGlyphs)
+	assert.True(t, len(written.hmtx.hMetrics)+len(written.hmtx.leftSideBearings) <= numGlyphs)
+	if written.post != nil {
+		assert.True(t, len(written.post.glyphNames) <= numGlyphs)
+	}
+	for i, gid := range gids {
+		wgid, has := written.LookupRune([]rune("中文字体")[i])
+		require.True(t, has)
+		assert.Equal(t, gid, wgid)
+		assert.Equal(t, fnt.glyf.descs[gid].raw, written.glyf.descs[gid].raw)
+	}
+}
+
+func TestSubsetKeepRunesComposite(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	gid, _ := fnt.LookupRune('é')
+	components, err := fnt.glyf.GetComponents(gid)
+	require.NoError(t, err)
+	require.NotEmpty(t, components)
+
+	subfnt, err := fnt.SubsetKeepRunes([]rune("é"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = subfnt.Write(&buf)
+	require.NoError(t, err)
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, newfnt.glyf.descs[gid].raw)
+	for _, comp := range components {
+		assert.NotEmpty(t, newfnt.glyf.descs[comp].raw, "component %d", comp)
+	}
+}
+
+func TestSubsetKeepRuneRanges(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	subfnt, err := fnt.SubsetKeepRuneRanges(LatinBasic)
+	require.NoError(t, err)
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	newfnt, err := parseTestBytes(data)
+	require.NoError(t, err)
+
+	nonEmpty := func(f *Font, r rune) bool {
+		gid, has := fnt.LookupRune(r)
+		return has && int(gid) < len(f.glyf.descs) && len(f.glyf.descs[gid].raw) > 0
+	}
+	for _, r := range "aZ~éÿ—…" {
+		assert.True(t, nonEmpty(newfnt, r), "%q", r)
+	}
+	for _, r := range "ŁπЖ" {
+		assert.False(t, nonEmpty(newfnt, r), "%q", r)
+	}
+	// The components of composite glyphs are kept.
+	gid, _ := fnt.LookupRune('é')
+	components, err := fnt.glyf.GetComponents(gid)
+	require.NoError(t, err)
+	for _, comp := range components {
+		assert.NotEmpty(t, newfnt.glyf.descs[comp].raw, "component %d", comp)
+	}
+
+	// Ranges are combined.
+	subfnt, err = fnt.SubsetKeepRuneRanges(append(append([]RuneRange(nil), LatinExtended...), Greek...))
+	require.NoError(t, err)
+	for _, r := range "aŁπ" {
+		assert.True(t, nonEmpty(subfnt, r), "%q", r)
+	}
+	assert.False(t, nonEmpty(subfnt, 'Ж'))
+	subfnt, err = fnt.SubsetKeepRuneRanges(Cyrillic)
+	require.NoError(t, err)
+	assert.True(t, nonEmpty(subfnt, 'Ж'))
+	assert.False(t, nonEmpty(subfnt, 'Z'))
+
+	// Code points not covered are skipped.
+	subfnt, err = fnt.SubsetKeepRuneRanges([]RuneRange{{0x4E00, 0x9FFF}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, int(subfnt.maxp.numGlyphs))
+
+	_, err = fnt.SubsetKeepRuneRanges([]RuneRange{{'z', 'a'}})
+	assert.EqualError(t, err, "invalid rune range U+007A-U+0061")
+}
+
+func TestSubsetKeepRunesSkipMissing(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	subfnt, missing, err := fnt.SubsetKeepRunesSkipMissing([]rune("a中b中😀"))
+	require.NoError(t, err)
+	assert.Equal(t, []rune("中😀"), missing)
+
+	var buf bytes.Buffer
+	err = subfnt.Write(&buf)
+	require.NoError(t, err)
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, newfnt.glyf.descs[0].raw)
+	indices, _ := fnt.LookupRunes([]rune("ab"))
+	for _, gid := range indices {
+		assert.NotEmpty(t, newfnt.glyf.descs[gid].raw)
+	}
+}
+
+func TestSubsetKeepRunesWithMap(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	runes := []rune("abba中")
+	subfnt, runeToGID, err := fnt.SubsetKeepRunesWithMap(runes)
+	require.NoError(t, err)
+	require.Len(t, runeToGID, 3)
+
+	indices, _ := fnt.LookupRunes(runes)
+	for i, r := range runes {
+		assert.Equal(t, indices[i], runeToGID[r])
+	}
+	assert.Equal(t, GlyphIndex(0), runeToGID['中'])
+
+	// GIDs are maintained in the subset.
+	cmap := subfnt.GetCmap(3, 1)
+	assert.Equal(t, runeToGID['a'], cmap['a'])
+	assert.Equal(t, runeToGID['b'], cmap['b'])
+}
+
+func TestSubsetKeepsNotdef(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	require.NotEmpty(t, fnt.glyf.descs[0].raw)
+
+	gids, _ := fnt.LookupRunes([]rune("xyz"))
+	subfnt, err := fnt.SubsetKeepIndices(gids)
+	require.NoError(t, err)
+	assert.NotEmpty(t, subfnt.glyf.descs[0].raw)
+
+	subfnt, oldnew, err := fnt.Subset(gids)
+	require.NoError(t, err)
+	assert.Equal(t, GlyphIndex(0), oldnew[0])
+	assert.Equal(t, fnt.glyf.descs[0].raw, subfnt.glyf.descs[0].raw)
+
+	subfnt, err = fnt.SubsetFirst(0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, int(subfnt.maxp.numGlyphs))
+	assert.NotEmpty(t, subfnt.glyf.descs[0].raw)
+}
+
+func TestSubsetWithOptions(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gids, _ := fnt.LookupRunes([]rune("xyz"))
+
+	// Defaults: renumbered, notdef emptied.
+	subfnt, oldnew, err := fnt.SubsetWithOptions(gids, SubsetOptions{})
+	require.NoError(t, err)
+	assert.Len(t, oldnew, 4)
+	assert.EqualValues(t, 4, subfnt.maxp.numGlyphs)
+	assert.Empty(t, subfnt.glyf.descs[0].raw)
+	assert.NotEmpty(t, fnt.glyf.descs[0].raw)
+	gid, has := subfnt.LookupRune('y')
+	assert.True(t, has)
+	assert.Equal(t, oldnew[gids[1]], gid)
+	assert.NotNil(t, subfnt.name)
+
+	subfnt, oldnew, err = fnt.SubsetWithOptions(gids, SubsetOptions{
+		RetainGIDs:    true,
+		IncludeNotdef: true,
+		PruneCmap:     true,
+		StripHinting:  true,
+		DropNameTable: true,
+		DropPostNames: true,
+	})
+	require.NoError(t, err)
+	for _, gid := range append(gids, 0) {
+		assert.Equal(t, gid, oldnew[gid])
+		assert.NotEmpty(t, subfnt.glyf.descs[gid].raw)
+	}
+	assert.Len(t, oldnew, 4)
+	assert.Nil(t, subfnt.cmap)
+	assert.Nil(t, subfnt.name)
+
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	newfnt, err := parseTestBytes(data)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0x00030000, newfnt.post.version)
+	assert.Empty(t, newfnt.post.glyphNames)
+	assert.False(t, newfnt.HasTable("cmap"))
+	assert.False(t, newfnt.HasTable("name"))
+
+	// The original font is not modified.
+	name, err := fnt.GlyphName(gids[0])
+	require.NoError(t, err)
+	assert.Equal(t, "x", name)
+}
+
+func TestSubsetKeepRawTables(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gids, _ := fnt.LookupRunes([]rune("fi"))
+	layout := []string{"GDEF", "GPOS", "GSUB"}
+
+	// Dropped by default as the glyphs are renumbered, also with Closure.
+	for _, opts := range []SubsetOptions{{}, {Closure: true}} {
+		subfnt, _, err := fnt.SubsetWithOptions(gids, opts)
+		require.NoError(t, err)
+		for _, tag := range layout {
+			assert.False(t, subfnt.HasTable(tag), tag)
+		}
+	}
+
+	// Kept verbatim with KeepRawTables.
+	subfnt, _, err := fnt.SubsetWithOptions(gids, SubsetOptions{Closure: true, KeepRawTables: true})
+	require.NoError(t, err)
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	newfnt, err := parseTestBytes(data)
+	require.NoError(t, err)
+	for _, tag := range layout {
+		require.True(t, newfnt.HasTable(tag), tag)
+		orig, err := fnt.TableBytes(tag)
+		require.NoError(t, err)
+		b, err := newfnt.TableBytes(tag)
+		require.NoError(t, err)
+		assert.Equal(t, orig, b, tag)
+	}
+}
+
+func TestSubsetNoAliasing(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	orig, err := fnt.Bytes()
+	require.NoError(t, err)
+
+	gids1, _ := fnt.LookupRunes([]rune("Hello"))
+	gids2, _ := fnt.LookupRunes([]rune("World"))
+
+	testcases := []struct {
+		name   string
+		subset func(gids []GlyphIndex) (*Font, error)
+	}{
+		{"SubsetKeepIndices", fnt.SubsetKeepIndices},
+		{"Subset", func(gids []GlyphIndex) (*Font, error) {
+			subfnt, _, err := fnt.Subset(gids)
+			return subfnt, err
+		}},
+		{"SubsetFirst", func(gids []GlyphIndex) (*Font, error) {
+			return fnt.SubsetFirst(int(gids[0]) + 1)
+		}},
+	}
+	for _, tcase := range testcases {
+		t.Run(tcase.name, func(t *testing.T) {
+			sub1, err := tcase.subset(gids1)
+			require.NoError(t, err)
+			sub2, err := tcase.subset(gids2)
+			require.NoError(t, err)
+			expected, err := sub2.Bytes()
+			require.NoError(t, err)
+
+			// Modify the first subset in place.
+			for _, desc := range sub1.glyf.descs {
+				for i := range desc.raw {
+					desc.raw[i] = 0xFF
+				}
+			}
+			for i := range sub1.hmtx.hMetrics {
+				sub1.hmtx.hMetrics[i].advanceWidth = 1
+			}
+			for i := range sub1.post.glyphNames {
+				sub1.post.glyphNames[i] = "x"
+			}
+			for _, subt := range sub1.cmap.subtables {
+				for r := range subt.cmap {
+					subt.cmap[r] = 1
+				}
+			}
+			sub1.name.nameRecords[0].data[0] = 'X'
+			sub1.head.unitsPerEm = 1
+			require.NoError(t, sub1.Optimize())
+
+			data, err := sub2.Bytes()
+			require.NoError(t, err)
+			assert.Equal(t, expected, data)
+			data, err = fnt.Bytes()
+			require.NoError(t, err)
+			assert.Equal(t, orig, data)
+		})
+	}
+}
+
+func TestSubsetKeepIndicesPrunesCmap(t *testing.T) {
+	testcases := []struct {
+		fontPath string
+		runes    []rune
+	}{
+		{"./testdata/FreeSans.ttf", []rune("Hello")},
+		{"./testdata/wts11.ttf", []rune("中文字体")},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+
+			subfnt, err := fnt.SubsetKeepRunes(tcase.runes)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = subfnt.Write(&buf)
+			require.NoError(t, err)
+			err = ValidateBytes(buf.Bytes())
+			require.NoError(t, err)
+			newfnt, err := parseTestBytes(buf.Bytes())
+			require.NoError(t, err)
+
+			origCmap := fnt.GetCmap(3, 1)
+			cmap := newfnt.GetCmap(3, 1)
+			assert.True(t, len(cmap) < len(origCmap))
+			for _, r := range tcase.runes {
+				assert.Equal(t, origCmap[r], cmap[r])
+			}
+			for r, gid := range cmap {
+				assert.Equal(t, origCmap[r], gid)
+				assert.NotEmpty(t, newfnt.glyf.descs[gid].raw, "rune %c", r)
+			}
+		})
+	}
+}
+
+func TestGetBestCmap(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	cmap, id := fnt.GetBestCmap()
+	assert.Equal(t, CmapID{PlatformID: 3, EncodingID: 1, Format: 4}, id)
+	assert.Equal(t, fnt.GetCmap(3, 1), cmap)
+
+	// Supplementary plane coverage prefers the full repertoire subtable.
+	fnt.cmap.subtables["12,3,10"] = &cmapSubtable{
+		format: 12, platformID: 3, encodingID: 10,
+		cmap: map[rune]GlyphIndex{'a': 70, 0x1F600: 5},
+	}
+	fnt.cmap.subtableKeys = append(fnt.cmap.subtableKeys, "12,3,10")
+	_, id = fnt.GetBestCmap()
+	assert.Equal(t, CmapID{PlatformID: 3, EncodingID: 10, Format: 12}, id)
+
+	// Macintosh only font.
+	fnt.cmap.subtableKeys = []string{"6,1,0"}
+	cmap, id = fnt.GetBestCmap()
+	assert.Equal(t, CmapID{PlatformID: 1, EncodingID: 0, Format: 6}, id)
+	assert.Equal(t, GlyphIndex(70), cmap['a'])
+	gid, found := fnt.LookupRune('a')
+	assert.True(t, found)
+	assert.Equal(t, GlyphIndex(70), gid)
+
+	fnt.cmap.subtableKeys = nil
+	cmap, id = fnt.GetBestCmap()
+	assert.Nil(t, cmap)
+	assert.Equal(t, CmapID{}, id)
+}
+
+func TestRunesForGlyph(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	cmap := fnt.GetCmap(3, 1)
+	assert.Equal(t, []rune{'A'}, fnt.RunesForGlyph(cmap['A']))
+	assert.Equal(t, []rune{0, 8, 29}, fnt.RunesForGlyph(1))
+	assert.Nil(t, fnt.RunesForGlyph(0))
+
+	gidRunes := fnt.GIDToRuneMap()
+	for gid, runes := range gidRunes {
+		assert.Equal(t, runes, fnt.RunesForGlyph(gid), "gid %d", gid)
+		for _, r := range runes {
+			found := false
+			for _, subt := range fnt.cmapSubtablesAll() {
+				found = found || subt.cmap[r] == gid
+			}
+			assert.True(t, found, "rune %U", r)
+		}
+	}
+
+	// Runes of the preferred subtable come first, followed by the ones only in other subtables.
+	fnt.cmap.subtables["4,3,1"] = &cmapSubtable{
+		format: 4, platformID: 3, encodingID: 1,
+		cmap: map[rune]GlyphIndex{0xA0: 3, ' ': 3, 'a': 4},
+	}
+	fnt.cmap.subtables["6,1,0"] = &cmapSubtable{
+		format: 6, platformID: 1, encodingID: 0,
+		cmap: map[rune]GlyphIndex{0x2007: 3, ' ': 3, 'b': 4},
+	}
+	fnt.cmap.subtableKeys = []string{"6,1,0", "4,3,1"}
+	assert.Equal(t, []rune{' ', 0xA0, 0x2007}, fnt.RunesForGlyph(3))
+	assert.Equal(t, map[GlyphIndex][]rune{
+		3: {' ', 0xA0, 0x2007},
+		4: {'a', 'b'},
+	}, fnt.GIDToRuneMap())
+}
+
+func TestLookupRune(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	cmap := fnt.GetCmap(3, 1)
+	gid, found := fnt.LookupRune('A')
+	assert.True(t, found)
+	assert.Equal(t, cmap['A'], gid)
+
+	gid, found = fnt.LookupRune(0x1F600)
+	assert.False(t, found)
+	assert.Equal(t, GlyphIndex(0), gid)
+
+	indices, missing := fnt.LookupRunes([]rune("a\U0001F600b\U0001F600\U0001F601"))
+	assert.Equal(t, []GlyphIndex{cmap['a'], 0, cmap['b'], 0, 0}, indices)
+	assert.Equal(t, []rune{0x1F600, 0x1F601}, missing)
+
+	// The cached lookup map is invalidated when the cmap is pruned.
+	require.NoError(t, fnt.PruneTables("cmap"))
+	_, found = fnt.LookupRune('A')
+	assert.False(t, found)
+}
+
+func TestGlyphName(t *testing.T) {
+	testcases := []struct {
+		fontPath string
+		names    map[GlyphIndex]string
+	}{
+		{"./testdata/FreeSans.ttf", map[GlyphIndex]string{0: ".notdef", 1: ".null", 2: "nonmarkingreturn", 3: "glyph2"}},
+		{"./testdata/wts11.ttf", map[GlyphIndex]string{0: ".notdef", 3: "uni0009", 4: "space"}},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+
+			for gid, expected := range tcase.names {
+				name, err := fnt.GlyphName(gid)
+				require.NoError(t, err)
+				assert.Equal(t, expected, name)
+
+				index, found := fnt.GlyphIndexByName(expected)
+				assert.True(t, found)
+				assert.Equal(t, gid, index)
+			}
+
+			_, err = fnt.GlyphName(GlyphIndex(fnt.maxp.numGlyphs))
+			assert.Error(t, err)
+			_, found := fnt.GlyphIndexByName("nonexistent")
+			assert.False(t, found)
+		})
+	}
+
+	// Post format 3.0 has no glyph names.
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	_, err = fnt.GlyphName(0)
+	assert.Equal(t, errNoGlyphNames, err)
+	_, found := fnt.GlyphIndexByName(".notdef")
+	assert.False(t, found)
+}
+
+func TestDropGlyphNames(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	require.EqualValues(t, 0x00020000, fnt.post.version)
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.WriteWithOptions(&buf, &WriteOptions{DropGlyphNames: true}))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.EqualValues(t, 32, newfnt.trec.trMap["post"].length)
+	assert.EqualValues(t, 0x00030000, newfnt.post.version)
+	assert.Equal(t, fnt.post.italicAngle, newfnt.post.italicAngle)
+	assert.Equal(t, fnt.post.underlinePosition, newfnt.post.underlinePosition)
+	assert.Equal(t, fnt.post.underlineThickness, newfnt.post.underlineThickness)
+	assert.Equal(t, fnt.post.isFixedPitch, newfnt.post.isFixedPitch)
+	_, err = newfnt.GlyphName(1)
+	assert.EqualError(t, err, "glyph names not available")
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	assert.True(t, buf.Len() < len(data)-10000, "%d >= %d", buf.Len(), len(data))
+
+	// The names of the font written are kept.
+	name, err := fnt.GlyphName(1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, name)
+
+	// Subsets.
+	gids, _ := fnt.LookupRunes([]rune("abc"))
+	subfnt, _, err := fnt.SubsetWithOptions(gids, SubsetOptions{IncludeNotdef: true, DropPostNames: true})
+	require.NoError(t, err)
+	_, err = subfnt.GlyphName(1)
+	assert.Equal(t, errNoGlyphNames, err)
+	data, err = subfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	newfnt, err = parseTestBytes(data)
+	require.NoError(t, err)
+	assert.EqualValues(t, 32, newfnt.trec.trMap["post"].length)
+}
+
+func TestSubsetHeadBBox(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	orig, _ := fnt.BoundingBox()
+
+	period, found := fnt.LookupRune('.')
+	require.True(t, found)
+	// The last glyph, keeping all the glyphs when retaining the GIDs.
+	last := GlyphIndex(fnt.maxp.numGlyphs - 1)
+
+	testcases := []struct {
+		name   string
+		gid    GlyphIndex
+		subset func(gid GlyphIndex) (*Font, error)
+	}{
+		{"SubsetKeepIndices", period, func(gid GlyphIndex) (*Font, error) {
+			return fnt.SubsetKeepIndices([]GlyphIndex{gid})
+		}},
+		{"SubsetKeepIndicesLast", last, func(gid GlyphIndex) (*Font, error) {
+			return fnt.SubsetKeepIndices([]GlyphIndex{gid})
+		}},
+		{"SubsetWithOptionsLast", last, func(gid GlyphIndex) (*Font, error) {
+			// With the outline of the notdef glyph emptied.
+			subfnt, _, err := fnt.SubsetWithOptions([]GlyphIndex{gid}, SubsetOptions{RetainGIDs: true})
+			return subfnt, err
+		}},
+		{"Subset", period, func(gid GlyphIndex) (*Font, error) {
+			subfnt, _, err := fnt.Subset([]GlyphIndex{gid})
+			return subfnt, err
+		}},
+	}
+	for _, tcase := range testcases {
+		gid := tcase.gid
+		t.Run(tcase.name, func(t *testing.T) {
+			subfnt, err := tcase.subset(gid)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, subfnt.Write(&buf))
+			newfnt, err := parseTestBytes(buf.Bytes())
+			require.NoError(t, err)
+
+			glyphs := []GlyphIndex{0, gid}
+			if tcase.name == "SubsetWithOptionsLast" {
+				glyphs = glyphs[1:]
+			}
+			var expected glyphBounds
+			for i, g := range glyphs {
+				b, has, err := fnt.glyf.bounds(g, 0)
+				require.NoError(t, err)
+				require.True(t, has)
+				if i == 0 {
+					expected = b
+					continue
+				}
+				expected = expected.union(b)
+			}
+			xMin, yMin, xMax, yMax := expected.rounded()
+
+			bbox, ok := newfnt.BoundingBox()
+			require.True(t, ok)
+			assert.Equal(t, BBox{XMin: int(xMin), YMin: int(yMin), XMax: int(xMax), YMax: int(yMax)}, bbox)
+			assert.True(t, bbox.XMax-bbox.XMin < orig.XMax-orig.XMin)
+			assert.True(t, bbox.YMax-bbox.YMin < orig.YMax-orig.YMin)
+		})
+	}
+
+	// Only empty glyphs left.
+	fnt.glyf.descs[0] = &glyphDescription{}
+	space, _ := fnt.LookupRune(' ')
+	subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{space})
+	require.NoError(t, err)
+	bbox, ok := subfnt.BoundingBox()
+	require.True(t, ok)
+	assert.Equal(t, BBox{}, bbox)
+}
+
+func TestRecomputeHhea(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+
+	// The original aggregates are consistent.
+	require.NoError(t, fnt.ValidateHhea())
+	orig := *fnt.hhea
+	require.NoError(t, fnt.RecomputeHhea())
+	assert.Equal(t, orig, *fnt.hhea)
+
+	// Stale values are detected and fixed.
+	fnt.hhea.advanceWidthMax++
+	assert.Error(t, fnt.ValidateHhea())
+	require.NoError(t, fnt.RecomputeHhea())
+	require.NoError(t, fnt.ValidateHhea())
+
+	gid, _ := fnt.LookupRune('i')
+	for name, subfnt := range map[string]*Font{
+		"SubsetKeepIndices": func() *Font {
+			subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{gid})
+			require.NoError(t, err)
+			return subfnt
+		}(),
+		"Subset": func() *Font {
+			subfnt, _, err := fnt.Subset([]GlyphIndex{gid})
+			require.NoError(t, err)
+			return subfnt
+		}(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, subfnt.ValidateHhea())
+			assert.True(t, subfnt.hhea.advanceWidthMax < orig.advanceWidthMax)
+			assert.True(t, subfnt.hhea.xMaxExtent < orig.xMaxExtent)
+			assert.True(t, subfnt.hhea.minLeftSideBearing > orig.minLeftSideBearing)
+		})
+	}
+
+	// Keeping the last glyph, which keeps all the GIDs, with and without the outline of the notdef glyph.
+	last := GlyphIndex(fnt.maxp.numGlyphs - 1)
+	subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{last})
+	require.NoError(t, err)
+	assert.NoError(t, subfnt.ValidateHhea())
+	assert.True(t, subfnt.hhea.xMaxExtent < orig.xMaxExtent)
+	subfnt, _, err = fnt.SubsetWithOptions([]GlyphIndex{last}, SubsetOptions{RetainGIDs: true})
+	require.NoError(t, err)
+	assert.NoError(t, subfnt.ValidateHhea())
+
+	fnt.hmtx = nil
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "hmtx"}, fnt.RecomputeHhea())
+}
+
+func TestStripHinting(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	require.NotNil(t, fnt.prep)
+	require.NotNil(t, fnt.fpgm)
+	require.NotNil(t, fnt.cvt)
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	origSize := buf.Len()
+
+	subfnt, err := fnt.SubsetKeepRunes([]rune("Hello World"))
+	require.NoError(t, err)
+	require.NoError(t, subfnt.StripHinting())
+	assert.Nil(t, subfnt.prep)
+	assert.Nil(t, subfnt.fpgm)
+	assert.Nil(t, subfnt.cvt)
+	assert.NotContains(t, subfnt.UnmodelledTables(), "hdmx")
+	assert.Zero(t, subfnt.maxp.maxSizeOfInstructions)
+	assert.Zero(t, subfnt.maxp.maxFunctionDefs)
+
+	// Stripping the subset does not affect the original font.
+	require.NotNil(t, fnt.prep)
+
+	fnt, err = ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	require.NoError(t, fnt.StripHinting())
+
+	buf.Reset()
+	require.NoError(t, fnt.Write(&buf))
+	assert.True(t, buf.Len() < origSize)
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	orig, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	require.Len(t, newfnt.glyf.descs, len(orig.glyf.descs))
+
+	numComposite := 0
+	for i, gd := range newfnt.glyf.descs {
+		origgd := orig.glyf.descs[i]
+		if len(origgd.raw) == 0 {
+			assert.Empty(t, gd.raw)
+			continue
+		}
+		require.NoError(t, gd.parse())
+		require.NoError(t, origgd.parse())
+		assert.Equal(t, *origgd.header, *gd.header, "gid %d", i)
+
+		if gd.IsSimple() {
+			n, err := gd.numPoints()
+			require.NoError(t, err)
+			origN, err := origgd.numPoints()
+			require.NoError(t, err)
+			assert.Equal(t, origN, n, "gid %d", i)
+			offset := 10 + 2*int(gd.header.numberOfContours)
+			assert.Equal(t, []byte{0, 0}, gd.raw[offset:offset+2], "gid %d", i)
+			continue
+		}
+
+		numComposite++
+		require.Len(t, gd.composite.components, len(origgd.composite.components))
+		assert.Empty(t, gd.composite.instructions)
+		for j, comp := range gd.composite.components {
+			assert.False(t, compositeGlyphFlag(comp.flags).IsSet(weHaveInstructions))
+			assert.Equal(t, origgd.composite.components[j].glyphIndex, comp.glyphIndex)
+		}
+	}
+	assert.NotZero(t, numComposite)
+}
+
+func TestParseBytes(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	fnt, err := ParseBytes(data)
+	require.NoError(t, err)
+	b, err := fnt.Bytes()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	assert.Equal(t, buf.Bytes(), b)
+	require.NoError(t, ValidateBytes(b))
+
+	// WOFF and WOFF2 are identified as by Parse.
+	buf.Reset()
+	require.NoError(t, fnt.WriteWOFF(&buf))
+	wfnt, err := ParseBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 3726, int(wfnt.maxp.numGlyphs))
+
+	buf.Reset()
+	require.NoError(t, fnt.WriteWOFF2(&buf))
+	wfnt, err = ParseBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 3726, int(wfnt.maxp.numGlyphs))
+
+	_, err = ParseBytes(nil)
+	assert.Error(t, err)
+	_, err = ParseBytes([]byte("%PDF-1.7"))
+	assert.EqualError(t, err, "unsupported font format: unknown signature 0x25504446")
+}
+
+func TestParseLenient(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Empty(t, fnt.ParseWarnings())
+
+	// Length of the first name record beyond the table.
+	bad := append([]byte(nil), data...)
+	binary.BigEndian.PutUint16(bad[fnt.trec.trMap["name"].offset+6+8:], 0xFFFF)
+
+	_, err = ParseBytes(bad)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+
+	lfnt, err := ParseWithOptions(bytes.NewReader(bad), ParseOptions{Lenient: true})
+	require.NoError(t, err)
+	assert.Nil(t, lfnt.name)
+	assert.Nil(t, lfnt.trec.trMap["name"])
+	warnings := lfnt.ParseWarnings()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "name", warnings[0].Tag)
+	assert.True(t, errors.Is(warnings[0].Err, ErrInvalidOffset), "%v", warnings[0].Err)
+	assert.NotNil(t, lfnt.post)
+	assert.Equal(t, 3726, int(lfnt.maxp.numGlyphs))
+
+	b, err := lfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(b))
+	rfnt, err := ParseBytes(b)
+	require.NoError(t, err)
+	assert.Nil(t, rfnt.name)
+
+	// Required tables still fail.
+	bad = append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(bad[fnt.trec.trMap["maxp"].offset:], 0x7)
+	_, err = ParseWithOptions(bytes.NewReader(bad), ParseOptions{Lenient: true})
+	assert.Error(t, err)
+
+	_, err = ParseWithOptions(bytes.NewReader(data[:fnt.trec.trMap["head"].offset+10]), ParseOptions{Lenient: true})
+	assert.Error(t, err)
+}
+
+func TestTableAccess(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	var tags []string
+	for _, tr := range fnt.trec.list {
+		tags = append(tags, tr.tableTag.String())
+	}
+	assert.Equal(t, tags, fnt.TableTags())
+	assert.True(t, fnt.HasTable("GSUB"))
+	assert.True(t, fnt.HasTable("OS/2"))
+	assert.True(t, fnt.HasTable("glyf"))
+	assert.False(t, fnt.HasTable("CFF"))
+
+	// Exact original data of modelled and unmodelled tables.
+	for _, tag := range []string{"head", "glyf", "cmap", "name", "post", "GPOS", "gasp"} {
+		tr := fnt.trec.trMap[tag]
+		b, err := fnt.TableBytes(tag)
+		require.NoError(t, err)
+		assert.Equal(t, data[tr.offset:tr.offset+offset32(tr.length)], b, tag)
+	}
+	_, err = fnt.TableBytes("CFF")
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "CFF"}, err)
+
+	// The data returned is a copy.
+	b, err := fnt.TableBytes("GPOS")
+	require.NoError(t, err)
+	b[0] = 0xFF
+	assert.NotEqual(t, b, fnt.rawTableData("GPOS"))
+
+	// Pruned tables are no longer listed.
+	require.NoError(t, fnt.PruneTables("GPOS", "post"))
+	assert.False(t, fnt.HasTable("GPOS"))
+	assert.False(t, fnt.HasTable("post"))
+	assert.NotContains(t, fnt.TableTags(), "GPOS")
+	assert.NotContains(t, fnt.TableTags(), "post")
+	assert.Len(t, fnt.TableTags(), len(tags)-2)
+
+	// Subsets have no original data, the modelled tables are serialized.
+	subfnt, err := fnt.SubsetKeepRunes([]rune("abc"))
+	require.NoError(t, err)
+	assert.True(t, subfnt.HasTable("GSUB"))
+	subdata, err := subfnt.Bytes()
+	require.NoError(t, err)
+	subparsed, err := ParseBytes(subdata)
+	require.NoError(t, err)
+	assert.Equal(t, subparsed.TableTags(), subfnt.TableTags())
+	for _, tag := range []string{"head", "hmtx", "glyf", "cmap"} {
+		b, err := subfnt.TableBytes(tag)
+		require.NoError(t, err)
+		tr := subparsed.trec.trMap[tag]
+		assert.Equal(t, subdata[tr.offset:tr.offset+offset32(tr.length)], b, tag)
+	}
+}
+
+func TestSetTableBytes(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gasp, err := fnt.TableBytes("gasp")
+	require.NoError(t, err)
+	gpos, err := fnt.TableBytes("GPOS")
+	require.NoError(t, err)
+	var pair KerningPair
+	for _, p := range fnt.AllKernPairs() {
+		if p.Left < 200 && p.Right < 200 {
+			pair = p
+			break
+		}
+	}
+	require.NotZero(t, pair.Value)
+
+	subfnt, err := fnt.SubsetFirst(200)
+	require.NoError(t, err)
+	require.NoError(t, subfnt.RemoveTable("gasp"))
+	require.NoError(t, subfnt.RemoveTable("GPOS"))
+	assert.False(t, subfnt.HasTable("gasp"))
+	_, has := subfnt.KernPair(pair.Left, pair.Right)
+	assert.False(t, has)
+
+	// Attached tables are written with their records in the sorted table directory.
+	require.NoError(t, subfnt.SetTableBytes("gasp", gasp))
+	require.NoError(t, subfnt.SetTableBytes("GPOS", gpos))
+	gasp[0] = 0xFF
+	kern, has := subfnt.KernPair(pair.Left, pair.Right)
+	assert.True(t, has)
+	assert.Equal(t, pair.Value, kern)
+
+	b, err := subfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(b))
+	parsed, err := ParseBytes(b)
+	require.NoError(t, err)
+	tags := parsed.TableTags()
+	assert.Contains(t, tags, "gasp")
+	assert.True(t, sort.StringsAreSorted(tags), "%v", tags)
+	data, err := parsed.TableBytes("gasp")
+	require.NoError(t, err)
+	assert.Equal(t, fnt.rawTableData("gasp"), data)
+	data, err = parsed.TableBytes("GPOS")
+	require.NoError(t, err)
+	assert.Equal(t, gpos, data)
+
+	// Replacing a table.
+	require.NoError(t, parsed.SetTableBytes("gasp", []byte{0, 1, 0, 0}))
+	data, err = parsed.TableBytes("gasp")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 0, 0}, data)
+
+	assert.Error(t, parsed.SetTableBytes("head", gasp))
+	assert.Error(t, parsed.SetTableBytes("gasps", gasp))
+	assert.Error(t, parsed.SetTableBytes("", gasp))
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "CFF"}, parsed.RemoveTable("CFF"))
+	assert.Error(t, parsed.RemoveTable("glyf"))
+	assert.True(t, parsed.HasTable("glyf"))
+	require.NoError(t, parsed.RemoveTable("post"))
+	assert.False(t, parsed.HasTable("post"))
+}
+
+func TestConcurrentReads(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	ref, err := ParseBytes(data)
+	require.NoError(t, err)
+
+	runes := []rune("HelloÅÄÖ ×אΩ")
+	fonts := map[string]func() (*Font, error){
+		"ParseBytes": func() (*Font, error) {
+			return ParseBytes(data)
+		},
+		"ParseReaderAt": func() (*Font, error) {
+			return ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+		},
+		"LazyGlyphs": func() (*Font, error) {
+			return ParseWithOptions(bytes.NewReader(data), ParseOptions{LazyGlyphs: true})
+		},
+		"LazyGlyphsReadSeeker": func() (*Font, error) {
+			// Without io.ReaderAt, the data is read under a lock.
+			rs := struct{ io.ReadSeeker }{bytes.NewReader(data)}
+			return ParseWithOptions(rs, ParseOptions{LazyGlyphs: true})
+		},
+	}
+	for name, parse := range fonts {
+		t.Run(name, func(t *testing.T) {
+			fnt, err := parse()
+			require.NoError(t, err)
+			head, err := ref.TableBytes("head")
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 16; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := range runes {
+						r := runes[(i+j)%len(runes)]
+						gid, has := fnt.LookupRune(r)
+						refGID, _ := ref.LookupRune(r)
+						if !assert.True(t, has, string(r)) || !assert.Equal(t, refGID, gid) {
+							return
+						}
+						advance, err := fnt.GlyphAdvance(gid)
+						assert.NoError(t, err)
+						refAdvance, _ := ref.GlyphAdvance(gid)
+						assert.Equal(t, refAdvance, advance)
+
+						o, err := fnt.GlyphOutline(gid)
+						assert.NoError(t, err)
+						refOutline, _ := ref.GlyphOutline(gid)
+						assert.Equal(t, refOutline, o)
+						_, _, _, _, _, err = fnt.GlyphBBox(gid)
+						assert.NoError(t, err)
+						_, err = fnt.GlyphName(gid)
+						assert.NoError(t, err)
+
+						b, err := fnt.TableBytes("head")
+						assert.NoError(t, err)
+						assert.Equal(t, head, b)
+					}
+				}(i)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkSubsetKeepRunes(b *testing.B) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(b, err)
+	runes := []rune("The quick brown fox jumps over the lazy dog. ÅÄÖ")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := fnt.SubsetKeepRunes(runes)
+		require.NoError(b, err)
+	}
+}
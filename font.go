@@ -10,8 +10,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-
-	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"sort"
 )
 
 // Export what UniPDF needs.
@@ -40,6 +40,13 @@ import (
 type font struct {
 	strict            bool
 	incompatibilities []string
+	opts              ParseOptions    // options the font was parsed with.
+	parseWarnings     []ParseWarning  // errors parsing tables tolerated in lenient mode.
+	parseTrace        []TableTrace    // locations of the tables in the order parsed.
+	dirty             map[string]bool // tables modified since parsed, see markDirty.
+	allDirty          bool            // all tables are considered modified since parsed.
+	locaRepaired      bool            // glyph data offsets of the loca table repaired, see ParseOptions.RepairLoca.
+	shortLocaGlyphs   int             // glyphs covered by a loca table too short for maxp.numGlyphs, 0 otherwise.
 
 	ot   *offsetTable
 	trec *tableRecords // table records (references other tables).
@@ -52,10 +59,90 @@ type font struct {
 	prep *prepTable
 	glyf *glyfTable
 	hmtx *hmtxTable
+	vhea *vheaTable
+	vmtx *vmtxTable
 	name *nameTable
 	os2  *os2Table
 	post *postTable
 	cmap *cmapTable
+
+	rawTables []*rawTable // tables that are not modelled, written out verbatim.
+	kern      *kernTable  // parsed from the raw kern table.
+	gpos      *gposTable  // kerning parsed from the raw GPOS table.
+	gsub      *gsubTable  // substitutions parsed from the raw GSUB table.
+	cff       *cffTable   // PostScript outlines parsed from the raw CFF table.
+	fvar      *fvarTable  // variation axes parsed from the raw fvar table.
+	avar      *avarTable  // axis segment maps parsed from the raw avar table.
+	gvar      *gvarTable  // glyph variations parsed from the raw gvar table.
+	colr      *colrTable  // color glyph layers parsed from the raw COLR table.
+	cpal      *cpalTable  // color palettes parsed from the raw CPAL table.
+	sbix      *sbixTable  // bitmap images parsed from the raw sbix table.
+	cbdt      *cbdtTable  // color bitmap images parsed from the raw CBLC and CBDT tables.
+	svg       *svgTable   // SVG glyph documents parsed from the raw SVG table.
+}
+
+// clone returns a deep copy of the modelled tables of `f`. The raw tables and the models parsed from them
+// are shared as they are replaced rather than modified when the font changes.
+func (f *font) clone() *font {
+	newf := *f
+	newf.incompatibilities = append([]string(nil), f.incompatibilities...)
+	newf.parseWarnings = append([]ParseWarning(nil), f.parseWarnings...)
+	newf.parseTrace = append([]TableTrace(nil), f.parseTrace...)
+	newf.dirty = map[string]bool{}
+	for tag := range f.dirty {
+		newf.dirty[tag] = true
+	}
+	newf.ot = f.ot.Clone()
+	newf.trec = f.trec.Clone()
+	newf.head = f.head.Clone()
+	newf.hhea = f.hhea.Clone()
+	newf.loca = f.loca.Clone()
+	newf.maxp = f.maxp.Clone()
+	newf.cvt = f.cvt.Clone()
+	newf.fpgm = f.fpgm.Clone()
+	newf.prep = f.prep.Clone()
+	newf.glyf = f.glyf.Clone()
+	newf.hmtx = f.hmtx.Clone()
+	newf.vhea = f.vhea.Clone()
+	newf.vmtx = f.vmtx.Clone()
+	newf.name = f.name.Clone()
+	newf.os2 = f.os2.Clone()
+	newf.post = f.post.Clone()
+	newf.cmap = f.cmap.Clone()
+	newf.rawTables = append([]*rawTable(nil), f.rawTables...)
+	return &newf
+}
+
+// markDirty records the tables `tags` of `f` as modified since parsed, or all tables if no tag is given.
+// Tables that are not modified are copied from the parsed font data when written with WriteOptions.KeepLayout.
+func (f *font) markDirty(tags ...string) {
+	if len(tags) == 0 {
+		f.allDirty = true
+		return
+	}
+	if f.dirty == nil {
+		f.dirty = map[string]bool{}
+	}
+	for _, tag := range tags {
+		f.dirty[tag] = true
+	}
+}
+
+// isDirty returns true if the table `tag` of `f` was modified since parsed, see markDirty.
+func (f *font) isDirty(tag string) bool {
+	return f.allDirty || f.dirty[tag]
+}
+
+// tolerateParseError returns `err`, the error parsing table `tag`, unless in lenient mode in which case the error
+// is recorded as a parse warning and the table record is removed so that the table is treated as absent.
+func (f *font) tolerateParseError(tag string, err error) error {
+	if !f.opts.Lenient {
+		return err
+	}
+	logger.Debugf("Error parsing %s table: %v - ignoring the table", tag, err)
+	f.parseWarnings = append(f.parseWarnings, ParseWarning{Tag: tag, Err: err})
+	f.trec.Remove(tag)
+	return nil
 }
 
 // Returns an error in strict mode, otherwise adds the incompatibility to a list of noted incompatibilities.
@@ -73,397 +160,607 @@ func (f font) numTables() int {
 }
 
 func parseFont(r *byteReader) (*font, error) {
-	f := &font{}
+	return parseFontWithOptions(r, ParseOptions{})
+}
+
+// parseFontWithOptions parses the font in `r` with options `opts`.
+func parseFontWithOptions(r *byteReader, opts ParseOptions) (*font, error) {
+	f := &font{opts: opts}
 
 	var err error
 
 	// Load table offsets and records.
 	f.ot, err = f.parseOffsetTable(r)
 	if err != nil {
-		return nil, err
+		return nil, wrapParseError("offset table", r.Offset(), err)
 	}
 
 	f.trec, err = f.parseTableRecords(r)
 	if err != nil {
-		return nil, err
+		return nil, wrapParseError("table records", r.Offset(), err)
 	}
 
 	f.head, err = f.parseHead(r)
 	if err != nil {
-		return nil, err
+		return nil, wrapParseError("head", r.Offset(), err)
 	}
 
 	f.maxp, err = f.parseMaxp(r)
 	if err != nil {
-		return nil, err
+		return nil, wrapParseError("maxp", r.Offset(), err)
 	}
 
 	f.hhea, err = f.parseHhea(r)
 	if err != nil {
-		return nil, err
+		f.hhea = nil
+		err = f.tolerateParseError("hhea", wrapParseError("hhea", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.hmtx, err = f.parseHmtx(r)
 	if err != nil {
-		return nil, err
+		f.hmtx = nil
+		err = f.tolerateParseError("hmtx", wrapParseError("hmtx", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.vhea, err = f.parseVhea(r)
+	if err != nil {
+		f.vhea = nil
+		err = f.tolerateParseError("vhea", wrapParseError("vhea", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.vmtx, err = f.parseVmtx(r)
+	if err != nil {
+		f.vmtx = nil
+		err = f.tolerateParseError("vmtx", wrapParseError("vmtx", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.loca, err = f.parseLoca(r)
 	if err != nil {
-		return nil, err
+		return nil, wrapParseError("loca", r.Offset(), err)
 	}
 
 	f.glyf, err = f.parseGlyf(r)
 	if err != nil {
-		return nil, err
+		return nil, wrapParseError("glyf", r.Offset(), err)
 	}
 
 	f.prep, err = f.parsePrep(r)
 	if err != nil {
-		return nil, err
+		f.prep = nil
+		err = f.tolerateParseError("prep", wrapParseError("prep", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.name, err = f.parseNameTable(r)
 	if err != nil {
-		return nil, err
+		f.name = nil
+		err = f.tolerateParseError("name", wrapParseError("name", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.os2, err = f.parseOS2Table(r)
 	if err != nil {
-		return nil, err
+		f.os2 = nil
+		err = f.tolerateParseError("OS/2", wrapParseError("OS/2", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.post, err = f.parsePost(r)
 	if err != nil {
-		return nil, err
+		f.post = nil
+		err = f.tolerateParseError("post", wrapParseError("post", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.cmap, err = f.parseCmap(r)
 	if err != nil {
-		return nil, err
+		f.cmap = nil
+		err = f.tolerateParseError("cmap", wrapParseError("cmap", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.cvt, err = f.parseCvt(r)
 	if err != nil {
-		return nil, err
+		f.cvt = nil
+		err = f.tolerateParseError("cvt", wrapParseError("cvt", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	f.fpgm, err = f.parseFpgm(r)
+	if err != nil {
+		f.fpgm = nil
+		err = f.tolerateParseError("fpgm", wrapParseError("fpgm", r.Offset(), err))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.rawTables, err = f.parseRawTables(r)
 	if err != nil {
 		return nil, err
 	}
+	for _, tag := range derivedTables {
+		f.parseDerivedTable(tag)
+	}
 
 	return f, nil
 }
 
-// numTablesToWrite returns the number of tables in `f`.
-// Calculates based on the number of tables will be written out.
-// NOTE that not all tables that are loaded are written out.
-func (f *font) numTablesToWrite() int {
-	var num int
+// derivedTables are the tables not modelled with a model derived from the raw table data.
+var derivedTables = []string{"kern", "GPOS", "GSUB", "CFF", "fvar", "avar", "gvar", "COLR", "CPAL", "sbix", "CBDT",
+	"SVG"}
+
+// parseDerivedTable parses the model derived from the data of the raw table `tag`, if any.
+func (f *font) parseDerivedTable(tag string) {
+	switch tag {
+	case "kern":
+		f.kern = f.parseKern()
+	case "GPOS":
+		f.gpos = f.parseGPOS()
+	case "GSUB":
+		f.gsub = f.parseGSUB()
+	case "CFF":
+		f.cff = f.parseCFF()
+	case "fvar":
+		f.fvar = f.parseFvar()
+	case "avar":
+		f.avar = f.parseAvar()
+	case "gvar":
+		f.gvar = f.parseGvar()
+	case "COLR":
+		f.colr = f.parseColr()
+	case "CPAL":
+		f.cpal = f.parseCpal()
+	case "sbix":
+		f.sbix = f.parseSbix()
+	case "CBLC", "CBDT":
+		f.cbdt = f.parseCbdt()
+	case "SVG":
+		f.svg = f.parseSVG()
+	}
+}
 
-	if f.head != nil {
-		num++
+// dsigEmpty is the data of an empty DSIG table: version 1 with no signatures and no flags.
+var dsigEmpty = []byte{0, 0, 0, 1, 0, 0, 0, 0}
+
+// prepareWrite returns the font to write for `f` with options `opts`: `f` itself or a copy with the tables
+// modified by the options, with the loca format selected for the glyph data.
+func (f *font) prepareWrite(opts *WriteOptions) (*font, error) {
+	if opts.DropGlyphNames && f.post != nil {
+		// Write a copy so that the names of `f` are kept.
+		dup := *f
+		dup.post = f.post.withoutNames()
+		f = &dup
+	}
+	if opts.ZeroModifiedDate && f.head != nil {
+		dup := *f
+		head := *f.head
+		head.modified = 0
+		dup.head = &head
+		f = &dup
+	}
+	// The loca format is selected from the size of the glyph data written.
+	err := f.updateLocaFormat()
+	if err != nil {
+		return nil, err
 	}
-	if f.maxp != nil {
-		num++
+	return f, nil
+}
+
+// write writes `f` to `w` with options `opts`, which may be nil for the defaults.
+// A DSIG table is only kept if the font is written unmodified, as the signature is invalid otherwise. It is
+// dropped from modified fonts, or replaced by an empty DSIG table if opts.EmptyDSIG is set.
+func (f *font) write(w *byteWriter, opts *WriteOptions) error {
+	if opts == nil {
+		opts = &WriteOptions{}
 	}
-	if f.hhea != nil {
-		num++
+	f, err := f.prepareWrite(opts)
+	if err != nil {
+		return err
 	}
-	if f.hmtx != nil {
-		num++
+	if f.rawTableData("DSIG") == nil {
+		return f.writeTables(w, opts)
 	}
-	if f.loca != nil {
-		num++
+
+	// Write without the signature to determine whether any table is modified.
+	unsigned := *f
+	unsigned.rawTables = nil
+	for _, t := range f.rawTables {
+		if t.tableTag.String() != "DSIG" {
+			unsigned.rawTables = append(unsigned.rawTables, t)
+		}
 	}
-	if f.glyf != nil {
-		num++
+	var buf bytes.Buffer
+	bufw := newByteWriter(&buf)
+	err = unsigned.writeTables(bufw, opts)
+	if err != nil {
+		return err
 	}
-	if f.cvt != nil {
-		num++
+	err = bufw.flush()
+	if err != nil {
+		return err
 	}
-	if f.fpgm != nil {
-		num++
+	modified, err := f.modifiedTables(buf.Bytes())
+	if err != nil {
+		return err
 	}
-	if f.prep != nil {
-		num++
+
+	switch {
+	case len(modified) == 0:
+		return f.writeTables(w, opts)
+	case opts.EmptyDSIG:
+		logger.Debugf("Tables %v modified - replacing DSIG by an empty DSIG", modified)
+		unsigned.rawTables = f.rawTables
+		unsigned.setRawTableData("DSIG", dsigEmpty)
+		return unsigned.writeTables(w, opts)
 	}
-	if f.name != nil {
-		num++
+	logger.Debugf("Tables %v modified - dropping DSIG", modified)
+	return w.writeBytes(buf.Bytes())
+}
+
+// modifiedTables returns the names of the tables of `f` that differ in the font `data` written from `f`,
+// by comparing the table records to those `f` was loaded from. The DSIG table is not considered. Tables added
+// or removed count as modified.
+func (f *font) modifiedTables(data []byte) ([]string, error) {
+	r := newByteReader(bytes.NewReader(data))
+	mockf := &font{}
+	ot, err := mockf.parseOffsetTable(r)
+	if err != nil {
+		return nil, err
 	}
-	if f.os2 != nil {
-		num++
+	mockf.ot = ot
+	written, err := mockf.parseTableRecords(r)
+	if err != nil {
+		return nil, err
 	}
-	if f.post != nil {
-		num++
+
+	var modified []string
+	original := map[string]bool{}
+	if f.trec != nil {
+		for _, tr := range f.trec.list {
+			name := tr.tableTag.String()
+			if name == "DSIG" {
+				continue
+			}
+			original[name] = true
+			wtr, has := written.trMap[name]
+			if !has || wtr.length != tr.length || !f.sameTableChecksum(name, wtr, tr) {
+				modified = append(modified, name)
+			}
+		}
 	}
-	if f.cmap != nil {
-		num++
+	for _, wtr := range written.list {
+		if name := wtr.tableTag.String(); !original[name] {
+			modified = append(modified, name)
+		}
 	}
-	return num
+	return modified, nil
 }
 
-func (f *font) write(w *byteWriter) error {
-	logrus.Debug("Writing font")
-	numTables := f.numTablesToWrite()
-	otTable := &offsetTable{
-		sfntVersion:   f.ot.sfntVersion,
-		numTables:     uint16(numTables),
-		searchRange:   f.ot.searchRange,
-		entrySelector: f.ot.entrySelector,
-		rangeShift:    f.ot.rangeShift,
+// sameTableChecksum returns true if the checksum of the written table `name` with record `wtr` matches that
+// of the original record `tr`. The checksum of the head table is written with the checksumAdjustment field set
+// to 0 as per the spec, whereas some fonts include the field.
+func (f *font) sameTableChecksum(name string, wtr, tr *tableRecord) bool {
+	if wtr.checksum == tr.checksum {
+		return true
 	}
-	trec := &tableRecords{}
+	return name == "head" && f.head != nil && wtr.checksum+f.head.checksumAdjustment == tr.checksum
+}
+
+// tableWriter writes the table `tag` of a font.
+type tableWriter struct {
+	tag   string
+	write func(w *byteWriter) error
+}
+
+// tableWriters returns the writers of the tables of `f` in the order they are laid out in the font, see
+// tableOrder.
+func (f *font) tableWriters(opts *WriteOptions) []tableWriter {
+	tables := []tableWriter{
+		{"head", f.writeHead},
+		{"maxp", f.writeMaxp},
+	}
+	add := func(present bool, tag string, write func(w *byteWriter) error) {
+		if present {
+			tables = append(tables, tableWriter{tag, write})
+		}
+	}
+	add(f.hhea != nil, "hhea", f.writeHhea)
+	add(f.hmtx != nil, "hmtx", f.writeHmtx)
+	add(f.vhea != nil, "vhea", f.writeVhea)
+	add(f.vmtx != nil, "vmtx", f.writeVmtx)
+	add(f.loca != nil, "loca", f.writeLoca)
+	add(f.glyf != nil, "glyf", f.writeGlyf)
+	add(f.prep != nil, "prep", f.writePrep)
+	add(f.cvt != nil, "cvt", f.writeCvt)
+	add(f.fpgm != nil, "fpgm", f.writeFpgm)
+	add(f.name != nil, "name", f.writeNameTable)
+	add(f.os2 != nil, "OS/2", f.writeOS2)
+	add(f.post != nil, "post", f.writePost)
+	add(f.cmap != nil, "cmap", f.writeCmap)
+	for _, t := range f.rawTables {
+		t := t
+		add(true, t.tableTag.String(), func(w *byteWriter) error {
+			return f.writeRawTable(w, t)
+		})
+	}
+	rank := f.tableOrder(opts)
+	sort.SliceStable(tables, func(i, j int) bool {
+		return rank(tables[i].tag) < rank(tables[j].tag)
+	})
+	return tables
+}
 
+// recommendedTableOrder is the order of the tables in TrueType fonts recommended by the spec.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/recom#optimized-table-ordering
+var recommendedTableOrder = []string{"head", "hhea", "maxp", "OS/2", "hmtx", "LTSH", "VDMX", "hdmx", "cmap",
+	"fpgm", "prep", "cvt", "loca", "glyf", "kern", "name", "post", "gasp", "PCLT"}
+
+// recommendedTableOrderCFF is the order of the tables in fonts with CFF outlines recommended by the spec.
+var recommendedTableOrderCFF = []string{"head", "hhea", "maxp", "OS/2", "name", "cmap", "post", "CFF"}
+
+// tableOrder returns a function ranking the tables of `f` in the order they are laid out in the font: the
+// order recommended by the spec, with the other tables following in their current order and the DSIG table
+// last, or their order in the font `f` was loaded from if opts.PreserveTableOrder is set.
+func (f *font) tableOrder(opts *WriteOptions) func(tag string) int {
+	ranks := map[string]int{}
+	var other int
+	if opts.PreserveTableOrder && f.trec != nil {
+		recs := append([]*tableRecord(nil), f.trec.list...)
+		sort.SliceStable(recs, func(i, j int) bool {
+			return recs[i].offset < recs[j].offset
+		})
+		for i, tr := range recs {
+			ranks[tr.tableTag.String()] = i
+		}
+		other = len(recs)
+	} else {
+		order := recommendedTableOrder
+		if f.ot != nil && f.ot.sfntVersion == signatureCFF {
+			order = recommendedTableOrderCFF
+		}
+		for i, tag := range order {
+			ranks[tag] = i
+		}
+		other = len(order)
+		ranks["DSIG"] = other + 1
+	}
+	return func(tag string) int {
+		if rank, has := ranks[tag]; has {
+			return rank
+		}
+		return other
+	}
+}
+
+// streamFlushSize is the size at which table data is flushed to the destination while streaming.
+const streamFlushSize = 64 * 1024
+
+// writeTables writes `f` to `w` as an sfnt font. The tables are streamed to the destination of `w` as they are
+// written, computing their lengths and checksums on the way, so the font is not held in memory. The table
+// records and the checksumAdjustment of the head table depend on the tables, and are back-patched if the
+// destination is a bytes.Buffer or an io.WriteSeeker. Otherwise the tables are written twice: first to compute
+// the table records only, then to the destination following the table records.
+func (f *font) writeTables(w *byteWriter, opts *WriteOptions) error {
+	logger.Debugf("Writing font")
+	tables := f.tableWriters(opts)
+	numTables := len(tables)
 	f.ot.numTables = uint16(numTables)
 
 	// Starting offset after offset table and table records.
 	startOffset := int64(12 + numTables*16)
+	logger.Tracef("==== write\nnumTables: %d\nstartOffset: %d", numTables, startOffset)
 
-	logrus.Tracef("==== write\nnumTables: %d\nstartOffset: %d", numTables, startOffset)
-	logrus.Trace("Write 2")
-	// Writing is two phases and is done in a few steps:
-	// 1. Write the content tables: head, hhea, etc in the expected order and keep track of the length, checksum for each.
-	// 2. Generate the table records based on the information.
-	// 3. Write out in final order: offset table, table records, head, ...
-	// 4. Set checkAdjustment of head table based on checksumof entire file
-	// 5. Write the final output
+	err := w.flush()
+	if err != nil {
+		return err
+	}
+	dst := w.w
 
-	// Write to buffer to get offsets.
-	var buf bytes.Buffer
-	var headChecksum uint32
-	{
-		bufw := newByteWriter(&buf)
-
-		// head.
-		f.head.checksumAdjustment = 0
-		offset := startOffset
-		err := f.writeHead(bufw)
+	switch t := dst.(type) {
+	case *bytes.Buffer:
+		start := t.Len()
+		_, err = t.Write(make([]byte, startOffset))
 		if err != nil {
 			return err
 		}
-		headChecksum = bufw.checksum()
-		trec.Set("head", offset, bufw.bufferedLen(), headChecksum)
-		err = bufw.flush()
+		trec, sum, err := f.streamTables(t, tables, startOffset, 0)
 		if err != nil {
 			return err
 		}
-
-		// maxp.
-		offset = startOffset + bufw.flushedLen
-		err = f.writeMaxp(bufw)
+		header, adjustment, err := f.tableDirectory(trec, sum)
 		if err != nil {
 			return err
 		}
-		trec.Set("maxp", offset, bufw.bufferedLen(), bufw.checksum())
-		err = bufw.flush()
+		data := t.Bytes()[start:]
+		copy(data, header)
+		binary.BigEndian.PutUint32(data[trec.trMap["head"].offset+8:], adjustment)
+		w.flushedLen += int64(len(data))
+		return nil
+
+	case io.WriteSeeker:
+		start, err := t.Seek(0, io.SeekCurrent)
 		if err != nil {
 			return err
 		}
-
-		// hhea.
-		if f.hhea != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeHhea(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("hhea", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
-		}
-
-		// hmtx.
-		if f.hmtx != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeHmtx(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("hmtx", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+		_, err = t.Write(make([]byte, startOffset))
+		if err != nil {
+			return err
 		}
-
-		// loca.
-		if f.loca != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeLoca(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("loca", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+		trec, sum, err := f.streamTables(t, tables, startOffset, 0)
+		if err != nil {
+			return err
 		}
-
-		// glyf.
-		if f.glyf != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeGlyf(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("glyf", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+		header, adjustment, err := f.tableDirectory(trec, sum)
+		if err != nil {
+			return err
 		}
-
-		// prep.
-		if f.prep != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writePrep(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("prep", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+		end, err := t.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
 		}
-
-		// cvt.
-		if f.cvt != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeCvt(bufw)
+		var adj [4]byte
+		binary.BigEndian.PutUint32(adj[:], adjustment)
+		patches := []struct {
+			offset int64
+			data   []byte
+		}{
+			{start, header},
+			{start + int64(trec.trMap["head"].offset) + 8, adj[:]},
+		}
+		for _, p := range patches {
+			_, err = t.Seek(p.offset, io.SeekStart)
 			if err != nil {
 				return err
 			}
-			trec.Set("cvt", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
+			_, err = t.Write(p.data)
 			if err != nil {
 				return err
 			}
 		}
-
-		// fpgm.
-		if f.fpgm != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeFpgm(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("fpgm", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+		_, err = t.Seek(end, io.SeekStart)
+		if err != nil {
+			return err
 		}
+		w.flushedLen += end - start
+		return nil
+	}
 
-		// name.
-		if f.name != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeNameTable(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("name", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+	// Not seekable: compute the table records in a first pass without keeping the data.
+	trec, sum, err := f.streamTables(ioutil.Discard, tables, startOffset, 0)
+	if err != nil {
+		return err
+	}
+	header, adjustment, err := f.tableDirectory(trec, sum)
+	if err != nil {
+		return err
+	}
+	cw := &checksumWriter{w: dst}
+	_, err = cw.Write(header)
+	if err != nil {
+		return err
+	}
+	trec2, _, err := f.streamTables(cw, tables, startOffset, adjustment)
+	w.flushedLen += cw.total
+	if err != nil {
+		return err
+	}
+	sortTableRecords(trec2)
+	for i, tr := range trec.list {
+		tr2 := trec2.list[i]
+		if tr.offset != tr2.offset || tr.length != tr2.length || tr.checksum != tr2.checksum {
+			logger.Debugf("Table %s changed between write passes", tr.tableTag.String())
+			return errRangeCheck
 		}
+	}
+	return nil
+}
 
-		// os2.
-		if f.os2 != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeOS2(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("OS/2", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
-		}
+// streamTables writes `tables` to `dst`, starting at `startOffset` in the font, with the checksumAdjustment of
+// the head table set to `adjustment`. Returns the table records, sorted by tag, and the sum of the table
+// checksums. The head checksum is computed with a zero checksumAdjustment, as per the spec.
+func (f *font) streamTables(dst io.Writer, tables []tableWriter, startOffset int64,
+	adjustment uint32) (*tableRecords, uint32, error) {
+	cw := &checksumWriter{w: dst}
+	tw := newByteWriter(cw)
+	tw.flushSize = streamFlushSize
+	trec := &tableRecords{}
 
-		// post
-		if f.post != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writePost(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("post", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
-			}
+	var sum uint32
+	offset := startOffset
+	for _, t := range tables {
+		cw.reset()
+		err := t.write(tw)
+		if err != nil {
+			return nil, 0, err
 		}
 
-		// cmap
-		if f.cmap != nil {
-			offset = startOffset + bufw.flushedLen
-			err = f.writeCmap(bufw)
-			if err != nil {
-				return err
-			}
-			trec.Set("cmap", offset, bufw.bufferedLen(), bufw.checksum())
-			err = bufw.flush()
-			if err != nil {
-				return err
+		var headChecksum uint32
+		isHead := t.tag == "head"
+		if isHead {
+			data := tw.buffer.Bytes()
+			if cw.n != 0 || len(data) < 12 {
+				logger.Debugf("head: invalid length (write)")
+				return nil, 0, errRangeCheck
 			}
+			binary.BigEndian.PutUint32(data[8:], 0)
+			headChecksum = tableChecksum(data)
+			binary.BigEndian.PutUint32(data[8:], adjustment)
 		}
-	}
-	logrus.Trace("Write 3")
-
-	// Write the offset and table records to another mock buffer.
-	var bufh bytes.Buffer
-	{
-		bufw := newByteWriter(&bufh)
-		// Create a mock font for writing without modifying the original entries of `f`.
-		mockf := &font{
-			ot:   otTable,
-			trec: trec,
-		}
-
-		err := mockf.writeOffsetTable(bufw)
+		err = tw.flush()
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
 
-		err = mockf.writeTableRecords(bufw)
-		if err != nil {
-			return err
+		checksum := cw.checksum()
+		if isHead {
+			checksum = headChecksum
 		}
-		err = bufw.flush()
+		trec.Set(t.tag, offset, int(cw.n), checksum)
+		sum += checksum
+
+		err = cw.pad()
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
+		offset += cw.n
 	}
 
-	// Write everything to bufh.
-	_, err := buf.WriteTo(&bufh)
+	// The table records are sorted by tag, whereas the tables are in the order written.
+	sortTableRecords(trec)
+	return trec, sum, nil
+}
+
+// tableDirectory returns the offset table and table records `trec` of `f` as written, and the
+// checksumAdjustment of the head table given the sum of the table checksums `sum`.
+func (f *font) tableDirectory(trec *tableRecords, sum uint32) ([]byte, uint32, error) {
+	var buf bytes.Buffer
+	bufw := newByteWriter(&buf)
+	// Create a mock font for writing without modifying the original entries of `f`.
+	mockf := &font{
+		ot:   newOffsetTable(f.ot.sfntVersion, len(trec.list)),
+		trec: trec,
+	}
+	err := mockf.writeOffsetTable(bufw)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-
-	// Calculate total checksum for the entire font.
-	checksummer := byteWriter{
-		buffer: bufh,
+	err = mockf.writeTableRecords(bufw)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = bufw.flush()
+	if err != nil {
+		return nil, 0, err
 	}
-	fontChecksum := checksummer.checksum()
-	checksumAdjustment := 0xB1B0AFBA - fontChecksum
-
-	// Set the checksumAdjustment of the head table.
-	data := bufh.Bytes()
-	hoff := startOffset
-	binary.BigEndian.PutUint32(data[hoff+8:hoff+12], checksumAdjustment)
 
-	buffer := bytes.NewBuffer(data)
-	_, err = io.Copy(&w.buffer, buffer)
-	return err
+	// The font checksum is that of the table directory and the tables, padded to 4 bytes each.
+	fontChecksum := tableChecksum(buf.Bytes()) + sum
+	return buf.Bytes(), 0xB1B0AFBA - fontChecksum, nil
 }
 
 // TableInfo provides readable information regarding a table.
@@ -512,6 +809,19 @@ func (f *font) TableInfo(table string) string {
 		}
 		b.WriteString(fmt.Sprintf("hmtx: hmetrics: %d, leftSideBearings: %d\n",
 			len(f.hmtx.hMetrics), len(f.hmtx.leftSideBearings)))
+	case "vhea":
+		if f.vhea == nil {
+			b.WriteString("vhea: missing\n")
+			break
+		}
+		b.WriteString(fmt.Sprintf("vhea table: numOfLongVerMetrics: %d\n", f.vhea.numOfLongVerMetrics))
+	case "vmtx":
+		if f.vmtx == nil {
+			b.WriteString("vmtx: missing\n")
+			break
+		}
+		b.WriteString(fmt.Sprintf("vmtx: vmetrics: %d, topSideBearings: %d\n",
+			len(f.vmtx.vMetrics), len(f.vmtx.topSideBearings)))
 	case "cmap":
 		if f.cmap == nil {
 			b.WriteString("cmap: missing\n")
@@ -551,7 +861,7 @@ func (f *font) TableInfo(table string) string {
 		}
 		rawTotal := 0.0
 		for _, desc := range f.glyf.descs {
-			rawTotal += float64(len(desc.raw))
+			rawTotal += float64(desc.size())
 		}
 		b.WriteString(fmt.Sprintf("glyf table present: %d descriptions (%.2f kB)\n", len(f.glyf.descs), rawTotal/1024))
 	case "post":
@@ -580,3 +890,38 @@ func (f *font) TableInfo(table string) string {
 func (f *font) String() string {
 	return f.TableInfo("trec")
 }
+
+// sfntData represents the data of a font as written out along with its table records.
+type sfntData struct {
+	data []byte
+	ot   *offsetTable
+	trec *tableRecords
+}
+
+// writeSfnt writes `f` as a standalone font and returns the data with the table records, as a basis for
+// writing `f` in other containers.
+func (f *Font) writeSfnt() (*sfntData, error) {
+	data, err := f.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sfntData{data: data}
+	r := newByteReader(bytes.NewReader(s.data))
+	mockf := &font{}
+	s.ot, err = mockf.parseOffsetTable(r)
+	if err != nil {
+		return nil, err
+	}
+	mockf.ot = s.ot
+	s.trec, err = mockf.parseTableRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// tableData returns the data of the table with record `tr` in `s`.
+func (s *sfntData) tableData(tr *tableRecord) []byte {
+	return s.data[tr.offset : int64(tr.offset)+int64(tr.length)]
+}
@@ -1,9 +1,16 @@
 package unitype
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
 	"testing"
 
-	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,7 +36,7 @@ func TestReadWrite(t *testing.T) {
 		fnt, err := ParseFile(tcase.fontPath)
 		require.NoError(t, err)
 
-		logrus.Debug("Write")
+		logger.Debugf("Write")
 		outPath := "/tmp/1.ttf"
 
 		t.Logf("WriteFile -> %s", outPath)
@@ -41,3 +48,357 @@ func TestReadWrite(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+// buildTestSignedFont returns FreeSans with a DSIG table, such that writing it unmodified keeps the table.
+func buildTestSignedFont(t *testing.T) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+
+	// Recorded as loaded with the DSIG table.
+	fnt.rawTables = append(fnt.rawTables, &rawTable{tableTag: makeTag("DSIG"), data: []byte{0, 0, 0, 1, 0, 0, 0, 0xA}})
+	fnt.trec.Set("DSIG", 0, 9, 0)
+	data, err = fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, fnt.rawTableData("DSIG"))
+	return fnt
+}
+
+func TestWriteDSIG(t *testing.T) {
+	fnt := buildTestSignedFont(t)
+	signature := fnt.rawTableData("DSIG")
+
+	// Written unmodified.
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	written, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, signature, written.rawTableData("DSIG"))
+
+	// Modified.
+	fnt.SetNameRecord(6, "Signed")
+	data, err = fnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	written, err = ParseBytes(data)
+	require.NoError(t, err)
+	assert.Nil(t, written.rawTableData("DSIG"))
+	assert.False(t, written.trec.HasTable("DSIG"))
+	assert.Equal(t, int(written.ot.numTables), len(written.trec.list))
+	assert.Equal(t, newOffsetTable(written.ot.sfntVersion, len(written.trec.list)), written.ot)
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.WriteWithOptions(&buf, &WriteOptions{EmptyDSIG: true}))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	written, err = ParseBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, dsigEmpty, written.rawTableData("DSIG"))
+
+	// Subsetted.
+	subfnt, err := fnt.SubsetFirst(10)
+	require.NoError(t, err)
+	data, err = subfnt.Bytes()
+	require.NoError(t, err)
+	written, err = ParseBytes(data)
+	require.NoError(t, err)
+	assert.Nil(t, written.rawTableData("DSIG"))
+}
+
+// testChecksum returns the checksum of `data` computed independently of tableChecksum.
+func testChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i++ {
+		sum += uint32(data[i]) << uint(24-8*(i%4))
+	}
+	return sum
+}
+
+func TestWriteChecksums(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-BoldItalic.ttf")
+	require.NoError(t, err)
+	subfnt, err := fnt.SubsetFirst(30)
+	require.NoError(t, err)
+
+	for _, f := range []*Font{fnt, subfnt} {
+		adjustment := f.head.checksumAdjustment
+		data, err := f.Bytes()
+		require.NoError(t, err)
+		// The font is not modified by writing.
+		assert.Equal(t, adjustment, f.head.checksumAdjustment)
+
+		written, err := ParseBytes(data)
+		require.NoError(t, err)
+		for _, tr := range written.trec.list {
+			assert.Zero(t, tr.offset%4, tr.tableTag.String())
+			table := append([]byte(nil), data[tr.offset:tr.offset+offset32(tr.length)]...)
+			if tr.tableTag.String() == "head" {
+				assert.Equal(t, written.head.checksumAdjustment, binary.BigEndian.Uint32(table[8:]))
+				binary.BigEndian.PutUint32(table[8:], 0)
+			}
+			assert.Equal(t, testChecksum(table), tr.checksum, tr.tableTag.String())
+		}
+		assert.Zero(t, len(data)%4)
+		assert.Equal(t, uint32(0xB1B0AFBA), testChecksum(data))
+		require.NoError(t, ValidateBytes(data))
+	}
+}
+
+// writerOnly hides the other methods of the writer, such as Seek, to test writing to non-seekable writers.
+type writerOnly struct {
+	io.Writer
+}
+
+func TestWriteStreaming(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	expected, err := fnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(expected))
+
+	// Not seekable: the tables are written twice.
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(writerOnly{&buf}))
+	assert.Equal(t, expected, buf.Bytes())
+
+	// Seekable: the table directory is back-patched relative to the start of the font.
+	f, err := ioutil.TempFile("", "unitype")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	prefix := []byte("prefix")
+	_, err = f.Write(prefix)
+	require.NoError(t, err)
+	require.NoError(t, fnt.Write(f))
+	_, err = f.Write(prefix)
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, append(append(append([]byte(nil), prefix...), expected...), prefix...), data)
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	fontPaths := []string{
+		"./testdata/FreeSans.ttf",
+		"./testdata/wts11.ttf",
+		"./testdata/roboto/Roboto-Regular.ttf",
+		"./testdata/roboto/Roboto-BoldItalic.ttf",
+	}
+	for _, fontPath := range fontPaths {
+		t.Run(fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(fontPath)
+			require.NoError(t, err)
+			subfnt, err := fnt.SubsetFirst(100)
+			require.NoError(t, err)
+
+			for _, f := range []*Font{fnt, subfnt} {
+				data1, err := f.Bytes()
+				require.NoError(t, err)
+				data2, err := f.Bytes()
+				require.NoError(t, err)
+				require.Equal(t, data1, data2)
+
+				// The table records and the cmap encoding records are sorted.
+				written, err := ParseBytes(data1)
+				require.NoError(t, err)
+				for i := 1; i < len(written.trec.list); i++ {
+					assert.True(t, written.trec.list[i-1].tableTag.String() < written.trec.list[i].tableTag.String())
+				}
+				recs := written.cmap.encodingRecords
+				for i := 1; i < len(recs); i++ {
+					assert.True(t, recs[i-1].platformID < recs[i].platformID ||
+						recs[i-1].platformID == recs[i].platformID && recs[i-1].encodingID <= recs[i].encodingID)
+				}
+			}
+
+			modified := fnt.head.modified
+			require.NotZero(t, modified)
+			var buf bytes.Buffer
+			require.NoError(t, fnt.WriteWithOptions(&buf, &WriteOptions{ZeroModifiedDate: true}))
+			written, err := ParseBytes(buf.Bytes())
+			require.NoError(t, err)
+			assert.Zero(t, written.head.modified)
+			assert.Equal(t, modified, fnt.head.modified)
+			require.NoError(t, ValidateBytes(buf.Bytes()))
+		})
+	}
+}
+
+// physicalTableOrder returns the tags of the tables of `f` in the order of their data.
+func physicalTableOrder(f *Font) []string {
+	recs := append([]*tableRecord(nil), f.trec.list...)
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].offset < recs[j].offset
+	})
+	var tags []string
+	for _, tr := range recs {
+		tags = append(tags, tr.tableTag.String())
+	}
+	return tags
+}
+
+func TestWriteTableOrder(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Regular.ttf")
+	require.NoError(t, err)
+
+	for _, preserve := range []bool{false, true} {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.WriteWithOptions(&buf, &WriteOptions{PreserveTableOrder: preserve}))
+		require.NoError(t, ValidateBytes(buf.Bytes()))
+		written, err := ParseBytes(buf.Bytes())
+		require.NoError(t, err)
+
+		// The binary search fields match the number of tables.
+		numTables := len(written.trec.list)
+		assert.Equal(t, numTables, int(written.ot.numTables))
+		assert.Equal(t, 16<<written.ot.entrySelector, int(written.ot.searchRange))
+		assert.True(t, int(written.ot.searchRange) <= 16*numTables && 32*numTables < 4*int(written.ot.searchRange))
+		assert.Equal(t, 16*numTables-int(written.ot.searchRange), int(written.ot.rangeShift))
+
+		order := physicalTableOrder(written)
+		if preserve {
+			assert.Equal(t, physicalTableOrder(fnt), order)
+			continue
+		}
+		assert.Equal(t, []string{"head", "hhea", "maxp", "OS/2", "hmtx"}, order[:5])
+		rank := map[string]int{}
+		for i, tag := range order {
+			rank[tag] = i
+		}
+		assert.True(t, rank["cmap"] < rank["loca"] && rank["loca"] < rank["glyf"] && rank["glyf"] < rank["name"] &&
+			rank["name"] < rank["post"], "%v", order)
+	}
+}
+
+func TestWriteKeepLayout(t *testing.T) {
+	fontPaths := []string{
+		"./testdata/FreeSans.ttf",
+		"./testdata/wts11.ttf",
+		"./testdata/roboto/Roboto-Regular.ttf",
+		"./testdata/roboto/Roboto-BoldItalic.ttf",
+	}
+	for _, fontPath := range fontPaths {
+		t.Run(fontPath, func(t *testing.T) {
+			original, err := ioutil.ReadFile(fontPath)
+			require.NoError(t, err)
+			fnt, err := ParseFile(fontPath)
+			require.NoError(t, err)
+
+			// Unmodified fonts are written as parsed.
+			var buf bytes.Buffer
+			require.NoError(t, fnt.WriteWithOptions(&buf, &WriteOptions{KeepLayout: true}))
+			require.Equal(t, original, buf.Bytes())
+
+			// Only the modified table is written anew.
+			fnt.SetNameRecord(1, "Keep Layout")
+			buf.Reset()
+			require.NoError(t, fnt.WriteWithOptions(&buf, &WriteOptions{KeepLayout: true}))
+			require.NoError(t, ValidateBytes(buf.Bytes()))
+			written, err := ParseBytes(buf.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, "Keep Layout", written.FamilyName())
+			assert.Equal(t, physicalTableOrder(fnt), physicalTableOrder(written))
+			for _, tr := range fnt.trec.list {
+				tag := tr.tableTag.String()
+				wtr := written.trec.trMap[tag]
+				require.NotNil(t, wtr, tag)
+				data := buf.Bytes()[wtr.offset : wtr.offset+offset32(wtr.length)]
+				switch tag {
+				case "name":
+					assert.NotEqual(t, original[tr.offset:tr.offset+offset32(tr.length)], data)
+				case "head":
+					assert.Equal(t, original[tr.offset:tr.offset+8], data[:8])
+					assert.Equal(t, original[tr.offset+12:tr.offset+offset32(tr.length)], data[12:])
+				default:
+					assert.Equal(t, original[tr.offset:tr.offset+offset32(tr.length)], data, tag)
+				}
+			}
+		})
+	}
+
+	// Fonts that were not parsed are written as without KeepLayout.
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	subfnt, err := fnt.SubsetFirst(30)
+	require.NoError(t, err)
+	expected, err := subfnt.Bytes()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, subfnt.WriteWithOptions(&buf, &WriteOptions{KeepLayout: true}))
+	assert.Equal(t, expected, buf.Bytes())
+}
+
+func TestParseLimits(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err := ParseBytes(data)
+	require.NoError(t, err)
+
+	// setTableLength returns a copy of `data` with the length of the table record of `tag` set to `length`.
+	setTableLength := func(tag string, length uint32) []byte {
+		for i, tr := range fnt.trec.list {
+			if tr.tableTag.String() == tag {
+				b := append([]byte(nil), data...)
+				binary.BigEndian.PutUint32(b[12+16*i+12:], length)
+				return b
+			}
+		}
+		t.Fatalf("table %s not found", tag)
+		return nil
+	}
+
+	t.Run("TableLength", func(t *testing.T) {
+		// Allocated 3.8 GB.
+		_, err := ParseBytes(setTableLength("GPOS", 0xE4000000))
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+		_, err = ParseBytes(setTableLength("name", 0xE4000000))
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+
+		// Below the limit but beyond the data.
+		_, err = ParseBytes(setTableLength("GPOS", 0x08000000))
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+		_, err = ParseBytes(setTableLength("post", 0x08000000))
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+
+		lfnt, err := ParseWithOptions(bytes.NewReader(setTableLength("GPOS", 0xE4000000)), ParseOptions{Lenient: true})
+		require.NoError(t, err)
+		assert.Nil(t, lfnt.gpos)
+		require.Len(t, lfnt.ParseWarnings(), 1)
+		assert.Equal(t, "GPOS", lfnt.ParseWarnings()[0].Tag)
+	})
+
+	t.Run("NumGlyphs", func(t *testing.T) {
+		// Number of glyphs beyond the loca table.
+		b := append([]byte(nil), data...)
+		binary.BigEndian.PutUint16(b[fnt.trec.trMap["maxp"].offset+4:], 0xFFFF)
+		_, err := ParseBytes(b)
+		assert.True(t, errors.Is(err, ErrInvalidOffset), "%v", err)
+
+		_, err = ParseWithOptions(bytes.NewReader(data), ParseOptions{MaxNumGlyphs: 1000})
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+		_, err = ParseWithOptions(bytes.NewReader(data), ParseOptions{MaxNumGlyphs: 3726})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		_, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{MaxTableSize: 100000})
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+		assert.EqualError(t, err, "glyf: limit exceeded: table size 354716 exceeds 100000")
+		_, err = ParseWithOptions(bytes.NewReader(data), ParseOptions{MaxCmapSegments: 10})
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+
+		var buf bytes.Buffer
+		require.NoError(t, fnt.WriteWOFF(&buf))
+		_, err = ParseWithOptions(bytes.NewReader(buf.Bytes()), ParseOptions{MaxTableSize: 100000})
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+		buf.Reset()
+		require.NoError(t, fnt.WriteWOFF2(&buf))
+		_, err = ParseWithOptions(bytes.NewReader(buf.Bytes()), ParseOptions{MaxTableSize: 100000})
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+	})
+}
@@ -0,0 +1,153 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Font file signatures as found in the first 4 bytes of the font data.
+const (
+	signatureTrueType   uint32 = 0x00010000 // TrueType outlines.
+	signatureApple      uint32 = 0x74727565 // 'true' - Apple TrueType.
+	signatureCFF        uint32 = 0x4F54544F // 'OTTO' - OpenType with CFF outlines.
+	signatureType1      uint32 = 0x74797031 // 'typ1' - PostScript Type 1 in an sfnt wrapper (unsupported).
+	signatureCollection uint32 = 0x74746366 // 'ttcf' - TrueType collection.
+	signatureWOFF       uint32 = 0x774F4646 // 'wOFF' - WOFF 1.0.
+	signatureWOFF2      uint32 = 0x774F4632 // 'wOF2' - WOFF 2.0.
+)
+
+// fontFormat represents the container format of font data.
+type fontFormat int
+
+const (
+	fontFormatUnknown fontFormat = iota
+	fontFormatTrueType
+	fontFormatCFF
+	fontFormatCollection
+	fontFormatWOFF
+	fontFormatWOFF2
+)
+
+func (ff fontFormat) String() string {
+	switch ff {
+	case fontFormatTrueType:
+		return "TrueType"
+	case fontFormatCFF:
+		return "OpenType/CFF"
+	case fontFormatCollection:
+		return "TrueType collection"
+	case fontFormatWOFF:
+		return "WOFF"
+	case fontFormatWOFF2:
+		return "WOFF2"
+	}
+	return "unknown"
+}
+
+// sniffFormat identifies the font format from the signature `sig` (first 4 bytes of the data).
+func sniffFormat(sig uint32) fontFormat {
+	switch sig {
+	case signatureTrueType, signatureApple:
+		return fontFormatTrueType
+	case signatureCFF:
+		return fontFormatCFF
+	case signatureCollection:
+		return fontFormatCollection
+	case signatureWOFF:
+		return fontFormatWOFF
+	case signatureWOFF2:
+		return fontFormatWOFF2
+	}
+	return fontFormatUnknown
+}
+
+// sniffReader identifies the font format of the data in `rs` and seeks back to the start of the data.
+func sniffReader(rs io.ReadSeeker) (fontFormat, uint32, error) {
+	b := make([]byte, 4)
+	_, err := io.ReadFull(rs, b)
+	if err != nil {
+		return fontFormatUnknown, 0, err
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return fontFormatUnknown, 0, err
+	}
+
+	sig := binary.BigEndian.Uint32(b)
+	return sniffFormat(sig), sig, nil
+}
+
+// ParseDataURI parses a font embedded in a data URI such as "data:font/ttf;base64,AAEAAA...",
+// as commonly found in CSS. Both base64 and percent-encoded data are supported. The font format
+// is identified from the signature of the decoded data.
+func ParseDataURI(uri string) (*Font, error) {
+	data, err := decodeDataURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(bytes.NewReader(data))
+}
+
+// decodeDataURI decodes the data contained in the data URI `uri`.
+func decodeDataURI(uri string) ([]byte, error) {
+	const scheme = "data:"
+	if len(uri) < len(scheme) || !strings.EqualFold(uri[:len(scheme)], scheme) {
+		return nil, errors.New("invalid data URI: missing data scheme")
+	}
+	uri = uri[len(scheme):]
+
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return nil, errors.New("invalid data URI: missing data separator")
+	}
+	mediaType, payload := uri[:comma], uri[comma+1:]
+
+	isBase64 := false
+	params := strings.Split(mediaType, ";")
+	if len(params) > 1 && strings.EqualFold(strings.TrimSpace(params[len(params)-1]), "base64") {
+		isBase64 = true
+	}
+
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URI: %v", err)
+		}
+		return []byte(data), nil
+	}
+
+	// Base64 data may be percent-encoded as well and contain whitespace when taken from stylesheets.
+	payload, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %v", err)
+	}
+	payload = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, payload)
+
+	enc := base64.StdEncoding
+	if strings.ContainsAny(payload, "-_") {
+		enc = base64.URLEncoding
+	}
+	data, err := enc.WithPadding(base64.NoPadding).DecodeString(strings.TrimRight(payload, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %v", err)
+	}
+	return data, nil
+}
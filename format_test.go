@@ -0,0 +1,115 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDataURI(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	b64 := base64.StdEncoding.EncodeToString(data)
+
+	testcases := []struct {
+		uri   string
+		valid bool
+	}{
+		{"data:font/ttf;base64," + b64, true},
+		{"DATA:application/x-font-ttf;charset=utf-8;base64," + b64, true},
+		{"data:;base64," + b64[:76] + "\n" + b64[76:], true},
+		{"data:font/ttf," + url.PathEscape(string(data)), true},
+		{"font/ttf;base64," + b64, false},
+		{"data:font/ttf;base64", false},
+		{"data:font/ttf;base64,!!!!", false},
+		{"data:font/woff;base64," + base64.StdEncoding.EncodeToString([]byte("wOFF0000")), false},
+	}
+
+	for i, tcase := range testcases {
+		fnt, err := ParseDataURI(tcase.uri)
+		if !tcase.valid {
+			assert.Error(t, err, "case %d", i)
+			continue
+		}
+		require.NoError(t, err, "case %d", i)
+		require.NotNil(t, fnt)
+		assert.Equal(t, 3726, int(fnt.maxp.numGlyphs))
+	}
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	testcases := []struct {
+		data   []byte
+		errStr string
+	}{
+		{[]byte("%PDF-1.7"), "unsupported font format: unknown signature 0x25504446"},
+	}
+
+	for _, tcase := range testcases {
+		_, err := Parse(bytes.NewReader(tcase.data))
+		require.Error(t, err)
+		assert.Equal(t, tcase.errStr, err.Error())
+	}
+}
+
+func TestParseSfntVersions(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err = fnt.SubsetFirst(20)
+	require.NoError(t, err)
+
+	// Apple TrueType fonts are parsed as TrueType and keep their version when written.
+	fnt.ot.sfntVersion = signatureApple
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, "true", string(data[:4]))
+	require.NoError(t, ValidateBytes(data))
+	apple, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, 20, int(apple.maxp.numGlyphs))
+	info, err := ParseMinimal(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 20, info.NumGlyphs)
+
+	// OpenType fonts with CFF outlines are parsed, but editing the outlines is not supported.
+	otto, err := ParseBytes(buildTestOTTO(t, []string{".notdef", "a", "b"}))
+	require.NoError(t, err)
+	_, err = otto.AddGlyph(nil, 500, 0)
+	assert.True(t, errors.Is(err, ErrCFFOutlinesUnsupported), "%v", err)
+	err = otto.ScaleUnitsPerEm(2048)
+	assert.True(t, errors.Is(err, ErrCFFOutlinesUnsupported), "%v", err)
+
+	testcases := []struct {
+		version uint32
+		tag     string
+		errStr  string
+	}{
+		{signatureType1, "typ1", "unsupported font format: PostScript Type 1 outlines (sfnt version 'typ1')"},
+		{0x00020000, "", "unsupported font format: unknown signature 0x00020000"},
+		{0x25504446, "%PDF", "unsupported font format: unknown signature 0x25504446"},
+	}
+	for _, tcase := range testcases {
+		bad := append([]byte(nil), data...)
+		binary.BigEndian.PutUint32(bad, tcase.version)
+		_, err := ParseBytes(bad)
+		var unsupported ErrUnsupportedSfntVersion
+		require.True(t, errors.As(err, &unsupported), "%v", err)
+		assert.Equal(t, ErrUnsupportedSfntVersion{Version: tcase.version, Tag: tcase.tag}, unsupported)
+		assert.EqualError(t, err, tcase.errStr)
+
+		_, err = ParseMinimal(bytes.NewReader(bad))
+		assert.True(t, errors.As(err, &unsupported), "%v", err)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// FuzzParse checks that parsing arbitrary data fails gracefully, without panics or excessive allocations.
+// Run with: go test -run XXX -fuzz FuzzParse -fuzzminimizetime 5x
+func FuzzParse(f *testing.F) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	subfnt, err := fnt.SubsetKeepRunes([]rune("Hé!fi"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	seed, err := subfnt.Bytes()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(seed)
+
+	// Crashers: table lengths beyond the data, which were allocated up front.
+	for i := range subfnt.trec.list {
+		b := append([]byte(nil), seed...)
+		binary.BigEndian.PutUint32(b[12+16*i+12:], 0xE4000000)
+		f.Add(b)
+	}
+
+	var buf bytes.Buffer
+	if err := subfnt.WriteWOFF(&buf); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fnt, err := ParseBytes(data)
+		if err != nil {
+			return
+		}
+		_, err = fnt.Bytes()
+		if err != nil {
+			return
+		}
+	})
+}
@@ -1,11 +1,10 @@
 module github.com/unidoc/unitype
 
 require (
-	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
+	github.com/andybalholm/brotli v1.0.6
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/sirupsen/logrus v1.5.0
 	github.com/stretchr/testify v1.4.0
-	golang.org/x/sys v0.0.0-20200413165638-669c56c373c4 // indirect
 	golang.org/x/text v0.3.2
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 )
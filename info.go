@@ -0,0 +1,155 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"fmt"
+	"io"
+)
+
+// FontInfo represents the metadata of a font as parsed by ParseMinimal, without the glyph data.
+type FontInfo struct {
+	FamilyName     string // name ID 1.
+	SubfamilyName  string // name ID 2.
+	FullName       string // name ID 4.
+	PostScriptName string // name ID 6.
+
+	UnitsPerEm  int
+	NumGlyphs   int
+	WeightClass int // usWeightClass of the OS/2 table, 0 if absent.
+	WidthClass  int // usWidthClass of the OS/2 table, 0 if absent.
+
+	// Ascent, Descent and LineGap are those of the hhea table, 0 if absent.
+	Ascent  int
+	Descent int
+	LineGap int
+
+	// Cmaps are the subtables of the cmap table.
+	Cmaps []CmapID
+	// NumRunes is the number of runes mapped by the preferred cmap subtable, see Font.GetBestCmap. Only set if
+	// requested by MinimalOptions.Cmap, 0 otherwise.
+	NumRunes int
+
+	Tables []string // tags of the tables in the order of the table directory.
+}
+
+// MinimalOptions represents options for ParseMinimalWithOptions.
+type MinimalOptions struct {
+	// Cmap parses the cmap subtables for FontInfo.NumRunes.
+	Cmap bool
+}
+
+// ParseMinimal parses the metadata of the font in `rs` for listing fonts, such as in a font picker, which is
+// much faster than Parse for large fonts. Only the offset table, the table records and the head, maxp, hhea,
+// name and OS/2 tables are parsed, as well as the encoding records of the cmap table. The glyph data and the
+// other tables are skipped. WOFF and WOFF2 fonts are decompressed in full.
+// ParseMinimal is ParseMinimalWithOptions with the default options.
+func ParseMinimal(rs io.ReadSeeker) (*FontInfo, error) {
+	return ParseMinimalWithOptions(rs, MinimalOptions{})
+}
+
+// ParseMinimalWithOptions parses the metadata of the font in `rs` as ParseMinimal with options `opts`.
+func ParseMinimalWithOptions(rs io.ReadSeeker, opts MinimalOptions) (*FontInfo, error) {
+	format, sig, err := sniffReader(rs)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case fontFormatTrueType, fontFormatCFF:
+	case fontFormatWOFF, fontFormatWOFF2:
+		fnt, err := ParseWithOptions(rs, ParseOptions{LazyGlyphs: true})
+		if err != nil {
+			return nil, err
+		}
+		return fnt.info(opts), nil
+	case fontFormatUnknown:
+		return nil, newUnsupportedSfntVersionError(sig)
+	default:
+		return nil, fmt.Errorf("unsupported font format: %s", format)
+	}
+
+	r := newByteReader(rs)
+	f := &font{}
+	f.ot, err = f.parseOffsetTable(r)
+	if err != nil {
+		return nil, wrapParseError("offset table", r.Offset(), err)
+	}
+	f.trec, err = f.parseTableRecords(r)
+	if err != nil {
+		return nil, wrapParseError("table records", r.Offset(), err)
+	}
+	f.head, err = f.parseHead(r)
+	if err != nil {
+		return nil, wrapParseError("head", r.Offset(), err)
+	}
+	f.maxp, err = f.parseMaxp(r)
+	if err != nil {
+		return nil, wrapParseError("maxp", r.Offset(), err)
+	}
+	f.hhea, err = f.parseHhea(r)
+	if err != nil {
+		return nil, wrapParseError("hhea", r.Offset(), err)
+	}
+	f.name, err = f.parseNameTable(r)
+	if err != nil {
+		return nil, wrapParseError("name", r.Offset(), err)
+	}
+	f.os2, err = f.parseOS2Table(r)
+	if err != nil {
+		return nil, wrapParseError("OS/2", r.Offset(), err)
+	}
+
+	if opts.Cmap {
+		f.cmap, err = f.parseCmap(r)
+		if err != nil {
+			return nil, wrapParseError("cmap", r.Offset(), err)
+		}
+		return (&Font{font: f}).info(opts), nil
+	}
+
+	info := (&Font{font: f}).info(opts)
+	info.Cmaps, err = f.parseCmapEncodings(r)
+	if err != nil {
+		return nil, wrapParseError("cmap", r.Offset(), err)
+	}
+	return info, nil
+}
+
+// info returns the metadata of `f`, with the number of runes mapped if requested by `opts`.
+func (f *Font) info(opts MinimalOptions) *FontInfo {
+	info := &FontInfo{
+		FamilyName:     f.FamilyName(),
+		SubfamilyName:  f.SubfamilyName(),
+		FullName:       f.FullName(),
+		PostScriptName: f.PostScriptName(),
+	}
+	info.UnitsPerEm, _ = f.UnitsPerEm()
+	info.NumGlyphs, _ = f.NumGlyphs()
+	if f.os2 != nil {
+		info.WeightClass, info.WidthClass = int(f.os2.usWeightClass), int(f.os2.usWidthClass)
+	}
+	if f.hhea != nil {
+		info.Ascent, info.Descent, info.LineGap = int(f.hhea.ascender), int(f.hhea.descender),
+			int(f.hhea.lineGap)
+	}
+	if f.cmap != nil {
+		for _, key := range f.cmap.subtableKeys {
+			subt := f.cmap.subtables[key]
+			info.Cmaps = append(info.Cmaps, CmapID{PlatformID: subt.platformID, EncodingID: subt.encodingID,
+				Format: subt.format})
+		}
+		if opts.Cmap {
+			cmap, _ := f.GetBestCmap()
+			info.NumRunes = len(cmap)
+		}
+	}
+	if f.trec != nil {
+		for _, tr := range f.trec.list {
+			info.Tables = append(info.Tables, tr.tableTag.String())
+		}
+	}
+	return info
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMinimal(t *testing.T) {
+	for _, path := range []string{"./testdata/FreeSans.ttf", "./testdata/roboto/Roboto-Bold.ttf"} {
+		t.Run(path, func(t *testing.T) {
+			data, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			fnt, err := ParseBytes(data)
+			require.NoError(t, err)
+
+			info, err := ParseMinimal(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, fnt.FamilyName(), info.FamilyName)
+			assert.Equal(t, fnt.SubfamilyName(), info.SubfamilyName)
+			assert.Equal(t, fnt.FullName(), info.FullName)
+			assert.Equal(t, fnt.PostScriptName(), info.PostScriptName)
+			assert.NotEmpty(t, info.FamilyName)
+			unitsPerEm, _ := fnt.UnitsPerEm()
+			assert.Equal(t, unitsPerEm, info.UnitsPerEm)
+			numGlyphs, _ := fnt.NumGlyphs()
+			assert.Equal(t, numGlyphs, info.NumGlyphs)
+			assert.Equal(t, int(fnt.os2.usWeightClass), info.WeightClass)
+			assert.Equal(t, int(fnt.os2.usWidthClass), info.WidthClass)
+			ascent, _ := fnt.Ascent()
+			assert.Equal(t, ascent, info.Ascent)
+			assert.Equal(t, fnt.TableTags(), info.Tables)
+			assert.Equal(t, 0, info.NumRunes)
+			require.NotEmpty(t, info.Cmaps)
+
+			// The subtables are parsed on request.
+			full, err := ParseMinimalWithOptions(bytes.NewReader(data), MinimalOptions{Cmap: true})
+			require.NoError(t, err)
+			best, _ := fnt.GetBestCmap()
+			assert.Equal(t, len(best), full.NumRunes)
+			assert.Equal(t, info.Cmaps, full.Cmaps)
+
+			// WOFF fonts are decompressed.
+			var buf bytes.Buffer
+			require.NoError(t, fnt.WriteWOFF(&buf))
+			woffInfo, err := ParseMinimal(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, info.FamilyName, woffInfo.FamilyName)
+			assert.Equal(t, info.NumGlyphs, woffInfo.NumGlyphs)
+		})
+	}
+
+	_, err := ParseMinimal(bytes.NewReader([]byte("nofont")))
+	assert.Error(t, err)
+}
+
+func BenchmarkParseMinimal(b *testing.B) {
+	data, err := ioutil.ReadFile("./testdata/wts11.ttf")
+	require.NoError(b, err)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := ParseMinimal(bytes.NewReader(data))
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	data, err := ioutil.ReadFile("./testdata/wts11.ttf")
+	require.NoError(b, err)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := Parse(bytes.NewReader(data))
+		require.NoError(b, err)
+	}
+}
@@ -0,0 +1,274 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// DumpOptions selects the sections included by Font.MarshalInspectionJSON.
+type DumpOptions struct {
+	// ExcludeGlyf omits the per-glyph summaries of the glyf table.
+	ExcludeGlyf bool
+	// ExcludeCmap omits the mappings of the cmap subtables.
+	ExcludeCmap bool
+}
+
+// MarshalInspectionJSON writes a JSON dump of the internals of `f` to `w` for inspection, similar to the TTX
+// output of fonttools. The dump contains the offset table, the table records, the fields of the head, hhea,
+// maxp and OS/2 tables, the hmtx metrics, the loca offsets, a summary of each glyph of the glyf table and the
+// mappings of the cmap subtables. The table fields are named as in the OpenType specification.
+// Sections of missing tables are omitted. The format of the dump is meant for humans and tools inspecting
+// fonts and may change between versions.
+func (f *Font) MarshalInspectionJSON(w io.Writer, opts DumpOptions) error {
+	dump := inspectFont{
+		OffsetTable: inspectFields(f.ot),
+		Head:        inspectFields(f.head),
+		Hhea:        inspectFields(f.hhea),
+		Maxp:        inspectFields(f.maxp),
+		OS2:         inspectFields(f.os2),
+	}
+	if f.trec != nil {
+		dump.TableRecords = []inspectTableRecord{}
+		for _, tr := range f.trec.list {
+			dump.TableRecords = append(dump.TableRecords, inspectTableRecord{
+				Tag:      tr.tableTag.String(),
+				Checksum: tr.checksum,
+				Offset:   uint32(tr.offset),
+				Length:   tr.length,
+			})
+		}
+	}
+	if f.hmtx != nil {
+		dump.Hmtx = &inspectHmtx{
+			HMetrics:         []inspectHMetric{},
+			LeftSideBearings: append([]int16{}, f.hmtx.leftSideBearings...),
+		}
+		for _, m := range f.hmtx.hMetrics {
+			dump.Hmtx.HMetrics = append(dump.Hmtx.HMetrics, inspectHMetric{AdvanceWidth: m.advanceWidth, LSB: m.lsb})
+		}
+	}
+	if f.loca != nil && f.head != nil {
+		dump.Loca = f.locaOffsets()
+	}
+	if f.glyf != nil && !opts.ExcludeGlyf {
+		dump.Glyf = []inspectGlyph{}
+		for gid, gd := range f.glyf.descs {
+			dump.Glyf = append(dump.Glyf, inspectGlyphDescription(GlyphIndex(gid), gd))
+		}
+	}
+	if f.cmap != nil && !opts.ExcludeCmap {
+		dump.Cmap = []inspectCmapSubtable{}
+		for _, key := range f.cmap.subtableKeys {
+			dump.Cmap = append(dump.Cmap, inspectCmap(f.cmap.subtables[key]))
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// inspectFont is the JSON dump of a font written by MarshalInspectionJSON.
+type inspectFont struct {
+	OffsetTable  inspectObject         `json:"offsetTable,omitempty"`
+	TableRecords []inspectTableRecord  `json:"tableRecords,omitempty"`
+	Head         inspectObject         `json:"head,omitempty"`
+	Hhea         inspectObject         `json:"hhea,omitempty"`
+	Maxp         inspectObject         `json:"maxp,omitempty"`
+	OS2          inspectObject         `json:"OS/2,omitempty"`
+	Hmtx         *inspectHmtx          `json:"hmtx,omitempty"`
+	Loca         []int64               `json:"loca,omitempty"`
+	Glyf         []inspectGlyph        `json:"glyf,omitempty"`
+	Cmap         []inspectCmapSubtable `json:"cmap,omitempty"`
+}
+
+type inspectTableRecord struct {
+	Tag      string `json:"tag"`
+	Checksum uint32 `json:"checksum"`
+	Offset   uint32 `json:"offset"`
+	Length   uint32 `json:"length"`
+}
+
+type inspectHmtx struct {
+	HMetrics         []inspectHMetric `json:"hMetrics"`
+	LeftSideBearings []int16          `json:"leftSideBearings"`
+}
+
+type inspectHMetric struct {
+	AdvanceWidth uint16 `json:"advanceWidth"`
+	LSB          int16  `json:"lsb"`
+}
+
+// inspectGlyph is the summary of a glyph description. Empty glyphs have no header.
+type inspectGlyph struct {
+	GID              GlyphIndex         `json:"gid"`
+	Length           int                `json:"length"`
+	NumberOfContours *int16             `json:"numberOfContours,omitempty"`
+	XMin             int16              `json:"xMin,omitempty"`
+	YMin             int16              `json:"yMin,omitempty"`
+	XMax             int16              `json:"xMax,omitempty"`
+	YMax             int16              `json:"yMax,omitempty"`
+	Components       []inspectComponent `json:"components,omitempty"`
+	Error            string             `json:"error,omitempty"`
+}
+
+type inspectComponent struct {
+	GlyphIndex uint16 `json:"glyphIndex"`
+	Flags      uint16 `json:"flags"`
+}
+
+// inspectCmapSubtable is the dump of a cmap subtable with its mappings as [charcode, glyph index] pairs sorted
+// by charcode.
+type inspectCmapSubtable struct {
+	PlatformID int         `json:"platformID"`
+	EncodingID int         `json:"encodingID"`
+	Format     int         `json:"format"`
+	Mappings   [][2]uint32 `json:"mappings"`
+}
+
+// inspectGlyphDescription returns the summary of glyph `gid` with description `gd`. The description is
+// parsed from a copy of the data so that inspecting does not modify the font. Errors parsing the description
+// are reported in the summary, as broken glyphs are what inspection is often used to find.
+func inspectGlyphDescription(gid GlyphIndex, gd *glyphDescription) inspectGlyph {
+	summary := inspectGlyph{GID: gid}
+	if gd.size() == 0 {
+		return summary
+	}
+	summary.Length = gd.size()
+	err := gd.load()
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	desc := &glyphDescription{raw: gd.raw}
+	err = desc.parse()
+	if desc.header != nil {
+		h := desc.header
+		numberOfContours := h.numberOfContours
+		summary.NumberOfContours = &numberOfContours
+		summary.XMin, summary.YMin, summary.XMax, summary.YMax = h.xMin, h.yMin, h.xMax, h.yMax
+	}
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	if desc.composite != nil {
+		summary.Components = []inspectComponent{}
+		for _, comp := range desc.composite.components {
+			summary.Components = append(summary.Components, inspectComponent{GlyphIndex: comp.glyphIndex, Flags: comp.flags})
+		}
+	}
+	return summary
+}
+
+// inspectCmap returns the dump of cmap subtable `subt`.
+func inspectCmap(subt *cmapSubtable) inspectCmapSubtable {
+	dump := inspectCmapSubtable{
+		PlatformID: subt.platformID,
+		EncodingID: subt.encodingID,
+		Format:     subt.format,
+		Mappings:   [][2]uint32{},
+	}
+	for cc, gid := range subt.charcodeToGID {
+		dump.Mappings = append(dump.Mappings, [2]uint32{uint32(cc), uint32(gid)})
+	}
+	sort.Slice(dump.Mappings, func(i, j int) bool {
+		return dump.Mappings[i][0] < dump.Mappings[j][0]
+	})
+	return dump
+}
+
+// inspectObject is a JSON object with its fields in order.
+type inspectObject []inspectField
+
+type inspectField struct {
+	name  string
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o inspectObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var (
+	fixedType = reflect.TypeOf(fixed(0))
+	tagType   = reflect.TypeOf(tag{})
+)
+
+// inspectFields returns the fields of table `t`, a pointer to a table struct, named as in the struct. Fixed
+// values are given as numbers with fractions and tags as strings. Returns nil if `t` is a nil pointer.
+func inspectFields(t interface{}) inspectObject {
+	v := reflect.ValueOf(t)
+	if v.IsNil() {
+		return nil
+	}
+	v = v.Elem()
+
+	var obj inspectObject
+	for i := 0; i < v.NumField(); i++ {
+		obj = append(obj, inspectField{name: v.Type().Field(i).Name, value: inspectValue(v.Field(i))})
+	}
+	return obj
+}
+
+// inspectValue returns the value of field `v` for the JSON dump. The fields are unexported, so their values are
+// read by kind rather than with Interface.
+func inspectValue(v reflect.Value) interface{} {
+	switch {
+	case v.Type() == fixedType:
+		return fixed(v.Int()).Float64()
+	case v.Type() == tagType:
+		var t tag
+		for i := range t {
+			t[i] = uint8(v.Index(i).Uint())
+		}
+		return string(t[:])
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Array:
+		values := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, inspectValue(v.Index(i)))
+		}
+		return values
+	}
+	return nil
+}
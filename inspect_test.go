@@ -0,0 +1,134 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalInspectionJSON(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = fnt.MarshalInspectionJSON(&buf, DumpOptions{})
+	require.NoError(t, err)
+
+	var dump struct {
+		OffsetTable  map[string]interface{} `json:"offsetTable"`
+		TableRecords []struct {
+			Tag    string `json:"tag"`
+			Offset uint32 `json:"offset"`
+			Length uint32 `json:"length"`
+		} `json:"tableRecords"`
+		Head map[string]interface{} `json:"head"`
+		Maxp map[string]interface{} `json:"maxp"`
+		OS2  map[string]interface{} `json:"OS/2"`
+		Hmtx struct {
+			HMetrics []struct {
+				AdvanceWidth uint16 `json:"advanceWidth"`
+				LSB          int16  `json:"lsb"`
+			} `json:"hMetrics"`
+		} `json:"hmtx"`
+		Loca []int64 `json:"loca"`
+		Glyf []struct {
+			GID              int    `json:"gid"`
+			Length           int    `json:"length"`
+			NumberOfContours *int16 `json:"numberOfContours"`
+			Components       []struct {
+				GlyphIndex uint16 `json:"glyphIndex"`
+			} `json:"components"`
+		} `json:"glyf"`
+		Cmap []struct {
+			PlatformID int         `json:"platformID"`
+			EncodingID int         `json:"encodingID"`
+			Format     int         `json:"format"`
+			Mappings   [][2]uint32 `json:"mappings"`
+		} `json:"cmap"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &dump))
+
+	assert.EqualValues(t, len(fnt.trec.list), dump.OffsetTable["numTables"])
+	require.Len(t, dump.TableRecords, len(fnt.trec.list))
+	for i, tr := range fnt.trec.list {
+		assert.Equal(t, tr.tableTag.String(), dump.TableRecords[i].Tag)
+		assert.Equal(t, uint32(tr.offset), dump.TableRecords[i].Offset)
+		assert.Equal(t, tr.length, dump.TableRecords[i].Length)
+	}
+	assert.EqualValues(t, 1000, dump.Head["unitsPerEm"])
+	assert.EqualValues(t, 1, dump.Maxp["version"])
+	assert.EqualValues(t, 3726, dump.Maxp["numGlyphs"])
+	assert.Len(t, dump.OS2["panose10"], 10)
+	assert.IsType(t, "", dump.OS2["achVendID"])
+
+	require.Len(t, dump.Hmtx.HMetrics, len(fnt.hmtx.hMetrics))
+	gid, has := fnt.LookupRune('A')
+	require.True(t, has)
+	advance, err := fnt.GlyphAdvance(gid)
+	require.NoError(t, err)
+	assert.Equal(t, advance, dump.Hmtx.HMetrics[gid].AdvanceWidth)
+	assert.Equal(t, fnt.locaOffsets(), dump.Loca)
+
+	require.Len(t, dump.Glyf, 3726)
+	glyph := dump.Glyf[gid]
+	assert.Equal(t, int(gid), glyph.GID)
+	assert.Equal(t, int(dump.Loca[gid+1]-dump.Loca[gid]), glyph.Length)
+	require.NotNil(t, glyph.NumberOfContours)
+	assert.True(t, *glyph.NumberOfContours > 0)
+	assert.Empty(t, glyph.Components)
+
+	// Composite glyphs list their components.
+	gid, has = fnt.LookupRune('Å')
+	require.True(t, has)
+	glyph = dump.Glyf[gid]
+	require.NotNil(t, glyph.NumberOfContours)
+	assert.Equal(t, int16(-1), *glyph.NumberOfContours)
+	assert.NotEmpty(t, glyph.Components)
+
+	// Empty glyphs.
+	gid, has = fnt.LookupRune(' ')
+	require.True(t, has)
+	assert.Zero(t, dump.Glyf[gid].Length)
+	assert.Nil(t, dump.Glyf[gid].NumberOfContours)
+
+	require.Len(t, dump.Cmap, len(fnt.cmap.subtableKeys))
+	found := false
+	for _, subt := range dump.Cmap {
+		if subt.PlatformID != 3 || subt.EncodingID != 1 {
+			continue
+		}
+		found = true
+		assert.Equal(t, 4, subt.Format)
+		gidA, _ := fnt.LookupRune('A')
+		assert.Contains(t, subt.Mappings, [2]uint32{'A', uint32(gidA)})
+	}
+	assert.True(t, found)
+
+	// Excluding the bulky sections.
+	buf.Reset()
+	err = fnt.MarshalInspectionJSON(&buf, DumpOptions{ExcludeGlyf: true, ExcludeCmap: true})
+	require.NoError(t, err)
+	var sections map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &sections))
+	assert.NotContains(t, sections, "glyf")
+	assert.NotContains(t, sections, "cmap")
+	assert.Contains(t, sections, "loca")
+	assert.Contains(t, sections, "hmtx")
+
+	// Field order follows the table.
+	assert.Regexp(t, `^\{"majorVersion":1,"minorVersion":0,"fontRevision":`, string(mustCompact(t, sections["head"])))
+}
+
+func mustCompact(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, json.Compact(&buf, data))
+	return buf.Bytes()
+}
@@ -0,0 +1,746 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// variationTables are the tables dropped from static instances of variable fonts.
+var variationTables = map[string]bool{
+	"fvar": true,
+	"avar": true,
+	"gvar": true,
+	"cvar": true,
+	"HVAR": true,
+	"VVAR": true,
+	"MVAR": true,
+	"STAT": true,
+}
+
+// Instance returns a static instance of the variable font `f` with the variation axes pinned to the
+// user-space coordinates `coords` by axis tag, e.g. {"wght": 500}. Axes that are not specified are pinned to
+// their default values and values out of the axis range are clamped.
+//
+// The glyph variations (gvar) are applied to the outlines and the side bearings are computed from the varied
+// phantom points, as with fontTools' varLib.instancer. The advances are varied by the metrics variations
+// (HVAR and VVAR) where present, otherwise they are computed from the phantom points as well. The metrics
+// variations (MVAR) are applied to the font-wide metrics and the control value variations (cvar) to the cvt table. The
+// usWeightClass and usWidthClass of the OS/2 table and the italic angle of the post table are set from the
+// wght, wdth and slnt axes. The names are updated for the instance: the subfamily name of the matching named
+// instance is used where there is one, otherwise the subfamily name is derived from the axis values.
+// The variation tables are dropped; the OpenType layout tables (GDEF, GPOS and GSUB) are kept as is, so
+// their variations are not applied.
+//
+// Only fonts with TrueType outlines (glyf) are supported. An error is returned if `f` is not a variable
+// font, if an axis tag is unknown or if the variation data is invalid.
+func (f *Font) Instance(coords map[string]float64) (*Font, error) {
+	if f.fvar == nil {
+		logger.Debugf("Instance requires a variable font (fvar)")
+		return nil, ErrRequiredTableMissing{Tag: "fvar"}
+	}
+	for _, t := range []struct {
+		tag     string
+		missing bool
+	}{
+		{"glyf", f.glyf == nil},
+		{"maxp", f.maxp == nil},
+		{"head", f.head == nil},
+		{"hhea", f.hhea == nil},
+		{"hmtx", f.hmtx == nil},
+	} {
+		if t.missing {
+			logger.Debugf("Instance requires the %s table", t.tag)
+			return nil, ErrRequiredTableMissing{Tag: t.tag}
+		}
+	}
+
+	user, err := f.fvar.userCoords(coords)
+	if err != nil {
+		return nil, err
+	}
+	norm := f.fvar.normalize(user, f.avar)
+
+	newfnt := *f.font.clone()
+
+	err = f.font.instanceGlyphs(&newfnt, norm)
+	if err != nil {
+		return nil, err
+	}
+	err = f.font.instanceCvt(&newfnt, norm)
+	if err != nil {
+		return nil, err
+	}
+	if data := f.font.rawTableData("MVAR"); data != nil {
+		mvar, err := parseMvarData(data)
+		if err != nil {
+			logger.Debugf("Error parsing MVAR table: %v", err)
+			return nil, err
+		}
+		newfnt.applyMetricsDeltas(mvar.deltas(norm))
+	}
+	newfnt.setStyleClasses(f.fvar, user)
+
+	newfnt.rawTables = nil
+	for _, t := range f.font.rawTables {
+		if !variationTables[t.tableTag.String()] {
+			newfnt.rawTables = append(newfnt.rawTables, t)
+		}
+	}
+	newfnt.fvar = nil
+	newfnt.avar = nil
+	newfnt.gvar = nil
+
+	if newfnt.name != nil {
+		newfnt.updateInstanceNames(f.fvar, user)
+	}
+
+	err = newfnt.updateLocaFormat()
+	if err != nil {
+		return nil, err
+	}
+	newfnt.updateHeadBBox()
+	newfnt.recomputeMaxp()
+	newfnt.recomputeHhea()
+	newfnt.optimizeHmtx()
+	newfnt.optimizeVmtx()
+	newfnt.updateAvgCharWidth()
+
+	return &Font{font: &newfnt}, nil
+}
+
+// otRound rounds `v` to the nearest integer, rounding halves up as the OpenType font tools do.
+func otRound(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
+
+// quantizeF2Dot14 rounds `v` to the precision of the F2DOT14 format.
+func quantizeF2Dot14(v float64) float64 {
+	return float64(otRound(v*16384)) / 16384
+}
+
+// userCoords returns the user-space coordinate per axis of `t` for the coordinates `coords` by axis tag,
+// clamped to the axis ranges. Axes not in `coords` get their default values.
+func (t *fvarTable) userCoords(coords map[string]float64) ([]float64, error) {
+	for axisTag := range coords {
+		found := false
+		for _, axis := range t.axes {
+			if axis.axisTag.String() == axisTag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown variation axis: %q", axisTag)
+		}
+	}
+
+	user := make([]float64, len(t.axes))
+	for i, axis := range t.axes {
+		v, has := coords[axis.axisTag.String()]
+		if !has {
+			v = axis.defaultValue
+		}
+		user[i] = math.Max(axis.minValue, math.Min(axis.maxValue, v))
+	}
+	return user, nil
+}
+
+// normalize returns the normalized coordinates in the range [-1,1] for the user-space coordinates `user`
+// per axis of `t`, mapped through the segment maps of `avar` if not nil.
+func (t *fvarTable) normalize(user []float64, avar *avarTable) []float64 {
+	norm := make([]float64, len(t.axes))
+	for i, axis := range t.axes {
+		v := user[i]
+		switch {
+		case v < axis.defaultValue && axis.defaultValue > axis.minValue:
+			v = (v - axis.defaultValue) / (axis.defaultValue - axis.minValue)
+		case v > axis.defaultValue && axis.maxValue > axis.defaultValue:
+			v = (v - axis.defaultValue) / (axis.maxValue - axis.defaultValue)
+		default:
+			v = 0
+		}
+		v = quantizeF2Dot14(v)
+		if avar != nil {
+			v = quantizeF2Dot14(avar.mapCoord(i, v))
+		}
+		norm[i] = v
+	}
+	return norm
+}
+
+// pointF is a point of a glyph outline with fractional coordinates.
+type pointF struct {
+	x, y float64
+}
+
+// instanceGlyphs applies the glyph variations of `f` at the normalized coordinates `coords` to the
+// glyphs, setting the glyf, hmtx and vmtx tables of `newf`.
+func (f *font) instanceGlyphs(newf *font, coords []float64) error {
+	err := f.glyf.loadAll()
+	if err != nil {
+		return err
+	}
+	numGlyphs := len(f.glyf.descs)
+	newf.glyf = &glyfTable{
+		descs: make([]*glyphDescription, numGlyphs),
+	}
+	newf.hmtx = &hmtxTable{
+		hMetrics: make([]longHorMetric, numGlyphs),
+	}
+	newf.hhea.numberOfHMetrics = uint16(numGlyphs)
+	hasVertical := f.vhea != nil && f.vmtx != nil
+	if hasVertical {
+		newf.vmtx = &vmtxTable{
+			vMetrics: make([]longVerMetric, numGlyphs),
+		}
+		newf.vhea.numOfLongVerMetrics = uint16(numGlyphs)
+	}
+
+	hvar, err := f.parseHvar("HVAR")
+	if err != nil {
+		return err
+	}
+	vvar, err := f.parseHvar("VVAR")
+	if err != nil {
+		return err
+	}
+
+	// The left side bearings and top side bearings of composite glyphs are computed once the bounds of
+	// all components are known.
+	leftX := make([]float64, numGlyphs)
+	topY := make([]float64, numGlyphs)
+	var composites []GlyphIndex
+
+	for i, gd := range f.glyf.descs {
+		gid := GlyphIndex(i)
+		var h glyphHeader
+		var simple *simpleGlyph
+		var composite *compositeGlyph
+		var points []pointF
+		var endPts []int
+		if len(gd.raw) > 0 {
+			err := gd.parse()
+			if err != nil {
+				logger.Debugf("Error parsing glyph %d: %v", gid, err)
+				return err
+			}
+			h = *gd.header
+		}
+		switch {
+		case h.numberOfContours > 0:
+			var err error
+			simple, err = decodeSimpleGlyph(gd.raw)
+			if err != nil {
+				logger.Debugf("Error decoding glyph %d: %v", gid, err)
+				return err
+			}
+			for _, p := range simple.points {
+				points = append(points, pointF{x: float64(p.x), y: float64(p.y)})
+			}
+			for _, end := range simple.endPts {
+				endPts = append(endPts, int(end))
+			}
+		case h.numberOfContours < 0 && gd.composite != nil:
+			composite = &compositeGlyph{
+				components:   append([]compositeComponent(nil), gd.composite.components...),
+				instructions: gd.composite.instructions,
+			}
+			for j, comp := range composite.components {
+				dx, dy, _ := comp.offset()
+				points = append(points, pointF{x: dx, y: dy})
+				endPts = append(endPts, j)
+			}
+		default:
+			// Empty glyphs have a zero bounding box.
+			h = glyphHeader{}
+		}
+
+		// Phantom points: the horizontal origin and advance and the vertical origin and advance.
+		lhm := f.hmtx.getMetric(gid)
+		left := float64(h.xMin) - float64(lhm.lsb)
+		phantom := []pointF{{x: left}, {x: left + float64(lhm.advanceWidth)}, {}, {}}
+		var lvm longVerMetric
+		if hasVertical {
+			lvm = f.vmtx.getMetric(gid)
+			top := float64(h.yMax) + float64(lvm.tsb)
+			phantom[2].y, phantom[3].y = top, top-float64(lvm.advanceHeight)
+		}
+		points = append(points, phantom...)
+		for j := 0; j < 4; j++ {
+			endPts = append(endPts, len(points)-4+j)
+		}
+
+		varied := false
+		if f.gvar != nil && int(gid) < len(f.gvar.glyphData) {
+			variations, err := f.gvar.glyphVariations(gid, len(points))
+			if err != nil {
+				logger.Debugf("Error decoding variations of glyph %d: %v", gid, err)
+				return err
+			}
+			deltas := make([]pointF, len(points))
+			for _, tv := range variations {
+				scalar := regionScalar(tv.region(), coords)
+				if scalar == 0 {
+					continue
+				}
+				for j, d := range tv.deltas(points, endPts) {
+					deltas[j].x += scalar * d.x
+					deltas[j].y += scalar * d.y
+				}
+				varied = true
+			}
+			for j := range points {
+				points[j].x += deltas[j].x
+				points[j].y += deltas[j].y
+			}
+		}
+
+		phantom = points[len(points)-4:]
+		points = points[:len(points)-4]
+		advance := otRound(phantom[1].x - phantom[0].x)
+		if hvar != nil {
+			advance = otRound(float64(lhm.advanceWidth) + hvar.advanceDelta(gid, coords))
+		}
+		if advance < 0 {
+			advance = 0
+		}
+		newf.hmtx.hMetrics[i].advanceWidth = uint16(advance)
+		leftX[i] = phantom[0].x
+		if hasVertical {
+			advance := otRound(phantom[2].y - phantom[3].y)
+			if vvar != nil {
+				advance = otRound(float64(lvm.advanceHeight) + vvar.advanceDelta(gid, coords))
+			}
+			if advance < 0 {
+				advance = 0
+			}
+			newf.vmtx.vMetrics[i].advanceHeight = uint16(advance)
+			topY[i] = phantom[2].y
+		}
+
+		raw := gd.raw
+		switch {
+		case simple != nil:
+			if varied {
+				for j := range simple.points {
+					simple.points[j].x = otRound(points[j].x)
+					simple.points[j].y = otRound(points[j].y)
+				}
+				simple.header.xMin, simple.header.yMin, simple.header.xMax, simple.header.yMax = simple.bounds()
+				h = simple.header
+			}
+			simple.overlap = true
+			raw = simple.encode()
+		case composite != nil:
+			for j := range composite.components {
+				comp := &composite.components[j]
+				if compositeGlyphFlag(comp.flags).IsSet(argsAreXYValues) {
+					comp.argument1 = uint16(int16(otRound(points[j].x)))
+					comp.argument2 = uint16(int16(otRound(points[j].y)))
+				}
+			}
+			composite.components[0].flags |= uint16(overlapCompound)
+			raw = composite.encode(h)
+			composites = append(composites, gid)
+		}
+		newf.glyf.descs[i] = &glyphDescription{raw: raw}
+		newf.hmtx.hMetrics[i].lsb = int16(otRound(float64(h.xMin) - leftX[i]))
+		if hasVertical {
+			newf.vmtx.vMetrics[i].tsb = int16(otRound(topY[i] - float64(h.yMax)))
+		}
+	}
+
+	for _, gid := range composites {
+		b, has, err := newf.glyf.bounds(gid, 0)
+		if err != nil {
+			return err
+		}
+		if !has {
+			continue
+		}
+		xMin, yMin, xMax, yMax := b.rounded()
+		// The data may be that of `f`.
+		raw := append([]byte(nil), newf.glyf.descs[gid].raw...)
+		for j, v := range []int16{xMin, yMin, xMax, yMax} {
+			binary.BigEndian.PutUint16(raw[2+2*j:], uint16(v))
+		}
+		newf.glyf.descs[gid] = &glyphDescription{raw: raw}
+		newf.hmtx.hMetrics[gid].lsb = int16(otRound(float64(xMin) - leftX[gid]))
+		if hasVertical {
+			newf.vmtx.vMetrics[gid].tsb = int16(otRound(topY[gid] - float64(yMax)))
+		}
+	}
+	return nil
+}
+
+// deltas returns the deltas of `tv` for all `points` of a glyph with contours ending at `endPts`. The
+// deltas of points that are not referenced explicitly are inferred by interpolation (IUP) within each
+// contour.
+func (tv *tupleVariation) deltas(points []pointF, endPts []int) []pointF {
+	deltas := make([]pointF, len(points))
+	if tv.points == nil {
+		for i := range deltas {
+			if i < len(tv.deltasX) && i < len(tv.deltasY) {
+				deltas[i] = pointF{x: float64(tv.deltasX[i]), y: float64(tv.deltasY[i])}
+			}
+		}
+		return deltas
+	}
+
+	touched := make([]bool, len(points))
+	for i, p := range tv.points {
+		if int(p) < len(points) && i < len(tv.deltasX) && i < len(tv.deltasY) {
+			touched[p] = true
+			deltas[p] = pointF{x: float64(tv.deltasX[i]), y: float64(tv.deltasY[i])}
+		}
+	}
+	start := 0
+	for _, end := range endPts {
+		if end < start || end >= len(points) {
+			continue
+		}
+		interpolateContour(points[start:end+1], touched[start:end+1], deltas[start:end+1])
+		start = end + 1
+	}
+	return deltas
+}
+
+// interpolateContour infers the deltas of the points of a contour that are not `touched` from the nearest
+// touched points before and after them along the contour, as specified for glyph variations: coordinates
+// between those of the reference points are interpolated, others get the delta of the nearest reference
+// point.
+func interpolateContour(points []pointF, touched []bool, deltas []pointF) {
+	var refs []int
+	for i, t := range touched {
+		if t {
+			refs = append(refs, i)
+		}
+	}
+	switch len(refs) {
+	case 0:
+		return
+	case 1:
+		for i := range deltas {
+			deltas[i] = deltas[refs[0]]
+		}
+		return
+	}
+
+	n := len(points)
+	for k, r1 := range refs {
+		r2 := refs[(k+1)%len(refs)]
+		for i := (r1 + 1) % n; i != r2; i = (i + 1) % n {
+			deltas[i].x = interpolateDelta(points[i].x, points[r1].x, points[r2].x, deltas[r1].x, deltas[r2].x)
+			deltas[i].y = interpolateDelta(points[i].y, points[r1].y, points[r2].y, deltas[r1].y, deltas[r2].y)
+		}
+	}
+}
+
+// interpolateDelta returns the delta of coordinate `v` given the coordinates `v1` and `v2` of the reference
+// points with deltas `d1` and `d2`.
+func interpolateDelta(v, v1, v2, d1, d2 float64) float64 {
+	if v1 == v2 {
+		if d1 == d2 {
+			return d1
+		}
+		return 0
+	}
+	if v1 > v2 {
+		v1, v2, d1, d2 = v2, v1, d2, d1
+	}
+	switch {
+	case v <= v1:
+		return d1
+	case v >= v2:
+		return d2
+	}
+	return d1 + (v-v1)*(d2-d1)/(v2-v1)
+}
+
+// instanceCvt applies the cvar variations of `f` at the normalized coordinates `coords` to the control
+// values, setting the cvt table of `newf`.
+func (f *font) instanceCvt(newf *font, coords []float64) error {
+	data := f.rawTableData("cvar")
+	if f.cvt == nil || data == nil {
+		return nil
+	}
+	values := f.cvt.controlValues
+	variations, err := parseCvarData(data, len(f.fvar.axes), len(values))
+	if err != nil {
+		logger.Debugf("Error parsing cvar table: %v", err)
+		return err
+	}
+
+	deltas := make([]float64, len(values))
+	for _, tv := range variations {
+		scalar := regionScalar(tv.region(), coords)
+		if scalar == 0 {
+			continue
+		}
+		for i, d := range tv.deltasX {
+			j := i
+			if tv.points != nil {
+				j = int(tv.points[i])
+			}
+			if j < len(deltas) {
+				deltas[j] += scalar * float64(d)
+			}
+		}
+	}
+
+	newf.cvt = &cvtTable{
+		controlValues: make([]int16, len(values)),
+	}
+	for i, v := range values {
+		newf.cvt.controlValues[i] = int16(int(v) + otRound(deltas[i]))
+	}
+	return nil
+}
+
+// applyMetricsDeltas adds the MVAR `deltas` by value tag to the corresponding font-wide metrics of `f`.
+func (f *font) applyMetricsDeltas(deltas map[string]int) {
+	addInt16 := func(v *int16, valueTag string) {
+		*v = int16(int(*v) + deltas[valueTag])
+	}
+	addUint16 := func(v *uint16, valueTag string) {
+		*v = uint16(int(*v) + deltas[valueTag])
+	}
+
+	if t := f.os2; t != nil {
+		addInt16(&t.sTypoAscender, "hasc")
+		addInt16(&t.sTypoDescender, "hdsc")
+		addInt16(&t.sTypoLineGap, "hlgp")
+		addUint16(&t.usWinAscent, "hcla")
+		addUint16(&t.usWinDescent, "hcld")
+		addInt16(&t.sxHeight, "xhgt")
+		addInt16(&t.sCapHeight, "cpht")
+		addInt16(&t.ySubscriptXSize, "sbxs")
+		addInt16(&t.ySubscriptYSize, "sbys")
+		addInt16(&t.ySubscriptXOffset, "sbxo")
+		addInt16(&t.ySubscriptYOffset, "sbyo")
+		addInt16(&t.ySuperscriptXSize, "spxs")
+		addInt16(&t.ySuperscriptYSize, "spys")
+		addInt16(&t.ySuperscriptXOffset, "spxo")
+		addInt16(&t.ySuperscriptYOffset, "spyo")
+		addInt16(&t.yStrikeoutSize, "strs")
+		addInt16(&t.yStrikeoutPosition, "stro")
+	}
+	if t := f.hhea; t != nil {
+		addInt16(&t.caretSlopeRise, "hcrs")
+		addInt16(&t.caretSlopeRun, "hcrn")
+		addInt16(&t.caretOffset, "hcof")
+	}
+	if t := f.vhea; t != nil {
+		addInt16((*int16)(&t.vertTypoAscender), "vasc")
+		addInt16((*int16)(&t.vertTypoDescender), "vdsc")
+		addInt16((*int16)(&t.vertTypoLineGap), "vlgp")
+		addInt16(&t.caretSlopeRise, "vcrs")
+		addInt16(&t.caretSlopeRun, "vcrn")
+		addInt16(&t.caretOffset, "vcof")
+	}
+	if t := f.post; t != nil {
+		addInt16((*int16)(&t.underlinePosition), "undo")
+		addInt16((*int16)(&t.underlineThickness), "unds")
+	}
+}
+
+// widthClasses maps the values of the wdth axis to the OS/2 usWidthClass values.
+var widthClasses = []struct {
+	width float64
+	class float64
+}{
+	{50, 1}, {62.5, 2}, {75, 3}, {87.5, 4}, {100, 5}, {112.5, 6}, {125, 7}, {150, 8}, {200, 9},
+}
+
+// setStyleClasses sets usWeightClass and usWidthClass of the OS/2 table and the italic angle of the post
+// table of `f` from the wght, wdth and slnt axes of `fvar` at the user-space coordinates `user`.
+func (f *font) setStyleClasses(fvar *fvarTable, user []float64) {
+	for i, axis := range fvar.axes {
+		v := user[i]
+		switch axis.axisTag.String() {
+		case "wght":
+			if f.os2 != nil {
+				f.os2.usWeightClass = uint16(otRound(math.Max(1, math.Min(1000, v))))
+			}
+		case "wdth":
+			if f.os2 == nil {
+				continue
+			}
+			v = math.Max(50, math.Min(200, v))
+			for j := 1; j < len(widthClasses); j++ {
+				lo, hi := widthClasses[j-1], widthClasses[j]
+				if v <= hi.width {
+					class := lo.class + (v-lo.width)*(hi.class-lo.class)/(hi.width-lo.width)
+					f.os2.usWidthClass = uint16(otRound(class))
+					break
+				}
+			}
+		case "slnt":
+			if f.post != nil {
+				f.post.italicAngle = fixed(math.Round(math.Max(-90, math.Min(90, v)) * 65536))
+			}
+		}
+	}
+}
+
+// weightNames are the common subfamily names of the standard weights.
+var weightNames = map[float64]string{
+	100: "Thin",
+	200: "ExtraLight",
+	300: "Light",
+	400: "Regular",
+	500: "Medium",
+	600: "SemiBold",
+	700: "Bold",
+	800: "ExtraBold",
+	900: "Black",
+}
+
+// updateInstanceNames updates the family, subfamily, full, unique and PostScript names of `f` for the
+// instance of `fvar` at the user-space coordinates `user`, and removes the variations PostScript name
+// prefix. The subfamily name of the matching named instance is used if there is one.
+func (f *font) updateInstanceNames(fvar *fvarTable, user []float64) {
+	t := f.name
+	family := t.englishName(16)
+	if family == "" {
+		family = t.englishName(1)
+	}
+
+	var subfamily, psName string
+	for _, inst := range fvar.instances {
+		match := true
+		for i, v := range inst.coordinates {
+			if math.Abs(v-user[i]) > 1e-4 {
+				match = false
+				break
+			}
+		}
+		if match {
+			subfamily = t.englishName(inst.subfamilyNameID)
+			if inst.postScriptNameID != 0xFFFF {
+				psName = t.englishName(inst.postScriptNameID)
+			}
+			break
+		}
+	}
+	if subfamily == "" {
+		subfamily = instanceSubfamily(fvar, user)
+	}
+
+	// The family name and the subfamily name are limited to the RIBBI styles (Regular, Italic, Bold and
+	// Bold Italic), with other styles moved to the family name and the typographic names.
+	var ribbi, other []string
+	for _, word := range strings.Fields(subfamily) {
+		switch word {
+		case "Regular":
+		case "Bold", "Italic":
+			ribbi = append(ribbi, word)
+		default:
+			other = append(other, word)
+		}
+	}
+	if len(other) > 0 {
+		t.setName(1, family+" "+strings.Join(other, " "))
+		t.setName(16, family)
+		t.setName(17, subfamily)
+	} else {
+		t.setName(1, family)
+		t.removeName(16)
+		t.removeName(17)
+	}
+	if len(ribbi) > 0 {
+		t.setName(2, strings.Join(ribbi, " "))
+	} else {
+		t.setName(2, "Regular")
+	}
+	t.setName(4, family+" "+subfamily)
+
+	if psName == "" {
+		prefix := t.englishName(25)
+		if prefix == "" {
+			prefix = family
+		}
+		psName = prefix + "-" + subfamily
+	}
+	psName = sanitizePostScriptName(psName)
+	t.setName(6, psName)
+	t.removeName(25)
+
+	vendor := ""
+	if f.os2 != nil {
+		vendor = f.os2.achVendID.String()
+	}
+	t.setName(3, fmt.Sprintf("%.3f;%s;%s", f.head.fontRevision.Float64(), vendor, psName))
+}
+
+// instanceSubfamily returns a subfamily name for the instance of `fvar` at the user-space coordinates
+// `user` from the axis values that differ from the defaults, e.g. "Medium wdth75 Italic".
+func instanceSubfamily(fvar *fvarTable, user []float64) string {
+	var parts []string
+	italic := false
+	for i, axis := range fvar.axes {
+		v := user[i]
+		if v == axis.defaultValue {
+			continue
+		}
+		axisTag := axis.axisTag.String()
+		switch {
+		case axisTag == "wght" && weightNames[v] != "":
+			parts = append(parts, weightNames[v])
+		case axisTag == "ital" && v == 1:
+			italic = true
+		default:
+			parts = append(parts, axisTag+strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	if italic {
+		parts = append(parts, "Italic")
+	}
+	if len(parts) == 0 {
+		return "Regular"
+	}
+	return strings.Join(parts, " ")
+}
+
+// sanitizePostScriptName returns `name` with the characters that are not allowed in PostScript names
+// removed and limited to 63 characters.
+func sanitizePostScriptName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 33 || r > 126 || strings.ContainsRune("[](){}<>/%", r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name = b.String()
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// updateAvgCharWidth sets xAvgCharWidth of the OS/2 table of `f` to the average of the non-zero advance
+// widths of the glyphs.
+func (f *font) updateAvgCharWidth() {
+	if f.os2 == nil || f.hmtx == nil {
+		return
+	}
+	var sum, count int
+	for i := 0; i < f.hmtx.numGlyphs(); i++ {
+		if w := int(f.hmtx.getMetric(GlyphIndex(i)).advanceWidth); w > 0 {
+			sum += w
+			count++
+		}
+	}
+	if count > 0 {
+		f.os2.xAvgCharWidth = int16(otRound(float64(sum) / float64(count)))
+	}
+}
@@ -0,0 +1,377 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestItemVariationStore returns an ItemVariationStore for two axes with a single region peaking at
+// the maximum of the first axis, and one item per delta.
+func buildTestItemVariationStore(deltas ...int16) []byte {
+	buf, write := testWriter()
+	write(uint16(1), uint32(12), uint16(1), uint32(28))
+	write(uint16(2), uint16(1), int16(0), int16(0x4000), int16(0x4000), int16(0), int16(0), int16(0))
+	write(uint16(len(deltas)), uint16(1), uint16(1), uint16(0), deltas)
+	return buf.Bytes()
+}
+
+// buildTestMvar returns an MVAR table varying the typo ascender by 20 and the underline position by -30
+// at the maximum weight.
+func buildTestMvar() []byte {
+	buf, write := testWriter()
+	write(uint16(1), uint16(0), uint16(0), uint16(8), uint16(2), uint16(28))
+	write(makeTag("hasc"), uint16(0), uint16(0))
+	write(makeTag("undo"), uint16(0), uint16(1))
+	write(buildTestItemVariationStore(20, -30))
+	return buf.Bytes()
+}
+
+// buildTestHvar returns an HVAR table for `numGlyphs` glyphs varying the advance of glyph `gid` by 50 at
+// the maximum weight.
+func buildTestHvar(numGlyphs int, gid GlyphIndex) []byte {
+	store := buildTestItemVariationStore(0, 50)
+	buf, write := testWriter()
+	write(uint16(1), uint16(0), uint32(20), uint32(20+len(store)), uint32(0), uint32(0))
+	write(store)
+	write(uint8(0), uint8(0), uint16(numGlyphs))
+	for i := 0; i < numGlyphs; i++ {
+		if GlyphIndex(i) == gid {
+			write(uint8(1))
+		} else {
+			write(uint8(0))
+		}
+	}
+	return buf.Bytes()
+}
+
+// buildTestCvar returns a cvar table varying the control values 0 and 1 by 10 and -4 at the maximum weight.
+func buildTestCvar() []byte {
+	buf, write := testWriter()
+	write(uint16(1), uint16(0), uint16(1), uint16(16))
+	write(uint16(7), uint16(gvarEmbeddedPeakTuple|gvarPrivatePointNumbers), int16(0x4000), int16(0))
+	write([]byte{2, 0x01, 0, 1}, []byte{0x01, 10, 0xFC})
+	return buf.Bytes()
+}
+
+// buildTestInstanceFont builds a variable font from the first 102 glyphs of FreeSans with the axes of
+// buildTestFvar and variations of the glyphs I (46), a simple glyph with 4 points, and exclamdown (101), a
+// composite glyph with a single component, as well as variations of the control values and metrics.
+func buildTestInstanceFont(t *testing.T, withHvar bool) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err = fnt.SubsetFirst(102)
+	require.NoError(t, err)
+
+	glyphData := make([][]byte, 102)
+
+	// I: shifted right by 20 and advance increased by 40 at the maximum weight, and point 0 moved by
+	// (-8,4) at the minimum weight, moving all points of the contour.
+	buf, write := testWriter()
+	write(uint16(2), uint16(16))
+	write(uint16(10), uint16(0))
+	write(uint16(7), uint16(gvarEmbeddedPeakTuple|gvarPrivatePointNumbers), int16(-0x4000), int16(0))
+	write([]byte{0x07, 20, 20, 20, 20, 0, 40, 0, 0, 0x87})
+	write([]byte{1, 0x00, 0}, []byte{0x00, 0xF8}, []byte{0x00, 4})
+	glyphData[46] = buf.Bytes()
+
+	// exclamdown: component moved right by 6 and advance increased by 12 at the maximum weight.
+	buf, write = testWriter()
+	write(uint16(1), uint16(8))
+	write(uint16(7), uint16(0))
+	write([]byte{0x04, 6, 0, 12, 0, 0, 0x84})
+	glyphData[101] = buf.Bytes()
+
+	gvar := &gvarTable{
+		axisCount:    2,
+		sharedTuples: [][]f2dot14{{0x4000, 0}},
+		glyphData:    glyphData,
+	}
+	fnt.rawTables = append(fnt.rawTables,
+		&rawTable{tableTag: makeTag("fvar"), data: buildTestFvar(true)},
+		&rawTable{tableTag: makeTag("avar"), data: buildTestAvar()},
+		&rawTable{tableTag: makeTag("gvar"), data: gvar.encode()},
+		&rawTable{tableTag: makeTag("cvar"), data: buildTestCvar()},
+		&rawTable{tableTag: makeTag("MVAR"), data: buildTestMvar()},
+	)
+	if withHvar {
+		fnt.rawTables = append(fnt.rawTables, &rawTable{tableTag: makeTag("HVAR"), data: buildTestHvar(102, 46)})
+	}
+	fnt.name.setName(258, "Regular")
+	fnt.name.setName(259, "FreeSansVar-Regular")
+	fnt.name.setName(260, "Bold Condensed")
+	fnt.name.setName(261, "FreeSansVar-BoldCondensed")
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, fnt.gvar)
+	return fnt
+}
+
+func TestInstance(t *testing.T) {
+	fnt := buildTestInstanceFont(t, false)
+
+	type glyphExpectation struct {
+		gid                    GlyphIndex
+		advance                uint16
+		lsb                    int16
+		xMin, yMin, xMax, yMax int16
+	}
+	testcases := []struct {
+		coords       map[string]float64
+		glyphs       []glyphExpectation
+		cvt          []int16
+		ascenderDiff int16
+		underlineDif fword
+		weightClass  uint16
+	}{
+		{
+			// Maximum weight: normalized 1.
+			coords: map[string]float64{"wght": 900},
+			glyphs: []glyphExpectation{
+				{46, 318, 120, 120, 0, 214, 729},
+				{101, 290, 128, 128, -205, 212, 524},
+				{6, 278, 124, 124, 0, 208, 729},
+			},
+			cvt:          []int16{43, 629},
+			ascenderDiff: 20,
+			underlineDif: -30,
+			weightClass:  900,
+		},
+		{
+			// Normalized 0.5 mapped to 0.25 by avar.
+			coords: map[string]float64{"wght": 650},
+			glyphs: []glyphExpectation{
+				{46, 288, 105, 105, 0, 199, 729},
+				{101, 281, 124, 124, -205, 208, 524},
+			},
+			cvt:          []int16{36, 632},
+			ascenderDiff: 5,
+			underlineDif: -7,
+			weightClass:  650,
+		},
+		{
+			// Minimum weight: normalized -1, clamped.
+			coords: map[string]float64{"wght": 50},
+			glyphs: []glyphExpectation{
+				{46, 278, 92, 92, 4, 186, 733},
+				{101, 278, 122, 122, -205, 206, 524},
+			},
+			cvt:         []int16{33, 633},
+			weightClass: 100,
+		},
+		{
+			// Default instance.
+			coords: nil,
+			glyphs: []glyphExpectation{
+				{46, 278, 100, 100, 0, 194, 729},
+			},
+			cvt:         []int16{33, 633},
+			weightClass: 400,
+		},
+	}
+
+	for _, tcase := range testcases {
+		inst, err := fnt.Instance(tcase.coords)
+		require.NoError(t, err)
+
+		data, err := inst.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		inst, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		for _, g := range tcase.glyphs {
+			adv, err := inst.GlyphAdvance(g.gid)
+			require.NoError(t, err)
+			assert.Equal(t, g.advance, adv, "advance %d %v", g.gid, tcase.coords)
+			lsb, err := inst.GlyphLSB(g.gid)
+			require.NoError(t, err)
+			assert.Equal(t, g.lsb, lsb, "lsb %d %v", g.gid, tcase.coords)
+			xMin, yMin, xMax, yMax, _, err := inst.GlyphBBox(g.gid)
+			require.NoError(t, err)
+			assert.Equal(t, []int16{g.xMin, g.yMin, g.xMax, g.yMax}, []int16{xMin, yMin, xMax, yMax},
+				"bbox %d %v", g.gid, tcase.coords)
+		}
+
+		// Overlap flags are set as with fontTools.
+		simple, err := decodeSimpleGlyph(inst.glyf.descs[46].raw)
+		require.NoError(t, err)
+		assert.True(t, simple.overlap)
+		require.NoError(t, inst.glyf.descs[101].parse())
+		assert.True(t, compositeGlyphFlag(inst.glyf.descs[101].composite.components[0].flags).IsSet(overlapCompound))
+
+		assert.Equal(t, tcase.cvt, inst.cvt.controlValues, "%v", tcase.coords)
+		assert.Equal(t, fnt.os2.sTypoAscender+tcase.ascenderDiff, inst.os2.sTypoAscender, "%v", tcase.coords)
+		assert.Equal(t, fnt.post.underlinePosition+tcase.underlineDif, inst.post.underlinePosition, "%v", tcase.coords)
+		assert.Equal(t, tcase.weightClass, inst.os2.usWeightClass)
+
+		assert.Nil(t, inst.Axes())
+		for _, name := range []string{"fvar", "avar", "gvar", "cvar", "MVAR"} {
+			assert.Nil(t, inst.rawTableData(name), name)
+		}
+	}
+
+	// The source font is not modified.
+	adv, err := fnt.GlyphAdvance(46)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(278), adv)
+	assert.NotNil(t, fnt.rawTableData("gvar"))
+
+	_, err = fnt.Instance(map[string]float64{"opsz": 12})
+	assert.Error(t, err)
+
+	static, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	_, err = static.Instance(map[string]float64{"wght": 700})
+	assert.Error(t, err)
+}
+
+func TestInstanceHvar(t *testing.T) {
+	fnt := buildTestInstanceFont(t, true)
+	inst, err := fnt.Instance(map[string]float64{"wght": 900})
+	require.NoError(t, err)
+
+	// The advances are varied by HVAR rather than by the phantom points.
+	adv, err := inst.GlyphAdvance(46)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(328), adv)
+	adv, err = inst.GlyphAdvance(101)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(278), adv)
+	lsb, err := inst.GlyphLSB(46)
+	require.NoError(t, err)
+	assert.Equal(t, int16(120), lsb)
+	assert.Nil(t, inst.rawTableData("HVAR"))
+}
+
+func TestInstanceNames(t *testing.T) {
+	fnt := buildTestInstanceFont(t, false)
+
+	testcases := []struct {
+		coords     map[string]float64
+		names      map[uint16]string
+		widthClass uint16
+	}{
+		{
+			coords: map[string]float64{"wght": 700, "wdth": 87.5},
+			names: map[uint16]string{
+				1:  "FreeSans Condensed",
+				2:  "Bold",
+				3:  "1.790;PfEd;FreeSansVar-BoldCondensed",
+				4:  "FreeSans Bold Condensed",
+				6:  "FreeSansVar-BoldCondensed",
+				16: "FreeSans",
+				17: "Bold Condensed",
+			},
+			widthClass: 4,
+		},
+		{
+			coords: map[string]float64{"wght": 400},
+			names: map[uint16]string{
+				1:  "FreeSans",
+				2:  "Regular",
+				4:  "FreeSans Regular",
+				6:  "FreeSansVar-Regular",
+				16: "",
+				17: "",
+			},
+			widthClass: 5,
+		},
+		{
+			coords: map[string]float64{"wght": 500, "wdth": 81.25},
+			names: map[uint16]string{
+				1:  "FreeSans Medium wdth81.25",
+				2:  "Regular",
+				4:  "FreeSans Medium wdth81.25",
+				6:  "FreeSans-Mediumwdth81.25",
+				16: "FreeSans",
+				17: "Medium wdth81.25",
+			},
+			widthClass: 4,
+		},
+	}
+	for _, tcase := range testcases {
+		inst, err := fnt.Instance(tcase.coords)
+		require.NoError(t, err)
+		for nameID, expected := range tcase.names {
+			assert.Equal(t, expected, inst.name.englishName(nameID), "name %d %v", nameID, tcase.coords)
+		}
+		assert.Equal(t, tcase.widthClass, inst.os2.usWidthClass)
+
+		// All records of a name are updated.
+		for _, nr := range inst.name.nameRecords {
+			if nr.nameID == 2 {
+				assert.Equal(t, tcase.names[2], nr.Decoded())
+			}
+		}
+	}
+
+	// The name table of the source font is not modified.
+	assert.Equal(t, "FreeSans", fnt.name.englishName(1))
+	assert.Equal(t, "", fnt.name.englishName(17))
+}
+
+func TestInterpolateContour(t *testing.T) {
+	points := []pointF{{0, 0}, {100, 0}, {200, 0}, {200, 100}, {100, 100}}
+	touched := []bool{true, false, true, false, false}
+	deltas := []pointF{{10, 0}, {}, {30, 20}, {}, {}}
+	interpolateContour(points, touched, deltas)
+	// The y deltas differ between touched points with equal y coordinates and are not interpolated.
+	assert.Equal(t, []pointF{{10, 0}, {20, 0}, {30, 20}, {30, 0}, {20, 0}}, deltas)
+
+	// A single touched point moves the whole contour.
+	touched = []bool{false, false, false, true, false}
+	deltas = []pointF{{}, {}, {}, {5, -5}, {}}
+	interpolateContour(points, touched, deltas)
+	assert.Equal(t, []pointF{{5, -5}, {5, -5}, {5, -5}, {5, -5}, {5, -5}}, deltas)
+}
+
+func TestRegionScalar(t *testing.T) {
+	testcases := []struct {
+		region   []regionAxis
+		coords   []float64
+		expected float64
+	}{
+		{[]regionAxis{{0, 1, 1}}, []float64{1}, 1},
+		{[]regionAxis{{0, 1, 1}}, []float64{0.25}, 0.25},
+		{[]regionAxis{{0, 1, 1}}, []float64{-0.5}, 0},
+		{[]regionAxis{{0, 0.5, 1}}, []float64{0.75}, 0.5},
+		{[]regionAxis{{0, 1, 1}, {-1, -1, 0}}, []float64{0.5, -0.5}, 0.25},
+		{[]regionAxis{{0, 0, 0}, {-1, -1, 0}}, []float64{0.5, -1}, 1},
+		{[]regionAxis{{-1, 0.5, 1}}, []float64{0}, 1}, // invalid region spanning 0 is ignored.
+	}
+	for _, tcase := range testcases {
+		assert.Equal(t, tcase.expected, regionScalar(tcase.region, tcase.coords), "%v %v", tcase.region, tcase.coords)
+	}
+
+	store, err := parseItemVariationStore(buildTestItemVariationStore(20, -30), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, store.delta(0, 0, []float64{0.25, 0}))
+	assert.Equal(t, -30.0, store.delta(0, 1, []float64{1, 1}))
+	assert.Equal(t, 0.0, store.delta(0, 2, []float64{1, 1}))
+
+	data := buildTestHvar(4, 2)
+	hvar, err := parseHvarData("HVAR", data)
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, hvar.advanceDelta(2, []float64{1, 0}))
+	assert.Equal(t, 0.0, hvar.advanceDelta(3, []float64{1, 0}))
+	_, err = parseHvarData("HVAR", data[:len(data)-2])
+	assert.Error(t, err)
+
+	mvar, err := parseMvarData(buildTestMvar())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"hasc": 10, "undo": -15}, mvar.deltas([]float64{0.5, 0}))
+
+	_, err = parseMvarData(bytes.Repeat([]byte{0}, 12))
+	assert.Error(t, err)
+}
@@ -9,8 +9,6 @@ package strutils
 import (
 	"bytes"
 	"unicode/utf16"
-
-	"github.com/sirupsen/logrus"
 )
 
 var pdfdocEncodingRuneMap map[rune]byte
@@ -29,7 +27,7 @@ func UTF16ToRunes(b []byte) []rune {
 	}
 	if len(b)%2 != 0 {
 		b = append(b, 0)
-		logrus.Debug("ERROR: UTF16ToRunes. Padding with zeros.")
+		logger.Debugf("ERROR: UTF16ToRunes. Padding with zeros.")
 	}
 	n := len(b) >> 1
 	chars := make([]uint16, n)
@@ -64,7 +62,7 @@ func PDFDocEncodingToRunes(b []byte) []rune {
 	for _, bval := range b {
 		rune, has := pdfDocEncoding[bval]
 		if !has {
-			logrus.Debugf("Error: PDFDocEncoding input mapping error %d - skipping", bval)
+			logger.Debugf("Error: PDFDocEncoding input mapping error %d - skipping", bval)
 			continue
 		}
 
@@ -85,7 +83,7 @@ func StringToPDFDocEncoding(s string) []byte {
 	for _, r := range s {
 		b, has := pdfdocEncodingRuneMap[r]
 		if !has {
-			logrus.Debugf("ERROR: PDFDocEncoding rune mapping missing %c/%X - skipping", r, r)
+			logger.Debugf("ERROR: PDFDocEncoding rune mapping missing %c/%X - skipping", r, r)
 			continue
 		}
 		buf.WriteByte(b)
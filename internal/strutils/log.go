@@ -0,0 +1,26 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package strutils
+
+// Logger is the interface of the logger the debug output of the package is written to.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// nopLogger discards all output.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+
+var logger Logger = nopLogger{}
+
+// SetLogger sets the logger the debug output of the package is written to. A nil `l` discards the output.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger = l
+}
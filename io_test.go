@@ -6,10 +6,15 @@
 package unitype
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
+	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 /*
@@ -104,3 +109,61 @@ func BenchmarkBinaryRead3(b *testing.B) {
 	}
 	b.Logf("Result: %d (N: %d)", sum, b.N)
 }
+
+func TestByteReader(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	r := newByteReader(bytes.NewReader(data))
+
+	// Seeks forward within the buffered data, backward and beyond it.
+	for _, offset := range []int64{0, 2, 100, 50, 9000, 1, 9998} {
+		require.NoError(t, r.SeekTo(offset))
+		assert.Equal(t, offset, r.Offset())
+		val, err := r.readUint16()
+		require.NoError(t, err)
+		assert.Equal(t, uint16(byte(offset))<<8|uint16(byte(offset+1)), val, offset)
+	}
+
+	require.NoError(t, r.SeekTo(4))
+	var vals []uint16
+	require.NoError(t, r.readSlice(&vals, 3))
+	assert.Equal(t, []uint16{0x0405, 0x0607, 0x0809}, vals)
+	require.NoError(t, r.readSlice(&vals, 1))
+	assert.Equal(t, []uint16{0x0405, 0x0607, 0x0809, 0x0a0b}, vals)
+	var u32 uint32
+	var tg tag
+	require.NoError(t, r.read(&u32, &tg))
+	assert.Equal(t, uint32(0x0c0d0e0f), u32)
+	assert.Equal(t, "\x10\x11\x12\x13", tg.String())
+
+	// As io.ReadFull at the end of the data.
+	require.NoError(t, r.SeekTo(9999))
+	_, err := r.readUint32()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	require.NoError(t, r.SeekTo(10000))
+	_, err = r.readUint16()
+	assert.Equal(t, io.EOF, err)
+}
+
+func BenchmarkByteReader(b *testing.B) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := newByteReader(bytes.NewReader(data))
+		var u16 uint16
+		var i16 int16
+		var u32 uint32
+		for j := 0; j < 1000; j++ {
+			require.NoError(b, r.read(&u16, &i16, &u32))
+		}
+		var vals []uint16
+		require.NoError(b, r.readSlice(&vals, 10000))
+		for j := int64(0); j < 1000; j++ {
+			require.NoError(b, r.SeekTo(j*64))
+		}
+	}
+}
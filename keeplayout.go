@@ -0,0 +1,193 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// writeKeepLayout writes `f` to `w` with options `opts`, keeping the layout of the font data `f` was parsed from
+// as described for WriteOptions.KeepLayout.
+func (f *Font) writeKeepLayout(w io.Writer, opts *WriteOptions) error {
+	fnt, err := f.font.prepareWrite(opts)
+	if err != nil {
+		return err
+	}
+	original := fnt.trec.trMap
+	rewrite := map[string]bool{}
+	dirty := func(tag string) bool {
+		if rewrite[tag] || fnt.isDirty(tag) || original[tag] == nil {
+			return true
+		}
+		return tag == "post" && opts.DropGlyphNames || tag == "head" && opts.ZeroModifiedDate
+	}
+
+	tables := fnt.tableWriters(opts)
+	written := map[string]bool{}
+	modified := false
+	for _, t := range tables {
+		written[t.tag] = true
+		modified = modified || dirty(t.tag)
+	}
+	setChanged := len(written) != len(fnt.trec.list)
+	for _, tr := range fnt.trec.list {
+		setChanged = setChanged || !written[tr.tableTag.String()]
+	}
+	modified = modified || setChanged
+
+	// The signature is invalid for modified fonts, see font.write.
+	if modified && fnt.rawTableData("DSIG") != nil {
+		var unsigned []tableWriter
+		for _, t := range tables {
+			if t.tag != "DSIG" {
+				unsigned = append(unsigned, t)
+			}
+		}
+		if opts.EmptyDSIG {
+			unsigned = append(unsigned, tableWriter{"DSIG", func(w *byteWriter) error {
+				return w.writeBytes(dsigEmpty)
+			}})
+			rewrite["DSIG"] = true
+		}
+		tables = unsigned
+		setChanged = true
+	}
+
+	// The tables that were parsed come in the order of their data, followed by the tables added.
+	recs := append([]*tableRecord(nil), fnt.trec.list...)
+	sort.SliceStable(recs, func(i, j int) bool {
+		return recs[i].offset < recs[j].offset
+	})
+	rank := map[string]int{}
+	for i, tr := range recs {
+		rank[tr.tableTag.String()] = i
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		ri, hasi := rank[tables[i].tag]
+		rj, hasj := rank[tables[j].tag]
+		if hasi && hasj {
+			return ri < rj
+		}
+		return hasi && !hasj
+	})
+
+	// The gaps between the tables are only kept for fonts parsed from sfnt data starting with the offset table,
+	// as opposed to fonts of collections.
+	standalone := false
+	if b, err := f.br.readAt(f.brMu, 0, 4); err == nil {
+		standalone = binary.BigEndian.Uint32(b) == fnt.ot.sfntVersion
+	}
+	// gapEnd returns the offset of the end of the bytes following the table with record `tr` in the font data.
+	gapEnd := func(tr *tableRecord) int64 {
+		end := int64(tr.offset) + int64(tr.length)
+		for _, next := range recs {
+			if next.offset > tr.offset {
+				return int64(next.offset)
+			}
+		}
+		padded := (end + 3) &^ 3
+		if f.br.size >= 0 && padded > f.br.size {
+			return f.br.size
+		}
+		return padded
+	}
+
+	var buf bytes.Buffer
+	dirLen := int64(12 + 16*len(tables))
+	buf.Write(make([]byte, dirLen))
+	if standalone && !setChanged && len(recs) > 0 && int64(recs[0].offset) > dirLen {
+		gap, err := f.br.readAt(f.brMu, dirLen, int(int64(recs[0].offset)-dirLen))
+		if err != nil {
+			return err
+		}
+		buf.Write(gap)
+	}
+
+	trec := &tableRecords{}
+	for _, t := range tables {
+		tr := original[t.tag]
+		if !dirty(t.tag) {
+			length := int64(tr.length)
+			if standalone {
+				if end := gapEnd(tr); end > int64(tr.offset)+length {
+					length = end - int64(tr.offset)
+				}
+			}
+			data, err := f.br.readAt(f.brMu, int64(tr.offset), int(length))
+			if err != nil {
+				return wrapParseError(t.tag, int64(tr.offset), err)
+			}
+			trec.Set(t.tag, int64(buf.Len()), int(tr.length), tr.checksum)
+			buf.Write(data)
+			for buf.Len()%4 != 0 && !standalone {
+				buf.WriteByte(0)
+			}
+			continue
+		}
+
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+		offset := int64(buf.Len())
+		bw := newByteWriter(&buf)
+		err := t.write(bw)
+		if err != nil {
+			return err
+		}
+		if t.tag == "head" {
+			// The checksum is computed with a zero checksum adjustment, set when the whole font is written.
+			binary.BigEndian.PutUint32(bw.buffer.Bytes()[8:], 0)
+		}
+		trec.Set(t.tag, offset, bw.bufferedLen(), bw.checksum())
+		err = bw.flushPadded()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The table directory keeps the original order of the table records unless tables were added or removed.
+	ot := newOffsetTable(fnt.ot.sfntVersion, len(tables))
+	if setChanged {
+		sortTableRecords(trec)
+	} else {
+		dup := *fnt.ot
+		dup.numTables = uint16(len(tables))
+		ot = &dup
+		list := make([]*tableRecord, 0, len(trec.list))
+		for _, tr := range fnt.trec.list {
+			list = append(list, trec.trMap[tr.tableTag.String()])
+		}
+		trec.list = list
+	}
+	var dir bytes.Buffer
+	dirw := newByteWriter(&dir)
+	mockf := &font{ot: ot, trec: trec}
+	err = mockf.writeOffsetTable(dirw)
+	if err != nil {
+		return err
+	}
+	err = mockf.writeTableRecords(dirw)
+	if err != nil {
+		return err
+	}
+	err = dirw.flush()
+	if err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	copy(data, dir.Bytes())
+
+	// The checksumAdjustment of an unmodified font is kept as is.
+	if head, has := trec.trMap["head"]; has && (modified || !standalone) && int64(head.offset)+12 <= int64(len(data)) {
+		binary.BigEndian.PutUint32(data[head.offset+8:], 0)
+		binary.BigEndian.PutUint32(data[head.offset+8:], 0xB1B0AFBA-tableChecksum(data))
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,62 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"sort"
+)
+
+// KerningPair represents the horizontal kerning adjustment between two glyphs in font design units.
+type KerningPair struct {
+	Left  GlyphIndex
+	Right GlyphIndex
+	Value int16
+}
+
+// KernPair returns the horizontal kerning adjustment in font design units to apply between the glyphs
+// `left` and `right`. The pair adjustments of the 'kern' feature in the GPOS table take precedence,
+// the legacy kern table is used if the GPOS table has no kerning.
+// Returns false if the pair is not kerned.
+func (f *Font) KernPair(left, right GlyphIndex) (int16, bool) {
+	if f.hasGPOSKerning() {
+		return f.gpos.lookup(left, right)
+	}
+	if f.kern == nil {
+		return 0, false
+	}
+	return f.kern.lookup(left, right)
+}
+
+// AllKernPairs returns all kerned glyph pairs of `f` sorted by the left and then the right glyph.
+func (f *Font) AllKernPairs() []KerningPair {
+	var values map[[2]GlyphIndex]int16
+	switch {
+	case f.hasGPOSKerning():
+		numGlyphs, _ := f.NumGlyphs()
+		values = f.gpos.pairs(numGlyphs)
+	case f.kern != nil:
+		values = f.kern.pairs()
+	default:
+		return nil
+	}
+
+	pairs := make([]KerningPair, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, KerningPair{Left: key[0], Right: key[1], Value: value})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Left != pairs[j].Left {
+			return pairs[i].Left < pairs[j].Left
+		}
+		return pairs[i].Right < pairs[j].Right
+	})
+	return pairs
+}
+
+// hasGPOSKerning returns true if `f` has kerning specified in the GPOS table.
+func (f *Font) hasGPOSKerning() bool {
+	return f.gpos != nil && len(f.gpos.kernLookups) > 0
+}
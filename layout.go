@@ -0,0 +1,400 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"sort"
+)
+
+// Common table formats of the OpenType layout tables (GSUB and GPOS).
+// Only the parts needed to resolve the lookups of a feature in the default script are modelled.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/chapter2
+
+// layoutHeader represents the header shared by the GSUB and GPOS tables. Offsets are from the start of the table.
+type layoutHeader struct {
+	majorVersion      uint16
+	minorVersion      uint16
+	scriptListOffset  offset16
+	featureListOffset offset16
+	lookupListOffset  offset16
+}
+
+// layoutLookup represents a lookup table of the LookupList with extension subtables resolved.
+type layoutLookup struct {
+	lookupType uint16
+	lookupFlag uint16
+	subtables  []int64 // offsets of the subtables from the start of the table.
+}
+
+// coverage maps the glyphs of a coverage table to their coverage index.
+type coverage map[GlyphIndex]int
+
+// classDef maps glyphs to their class as specified by a class definition table. Glyphs not
+// present are in class 0.
+type classDef map[GlyphIndex]uint16
+
+func parseLayoutHeader(r *byteReader) (layoutHeader, error) {
+	var h layoutHeader
+	err := r.read(&h.majorVersion, &h.minorVersion)
+	if err != nil {
+		return h, err
+	}
+	if h.majorVersion != 1 {
+		logger.Debugf("Unsupported layout table version: %d.%d", h.majorVersion, h.minorVersion)
+		return h, errRangeCheck
+	}
+	err = r.read(&h.scriptListOffset, &h.featureListOffset, &h.lookupListOffset)
+	return h, err
+}
+
+// defaultLangSysFeatures returns the feature indices of the default language system of the default
+// script ("DFLT"), falling back to "latn" if there is no default script.
+// Returns nil if neither script is present.
+func defaultLangSysFeatures(r *byteReader, h layoutHeader) ([]uint16, error) {
+	if h.scriptListOffset == 0 {
+		return nil, nil
+	}
+	scriptList := int64(h.scriptListOffset)
+	err := r.SeekTo(scriptList)
+	if err != nil {
+		return nil, err
+	}
+	var scriptCount uint16
+	err = r.read(&scriptCount)
+	if err != nil {
+		return nil, err
+	}
+	scripts := map[string]offset16{}
+	for i := 0; i < int(scriptCount); i++ {
+		var scriptTag tag
+		var off offset16
+		err = r.read(&scriptTag, &off)
+		if err != nil {
+			return nil, err
+		}
+		scripts[scriptTag.String()] = off
+	}
+
+	off, has := scripts["DFLT"]
+	if !has {
+		off, has = scripts["latn"]
+	}
+	if !has {
+		logger.Debugf("No default script in layout table")
+		return nil, nil
+	}
+
+	script := scriptList + int64(off)
+	err = r.SeekTo(script)
+	if err != nil {
+		return nil, err
+	}
+	var defaultLangSysOffset offset16
+	err = r.read(&defaultLangSysOffset)
+	if err != nil {
+		return nil, err
+	}
+	if defaultLangSysOffset == 0 {
+		return nil, nil
+	}
+
+	err = r.SeekTo(script + int64(defaultLangSysOffset))
+	if err != nil {
+		return nil, err
+	}
+	var lookupOrderOffset offset16
+	var requiredFeatureIndex, featureIndexCount uint16
+	err = r.read(&lookupOrderOffset, &requiredFeatureIndex, &featureIndexCount)
+	if err != nil {
+		return nil, err
+	}
+	var features []uint16
+	if requiredFeatureIndex != 0xFFFF {
+		features = append(features, requiredFeatureIndex)
+	}
+	err = r.readSlice(&features, int(featureIndexCount))
+	if err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+// featureLookupIndices returns the sorted indices of the lookups in the LookupList referenced by
+// the features tagged `feature` in the default language system of the default script.
+func featureLookupIndices(r *byteReader, h layoutHeader, feature string) ([]uint16, error) {
+	features, err := defaultLangSysFeatures(r, h)
+	if err != nil {
+		return nil, err
+	}
+	if len(features) == 0 || h.featureListOffset == 0 {
+		return nil, nil
+	}
+
+	featureList := int64(h.featureListOffset)
+	err = r.SeekTo(featureList)
+	if err != nil {
+		return nil, err
+	}
+	var featureCount uint16
+	err = r.read(&featureCount)
+	if err != nil {
+		return nil, err
+	}
+	type featureRecord struct {
+		featureTag tag
+		offset     offset16
+	}
+	records := make([]featureRecord, featureCount)
+	for i := range records {
+		err = r.read(&records[i].featureTag, &records[i].offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	indexMap := map[uint16]bool{}
+	for _, fi := range features {
+		if int(fi) >= len(records) {
+			logger.Debugf("Feature index out of range (%d/%d)", fi, len(records))
+			return nil, errRangeCheck
+		}
+		if records[fi].featureTag.String() != feature {
+			continue
+		}
+		err = r.SeekTo(featureList + int64(records[fi].offset))
+		if err != nil {
+			return nil, err
+		}
+		var featureParamsOffset offset16
+		var lookupIndexCount uint16
+		err = r.read(&featureParamsOffset, &lookupIndexCount)
+		if err != nil {
+			return nil, err
+		}
+		var indices []uint16
+		err = r.readSlice(&indices, int(lookupIndexCount))
+		if err != nil {
+			return nil, err
+		}
+		for _, li := range indices {
+			indexMap[li] = true
+		}
+	}
+
+	var indices []uint16
+	for li := range indexMap {
+		indices = append(indices, li)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i] < indices[j]
+	})
+	return indices, nil
+}
+
+// parseLookups parses the lookups of the LookupList with the indices `indices`. Subtables of the extension
+// lookup type `extensionType` are resolved to the subtables they point to.
+func parseLookups(r *byteReader, h layoutHeader, indices []uint16, extensionType uint16) ([]*layoutLookup, error) {
+	if len(indices) == 0 || h.lookupListOffset == 0 {
+		return nil, nil
+	}
+
+	lookupList := int64(h.lookupListOffset)
+	err := r.SeekTo(lookupList)
+	if err != nil {
+		return nil, err
+	}
+	var lookupCount uint16
+	err = r.read(&lookupCount)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []offset16
+	err = r.readSlice(&offsets, int(lookupCount))
+	if err != nil {
+		return nil, err
+	}
+
+	var lookups []*layoutLookup
+	for _, li := range indices {
+		if int(li) >= len(offsets) {
+			logger.Debugf("Lookup index out of range (%d/%d)", li, len(offsets))
+			return nil, errRangeCheck
+		}
+		lookup, err := parseLookup(r, lookupList+int64(offsets[li]), extensionType)
+		if err != nil {
+			return nil, err
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups, nil
+}
+
+// parseAllLookups parses all the lookups of the LookupList. Subtables of the extension lookup type
+// `extensionType` are resolved to the subtables they point to.
+func parseAllLookups(r *byteReader, h layoutHeader, extensionType uint16) ([]*layoutLookup, error) {
+	if h.lookupListOffset == 0 {
+		return nil, nil
+	}
+	err := r.SeekTo(int64(h.lookupListOffset))
+	if err != nil {
+		return nil, err
+	}
+	var lookupCount uint16
+	err = r.read(&lookupCount)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]uint16, lookupCount)
+	for i := range indices {
+		indices[i] = uint16(i)
+	}
+	return parseLookups(r, h, indices, extensionType)
+}
+
+// parseLookup parses the lookup table at `offset`.
+func parseLookup(r *byteReader, offset int64, extensionType uint16) (*layoutLookup, error) {
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	l := &layoutLookup{}
+	var subTableCount uint16
+	err = r.read(&l.lookupType, &l.lookupFlag, &subTableCount)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []offset16
+	err = r.readSlice(&offsets, int(subTableCount))
+	if err != nil {
+		return nil, err
+	}
+	for _, off := range offsets {
+		l.subtables = append(l.subtables, offset+int64(off))
+	}
+
+	if l.lookupType != extensionType {
+		return l, nil
+	}
+
+	// Extension subtables point to the actual subtables, which all have the same lookup type.
+	l.lookupType = 0
+	for i, sub := range l.subtables {
+		err = r.SeekTo(sub)
+		if err != nil {
+			return nil, err
+		}
+		var format, lookupType uint16
+		var extOffset offset32
+		err = r.read(&format, &lookupType, &extOffset)
+		if err != nil {
+			return nil, err
+		}
+		if format != 1 || (l.lookupType != 0 && lookupType != l.lookupType) {
+			logger.Debugf("Invalid extension subtable (format %d, type %d)", format, lookupType)
+			return nil, errRangeCheck
+		}
+		l.lookupType = lookupType
+		l.subtables[i] = sub + int64(extOffset)
+	}
+	return l, nil
+}
+
+// parseCoverage parses the coverage table at `offset`.
+func parseCoverage(r *byteReader, offset int64) (coverage, error) {
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var format, count uint16
+	err = r.read(&format, &count)
+	if err != nil {
+		return nil, err
+	}
+
+	cov := coverage{}
+	switch format {
+	case 1:
+		for i := 0; i < int(count); i++ {
+			var gid uint16
+			err = r.read(&gid)
+			if err != nil {
+				return nil, err
+			}
+			cov[GlyphIndex(gid)] = i
+		}
+	case 2:
+		for i := 0; i < int(count); i++ {
+			var start, end, startCoverageIndex uint16
+			err = r.read(&start, &end, &startCoverageIndex)
+			if err != nil {
+				return nil, err
+			}
+			for gid := int(start); gid <= int(end); gid++ {
+				cov[GlyphIndex(gid)] = int(startCoverageIndex) + gid - int(start)
+			}
+		}
+	default:
+		logger.Debugf("Unsupported coverage format: %d", format)
+		return nil, errRangeCheck
+	}
+	return cov, nil
+}
+
+// parseClassDef parses the class definition table at `offset`.
+func parseClassDef(r *byteReader, offset int64) (classDef, error) {
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var format uint16
+	err = r.read(&format)
+	if err != nil {
+		return nil, err
+	}
+
+	cd := classDef{}
+	switch format {
+	case 1:
+		var startGlyph, glyphCount uint16
+		err = r.read(&startGlyph, &glyphCount)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < int(glyphCount); i++ {
+			var class uint16
+			err = r.read(&class)
+			if err != nil {
+				return nil, err
+			}
+			if class != 0 {
+				cd[GlyphIndex(int(startGlyph)+i)] = class
+			}
+		}
+	case 2:
+		var classRangeCount uint16
+		err = r.read(&classRangeCount)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < int(classRangeCount); i++ {
+			var start, end, class uint16
+			err = r.read(&start, &end, &class)
+			if err != nil {
+				return nil, err
+			}
+			if class == 0 {
+				continue
+			}
+			for gid := int(start); gid <= int(end); gid++ {
+				cd[GlyphIndex(gid)] = class
+			}
+		}
+	default:
+		logger.Debugf("Unsupported class definition format: %d", format)
+		return nil, errRangeCheck
+	}
+	return cd, nil
+}
@@ -0,0 +1,39 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"github.com/unidoc/unitype/internal/strutils"
+)
+
+// Logger is the interface of the logger unitype writes its debug output to. The output is discarded unless
+// a logger is set with SetLogger. The loggers of logrus implement Logger, see the logrusadapter package.
+type Logger interface {
+	// Debugf logs information that helps to understand why fonts are rejected or modified.
+	Debugf(format string, args ...interface{})
+	// Tracef logs detailed information about the parsing of the font data.
+	Tracef(format string, args ...interface{})
+}
+
+// nopLogger is a Logger that discards all output.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Tracef(format string, args ...interface{}) {}
+
+// logger is the logger all output of the package goes through.
+var logger Logger = nopLogger{}
+
+// SetLogger sets the logger unitype writes its debug output to. A nil `l` discards the output, which is the
+// default. SetLogger is not safe for concurrent use with the other functions of the package, it is meant
+// to be called once during initialization.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger = l
+	strutils.SetLogger(l)
+}
@@ -0,0 +1,60 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogger records the messages logged.
+type testLogger struct {
+	messages []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Tracef(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	l := &testLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	// No logging on the hot paths.
+	for _, r := range "Hello world" {
+		gid, has := fnt.LookupRune(r)
+		require.True(t, has)
+		_, err = fnt.GlyphAdvance(gid)
+		require.NoError(t, err)
+		_, err = fnt.GlyphName(gid)
+		require.NoError(t, err)
+	}
+	gids, missing := fnt.LookupRunes([]rune("Hello world"))
+	assert.Len(t, gids, 11)
+	assert.Empty(t, missing)
+	assert.Empty(t, l.messages)
+
+	_, err = fnt.GlyphSVG(5)
+	require.Error(t, err)
+	assert.Equal(t, []string{"GlyphSVG requires an SVG table"}, l.messages)
+
+	// Discarded once reset.
+	SetLogger(nil)
+	_, err = fnt.GlyphSVG(5)
+	require.Error(t, err)
+	assert.Len(t, l.messages, 1)
+}
@@ -0,0 +1,10 @@
+module github.com/unidoc/unitype/logrusadapter
+
+go 1.11
+
+require (
+	github.com/sirupsen/logrus v1.5.0
+	github.com/unidoc/unitype v0.0.0-20200419001631-11c8f668ac91
+)
+
+replace github.com/unidoc/unitype => ../
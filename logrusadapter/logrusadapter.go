@@ -0,0 +1,21 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+// Package logrusadapter routes the debug output of unitype to a logrus logger:
+//
+//	unitype.SetLogger(logrusadapter.New(logrus.StandardLogger()))
+package logrusadapter
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/unidoc/unitype"
+)
+
+// New returns a unitype.Logger writing to the logrus logger `l`, e.g. a *logrus.Logger or a *logrus.Entry.
+// The output of unitype is logged at the debug and trace levels.
+func New(l logrus.Ext1FieldLogger) unitype.Logger {
+	return l
+}
@@ -0,0 +1,212 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MergeOptions controls MergeFontsWithOptions.
+type MergeOptions struct {
+	// ScaleSecondary scales the glyphs and metrics of the secondary font to the unitsPerEm of the primary font
+	// if they differ, see Font.ScaleUnitsPerEm. Otherwise fonts with different unitsPerEm are not merged.
+	ScaleSecondary bool
+}
+
+// MergeFonts returns a font with the glyphs of `primary` augmented by the glyphs of `secondary` for the runes
+// not covered by `primary`, such as for adding the glyphs of other scripts to a Latin font.
+// MergeFonts is MergeFontsWithOptions with the default options.
+func MergeFonts(primary, secondary *Font) (*Font, error) {
+	return MergeFontsWithOptions(primary, secondary, MergeOptions{})
+}
+
+// MergeFontsWithOptions returns a font with the glyphs of `primary` augmented by the glyphs of `secondary` for
+// the runes not covered by `primary`, as controlled by `opts`.
+// The glyphs of `primary` keep their GIDs, the glyphs of `secondary` mapped by the runes not covered by `primary`
+// and their components are appended with new GIDs, without their hinting instructions as these depend on the
+// fpgm, cvt and prep tables of `secondary`. The cmap is rebuilt as a Unicode cmap of the runes of both fonts,
+// with the glyph of `primary` for the runes covered by both. The hmtx and vmtx metrics are extended, the vertical
+// metrics only if both fonts have them, and the maxp, head, hhea and OS/2 aggregates are recomputed.
+// All other tables are those of `primary`: layout tables such as GSUB, GPOS and kern and color glyphs apply to the
+// glyphs of `primary` only, and the tables depending on the number of glyphs (hdmx, LTSH, sbix) are dropped.
+// Both fonts must have TrueType (glyf) outlines, variable fonts are not supported. An error is returned if the
+// fonts have different unitsPerEm, unless ScaleSecondary is set.
+func MergeFontsWithOptions(primary, secondary *Font, opts MergeOptions) (*Font, error) {
+	if primary == nil || secondary == nil {
+		return nil, errors.New("nil font")
+	}
+	for _, f := range []*Font{primary, secondary} {
+		for _, t := range []struct {
+			tag     string
+			missing bool
+		}{
+			{"head", f.head == nil},
+			{"maxp", f.maxp == nil},
+			{"hhea", f.hhea == nil},
+			{"hmtx", f.hmtx == nil},
+			{"glyf", f.glyf == nil},
+		} {
+			if t.missing {
+				logger.Debugf("Merging requires the %s table", t.tag)
+				return nil, ErrRequiredTableMissing{Tag: t.tag}
+			}
+		}
+		if f.gvar != nil || f.fvar != nil {
+			return nil, errors.New("merging variable fonts is not supported")
+		}
+	}
+
+	if primary.head.unitsPerEm != secondary.head.unitsPerEm {
+		if !opts.ScaleSecondary {
+			return nil, fmt.Errorf("unitsPerEm differs: %d != %d", primary.head.unitsPerEm,
+				secondary.head.unitsPerEm)
+		}
+		secondary = &Font{font: secondary.font.clone()}
+		err := secondary.ScaleUnitsPerEm(primary.head.unitsPerEm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The glyphs of secondary to append: those of the runes not covered by primary and their components.
+	runeMap := make(map[rune]GlyphIndex)
+	for r, gid := range primary.runeLookupMap() {
+		runeMap[r] = gid
+	}
+	var indices []GlyphIndex
+	added := map[rune]GlyphIndex{}
+	for r, gid := range secondary.runeLookupMap() {
+		if _, has := runeMap[r]; has || gid == 0 {
+			continue
+		}
+		added[r] = gid
+		indices = append(indices, gid)
+	}
+	included, err := secondary.glyf.componentClosure(indices)
+	if err != nil {
+		return nil, err
+	}
+	gids := make([]GlyphIndex, 0, len(included))
+	for gid := range included {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(i, j int) bool {
+		return gids[i] < gids[j]
+	})
+
+	numPrimary := int(primary.maxp.numGlyphs)
+	if len(primary.glyf.descs) < numPrimary {
+		numPrimary = len(primary.glyf.descs)
+	}
+	numGlyphs := numPrimary + len(gids)
+	if numGlyphs > math.MaxUint16 {
+		logger.Debugf("Merged font has too many glyphs (%d)", numGlyphs)
+		return nil, errRangeCheck
+	}
+	oldnew := make(map[GlyphIndex]GlyphIndex, len(gids))
+	for i, gid := range gids {
+		oldnew[gid] = GlyphIndex(numPrimary + i)
+	}
+	for r, gid := range added {
+		runeMap[r] = oldnew[gid]
+	}
+
+	newfnt := primary.font.clone()
+	newfnt.glyf = &glyfTable{descs: append([]*glyphDescription(nil), primary.glyf.descs[:numPrimary]...)}
+	for _, gid := range gids {
+		raw, err := secondary.glyf.descs[gid].remapComponents(oldnew)
+		if err != nil {
+			return nil, err
+		}
+		raw, err = (&glyphDescription{raw: raw}).stripInstructions()
+		if err != nil {
+			return nil, err
+		}
+		newfnt.glyf.descs = append(newfnt.glyf.descs, &glyphDescription{raw: raw})
+	}
+	newfnt.maxp.numGlyphs = uint16(numGlyphs)
+
+	newfnt.hmtx = &hmtxTable{hMetrics: make([]longHorMetric, 0, numGlyphs)}
+	for gid := 0; gid < numPrimary; gid++ {
+		newfnt.hmtx.hMetrics = append(newfnt.hmtx.hMetrics, primary.hmtx.getMetric(GlyphIndex(gid)))
+	}
+	for _, gid := range gids {
+		newfnt.hmtx.hMetrics = append(newfnt.hmtx.hMetrics, secondary.hmtx.getMetric(gid))
+	}
+	newfnt.hhea.numberOfHMetrics = uint16(numGlyphs)
+	newfnt.optimizeHmtx()
+
+	if newfnt.vhea != nil && newfnt.vmtx != nil && secondary.vhea != nil && secondary.vmtx != nil {
+		newfnt.vmtx = &vmtxTable{vMetrics: make([]longVerMetric, 0, numGlyphs)}
+		for gid := 0; gid < numPrimary; gid++ {
+			newfnt.vmtx.vMetrics = append(newfnt.vmtx.vMetrics, primary.vmtx.getMetric(GlyphIndex(gid)))
+		}
+		for _, gid := range gids {
+			newfnt.vmtx.vMetrics = append(newfnt.vmtx.vMetrics, secondary.vmtx.getMetric(gid))
+		}
+		newfnt.vhea.numOfLongVerMetrics = uint16(numGlyphs)
+		newfnt.optimizeVmtx()
+	} else if newfnt.vhea != nil || newfnt.vmtx != nil {
+		logger.Debugf("Dropping vertical metrics as the secondary font has none")
+		newfnt.vhea, newfnt.vmtx = nil, nil
+	}
+
+	err = newfnt.updateLocaFormat()
+	if err != nil {
+		return nil, err
+	}
+	newfnt.updateHeadBBox()
+	newfnt.recomputeMaxp()
+	newfnt.recomputeHhea()
+
+	if newfnt.post != nil && len(newfnt.post.glyphNames) > 0 {
+		names := make([]GlyphName, numGlyphs)
+		copy(names, newfnt.post.glyphNames)
+		used := make(map[GlyphName]bool, numGlyphs)
+		for _, name := range names[:numPrimary] {
+			used[name] = true
+		}
+		for i, gid := range gids {
+			if secondary.post == nil || int(gid) >= len(secondary.post.glyphNames) {
+				continue
+			}
+			name := secondary.post.glyphNames[gid]
+			if !used[name] {
+				names[numPrimary+i] = name
+				used[name] = true
+			}
+		}
+		newfnt.post.glyphNames = names
+		newfnt.post.glyphNameIndex = nil
+		newfnt.post.offsets = nil
+	}
+
+	newfnt.cmap, err = newUnicodeCmap(runeMap)
+	if err != nil {
+		return nil, err
+	}
+
+	if newfnt.os2 != nil {
+		if secondary.os2 != nil {
+			// The ranges of secondary are cleared where not covered by the merged font.
+			newfnt.os2.ulUnicodeRange1 |= secondary.os2.ulUnicodeRange1
+			newfnt.os2.ulUnicodeRange2 |= secondary.os2.ulUnicodeRange2
+			newfnt.os2.ulUnicodeRange3 |= secondary.os2.ulUnicodeRange3
+			newfnt.os2.ulUnicodeRange4 |= secondary.os2.ulUnicodeRange4
+			newfnt.os2.ulCodePageRange1 |= secondary.os2.ulCodePageRange1
+			newfnt.os2.ulCodePageRange2 |= secondary.os2.ulCodePageRange2
+		}
+		newfnt.updateOS2Ranges(func(gid GlyphIndex) bool {
+			return true
+		})
+	}
+
+	newfnt.pruneGlyphCountTables()
+	return &Font{font: newfnt}, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeFonts(t *testing.T) {
+	freeSans, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	roboto, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+
+	subset := func(fnt *Font, runes string) *Font {
+		indices, missing := fnt.LookupRunes([]rune(runes))
+		require.Empty(t, missing)
+		subfnt, _, err := fnt.Subset(indices)
+		require.NoError(t, err)
+		return subfnt
+	}
+	reparse := func(fnt *Font) *Font {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.Write(&buf))
+		require.NoError(t, ValidateBytes(buf.Bytes()))
+		newfnt, err := parseTestBytes(buf.Bytes())
+		require.NoError(t, err)
+		return newfnt
+	}
+
+	t.Run("SameUnitsPerEm", func(t *testing.T) {
+		primary := subset(freeSans, "Hello")
+		secondary := subset(freeSans, "WorldÅΩ")
+		merged, err := MergeFonts(primary, secondary)
+		require.NoError(t, err)
+		merged = reparse(merged)
+
+		numGlyphs, _ := merged.NumGlyphs()
+		numPrimary, _ := primary.NumGlyphs()
+		assert.True(t, numGlyphs > numPrimary)
+		for _, r := range "HelloWorldÅΩ" {
+			gid, has := merged.LookupRune(r)
+			require.True(t, has, string(r))
+			origGID, _ := freeSans.LookupRune(r)
+
+			o, err := merged.GlyphOutline(gid)
+			require.NoError(t, err)
+			orig, err := freeSans.GlyphOutline(origGID)
+			require.NoError(t, err)
+			assert.Equal(t, orig, o, string(r))
+
+			advance, err := merged.GlyphAdvance(gid)
+			require.NoError(t, err)
+			origAdvance, err := freeSans.GlyphAdvance(origGID)
+			require.NoError(t, err)
+			assert.Equal(t, origAdvance, advance, string(r))
+		}
+		// The glyphs of primary keep their GIDs.
+		for _, r := range "Helo" {
+			gid, _ := primary.LookupRune(r)
+			assert.Equal(t, gid, merged.runeLookupMap()[r])
+		}
+		assert.False(t, merged.CoversRune('x'))
+	})
+
+	t.Run("UnitsPerEmDiffers", func(t *testing.T) {
+		_, err := MergeFonts(roboto, freeSans)
+		assert.EqualError(t, err, "unitsPerEm differs: 2048 != 1000")
+
+		primary := subset(roboto, "AB")
+		secondary := subset(freeSans, "ABא")
+		merged, err := MergeFontsWithOptions(primary, secondary, MergeOptions{ScaleSecondary: true})
+		require.NoError(t, err)
+		merged = reparse(merged)
+
+		// Primary wins for the runes covered by both fonts.
+		gid, has := merged.LookupRune('A')
+		require.True(t, has)
+		mergedAdvance, err := merged.GlyphAdvance(gid)
+		require.NoError(t, err)
+		robotoGID, _ := roboto.LookupRune('A')
+		robotoAdvance, err := roboto.GlyphAdvance(robotoGID)
+		require.NoError(t, err)
+		assert.Equal(t, robotoAdvance, mergedAdvance)
+
+		// The glyphs of secondary are scaled to 2048 units per em.
+		gid, has = merged.LookupRune('א')
+		require.True(t, has)
+		freeSansGID, _ := freeSans.LookupRune('א')
+		advance, err := freeSans.GlyphAdvance(freeSansGID)
+		require.NoError(t, err)
+		mergedAdvance, err = merged.GlyphAdvance(gid)
+		require.NoError(t, err)
+		assert.InDelta(t, float64(advance)*2.048, float64(mergedAdvance), 0.5)
+
+		_, _, _, yMax, _, err := freeSans.GlyphBBox(freeSansGID)
+		require.NoError(t, err)
+		_, _, _, mergedYMax, _, err := merged.GlyphBBox(gid)
+		require.NoError(t, err)
+		assert.InDelta(t, float64(yMax)*2.048, float64(mergedYMax), 1)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := MergeFonts(freeSans, nil)
+		assert.Error(t, err)
+		_, err = MergeFonts(&Font{font: &font{}}, freeSans)
+		assert.Equal(t, ErrRequiredTableMissing{Tag: "head"}, err)
+	})
+}
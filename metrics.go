@@ -0,0 +1,361 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import "math"
+
+// BBox represents a bounding box in font design units.
+type BBox struct {
+	XMin int
+	YMin int
+	XMax int
+	YMax int
+}
+
+// NumGlyphs returns the number of glyphs in `f` as specified by the maxp table.
+// Returns false if the maxp table is missing.
+func (f *Font) NumGlyphs() (int, bool) {
+	if f.maxp == nil {
+		return 0, false
+	}
+	return int(f.maxp.numGlyphs), true
+}
+
+// UnitsPerEm returns the number of font design units per em as specified by the head table.
+// Returns false if the head table is missing.
+func (f *Font) UnitsPerEm() (int, bool) {
+	if f.head == nil {
+		return 0, false
+	}
+	return int(f.head.unitsPerEm), true
+}
+
+// BoundingBox returns the bounding box of all glyphs in `f` as specified by the head table.
+// Returns false if the head table is missing.
+func (f *Font) BoundingBox() (BBox, bool) {
+	if f.head == nil {
+		return BBox{}, false
+	}
+	return BBox{
+		XMin: int(f.head.xMin),
+		YMin: int(f.head.yMin),
+		XMax: int(f.head.xMax),
+		YMax: int(f.head.yMax),
+	}, true
+}
+
+// Ascent returns the typographic ascent of `f` as specified by the hhea table.
+// Returns false if the hhea table is missing.
+func (f *Font) Ascent() (int, bool) {
+	if f.hhea == nil {
+		return 0, false
+	}
+	return int(f.hhea.ascender), true
+}
+
+// Descent returns the typographic descent of `f` as specified by the hhea table. The value is
+// typically negative as it is measured from the baseline.
+// Returns false if the hhea table is missing.
+func (f *Font) Descent() (int, bool) {
+	if f.hhea == nil {
+		return 0, false
+	}
+	return int(f.hhea.descender), true
+}
+
+// LineGap returns the typographic line gap of `f` as specified by the hhea table.
+// Returns false if the hhea table is missing.
+func (f *Font) LineGap() (int, bool) {
+	if f.hhea == nil {
+		return 0, false
+	}
+	return int(f.hhea.lineGap), true
+}
+
+// TypoAscender returns the typographic ascender of `f` as specified by the OS/2 table.
+// Returns false if the OS/2 table is missing.
+func (f *Font) TypoAscender() (int, bool) {
+	if f.os2 == nil {
+		return 0, false
+	}
+	return int(f.os2.sTypoAscender), true
+}
+
+// TypoDescender returns the typographic descender of `f` as specified by the OS/2 table.
+// Returns false if the OS/2 table is missing.
+func (f *Font) TypoDescender() (int, bool) {
+	if f.os2 == nil {
+		return 0, false
+	}
+	return int(f.os2.sTypoDescender), true
+}
+
+// CapHeight returns the height of capital letters of `f` as specified by the OS/2 table.
+// Returns false if the OS/2 table is missing or older than version 2.
+func (f *Font) CapHeight() (int, bool) {
+	if f.os2 == nil || f.os2.version < 2 {
+		return 0, false
+	}
+	return int(f.os2.sCapHeight), true
+}
+
+// XHeight returns the height of lowercase letters of `f` as specified by the OS/2 table.
+// Returns false if the OS/2 table is missing or older than version 2.
+func (f *Font) XHeight() (int, bool) {
+	if f.os2 == nil || f.os2.version < 2 {
+		return 0, false
+	}
+	return int(f.os2.sxHeight), true
+}
+
+// EstimateCapHeight returns the height of capital letters of `f` in font design units measured from the
+// outlines, for fonts whose OS/2 table is missing or has no sCapHeight, see CapHeight. The height is the top
+// of the glyph of 'H', or of 'I' if 'H' is not covered. If neither glyph has an outline, 0.7 em is returned.
+func (f *Font) EstimateCapHeight() int {
+	return f.estimateHeight("HI", 0.7)
+}
+
+// EstimateXHeight returns the height of lowercase letters of `f` in font design units measured from the
+// outlines, for fonts whose OS/2 table is missing or has no sxHeight, see XHeight. The height is the top of
+// the glyph of 'x', or of 'o' if 'x' is not covered. If neither glyph has an outline, 0.5 em is returned.
+func (f *Font) EstimateXHeight() int {
+	return f.estimateHeight("xo", 0.5)
+}
+
+// estimateHeight returns the top of the glyph of the first of `probes` with an outline, or `emFraction` of
+// the units per em if there is none. Returns 0 if there is neither a probe glyph nor a head table.
+func (f *Font) estimateHeight(probes string, emFraction float64) int {
+	for _, r := range probes {
+		gid, has := f.LookupRune(r)
+		if !has || gid == 0 {
+			continue
+		}
+		o, err := f.GlyphOutline(gid)
+		if err != nil {
+			continue
+		}
+		b, has := o.Bounds()
+		if !has {
+			continue
+		}
+		return b.YMax
+	}
+	if f.head == nil {
+		return 0
+	}
+	return int(math.Floor(emFraction*float64(f.head.unitsPerEm) + 0.5))
+}
+
+// PostIsFixedPitch returns true if the post table of `f` declares the font as monospaced. The flag is wrong
+// in many fonts, see IsMonospace for a more reliable answer.
+func (f *Font) PostIsFixedPitch() bool {
+	return f.post != nil && f.post.isFixedPitch != 0
+}
+
+// IsMonospace returns true if `f` is a monospaced font. The evidence of the isFixedPitch flag of the post
+// table, the PANOSE proportion of the OS/2 table (for Latin text fonts) and of the advance widths of the
+// glyphs of the printable ASCII characters is combined as follows:
+//   - If the advance widths differ, the font is not monospaced regardless of its flags.
+//   - Otherwise each piece of evidence available votes for or against monospace and the majority decides.
+//     A tie is broken by the advance widths, or is decided against monospace if there are fewer than two
+//     printable ASCII glyphs to compare.
+func (f *Font) IsMonospace() bool {
+	var votes int
+	vote := func(mono bool) {
+		if mono {
+			votes++
+		} else {
+			votes--
+		}
+	}
+
+	if f.post != nil {
+		vote(f.post.isFixedPitch != 0)
+	}
+	if f.os2 != nil && len(f.os2.panose10) == 10 && f.os2.panose10[0] == 2 && f.os2.panose10[3] > 1 {
+		// PANOSE proportion 0 and 1 are Any and No Fit, 9 is Monospaced.
+		vote(f.os2.panose10[3] == 9)
+	}
+
+	equal, has := f.asciiAdvancesEqual()
+	if !has {
+		return votes > 0
+	}
+	if !equal {
+		return false
+	}
+	vote(true)
+	return votes >= 0
+}
+
+// asciiAdvancesEqual returns true if the glyphs of the printable ASCII characters covered by `f` have the same
+// advance width, ignoring glyphs with zero advance. Returns false as second value if there are fewer than two
+// such glyphs.
+func (f *Font) asciiAdvancesEqual() (equal bool, has bool) {
+	if f.hmtx == nil {
+		return false, false
+	}
+	var advance uint16
+	count := 0
+	for r := rune(0x20); r <= 0x7E; r++ {
+		gid, has := f.LookupRune(r)
+		if !has || gid == 0 {
+			continue
+		}
+		adv := f.hmtx.getMetric(gid).advanceWidth
+		if adv == 0 {
+			continue
+		}
+		if count > 0 && adv != advance {
+			return false, true
+		}
+		advance = adv
+		count++
+	}
+	return true, count >= 2
+}
+
+// GlyphAdvance returns the advance width of glyph `gid` in font design units as specified by the
+// hmtx table. Glyphs beyond numberOfHMetrics share the advance width of the last full metric.
+// An error is returned if the hmtx table is missing or `gid` is out of range.
+func (f *Font) GlyphAdvance(gid GlyphIndex) (uint16, error) {
+	lhm, err := f.glyphMetric(gid)
+	if err != nil {
+		return 0, err
+	}
+	return lhm.advanceWidth, nil
+}
+
+// GlyphLSB returns the left side bearing of glyph `gid` in font design units as specified by the
+// hmtx table. An error is returned if the hmtx table is missing or `gid` is out of range.
+func (f *Font) GlyphLSB(gid GlyphIndex) (int16, error) {
+	lhm, err := f.glyphMetric(gid)
+	if err != nil {
+		return 0, err
+	}
+	return lhm.lsb, nil
+}
+
+// glyphMetric returns the horizontal metric of glyph `gid` with bounds checking.
+func (f *Font) glyphMetric(gid GlyphIndex) (longHorMetric, error) {
+	if f.hmtx == nil {
+		logger.Debugf("hmtx table missing")
+		return longHorMetric{}, ErrRequiredTableMissing{Tag: "hmtx"}
+	}
+	if int(gid) >= f.hmtx.numGlyphs() {
+		logger.Debugf("GID out of range: %d >= %d", gid, f.hmtx.numGlyphs())
+		return longHorMetric{}, errRangeCheck
+	}
+	return f.hmtx.getMetric(gid), nil
+}
+
+// GlyphBBox returns the bounding box of glyph `gid` in font design units as specified by the glyf table.
+// The bounding box of a composite glyph is computed by combining the bounding boxes of its components,
+// transformed as specified by the composite glyph.
+// Glyphs without an outline, such as space, give a zero bounding box with `empty` set to true.
+// An error is returned if the glyf table is missing or `gid` is out of range.
+func (f *Font) GlyphBBox(gid GlyphIndex) (xMin, yMin, xMax, yMax int16, empty bool, err error) {
+	if f.glyf == nil {
+		logger.Debugf("glyf table missing")
+		return 0, 0, 0, 0, false, ErrRequiredTableMissing{Tag: "glyf"}
+	}
+
+	b, has, err := f.glyf.bounds(gid, 0)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	if !has {
+		return 0, 0, 0, 0, true, nil
+	}
+
+	xMin, yMin, xMax, yMax = b.rounded()
+	return xMin, yMin, xMax, yMax, false, nil
+}
+
+// GlyphVerticalAdvance returns the advance height of glyph `gid` in font design units as specified by
+// the vmtx table, for vertical writing. Glyphs beyond numOfLongVerMetrics share the advance height of the
+// last full metric.
+// An error is returned if the font has no vertical metrics or `gid` is out of range.
+func (f *Font) GlyphVerticalAdvance(gid GlyphIndex) (uint16, error) {
+	lvm, err := f.glyphVerticalMetric(gid)
+	if err != nil {
+		return 0, err
+	}
+	return lvm.advanceHeight, nil
+}
+
+// GlyphTSB returns the top side bearing of glyph `gid` in font design units as specified by the
+// vmtx table. An error is returned if the font has no vertical metrics or `gid` is out of range.
+func (f *Font) GlyphTSB(gid GlyphIndex) (int16, error) {
+	lvm, err := f.glyphVerticalMetric(gid)
+	if err != nil {
+		return 0, err
+	}
+	return lvm.tsb, nil
+}
+
+// glyphVerticalMetric returns the vertical metric of glyph `gid` with bounds checking.
+func (f *Font) glyphVerticalMetric(gid GlyphIndex) (longVerMetric, error) {
+	if f.vmtx == nil {
+		logger.Debugf("vmtx table missing")
+		return longVerMetric{}, ErrRequiredTableMissing{Tag: "vmtx"}
+	}
+	if int(gid) >= f.vmtx.numGlyphs() {
+		logger.Debugf("GID out of range: %d >= %d", gid, f.vmtx.numGlyphs())
+		return longVerMetric{}, errRangeCheck
+	}
+	return f.vmtx.getMetric(gid), nil
+}
+
+// MeasureOptions controls the measuring of text by MeasureTextWithOptions and MeasureGlyphsWithOptions.
+type MeasureOptions struct {
+	// Kerning applies the kerning adjustments between consecutive glyphs, see KernPair.
+	Kerning bool
+}
+
+// MeasureText returns the width of `s` in font design units as the sum of the advance widths of the glyphs
+// that the runes of `s` map to, see LookupRune. No shaping is done, so the width is exact for simple text such
+// as Latin without kerning but not for complex scripts. Runes not covered by `f` are measured with the notdef
+// glyph, as they are rendered, and returned in `missing` in order of first occurrence.
+// An error is returned if the hmtx table is missing.
+func (f *Font) MeasureText(s string) (width int64, missing []rune, err error) {
+	return f.MeasureTextWithOptions(s, MeasureOptions{})
+}
+
+// MeasureTextWithOptions measures `s` as MeasureText with the options `opts`.
+func (f *Font) MeasureTextWithOptions(s string, opts MeasureOptions) (width int64, missing []rune, err error) {
+	indices, missing := f.LookupRunes([]rune(s))
+	width, err = f.MeasureGlyphsWithOptions(indices, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	return width, missing, nil
+}
+
+// MeasureGlyphs returns the width in font design units of the glyphs `gids`, e.g. glyphs resolved from the
+// text beforehand, as the sum of their advance widths.
+// An error is returned if the hmtx table is missing or a glyph index is out of range.
+func (f *Font) MeasureGlyphs(gids []GlyphIndex) (int64, error) {
+	return f.MeasureGlyphsWithOptions(gids, MeasureOptions{})
+}
+
+// MeasureGlyphsWithOptions measures `gids` as MeasureGlyphs with the options `opts`.
+func (f *Font) MeasureGlyphsWithOptions(gids []GlyphIndex, opts MeasureOptions) (int64, error) {
+	var width int64
+	for i, gid := range gids {
+		lhm, err := f.glyphMetric(gid)
+		if err != nil {
+			return 0, err
+		}
+		width += int64(lhm.advanceWidth)
+		if opts.Kerning && i > 0 {
+			if value, has := f.KernPair(gids[i-1], gid); has {
+				width += int64(value)
+			}
+		}
+	}
+	return width, nil
+}
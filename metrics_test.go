@@ -0,0 +1,323 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	type metric struct {
+		val int
+		ok  bool
+	}
+	m := func(val int, ok bool) metric {
+		return metric{val, ok}
+	}
+
+	testcases := []struct {
+		fontPath string
+		expected map[string]metric
+		bbox     BBox
+	}{
+		{
+			"./testdata/FreeSans.ttf",
+			map[string]metric{
+				"numGlyphs":     {3726, true},
+				"unitsPerEm":    {1000, true},
+				"ascent":        {800, true},
+				"descent":       {-200, true},
+				"lineGap":       {90, true},
+				"typoAscender":  {800, true},
+				"typoDescender": {-200, true},
+				"capHeight":     {0, false}, // OS/2 version 1.
+				"xHeight":       {0, false},
+			},
+			BBox{XMin: -631, YMin: -462, XMax: 1632, YMax: 1230},
+		},
+		{
+			"./testdata/roboto/Roboto-Bold.ttf",
+			map[string]metric{
+				"numGlyphs":  {1294, true},
+				"unitsPerEm": {2048, true},
+				"ascent":     {1900, true},
+				"descent":    {-500, true},
+				"lineGap":    {0, true},
+				"capHeight":  {1456, true},
+				"xHeight":    {1082, true},
+			},
+			BBox{XMin: -1488, YMin: -555, XMax: 2439, YMax: 2163},
+		},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+
+			actual := map[string]metric{
+				"numGlyphs":     m(fnt.NumGlyphs()),
+				"unitsPerEm":    m(fnt.UnitsPerEm()),
+				"ascent":        m(fnt.Ascent()),
+				"descent":       m(fnt.Descent()),
+				"lineGap":       m(fnt.LineGap()),
+				"typoAscender":  m(fnt.TypoAscender()),
+				"typoDescender": m(fnt.TypoDescender()),
+				"capHeight":     m(fnt.CapHeight()),
+				"xHeight":       m(fnt.XHeight()),
+			}
+			for name, expected := range tcase.expected {
+				assert.Equal(t, expected, actual[name], name)
+			}
+
+			bbox, ok := fnt.BoundingBox()
+			assert.True(t, ok)
+			assert.Equal(t, tcase.bbox, bbox)
+		})
+	}
+
+	// Missing tables give zero values.
+	fnt := &Font{font: &font{}}
+	for _, fn := range []func() (int, bool){
+		fnt.NumGlyphs, fnt.UnitsPerEm, fnt.Ascent, fnt.Descent, fnt.LineGap,
+		fnt.TypoAscender, fnt.TypoDescender, fnt.CapHeight, fnt.XHeight,
+	} {
+		assert.Equal(t, metric{0, false}, m(fn()))
+	}
+	bbox, ok := fnt.BoundingBox()
+	assert.False(t, ok)
+	assert.Equal(t, BBox{}, bbox)
+}
+
+func TestEstimateHeights(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	// Measured as specified by the OS/2 table.
+	assert.Equal(t, 1456, fnt.EstimateCapHeight())
+	assert.Equal(t, 1082, fnt.EstimateXHeight())
+
+	fnt, err = ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gid, _ := fnt.LookupRune('H')
+	_, _, _, yMax, _, err := fnt.GlyphBBox(gid)
+	require.NoError(t, err)
+	assert.Equal(t, int(yMax), fnt.EstimateCapHeight())
+	gid, _ = fnt.LookupRune('x')
+	_, _, _, yMax, _, err = fnt.GlyphBBox(gid)
+	require.NoError(t, err)
+	assert.Equal(t, int(yMax), fnt.EstimateXHeight())
+
+	// Without probe glyphs the heights are fractions of the em.
+	fnt = &Font{font: &font{head: &headTable{unitsPerEm: 2048}}}
+	assert.Equal(t, 1434, fnt.EstimateCapHeight())
+	assert.Equal(t, 1024, fnt.EstimateXHeight())
+	fnt = &Font{font: &font{}}
+	assert.Equal(t, 0, fnt.EstimateCapHeight())
+}
+
+func TestIsMonospace(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	assert.False(t, fnt.PostIsFixedPitch())
+	assert.False(t, fnt.IsMonospace())
+
+	// A proportional font claiming to be monospaced.
+	lying := &Font{font: fnt.font.clone()}
+	lying.post.isFixedPitch = 1
+	copy(lying.os2.panose10, []uint8{2, 11, 5, 9})
+	assert.True(t, lying.PostIsFixedPitch())
+	assert.False(t, lying.IsMonospace())
+
+	// Equal advances for the printable ASCII glyphs.
+	mono := &Font{font: &font{
+		post: &postTable{},
+		os2:  &os2Table{panose10: make([]uint8, 10)},
+		hmtx: &hmtxTable{hMetrics: []longHorMetric{{advanceWidth: 500}, {advanceWidth: 600}, {advanceWidth: 600}}},
+	}}
+	require.NoError(t, mono.SetCmapFromMap(map[rune]GlyphIndex{'a': 1, 'b': 2}))
+
+	// The post flag votes against, PANOSE Any does not vote: the tie is broken by the advance widths.
+	assert.True(t, mono.IsMonospace())
+	// PANOSE proportional and the post flag outvote the advance widths.
+	mono.os2.panose10 = []uint8{2, 11, 5, 3, 0, 0, 0, 0, 0, 0}
+	assert.False(t, mono.IsMonospace())
+	mono.post.isFixedPitch = 1
+	assert.True(t, mono.IsMonospace())
+
+	// Without glyphs to compare the declarations must agree.
+	mono.hmtx = nil
+	assert.False(t, mono.IsMonospace())
+	mono.os2.panose10[3] = 9
+	assert.True(t, mono.IsMonospace())
+	mono.post = nil
+	assert.True(t, mono.IsMonospace())
+	mono.os2 = nil
+	assert.False(t, mono.IsMonospace())
+}
+
+func TestGlyphAdvance(t *testing.T) {
+	fnt := &Font{font: &font{
+		maxp: &maxpTable{numGlyphs: 7},
+		hhea: &hheaTable{numberOfHMetrics: 5},
+		hmtx: &hmtxTable{
+			hMetrics: []longHorMetric{
+				{advanceWidth: 10, lsb: 1},
+				{advanceWidth: 20, lsb: 2},
+				{advanceWidth: 30, lsb: 3},
+				{advanceWidth: 30, lsb: 4},
+				{advanceWidth: 30, lsb: 5},
+			},
+			leftSideBearings: []int16{6, 7},
+		},
+	}}
+	expAdvances := []uint16{10, 20, 30, 30, 30, 30, 30}
+	expLSBs := []int16{1, 2, 3, 4, 5, 6, 7}
+
+	check := func() {
+		for i := range expAdvances {
+			gid := GlyphIndex(i)
+			advance, err := fnt.GlyphAdvance(gid)
+			require.NoError(t, err)
+			assert.Equal(t, expAdvances[i], advance, "gid %d", gid)
+
+			lsb, err := fnt.GlyphLSB(gid)
+			require.NoError(t, err)
+			assert.Equal(t, expLSBs[i], lsb, "gid %d", gid)
+		}
+
+		_, err := fnt.GlyphAdvance(7)
+		assert.Equal(t, errRangeCheck, err)
+		_, err = fnt.GlyphLSB(7)
+		assert.Equal(t, errRangeCheck, err)
+	}
+
+	check()
+	// Same metrics once the hmtx table is compacted.
+	fnt.optimizeHmtx()
+	require.Len(t, fnt.hmtx.hMetrics, 3)
+	check()
+
+	fnt.hmtx = nil
+	_, err := fnt.GlyphAdvance(0)
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "hmtx"}, err)
+}
+
+func TestGlyphBBox(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	cmap := fnt.GetCmap(3, 1)
+	xMin, yMin, xMax, yMax, empty, err := fnt.GlyphBBox(cmap['A'])
+	require.NoError(t, err)
+	assert.False(t, empty)
+	assert.Equal(t, []int16{17, 0, 653, 729}, []int16{xMin, yMin, xMax, yMax})
+
+	_, _, _, _, empty, err = fnt.GlyphBBox(cmap[' '])
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	// The bounding boxes of composite glyphs resolved from their components agree with the glyph headers.
+	gid := cmap['é']
+	require.NoError(t, fnt.glyf.descs[gid].parse())
+	require.False(t, fnt.glyf.descs[gid].IsSimple())
+	h := fnt.glyf.descs[gid].header
+	xMin, yMin, xMax, yMax, empty, err = fnt.GlyphBBox(gid)
+	require.NoError(t, err)
+	assert.False(t, empty)
+	assert.Equal(t, []int16{h.xMin, h.yMin, h.xMax, h.yMax}, []int16{xMin, yMin, xMax, yMax})
+
+	_, _, _, _, _, err = fnt.GlyphBBox(GlyphIndex(len(fnt.glyf.descs)))
+	assert.Equal(t, errRangeCheck, err)
+
+	// Transformed components.
+	fnt.glyf = &glyfTable{
+		descs: []*glyphDescription{
+			{raw: nil},
+			{raw: []byte{0, 1, 0, 0, 0, 0, 0, 100, 0, 200}}, // simple glyph, bbox (0,0,100,200).
+			{raw: []byte{
+				0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0,
+				// Scaled by 0.5 and offset by (50,-10).
+				0x00, 0x2B, 0, 1, 0x00, 0x32, 0xFF, 0xF6, 0x20, 0x00,
+				// Rotated by 90 degrees.
+				0x00, 0x83, 0, 1, 0, 0, 0, 0, 0x00, 0x00, 0x40, 0x00, 0xC0, 0x00, 0x00, 0x00,
+			}},
+		},
+	}
+	xMin, yMin, xMax, yMax, empty, err = fnt.GlyphBBox(2)
+	require.NoError(t, err)
+	assert.False(t, empty)
+	assert.Equal(t, []int16{-200, -10, 100, 100}, []int16{xMin, yMin, xMax, yMax})
+
+	_, _, _, _, empty, err = fnt.GlyphBBox(0)
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	fnt.glyf = nil
+	_, _, _, _, _, err = fnt.GlyphBBox(0)
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "glyf"}, err)
+}
+
+func TestMeasureText(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	var expected int64
+	for _, r := range "AVATAR" {
+		gid, has := fnt.LookupRune(r)
+		require.True(t, has)
+		advance, err := fnt.GlyphAdvance(gid)
+		require.NoError(t, err)
+		expected += int64(advance)
+	}
+	width, missing, err := fnt.MeasureText("AVATAR")
+	require.NoError(t, err)
+	assert.Equal(t, expected, width)
+	assert.Empty(t, missing)
+
+	// Kerning adjustments.
+	gidA, _ := fnt.LookupRune('A')
+	gidV, _ := fnt.LookupRune('V')
+	kernAV, has := fnt.KernPair(gidA, gidV)
+	require.True(t, has)
+	kernVA, _ := fnt.KernPair(gidV, gidA)
+	width, _, err = fnt.MeasureTextWithOptions("AVA", MeasureOptions{Kerning: true})
+	require.NoError(t, err)
+	unkerned, _, err := fnt.MeasureText("AVA")
+	require.NoError(t, err)
+	assert.Equal(t, unkerned+int64(kernAV)+int64(kernVA), width)
+
+	// Missing runes are measured with notdef.
+	notdef, err := fnt.GlyphAdvance(0)
+	require.NoError(t, err)
+	width, missing, err = fnt.MeasureText("A中A中")
+	require.NoError(t, err)
+	advanceA, _ := fnt.GlyphAdvance(gidA)
+	assert.Equal(t, 2*int64(advanceA)+2*int64(notdef), width)
+	assert.Equal(t, []rune("中"), missing)
+
+	width, missing, err = fnt.MeasureText("")
+	require.NoError(t, err)
+	assert.Zero(t, width)
+	assert.Empty(t, missing)
+
+	// Pre-resolved glyphs.
+	width, err = fnt.MeasureGlyphs([]GlyphIndex{gidA, gidV})
+	require.NoError(t, err)
+	advanceV, _ := fnt.GlyphAdvance(gidV)
+	assert.Equal(t, int64(advanceA)+int64(advanceV), width)
+	width, err = fnt.MeasureGlyphsWithOptions([]GlyphIndex{gidA, gidV}, MeasureOptions{Kerning: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(advanceA)+int64(advanceV)+int64(kernAV), width)
+	_, err = fnt.MeasureGlyphs([]GlyphIndex{GlyphIndex(fnt.maxp.numGlyphs)})
+	assert.Equal(t, errRangeCheck, err)
+
+	fnt.hmtx = nil
+	_, _, err = fnt.MeasureText("A")
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "hmtx"}, err)
+}
@@ -0,0 +1,79 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// maxMmapSize is the maximum size of files mapped into memory.
+const maxMmapSize = 1 << 30
+
+// ParseFileMmap parses the font from the file `filePath` mapped into memory instead of being read into the heap,
+// as for servers keeping many large fonts open. The font is parsed with ParseOptions.LazyGlyphs and the glyph
+// data is referenced from the mapping without copying. The font is parsed by ParseFile if memory mapping is not
+// supported on the platform or fails, and for fonts other than TrueType and OpenType fonts, such as WOFF.
+//
+// Close must be called to unmap the file once the font is no longer needed. The Font, the fonts derived from it
+// such as by Subset or MergeFonts, and the data returned by their methods must not be used after Close, as the
+// glyph data may reference the mapping. The file must not be modified while mapped.
+func ParseFileMmap(filePath string) (*Font, error) {
+	data, unmap, err := mmapFile(filePath)
+	if err != nil {
+		logger.Debugf("Unable to map %s, reading it: %v", filePath, err)
+		return ParseFile(filePath)
+	}
+	if len(data) < 4 {
+		unmap()
+		return ParseFile(filePath)
+	}
+	switch sniffFormat(binary.BigEndian.Uint32(data)) {
+	case fontFormatTrueType, fontFormatCFF:
+	default:
+		unmap()
+		return ParseFile(filePath)
+	}
+
+	r := newByteReader(bytes.NewReader(data))
+	r.mapped = data
+	fnt, err := parseFontWithOptions(r, ParseOptions{LazyGlyphs: true})
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	f := newParsedFont(r, fnt)
+	f.unmap = unmap
+	return f, nil
+}
+
+// Close unmaps the file of `f` parsed by ParseFileMmap. The Font must not be used after Close, see ParseFileMmap.
+// Close does nothing for fonts that are not memory mapped and when called again.
+func (f *Font) Close() error {
+	if f.unmap == nil {
+		return nil
+	}
+	unmap := f.unmap
+	f.unmap = nil
+	// Glyph data not read yet fails to load rather than accessing the unmapped data.
+	f.br.detach()
+	return unmap()
+}
+
+// mmapSize returns the size of file `f` for mapping it into memory.
+func mmapSize(f *os.File) (int, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	if size <= 0 || size > maxMmapSize {
+		return 0, errors.New("file size not supported for mapping")
+	}
+	return int(size), nil
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import "errors"
+
+// mmapFile returns an error as memory mapping files is not supported on this platform.
+func mmapFile(path string) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory mapping not supported")
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileMmap(t *testing.T) {
+	ref, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err := ParseFileMmap("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	for _, r := range "AÅ×" {
+		gid, has := fnt.LookupRune(r)
+		require.True(t, has)
+		o, err := fnt.GlyphOutline(gid)
+		require.NoError(t, err)
+		expected, err := ref.GlyphOutline(gid)
+		require.NoError(t, err)
+		assert.Equal(t, expected, o)
+	}
+	head, err := fnt.TableBytes("head")
+	require.NoError(t, err)
+	expected, err := ref.TableBytes("head")
+	require.NoError(t, err)
+	assert.Equal(t, expected, head)
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	refData, err := ref.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, refData, data)
+
+	require.NoError(t, fnt.Close())
+	require.NoError(t, fnt.Close())
+	require.NoError(t, ref.Close())
+
+	// Glyphs not loaded before closing fail to load.
+	fnt, err = ParseFileMmap("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	if runtime.GOOS == "linux" {
+		assert.NotNil(t, fnt.br.mapped)
+	}
+	require.NoError(t, fnt.Close())
+	gid, _ := ref.LookupRune('A')
+	_, err = fnt.GlyphOutline(gid)
+	assert.Error(t, err)
+
+	t.Run("Fallback", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "unitype")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		// WOFF fonts are parsed by ParseFile.
+		path := filepath.Join(dir, "font.woff")
+		require.NoError(t, ref.WriteWOFFFile(path))
+		fnt, err := ParseFileMmap(path)
+		require.NoError(t, err)
+		assert.Equal(t, ref.FamilyName(), fnt.FamilyName())
+		require.NoError(t, fnt.Close())
+
+		// Empty files cannot be mapped.
+		path = filepath.Join(dir, "empty.ttf")
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+		_, err = ParseFileMmap(path)
+		assert.Error(t, err)
+
+		_, err = ParseFileMmap(filepath.Join(dir, "missing.ttf"))
+		assert.Error(t, err)
+	})
+}
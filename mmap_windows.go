@@ -0,0 +1,45 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
+)
+
+// mmapFile maps the file `path` read-only into memory and returns the mapped data along with the function
+// unmapping it.
+func mmapFile(path string) ([]byte, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	size, err := mmapSize(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := syscall.CreateFileMapping(syscall.Handle(f.Fd()), nil, syscall.PAGE_READONLY, 0, uint32(size), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The view keeps the mapping open.
+	defer syscall.CloseHandle(h)
+
+	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, nil, err
+	}
+	var data []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&data))
+	hdr.Data, hdr.Len, hdr.Cap = addr, size, size
+	return data, func() error {
+		return syscall.UnmapViewOfFile(addr)
+	}, nil
+}
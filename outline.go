@@ -0,0 +1,588 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// GlyphPoint is a point of a glyph outline in font design units. Off-curve points are the control points of
+// quadratic Bézier curves, two consecutive off-curve points imply an on-curve point midway between them.
+type GlyphPoint struct {
+	X       float64
+	Y       float64
+	OnCurve bool
+}
+
+// GlyphContour is a closed contour of a glyph outline, the last point connects to the first.
+type GlyphContour []GlyphPoint
+
+// GlyphOutline is the outline of a glyph as a list of contours.
+type GlyphOutline struct {
+	Contours []GlyphContour
+}
+
+// NumPoints returns the number of points of `o`.
+func (o *GlyphOutline) NumPoints() int {
+	n := 0
+	for _, c := range o.Contours {
+		n += len(c)
+	}
+	return n
+}
+
+// Bounds returns the bounding box of the points of `o`, rounded outwards to integer font design units.
+// Returns false if `o` has no points.
+func (o *GlyphOutline) Bounds() (BBox, bool) {
+	var b glyphBounds
+	has := false
+	for _, c := range o.Contours {
+		for _, p := range c {
+			pb := glyphBounds{xMin: p.X, yMin: p.Y, xMax: p.X, yMax: p.Y}
+			if !has {
+				b, has = pb, true
+				continue
+			}
+			b = b.union(pb)
+		}
+	}
+	if !has {
+		return BBox{}, false
+	}
+	xMin, yMin, xMax, yMax := b.rounded()
+	return BBox{XMin: int(xMin), YMin: int(yMin), XMax: int(xMax), YMax: int(yMax)}, true
+}
+
+// GlyphOutline returns the outline of glyph `gid` as specified by the glyf table. Composite glyphs are resolved
+// by combining the outlines of their components, transformed and positioned as specified by the component
+// records, either by offsets or by matching points. The points of composite glyphs may have fractional
+// coordinates where the components are scaled.
+// Glyphs without an outline, such as space, give an outline with no contours.
+// An error is returned if the glyf table is missing, `gid` is out of range or the glyph data is invalid.
+func (f *Font) GlyphOutline(gid GlyphIndex) (*GlyphOutline, error) {
+	if f.glyf == nil {
+		logger.Debugf("glyf table missing")
+		return nil, ErrRequiredTableMissing{Tag: "glyf"}
+	}
+	return f.glyf.outline(gid, 0)
+}
+
+// outline returns the outline of glyph `gid`, resolving composite glyphs recursively.
+func (glyf *glyfTable) outline(gid GlyphIndex, depth int) (*GlyphOutline, error) {
+	if int(gid) >= len(glyf.descs) {
+		logger.Debugf("GID out of range (%d >= %d)", gid, len(glyf.descs))
+		return nil, errRangeCheck
+	}
+	if depth > maxComponentDepth {
+		logger.Debugf("Composite glyph nesting too deep (> %d)", maxComponentDepth)
+		return nil, errRangeCheck
+	}
+
+	gd := glyf.descs[gid]
+	if gd.size() == 0 {
+		return &GlyphOutline{}, nil
+	}
+	err := gd.parse()
+	if err != nil {
+		return nil, err
+	}
+	if gd.header.numberOfContours == 0 {
+		return &GlyphOutline{}, nil
+	}
+	if gd.IsSimple() {
+		return simpleGlyphOutline(gd.raw)
+	}
+	if gd.composite == nil {
+		return &GlyphOutline{}, nil
+	}
+
+	o := &GlyphOutline{}
+	var points []GlyphPoint // all points of the components so far, for point matching.
+	for _, comp := range gd.composite.components {
+		co, err := glyf.outline(GlyphIndex(comp.glyphIndex), depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		ma, mb, mc, md := comp.matrix()
+		for _, c := range co.Contours {
+			for i, p := range c {
+				c[i].X, c[i].Y = ma*p.X+mc*p.Y, mb*p.X+md*p.Y
+			}
+		}
+
+		flag := compositeGlyphFlag(comp.flags)
+		dx, dy, isOffset := comp.offset()
+		if isOffset {
+			if flag.IsSet(scaledComponentOffset) && !flag.IsSet(unscaledComponentOffset) {
+				dx, dy = ma*dx+mc*dy, mb*dx+md*dy
+			}
+			if flag.IsSet(roundXYToGrid) {
+				dx, dy = math.Floor(dx+0.5), math.Floor(dy+0.5)
+			}
+		} else {
+			// The arguments are the number of a point of the glyph so far and of a point of the component,
+			// the component is moved so that the points coincide.
+			parent, child := int(comp.argument1), int(comp.argument2)
+			if !flag.IsSet(arg1And2AreWords) {
+				parent, child = int(uint8(comp.argument1)), int(uint8(comp.argument2))
+			}
+			var childPoints []GlyphPoint
+			for _, c := range co.Contours {
+				childPoints = append(childPoints, c...)
+			}
+			if parent >= len(points) || child >= len(childPoints) {
+				logger.Debugf("Composite glyph %d matches points out of range (%d/%d, %d/%d)",
+					gid, parent, len(points), child, len(childPoints))
+				return nil, errRangeCheck
+			}
+			dx, dy = points[parent].X-childPoints[child].X, points[parent].Y-childPoints[child].Y
+		}
+
+		for _, c := range co.Contours {
+			for i := range c {
+				c[i].X += dx
+				c[i].Y += dy
+			}
+			points = append(points, c...)
+			o.Contours = append(o.Contours, c)
+		}
+	}
+	return o, nil
+}
+
+// simpleGlyphOutline returns the outline of the simple glyph description `data`.
+func simpleGlyphOutline(data []byte) (*GlyphOutline, error) {
+	g, err := decodeSimpleGlyph(data)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &GlyphOutline{}
+	start := 0
+	for _, endPt := range g.endPts {
+		end := int(endPt) + 1
+		if end <= start || end > len(g.points) {
+			logger.Debugf("Invalid contour end point %d (start %d, %d points)", endPt, start, len(g.points))
+			return nil, errRangeCheck
+		}
+		contour := make(GlyphContour, 0, end-start)
+		for _, p := range g.points[start:end] {
+			contour = append(contour, GlyphPoint{X: float64(p.x), Y: float64(p.y), OnCurve: p.onCurve})
+		}
+		o.Contours = append(o.Contours, contour)
+		start = end
+	}
+	return o, nil
+}
+
+// checkGlyphsEditable returns an error if the glyphs of `f` cannot be added or replaced, as `f` lacks the
+// tables required, has CFF outlines or is a variable font.
+func (f *Font) checkGlyphsEditable() error {
+	if f.cff != nil {
+		return ErrCFFOutlinesUnsupported
+	}
+	for _, t := range []struct {
+		tag     string
+		missing bool
+	}{
+		{"head", f.head == nil},
+		{"maxp", f.maxp == nil},
+		{"hhea", f.hhea == nil},
+		{"hmtx", f.hmtx == nil},
+		{"glyf", f.glyf == nil},
+	} {
+		if t.missing {
+			logger.Debugf("Editing glyphs requires the %s table", t.tag)
+			return ErrRequiredTableMissing{Tag: t.tag}
+		}
+	}
+	if f.gvar != nil || f.fvar != nil {
+		return errors.New("editing the glyphs of variable fonts is not supported")
+	}
+	return nil
+}
+
+// encodeOutline returns the simple glyph description of the outline `o`, with the coordinates rounded to
+// integers. Contours without points are skipped, nil outlines and outlines without points give an empty glyph.
+func encodeOutline(o *GlyphOutline) ([]byte, error) {
+	if o == nil {
+		return nil, nil
+	}
+	g := &simpleGlyph{}
+	for _, c := range o.Contours {
+		if len(c) == 0 {
+			continue
+		}
+		for _, p := range c {
+			x, y := math.Floor(p.X+0.5), math.Floor(p.Y+0.5)
+			if x < math.MinInt16 || x > math.MaxInt16 || y < math.MinInt16 || y > math.MaxInt16 {
+				logger.Debugf("Point out of range (%g,%g)", p.X, p.Y)
+				return nil, errRangeCheck
+			}
+			g.points = append(g.points, glyphPoint{x: int(x), y: int(y), onCurve: p.OnCurve})
+		}
+		if len(g.points) > math.MaxUint16 || len(g.endPts) == math.MaxInt16 {
+			logger.Debugf("Too many points or contours")
+			return nil, errRangeCheck
+		}
+		g.endPts = append(g.endPts, uint16(len(g.points)-1))
+	}
+	if len(g.points) == 0 {
+		return nil, nil
+	}
+	g.header.numberOfContours = int16(len(g.endPts))
+	g.header.xMin, g.header.yMin, g.header.xMax, g.header.yMax = g.bounds()
+	return g.encode(), nil
+}
+
+// AddGlyph appends a glyph with the outline `outline`, advance width `advance` and left side bearing `lsb` to
+// `f` and returns its GID, e.g. for adding a check mark to a subset font. The coordinates are in font design
+// units and rounded to integers; a nil outline or an outline without points gives an empty glyph such as a
+// space. The glyph has no hinting instructions and no glyph name. The hmtx, vmtx, maxp, head and hhea tables are
+// updated, the tables depending on the number of glyphs (hdmx, LTSH, sbix) are dropped. The glyph is not mapped by
+// the cmap, see AddGlyphForRune.
+// An error is returned if `f` has no glyf outlines, ErrCFFOutlinesUnsupported for CFF outlines, or is a variable font.
+func (f *Font) AddGlyph(outline *GlyphOutline, advance uint16, lsb int16) (GlyphIndex, error) {
+	err := f.checkGlyphsEditable()
+	if err != nil {
+		return 0, err
+	}
+	numGlyphs := int(f.maxp.numGlyphs)
+	if numGlyphs != len(f.glyf.descs) || numGlyphs >= math.MaxUint16 {
+		logger.Debugf("Unable to add glyph to %d glyphs (%d glyph descriptions)", numGlyphs, len(f.glyf.descs))
+		return 0, errRangeCheck
+	}
+	raw, err := encodeOutline(outline)
+	if err != nil {
+		return 0, err
+	}
+	gid := GlyphIndex(numGlyphs)
+
+	// The tables are updated on a copy of `f` that is committed once all of them are built, so that `f` is left
+	// unchanged on error. The tables modified in place are cloned, the others replaced.
+	nf := *f.font
+	nf.head = f.head.Clone()
+	nf.hhea = f.hhea.Clone()
+	nf.maxp = f.maxp.Clone()
+	nf.vhea = f.vhea.Clone()
+
+	// The glyph descriptions may be shared with other fonts, so replace rather than modify them.
+	nf.glyf = &glyfTable{descs: append(append([]*glyphDescription(nil), f.glyf.descs...), &glyphDescription{raw: raw})}
+	nf.maxp.numGlyphs++
+
+	hmtx := &hmtxTable{hMetrics: make([]longHorMetric, 0, numGlyphs+1)}
+	for i := 0; i < numGlyphs; i++ {
+		hmtx.hMetrics = append(hmtx.hMetrics, f.hmtx.getMetric(GlyphIndex(i)))
+	}
+	nf.hmtx = hmtx
+	nf.hmtx.hMetrics = append(nf.hmtx.hMetrics, longHorMetric{advanceWidth: advance, lsb: lsb})
+	nf.hhea.numberOfHMetrics = uint16(numGlyphs + 1)
+	nf.optimizeHmtx()
+
+	if f.vhea != nil && f.vmtx != nil {
+		vmtx := &vmtxTable{vMetrics: make([]longVerMetric, 0, numGlyphs+1)}
+		for i := 0; i < numGlyphs; i++ {
+			vmtx.vMetrics = append(vmtx.vMetrics, f.vmtx.getMetric(GlyphIndex(i)))
+		}
+		// Vertically the glyph is set on an em box from the ascender.
+		vm := longVerMetric{advanceHeight: nf.head.unitsPerEm}
+		if b, has := outline.Bounds(); has {
+			vm.tsb = int16(int(nf.vhea.vertTypoAscender) - b.YMax)
+		}
+		nf.vmtx = vmtx
+		nf.vmtx.vMetrics = append(nf.vmtx.vMetrics, vm)
+		nf.vhea.numOfLongVerMetrics = uint16(numGlyphs + 1)
+		nf.optimizeVmtx()
+	}
+
+	namesChanged := false
+	if f.post != nil && len(f.post.glyphNames) > 0 {
+		post := f.post.Clone()
+		names := make([]GlyphName, numGlyphs+1)
+		copy(names, post.glyphNames)
+		post.glyphNames = names
+		post.glyphNameIndex = nil
+		post.offsets = nil
+		nf.post = post
+		namesChanged = true
+	}
+
+	err = nf.updateLocaFormat()
+	if err != nil {
+		return 0, err
+	}
+	nf.updateHeadBBox()
+	nf.recomputeMaxp()
+	nf.recomputeHhea()
+	nf.pruneGlyphCountTables()
+
+	*f.font = nf
+	f.markDirty()
+	if namesChanged {
+		f.resetGlyphNameMap()
+	}
+	return gid, nil
+}
+
+// SetGlyph replaces the outline and the metrics of glyph `gid` of `f` by `outline`, advance width `advance` and
+// left side bearing `lsb`, e.g. for replacing a glyph of a subset font. The outline is encoded as by AddGlyph, a
+// nil outline gives an empty glyph such as a space. The hinting instructions of the glyph are removed. Composite
+// glyphs using `gid` as component use the new outline. The maxp, head and hhea tables are updated.
+// An error is returned if `gid` is out of range, if `f` has no glyf outlines, ErrCFFOutlinesUnsupported for CFF
+// outlines, or is a variable font.
+func (f *Font) SetGlyph(gid GlyphIndex, outline *GlyphOutline, advance uint16, lsb int16) error {
+	err := f.checkGlyphsEditable()
+	if err != nil {
+		return err
+	}
+	numGlyphs := int(f.maxp.numGlyphs)
+	if int(gid) >= numGlyphs || int(gid) >= len(f.glyf.descs) {
+		logger.Debugf("GID out of range (%d >= %d)", gid, numGlyphs)
+		return errRangeCheck
+	}
+	raw, err := encodeOutline(outline)
+	if err != nil {
+		return err
+	}
+
+	f.markDirty()
+
+	// The glyph descriptions may be shared with other fonts, so replace rather than modify them.
+	descs := append([]*glyphDescription(nil), f.glyf.descs...)
+	descs[gid] = &glyphDescription{raw: raw}
+	f.glyf = &glyfTable{descs: descs}
+
+	// All advances are stored so that the advance of `gid` can differ from the glyphs sharing the last advance.
+	hmtx := &hmtxTable{hMetrics: make([]longHorMetric, 0, numGlyphs)}
+	for i := 0; i < numGlyphs; i++ {
+		hmtx.hMetrics = append(hmtx.hMetrics, f.hmtx.getMetric(GlyphIndex(i)))
+	}
+	hmtx.hMetrics[gid] = longHorMetric{advanceWidth: advance, lsb: lsb}
+	f.hmtx = hmtx
+	f.hhea.numberOfHMetrics = uint16(numGlyphs)
+	f.optimizeHmtx()
+
+	err = f.updateLocaFormat()
+	if err != nil {
+		return err
+	}
+	f.updateHeadBBox()
+	f.recomputeMaxp()
+	f.recomputeHhea()
+	return nil
+}
+
+// AddGlyphForRune adds a glyph as AddGlyph and maps `r` to it, replacing the glyph `r` was mapped to. The cmap
+// is rebuilt as by SetCmapFromMap from the runes mapped by `f`.
+func (f *Font) AddGlyphForRune(r rune, outline *GlyphOutline, advance uint16, lsb int16) (GlyphIndex, error) {
+	if !utf8.ValidRune(r) {
+		return 0, fmt.Errorf("invalid rune U+%04X", r)
+	}
+	runeToGID := map[rune]GlyphIndex{}
+	for rr, gid := range f.runeLookupMap() {
+		runeToGID[rr] = gid
+	}
+
+	gid, err := f.AddGlyph(outline, advance, lsb)
+	if err != nil {
+		return 0, err
+	}
+	runeToGID[r] = gid
+	err = f.SetCmapFromMap(runeToGID)
+	if err != nil {
+		return 0, err
+	}
+	return gid, nil
+}
+
+// PathSink receives the segments of a glyph outline from GlyphOutline.Walk, such as a rasterizer or a writer of
+// PDF content streams. The coordinates are in font design units with the Y axis pointing up.
+type PathSink interface {
+	// MoveTo starts a new contour at (x,y).
+	MoveTo(x, y float64)
+	// LineTo adds a line from the current point to (x,y).
+	LineTo(x, y float64)
+	// QuadTo adds a quadratic Bézier curve from the current point to (x,y) with control point (cx,cy).
+	QuadTo(cx, cy, x, y float64)
+	// ClosePath closes the contour, connecting the current point to the start of the contour.
+	ClosePath()
+}
+
+// Walk passes the outline `o` to `sink` segment by segment, in the order of the contours and their points.
+// Each contour starts with MoveTo at its first on-curve point and ends with ClosePath. The on-curve points implied
+// between consecutive off-curve points are made explicit.
+func (o *GlyphOutline) Walk(sink PathSink) {
+	midpoint := func(p, q GlyphPoint) GlyphPoint {
+		return GlyphPoint{X: (p.X + q.X) / 2, Y: (p.Y + q.Y) / 2, OnCurve: true}
+	}
+
+	for _, c := range o.Contours {
+		if len(c) == 0 {
+			continue
+		}
+
+		// Start at the first on-curve point, or at the implied point before the first point if there is none.
+		first := -1
+		for i, p := range c {
+			if p.OnCurve {
+				first = i
+				break
+			}
+		}
+		var start GlyphPoint
+		var rest []GlyphPoint
+		if first >= 0 {
+			start = c[first]
+			rest = append(append(rest, c[first+1:]...), c[:first]...)
+		} else {
+			start = midpoint(c[len(c)-1], c[0])
+			rest = c
+		}
+
+		sink.MoveTo(start.X, start.Y)
+		var control *GlyphPoint
+		for i := range rest {
+			p := rest[i]
+			switch {
+			case p.OnCurve && control == nil:
+				sink.LineTo(p.X, p.Y)
+			case p.OnCurve:
+				sink.QuadTo(control.X, control.Y, p.X, p.Y)
+				control = nil
+			case control != nil:
+				mid := midpoint(*control, p)
+				sink.QuadTo(control.X, control.Y, mid.X, mid.Y)
+				control = &rest[i]
+			default:
+				control = &rest[i]
+			}
+		}
+		if control != nil {
+			sink.QuadTo(control.X, control.Y, start.X, start.Y)
+		}
+		sink.ClosePath()
+	}
+}
+
+// PathOp is the operation of a PathSegment.
+type PathOp int
+
+// The operations of path segments, corresponding to the methods of PathSink.
+const (
+	PathMoveTo PathOp = iota
+	PathLineTo
+	PathQuadTo
+	PathClose
+)
+
+// PathSegment is a segment of a glyph outline. CX and CY are the control point of PathQuadTo segments, X and Y
+// the end point of all segments but PathClose.
+type PathSegment struct {
+	Op     PathOp
+	CX, CY float64
+	X, Y   float64
+}
+
+// PathSegments is a PathSink that collects the segments passed to it.
+type PathSegments []PathSegment
+
+// MoveTo implements PathSink.
+func (s *PathSegments) MoveTo(x, y float64) {
+	*s = append(*s, PathSegment{Op: PathMoveTo, X: x, Y: y})
+}
+
+// LineTo implements PathSink.
+func (s *PathSegments) LineTo(x, y float64) {
+	*s = append(*s, PathSegment{Op: PathLineTo, X: x, Y: y})
+}
+
+// QuadTo implements PathSink.
+func (s *PathSegments) QuadTo(cx, cy, x, y float64) {
+	*s = append(*s, PathSegment{Op: PathQuadTo, CX: cx, CY: cy, X: x, Y: y})
+}
+
+// ClosePath implements PathSink.
+func (s *PathSegments) ClosePath() {
+	*s = append(*s, PathSegment{Op: PathClose})
+}
+
+// Segments returns the segments of the outline `o` as passed to a PathSink by Walk.
+func (o *GlyphOutline) Segments() []PathSegment {
+	var s PathSegments
+	o.Walk(&s)
+	return s
+}
+
+// SVGPath returns the outline `o` as the data of an SVG path, e.g. for the "d" attribute of a path element, with
+// the coordinates in font design units. The Y axis points up as in the font, see Font.GlyphSVGPath for the
+// Y axis of SVG pointing down. The on-curve points implied between consecutive off-curve points are made
+// explicit, so the path consists of M, L, Q and Z commands only.
+func (o *GlyphOutline) SVGPath() string {
+	return o.svgPath(false)
+}
+
+// svgPath returns the SVG path data of `o`, with the Y axis flipped if `flipY` is true.
+func (o *GlyphOutline) svgPath(flipY bool) string {
+	sink := &svgPathSink{flipY: flipY}
+	o.Walk(sink)
+	return sink.b.String()
+}
+
+// svgPathSink is a PathSink writing SVG path data.
+type svgPathSink struct {
+	b     strings.Builder
+	flipY bool
+}
+
+func (s *svgPathSink) MoveTo(x, y float64) {
+	s.command("M", x, y)
+}
+
+func (s *svgPathSink) LineTo(x, y float64) {
+	s.command("L", x, y)
+}
+
+func (s *svgPathSink) QuadTo(cx, cy, x, y float64) {
+	s.command("Q", cx, cy, x, y)
+}
+
+func (s *svgPathSink) ClosePath() {
+	s.command("Z")
+}
+
+// command writes the path command `cmd` with the coordinate pairs `coords`.
+func (s *svgPathSink) command(cmd string, coords ...float64) {
+	if s.b.Len() > 0 {
+		s.b.WriteByte(' ')
+	}
+	s.b.WriteString(cmd)
+	for i, v := range coords {
+		if i%2 == 1 && s.flipY {
+			v = 0 - v // not -v, which gives -0 for 0.
+		}
+		if i > 0 {
+			s.b.WriteByte(' ')
+		}
+		s.b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+}
+
+// GlyphSVGPath returns the outline of glyph `gid` as the data of an SVG path, see GlyphOutline and
+// GlyphOutline.SVGPath. If `flipY` is true, the Y axis is flipped for the coordinate system of SVG with the
+// Y axis pointing down, so that the baseline is at y=0 and the ascent at negative y.
+func (f *Font) GlyphSVGPath(gid GlyphIndex, flipY bool) (string, error) {
+	o, err := f.GlyphOutline(gid)
+	if err != nil {
+		return "", err
+	}
+	return o.svgPath(flipY), nil
+}
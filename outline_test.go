@@ -0,0 +1,293 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlyphOutline(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	for _, r := range "OAÅé" {
+		gid, has := fnt.LookupRune(r)
+		require.True(t, has)
+		o, err := fnt.GlyphOutline(gid)
+		require.NoError(t, err)
+		require.NotEmpty(t, o.Contours, string(r))
+
+		xMin, yMin, xMax, yMax, empty, err := fnt.GlyphBBox(gid)
+		require.NoError(t, err)
+		require.False(t, empty)
+		b, has := o.Bounds()
+		require.True(t, has)
+		assert.Equal(t, BBox{XMin: int(xMin), YMin: int(yMin), XMax: int(xMax), YMax: int(yMax)}, b, string(r))
+	}
+
+	gid, _ := fnt.LookupRune('O')
+	o, err := fnt.GlyphOutline(gid)
+	require.NoError(t, err)
+	assert.Len(t, o.Contours, 2)
+	numPoints, err := fnt.glyf.descs[gid].numPoints()
+	require.NoError(t, err)
+	assert.Equal(t, numPoints, o.NumPoints())
+
+	// Composite glyphs combine the contours of their components.
+	gidA, _ := fnt.LookupRune('A')
+	gid, _ = fnt.LookupRune('Å')
+	oA, err := fnt.GlyphOutline(gidA)
+	require.NoError(t, err)
+	o, err = fnt.GlyphOutline(gid)
+	require.NoError(t, err)
+	assert.True(t, len(o.Contours) > len(oA.Contours))
+
+	gid, _ = fnt.LookupRune(' ')
+	o, err = fnt.GlyphOutline(gid)
+	require.NoError(t, err)
+	assert.Empty(t, o.Contours)
+	_, has := o.Bounds()
+	assert.False(t, has)
+
+	_, err = fnt.GlyphOutline(5000)
+	assert.Error(t, err)
+}
+
+func TestGlyphOutlineComposite(t *testing.T) {
+	square := &simpleGlyph{
+		header: glyphHeader{numberOfContours: 1, xMax: 100, yMax: 100},
+		endPts: []uint16{3},
+		points: []glyphPoint{{0, 0, true}, {0, 100, true}, {100, 100, true}, {100, 0, true}},
+	}
+	triangle := &simpleGlyph{
+		header: glyphHeader{numberOfContours: 1, xMax: 40, yMax: 40},
+		endPts: []uint16{2},
+		points: []glyphPoint{{0, 0, true}, {20, 40, false}, {40, 0, true}},
+	}
+	half := f2dot14(1 << 13)
+	composite := &compositeGlyph{components: []compositeComponent{
+		// Square moved by (10,-20).
+		{flags: uint16(argsAreXYValues), glyphIndex: 1, argument1: 10, argument2: uint16(0xFFEC)},
+		// Triangle scaled by half, with its point 2 attached to point 2 of the square.
+		{flags: uint16(weHaveAScale), glyphIndex: 2, argument1: 2, argument2: 2, scale: &half},
+	}}
+
+	glyf := &glyfTable{descs: []*glyphDescription{
+		{},
+		{raw: square.encode()},
+		{raw: triangle.encode()},
+		{raw: composite.encode(glyphHeader{numberOfContours: -1})},
+	}}
+	fnt := &Font{font: &font{glyf: glyf}}
+
+	o, err := fnt.GlyphOutline(3)
+	require.NoError(t, err)
+	assert.Equal(t, []GlyphContour{
+		{{10, -20, true}, {10, 80, true}, {110, 80, true}, {110, -20, true}},
+		{{90, 80, true}, {100, 100, false}, {110, 80, true}},
+	}, o.Contours)
+
+	// Points out of range.
+	composite.components[1].argument1 = 4
+	glyf.descs[3] = &glyphDescription{raw: composite.encode(glyphHeader{numberOfContours: -1})}
+	_, err = fnt.GlyphOutline(3)
+	assert.Error(t, err)
+}
+
+func TestGlyphSVGPath(t *testing.T) {
+	o := &GlyphOutline{Contours: []GlyphContour{
+		{{10, -20, true}, {10, 80, true}, {110, 80, true}},
+		{{0, 0, false}, {90, 80, true}, {100, 100, false}, {110, 80, false}},
+		// Off-curve points only.
+		{{0, 0, false}, {0, 10, false}, {10, 10, false}, {10, 0, false}},
+	}}
+	assert.Equal(t, "M10 -20 L10 80 L110 80 Z "+
+		"M90 80 Q100 100 105 90 Q110 80 55 40 Q0 0 90 80 Z "+
+		"M5 0 Q0 0 0 5 Q0 10 5 10 Q10 10 10 5 Q10 0 5 0 Z", o.SVGPath())
+	assert.Equal(t, "M10 20 L10 -80 L110 -80 Z "+
+		"M90 -80 Q100 -100 105 -90 Q110 -80 55 -40 Q0 0 90 -80 Z "+
+		"M5 0 Q0 0 0 -5 Q0 -10 5 -10 Q10 -10 10 -5 Q10 0 5 0 Z", o.svgPath(true))
+	assert.Equal(t, "", (&GlyphOutline{}).SVGPath())
+
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gid, has := fnt.LookupRune('O')
+	require.True(t, has)
+	path, err := fnt.GlyphSVGPath(gid, true)
+	require.NoError(t, err)
+	assert.Regexp(t, `^M[-0-9. ]+( [LQ][-0-9. ]+)+ Z M[-0-9. ]+( [LQ][-0-9. ]+)+ Z$`, path)
+
+	gid, has = fnt.LookupRune(' ')
+	require.True(t, has)
+	path, err = fnt.GlyphSVGPath(gid, true)
+	require.NoError(t, err)
+	assert.Equal(t, "", path)
+}
+
+func TestGlyphOutlineWalk(t *testing.T) {
+	o := &GlyphOutline{Contours: []GlyphContour{
+		{{0, 0, false}, {90, 80, true}, {100, 100, false}, {110, 80, false}},
+		{},
+		{{10, -20, true}, {10, 80, true}},
+	}}
+	assert.Equal(t, []PathSegment{
+		{Op: PathMoveTo, X: 90, Y: 80},
+		{Op: PathQuadTo, CX: 100, CY: 100, X: 105, Y: 90},
+		{Op: PathQuadTo, CX: 110, CY: 80, X: 55, Y: 40},
+		{Op: PathQuadTo, CX: 0, CY: 0, X: 90, Y: 80},
+		{Op: PathClose},
+		{Op: PathMoveTo, X: 10, Y: -20},
+		{Op: PathLineTo, X: 10, Y: 80},
+		{Op: PathClose},
+	}, o.Segments())
+
+	var s PathSegments
+	(&GlyphOutline{}).Walk(&s)
+	assert.Empty(t, s)
+}
+
+func TestAddGlyph(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	subfnt, err := fnt.SubsetKeepRunes([]rune("AB"))
+	require.NoError(t, err)
+	numGlyphs, _ := subfnt.NumGlyphs()
+
+	check := &GlyphOutline{Contours: []GlyphContour{
+		{{100, 300, true}, {250, 100, true}, {600, 700, true}, {550, 750, true}, {250, 250.4, true}},
+		{},
+	}}
+	gid, err := subfnt.AddGlyphForRune(0x2713, check, 700, 100)
+	require.NoError(t, err)
+	assert.Equal(t, GlyphIndex(numGlyphs), gid)
+	space, err := subfnt.AddGlyph(&GlyphOutline{}, 250, 0)
+	require.NoError(t, err)
+	assert.Equal(t, gid+1, space)
+
+	var buf bytes.Buffer
+	require.NoError(t, subfnt.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	n, _ := newfnt.NumGlyphs()
+	assert.Equal(t, numGlyphs+2, n)
+	mapped, has := newfnt.LookupRune(0x2713)
+	require.True(t, has)
+	assert.Equal(t, gid, mapped)
+	for _, r := range "AB" {
+		origGID, _ := fnt.LookupRune(r)
+		newGID, has := newfnt.LookupRune(r)
+		assert.True(t, has)
+		assert.Equal(t, origGID, newGID)
+	}
+
+	o, err := newfnt.GlyphOutline(gid)
+	require.NoError(t, err)
+	assert.Equal(t, []GlyphContour{
+		{{100, 300, true}, {250, 100, true}, {600, 700, true}, {550, 750, true}, {250, 250, true}},
+	}, o.Contours)
+	advance, err := newfnt.GlyphAdvance(gid)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(700), advance)
+	lsb, err := newfnt.GlyphLSB(gid)
+	require.NoError(t, err)
+	assert.Equal(t, int16(100), lsb)
+	xMin, yMin, xMax, yMax, empty, err := newfnt.GlyphBBox(gid)
+	require.NoError(t, err)
+	assert.False(t, empty)
+	assert.Equal(t, []int16{100, 100, 600, 750}, []int16{xMin, yMin, xMax, yMax})
+
+	o, err = newfnt.GlyphOutline(space)
+	require.NoError(t, err)
+	assert.Empty(t, o.Contours)
+	advance, err = newfnt.GlyphAdvance(space)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(250), advance)
+
+	_, err = newfnt.AddGlyph(&GlyphOutline{Contours: []GlyphContour{{{40000, 0, true}}}}, 0, 0)
+	assert.Error(t, err)
+	_, err = (&Font{font: &font{}}).AddGlyph(check, 0, 0)
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "head"}, err)
+
+	// The font is unchanged if a step fails, here loading the glyph data for the loca table.
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	lazyfnt, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{LazyGlyphs: true})
+	require.NoError(t, err)
+	lazyfnt.glyf.descs[len(lazyfnt.glyf.descs)-1].lazy.length = int64(len(data))
+	orig := *lazyfnt.font
+	origMaxp := *lazyfnt.maxp
+	origHhea := *lazyfnt.hhea
+	_, err = lazyfnt.AddGlyph(check, 700, 100)
+	require.Error(t, err)
+	assert.Equal(t, orig, *lazyfnt.font)
+	assert.Equal(t, origMaxp, *lazyfnt.maxp)
+	assert.Equal(t, origHhea, *lazyfnt.hhea)
+	assert.False(t, lazyfnt.isDirty("glyf"))
+}
+
+func TestSetGlyph(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gidA, _ := fnt.LookupRune('A')
+	gidB, _ := fnt.LookupRune('B')
+	subfnt := &Font{font: fnt.font.clone()}
+	advanceB, err := subfnt.GlyphAdvance(gidB)
+	require.NoError(t, err)
+
+	square := &GlyphOutline{Contours: []GlyphContour{
+		{{50, 0, true}, {50, 500, true}, {550, 500, true}, {550, 0, true}},
+	}}
+	require.NoError(t, subfnt.SetGlyph(gidA, square, 600, 50))
+	// The last glyphs share an advance in the compressed hmtx table, which the new advance breaks up.
+	numGlyphs, _ := subfnt.NumGlyphs()
+	last := GlyphIndex(numGlyphs - 1)
+	require.NoError(t, subfnt.SetGlyph(last, nil, 333, 0))
+
+	var buf bytes.Buffer
+	require.NoError(t, subfnt.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	o, err := newfnt.GlyphOutline(gidA)
+	require.NoError(t, err)
+	assert.Equal(t, square, o)
+	advance, err := newfnt.GlyphAdvance(gidA)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(600), advance)
+	xMin, yMin, xMax, yMax, _, err := newfnt.GlyphBBox(gidA)
+	require.NoError(t, err)
+	assert.Equal(t, []int16{50, 0, 550, 500}, []int16{xMin, yMin, xMax, yMax})
+
+	o, err = newfnt.GlyphOutline(last)
+	require.NoError(t, err)
+	assert.Empty(t, o.Contours)
+	advance, err = newfnt.GlyphAdvance(last)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(333), advance)
+
+	advance, err = newfnt.GlyphAdvance(gidB)
+	require.NoError(t, err)
+	assert.Equal(t, advanceB, advance)
+	origOutline, err := fnt.GlyphOutline(gidB)
+	require.NoError(t, err)
+	o, err = newfnt.GlyphOutline(gidB)
+	require.NoError(t, err)
+	assert.Equal(t, origOutline, o)
+	// The original font is unchanged.
+	origOutline, err = fnt.GlyphOutline(gidA)
+	require.NoError(t, err)
+	assert.NotEqual(t, square, origOutline)
+
+	assert.Error(t, subfnt.SetGlyph(GlyphIndex(numGlyphs), square, 0, 0))
+}
@@ -0,0 +1,377 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CIDToGIDMap returns the data of the CIDToGIDMap stream of a CIDFontType2 font in a PDF document: the GIDs
+// of the CIDs as 2-byte big-endian values, indexed by CID. The GID of each CID is found by looking up its rune
+// in `cidToRune` with LookupRune. The map covers the CIDs up to the highest CID of `cidToRune`, the CIDs not in
+// `cidToRune` and the CIDs whose rune is not covered by `f` map to GID 0 (notdef).
+// An ErrRequiredTableMissing error is returned if `f` has no cmap table.
+func (f *Font) CIDToGIDMap(cidToRune map[uint16]rune) ([]byte, error) {
+	if f.cmap == nil {
+		return nil, ErrRequiredTableMissing{Tag: "cmap"}
+	}
+
+	numCIDs := 0
+	for cid := range cidToRune {
+		if int(cid)+1 > numCIDs {
+			numCIDs = int(cid) + 1
+		}
+	}
+	data := make([]byte, 2*numCIDs)
+	for cid, r := range cidToRune {
+		gid, _ := f.LookupRune(r)
+		binary.BigEndian.PutUint16(data[2*int(cid):], uint16(gid))
+	}
+	return data, nil
+}
+
+// IdentityCIDToGIDMap returns the data of a CIDToGIDMap stream mapping each GID of `f` to itself, i.e. for
+// CIDs equal to the GIDs, such as for fonts subsetted with SubsetKeepIndices. PDF documents can also specify
+// the identity mapping with the name /Identity instead of a stream.
+// An ErrRequiredTableMissing error is returned if `f` has no maxp table.
+func (f *Font) IdentityCIDToGIDMap() ([]byte, error) {
+	if f.maxp == nil {
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
+	}
+	numGlyphs := int(f.maxp.numGlyphs)
+	data := make([]byte, 2*numGlyphs)
+	for gid := 0; gid < numGlyphs; gid++ {
+		binary.BigEndian.PutUint16(data[2*gid:], uint16(gid))
+	}
+	return data, nil
+}
+
+// pdfWidthPrecision is the number of decimals the PDF glyph widths are rounded to.
+const pdfWidthPrecision = 3
+
+// pdfWidth returns the advance width `advance` in font design units scaled to the 1000 units per em of the PDF
+// glyph space, rounded half up to pdfWidthPrecision decimals so that the widths are the same on all platforms.
+func pdfWidth(advance uint16, unitsPerEm uint16) float64 {
+	return pdfScale(float64(advance), unitsPerEm)
+}
+
+// pdfScale returns the value `v` in font design units scaled to PDF glyph space and rounded as pdfWidth.
+func pdfScale(v float64, unitsPerEm uint16) float64 {
+	scale := math.Pow(10, pdfWidthPrecision)
+	return math.Floor(v*1000/float64(unitsPerEm)*scale+0.5) / scale
+}
+
+// pdfUnitsPerEm returns the units per em of `f` for scaling to PDF glyph space.
+func (f *Font) pdfUnitsPerEm() (uint16, error) {
+	if f.head == nil {
+		return 0, ErrRequiredTableMissing{Tag: "head"}
+	}
+	if f.head.unitsPerEm == 0 {
+		logger.Debugf("Invalid unitsPerEm: 0")
+		return 0, errRangeCheck
+	}
+	return f.head.unitsPerEm, nil
+}
+
+// GlyphWidthsPDF returns the advance widths of all glyphs of `f`, indexed by GID, scaled from the units per
+// em of `f` to the 1000 units per em of PDF glyph space. The widths are rounded half up to 3 decimals, so that
+// PDF documents generated again are identical.
+// An ErrRequiredTableMissing error is returned if `f` has no head or hmtx table.
+func (f *Font) GlyphWidthsPDF() ([]float64, error) {
+	if f.hmtx == nil {
+		return nil, ErrRequiredTableMissing{Tag: "hmtx"}
+	}
+	unitsPerEm, err := f.pdfUnitsPerEm()
+	if err != nil {
+		return nil, err
+	}
+	numGlyphs := f.hmtx.numGlyphs()
+	if f.maxp != nil {
+		numGlyphs = int(f.maxp.numGlyphs)
+	}
+	widths := make([]float64, numGlyphs)
+	for gid := range widths {
+		widths[gid] = pdfWidth(f.hmtx.getMetric(GlyphIndex(gid)).advanceWidth, unitsPerEm)
+	}
+	return widths, nil
+}
+
+// RuneWidthsPDF returns the advance widths of the glyphs of `runes` as GlyphWidthsPDF, looked up with
+// LookupRune. Runes not covered by `f` have the width of the glyph 0 (notdef).
+// An ErrRequiredTableMissing error is returned if `f` has no head or hmtx table.
+func (f *Font) RuneWidthsPDF(runes []rune) ([]float64, error) {
+	if f.hmtx == nil {
+		return nil, ErrRequiredTableMissing{Tag: "hmtx"}
+	}
+	unitsPerEm, err := f.pdfUnitsPerEm()
+	if err != nil {
+		return nil, err
+	}
+	widths := make([]float64, len(runes))
+	for i, r := range runes {
+		gid, _ := f.LookupRune(r)
+		widths[i] = pdfWidth(f.hmtx.getMetric(gid).advanceWidth, unitsPerEm)
+	}
+	return widths, nil
+}
+
+// PDFWidthRun is a run of consecutive glyphs with their widths in a PDFWArray.
+type PDFWidthRun struct {
+	First  GlyphIndex
+	Widths []float64
+}
+
+// PDFWArray is the W array of widths of a CIDFont in a PDF document, with CIDs equal to the GIDs.
+type PDFWArray []PDFWidthRun
+
+// String returns `a` in PDF syntax, e.g. "[1 [500 600] 5 [278]]".
+func (a PDFWArray) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, run := range a {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.Itoa(int(run.First)))
+		b.WriteString(" [")
+		for j, w := range run.Widths {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatFloat(w, 'f', -1, 64))
+		}
+		b.WriteByte(']')
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// PDFWArray returns the W array of the glyphs `gids` for a CIDFont with CIDs equal to the GIDs, such as for
+// fonts subsetted with SubsetKeepIndices. The glyphs are sorted and grouped into runs of consecutive GIDs, the
+// widths are as GlyphWidthsPDF. GIDs out of range are ignored.
+// An ErrRequiredTableMissing error is returned if `f` has no head or hmtx table.
+func (f *Font) PDFWArray(gids []GlyphIndex) (PDFWArray, error) {
+	widths, err := f.GlyphWidthsPDF()
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]GlyphIndex, 0, len(gids))
+	seen := map[GlyphIndex]bool{}
+	for _, gid := range gids {
+		if int(gid) >= len(widths) || seen[gid] {
+			continue
+		}
+		seen[gid] = true
+		sorted = append(sorted, gid)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var a PDFWArray
+	for i, gid := range sorted {
+		if i == 0 || gid != sorted[i-1]+1 {
+			a = append(a, PDFWidthRun{First: gid})
+		}
+		run := &a[len(a)-1]
+		run.Widths = append(run.Widths, widths[gid])
+	}
+	return a, nil
+}
+
+// FontDescriptorFlags are the flags of a PDF font descriptor as specified in the PDF reference.
+type FontDescriptorFlags uint32
+
+// The flags of a PDF font descriptor.
+const (
+	FontFlagFixedPitch  FontDescriptorFlags = 1 << 0
+	FontFlagSerif       FontDescriptorFlags = 1 << 1
+	FontFlagSymbolic    FontDescriptorFlags = 1 << 2
+	FontFlagScript      FontDescriptorFlags = 1 << 3
+	FontFlagNonsymbolic FontDescriptorFlags = 1 << 5
+	FontFlagItalic      FontDescriptorFlags = 1 << 6
+	FontFlagAllCap      FontDescriptorFlags = 1 << 16
+	FontFlagSmallCap    FontDescriptorFlags = 1 << 17
+	FontFlagForceBold   FontDescriptorFlags = 1 << 18
+)
+
+// FontDescriptor holds the values of a PDF /FontDescriptor dictionary computed by Font.Descriptor. The
+// metrics are in the 1000 units per em of PDF glyph space.
+type FontDescriptor struct {
+	Flags FontDescriptorFlags
+	// FontBBox is the bounding box of all glyphs as [xMin yMin xMax yMax].
+	FontBBox    [4]float64
+	ItalicAngle float64
+	Ascent      float64
+	Descent     float64
+	CapHeight   float64
+	StemV       float64
+}
+
+// Descriptor returns the values of a PDF font descriptor for `f`:
+//   - Flags: FixedPitch as IsMonospace, Serif and Script from the PANOSE family and serif style, Symbolic or
+//     Nonsymbolic as IsSymbolic and Italic from the head, OS/2 or post table.
+//   - FontBBox from the head table and ItalicAngle from the post table.
+//   - Ascent and Descent from the typographic metrics of the OS/2 table, otherwise from the hhea table or the
+//     FontBBox.
+//   - CapHeight from the OS/2 table, otherwise as EstimateCapHeight.
+//   - StemV estimated from the weight class of the OS/2 table, otherwise measured from the vertical stem of the
+//     glyph of 'l' or 'I'.
+//
+// An ErrRequiredTableMissing error is returned if `f` has no head table.
+func (f *Font) Descriptor() (FontDescriptor, error) {
+	unitsPerEm, err := f.pdfUnitsPerEm()
+	if err != nil {
+		return FontDescriptor{}, err
+	}
+	scale := func(v float64) float64 {
+		return pdfScale(v, unitsPerEm)
+	}
+
+	d := FontDescriptor{
+		Flags: f.descriptorFlags(),
+		FontBBox: [4]float64{
+			scale(float64(f.head.xMin)), scale(float64(f.head.yMin)),
+			scale(float64(f.head.xMax)), scale(float64(f.head.yMax)),
+		},
+	}
+	if f.post != nil {
+		d.ItalicAngle = math.Floor(f.post.italicAngle.Float64()*100+0.5) / 100
+	}
+
+	switch {
+	case f.os2 != nil && (f.os2.sTypoAscender != 0 || f.os2.sTypoDescender != 0):
+		d.Ascent, d.Descent = scale(float64(f.os2.sTypoAscender)), scale(float64(f.os2.sTypoDescender))
+	case f.hhea != nil && (f.hhea.ascender != 0 || f.hhea.descender != 0):
+		d.Ascent, d.Descent = scale(float64(f.hhea.ascender)), scale(float64(f.hhea.descender))
+	default:
+		d.Ascent, d.Descent = d.FontBBox[3], d.FontBBox[1]
+	}
+
+	capHeight, ok := f.CapHeight()
+	if !ok || capHeight == 0 {
+		capHeight = f.EstimateCapHeight()
+	}
+	d.CapHeight = scale(float64(capHeight))
+
+	if f.os2 != nil && f.os2.usWeightClass != 0 {
+		// Estimate commonly used by PDF producers for Type 1 fonts without a StdVW entry.
+		weight := float64(f.os2.usWeightClass) / 65
+		d.StemV = math.Floor(50 + weight*weight + 0.5)
+	} else if stem, ok := f.measureStemV(); ok {
+		d.StemV = math.Floor(stem*1000/float64(unitsPerEm) + 0.5)
+	} else {
+		d.StemV = 80
+	}
+	return d, nil
+}
+
+// descriptorFlags returns the flags of the PDF font descriptor of `f`.
+func (f *Font) descriptorFlags() FontDescriptorFlags {
+	var flags FontDescriptorFlags
+	if f.IsSymbolic() {
+		flags |= FontFlagSymbolic
+	} else {
+		flags |= FontFlagNonsymbolic
+	}
+
+	if f.IsMonospace() {
+		flags |= FontFlagFixedPitch
+	}
+	if f.os2 != nil && len(f.os2.panose10) == 10 {
+		// PANOSE family kind 2 is Latin Text, with serif styles 2-10 having serifs and 11-15 being sans serif.
+		// Family kind 3 is Latin Hand Written.
+		panose := f.os2.panose10
+		switch panose[0] {
+		case 2:
+			if panose[1] >= 2 && panose[1] <= 10 {
+				flags |= FontFlagSerif
+			}
+		case 3:
+			flags |= FontFlagScript
+		}
+	}
+
+	italic := f.head.macStyle&0x2 != 0
+	if f.os2 != nil && f.os2.fsSelection&0x1 != 0 {
+		italic = true
+	}
+	if f.post != nil && f.post.italicAngle != 0 {
+		italic = true
+	}
+	if italic {
+		flags |= FontFlagItalic
+	}
+	return flags
+}
+
+// measureStemV measures the width of the vertical stem of the glyph of 'l' or 'I' in font design units, as the
+// distance between the first two crossings of the outline with a horizontal line at half the height of the
+// glyph. Returns false if neither glyph has a usable outline.
+func (f *Font) measureStemV() (float64, bool) {
+	for _, r := range "lI" {
+		gid, has := f.LookupRune(r)
+		if !has {
+			continue
+		}
+		o, err := f.GlyphOutline(gid)
+		if err != nil {
+			continue
+		}
+		b, has := o.Bounds()
+		if !has {
+			continue
+		}
+
+		sink := &crossingSink{y: float64(b.YMin+b.YMax) / 2}
+		o.Walk(sink)
+		xs := sink.xs
+		sort.Float64s(xs)
+		if len(xs) >= 2 && xs[1] > xs[0] {
+			return xs[1] - xs[0], true
+		}
+	}
+	return 0, false
+}
+
+// crossingSink is a PathSink collecting the x coordinates where the path crosses the horizontal line at `y`.
+// Curves are approximated by lines.
+type crossingSink struct {
+	y      float64
+	xs     []float64
+	x0, y0 float64 // current point.
+	sx, sy float64 // start of the contour.
+}
+
+func (s *crossingSink) MoveTo(x, y float64) {
+	s.x0, s.y0, s.sx, s.sy = x, y, x, y
+}
+
+func (s *crossingSink) LineTo(x, y float64) {
+	if (s.y0 <= s.y) != (y <= s.y) {
+		s.xs = append(s.xs, s.x0+(s.y-s.y0)*(x-s.x0)/(y-s.y0))
+	}
+	s.x0, s.y0 = x, y
+}
+
+func (s *crossingSink) QuadTo(cx, cy, x, y float64) {
+	x0, y0 := s.x0, s.y0
+	const steps = 8
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / steps
+		u := 1 - t
+		s.LineTo(u*u*x0+2*u*t*cx+t*t*x, u*u*y0+2*u*t*cy+t*t*y)
+	}
+}
+
+func (s *crossingSink) ClosePath() {
+	s.LineTo(s.sx, s.sy)
+}
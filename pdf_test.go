@@ -0,0 +1,135 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIDToGIDMap(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	gidA, _ := fnt.LookupRune('A')
+	gidB, _ := fnt.LookupRune('B')
+	data, err := fnt.CIDToGIDMap(map[uint16]rune{1: 'A', 2: 'B', 5: '中'})
+	require.NoError(t, err)
+	require.Len(t, data, 12)
+	expected := make([]byte, 12)
+	binary.BigEndian.PutUint16(expected[2:], uint16(gidA))
+	binary.BigEndian.PutUint16(expected[4:], uint16(gidB))
+	assert.Equal(t, expected, data)
+
+	data, err = fnt.CIDToGIDMap(nil)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	// The subset renumbered, with the same runes.
+	subfnt, oldnew, err := fnt.Subset([]GlyphIndex{gidA, gidB})
+	require.NoError(t, err)
+	data, err = subfnt.CIDToGIDMap(map[uint16]rune{0: 'B', 1: 'A'})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, byte(oldnew[gidB]), 0, byte(oldnew[gidA])}, data)
+
+	require.NoError(t, subfnt.PruneTables("cmap"))
+	_, err = subfnt.CIDToGIDMap(map[uint16]rune{0: 'B'})
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "cmap"}, err)
+
+	data, err = subfnt.IdentityCIDToGIDMap()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 1, 0, 2}, data)
+}
+
+func TestWidthsPDF(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	widths, err := fnt.GlyphWidthsPDF()
+	require.NoError(t, err)
+	require.Len(t, widths, 3726)
+	gidA, _ := fnt.LookupRune('A')
+	advance, err := fnt.GlyphAdvance(gidA)
+	require.NoError(t, err)
+	assert.Equal(t, float64(advance), widths[gidA]) // 1000 units per em.
+
+	runeWidths, err := fnt.RuneWidthsPDF([]rune("A中"))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{widths[gidA], widths[0]}, runeWidths)
+
+	// Scaled and rounded half up.
+	assert.Equal(t, 556.152, pdfWidth(1139, 2048))
+	assert.Equal(t, 0.5, pdfWidth(1, 2000))
+	assert.Equal(t, 0.063, pdfWidth(1, 16000)) // 0.0625.
+
+	a, err := fnt.PDFWArray([]GlyphIndex{5, 3, 4, 10, 4, 9000})
+	require.NoError(t, err)
+	require.Len(t, a, 2)
+	assert.Equal(t, PDFWArray{
+		{First: 3, Widths: widths[3:6]},
+		{First: 10, Widths: widths[10:11]},
+	}, a)
+	assert.Regexp(t, `^\[3 \[[0-9.]+ [0-9.]+ [0-9.]+\] 10 \[[0-9.]+\]\]$`, a.String())
+	assert.Equal(t, "[1 [500 278.5]]", PDFWArray{{First: 1, Widths: []float64{500, 278.5}}}.String())
+	assert.Equal(t, "[]", PDFWArray(nil).String())
+}
+
+func TestDescriptor(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	d, err := fnt.Descriptor()
+	require.NoError(t, err)
+	assert.Equal(t, FontFlagNonsymbolic, d.Flags)
+	assert.Equal(t, [4]float64{-631, -462, 1632, 1230}, d.FontBBox) // 1000 units per em.
+	assert.Equal(t, 0.0, d.ItalicAngle)
+	assert.Equal(t, 800.0, d.Ascent)
+	assert.Equal(t, -200.0, d.Descent)
+	// OS/2 version 1 has no sCapHeight, so it is measured from 'H'.
+	gid, _ := fnt.LookupRune('H')
+	_, _, _, yMax, _, err := fnt.GlyphBBox(gid)
+	require.NoError(t, err)
+	assert.Equal(t, float64(yMax), d.CapHeight)
+	assert.Equal(t, 88.0, d.StemV) // usWeightClass 400.
+
+	t.Run("NoOS2", func(t *testing.T) {
+		modified := &Font{font: fnt.font.clone()}
+		modified.os2 = nil
+		modified.post.italicAngle = -12 << 16
+		d, err := modified.Descriptor()
+		require.NoError(t, err)
+		assert.Equal(t, FontFlagNonsymbolic|FontFlagItalic, d.Flags)
+		assert.Equal(t, -12.0, d.ItalicAngle)
+		assert.Equal(t, float64(fnt.hhea.ascender), d.Ascent)
+		assert.Equal(t, float64(fnt.hhea.descender), d.Descent)
+		// Measured from the stem of 'l'.
+		assert.InDelta(t, 84, d.StemV, 10)
+	})
+
+	t.Run("Panose", func(t *testing.T) {
+		modified := &Font{font: fnt.font.clone()}
+		copy(modified.os2.panose10, []uint8{2, 2, 6, 9})
+		d, err := modified.Descriptor()
+		require.NoError(t, err)
+		// Not FixedPitch, as the advance widths differ, see IsMonospace.
+		assert.Equal(t, FontFlagNonsymbolic|FontFlagSerif, d.Flags)
+	})
+
+	t.Run("Scaled", func(t *testing.T) {
+		fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+		require.NoError(t, err)
+		d, err := fnt.Descriptor()
+		require.NoError(t, err)
+		assert.Equal(t, -726.562, d.FontBBox[0]) // -1488/2048 units per em.
+		assert.Equal(t, 166.0, d.StemV)          // usWeightClass 700.
+	})
+
+	_, err = (&Font{font: &font{}}).Descriptor()
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "head"}, err)
+}
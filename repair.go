@@ -0,0 +1,153 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"fmt"
+)
+
+// The codes of the repair fixes. The codes are stable and can be relied upon, unlike the messages.
+const (
+	RepairHeadMagicNumber = "head-magic-number"
+	RepairHeadBBox        = "head-bbox"
+	RepairNumGlyphs       = "num-glyphs"
+	RepairGlyphsPadded    = "glyphs-padded"
+	RepairLocaRegenerated = "loca-regenerated"
+	RepairHMetricsCount   = "hmetrics-count"
+	RepairPostSynthesized = "post-synthesized"
+)
+
+// RepairOptions represents options for repairing fonts with Font.Repair.
+type RepairOptions struct {
+	// DryRun only reports the fixes that would be applied, leaving the font unchanged.
+	DryRun bool
+
+	// PadGlyphs keeps maxp.numGlyphs when the loca table covers fewer glyphs, loading the glyphs not covered
+	// as empty glyphs. Otherwise maxp.numGlyphs is clamped to the glyphs covered by the loca table.
+	PadGlyphs bool
+}
+
+// RepairFix represents a fix applied by Font.Repair.
+type RepairFix struct {
+	Tag     string // tag of the table fixed, e.g. "loca".
+	Code    string // kind of fix, one of the Repair constants.
+	Message string
+}
+
+// String returns a description of `fix`, e.g. "maxp: numGlyphs clamped from 3726 to 3000".
+func (fix RepairFix) String() string {
+	return fmt.Sprintf("%s: %s", fix.Tag, fix.Message)
+}
+
+// RepairReport represents the fixes applied by Font.Repair.
+type RepairReport struct {
+	// Fixes holds the fixes in the order applied, empty if the font needed no repair.
+	Fixes []RepairFix
+}
+
+// Repair fixes common defects of fonts found in the wild, such as fonts embedded in PDF files, so that the
+// font written by Write passes validation:
+//   - an invalid magic number of the head table is corrected,
+//   - numberOfHMetrics of the hhea table exceeding maxp.numGlyphs is clamped,
+//   - a maxp.numGlyphs exceeding the glyphs covered by a short loca table is clamped, or with
+//     RepairOptions.PadGlyphs the glyphs not covered are kept as empty glyphs,
+//   - a loca table whose offsets were repaired or whose glyph count disagrees is regenerated from the glyf table,
+//   - a missing post table is synthesized as a version 3.0 table without glyph names, see EnsurePost,
+//   - an inverted bounding box of the head table is recomputed from the glyphs, or zeroed without glyf table.
+//
+// Damaged fonts must be parsed with ParseOptions.RepairLoca and ParseOptions.Lenient for the defects of the
+// loca and head tables to be tolerated. Each fix applied is listed in the returned report.
+// An error is returned if the head or maxp table is missing, which cannot be repaired.
+func (f *Font) Repair(opts RepairOptions) (*RepairReport, error) {
+	if f.head == nil {
+		return nil, ErrRequiredTableMissing{Tag: "head"}
+	}
+	if f.maxp == nil {
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
+	}
+
+	report := &RepairReport{}
+	add := func(tag, code, format string, args ...interface{}) {
+		report.Fixes = append(report.Fixes, RepairFix{Tag: tag, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Work on a copy so that a dry run or a failure leaves `f` unchanged.
+	fnt := &Font{font: f.font.clone()}
+
+	if fnt.head.magicNumber != 0x5F0F3CF5 {
+		add("head", RepairHeadMagicNumber, "magic number 0x%X corrected", fnt.head.magicNumber)
+		fnt.head.magicNumber = 0x5F0F3CF5
+	}
+
+	numGlyphs := int(fnt.maxp.numGlyphs)
+	if fnt.hhea != nil && fnt.hmtx != nil && len(fnt.hmtx.hMetrics) > numGlyphs {
+		add("hhea", RepairHMetricsCount, "numberOfHMetrics clamped from %d to %d", len(fnt.hmtx.hMetrics), numGlyphs)
+		fnt.hmtx = &hmtxTable{hMetrics: fnt.hmtx.hMetrics[:numGlyphs]}
+		fnt.hhea.numberOfHMetrics = uint16(numGlyphs)
+	}
+
+	if fnt.glyf != nil {
+		covered := len(fnt.glyf.descs)
+		if f.shortLocaGlyphs > 0 && f.shortLocaGlyphs < covered {
+			covered = f.shortLocaGlyphs
+		}
+		regenerate := f.locaRepaired
+		switch {
+		case covered < numGlyphs && opts.PadGlyphs:
+			add("loca", RepairGlyphsPadded, "%d glyphs not covered kept as empty glyphs", numGlyphs-covered)
+			descs := append([]*glyphDescription(nil), fnt.glyf.descs[:covered]...)
+			for len(descs) < numGlyphs {
+				descs = append(descs, &glyphDescription{})
+			}
+			fnt.glyf = &glyfTable{descs: descs}
+			regenerate = true
+		case covered < numGlyphs:
+			add("maxp", RepairNumGlyphs, "numGlyphs clamped from %d to %d", numGlyphs, covered)
+			sub, err := fnt.SubsetFirst(covered)
+			if err != nil {
+				return nil, err
+			}
+			fnt.font = sub.font
+			numGlyphs = covered
+			regenerate = true
+		case covered > numGlyphs:
+			add("glyf", RepairNumGlyphs, "%d glyphs beyond numGlyphs (%d) dropped", covered-numGlyphs, numGlyphs)
+			fnt.glyf = &glyfTable{descs: append([]*glyphDescription(nil), fnt.glyf.descs[:numGlyphs]...)}
+			regenerate = true
+		}
+		if fnt.loca == nil || regenerate {
+			add("loca", RepairLocaRegenerated, "loca table regenerated from %d glyphs", numGlyphs)
+			err := fnt.updateLocaFormat()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if fnt.post == nil {
+		add("post", RepairPostSynthesized, "post table synthesized")
+		fnt.post = fnt.synthesizePost()
+	}
+
+	if fnt.head.xMin > fnt.head.xMax || fnt.head.yMin > fnt.head.yMax {
+		h := *fnt.head
+		fnt.head.xMin, fnt.head.yMin, fnt.head.xMax, fnt.head.yMax = 0, 0, 0, 0
+		fnt.updateHeadBBox()
+		add("head", RepairHeadBBox, "invalid bounding box (%d,%d,%d,%d) replaced by (%d,%d,%d,%d)",
+			h.xMin, h.yMin, h.xMax, h.yMax, fnt.head.xMin, fnt.head.yMin, fnt.head.xMax, fnt.head.yMax)
+	}
+
+	if opts.DryRun || len(report.Fixes) == 0 {
+		return report, nil
+	}
+	f.font = fnt.font
+	f.locaRepaired = false
+	f.shortLocaGlyphs = 0
+	f.markDirty()
+	f.resetRuneLookupMap()
+	f.resetGlyphNameMap()
+	return report, nil
+}
@@ -0,0 +1,134 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// damagedTestFont returns FreeSans with an invalid head magic number and bounding box, numberOfHMetrics
+// exceeding numGlyphs and a loca table covering only `covered` glyphs, parsed leniently without post table.
+func damagedTestFont(t *testing.T, covered int) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.Equal(t, int16(1), fnt.head.indexToLocFormat)
+
+	head := fnt.trec.trMap["head"].offset
+	binary.BigEndian.PutUint32(data[head+12:], 0xDEADBEEF)
+	binary.BigEndian.PutUint16(data[head+36:], 500) // xMin
+	binary.BigEndian.PutUint16(data[head+40:], 0)   // xMax
+	hhea := fnt.trec.trMap["hhea"].offset
+	binary.BigEndian.PutUint16(data[hhea+34:], fnt.maxp.numGlyphs+1)
+	for i, tr := range fnt.trec.list {
+		if tr.tableTag.String() == "loca" {
+			binary.BigEndian.PutUint32(data[12+16*i+12:], uint32(4*(covered+1)))
+		}
+	}
+
+	_, err = ParseBytes(data)
+	require.Error(t, err)
+
+	damaged, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{RepairLoca: true, Lenient: true})
+	require.NoError(t, err)
+	damaged.post = nil
+	return damaged
+}
+
+// repairCodes returns the codes of the fixes of `report`.
+func repairCodes(report *RepairReport) []string {
+	var codes []string
+	for _, fix := range report.Fixes {
+		codes = append(codes, fix.Code)
+	}
+	return codes
+}
+
+func TestRepair(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	numGlyphs := int(fnt.maxp.numGlyphs)
+
+	// Fonts without defects are left alone.
+	report, err := fnt.Repair(RepairOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Fixes)
+	assert.False(t, fnt.isDirty("head"))
+
+	damaged := damagedTestFont(t, 3000)
+	warnings := damaged.ParseWarnings()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "head", warnings[0].Tag)
+
+	// A dry run reports the fixes without applying them.
+	report, err = damaged.Repair(RepairOptions{DryRun: true})
+	require.NoError(t, err)
+	// The bounding box is recomputed when clamping the glyphs.
+	expected := []string{RepairHeadMagicNumber, RepairHMetricsCount, RepairNumGlyphs, RepairLocaRegenerated,
+		RepairPostSynthesized}
+	assert.Equal(t, expected, repairCodes(report))
+	assert.Equal(t, uint32(0xDEADBEEF), damaged.head.magicNumber)
+	assert.Equal(t, numGlyphs, int(damaged.maxp.numGlyphs))
+	assert.Nil(t, damaged.post)
+
+	report, err = damaged.Repair(RepairOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, repairCodes(report))
+	for _, fix := range report.Fixes {
+		t.Logf("%s", fix)
+	}
+	assert.Equal(t, 3000, int(damaged.maxp.numGlyphs))
+	assert.Len(t, damaged.glyf.descs, 3000)
+	for i := 0; i < 3000; i++ {
+		assert.Equal(t, fnt.glyf.descs[i].raw, damaged.glyf.descs[i].raw, "%d", i)
+	}
+	assert.NotNil(t, damaged.post)
+	assert.True(t, damaged.head.xMin <= damaged.head.xMax)
+
+	// Repairing again finds nothing to fix.
+	report, err = damaged.Repair(RepairOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Fixes)
+
+	data, err := damaged.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	repaired, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, 3000, int(repaired.maxp.numGlyphs))
+	assert.Equal(t, uint32(0x5F0F3CF5), repaired.head.magicNumber)
+	assert.True(t, len(repaired.hmtx.hMetrics) <= 3000)
+}
+
+func TestRepairPadGlyphs(t *testing.T) {
+	damaged := damagedTestFont(t, 3000)
+	numGlyphs := int(damaged.maxp.numGlyphs)
+
+	report, err := damaged.Repair(RepairOptions{PadGlyphs: true})
+	require.NoError(t, err)
+	expected := []string{RepairHeadMagicNumber, RepairHMetricsCount, RepairGlyphsPadded, RepairLocaRegenerated,
+		RepairPostSynthesized, RepairHeadBBox}
+	assert.Equal(t, expected, repairCodes(report))
+	assert.Equal(t, numGlyphs, int(damaged.maxp.numGlyphs))
+	for i := 3000; i < numGlyphs; i++ {
+		assert.Empty(t, damaged.glyf.descs[i].raw, "%d", i)
+	}
+
+	data, err := damaged.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	repaired, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, numGlyphs, int(repaired.maxp.numGlyphs))
+}
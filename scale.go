@@ -0,0 +1,201 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"errors"
+	"math"
+)
+
+// ScaleUnitsPerEm scales `f` from its unitsPerEm to `target` units per em, e.g. for using fonts of 1000 and
+// 2048 units per em with consistent metrics. The coordinates of the glyph outlines and the offsets of the
+// components of composite glyphs are scaled, while the 2.14 scale factors of the components are kept. Also scaled
+// are the hmtx and vmtx metrics, the bounding box of the head table, the vertical metrics of the hhea, vhea and
+// OS/2 tables, the underline of the post table, the control values of the cvt table and the values of the kern
+// table. All values are rounded half up to integers. The values of other tables such as GPOS are not scaled.
+// An error is returned if `target` is not within 16 to 16384 as required by the specification, if `f` has no
+// head table, ErrCFFOutlinesUnsupported if `f` has CFF outlines, or if `f` is a variable font.
+func (f *Font) ScaleUnitsPerEm(target uint16) error {
+	if target < 16 || target > 16384 {
+		logger.Debugf("unitsPerEm out of range (%d)", target)
+		return errRangeCheck
+	}
+	if f.head == nil {
+		return ErrRequiredTableMissing{Tag: "head"}
+	}
+	if f.cff != nil {
+		return ErrCFFOutlinesUnsupported
+	}
+	if f.gvar != nil || f.fvar != nil {
+		return errors.New("scaling variable fonts is not supported")
+	}
+	if f.head.unitsPerEm == target {
+		return nil
+	}
+	if f.head.unitsPerEm == 0 {
+		logger.Debugf("Invalid unitsPerEm: 0")
+		return errRangeCheck
+	}
+	f.markDirty()
+
+	scale := float64(target) / float64(f.head.unitsPerEm)
+	round := func(v float64) float64 {
+		return math.Floor(v*scale + 0.5)
+	}
+	s16 := func(v int16) int16 {
+		return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, round(float64(v)))))
+	}
+	u16 := func(v uint16) uint16 {
+		return uint16(math.Min(math.MaxUint16, round(float64(v))))
+	}
+
+	if f.glyf != nil {
+		err := f.glyf.loadAll()
+		if err != nil {
+			return err
+		}
+		descs := make([]*glyphDescription, len(f.glyf.descs))
+		for gid, gd := range f.glyf.descs {
+			if gd == nil {
+				descs[gid] = &glyphDescription{}
+				continue
+			}
+			raw, err := scaleGlyph(gd.raw, round)
+			if err != nil {
+				logger.Debugf("Error scaling glyph %d: %v", gid, err)
+				return err
+			}
+			descs[gid] = &glyphDescription{raw: raw}
+		}
+		f.glyf = &glyfTable{descs: descs}
+		err = f.updateLocaFormat()
+		if err != nil {
+			return err
+		}
+		f.updateHeadBBox()
+		f.recomputeMaxp()
+	} else {
+		f.head.xMin, f.head.yMin, f.head.xMax, f.head.yMax = s16(f.head.xMin), s16(f.head.yMin), s16(f.head.xMax),
+			s16(f.head.yMax)
+	}
+	f.head.unitsPerEm = target
+
+	if f.hmtx != nil {
+		hmtx := f.hmtx.Clone()
+		for i, m := range hmtx.hMetrics {
+			hmtx.hMetrics[i] = longHorMetric{advanceWidth: u16(m.advanceWidth), lsb: s16(m.lsb)}
+		}
+		for i, lsb := range hmtx.leftSideBearings {
+			hmtx.leftSideBearings[i] = s16(lsb)
+		}
+		f.hmtx = hmtx
+	}
+	if f.vmtx != nil {
+		vmtx := f.vmtx.Clone()
+		for i, m := range vmtx.vMetrics {
+			vmtx.vMetrics[i] = longVerMetric{advanceHeight: u16(m.advanceHeight), tsb: s16(m.tsb)}
+		}
+		for i, tsb := range vmtx.topSideBearings {
+			vmtx.topSideBearings[i] = s16(tsb)
+		}
+		f.vmtx = vmtx
+	}
+
+	if t := f.hhea; t != nil {
+		t.ascender, t.descender, t.lineGap = fword(s16(int16(t.ascender))), fword(s16(int16(t.descender))),
+			fword(s16(int16(t.lineGap)))
+		t.caretOffset = s16(t.caretOffset)
+		f.recomputeHhea()
+	}
+	if t := f.vhea; t != nil {
+		t.vertTypoAscender = fword(s16(int16(t.vertTypoAscender)))
+		t.vertTypoDescender = fword(s16(int16(t.vertTypoDescender)))
+		t.vertTypoLineGap = fword(s16(int16(t.vertTypoLineGap)))
+		t.advanceHeightMax = ufword(u16(uint16(t.advanceHeightMax)))
+		t.minTopSideBearing = fword(s16(int16(t.minTopSideBearing)))
+		t.minBottomSideBearing = fword(s16(int16(t.minBottomSideBearing)))
+		t.yMaxExtent = fword(s16(int16(t.yMaxExtent)))
+		t.caretOffset = s16(t.caretOffset)
+	}
+	if t := f.os2; t != nil {
+		t.xAvgCharWidth = s16(t.xAvgCharWidth)
+		t.ySubscriptXSize, t.ySubscriptYSize = s16(t.ySubscriptXSize), s16(t.ySubscriptYSize)
+		t.ySubscriptXOffset, t.ySubscriptYOffset = s16(t.ySubscriptXOffset), s16(t.ySubscriptYOffset)
+		t.ySuperscriptXSize, t.ySuperscriptYSize = s16(t.ySuperscriptXSize), s16(t.ySuperscriptYSize)
+		t.ySuperscriptXOffset, t.ySuperscriptYOffset = s16(t.ySuperscriptXOffset), s16(t.ySuperscriptYOffset)
+		t.yStrikeoutSize, t.yStrikeoutPosition = s16(t.yStrikeoutSize), s16(t.yStrikeoutPosition)
+		t.sTypoAscender, t.sTypoDescender, t.sTypoLineGap = s16(t.sTypoAscender), s16(t.sTypoDescender),
+			s16(t.sTypoLineGap)
+		t.usWinAscent, t.usWinDescent = u16(t.usWinAscent), u16(t.usWinDescent)
+		t.sxHeight, t.sCapHeight = s16(t.sxHeight), s16(t.sCapHeight)
+	}
+	if t := f.post; t != nil {
+		t.underlinePosition = fword(s16(int16(t.underlinePosition)))
+		t.underlineThickness = fword(s16(int16(t.underlineThickness)))
+	}
+	if f.cvt != nil {
+		cvt := f.cvt.Clone()
+		for i, v := range cvt.controlValues {
+			cvt.controlValues[i] = s16(v)
+		}
+		f.cvt = cvt
+	}
+	if f.kern != nil {
+		data := f.kern.scaledData(s16)
+		kern, err := parseKernData(data)
+		if err != nil {
+			return err
+		}
+		f.setRawTableData("kern", data)
+		f.kern = kern
+	}
+	return nil
+}
+
+// scaleGlyph returns the glyph description `raw` with the coordinates mapped by `round`. The offsets of the
+// components of composite glyphs are mapped, their transformations are kept.
+func scaleGlyph(raw []byte, round func(v float64) float64) ([]byte, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+	gd := &glyphDescription{raw: raw}
+	err := gd.parse()
+	if err != nil {
+		return nil, err
+	}
+	if gd.header.numberOfContours == 0 {
+		return raw, nil
+	}
+
+	if gd.IsSimple() {
+		g, err := decodeSimpleGlyph(raw)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range g.points {
+			g.points[i].x, g.points[i].y = int(round(float64(p.x))), int(round(float64(p.y)))
+		}
+		g.header.xMin, g.header.yMin, g.header.xMax, g.header.yMax = g.bounds()
+		return g.encode(), nil
+	}
+	if gd.composite == nil {
+		return raw, nil
+	}
+
+	h := *gd.header
+	h.xMin, h.yMin = int16(round(float64(h.xMin))), int16(round(float64(h.yMin)))
+	h.xMax, h.yMax = int16(round(float64(h.xMax))), int16(round(float64(h.yMax)))
+	for i, comp := range gd.composite.components {
+		// Components positioned by matching points rather than by offsets are kept.
+		dx, dy, isOffset := comp.offset()
+		if !isOffset {
+			continue
+		}
+		gd.composite.components[i].argument1 = uint16(int16(round(dx)))
+		gd.composite.components[i].argument2 = uint16(int16(round(dy)))
+	}
+	return gd.composite.encode(h), nil
+}
@@ -0,0 +1,97 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaleUnitsPerEm(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	var kernData []byte
+	kernData = append(kernData, 0, 0, 0, 1)
+	kernData = append(kernData, kernFormat0Data(0x0001, []kernPair{{3, 4, -50}, {1, 2, -101}, {5, 6, 10}})...)
+	kern, err := parseKernData(kernData)
+	require.NoError(t, err)
+	fnt.setRawTableData("kern", kernData)
+	fnt.kern = kern
+
+	// Doubling keeps the values exact.
+	scaled := &Font{font: fnt.font.clone()}
+	err = scaled.ScaleUnitsPerEm(2000)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, scaled.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	scaled, err = parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	unitsPerEm, _ := scaled.UnitsPerEm()
+	assert.Equal(t, 2000, unitsPerEm)
+	bbox, _ := fnt.BoundingBox()
+	scaledBBox, _ := scaled.BoundingBox()
+	assert.Equal(t, BBox{XMin: 2 * bbox.XMin, YMin: 2 * bbox.YMin, XMax: 2 * bbox.XMax, YMax: 2 * bbox.YMax}, scaledBBox)
+	assert.Equal(t, 2*fnt.hhea.ascender, scaled.hhea.ascender)
+	assert.Equal(t, 2*fnt.os2.sTypoDescender, scaled.os2.sTypoDescender)
+	assert.Equal(t, 2*fnt.post.underlinePosition, scaled.post.underlinePosition)
+
+	for _, r := range "AOÅé" {
+		gid, has := fnt.LookupRune(r)
+		require.True(t, has)
+		o, err := fnt.GlyphOutline(gid)
+		require.NoError(t, err)
+		for _, c := range o.Contours {
+			for i := range c {
+				c[i].X *= 2
+				c[i].Y *= 2
+			}
+		}
+		scaledOutline, err := scaled.GlyphOutline(gid)
+		require.NoError(t, err)
+		assert.Equal(t, o, scaledOutline, string(r))
+
+		advance, err := fnt.GlyphAdvance(gid)
+		require.NoError(t, err)
+		scaledAdvance, err := scaled.GlyphAdvance(gid)
+		require.NoError(t, err)
+		assert.Equal(t, 2*advance, scaledAdvance)
+	}
+
+	// The 2.14 scale factors of composite components are kept.
+	gid, _ := fnt.LookupRune('Å')
+	require.NoError(t, fnt.glyf.descs[gid].parse())
+	scaledDesc := &glyphDescription{raw: scaled.glyf.descs[gid].raw}
+	require.NoError(t, scaledDesc.parse())
+	for i, comp := range fnt.glyf.descs[gid].composite.components {
+		scaledComp := scaledDesc.composite.components[i]
+		assert.Equal(t, comp.scale, scaledComp.scale)
+		dx, dy, _ := comp.offset()
+		scaledDX, scaledDY, _ := scaledComp.offset()
+		assert.Equal(t, [2]float64{2 * dx, 2 * dy}, [2]float64{scaledDX, scaledDY})
+	}
+
+	// The values of the kern table are scaled.
+	require.NotNil(t, scaled.kern)
+	assert.Equal(t, map[[2]GlyphIndex]int16{{1, 2}: -202, {3, 4}: -100, {5, 6}: 20}, scaled.kern.pairs())
+
+	// Rounded half up.
+	scaled = &Font{font: fnt.font.clone()}
+	require.NoError(t, scaled.ScaleUnitsPerEm(2048))
+	gid, _ = fnt.LookupRune('A')
+	advance, _ := fnt.GlyphAdvance(gid)
+	scaledAdvance, _ := scaled.GlyphAdvance(gid)
+	assert.Equal(t, uint16(float64(advance)*2.048+0.5), scaledAdvance)
+
+	assert.Error(t, scaled.ScaleUnitsPerEm(8))
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "head"}, (&Font{font: &font{}}).ScaleUnitsPerEm(1000))
+}
@@ -0,0 +1,108 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// avarTable represents the axis variations (avar) table, modifying the normalization of the axis
+// coordinates of variable fonts with a piecewise linear segment map per axis. The table itself is
+// preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/avar
+type avarTable struct {
+	segmentMaps [][]avarMapping // segment map per axis in fvar order.
+}
+
+// avarMapping maps the normalized coordinate `from` to `to`.
+type avarMapping struct {
+	from float64
+	to   float64
+}
+
+// parseAvar parses the avar table from the data of the raw avar table, if present.
+// Malformed avar tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseAvar() *avarTable {
+	data := f.rawTableData("avar")
+	if data == nil {
+		logger.Debugf("avar table absent")
+		return nil
+	}
+
+	t, err := parseAvarData(data)
+	if err != nil {
+		logger.Debugf("Error parsing avar table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseAvarData parses avar table `data`.
+func parseAvarData(data []byte) (*avarTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var majorVersion, minorVersion, reserved, axisCount uint16
+	err := r.read(&majorVersion, &minorVersion, &reserved, &axisCount)
+	if err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 {
+		logger.Debugf("Unsupported avar version %d.%d", majorVersion, minorVersion)
+		return nil, errRangeCheck
+	}
+
+	t := &avarTable{
+		segmentMaps: make([][]avarMapping, axisCount),
+	}
+	for i := range t.segmentMaps {
+		var positionMapCount uint16
+		err = r.read(&positionMapCount)
+		if err != nil {
+			return nil, err
+		}
+		if r.Offset()+4*int64(positionMapCount) > int64(len(data)) {
+			logger.Debugf("avar segment map out of range")
+			return nil, errRangeCheck
+		}
+		mappings := make([]avarMapping, positionMapCount)
+		for j := range mappings {
+			var from, to f2dot14
+			err = r.read(&from, &to)
+			if err != nil {
+				return nil, err
+			}
+			mappings[j] = avarMapping{from: from.Float64(), to: to.Float64()}
+		}
+		t.segmentMaps[i] = mappings
+	}
+	return t, nil
+}
+
+// mapCoord maps the normalized coordinate `v` of axis `axis` through its segment map. Coordinates are
+// returned unchanged if the axis has no valid segment map.
+func (t *avarTable) mapCoord(axis int, v float64) float64 {
+	if axis >= len(t.segmentMaps) {
+		return v
+	}
+	m := t.segmentMaps[axis]
+	if len(m) < 2 {
+		return v
+	}
+	if v <= m[0].from {
+		return v - m[0].from + m[0].to
+	}
+	for i := 1; i < len(m); i++ {
+		if v < m[i].from {
+			prev := m[i-1]
+			if m[i].from == prev.from {
+				return prev.to
+			}
+			return prev.to + (m[i].to-prev.to)*(v-prev.from)/(m[i].from-prev.from)
+		}
+	}
+	last := m[len(m)-1]
+	return v - last.from + last.to
+}
@@ -0,0 +1,55 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestAvar returns an avar table for two axes, mapping 0.5 to 0.25 on the first axis and with an empty
+// segment map for the second.
+func buildTestAvar() []byte {
+	buf, write := testWriter()
+	write(uint16(1), uint16(0), uint16(0), uint16(2))
+	write(uint16(4), int16(-0x4000), int16(-0x4000), int16(0), int16(0), int16(0x2000), int16(0x1000),
+		int16(0x4000), int16(0x4000))
+	write(uint16(0))
+	return buf.Bytes()
+}
+
+func TestAvarTable(t *testing.T) {
+	avar, err := parseAvarData(buildTestAvar())
+	require.NoError(t, err)
+	require.Len(t, avar.segmentMaps, 2)
+	assert.Equal(t, []avarMapping{{-1, -1}, {0, 0}, {0.5, 0.25}, {1, 1}}, avar.segmentMaps[0])
+	assert.Empty(t, avar.segmentMaps[1])
+
+	testcases := []struct {
+		axis     int
+		v        float64
+		expected float64
+	}{
+		{0, -1, -1},
+		{0, -0.5, -0.5},
+		{0, 0, 0},
+		{0, 0.25, 0.125},
+		{0, 0.5, 0.25},
+		{0, 0.75, 0.625},
+		{0, 1, 1},
+		{1, 0.5, 0.5},
+		{2, 0.5, 0.5},
+	}
+	for _, tcase := range testcases {
+		assert.Equal(t, tcase.expected, avar.mapCoord(tcase.axis, tcase.v), "axis %d %v", tcase.axis, tcase.v)
+	}
+
+	data := buildTestAvar()
+	_, err = parseAvarData(data[:len(data)-3])
+	assert.Error(t, err)
+}
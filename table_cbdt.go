@@ -0,0 +1,453 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// cbdtTable represents the color bitmap location (CBLC) and data (CBDT) tables, holding PNG images per glyph
+// in strikes of different sizes, as used by Google color emoji fonts. The index of the CBLC table is resolved
+// to the image data records of each glyph in the CBDT table. The tables themselves are preserved as raw tables
+// and written out verbatim, unless the glyphs are subsetted in which case they are re-encoded from the model.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/cblc
+// https://docs.microsoft.com/en-us/typography/opentype/spec/cbdt
+type cbdtTable struct {
+	majorVersion uint16 // 3, or 2 as used by early color bitmap fonts.
+	minorVersion uint16
+	strikes      []cbdtStrike
+}
+
+// cbdtStrike represents a BitmapSize record of the CBLC table along with its index subtables.
+type cbdtStrike struct {
+	colorRef  uint32
+	hori      []byte // SbitLineMetrics, kept as is.
+	vert      []byte // SbitLineMetrics, kept as is.
+	ppemX     uint8
+	ppemY     uint8
+	bitDepth  uint8
+	flags     int8
+	subtables []cbdtIndexSubtable
+}
+
+// cbdtIndexSubtable represents an index subtable of the CBLC table, the images of a range of glyphs.
+type cbdtIndexSubtable struct {
+	imageFormat uint16
+	constant    bool   // images of the same size, with the metrics in the index (index formats 2 and 5).
+	imageSize   uint32 // constant only.
+	metrics     []byte // constant only, BigGlyphMetrics kept as is.
+	glyphs      []cbdtGlyph
+}
+
+// cbdtGlyph represents the image data record of a glyph in the CBDT table.
+type cbdtGlyph struct {
+	gid  GlyphIndex
+	data []byte
+}
+
+// Sizes of CBLC and CBDT structures.
+const (
+	cblcHeaderSize        = 8
+	cblcBitmapSizeSize    = 48
+	cblcLineMetricsSize   = 12
+	cbdtBigMetricsSize    = 8
+	cbdtSmallMetricsSize  = 5
+	cblcSubtableArraySize = 8
+)
+
+// parseCbdt parses the CBLC and CBDT tables from the data of the raw tables, if present.
+// Malformed tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseCbdt() *cbdtTable {
+	cblc := f.rawTableData("CBLC")
+	cbdt := f.rawTableData("CBDT")
+	if cblc == nil || cbdt == nil {
+		logger.Debugf("CBLC or CBDT table absent")
+		return nil
+	}
+
+	t, err := parseCbdtData(cblc, cbdt)
+	if err != nil {
+		logger.Debugf("Error parsing CBLC/CBDT tables: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseCbdtData parses the CBLC table `cblc` and the image data records referenced in the CBDT table `cbdt`.
+func parseCbdtData(cblc, cbdt []byte) (*cbdtTable, error) {
+	r := newByteReader(bytes.NewReader(cblc))
+
+	t := &cbdtTable{}
+	var numSizes uint32
+	err := r.read(&t.majorVersion, &t.minorVersion, &numSizes)
+	if err != nil {
+		return nil, err
+	}
+	if t.majorVersion != 2 && t.majorVersion != 3 {
+		logger.Debugf("Unsupported CBLC version %d.%d", t.majorVersion, t.minorVersion)
+		return nil, errRangeCheck
+	}
+	if cblcHeaderSize+cblcBitmapSizeSize*int64(numSizes) > int64(len(cblc)) {
+		logger.Debugf("CBLC bitmap sizes out of range")
+		return nil, errRangeCheck
+	}
+
+	t.strikes = make([]cbdtStrike, numSizes)
+	for i := range t.strikes {
+		s := &t.strikes[i]
+		err = r.SeekTo(cblcHeaderSize + cblcBitmapSizeSize*int64(i))
+		if err != nil {
+			return nil, err
+		}
+		var indexSubTableArrayOffset offset32
+		var indexTablesSize, numberOfIndexSubTables uint32
+		err = r.read(&indexSubTableArrayOffset, &indexTablesSize, &numberOfIndexSubTables, &s.colorRef)
+		if err != nil {
+			return nil, err
+		}
+		err = r.readBytes(&s.hori, cblcLineMetricsSize)
+		if err != nil {
+			return nil, err
+		}
+		err = r.readBytes(&s.vert, cblcLineMetricsSize)
+		if err != nil {
+			return nil, err
+		}
+		var startGlyphIndex, endGlyphIndex uint16
+		err = r.read(&startGlyphIndex, &endGlyphIndex, &s.ppemX, &s.ppemY, &s.bitDepth, &s.flags)
+		if err != nil {
+			return nil, err
+		}
+
+		arrayOffset := int64(indexSubTableArrayOffset)
+		if arrayOffset+cblcSubtableArraySize*int64(numberOfIndexSubTables) > int64(len(cblc)) {
+			logger.Debugf("CBLC index subtables of strike %d out of range", i)
+			return nil, errRangeCheck
+		}
+		s.subtables = make([]cbdtIndexSubtable, numberOfIndexSubTables)
+		for j := range s.subtables {
+			err = r.SeekTo(arrayOffset + cblcSubtableArraySize*int64(j))
+			if err != nil {
+				return nil, err
+			}
+			var firstGlyphIndex, lastGlyphIndex uint16
+			var additionalOffsetToIndexSubtable offset32
+			err = r.read(&firstGlyphIndex, &lastGlyphIndex, &additionalOffsetToIndexSubtable)
+			if err != nil {
+				return nil, err
+			}
+			if lastGlyphIndex < firstGlyphIndex {
+				logger.Debugf("Invalid CBLC index subtable range %d-%d", firstGlyphIndex, lastGlyphIndex)
+				return nil, errRangeCheck
+			}
+			err = r.SeekTo(arrayOffset + int64(additionalOffsetToIndexSubtable))
+			if err != nil {
+				return nil, err
+			}
+			s.subtables[j], err = parseCbdtIndexSubtable(r, cblc, cbdt, firstGlyphIndex, lastGlyphIndex)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseCbdtIndexSubtable parses the index subtable for the glyphs `first` to `last` at the current offset of
+// `r` in the CBLC table `cblc`, along with the image data records referenced in the CBDT table `cbdt`.
+func parseCbdtIndexSubtable(r *byteReader, cblc, cbdt []byte, first, last uint16) (cbdtIndexSubtable, error) {
+	var st cbdtIndexSubtable
+	var indexFormat uint16
+	var imageDataOffset offset32
+	err := r.read(&indexFormat, &st.imageFormat, &imageDataOffset)
+	if err != nil {
+		return st, err
+	}
+
+	numGlyphs := int(last) - int(first) + 1
+	imageData := func(gid uint16, start, end int64) error {
+		start += int64(imageDataOffset)
+		end += int64(imageDataOffset)
+		if start > end || end > int64(len(cbdt)) {
+			logger.Debugf("CBDT image data of glyph %d out of range", gid)
+			return errRangeCheck
+		}
+		if start < end {
+			st.glyphs = append(st.glyphs, cbdtGlyph{gid: GlyphIndex(gid), data: cbdt[start:end]})
+		}
+		return nil
+	}
+	checkSize := func(size int64) error {
+		if r.Offset()+size > int64(len(cblc)) {
+			logger.Debugf("CBLC index subtable format %d out of range", indexFormat)
+			return errRangeCheck
+		}
+		return nil
+	}
+
+	switch indexFormat {
+	case 1, 3:
+		// Offsets per glyph in the range.
+		var offsets []int64
+		if indexFormat == 1 {
+			err = checkSize(4 * int64(numGlyphs+1))
+			if err != nil {
+				return st, err
+			}
+			var sbitOffsets []offset32
+			err = r.readSlice(&sbitOffsets, numGlyphs+1)
+			for _, off := range sbitOffsets {
+				offsets = append(offsets, int64(off))
+			}
+		} else {
+			err = checkSize(2 * int64(numGlyphs+1))
+			if err != nil {
+				return st, err
+			}
+			var sbitOffsets []offset16
+			err = r.readSlice(&sbitOffsets, numGlyphs+1)
+			for _, off := range sbitOffsets {
+				offsets = append(offsets, int64(off))
+			}
+		}
+		if err != nil {
+			return st, err
+		}
+		for i := 0; i < numGlyphs; i++ {
+			err = imageData(first+uint16(i), offsets[i], offsets[i+1])
+			if err != nil {
+				return st, err
+			}
+		}
+	case 2, 5:
+		// Images of the same size with the metrics in the index.
+		st.constant = true
+		err = r.read(&st.imageSize)
+		if err != nil {
+			return st, err
+		}
+		err = r.readBytes(&st.metrics, cbdtBigMetricsSize)
+		if err != nil {
+			return st, err
+		}
+		gids := make([]uint16, 0, numGlyphs)
+		if indexFormat == 2 {
+			for i := 0; i < numGlyphs; i++ {
+				gids = append(gids, first+uint16(i))
+			}
+		} else {
+			var count uint32
+			err = r.read(&count)
+			if err != nil {
+				return st, err
+			}
+			err = checkSize(2 * int64(count))
+			if err != nil {
+				return st, err
+			}
+			err = r.readSlice(&gids, int(count))
+			if err != nil {
+				return st, err
+			}
+		}
+		for i, gid := range gids {
+			start := int64(i) * int64(st.imageSize)
+			err = imageData(gid, start, start+int64(st.imageSize))
+			if err != nil {
+				return st, err
+			}
+		}
+	case 4:
+		// Offsets per glyph ID for sparse glyph ranges.
+		var count uint32
+		err = r.read(&count)
+		if err != nil {
+			return st, err
+		}
+		err = checkSize(4 * (int64(count) + 1))
+		if err != nil {
+			return st, err
+		}
+		gids := make([]uint16, count+1)
+		offsets := make([]uint16, count+1)
+		for i := range gids {
+			err = r.read(&gids[i], &offsets[i])
+			if err != nil {
+				return st, err
+			}
+		}
+		for i := 0; i < int(count); i++ {
+			err = imageData(gids[i], int64(offsets[i]), int64(offsets[i+1]))
+			if err != nil {
+				return st, err
+			}
+		}
+	default:
+		logger.Debugf("Unsupported CBLC index subtable format %d", indexFormat)
+		return st, errRangeCheck
+	}
+	sort.Slice(st.glyphs, func(i, j int) bool {
+		return st.glyphs[i].gid < st.glyphs[j].gid
+	})
+	return st, nil
+}
+
+// encode returns the data of `t` as CBLC and CBDT tables. Index subtables with images of the same size are
+// written in index format 5, others in index format 1.
+func (t *cbdtTable) encode() (cblc, cbdt []byte) {
+	cbdt = appendUint16(nil, t.majorVersion, t.minorVersion)
+
+	// The index subtables of each strike, preceded by the index subtable array, follow the bitmap sizes.
+	var index []byte
+	offset := cblcHeaderSize + cblcBitmapSizeSize*len(t.strikes)
+	cblc = appendUint16(nil, t.majorVersion, t.minorVersion)
+	cblc = appendUint32(cblc, uint32(len(t.strikes)))
+	for _, s := range t.strikes {
+		arraySize := cblcSubtableArraySize * len(s.subtables)
+		array := make([]byte, 0, arraySize)
+		var subtables []byte
+		var startGlyphIndex, endGlyphIndex GlyphIndex
+		for i, st := range s.subtables {
+			first := st.glyphs[0].gid
+			last := st.glyphs[len(st.glyphs)-1].gid
+			if i == 0 || first < startGlyphIndex {
+				startGlyphIndex = first
+			}
+			if last > endGlyphIndex {
+				endGlyphIndex = last
+			}
+			array = appendUint16(array, uint16(first), uint16(last))
+			array = appendUint32(array, uint32(arraySize+len(subtables)))
+
+			imageDataOffset := uint32(len(cbdt))
+			if st.constant {
+				subtables = appendUint16(subtables, 5, st.imageFormat)
+				subtables = appendUint32(subtables, imageDataOffset, st.imageSize)
+				subtables = append(subtables, st.metrics...)
+				subtables = appendUint32(subtables, uint32(len(st.glyphs)))
+				for _, g := range st.glyphs {
+					subtables = appendUint16(subtables, uint16(g.gid))
+					cbdt = append(cbdt, g.data...)
+				}
+				if len(st.glyphs)%2 == 1 {
+					// Keep the index subtables 32-bit aligned.
+					subtables = appendUint16(subtables, 0)
+				}
+				continue
+			}
+
+			subtables = appendUint16(subtables, 1, st.imageFormat)
+			subtables = appendUint32(subtables, imageDataOffset)
+			j := 0
+			for gid := int(first); gid <= int(last); gid++ {
+				subtables = appendUint32(subtables, uint32(len(cbdt))-imageDataOffset)
+				if int(st.glyphs[j].gid) == gid {
+					cbdt = append(cbdt, st.glyphs[j].data...)
+					j++
+				}
+			}
+			subtables = appendUint32(subtables, uint32(len(cbdt))-imageDataOffset)
+		}
+
+		cblc = appendUint32(cblc, uint32(offset+len(index)), uint32(arraySize+len(subtables)),
+			uint32(len(s.subtables)), s.colorRef)
+		cblc = append(cblc, s.hori...)
+		cblc = append(cblc, s.vert...)
+		cblc = appendUint16(cblc, uint16(startGlyphIndex), uint16(endGlyphIndex))
+		cblc = append(cblc, s.ppemX, s.ppemY, s.bitDepth, byte(s.flags))
+		index = append(index, array...)
+		index = append(index, subtables...)
+	}
+	cblc = append(cblc, index...)
+	return cblc, cbdt
+}
+
+// glyphData returns the image data record of glyph `gid` in `s` along with its image format.
+// Returns nil if `gid` has no image in `s`.
+func (s *cbdtStrike) glyphData(gid GlyphIndex) ([]byte, uint16) {
+	for _, st := range s.subtables {
+		i := sort.Search(len(st.glyphs), func(i int) bool {
+			return st.glyphs[i].gid >= gid
+		})
+		if i < len(st.glyphs) && st.glyphs[i].gid == gid {
+			return st.glyphs[i].data, st.imageFormat
+		}
+	}
+	return nil, 0
+}
+
+// cbdtImage returns the PNG image of the image data record `data` of format `imageFormat`.
+func cbdtImage(data []byte, imageFormat uint16) ([]byte, error) {
+	var headerSize int
+	switch imageFormat {
+	case 17:
+		headerSize = cbdtSmallMetricsSize
+	case 18:
+		headerSize = cbdtBigMetricsSize
+	case 19:
+		headerSize = 0
+	default:
+		logger.Debugf("Unsupported CBDT image format %d", imageFormat)
+		return nil, errTypeCheck
+	}
+	if len(data) < headerSize+4 {
+		return nil, errRangeCheck
+	}
+	dataLen := binary.BigEndian.Uint32(data[headerSize:])
+	if int64(headerSize)+4+int64(dataLen) > int64(len(data)) {
+		logger.Debugf("CBDT image data out of range")
+		return nil, errRangeCheck
+	}
+	return data[headerSize+4 : headerSize+4+int(dataLen)], nil
+}
+
+// selectGlyphs returns a copy of `t` with only the images of the glyphs in `oldnew`, renumbered as per
+// `oldnew`. Index subtables and strikes without images are dropped.
+func (t *cbdtTable) selectGlyphs(oldnew map[GlyphIndex]GlyphIndex) *cbdtTable {
+	newt := &cbdtTable{
+		majorVersion: t.majorVersion,
+		minorVersion: t.minorVersion,
+	}
+	for _, s := range t.strikes {
+		ns := s
+		ns.subtables = nil
+		for _, st := range s.subtables {
+			nst := st
+			nst.glyphs = nil
+			for _, g := range st.glyphs {
+				if newgid, has := oldnew[g.gid]; has {
+					nst.glyphs = append(nst.glyphs, cbdtGlyph{gid: newgid, data: g.data})
+				}
+			}
+			if len(nst.glyphs) == 0 {
+				continue
+			}
+			sort.Slice(nst.glyphs, func(i, j int) bool {
+				return nst.glyphs[i].gid < nst.glyphs[j].gid
+			})
+			ns.subtables = append(ns.subtables, nst)
+		}
+		if len(ns.subtables) == 0 {
+			continue
+		}
+		sort.Slice(ns.subtables, func(i, j int) bool {
+			return ns.subtables[i].glyphs[0].gid < ns.subtables[j].glyphs[0].gid
+		})
+		newt.strikes = append(newt.strikes, ns)
+	}
+	return newt
+}
+
+// setCbdt sets the CBLC/CBDT tables of `f` to `t` and replaces the raw CBLC and CBDT tables by the encoding
+// of `t`.
+func (f *font) setCbdt(t *cbdtTable) {
+	cblc, cbdt := t.encode()
+	f.setRawTableData("CBLC", cblc)
+	f.setRawTableData("CBDT", cbdt)
+	f.cbdt = t
+}
@@ -0,0 +1,214 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cbdtTestImage17 returns a CBDT image data record of format 17 with small glyph metrics and `png`.
+func cbdtTestImage17(png ...byte) []byte {
+	b := []byte{10, 10, 0, 8, 10}
+	b = appendUint32(b, uint32(len(png)))
+	return append(b, png...)
+}
+
+// cbdtTestImage19 returns a CBDT image data record of format 19 with `png` padded to 8 bytes.
+func cbdtTestImage19(png ...byte) []byte {
+	b := appendUint32(nil, uint32(len(png)))
+	b = append(b, png...)
+	return append(b, make([]byte, 8-len(b))...)
+}
+
+// buildTestCbdt returns CBLC/CBDT tables with strikes of 20 and 40 ppem. The small strike has images of
+// format 17 for the glyphs 5 and 7 and images of format 19 with constant metrics for the glyphs 10 and 12,
+// the large strike has an image for glyph 5.
+func buildTestCbdt() *cbdtTable {
+	lineMetrics := []byte{16, 252, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	return &cbdtTable{
+		majorVersion: 3,
+		strikes: []cbdtStrike{
+			{
+				hori: lineMetrics, vert: lineMetrics, ppemX: 20, ppemY: 20, bitDepth: 32, flags: 1,
+				subtables: []cbdtIndexSubtable{
+					{
+						imageFormat: 17,
+						glyphs: []cbdtGlyph{
+							{gid: 5, data: cbdtTestImage17(20, 20)},
+							{gid: 7, data: cbdtTestImage17(21)},
+						},
+					},
+					{
+						imageFormat: 19,
+						constant:    true,
+						imageSize:   8,
+						metrics:     []byte{10, 10, 0, 8, 10, 0, 0, 0},
+						glyphs: []cbdtGlyph{
+							{gid: 10, data: cbdtTestImage19(22)},
+							{gid: 12, data: cbdtTestImage19(23, 23)},
+						},
+					},
+				},
+			},
+			{
+				hori: lineMetrics, vert: lineMetrics, ppemX: 40, ppemY: 40, bitDepth: 32, flags: 1,
+				subtables: []cbdtIndexSubtable{
+					{imageFormat: 17, glyphs: []cbdtGlyph{{gid: 5, data: cbdtTestImage17(40, 40, 40)}}},
+				},
+			},
+		},
+	}
+}
+
+// buildTestCbdtFont returns FreeSans with the CBLC/CBDT tables of buildTestCbdt.
+func buildTestCbdtFont(t *testing.T) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	cblc, cbdt := buildTestCbdt().encode()
+	fnt.rawTables = append(fnt.rawTables,
+		&rawTable{tableTag: makeTag("CBDT"), data: cbdt},
+		&rawTable{tableTag: makeTag("CBLC"), data: cblc},
+	)
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, fnt.cbdt)
+	return fnt
+}
+
+func TestCbdtGlyphBitmap(t *testing.T) {
+	fnt := buildTestCbdtFont(t)
+	assert.Equal(t, buildTestCbdt(), fnt.cbdt)
+
+	testcases := []struct {
+		gid      GlyphIndex
+		ppem     uint16
+		expected []byte
+	}{
+		{5, 12, []byte{20, 20}},
+		{5, 30, []byte{40, 40, 40}},
+		{5, 64, []byte{40, 40, 40}},
+		{7, 64, []byte{21}},
+		{10, 20, []byte{22}},
+		{12, 20, []byte{23, 23}},
+		{11, 20, nil},
+		{6, 20, nil},
+	}
+	for _, tcase := range testcases {
+		img, format, err := fnt.GlyphBitmap(tcase.gid, tcase.ppem)
+		require.NoError(t, err)
+		assert.Equal(t, tcase.expected, img, "%d %d", tcase.gid, tcase.ppem)
+		if tcase.expected != nil {
+			assert.Equal(t, "png", format)
+		}
+	}
+}
+
+func TestCbdtSubset(t *testing.T) {
+	fnt := buildTestCbdtFont(t)
+
+	t.Run("Subset", func(t *testing.T) {
+		subfnt, oldnew, err := fnt.Subset([]GlyphIndex{7, 12})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		// The large strike has no images left.
+		require.NotNil(t, subfnt.cbdt)
+		require.Len(t, subfnt.cbdt.strikes, 1)
+		assert.Len(t, subfnt.cbdt.strikes[0].subtables, 2)
+		img, _, err := subfnt.GlyphBitmap(oldnew[7], 40)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{21}, img)
+		img, _, err = subfnt.GlyphBitmap(oldnew[12], 40)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{23, 23}, img)
+	})
+
+	t.Run("SubsetKeepIndices", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{5, 10})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		require.Len(t, subfnt.cbdt.strikes, 2)
+		for _, gid := range []GlyphIndex{7, 12} {
+			img, _, err := subfnt.GlyphBitmap(gid, 20)
+			require.NoError(t, err)
+			assert.Nil(t, img)
+		}
+		img, _, err := subfnt.GlyphBitmap(10, 20)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{22}, img)
+	})
+
+	t.Run("SubsetFirst", func(t *testing.T) {
+		subfnt, err := fnt.SubsetFirst(11)
+		require.NoError(t, err)
+		require.Len(t, subfnt.cbdt.strikes, 2)
+		img, _, err := subfnt.GlyphBitmap(10, 20)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{22}, img)
+		img, _, err = subfnt.GlyphBitmap(12, 20)
+		require.NoError(t, err)
+		assert.Nil(t, img)
+	})
+}
+
+func TestCbdtIndexFormats(t *testing.T) {
+	image := cbdtTestImage17(1)
+	cbdt := appendUint16(nil, 3, 0)
+	for i := 0; i < 3; i++ {
+		cbdt = append(cbdt, image...)
+	}
+	imageSize := uint32(len(image))
+
+	// A strike with the glyphs 1-2 in index format 3, 4 and 6 in index format 4 and 8-9 in index format 2.
+	buf, write := testWriter()
+	write(uint16(3), uint16(0), uint32(1))
+	write(uint32(56), uint32(0), uint32(3), uint32(0))
+	write(make([]byte, 24), uint16(1), uint16(9), uint8(20), uint8(20), uint8(32), int8(1))
+	write(uint16(1), uint16(2), uint32(24), uint16(4), uint16(6), uint32(40), uint16(8), uint16(9), uint32(64))
+	write(uint16(3), uint16(17), uint32(4), uint16(0), uint16(imageSize), uint16(imageSize), uint16(0))
+	write(uint16(4), uint16(17), uint32(4+imageSize), uint32(2))
+	write(uint16(4), uint16(0), uint16(6), uint16(imageSize), uint16(0xFFFF), uint16(2*imageSize))
+	write(uint16(2), uint16(19), uint32(4), uint32(imageSize), make([]byte, 8))
+	cblc := buf.Bytes()
+
+	t1, err := parseCbdtData(cblc, cbdt)
+	require.NoError(t, err)
+	require.Len(t, t1.strikes, 1)
+	var gids []GlyphIndex
+	for _, st := range t1.strikes[0].subtables {
+		for _, g := range st.glyphs {
+			gids = append(gids, g.gid)
+			assert.Equal(t, image, g.data)
+		}
+	}
+	assert.Equal(t, []GlyphIndex{1, 4, 6, 8, 9}, gids)
+	assert.True(t, t1.strikes[0].subtables[2].constant)
+
+	// Re-encoded in index formats 1 and 5.
+	cblc2, cbdt2 := t1.encode()
+	t2, err := parseCbdtData(cblc2, cbdt2)
+	require.NoError(t, err)
+	assert.Equal(t, t1, t2)
+
+	_, err = parseCbdtData(cblc, cbdt[:len(cbdt)-1])
+	assert.Error(t, err)
+	_, err = parseCbdtData(cblc[:len(cblc)-4], cbdt)
+	assert.Error(t, err)
+}
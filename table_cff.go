@@ -0,0 +1,974 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// cffTable represents the Compact Font Format (CFF) table of OpenType fonts with PostScript outlines
+// (sfnt version 'OTTO'). The header, the Name, Top DICT, String and Global Subr INDEXes, the charset,
+// the CharStrings and the Private DICTs (with the FDArray and FDSelect of CID-keyed fonts) are decoded,
+// the charstrings themselves are not interpreted. The table itself is preserved as a raw table and written
+// out verbatim, unless the glyphs are subsetted in which case it is re-encoded from the model.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/cff
+// https://adobe-type-tools.github.io/font-tech-notes/pdfs/5176.CFF.pdf
+type cffTable struct {
+	major   uint8
+	minor   uint8
+	hdrSize uint8
+	offSize uint8
+
+	names       []string // font names from the Name INDEX.
+	topDict     cffDict  // Top DICT of the first font.
+	strings     [][]byte // String INDEX, custom strings with SIDs from 391.
+	globalSubrs [][]byte
+	charset     []uint16 // SID per glyph (CID for CID-keyed fonts).
+	charStrings [][]byte // charstring data per glyph.
+
+	predefinedCharset int         // 0-2 for the predefined charsets, -1 for a custom charset.
+	private           *cffPrivate // Private DICT of name-keyed fonts.
+
+	fdArray  []*cffFontDict // Font DICTs of CID-keyed fonts.
+	fdSelect []uint8        // Font DICT index per glyph of CID-keyed fonts.
+}
+
+// cffPrivate represents a Private DICT followed by its local subrs. The local subrs are located relative
+// to the start of the Private DICT, so the data is kept as is and moved as a whole.
+type cffPrivate struct {
+	dictSize int    // size of the Private DICT at the start of data.
+	data     []byte // Private DICT and local Subr INDEX.
+}
+
+// cffFontDict represents a Font DICT from the FDArray of CID-keyed fonts with its Private DICT.
+type cffFontDict struct {
+	dict    cffDict
+	private *cffPrivate
+}
+
+// cffDict represents a DICT, mapping operators to their operands. Two-byte operators (escape 12) are
+// keyed as 1200 + the second byte.
+type cffDict map[int][]float64
+
+// Top DICT operators.
+const (
+	cffOpCharset        = 15
+	cffOpEncoding       = 16
+	cffOpCharStrings    = 17
+	cffOpPrivate        = 18
+	cffOpCharstringType = 1206
+	cffOpROS            = 1230
+	cffOpFDArray        = 1236
+	cffOpFDSelect       = 1237
+)
+
+// cffOpSubrs is the Private DICT operator of the local subrs offset.
+const cffOpSubrs = 19
+
+// cffNumStandardStrings is the number of standard strings, custom strings in the String INDEX follow
+// with SIDs starting at this number.
+const cffNumStandardStrings = 391
+
+// parseCFF parses the CFF table from the data of the raw CFF table, if present.
+// Malformed CFF tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseCFF() *cffTable {
+	data := f.rawTableData("CFF")
+	if data == nil {
+		logger.Debugf("CFF table absent")
+		return nil
+	}
+
+	t, err := parseCFFData(data)
+	if err != nil {
+		logger.Debugf("Error parsing CFF table: %v - ignoring", err)
+		return nil
+	}
+	if f.maxp != nil && int(f.maxp.numGlyphs) != len(t.charStrings) {
+		logger.Debugf("CFF glyph count mismatch: %d != %d", len(t.charStrings), f.maxp.numGlyphs)
+	}
+	return t
+}
+
+// parseCFFData parses CFF table `data`.
+func parseCFFData(data []byte) (*cffTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+	t := &cffTable{}
+	err := r.read(&t.major, &t.minor, &t.hdrSize, &t.offSize)
+	if err != nil {
+		return nil, err
+	}
+	if t.major != 1 {
+		logger.Debugf("Unsupported CFF version %d.%d", t.major, t.minor)
+		return nil, errRangeCheck
+	}
+
+	names, err := parseCFFIndex(r, data, int64(t.hdrSize))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		t.names = append(t.names, string(name))
+	}
+	topDicts, err := parseCFFIndex(r, data, r.Offset())
+	if err != nil {
+		return nil, err
+	}
+	t.strings, err = parseCFFIndex(r, data, r.Offset())
+	if err != nil {
+		return nil, err
+	}
+	t.globalSubrs, err = parseCFFIndex(r, data, r.Offset())
+	if err != nil {
+		return nil, err
+	}
+	if len(topDicts) == 0 {
+		logger.Debugf("CFF Top DICT missing")
+		return nil, errRequiredField
+	}
+
+	t.topDict, err = parseCFFDict(topDicts[0])
+	if err != nil {
+		return nil, err
+	}
+	if v, has := t.topDict.int(cffOpCharstringType); has && v != 2 {
+		logger.Debugf("Unsupported charstring type: %d", v)
+		return nil, errRangeCheck
+	}
+
+	offset, has := t.topDict.int(cffOpCharStrings)
+	if !has {
+		logger.Debugf("CFF CharStrings missing")
+		return nil, errRequiredField
+	}
+	t.charStrings, err = parseCFFIndex(r, data, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	offset, _ = t.topDict.int(cffOpCharset)
+	t.charset, err = parseCFFCharset(r, offset, len(t.charStrings))
+	if err != nil {
+		return nil, err
+	}
+	t.predefinedCharset = -1
+	if offset <= 2 {
+		t.predefinedCharset = offset
+	}
+
+	t.private, err = parseCFFPrivate(r, data, t.topDict)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, has = t.topDict.int(cffOpFDArray)
+	if !t.isCIDKeyed() || !has {
+		return t, nil
+	}
+	fontDicts, err := parseCFFIndex(r, data, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	for _, fontDict := range fontDicts {
+		fd := &cffFontDict{}
+		fd.dict, err = parseCFFDict(fontDict)
+		if err != nil {
+			return nil, err
+		}
+		fd.private, err = parseCFFPrivate(r, data, fd.dict)
+		if err != nil {
+			return nil, err
+		}
+		t.fdArray = append(t.fdArray, fd)
+	}
+
+	offset, has = t.topDict.int(cffOpFDSelect)
+	if !has {
+		logger.Debugf("CFF FDSelect missing")
+		return nil, errRequiredField
+	}
+	t.fdSelect, err = parseCFFFDSelect(r, offset, len(t.charStrings), len(t.fdArray))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseCFFPrivate parses the Private DICT referenced by the Top or Font DICT `d` in CFF data `data`,
+// including the local subrs. Returns nil if `d` has no Private DICT.
+func parseCFFPrivate(r *byteReader, data []byte, d cffDict) (*cffPrivate, error) {
+	operands := d[cffOpPrivate]
+	if len(operands) < 2 {
+		return nil, nil
+	}
+	size := int(operands[0])
+	offset := int(operands[1])
+	if size < 0 || offset < 0 || offset+size > len(data) {
+		logger.Debugf("CFF Private DICT out of range")
+		return nil, errRangeCheck
+	}
+	dict, err := parseCFFDict(data[offset : offset+size])
+	if err != nil {
+		return nil, err
+	}
+
+	end := offset + size
+	if subrs, has := dict.int(cffOpSubrs); has {
+		if subrs < 0 {
+			logger.Debugf("CFF local subrs out of range")
+			return nil, errRangeCheck
+		}
+		_, err = parseCFFIndex(r, data, int64(offset+subrs))
+		if err != nil {
+			return nil, err
+		}
+		if subrsEnd := int(r.Offset()); subrsEnd > end {
+			end = subrsEnd
+		}
+	}
+	return &cffPrivate{dictSize: size, data: data[offset:end]}, nil
+}
+
+// parseCFFFDSelect parses the FDSelect at `offset` for `numGlyphs` glyphs and `numFDs` Font DICTs.
+func parseCFFFDSelect(r *byteReader, offset, numGlyphs, numFDs int) ([]uint8, error) {
+	err := r.SeekTo(int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	var format uint8
+	err = r.read(&format)
+	if err != nil {
+		return nil, err
+	}
+
+	fdSelect := make([]uint8, numGlyphs)
+	switch format {
+	case 0:
+		err = r.readBytes(&fdSelect, numGlyphs)
+		if err != nil {
+			return nil, err
+		}
+	case 3:
+		var nRanges, first uint16
+		err = r.read(&nRanges, &first)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < int(nRanges); i++ {
+			var fd uint8
+			var next uint16
+			err = r.read(&fd, &next)
+			if err != nil {
+				return nil, err
+			}
+			if next < first || int(next) > numGlyphs {
+				logger.Debugf("CFF FDSelect range out of range")
+				return nil, errRangeCheck
+			}
+			for gid := first; gid < next; gid++ {
+				fdSelect[gid] = fd
+			}
+			first = next
+		}
+	default:
+		logger.Debugf("Unsupported CFF FDSelect format: %d", format)
+		return nil, errRangeCheck
+	}
+
+	for _, fd := range fdSelect {
+		if int(fd) >= numFDs {
+			logger.Debugf("CFF FDSelect index out of range: %d >= %d", fd, numFDs)
+			return nil, errRangeCheck
+		}
+	}
+	return fdSelect, nil
+}
+
+// parseCFFIndex parses the INDEX at `offset` in CFF data `data`. On return `r` is positioned at the end
+// of the INDEX.
+func parseCFFIndex(r *byteReader, data []byte, offset int64) ([][]byte, error) {
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var count uint16
+	err = r.read(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	var offSize uint8
+	err = r.read(&offSize)
+	if err != nil {
+		return nil, err
+	}
+	if offSize < 1 || offSize > 4 {
+		logger.Debugf("Invalid CFF INDEX offset size: %d", offSize)
+		return nil, errRangeCheck
+	}
+
+	offsets := make([]int64, int(count)+1)
+	for i := range offsets {
+		var v int64
+		for j := 0; j < int(offSize); j++ {
+			var b uint8
+			err = r.read(&b)
+			if err != nil {
+				return nil, err
+			}
+			v = v<<8 | int64(b)
+		}
+		offsets[i] = v
+	}
+
+	// Offsets are relative to the byte preceding the object data.
+	base := r.Offset() - 1
+	if offsets[0] != 1 || base+offsets[count] > int64(len(data)) {
+		logger.Debugf("CFF INDEX out of range")
+		return nil, errRangeCheck
+	}
+	items := make([][]byte, count)
+	for i := range items {
+		if offsets[i+1] < offsets[i] {
+			logger.Debugf("CFF INDEX offsets not ascending")
+			return nil, errRangeCheck
+		}
+		items[i] = data[base+offsets[i] : base+offsets[i+1]]
+	}
+	return items, r.SeekTo(base + offsets[count])
+}
+
+// parseCFFDict parses the DICT `data`.
+func parseCFFDict(data []byte) (cffDict, error) {
+	d := cffDict{}
+	var operands []float64
+	for i := 0; i < len(data); {
+		b0 := data[i]
+		switch {
+		case b0 <= 21:
+			op := int(b0)
+			i++
+			if b0 == 12 {
+				if i >= len(data) {
+					return nil, errRangeCheck
+				}
+				op = 1200 + int(data[i])
+				i++
+			}
+			d[op] = operands
+			operands = nil
+			continue
+		case b0 == 28:
+			if i+3 > len(data) {
+				return nil, errRangeCheck
+			}
+			operands = append(operands, float64(int16(uint16(data[i+1])<<8|uint16(data[i+2]))))
+			i += 3
+		case b0 == 29:
+			if i+5 > len(data) {
+				return nil, errRangeCheck
+			}
+			v := int32(uint32(data[i+1])<<24 | uint32(data[i+2])<<16 | uint32(data[i+3])<<8 | uint32(data[i+4]))
+			operands = append(operands, float64(v))
+			i += 5
+		case b0 == 30:
+			v, n, err := parseCFFReal(data[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			operands = append(operands, v)
+			i += 1 + n
+		case b0 >= 32 && b0 <= 246:
+			operands = append(operands, float64(int(b0)-139))
+			i++
+		case b0 >= 247 && b0 <= 254:
+			if i+2 > len(data) {
+				return nil, errRangeCheck
+			}
+			v := (int(b0)-247)*256 + int(data[i+1]) + 108
+			if b0 >= 251 {
+				v = -(int(b0)-251)*256 - int(data[i+1]) - 108
+			}
+			operands = append(operands, float64(v))
+			i += 2
+		default:
+			logger.Debugf("Invalid CFF DICT byte: %d", b0)
+			return nil, errRangeCheck
+		}
+	}
+	return d, nil
+}
+
+// parseCFFReal parses the nibble encoded real number at the start of `data`. Returns the value and the
+// number of bytes consumed.
+func parseCFFReal(data []byte) (float64, int, error) {
+	var s []byte
+	for i, b := range data {
+		for _, nibble := range []byte{b >> 4, b & 0x0F} {
+			switch {
+			case nibble <= 9:
+				s = append(s, '0'+nibble)
+			case nibble == 0xA:
+				s = append(s, '.')
+			case nibble == 0xB:
+				s = append(s, 'E')
+			case nibble == 0xC:
+				s = append(s, 'E', '-')
+			case nibble == 0xE:
+				s = append(s, '-')
+			case nibble == 0xF:
+				v, err := strconv.ParseFloat(string(s), 64)
+				if err != nil {
+					return 0, 0, err
+				}
+				return v, i + 1, nil
+			default:
+				return 0, 0, errRangeCheck
+			}
+		}
+	}
+	logger.Debugf("Unterminated CFF real number")
+	return 0, 0, errRangeCheck
+}
+
+// int returns the first operand of `op` in `d` as an integer.
+func (d cffDict) int(op int) (int, bool) {
+	operands, has := d[op]
+	if !has || len(operands) == 0 {
+		return 0, false
+	}
+	return int(math.Round(operands[0])), true
+}
+
+// parseCFFCharset parses the charset at `offset` for `numGlyphs` glyphs. Offsets 0, 1 and 2 denote the
+// predefined ISOAdobe, Expert and ExpertSubset charsets.
+func parseCFFCharset(r *byteReader, offset, numGlyphs int) ([]uint16, error) {
+	charset := make([]uint16, numGlyphs)
+	switch offset {
+	case 0:
+		// ISOAdobe charset maps glyphs to the standard strings 0-228 in order.
+		for i := range charset {
+			if i > 228 {
+				break
+			}
+			charset[i] = uint16(i)
+		}
+		return charset, nil
+	case 1, 2:
+		logger.Debugf("Predefined expert charsets not supported")
+		return charset, nil
+	}
+
+	err := r.SeekTo(int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	var format uint8
+	err = r.read(&format)
+	if err != nil {
+		return nil, err
+	}
+
+	// .notdef is implied as the first glyph.
+	switch format {
+	case 0:
+		for i := 1; i < numGlyphs; i++ {
+			err = r.read(&charset[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	case 1, 2:
+		for i := 1; i < numGlyphs; {
+			var first, nLeft uint16
+			if format == 1 {
+				var n uint8
+				err = r.read(&first, &n)
+				nLeft = uint16(n)
+			} else {
+				err = r.read(&first, &nLeft)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for j := 0; j <= int(nLeft) && i < numGlyphs; j++ {
+				charset[i] = first + uint16(j)
+				i++
+			}
+		}
+	default:
+		logger.Debugf("Unsupported CFF charset format: %d", format)
+		return nil, errRangeCheck
+	}
+	return charset, nil
+}
+
+// cffEndchar is the charstring of an empty glyph.
+var cffEndchar = []byte{14}
+
+// cffOffsetOps are the operators with offset operands. Their operands are encoded in the fixed 5-byte form,
+// so that the size of the DICTs is known before the offsets are.
+var cffOffsetOps = map[int]bool{
+	cffOpCharset:     true,
+	cffOpCharStrings: true,
+	cffOpPrivate:     true,
+	cffOpFDArray:     true,
+	cffOpFDSelect:    true,
+}
+
+// encode returns the data of CFF table `t`. The table is laid out as: header, Name, Top DICT, String and
+// Global Subr INDEXes, charset, FDSelect, CharStrings, FDArray and the Private DICTs with their local
+// subrs. Only the first font of a FontSet is kept and a custom Encoding is dropped, as the cmap table
+// determines the encoding of OpenType fonts.
+func (t *cffTable) encode() ([]byte, error) {
+	if len(t.charStrings) == 0 {
+		logger.Debugf("CFF table without glyphs")
+		return nil, errRequiredField
+	}
+	if len(t.names) > 1 {
+		logger.Debugf("Keeping only the first of %d CFF fonts", len(t.names))
+	}
+	if t.fdArray != nil && len(t.fdSelect) != len(t.charStrings) {
+		logger.Debugf("CFF FDSelect length mismatch: %d != %d", len(t.fdSelect), len(t.charStrings))
+		return nil, errRangeCheck
+	}
+
+	header := []byte{t.major, t.minor, 4, t.offSize}
+	nameIndex := encodeCFFIndex([][]byte{[]byte(t.names[0])})
+	stringIndex := encodeCFFIndex(t.strings)
+	globalSubrIndex := encodeCFFIndex(t.globalSubrs)
+	var charsetData []byte
+	if t.predefinedCharset < 0 {
+		charsetData = encodeCFFCharset(t.charset)
+	}
+	var fdSelectData []byte
+	if t.fdArray != nil {
+		fdSelectData = encodeCFFFDSelect(t.fdSelect)
+	}
+	charStringIndex := encodeCFFIndex(t.charStrings)
+
+	var charsetOffset, fdSelectOffset, charStringsOffset, fdArrayOffset int
+	privateOffsets := make([]int, len(t.fdArray)+1) // Top DICT first, then the Font DICTs.
+
+	topDictIndex := func() []byte {
+		d := t.topDict.clone()
+		if v, has := d.int(cffOpEncoding); has && v > 1 {
+			delete(d, cffOpEncoding)
+		}
+		delete(d, cffOpCharset)
+		if charsetData != nil {
+			d[cffOpCharset] = []float64{float64(charsetOffset)}
+		} else if t.predefinedCharset > 0 {
+			d[cffOpCharset] = []float64{float64(t.predefinedCharset)}
+		}
+		d[cffOpCharStrings] = []float64{float64(charStringsOffset)}
+		d.setPrivate(t.private, privateOffsets[0])
+		delete(d, cffOpFDArray)
+		delete(d, cffOpFDSelect)
+		if t.fdArray != nil {
+			d[cffOpFDArray] = []float64{float64(fdArrayOffset)}
+			d[cffOpFDSelect] = []float64{float64(fdSelectOffset)}
+		}
+		return encodeCFFIndex([][]byte{d.encode()})
+	}
+	fdArrayIndex := func() []byte {
+		if t.fdArray == nil {
+			return nil
+		}
+		dicts := make([][]byte, len(t.fdArray))
+		for i, fd := range t.fdArray {
+			d := fd.dict.clone()
+			d.setPrivate(fd.private, privateOffsets[i+1])
+			dicts[i] = d.encode()
+		}
+		return encodeCFFIndex(dicts)
+	}
+
+	// The sizes of the DICTs do not depend on the offsets.
+	offset := len(header) + len(nameIndex) + len(topDictIndex()) + len(stringIndex) + len(globalSubrIndex)
+	charsetOffset = offset
+	offset += len(charsetData)
+	fdSelectOffset = offset
+	offset += len(fdSelectData)
+	charStringsOffset = offset
+	offset += len(charStringIndex)
+	fdArrayOffset = offset
+	offset += len(fdArrayIndex())
+	privates := []*cffPrivate{t.private}
+	for _, fd := range t.fdArray {
+		privates = append(privates, fd.private)
+	}
+	for i, p := range privates {
+		privateOffsets[i] = offset
+		if p != nil {
+			offset += len(p.data)
+		}
+	}
+
+	b := make([]byte, 0, offset)
+	b = append(b, header...)
+	b = append(b, nameIndex...)
+	b = append(b, topDictIndex()...)
+	b = append(b, stringIndex...)
+	b = append(b, globalSubrIndex...)
+	b = append(b, charsetData...)
+	b = append(b, fdSelectData...)
+	b = append(b, charStringIndex...)
+	b = append(b, fdArrayIndex()...)
+	for _, p := range privates {
+		if p != nil {
+			b = append(b, p.data...)
+		}
+	}
+	return b, nil
+}
+
+// encodeCFFIndex returns the INDEX of `items` with the smallest offset size.
+func encodeCFFIndex(items [][]byte) []byte {
+	if len(items) == 0 {
+		return []byte{0, 0}
+	}
+	size := 1
+	for _, item := range items {
+		size += len(item)
+	}
+	offSize := 1
+	for offSize < 4 && size >= 1<<uint(8*offSize) {
+		offSize++
+	}
+
+	b := []byte{byte(len(items) >> 8), byte(len(items)), byte(offSize)}
+	offset := 1
+	appendOffset := func() {
+		for i := offSize - 1; i >= 0; i-- {
+			b = append(b, byte(offset>>uint(8*i)))
+		}
+	}
+	appendOffset()
+	for _, item := range items {
+		offset += len(item)
+		appendOffset()
+	}
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+// clone returns a copy of `d`.
+func (d cffDict) clone() cffDict {
+	c := make(cffDict, len(d))
+	for op, operands := range d {
+		c[op] = append([]float64(nil), operands...)
+	}
+	return c
+}
+
+// setPrivate sets the Private operator of `d` to Private DICT `p` at `offset`, or removes it if `p` is nil.
+func (d cffDict) setPrivate(p *cffPrivate, offset int) {
+	delete(d, cffOpPrivate)
+	if p != nil {
+		d[cffOpPrivate] = []float64{float64(p.dictSize), float64(offset)}
+	}
+}
+
+// encode returns the DICT data of `d`. The ROS operator comes first as required for CID-keyed fonts,
+// the other operators follow in ascending order. The operands of offset operators use the fixed 5-byte
+// integer form.
+func (d cffDict) encode() []byte {
+	ops := make([]int, 0, len(d))
+	for op := range d {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i] == cffOpROS || ops[j] == cffOpROS {
+			return ops[i] == cffOpROS && ops[j] != cffOpROS
+		}
+		return ops[i] < ops[j]
+	})
+
+	var b []byte
+	for _, op := range ops {
+		for _, v := range d[op] {
+			switch {
+			case cffOffsetOps[op]:
+				iv := int32(v)
+				b = append(b, 29, byte(iv>>24), byte(iv>>16), byte(iv>>8), byte(iv))
+			case v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32:
+				b = appendCFFInt(b, int(v))
+			default:
+				b = appendCFFReal(b, v)
+			}
+		}
+		if op >= 1200 {
+			b = append(b, 12, byte(op-1200))
+		} else {
+			b = append(b, byte(op))
+		}
+	}
+	return b
+}
+
+// appendCFFInt appends the shortest DICT encoding of integer `v` to `b`.
+func appendCFFInt(b []byte, v int) []byte {
+	switch {
+	case v >= -107 && v <= 107:
+		return append(b, byte(v+139))
+	case v >= 108 && v <= 1131:
+		v -= 108
+		return append(b, byte(v>>8+247), byte(v))
+	case v >= -1131 && v <= -108:
+		v = -v - 108
+		return append(b, byte(v>>8+251), byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return append(b, 28, byte(v>>8), byte(v))
+	}
+	return append(b, 29, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendCFFReal appends the nibble encoding of real number `v` to `b`.
+func appendCFFReal(b []byte, v float64) []byte {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	var nibbles []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			nibbles = append(nibbles, c-'0')
+		case c == '.':
+			nibbles = append(nibbles, 0xA)
+		case c == '-':
+			nibbles = append(nibbles, 0xE)
+		case c == 'e':
+			if i+1 < len(s) && s[i+1] == '-' {
+				nibbles = append(nibbles, 0xC)
+				i++
+			} else {
+				nibbles = append(nibbles, 0xB)
+				if i+1 < len(s) && s[i+1] == '+' {
+					i++
+				}
+			}
+		}
+	}
+	nibbles = append(nibbles, 0xF)
+	if len(nibbles)%2 != 0 {
+		nibbles = append(nibbles, 0xF)
+	}
+
+	b = append(b, 30)
+	for i := 0; i < len(nibbles); i += 2 {
+		b = append(b, nibbles[i]<<4|nibbles[i+1])
+	}
+	return b
+}
+
+// encodeCFFCharset returns the custom charset data of `charset` in format 0 or 2, whichever is smaller.
+func encodeCFFCharset(charset []uint16) []byte {
+	format0 := []byte{0}
+	format2 := []byte{2}
+	for i := 1; i < len(charset); i++ {
+		format0 = append(format0, byte(charset[i]>>8), byte(charset[i]))
+	}
+	for i := 1; i < len(charset); {
+		first := charset[i]
+		nLeft := 0
+		for i+nLeft+1 < len(charset) && nLeft < 0xFFFF && charset[i+nLeft+1] == first+uint16(nLeft+1) {
+			nLeft++
+		}
+		format2 = append(format2, byte(first>>8), byte(first), byte(nLeft>>8), byte(nLeft))
+		i += nLeft + 1
+	}
+	if len(format2) < len(format0) {
+		return format2
+	}
+	return format0
+}
+
+// encodeCFFFDSelect returns the FDSelect data of `fdSelect` in format 3.
+func encodeCFFFDSelect(fdSelect []uint8) []byte {
+	var ranges []byte
+	nRanges := 0
+	for i, fd := range fdSelect {
+		if i == 0 || fd != fdSelect[i-1] {
+			ranges = append(ranges, byte(i>>8), byte(i), fd)
+			nRanges++
+		}
+	}
+	b := []byte{3, byte(nRanges >> 8), byte(nRanges)}
+	b = append(b, ranges...)
+	return append(b, byte(len(fdSelect)>>8), byte(len(fdSelect)))
+}
+
+// stubGlyphs returns a copy of `t` with the charstrings of the glyphs for which `keep` returns false
+// replaced by empty glyphs. The GIDs are maintained. The subrs are kept as is.
+func (t *cffTable) stubGlyphs(keep func(gid GlyphIndex) bool) *cffTable {
+	newt := *t
+	newt.charStrings = make([][]byte, len(t.charStrings))
+	for i, cs := range t.charStrings {
+		if keep(GlyphIndex(i)) {
+			newt.charStrings[i] = cs
+		} else {
+			newt.charStrings[i] = cffEndchar
+		}
+	}
+	return &newt
+}
+
+// selectGlyphs returns a copy of `t` with only the glyphs `gids` in that order, renumbered from 0 up.
+// The charset and FDSelect follow the glyphs. The subrs are kept as is.
+func (t *cffTable) selectGlyphs(gids []GlyphIndex) *cffTable {
+	newt := *t
+	newt.charStrings = make([][]byte, len(gids))
+	newt.charset = make([]uint16, len(gids))
+	if t.fdArray != nil {
+		newt.fdSelect = make([]uint8, len(gids))
+	}
+
+	renumbered := false
+	for i, gid := range gids {
+		if gid != GlyphIndex(i) {
+			renumbered = true
+		}
+		if int(gid) >= len(t.charStrings) {
+			logger.Debugf("CFF GID out of range (%d >= %d) - using empty glyph", gid, len(t.charStrings))
+			newt.charStrings[i] = cffEndchar
+			continue
+		}
+		newt.charStrings[i] = t.charStrings[gid]
+		newt.charset[i] = t.charset[gid]
+		if t.fdArray != nil {
+			newt.fdSelect[i] = t.fdSelect[gid]
+		}
+	}
+
+	// The predefined charsets only remain valid when the glyphs are truncated.
+	if renumbered && t.predefinedCharset >= 0 {
+		if t.predefinedCharset > 0 {
+			logger.Debugf("Glyph names of predefined expert charset lost in subset")
+		}
+		newt.predefinedCharset = -1
+	}
+	return &newt
+}
+
+// setCFF sets the CFF table of `f` to `t` and replaces the raw CFF table by the encoding of `t`.
+func (f *font) setCFF(t *cffTable) error {
+	data, err := t.encode()
+	if err != nil {
+		return err
+	}
+	f.setRawTableData("CFF", data)
+	f.cff = t
+	return nil
+}
+
+// isCIDKeyed returns true if `t` is a CID-keyed font, in which case the charset maps glyphs to CIDs.
+func (t *cffTable) isCIDKeyed() bool {
+	_, has := t.topDict[cffOpROS]
+	return has
+}
+
+// glyphName returns the name of glyph `gid` from the charset of `t`. Glyphs of CID-keyed fonts are named
+// by their CID as "cidNNNNN".
+func (t *cffTable) glyphName(gid GlyphIndex) (GlyphName, error) {
+	if int(gid) >= len(t.charset) {
+		logger.Debugf("GID out of range: %d >= %d", gid, len(t.charset))
+		return "", errRangeCheck
+	}
+	sid := int(t.charset[gid])
+	if t.isCIDKeyed() {
+		return GlyphName(fmt.Sprintf("cid%05d", sid)), nil
+	}
+	if sid < cffNumStandardStrings {
+		return GlyphName(cffStandardStrings[sid]), nil
+	}
+	if sid-cffNumStandardStrings >= len(t.strings) {
+		logger.Debugf("SID out of range: %d", sid)
+		return "", errRangeCheck
+	}
+	return GlyphName(t.strings[sid-cffNumStandardStrings]), nil
+}
+
+// glyphNames returns the names of all glyphs of `t`. Glyphs that cannot be named get an empty name.
+func (t *cffTable) glyphNames() []GlyphName {
+	names := make([]GlyphName, len(t.charset))
+	for i := range names {
+		names[i], _ = t.glyphName(GlyphIndex(i))
+	}
+	return names
+}
+
+// cffStandardStrings are the predefined strings of CFF with SIDs 0-390.
+var cffStandardStrings = [cffNumStandardStrings]string{
+	".notdef", "space", "exclam", "quotedbl", "numbersign", "dollar", "percent", "ampersand", "quoteright",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen", "period", "slash", "zero", "one", "two",
+	"three", "four", "five", "six", "seven", "eight", "nine", "colon", "semicolon", "less", "equal", "greater",
+	"question", "at", "A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O", "P", "Q", "R",
+	"S", "T", "U", "V", "W", "X", "Y", "Z", "bracketleft", "backslash", "bracketright", "asciicircum",
+	"underscore", "quoteleft", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p",
+	"q", "r", "s", "t", "u", "v", "w", "x", "y", "z", "braceleft", "bar", "braceright", "asciitilde",
+	"exclamdown", "cent", "sterling", "fraction", "yen", "florin", "section", "currency", "quotesingle",
+	"quotedblleft", "guillemotleft", "guilsinglleft", "guilsinglright", "fi", "fl", "endash", "dagger",
+	"daggerdbl", "periodcentered", "paragraph", "bullet", "quotesinglbase", "quotedblbase", "quotedblright",
+	"guillemotright", "ellipsis", "perthousand", "questiondown", "grave", "acute", "circumflex", "tilde",
+	"macron", "breve", "dotaccent", "dieresis", "ring", "cedilla", "hungarumlaut", "ogonek", "caron",
+	"emdash", "AE", "ordfeminine", "Lslash", "Oslash", "OE", "ordmasculine", "ae", "dotlessi", "lslash",
+	"oslash", "oe", "germandbls", "onesuperior", "logicalnot", "mu", "trademark", "Eth", "onehalf",
+	"plusminus", "Thorn", "onequarter", "divide", "brokenbar", "degree", "thorn", "threequarters",
+	"twosuperior", "registered", "minus", "eth", "multiply", "threesuperior", "copyright", "Aacute",
+	"Acircumflex", "Adieresis", "Agrave", "Aring", "Atilde", "Ccedilla", "Eacute", "Ecircumflex",
+	"Edieresis", "Egrave", "Iacute", "Icircumflex", "Idieresis", "Igrave", "Ntilde", "Oacute", "Ocircumflex",
+	"Odieresis", "Ograve", "Otilde", "Scaron", "Uacute", "Ucircumflex", "Udieresis", "Ugrave", "Yacute",
+	"Ydieresis", "Zcaron", "aacute", "acircumflex", "adieresis", "agrave", "aring", "atilde", "ccedilla",
+	"eacute", "ecircumflex", "edieresis", "egrave", "iacute", "icircumflex", "idieresis", "igrave", "ntilde",
+	"oacute", "ocircumflex", "odieresis", "ograve", "otilde", "scaron", "uacute", "ucircumflex", "udieresis",
+	"ugrave", "yacute", "ydieresis", "zcaron", "exclamsmall", "Hungarumlautsmall", "dollaroldstyle",
+	"dollarsuperior", "ampersandsmall", "Acutesmall", "parenleftsuperior", "parenrightsuperior",
+	"twodotenleader", "onedotenleader", "zerooldstyle", "oneoldstyle", "twooldstyle", "threeoldstyle",
+	"fouroldstyle", "fiveoldstyle", "sixoldstyle", "sevenoldstyle", "eightoldstyle", "nineoldstyle",
+	"commasuperior", "threequartersemdash", "periodsuperior", "questionsmall", "asuperior", "bsuperior",
+	"centsuperior", "dsuperior", "esuperior", "isuperior", "lsuperior", "msuperior", "nsuperior",
+	"osuperior", "rsuperior", "ssuperior", "tsuperior", "ff", "ffi", "ffl", "parenleftinferior",
+	"parenrightinferior", "Circumflexsmall", "hyphensuperior", "Gravesmall", "Asmall", "Bsmall", "Csmall",
+	"Dsmall", "Esmall", "Fsmall", "Gsmall", "Hsmall", "Ismall", "Jsmall", "Ksmall", "Lsmall", "Msmall",
+	"Nsmall", "Osmall", "Psmall", "Qsmall", "Rsmall", "Ssmall", "Tsmall", "Usmall", "Vsmall", "Wsmall",
+	"Xsmall", "Ysmall", "Zsmall", "colonmonetary", "onefitted", "rupiah", "Tildesmall", "exclamdownsmall",
+	"centoldstyle", "Lslashsmall", "Scaronsmall", "Zcaronsmall", "Dieresissmall", "Brevesmall",
+	"Caronsmall", "Dotaccentsmall", "Macronsmall", "figuredash", "hypheninferior", "Ogoneksmall",
+	"Ringsmall", "Cedillasmall", "questiondownsmall", "oneeighth", "threeeighths", "fiveeighths",
+	"seveneighths", "onethird", "twothirds", "zerosuperior", "foursuperior", "fivesuperior", "sixsuperior",
+	"sevensuperior", "eightsuperior", "ninesuperior", "zeroinferior", "oneinferior", "twoinferior",
+	"threeinferior", "fourinferior", "fiveinferior", "sixinferior", "seveninferior", "eightinferior",
+	"nineinferior", "centinferior", "dollarinferior", "periodinferior", "commainferior", "Agravesmall",
+	"Aacutesmall", "Acircumflexsmall", "Atildesmall", "Adieresissmall", "Aringsmall", "AEsmall",
+	"Ccedillasmall", "Egravesmall", "Eacutesmall", "Ecircumflexsmall", "Edieresissmall", "Igravesmall",
+	"Iacutesmall", "Icircumflexsmall", "Idieresissmall", "Ethsmall", "Ntildesmall", "Ogravesmall",
+	"Oacutesmall", "Ocircumflexsmall", "Otildesmall", "Odieresissmall", "OEsmall", "Oslashsmall",
+	"Ugravesmall", "Uacutesmall", "Ucircumflexsmall", "Udieresissmall", "Yacutesmall", "Thornsmall",
+	"Ydieresissmall", "001.000", "001.001", "001.002", "001.003", "Black", "Bold", "Book", "Light", "Medium",
+	"Regular", "Roman", "Semibold",
+}
+
+// GlyphCharString returns the Type 2 charstring data of glyph `gid` for fonts with CFF outlines.
+// Returns an error if `f` has no CFF table or `gid` is out of range.
+func (f *Font) GlyphCharString(gid GlyphIndex) ([]byte, error) {
+	if f.cff == nil {
+		logger.Debugf("CFF table missing")
+		return nil, errRequiredField
+	}
+	if int(gid) >= len(f.cff.charStrings) {
+		logger.Debugf("GID out of range: %d >= %d", gid, len(f.cff.charStrings))
+		return nil, errRangeCheck
+	}
+	return f.cff.charStrings[gid], nil
+}
@@ -0,0 +1,497 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cffTestInt returns the 5-byte DICT encoding of `v`.
+func cffTestInt(v int) []byte {
+	return []byte{29, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// buildTestCFF builds a CFF table with glyphs named `glyphNames` and charstrings `charStrings`.
+// The charset is stored in `charsetFormat`, -1 for the predefined ISOAdobe charset. If `cid` is set the
+// font is CID-keyed and the glyph names are CIDs.
+func buildTestCFF(glyphNames []string, charStrings [][]byte, charsetFormat int, cid bool) []byte {
+	var stringIndex [][]byte
+	sids := make([]uint16, len(glyphNames))
+	for i, name := range glyphNames {
+		if cid {
+			var v int
+			fmt.Sscanf(name, "cid%05d", &v)
+			sids[i] = uint16(v)
+			continue
+		}
+		sid := -1
+		for j, s := range cffStandardStrings {
+			if s == name {
+				sid = j
+			}
+		}
+		if sid < 0 {
+			sid = cffNumStandardStrings + len(stringIndex)
+			stringIndex = append(stringIndex, []byte(name))
+		}
+		sids[i] = uint16(sid)
+	}
+
+	var charset []byte
+	switch charsetFormat {
+	case 0:
+		charset = []byte{0}
+		for _, sid := range sids[1:] {
+			charset = append(charset, byte(sid>>8), byte(sid))
+		}
+	case 1, 2:
+		// One range per glyph.
+		charset = []byte{byte(charsetFormat)}
+		for _, sid := range sids[1:] {
+			charset = append(charset, byte(sid>>8), byte(sid), 0)
+			if charsetFormat == 2 {
+				charset = append(charset, 0)
+			}
+		}
+	}
+
+	// Top DICT with fixed size operands, the offsets are filled in once known.
+	topDict := func(charsetOffset, charStringsOffset, privateOffset int) []byte {
+		var d []byte
+		if cid {
+			d = append(d, 0xF8, 0x1C, 0xF8, 0x1D, 0x8B, 12, 30) // ROS: SIDs 392, 393, supplement 0.
+		}
+		if charsetFormat >= 0 {
+			d = append(d, cffTestInt(charsetOffset)...)
+			d = append(d, cffOpCharset)
+		}
+		d = append(d, cffTestInt(charStringsOffset)...)
+		d = append(d, cffOpCharStrings)
+		d = append(d, cffTestInt(0)...)
+		d = append(d, cffTestInt(privateOffset)...)
+		d = append(d, cffOpPrivate)
+		// FontMatrix with real operands.
+		d = append(d, 0x1E, 0x1C, 0x3F, 0x8B, 0x8B, 0x1E, 0x1C, 0x3F, 0x8B, 0x8B, 12, 7)
+		return d
+	}
+
+	header := []byte{1, 0, 4, 4}
+	nameIndex := encodeCFFIndex([][]byte{[]byte("TestFont")})
+	stringsData := encodeCFFIndex(stringIndex)
+	subrs := encodeCFFIndex(nil)
+	topLen := len(encodeCFFIndex([][]byte{topDict(0, 0, 0)}))
+	charsetOffset := len(header) + len(nameIndex) + topLen + len(stringsData) + len(subrs)
+	charStringsOffset := charsetOffset + len(charset)
+	charStringsData := encodeCFFIndex(charStrings)
+	privateOffset := charStringsOffset + len(charStringsData)
+
+	var b []byte
+	b = append(b, header...)
+	b = append(b, nameIndex...)
+	b = append(b, encodeCFFIndex([][]byte{topDict(charsetOffset, charStringsOffset, privateOffset)})...)
+	b = append(b, stringsData...)
+	b = append(b, subrs...)
+	b = append(b, charset...)
+	b = append(b, charStringsData...)
+	return b
+}
+
+// buildTestOTTO builds an OpenType font with CFF outlines from the first glyphs of FreeSans,
+// with the glyf and loca tables replaced by a CFF table with glyphs named `glyphNames`.
+func buildTestOTTO(t *testing.T, glyphNames []string) []byte {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err = fnt.SubsetFirst(len(glyphNames))
+	require.NoError(t, err)
+
+	charStrings := make([][]byte, len(glyphNames))
+	for i := range charStrings {
+		// hmoveto and endchar.
+		charStrings[i] = []byte{byte(139 + i), 22, 14}
+	}
+	fnt.ot.sfntVersion = signatureCFF
+	fnt.glyf = nil
+	fnt.loca = nil
+	fnt.maxp = &maxpTable{version: 0x00005000, numGlyphs: uint16(len(glyphNames))}
+	fnt.post.glyphNames = nil
+	fnt.rawTables = append(fnt.rawTables, &rawTable{
+		tableTag: makeTag("CFF"),
+		data:     buildTestCFF(glyphNames, charStrings, 0, false),
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	return buf.Bytes()
+}
+
+func TestCFFTable(t *testing.T) {
+	glyphNames := []string{".notdef", "space", "A", "Semibold", "custom1", "custom2"}
+	charStrings := [][]byte{{14}, {14}, {139, 22, 14}, {14}, {14}, {14}}
+
+	for _, charsetFormat := range []int{0, 1, 2} {
+		data := buildTestCFF(glyphNames, charStrings, charsetFormat, false)
+		cff, err := parseCFFData(data)
+		require.NoError(t, err, "format %d", charsetFormat)
+		assert.Equal(t, []string{"TestFont"}, cff.names)
+		assert.Equal(t, charStrings, cff.charStrings)
+		assert.Equal(t, []float64{0.001, 0, 0, 0.001, 0, 0}, cff.topDict[1207])
+		assert.False(t, cff.isCIDKeyed())
+		for i, name := range glyphNames {
+			gname, err := cff.glyphName(GlyphIndex(i))
+			require.NoError(t, err)
+			assert.Equal(t, GlyphName(name), gname)
+		}
+		_, err = cff.glyphName(GlyphIndex(len(glyphNames)))
+		assert.Error(t, err)
+	}
+
+	// Predefined ISOAdobe charset.
+	cff, err := parseCFFData(buildTestCFF([]string{".notdef", "space", "exclam"}, [][]byte{{14}, {14}, {14}}, -1,
+		false))
+	require.NoError(t, err)
+	assert.Equal(t, []GlyphName{".notdef", "space", "exclam"}, cff.glyphNames())
+
+	// CID-keyed font.
+	cidNames := []string{"cid00000", "cid00010", "cid01234"}
+	cff, err = parseCFFData(buildTestCFF(cidNames, [][]byte{{14}, {14}, {14}}, 0, true))
+	require.NoError(t, err)
+	assert.True(t, cff.isCIDKeyed())
+	assert.Equal(t, []GlyphName{"cid00000", "cid00010", "cid01234"}, cff.glyphNames())
+
+	// Truncated data.
+	data := buildTestCFF(glyphNames, charStrings, 0, false)
+	_, err = parseCFFData(data[:len(data)-1])
+	assert.Error(t, err)
+	_, err = parseCFFData([]byte{2, 0, 4, 4})
+	assert.Error(t, err)
+}
+
+func TestCFFEncode(t *testing.T) {
+	glyphNames := []string{".notdef", "space", "A", "Semibold", "custom1", "custom2"}
+	charStrings := [][]byte{{14}, {14}, {139, 22, 14}, {14}, {14}, {14}}
+
+	for _, charsetFormat := range []int{-1, 0, 1, 2} {
+		names := glyphNames
+		if charsetFormat < 0 {
+			names = []string{".notdef", "space", "exclam", "quotedbl", "numbersign", "dollar"}
+		}
+		cff, err := parseCFFData(buildTestCFF(names, charStrings, charsetFormat, false))
+		require.NoError(t, err)
+		data, err := cff.encode()
+		require.NoError(t, err)
+		cff2, err := parseCFFData(data)
+		require.NoError(t, err, "format %d", charsetFormat)
+		assert.Equal(t, cff.names, cff2.names)
+		assert.Equal(t, cff.charStrings, cff2.charStrings)
+		assert.Equal(t, cff.charset, cff2.charset)
+		assert.Equal(t, cff.predefinedCharset, cff2.predefinedCharset)
+		assert.Equal(t, cff.topDict[1207], cff2.topDict[1207])
+		assert.Equal(t, cff.private, cff2.private)
+
+		// Encoding is stable.
+		data2, err := cff2.encode()
+		require.NoError(t, err)
+		assert.Equal(t, data, data2)
+	}
+
+	// CID-keyed font with Font DICTs and Private DICTs with local subrs.
+	private := func(defaultWidthX int) *cffPrivate {
+		// defaultWidthX, Subrs at the end of the DICT.
+		dict := appendCFFInt(nil, defaultWidthX)
+		dict = append(dict, 20, 139+5, cffOpSubrs)
+		return &cffPrivate{dictSize: len(dict), data: append(dict, encodeCFFIndex([][]byte{{11}, {11}})...)}
+	}
+	cff := &cffTable{
+		major:   1,
+		hdrSize: 4,
+		offSize: 4,
+		names:   []string{"TestCID"},
+		topDict: cffDict{
+			cffOpROS: {391, 392, 0},
+			1207:     {0.001, 0, 0, 0.001, 0, 0},
+			5:        {-50, -250, 1000, 900},
+		},
+		strings:           [][]byte{[]byte("Adobe"), []byte("Identity")},
+		globalSubrs:       [][]byte{{11}},
+		charset:           []uint16{0, 10, 11, 12, 1234},
+		charStrings:       [][]byte{{14}, {139, 14}, {140, 14}, {141, 14}, {142, 14}},
+		predefinedCharset: -1,
+		fdArray: []*cffFontDict{
+			{dict: cffDict{1238: {393}}, private: private(500)},
+			{dict: cffDict{1238: {394}}, private: private(1000)},
+		},
+		fdSelect: []uint8{0, 1, 1, 0, 1},
+	}
+	data, err := cff.encode()
+	require.NoError(t, err)
+	cff2, err := parseCFFData(data)
+	require.NoError(t, err)
+	assert.True(t, cff2.isCIDKeyed())
+	assert.Equal(t, cff.topDict[cffOpROS], cff2.topDict[cffOpROS])
+	assert.Equal(t, cff.topDict[5], cff2.topDict[5])
+	assert.Equal(t, cff.strings, cff2.strings)
+	assert.Equal(t, cff.globalSubrs, cff2.globalSubrs)
+	assert.Equal(t, cff.charset, cff2.charset)
+	assert.Equal(t, cff.charStrings, cff2.charStrings)
+	assert.Equal(t, cff.fdSelect, cff2.fdSelect)
+	require.Len(t, cff2.fdArray, 2)
+	for i, fd := range cff.fdArray {
+		assert.Equal(t, fd.dict[1238], cff2.fdArray[i].dict[1238])
+		assert.Equal(t, fd.private, cff2.fdArray[i].private)
+	}
+	assert.Equal(t, []GlyphName{"cid00000", "cid00010", "cid00011", "cid00012", "cid01234"}, cff2.glyphNames())
+
+	// Renumbering glyphs.
+	sub := cff2.selectGlyphs([]GlyphIndex{0, 2, 4})
+	data, err = sub.encode()
+	require.NoError(t, err)
+	sub, err = parseCFFData(data)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{{14}, {140, 14}, {142, 14}}, sub.charStrings)
+	assert.Equal(t, []uint16{0, 11, 1234}, sub.charset)
+	assert.Equal(t, []uint8{0, 1, 1}, sub.fdSelect)
+	assert.Equal(t, cff.fdArray[1].private, sub.fdArray[1].private)
+
+	// Empty glyphs.
+	sub = cff2.stubGlyphs(func(gid GlyphIndex) bool {
+		return gid == 3
+	})
+	assert.Equal(t, [][]byte{{14}, {14}, {14}, {141, 14}, {14}}, sub.charStrings)
+	assert.Equal(t, cff2.charset, sub.charset)
+}
+
+func TestCFFEncodeNumbers(t *testing.T) {
+	values := []float64{0, 107, -107, 108, 1131, -108, -1131, 1132, -1132, 32767, -32768, 32768, -32769,
+		100000, 0.5, -2.25, 0.001, 1e-5, 0.140541e-3, 1.5e20, -0.039625}
+	d := cffDict{5: values}
+	parsed, err := parseCFFDict(d.encode())
+	require.NoError(t, err)
+	assert.Equal(t, d, parsed)
+
+	assert.Equal(t, []byte{0x8B}, appendCFFInt(nil, 0))
+	assert.Equal(t, []byte{0xF7, 0x00}, appendCFFInt(nil, 108))
+	assert.Equal(t, []byte{0x1C, 0x80, 0x00}, appendCFFInt(nil, -32768))
+	assert.Equal(t, []byte{0x1E, 0xE2, 0xA2, 0x5F}, appendCFFReal(nil, -2.25))
+
+	// Offset operands have a fixed size.
+	d = cffDict{cffOpCharStrings: {0}, cffOpROS: {391, 392, 0}}
+	assert.Equal(t, []byte{0xF8, 0x1B, 0xF8, 0x1C, 0x8B, 12, 30, 29, 0, 0, 0, 0, 17}, d.encode())
+}
+
+func TestParseCFFDict(t *testing.T) {
+	testcases := []struct {
+		data     []byte
+		expected cffDict
+	}{
+		{[]byte{0x8B, 0xF7, 0x00, 0xFB, 0x00, 0x1C, 0x80, 0x00, 5}, cffDict{5: {0, 108, -108, -32768}}},
+		{[]byte{0x1D, 0xFF, 0xFF, 0xFF, 0xFF, 12, 30, 17}, cffDict{1230: {-1}, 17: nil}},
+		{[]byte{0x1E, 0xE2, 0xA2, 0x5F, 0x0F}, cffDict{15: {-2.25}}},
+		{[]byte{0x1E, 0x0A, 0x14, 0x05, 0x41, 0xC3, 0xFF, 0x0F}, cffDict{15: {0.140541e-3}}},
+	}
+
+	for i, tcase := range testcases {
+		d, err := parseCFFDict(tcase.data)
+		require.NoError(t, err, "case %d", i)
+		assert.Equal(t, tcase.expected, d, "case %d", i)
+	}
+
+	_, err := parseCFFDict([]byte{0x1C, 0x00})
+	assert.Error(t, err)
+	_, err = parseCFFDict([]byte{0xFF})
+	assert.Error(t, err)
+}
+
+func TestParseOTTO(t *testing.T) {
+	glyphNames := []string{".notdef", "space", "exclam", "quotedbl", "g1", "g2"}
+	data := buildTestOTTO(t, glyphNames)
+	assert.Equal(t, signatureCFF, binary.BigEndian.Uint32(data))
+
+	fnt, err := Parse(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, fnt.validate(fnt.br))
+	require.NotNil(t, fnt.cff)
+	assert.Nil(t, fnt.glyf)
+
+	numGlyphs, ok := fnt.NumGlyphs()
+	require.True(t, ok)
+	assert.Equal(t, len(glyphNames), numGlyphs)
+	for i, name := range glyphNames {
+		gname, err := fnt.GlyphName(GlyphIndex(i))
+		require.NoError(t, err)
+		assert.Equal(t, name, gname)
+		gid, has := fnt.GlyphIndexByName(name)
+		assert.True(t, has)
+		assert.Equal(t, GlyphIndex(i), gid)
+
+		cs, err := fnt.GlyphCharString(GlyphIndex(i))
+		require.NoError(t, err)
+		assert.Equal(t, []byte{byte(139 + i), 22, 14}, cs)
+	}
+	_, err = fnt.GlyphCharString(GlyphIndex(len(glyphNames)))
+	assert.Error(t, err)
+
+	gid, has := fnt.LookupRune(' ')
+	assert.True(t, has)
+	assert.Equal(t, GlyphIndex(5), gid)
+	assert.NotNil(t, fnt.GetCmap(3, 1))
+	upem, ok := fnt.UnitsPerEm()
+	assert.True(t, ok)
+	assert.Equal(t, 1000, upem)
+	assert.NotNil(t, fnt.name)
+	assert.NotNil(t, fnt.os2)
+	assert.NotNil(t, fnt.hhea)
+	adv, err := fnt.GlyphAdvance(gid)
+	require.NoError(t, err)
+	assert.NotZero(t, adv)
+
+	// Write round trip preserves the CFF table.
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	fnt2, err := Parse(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.NoError(t, fnt2.validate(fnt2.br))
+	assert.Equal(t, fnt.rawTableData("CFF"), fnt2.rawTableData("CFF"))
+	assert.Equal(t, fnt.cff, fnt2.cff)
+	assert.Equal(t, fnt.maxp, fnt2.maxp)
+
+	require.NoError(t, fnt2.PruneTables("CFF"))
+	assert.Nil(t, fnt2.cff)
+	_, err = fnt2.GlyphCharString(0)
+	assert.Error(t, err)
+}
+
+func TestOTTOContainers(t *testing.T) {
+	glyphNames := []string{".notdef", "space", "exclam", "quotedbl", "g1", "g2"}
+	data := buildTestOTTO(t, glyphNames)
+	fnt, err := Parse(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	check := func(t *testing.T, parsed *Font) {
+		require.NotNil(t, parsed.cff)
+		assert.Equal(t, signatureCFF, parsed.ot.sfntVersion)
+		assert.Equal(t, fnt.rawTableData("CFF"), parsed.rawTableData("CFF"))
+		assert.Equal(t, fnt.cff, parsed.cff)
+		written, err := parsed.Bytes()
+		require.NoError(t, err)
+		assert.Equal(t, data, written)
+	}
+
+	t.Run("WOFF", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.WriteWOFF(&buf))
+		parsed, err := ParseBytes(buf.Bytes())
+		require.NoError(t, err)
+		check(t, parsed)
+	})
+
+	t.Run("WOFF2", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.WriteWOFF2(&buf))
+		parsed, err := ParseBytes(buf.Bytes())
+		require.NoError(t, err)
+		check(t, parsed)
+	})
+
+	t.Run("Collection", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{2})
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, WriteCollection(&buf, []*Font{fnt, subfnt}))
+
+		parsed, err := ParseCollection(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		require.Len(t, parsed, 2)
+		check(t, parsed[0])
+		assert.NotNil(t, parsed[1].cff)
+
+		second, err := ParseCollectionFont(bytes.NewReader(buf.Bytes()), 1)
+		require.NoError(t, err)
+		assert.Equal(t, parsed[1].cff, second.cff)
+
+		// A single OpenType font is read as a collection of one font.
+		parsed, err = ParseCollection(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Len(t, parsed, 1)
+		check(t, parsed[0])
+	})
+}
+
+func TestSubsetOTTO(t *testing.T) {
+	glyphNames := []string{".notdef", "space", "exclam", "quotedbl", "g1", "g2"}
+	fnt, err := Parse(bytes.NewReader(buildTestOTTO(t, glyphNames)))
+	require.NoError(t, err)
+	require.NotNil(t, fnt.cff)
+
+	reparse := func(fnt *Font) *Font {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.Write(&buf))
+		fnt2, err := Parse(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		require.NoError(t, fnt2.validate(fnt2.br))
+		require.NotNil(t, fnt2.cff)
+		return fnt2
+	}
+
+	t.Run("SubsetKeepIndices", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{2, 4})
+		require.NoError(t, err)
+		subfnt = reparse(subfnt)
+
+		numGlyphs, ok := subfnt.NumGlyphs()
+		require.True(t, ok)
+		assert.Equal(t, 5, numGlyphs)
+		for i := 0; i < numGlyphs; i++ {
+			cs, err := subfnt.GlyphCharString(GlyphIndex(i))
+			require.NoError(t, err)
+			if i == 0 || i == 2 || i == 4 {
+				assert.Equal(t, []byte{byte(139 + i), 22, 14}, cs)
+			} else {
+				assert.Equal(t, cffEndchar, cs)
+			}
+			name, err := subfnt.GlyphName(GlyphIndex(i))
+			require.NoError(t, err)
+			assert.Equal(t, glyphNames[i], name)
+		}
+
+		// The original font is unaffected.
+		cs, err := fnt.GlyphCharString(1)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{140, 22, 14}, cs)
+	})
+
+	t.Run("Subset", func(t *testing.T) {
+		subfnt, oldnew, err := fnt.Subset([]GlyphIndex{2, 4})
+		require.NoError(t, err)
+		assert.Equal(t, map[GlyphIndex]GlyphIndex{0: 0, 2: 1, 4: 2}, oldnew)
+		subfnt = reparse(subfnt)
+
+		numGlyphs, ok := subfnt.NumGlyphs()
+		require.True(t, ok)
+		assert.Equal(t, 3, numGlyphs)
+		for oldgid, newgid := range oldnew {
+			cs, err := subfnt.GlyphCharString(newgid)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{byte(139 + oldgid), 22, 14}, cs)
+
+			name, err := subfnt.GlyphName(newgid)
+			require.NoError(t, err)
+			assert.Equal(t, glyphNames[oldgid], name)
+
+			adv, err := fnt.GlyphAdvance(oldgid)
+			require.NoError(t, err)
+			newadv, err := subfnt.GlyphAdvance(newgid)
+			require.NoError(t, err)
+			assert.Equal(t, adv, newadv)
+		}
+		assert.Equal(t, []string{"CFF"}, subfnt.UnmodelledTables())
+	})
+}
@@ -7,10 +7,12 @@ package unitype
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
-
-	"github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"unicode/utf16"
 )
 
 // cmapTable represents a Character to Glyph Index Mapping Table (cmap).
@@ -37,8 +39,8 @@ type encodingRecord struct {
 
 func (f *font) parseCmap(r *byteReader) (*cmapTable, error) {
 	if f.maxp == nil {
-		logrus.Debug("Unable to load cmap: maxp table is nil")
-		return nil, errRequiredField
+		logger.Debugf("Unable to load cmap: maxp table is nil")
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
 	}
 
 	tr, has, err := f.seekToTable(r, "cmap")
@@ -46,7 +48,7 @@ func (f *font) parseCmap(r *byteReader) (*cmapTable, error) {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("cmap table absent")
+		logger.Debugf("cmap table absent")
 		return nil, nil
 	}
 
@@ -75,42 +77,94 @@ func (f *font) parseCmap(r *byteReader) (*cmapTable, error) {
 		}
 
 		// Header.
+		start := r.Offset()
 		var format uint16
 		err = r.read(&format)
 		if err != nil {
-			return nil, err
+			return nil, wrapParseError(fmt.Sprintf("subtable at offset 0x%x", start), r.Offset(), err)
 		}
 
-		logrus.Debugf("Format: %d", format)
+		logger.Debugf("Format: %d", format)
 		var cmap *cmapSubtable
 		switch format {
 		case 0:
 			cmap, err = f.parseCmapSubtableFormat0(r, int(enc.platformID), int(enc.encodingID))
+		case 2:
+			cmap, err = f.parseCmapSubtableFormat2(r, int(enc.platformID), int(enc.encodingID))
 		case 4:
 			cmap, err = f.parseCmapSubtableFormat4(r, int(enc.platformID), int(enc.encodingID))
 		case 6:
 			cmap, err = f.parseCmapSubtableFormat6(r, int(enc.platformID), int(enc.encodingID))
 		case 12:
 			cmap, err = f.parseCmapSubtableFormat12(r, int(enc.platformID), int(enc.encodingID))
+		case 8:
+			cmap, err = f.parseCmapSubtableFormat8(r, int(enc.platformID), int(enc.encodingID))
+		case 10:
+			cmap, err = f.parseCmapSubtableFormat10(r, int(enc.platformID), int(enc.encodingID))
+		case 13:
+			cmap, err = f.parseCmapSubtableFormat13(r, int(enc.platformID), int(enc.encodingID))
+		case 14:
+			cmap, err = f.parseCmapSubtableFormat14(r, int(enc.platformID), int(enc.encodingID))
 		default:
-			logrus.Debugf("Unsupported cmap format %d", format)
+			logger.Debugf("Unsupported cmap format %d", format)
 			continue
 		}
 		if err != nil {
-			logrus.Debugf("Error: %v", err)
-			return nil, err
+			logger.Debugf("Error: %v", err)
+			return nil, wrapParseError(fmt.Sprintf("format %d subtable at offset 0x%x", format, start), r.Offset(), err)
 		}
 		if cmap != nil {
 			key := fmt.Sprintf("%d,%d,%d", format, enc.platformID, enc.encodingID)
 			t.subtables[key] = cmap
 			t.subtableKeys = append(t.subtableKeys, key)
-			logrus.Debugf("KEY: %s <-> %T", key, cmap.ctx)
+			logger.Debugf("KEY: %s <-> %T", key, cmap.ctx)
 		}
 	}
 
 	return t, nil
 }
 
+// parseCmapEncodings returns the platform and encoding IDs and the formats of the subtables of the cmap table
+// without parsing the subtables, nil if the table is absent.
+func (f *font) parseCmapEncodings(r *byteReader) ([]CmapID, error) {
+	tr, has, err := f.seekToTable(r, "cmap")
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+
+	var version, numTables uint16
+	err = r.read(&version, &numTables)
+	if err != nil {
+		return nil, err
+	}
+	encs := make([]encodingRecord, numTables)
+	for i := range encs {
+		err = r.read(&encs[i].platformID, &encs[i].encodingID, &encs[i].offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ids []CmapID
+	for _, enc := range encs {
+		err = r.SeekTo(int64(tr.offset) + int64(enc.offset))
+		if err != nil {
+			return nil, err
+		}
+		var format uint16
+		err = r.read(&format)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, CmapID{PlatformID: int(enc.platformID), EncodingID: int(enc.encodingID),
+			Format: int(format)})
+	}
+	return ids, nil
+}
+
 // cmap subtable data.
 type cmapSubtable struct {
 	format     int
@@ -127,6 +181,86 @@ type cmapSubtable struct {
 	runeToCharcodeBytes map[rune][]byte // Quick for going rune -> encoded bytes (charcodes).
 }
 
+// Clone returns a deep copy of `t`.
+func (t *cmapTable) Clone() *cmapTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	dup.encodingRecords = append([]encodingRecord(nil), t.encodingRecords...)
+	dup.subtables = make(map[string]*cmapSubtable, len(t.subtables))
+	for key, subt := range t.subtables {
+		dup.subtables[key] = subt.Clone()
+	}
+	dup.subtableKeys = append([]string(nil), t.subtableKeys...)
+	return &dup
+}
+
+// Clone returns a deep copy of `subt`, including the format specific subtable.
+func (subt *cmapSubtable) Clone() *cmapSubtable {
+	if subt == nil {
+		return nil
+	}
+	dup := *subt
+	dup.cmap = make(map[rune]GlyphIndex, len(subt.cmap))
+	for r, gid := range subt.cmap {
+		dup.cmap[r] = gid
+	}
+	dup.runes = append([]rune(nil), subt.runes...)
+	dup.charcodes = append([]CharCode(nil), subt.charcodes...)
+	dup.charcodeToGID = make(map[CharCode]GlyphIndex, len(subt.charcodeToGID))
+	for cc, gid := range subt.charcodeToGID {
+		dup.charcodeToGID[cc] = gid
+	}
+	dup.runeToCharcodeBytes = make(map[rune][]byte, len(subt.runeToCharcodeBytes))
+	for r, b := range subt.runeToCharcodeBytes {
+		dup.runeToCharcodeBytes[r] = append([]byte(nil), b...)
+	}
+
+	switch t := subt.ctx.(type) {
+	case cmapSubtableFormat0:
+		t.glyphIDArray = append([]uint8(nil), t.glyphIDArray...)
+		dup.ctx = t
+	case cmapSubtableFormat2:
+		t.subHeaderKeys = append([]uint16(nil), t.subHeaderKeys...)
+		t.subHeaders = append([]cmapFormat2SubHeader(nil), t.subHeaders...)
+		t.glyphIDArray = append([]uint16(nil), t.glyphIDArray...)
+		dup.ctx = t
+	case cmapSubtableFormat4:
+		t.endCode = append([]uint16(nil), t.endCode...)
+		t.startCode = append([]uint16(nil), t.startCode...)
+		t.idDelta = append([]uint16(nil), t.idDelta...)
+		t.idRangeOffset = append([]uint16(nil), t.idRangeOffset...)
+		t.glyphIDArray = append([]uint16(nil), t.glyphIDArray...)
+		dup.ctx = t
+	case cmapSubtableFormat6:
+		t.glyphIDArray = append([]uint16(nil), t.glyphIDArray...)
+		dup.ctx = t
+	case cmapSubtableFormat8:
+		t.is32 = append([]uint8(nil), t.is32...)
+		t.groups = append([]sequentialMapGroup(nil), t.groups...)
+		dup.ctx = t
+	case cmapSubtableFormat10:
+		t.glyphs = append([]uint16(nil), t.glyphs...)
+		dup.ctx = t
+	case cmapSubtableFormat12:
+		t.groups = append([]sequentialMapGroup(nil), t.groups...)
+		dup.ctx = t
+	case cmapSubtableFormat13:
+		t.groups = append([]sequentialMapGroup(nil), t.groups...)
+		dup.ctx = t
+	case cmapSubtableFormat14:
+		t.varSelectors = append([]variationSelector(nil), t.varSelectors...)
+		for i := range t.varSelectors {
+			vs := &t.varSelectors[i]
+			vs.defaultUVS = append([]unicodeRange(nil), vs.defaultUVS...)
+			vs.nonDefaultUVS = append([]uvsMapping(nil), vs.nonDefaultUVS...)
+		}
+		dup.ctx = t
+	}
+	return &dup
+}
+
 // cmapSubtableFormat0 represents format 0: Byte encoding table.
 // This is the Apple standard character to glyph index mapping table.
 type cmapSubtableFormat0 struct {
@@ -206,6 +340,241 @@ func writeCmapSubtableFormat0(subtable *cmapSubtable, w *byteWriter) error {
 	return w.writeSlice(subt.glyphIDArray)
 }
 
+// cmapSubtableFormat2 represents format 2: High-byte mapping through table.
+// Used for mixed 8/16-bit encodings such as Japanese, Chinese and Korean legacy encodings.
+// The high byte of a character code selects a subHeader via subHeaderKeys. Bytes that map to
+// subHeader 0 are single-byte character codes, whereas others are the first byte of a two-byte
+// character code.
+type cmapSubtableFormat2 struct {
+	length        uint16
+	language      uint16
+	subHeaderKeys []uint16 // len = 256. Array that maps high bytes to subHeaders: value is subHeader index × 8.
+	subHeaders    []cmapFormat2SubHeader
+	glyphIDArray  []uint16
+}
+
+type cmapFormat2SubHeader struct {
+	firstCode     uint16 // First valid low byte for this subHeader.
+	entryCount    uint16 // Number of valid low bytes for this subHeader.
+	idDelta       int16
+	idRangeOffset uint16 // Bytes from the idRangeOffset field to the glyphIDArray element for firstCode.
+}
+
+// getFormat2Encoding returns the cmapEncoding of format 2 subtables for `platformID` and `encodingID`.
+// Differs from getCmapEncoding in that the Macintosh CJK encodings are supported, which are only used
+// with the mixed 8/16-bit format 2 subtables.
+func getFormat2Encoding(platformID, encodingID int) cmapEncoding {
+	if platformID == platformIDMacintosh {
+		switch encodingID {
+		case 1: // Japanese.
+			return cmapEncodingShiftJIS
+		case 2: // Chinese (Traditional).
+			return cmapEncodingBig5
+		case 25: // Chinese (Simplified).
+			return cmapEncodingPRC
+		}
+	}
+	return getCmapEncoding(platformID, encodingID)
+}
+
+func (f *font) parseCmapSubtableFormat2(r *byteReader, platformID, encodingID int) (*cmapSubtable, error) {
+	st := cmapSubtableFormat2{}
+	err := r.read(&st.length, &st.language)
+	if err != nil {
+		return nil, err
+	}
+	err = r.readSlice(&st.subHeaderKeys, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	numSubHeaders := 0
+	for _, key := range st.subHeaderKeys {
+		if int(key/8)+1 > numSubHeaders {
+			numSubHeaders = int(key/8) + 1
+		}
+	}
+	dataLen := int(st.length) - 3*2 - 256*2 - 8*numSubHeaders
+	if dataLen < 0 {
+		logger.Debugf("Format 2 subtable too short (%d)", st.length)
+		return nil, errRangeCheck
+	}
+
+	st.subHeaders = make([]cmapFormat2SubHeader, numSubHeaders)
+	for i := range st.subHeaders {
+		sh := &st.subHeaders[i]
+		err = r.read(&sh.firstCode, &sh.entryCount, &sh.idDelta, &sh.idRangeOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = r.readSlice(&st.glyphIDArray, dataLen/2)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := getFormat2Encoding(platformID, encodingID)
+	runeDecoder := encoding.GetRuneDecoder()
+
+	cmap := map[rune]GlyphIndex{}
+	runes := make([]rune, f.maxp.numGlyphs)
+	runeToCharcodeBytes := map[rune][]byte{}
+	var charcodes []CharCode
+	charcodeToGID := map[CharCode]GlyphIndex{}
+
+	for hi, key := range st.subHeaderKeys {
+		k := int(key / 8)
+		sh := st.subHeaders[k]
+
+		// Index of the glyphIDArray element for firstCode, the idRangeOffset is relative to
+		// the position of the idRangeOffset field itself.
+		base := (8*k + 6 + int(sh.idRangeOffset) - 8*numSubHeaders) / 2
+
+		lo, hiLo := int(sh.firstCode), int(sh.firstCode)+int(sh.entryCount)
+		if k == 0 {
+			// Single-byte character code.
+			if hi < lo || hi >= hiLo {
+				continue
+			}
+			lo, hiLo = hi, hi+1
+		}
+		for code := lo; code < hiLo; code++ {
+			i := base + code - int(sh.firstCode)
+			if i < 0 || i >= len(st.glyphIDArray) {
+				logger.Debugf("Format 2 glyph index out of range (%d)", i)
+				break
+			}
+			if st.glyphIDArray[i] == 0 {
+				continue
+			}
+			gid := GlyphIndex(int(st.glyphIDArray[i]) + int(sh.idDelta))
+			if int(gid) >= int(f.maxp.numGlyphs) {
+				logger.Debugf("gid >= numGlyphs (%d > %d)", gid, f.maxp.numGlyphs)
+				continue
+			}
+
+			var codeBytes []byte
+			var charcode CharCode
+			if k == 0 {
+				codeBytes = []byte{byte(hi)}
+				charcode = CharCode(hi)
+			} else {
+				codeBytes = []byte{byte(hi), byte(code)}
+				charcode = CharCode(hi<<8 | code)
+			}
+			r := runeDecoder.DecodeRune(codeBytes)
+			runes[gid] = r
+			charcodes = append(charcodes, charcode)
+			charcodeToGID[charcode] = gid
+			if _, has := cmap[r]; !has {
+				// Avoid overwrite, if get same twice, use the earlier entry.
+				cmap[r] = gid
+				runeToCharcodeBytes[r] = codeBytes
+			}
+		}
+	}
+
+	return &cmapSubtable{
+		format:              2,
+		platformID:          platformID,
+		encodingID:          encodingID,
+		cmap:                cmap,
+		runes:               runes,
+		runeToCharcodeBytes: runeToCharcodeBytes,
+		charcodes:           charcodes,
+		charcodeToGID:       charcodeToGID,
+		ctx:                 st,
+	}, nil
+}
+
+func writeCmapSubtableFormat2(subtable *cmapSubtable, w *byteWriter) error {
+	subt := subtable.ctx.(cmapSubtableFormat2)
+	format := uint16(2)
+	subt.length = uint16(3*2 + 256*2 + 8*len(subt.subHeaders) + 2*len(subt.glyphIDArray))
+	err := w.write(format, subt.length, subt.language)
+	if err != nil {
+		return err
+	}
+	err = w.writeSlice(subt.subHeaderKeys)
+	if err != nil {
+		return err
+	}
+	for _, sh := range subt.subHeaders {
+		err = w.write(sh.firstCode, sh.entryCount, sh.idDelta, sh.idRangeOffset)
+		if err != nil {
+			return err
+		}
+	}
+	return w.writeSlice(subt.glyphIDArray)
+}
+
+// makeCmapFormat2 generates a format 2 subtable representing the mappings in `charcodeToGID`.
+// Character codes above 0xFF are two-byte codes, where the high byte is the first byte.
+// Each high byte gets its own subHeader with a dedicated part of the glyphIDArray and no delta.
+func makeCmapFormat2(charcodeToGID map[CharCode]GlyphIndex, language uint16) cmapSubtableFormat2 {
+	var leadLo, leadHi [256]int
+	var isLead [256]bool
+	for cc := range charcodeToGID {
+		if cc > 0xFFFF || cc <= 0xFF {
+			continue
+		}
+		hi, lo := int(cc>>8), int(cc&0xFF)
+		if !isLead[hi] || lo < leadLo[hi] {
+			leadLo[hi] = lo
+		}
+		if !isLead[hi] || lo > leadHi[hi] {
+			leadHi[hi] = lo
+		}
+		isLead[hi] = true
+	}
+
+	t := cmapSubtableFormat2{
+		language:      language,
+		subHeaderKeys: make([]uint16, 256),
+	}
+
+	// subHeader 0 for the single-byte codes.
+	t.subHeaders = append(t.subHeaders, cmapFormat2SubHeader{firstCode: 0, entryCount: 256})
+	single := make([]uint16, 256)
+	for cc, gid := range charcodeToGID {
+		if cc <= 0xFF && !isLead[cc] {
+			single[cc] = uint16(gid)
+		}
+	}
+	arrays := [][]uint16{single}
+
+	for hi := 0; hi < 256; hi++ {
+		if !isLead[hi] {
+			continue
+		}
+		t.subHeaderKeys[hi] = uint16(8 * len(t.subHeaders))
+		sh := cmapFormat2SubHeader{
+			firstCode:  uint16(leadLo[hi]),
+			entryCount: uint16(leadHi[hi] - leadLo[hi] + 1),
+		}
+		arr := make([]uint16, sh.entryCount)
+		for lo := leadLo[hi]; lo <= leadHi[hi]; lo++ {
+			if gid, has := charcodeToGID[CharCode(hi<<8|lo)]; has {
+				arr[lo-leadLo[hi]] = uint16(gid)
+			}
+		}
+		t.subHeaders = append(t.subHeaders, sh)
+		arrays = append(arrays, arr)
+	}
+
+	// Set the idRangeOffsets relative to each idRangeOffset field.
+	offset := 0
+	for i := range t.subHeaders {
+		fieldPos := 8*i + 6
+		arrPos := 8*len(t.subHeaders) + 2*offset
+		t.subHeaders[i].idRangeOffset = uint16(arrPos - fieldPos)
+		t.glyphIDArray = append(t.glyphIDArray, arrays[i]...)
+		offset += len(arrays[i])
+	}
+	t.length = uint16(3*2 + 256*2 + 8*len(t.subHeaders) + 2*len(t.glyphIDArray))
+	return t
+}
+
 // cmapSubtableFormat4 represents cmap data format 4: Segment mapping to delta values.
 // This is the standard character-to-glyph index mapping for the Windows platform for fonts that
 // support Unicode BMP characters.
@@ -235,6 +604,13 @@ func (f *font) parseCmapSubtableFormat4(r *byteReader, platformID, encodingID in
 	}
 
 	segCount := int(st.segCountX2 / 2)
+	if segCount == 0 {
+		// The last segment must end with 0xFFFF.
+		return nil, errors.New("segment count 0 invalid")
+	}
+	if segCount > f.opts.maxCmapSegments() {
+		return nil, newLimitError("cmap format 4 segment count %d exceeds %d", segCount, f.opts.maxCmapSegments())
+	}
 
 	err = r.readSlice(&st.endCode, segCount)
 	if err != nil {
@@ -260,9 +636,9 @@ func (f *font) parseCmapSubtableFormat4(r *byteReader, platformID, encodingID in
 	}
 
 	glyphIDArrLen := int(st.length-uint16(2*8+2*4*segCount)) / 2
-	logrus.Debugf("Parsing cmap format 4, segCount: %d", segCount)
-	logrus.Debugf("Table len: %d", st.length)
-	logrus.Debugf("glyphIDArrLen: %d", glyphIDArrLen)
+	logger.Debugf("Parsing cmap format 4, segCount: %d", segCount)
+	logger.Debugf("Table len: %d", st.length)
+	logger.Debugf("glyphIDArrLen: %d", glyphIDArrLen)
 	if glyphIDArrLen < 0 {
 		return nil, errors.New("invalid length")
 	}
@@ -278,16 +654,25 @@ func (f *font) parseCmapSubtableFormat4(r *byteReader, platformID, encodingID in
 	runes := make([]rune, int(f.maxp.numGlyphs))
 	charcodes := make([]CharCode, int(f.maxp.numGlyphs))
 	charcodeMap := make(map[CharCode]GlyphIndex, f.maxp.numGlyphs)
-	logrus.Debugf("Number of glyphs in font: %d\n", f.maxp.numGlyphs)
+	logger.Debugf("Number of glyphs in font: %d\n", f.maxp.numGlyphs)
+	numMapped := 0
 	for i := 0; i < segCount-1; i++ {
 		c1 := st.startCode[i]
 		c2 := st.endCode[i]
 		d := st.idDelta[i]
 		rangeOffset := st.idRangeOffset[i]
 
-		logrus.Debugf("Segment %d/%d, c1: %d, c2: %d, d: %d, rangeOffset: %d", i+1, segCount, c1, c2, d, rangeOffset)
+		logger.Debugf("Segment %d/%d, c1: %d, c2: %d, d: %d, rangeOffset: %d", i+1, segCount, c1, c2, d, rangeOffset)
 
-		for c := c1; c <= c2; c++ {
+		if c2 >= c1 {
+			numMapped += int(c2-c1) + 1
+		}
+		if numMapped > 0x10000 {
+			logger.Debugf("ERROR: overlapping segments")
+			return nil, errRangeCheck
+		}
+		for cc := int(c1); cc <= int(c2); cc++ {
+			c := uint16(cc)
 			var gid uint16
 
 			if rangeOffset == 0 {
@@ -296,8 +681,8 @@ func (f *font) parseCmapSubtableFormat4(r *byteReader, platformID, encodingID in
 				index := int(rangeOffset/2 + (c - c1) + uint16(i) - uint16(len(st.idRangeOffset)))
 
 				if index >= len(st.glyphIDArray) {
-					logrus.Debugf("c1=%d c=%d c2=%d", c1, c, c2)
-					logrus.Debugf("ERROR: index outside bounds (%d/%d)", index, len(st.glyphIDArray))
+					logger.Debugf("c1=%d c=%d c2=%d", c1, c, c2)
+					logger.Debugf("ERROR: index outside bounds (%d/%d)", index, len(st.glyphIDArray))
 					return nil, errors.New("outside bounds")
 				}
 				if st.glyphIDArray[index] != 0 {
@@ -307,13 +692,13 @@ func (f *font) parseCmapSubtableFormat4(r *byteReader, platformID, encodingID in
 				}
 			}
 
-			logrus.Tracef("Charcode:GID - %d:%d", c, gid)
+			logger.Tracef("Charcode:GID - %d:%d", c, gid)
 
 			if gid > 0 {
 				b := runeDecoder.ToBytes(uint32(c))
 				r := runeDecoder.DecodeRune(b)
 				if int(gid) >= int(f.maxp.numGlyphs) {
-					logrus.Debugf("ERROR: gid > numGlyphs (%d > %d)", gid, f.maxp.numGlyphs)
+					logger.Debugf("ERROR: gid > numGlyphs (%d > %d)", gid, f.maxp.numGlyphs)
 					return nil, errors.New("gid out of range")
 				}
 				runes[int(gid)] = r
@@ -471,15 +856,18 @@ func (f *font) parseCmapSubtableFormat12(r *byteReader, platformID, encodingID i
 	st := cmapSubtableFormat12{}
 	err := r.read(&st.reserved, &st.length, &st.language, &st.numGroups)
 	if err != nil {
-		logrus.Debugf("Error: %v", err)
+		logger.Debugf("Error: %v", err)
 		return nil, err
 	}
+	if int64(st.numGroups) > int64(f.opts.maxCmapSegments()) {
+		return nil, newLimitError("cmap format 12 group count %d exceeds %d", st.numGroups, f.opts.maxCmapSegments())
+	}
 
 	for i := 0; i < int(st.numGroups); i++ {
 		var group sequentialMapGroup
 		err = r.read(&group.startCharCode, &group.endCharCode, &group.startGlyphID)
 		if err != nil {
-			logrus.Debugf("Error: %v", err)
+			logger.Debugf("Error: %v", err)
 			return nil, err
 		}
 		st.groups = append(st.groups, group)
@@ -492,17 +880,23 @@ func (f *font) parseCmapSubtableFormat12(r *byteReader, platformID, encodingID i
 	runes := make([]rune, f.maxp.numGlyphs)
 	charcodes := make([]CharCode, f.maxp.numGlyphs)
 	charcodeMap := make(map[CharCode]GlyphIndex, f.maxp.numGlyphs)
+	numMapped := 0
 	for _, group := range st.groups {
 		gid := GlyphIndex(group.startGlyphID)
 		if int(gid) >= int(f.maxp.numGlyphs) {
-			logrus.Debugf("gid >= numGlyphs (%d > %d)", gid, f.maxp.numGlyphs)
-			logrus.Debugf("Error: %v", errRangeCheck)
+			logger.Debugf("gid >= numGlyphs (%d > %d)", gid, f.maxp.numGlyphs)
+			logger.Debugf("Error: %v", errRangeCheck)
 			return nil, errRangeCheck
 		}
 		for charcode := group.startCharCode; charcode <= group.endCharCode; charcode++ {
 			if int(gid) >= int(f.maxp.numGlyphs) {
 				break
 			}
+			numMapped++
+			if numMapped > maxCmapMappings {
+				logger.Debugf("Overlapping groups")
+				return nil, errRangeCheck
+			}
 			b := runeDecoder.ToBytes(charcode)
 			r := runeDecoder.DecodeRune(b)
 			runes[gid] = r
@@ -541,7 +935,7 @@ func writeCmapSubtableFormat12(subtable *cmapSubtable, w *byteWriter) error {
 	}
 
 	for _, group := range subt.groups {
-		logrus.Tracef("XXX Write, startCharcode: %d, endCharCode: %d, startGlyphID: %d", group.startCharCode, group.endCharCode, group.startGlyphID)
+		logger.Tracef("XXX Write, startCharcode: %d, endCharCode: %d, startGlyphID: %d", group.startCharCode, group.endCharCode, group.startGlyphID)
 		err = w.write(group.startCharCode, group.endCharCode, group.startGlyphID)
 		if err != nil {
 			return err
@@ -551,69 +945,1132 @@ func writeCmapSubtableFormat12(subtable *cmapSubtable, w *byteWriter) error {
 	return nil
 }
 
-func (f *font) writeCmap(w *byteWriter) error {
-	if f.cmap == nil {
-		return nil
+// cmapSubtableFormat8 represents format 8: mixed 16-bit and 32-bit coverage.
+// Similar to format 12, except that 16-bit and 32-bit (UTF-16 surrogate pair) character codes are
+// mixed, where is32 indicates which 16-bit values are the high word of a 32-bit character code.
+type cmapSubtableFormat8 struct {
+	reserved  uint16
+	length    uint32
+	language  uint32
+	is32      []uint8 // len = 8192. Bit array indicating whether a 16-bit value starts a 32-bit code.
+	numGroups uint32
+	groups    []sequentialMapGroup // length = numGroups.
+}
+
+// cmapSubtableFormat10 represents format 10: Trimmed array.
+// Similar to format 6, but for 32-bit character codes.
+type cmapSubtableFormat10 struct {
+	reserved      uint16
+	length        uint32
+	language      uint32
+	startCharCode uint32
+	numChars      uint32
+	glyphs        []uint16 // len = numChars.
+}
+
+// cmapSubtableFormat13 represents format 13: Many-to-one range mappings.
+// Same layout as format 12, but all character codes in a group map to the same glyph (startGlyphID),
+// e.g. as used by last resort fonts.
+type cmapSubtableFormat13 struct {
+	reserved  uint16
+	length    uint32
+	language  uint32
+	numGroups uint32
+	groups    []sequentialMapGroup // length = numGroups. startGlyphID is the glyph for all codes.
+}
+
+// maxCharCode32 is the maximum 32-bit character code considered, i.e. the maximum Unicode code point.
+const maxCharCode32 = 0x10FFFF
+
+// maxCmapMappings is the maximum number of character codes mapped by the groups of a cmap subtable, the number of
+// Unicode code points. More mappings imply overlapping groups, which could otherwise map the same codes over and
+// over.
+const maxCmapMappings = maxCharCode32 + 1
+
+// newCmapSubtable creates a cmap subtable from the character code to glyph index mappings in
+// `charcodeToGID`. The `decode` function returns the rune and encoded bytes of a character code.
+func newCmapSubtable(format, platformID, encodingID int, ctx interface{}, charcodeToGID map[CharCode]GlyphIndex,
+	decode func(cc CharCode) (rune, []byte)) *cmapSubtable {
+	charcodes := make([]CharCode, 0, len(charcodeToGID))
+	for cc := range charcodeToGID {
+		charcodes = append(charcodes, cc)
+	}
+	sort.Slice(charcodes, func(i, j int) bool {
+		return charcodes[i] < charcodes[j]
+	})
+
+	cmap := make(map[rune]GlyphIndex, len(charcodes))
+	runeToCharcodeBytes := make(map[rune][]byte, len(charcodes))
+	var runes []rune
+	for _, cc := range charcodes {
+		r, b := decode(cc)
+		if _, has := cmap[r]; !has {
+			// Avoid overwrite, if get same twice, use the earlier entry.
+			cmap[r] = charcodeToGID[cc]
+			runeToCharcodeBytes[r] = b
+			runes = append(runes, r)
+		}
 	}
-	t := f.cmap
 
-	err := w.write(t.version, t.numTables)
+	return &cmapSubtable{
+		format:              format,
+		platformID:          platformID,
+		encodingID:          encodingID,
+		ctx:                 ctx,
+		cmap:                cmap,
+		runes:               runes,
+		charcodes:           charcodes,
+		charcodeToGID:       charcodeToGID,
+		runeToCharcodeBytes: runeToCharcodeBytes,
+	}
+}
 
-	// Write the cmap subtables to an in-memory mock buffer to calculate offsets.
-	var mockBuffer bytes.Buffer
-	mockWriter := newByteWriter(&mockBuffer)
+// getCharcodeDecoder returns a function decoding 32-bit character codes of the encoding
+// `platformID` and `encodingID`.
+func getCharcodeDecoder(platformID, encodingID int) func(cc CharCode) (rune, []byte) {
+	runeDecoder := getCmapEncoding(platformID, encodingID).GetRuneDecoder()
+	return func(cc CharCode) (rune, []byte) {
+		b := runeDecoder.ToBytes(uint32(cc))
+		return runeDecoder.DecodeRune(b), b
+	}
+}
 
-	var encodingRecords []encodingRecord
-	for _, subtkey := range t.subtableKeys {
-		subt := t.subtables[subtkey]
-		rec := encodingRecord{
-			platformID: uint16(subt.platformID),
-			encodingID: uint16(subt.encodingID),
-			offset:     offset32(mockWriter.bufferedLen()),
+func (f *font) parseCmapSubtableFormat8(r *byteReader, platformID, encodingID int) (*cmapSubtable, error) {
+	st := cmapSubtableFormat8{}
+	err := r.read(&st.reserved, &st.length, &st.language)
+	if err != nil {
+		return nil, err
+	}
+	err = r.readSlice(&st.is32, 8192)
+	if err != nil {
+		return nil, err
+	}
+	err = r.read(&st.numGroups)
+	if err != nil {
+		return nil, err
+	}
+	if int64(st.numGroups)*12 > int64(st.length) {
+		logger.Debugf("Too many groups (%d)", st.numGroups)
+		return nil, errRangeCheck
+	}
+	if int64(st.numGroups) > int64(f.opts.maxCmapSegments()) {
+		return nil, newLimitError("cmap format 8 group count %d exceeds %d", st.numGroups, f.opts.maxCmapSegments())
+	}
+
+	charcodeToGID := map[CharCode]GlyphIndex{}
+	numMapped := 0
+	for i := 0; i < int(st.numGroups); i++ {
+		var group sequentialMapGroup
+		err = r.read(&group.startCharCode, &group.endCharCode, &group.startGlyphID)
+		if err != nil {
+			return nil, err
 		}
+		st.groups = append(st.groups, group)
 
-		supported := true
-		switch subt.format {
-		case 0:
-			err := writeCmapSubtableFormat0(subt, mockWriter)
-			if err != nil {
-				return err
-			}
-		case 4:
-			err := writeCmapSubtableFormat4(subt, mockWriter)
-			if err != nil {
-				return err
-			}
-		case 6:
-			err := writeCmapSubtableFormat6(subt, mockWriter)
-			if err != nil {
-				return err
-			}
-		case 12:
-			err := writeCmapSubtableFormat12(subt, mockWriter)
-			if err != nil {
-				return err
+		if group.endCharCode < group.startCharCode || group.endCharCode-group.startCharCode > maxCharCode32 {
+			logger.Debugf("Invalid group range (%d-%d)", group.startCharCode, group.endCharCode)
+			return nil, errRangeCheck
+		}
+		gid := group.startGlyphID
+		for cc := uint64(group.startCharCode); cc <= uint64(group.endCharCode) && gid < uint32(f.maxp.numGlyphs); cc++ {
+			numMapped++
+			if numMapped > maxCmapMappings {
+				logger.Debugf("Overlapping groups")
+				return nil, errRangeCheck
 			}
-		default:
-			supported = false
+			charcodeToGID[CharCode(cc)] = GlyphIndex(gid)
+			gid++
 		}
+	}
 
-		if supported {
-			encodingRecords = append(encodingRecords, rec)
+	// 32-bit codes are UTF-16 surrogate pairs, 16-bit codes are decoded as per the encoding.
+	decode16 := getCharcodeDecoder(platformID, encodingID)
+	decode := func(cc CharCode) (rune, []byte) {
+		if cc <= 0xFFFF {
+			return decode16(cc)
 		}
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(cc))
+		return utf16.DecodeRune(rune(cc>>16), rune(cc&0xFFFF)), b
 	}
-	err = mockWriter.flush()
+	return newCmapSubtable(8, platformID, encodingID, st, charcodeToGID, decode), nil
+}
+
+func writeCmapSubtableFormat8(subtable *cmapSubtable, w *byteWriter) error {
+	subt := subtable.ctx.(cmapSubtableFormat8)
+	format := uint16(8)
+	subt.numGroups = uint32(len(subt.groups))
+	subt.length = 2*2 + 2*4 + 8192 + 4 + subt.numGroups*3*4
+	err := w.write(format, subt.reserved, subt.length, subt.language)
 	if err != nil {
 		return err
 	}
-
-	// Output the encoding records and the mock buffer.
-	for _, rec := range encodingRecords {
-		rec.offset += offset32(4 + 8*len(encodingRecords)) // Add static part.
-		err := w.write(rec.platformID, rec.encodingID, rec.offset)
+	err = w.writeBytes(subt.is32)
+	if err != nil {
+		return err
+	}
+	err = w.write(subt.numGroups)
+	if err != nil {
+		return err
+	}
+	for _, group := range subt.groups {
+		err = w.write(group.startCharCode, group.endCharCode, group.startGlyphID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *font) parseCmapSubtableFormat10(r *byteReader, platformID, encodingID int) (*cmapSubtable, error) {
+	st := cmapSubtableFormat10{}
+	err := r.read(&st.reserved, &st.length, &st.language, &st.startCharCode, &st.numChars)
+	if err != nil {
+		return nil, err
+	}
+	if int64(st.numChars)*2 > int64(st.length) || st.startCharCode+st.numChars < st.startCharCode {
+		logger.Debugf("Invalid number of chars (%d)", st.numChars)
+		return nil, errRangeCheck
+	}
+	err = r.readSlice(&st.glyphs, int(st.numChars))
+	if err != nil {
+		return nil, err
+	}
+
+	charcodeToGID := map[CharCode]GlyphIndex{}
+	for i, gid := range st.glyphs {
+		if gid == 0 || int(gid) >= int(f.maxp.numGlyphs) {
+			continue
+		}
+		charcodeToGID[CharCode(st.startCharCode+uint32(i))] = GlyphIndex(gid)
+	}
+	return newCmapSubtable(10, platformID, encodingID, st, charcodeToGID,
+		getCharcodeDecoder(platformID, encodingID)), nil
+}
+
+func writeCmapSubtableFormat10(subtable *cmapSubtable, w *byteWriter) error {
+	subt := subtable.ctx.(cmapSubtableFormat10)
+	format := uint16(10)
+	subt.numChars = uint32(len(subt.glyphs))
+	subt.length = 2*2 + 4*4 + subt.numChars*2
+	err := w.write(format, subt.reserved, subt.length, subt.language, subt.startCharCode, subt.numChars)
+	if err != nil {
+		return err
+	}
+	return w.writeSlice(subt.glyphs)
+}
+
+func (f *font) parseCmapSubtableFormat13(r *byteReader, platformID, encodingID int) (*cmapSubtable, error) {
+	st := cmapSubtableFormat13{}
+	err := r.read(&st.reserved, &st.length, &st.language, &st.numGroups)
+	if err != nil {
+		return nil, err
+	}
+	if int64(st.numGroups)*12 > int64(st.length) {
+		logger.Debugf("Too many groups (%d)", st.numGroups)
+		return nil, errRangeCheck
+	}
+	if int64(st.numGroups) > int64(f.opts.maxCmapSegments()) {
+		return nil, newLimitError("cmap format 13 group count %d exceeds %d", st.numGroups, f.opts.maxCmapSegments())
+	}
+
+	charcodeToGID := map[CharCode]GlyphIndex{}
+	numMapped := 0
+	for i := 0; i < int(st.numGroups); i++ {
+		var group sequentialMapGroup
+		err = r.read(&group.startCharCode, &group.endCharCode, &group.startGlyphID)
+		if err != nil {
+			return nil, err
+		}
+		st.groups = append(st.groups, group)
+
+		if group.startGlyphID >= uint32(f.maxp.numGlyphs) {
+			logger.Debugf("gid >= numGlyphs (%d > %d)", group.startGlyphID, f.maxp.numGlyphs)
+			continue
+		}
+		end := group.endCharCode
+		if end > maxCharCode32 {
+			end = maxCharCode32
+		}
+		if end >= group.startCharCode {
+			numMapped += int(end-group.startCharCode) + 1
+		}
+		if numMapped > maxCmapMappings {
+			logger.Debugf("Overlapping groups")
+			return nil, errRangeCheck
+		}
+		for cc := group.startCharCode; cc <= end; cc++ {
+			charcodeToGID[CharCode(cc)] = GlyphIndex(group.startGlyphID)
+		}
+	}
+	return newCmapSubtable(13, platformID, encodingID, st, charcodeToGID,
+		getCharcodeDecoder(platformID, encodingID)), nil
+}
+
+func writeCmapSubtableFormat13(subtable *cmapSubtable, w *byteWriter) error {
+	subt := subtable.ctx.(cmapSubtableFormat13)
+	format := uint16(13)
+	subt.numGroups = uint32(len(subt.groups))
+	subt.length = 2*2 + 3*4 + subt.numGroups*3*4
+	err := w.write(format, subt.reserved, subt.length, subt.language, subt.numGroups)
+	if err != nil {
+		return err
+	}
+	for _, group := range subt.groups {
+		err = w.write(group.startCharCode, group.endCharCode, group.startGlyphID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cmapSubtableFormat14 represents format 14: Unicode Variation Sequences.
+// Specifies the glyphs for Unicode variation sequences, i.e. a base character followed by a
+// variation selector. Glyphs for default variation sequences are obtained from the Unicode cmap
+// subtable of the font, whereas non-default variation sequences map directly to a glyph.
+type cmapSubtableFormat14 struct {
+	length                uint32
+	numVarSelectorRecords uint32
+	varSelectors          []variationSelector // len = numVarSelectorRecords, sorted by varSelector.
+}
+
+type variationSelector struct {
+	varSelector         uint24
+	defaultUVSOffset    offset32
+	nonDefaultUVSOffset offset32
+
+	defaultUVS    []unicodeRange // Default UVS table: ranges of base characters.
+	nonDefaultUVS []uvsMapping   // Non-default UVS table: base character to glyph mappings.
+}
+
+type unicodeRange struct {
+	startUnicodeValue uint24
+	additionalCount   uint8
+}
+
+type uvsMapping struct {
+	unicodeValue uint24
+	glyphID      uint16
+}
+
+func (f *font) parseCmapSubtableFormat14(r *byteReader, platformID, encodingID int) (*cmapSubtable, error) {
+	// Offsets are relative to the start of the subtable (prior to format).
+	start := r.Offset() - 2
+
+	st := cmapSubtableFormat14{}
+	err := r.read(&st.length, &st.numVarSelectorRecords)
+	if err != nil {
+		return nil, err
+	}
+	if int64(st.numVarSelectorRecords)*11 > int64(st.length) {
+		logger.Debugf("Too many variation selector records (%d)", st.numVarSelectorRecords)
+		return nil, errRangeCheck
+	}
+
+	for i := 0; i < int(st.numVarSelectorRecords); i++ {
+		var vs variationSelector
+		err = r.read(&vs.varSelector, &vs.defaultUVSOffset, &vs.nonDefaultUVSOffset)
+		if err != nil {
+			return nil, err
+		}
+		st.varSelectors = append(st.varSelectors, vs)
+	}
+
+	for i := range st.varSelectors {
+		vs := &st.varSelectors[i]
+		if vs.defaultUVSOffset > 0 {
+			err = r.SeekTo(start + int64(vs.defaultUVSOffset))
+			if err != nil {
+				return nil, err
+			}
+			var numRanges uint32
+			err = r.read(&numRanges)
+			if err != nil {
+				return nil, err
+			}
+			if int64(numRanges)*4 > int64(st.length) {
+				return nil, errRangeCheck
+			}
+			err = r.checkRemaining(int64(numRanges) * 4)
+			if err != nil {
+				return nil, err
+			}
+			vs.defaultUVS = make([]unicodeRange, numRanges)
+			for j := range vs.defaultUVS {
+				err = r.read(&vs.defaultUVS[j].startUnicodeValue, &vs.defaultUVS[j].additionalCount)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if vs.nonDefaultUVSOffset > 0 {
+			err = r.SeekTo(start + int64(vs.nonDefaultUVSOffset))
+			if err != nil {
+				return nil, err
+			}
+			var numMappings uint32
+			err = r.read(&numMappings)
+			if err != nil {
+				return nil, err
+			}
+			if int64(numMappings)*5 > int64(st.length) {
+				return nil, errRangeCheck
+			}
+			err = r.checkRemaining(int64(numMappings) * 5)
+			if err != nil {
+				return nil, err
+			}
+			vs.nonDefaultUVS = make([]uvsMapping, numMappings)
+			for j := range vs.nonDefaultUVS {
+				err = r.read(&vs.nonDefaultUVS[j].unicodeValue, &vs.nonDefaultUVS[j].glyphID)
+				if err != nil {
+					return nil, err
+				}
+				if int(vs.nonDefaultUVS[j].glyphID) >= int(f.maxp.numGlyphs) {
+					logger.Debugf("UVS glyph out of range (%d >= %d)", vs.nonDefaultUVS[j].glyphID, f.maxp.numGlyphs)
+					vs.nonDefaultUVS[j].glyphID = 0
+				}
+			}
+		}
+	}
+
+	return &cmapSubtable{
+		format:        14,
+		ctx:           st,
+		platformID:    platformID,
+		encodingID:    encodingID,
+		cmap:          map[rune]GlyphIndex{},
+		charcodeToGID: map[CharCode]GlyphIndex{},
+	}, nil
+}
+
+func writeCmapSubtableFormat14(subtable *cmapSubtable, w *byteWriter) error {
+	subt := subtable.ctx.(cmapSubtableFormat14)
+
+	// Calculate the offsets of the default and non-default UVS tables.
+	offset := 2 + 4 + 4 + 11*len(subt.varSelectors)
+	for i := range subt.varSelectors {
+		vs := &subt.varSelectors[i]
+		vs.defaultUVSOffset = 0
+		if len(vs.defaultUVS) > 0 {
+			vs.defaultUVSOffset = offset32(offset)
+			offset += 4 + 4*len(vs.defaultUVS)
+		}
+		vs.nonDefaultUVSOffset = 0
+		if len(vs.nonDefaultUVS) > 0 {
+			vs.nonDefaultUVSOffset = offset32(offset)
+			offset += 4 + 5*len(vs.nonDefaultUVS)
+		}
+	}
+	subt.length = uint32(offset)
+	subt.numVarSelectorRecords = uint32(len(subt.varSelectors))
+
+	format := uint16(14)
+	err := w.write(format, subt.length, subt.numVarSelectorRecords)
+	if err != nil {
+		return err
+	}
+	for _, vs := range subt.varSelectors {
+		err = w.write(vs.varSelector, vs.defaultUVSOffset, vs.nonDefaultUVSOffset)
+		if err != nil {
+			return err
+		}
+	}
+	for _, vs := range subt.varSelectors {
+		if len(vs.defaultUVS) > 0 {
+			err = w.write(uint32(len(vs.defaultUVS)))
+			if err != nil {
+				return err
+			}
+			for _, ur := range vs.defaultUVS {
+				err = w.write(ur.startUnicodeValue, ur.additionalCount)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if len(vs.nonDefaultUVS) > 0 {
+			err = w.write(uint32(len(vs.nonDefaultUVS)))
+			if err != nil {
+				return err
+			}
+			for _, m := range vs.nonDefaultUVS {
+				err = w.write(m.unicodeValue, m.glyphID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the glyph index of the variation sequence of `base` followed by `selector`.
+// Returns true as the second value if the sequence is a default variation sequence, in which case
+// the glyph is obtained from the Unicode cmap. The last return value is false if the sequence
+// is not found.
+func (t cmapSubtableFormat14) lookup(base, selector rune) (GlyphIndex, bool, bool) {
+	for _, vs := range t.varSelectors {
+		if rune(vs.varSelector) != selector {
+			continue
+		}
+		for _, ur := range vs.defaultUVS {
+			start := rune(ur.startUnicodeValue)
+			if base >= start && base <= start+rune(ur.additionalCount) {
+				return 0, true, true
+			}
+		}
+		for _, m := range vs.nonDefaultUVS {
+			if rune(m.unicodeValue) == base {
+				return GlyphIndex(m.glyphID), false, true
+			}
+		}
+		return 0, false, false
+	}
+	return 0, false, false
+}
+
+// remap returns a copy of `t` with the glyph indices of the non-default variation sequences mapped
+// through `oldnew`. Sequences to glyphs not in `oldnew` are dropped. Default variation sequences
+// are dropped if `hasRune` is not nil and returns false for the base character.
+func (t cmapSubtableFormat14) remap(oldnew map[GlyphIndex]GlyphIndex, hasRune func(r rune) bool) cmapSubtableFormat14 {
+	newt := cmapSubtableFormat14{}
+	for _, vs := range t.varSelectors {
+		newvs := variationSelector{varSelector: vs.varSelector}
+		for _, ur := range vs.defaultUVS {
+			if hasRune == nil {
+				newvs.defaultUVS = append(newvs.defaultUVS, ur)
+				continue
+			}
+			// Split the range into the sub-ranges of base characters still present.
+			start := rune(ur.startUnicodeValue)
+			end := start + rune(ur.additionalCount)
+			for r := start; r <= end; r++ {
+				if !hasRune(r) {
+					continue
+				}
+				n := len(newvs.defaultUVS)
+				if n > 0 {
+					last := &newvs.defaultUVS[n-1]
+					if rune(last.startUnicodeValue)+rune(last.additionalCount)+1 == r && last.additionalCount < 0xFF {
+						last.additionalCount++
+						continue
+					}
+				}
+				newvs.defaultUVS = append(newvs.defaultUVS, unicodeRange{startUnicodeValue: uint24(r)})
+			}
+		}
+		for _, m := range vs.nonDefaultUVS {
+			if newgid, has := oldnew[GlyphIndex(m.glyphID)]; has {
+				newvs.nonDefaultUVS = append(newvs.nonDefaultUVS, uvsMapping{
+					unicodeValue: m.unicodeValue,
+					glyphID:      uint16(newgid),
+				})
+			}
+		}
+		if len(newvs.defaultUVS) == 0 && len(newvs.nonDefaultUVS) == 0 {
+			continue
+		}
+		newt.varSelectors = append(newt.varSelectors, newvs)
+	}
+	newt.numVarSelectorRecords = uint32(len(newt.varSelectors))
+	return newt
+}
+
+// sortedSubtableKeys returns the keys of the subtables of `t` in the order of the encoding records as required
+// by the spec: by platform ID and then encoding ID. Subtables with the same IDs keep their order.
+func (t *cmapTable) sortedSubtableKeys() []string {
+	keys := append([]string(nil), t.subtableKeys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		si, sj := t.subtables[keys[i]], t.subtables[keys[j]]
+		if si.platformID != sj.platformID {
+			return si.platformID < sj.platformID
+		}
+		return si.encodingID < sj.encodingID
+	})
+	return keys
+}
+
+func (f *font) writeCmap(w *byteWriter) error {
+	if f.cmap == nil {
+		return nil
+	}
+	t := f.cmap
+
+	// Write the cmap subtables to an in-memory mock buffer to calculate offsets.
+	var mockBuffer bytes.Buffer
+	mockWriter := newByteWriter(&mockBuffer)
+
+	var encodingRecords []encodingRecord
+	for _, subtkey := range t.sortedSubtableKeys() {
+		subt := t.subtables[subtkey]
+		rec := encodingRecord{
+			platformID: uint16(subt.platformID),
+			encodingID: uint16(subt.encodingID),
+			offset:     offset32(mockWriter.bufferedLen()),
+		}
+
+		supported := true
+		switch subt.format {
+		case 0:
+			err := writeCmapSubtableFormat0(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 2:
+			err := writeCmapSubtableFormat2(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 4:
+			err := writeCmapSubtableFormat4(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 6:
+			err := writeCmapSubtableFormat6(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 12:
+			err := writeCmapSubtableFormat12(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 8:
+			err := writeCmapSubtableFormat8(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 10:
+			err := writeCmapSubtableFormat10(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 13:
+			err := writeCmapSubtableFormat13(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		case 14:
+			err := writeCmapSubtableFormat14(subt, mockWriter)
+			if err != nil {
+				return err
+			}
+		default:
+			supported = false
+		}
+
+		if supported {
+			encodingRecords = append(encodingRecords, rec)
+		}
+	}
+	err := mockWriter.flush()
+	if err != nil {
+		return err
+	}
+
+	// Only the supported subtables are written out.
+	t.numTables = uint16(len(encodingRecords))
+	err = w.write(t.version, t.numTables)
+	if err != nil {
+		return err
+	}
+
+	// Output the encoding records and the mock buffer.
+	for _, rec := range encodingRecords {
+		rec.offset += offset32(4 + 8*len(encodingRecords)) // Add static part.
+		err := w.write(rec.platformID, rec.encodingID, rec.offset)
 		if err != nil {
 			return err
 		}
 	}
 	return w.writeBytes(mockBuffer.Bytes())
 }
+
+// optimizeCmap removes cmap subtables that duplicate another subtable, i.e. have the same format,
+// encoding and character code to glyph index mapping. Windows platform subtables are preferred
+// over the Unicode platform duplicates.
+func (f *font) optimizeCmap() {
+	if f.cmap == nil {
+		return
+	}
+	t := f.cmap
+
+	isDuplicate := func(a, b *cmapSubtable) bool {
+		if a.format != b.format {
+			return false
+		}
+		if getCmapEncoding(a.platformID, a.encodingID) != getCmapEncoding(b.platformID, b.encodingID) {
+			return false
+		}
+		if len(a.charcodeToGID) != len(b.charcodeToGID) {
+			return false
+		}
+		for cc, gid := range a.charcodeToGID {
+			if bgid, has := b.charcodeToGID[cc]; !has || bgid != gid {
+				return false
+			}
+		}
+		return true
+	}
+
+	removed := map[string]bool{}
+	for i, keyi := range t.subtableKeys {
+		if removed[keyi] {
+			continue
+		}
+		for _, keyj := range t.subtableKeys[i+1:] {
+			if removed[keyj] {
+				continue
+			}
+			subti, subtj := t.subtables[keyi], t.subtables[keyj]
+			if !isDuplicate(subti, subtj) {
+				continue
+			}
+			if subti.platformID == platformIDUnicode && subtj.platformID == platformIDWindows {
+				logger.Debugf("Removing duplicate cmap subtable %s (same as %s)", keyi, keyj)
+				removed[keyi] = true
+				break
+			}
+			logger.Debugf("Removing duplicate cmap subtable %s (same as %s)", keyj, keyi)
+			removed[keyj] = true
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	var keys []string
+	for _, key := range t.subtableKeys {
+		if removed[key] {
+			delete(t.subtables, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	t.subtableKeys = keys
+	t.numTables = uint16(len(keys))
+}
+
+// mappedRunes returns the sorted runes that are mapped in any of the cmap subtables to a glyph index
+// other than 0 and for which `keep` returns true.
+func (f *font) mappedRunes(keep func(gid GlyphIndex) bool) []rune {
+	if f.cmap == nil {
+		return nil
+	}
+
+	seen := map[rune]struct{}{}
+	var runes []rune
+	for _, key := range f.cmap.subtableKeys {
+		subt, has := f.cmap.subtables[key]
+		if !has {
+			continue
+		}
+		for r, gid := range subt.cmap {
+			if gid == 0 || !keep(gid) {
+				continue
+			}
+			if _, has := seen[r]; has {
+				continue
+			}
+			seen[r] = struct{}{}
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		return runes[i] < runes[j]
+	})
+	return runes
+}
+
+// makeCmapFormat4 generates a format 4 subtable representing the mappings in `charcodeToGID`.
+// Character codes beyond 0xFFFF are ignored. Consecutive character codes mapping to consecutive
+// glyph indices are grouped into segments using only the deltas (no glyphIDArray). Can lead to many
+// segments, but should not be too bad (especially when subsetting).
+func makeCmapFormat4(charcodeToGID map[CharCode]GlyphIndex, language uint16) cmapSubtableFormat4 {
+	charcodes := make([]CharCode, 0, len(charcodeToGID))
+	for cc := range charcodeToGID {
+		if cc > 0xFFFF {
+			continue
+		}
+		charcodes = append(charcodes, cc)
+	}
+	sort.Slice(charcodes, func(i, j int) bool {
+		return charcodes[i] < charcodes[j]
+	})
+
+	t := cmapSubtableFormat4{}
+	segments := 0
+	i := 0
+	for i < len(charcodes) {
+		j := i + 1
+		for ; j < len(charcodes); j++ {
+			if int(charcodes[j]-charcodes[i]) != j-i ||
+				int(charcodeToGID[charcodes[j]])-int(charcodeToGID[charcodes[i]]) != j-i {
+				break
+			}
+		}
+		// from i:j-1 maps to charcodes[i]:charcodes[i]+j-i-1
+		startCode := uint16(charcodes[i])
+		endCode := uint16(charcodes[i]) + uint16(j-i-1)
+		idDelta := uint16(charcodeToGID[charcodes[i]]) - uint16(charcodes[i])
+
+		t.startCode = append(t.startCode, startCode)
+		t.endCode = append(t.endCode, endCode)
+		t.idDelta = append(t.idDelta, idDelta)
+		t.idRangeOffset = append(t.idRangeOffset, 0)
+		segments++
+		i = j
+	}
+
+	// The last segment must end with 0xFFFF.
+	if segments == 0 || t.endCode[segments-1] < 0xFFFF {
+		t.endCode = append(t.endCode, 0xFFFF)
+		t.startCode = append(t.startCode, 0xFFFF)
+		t.idDelta = append(t.idDelta, 1)
+		t.idRangeOffset = append(t.idRangeOffset, 0)
+		segments++
+	}
+
+	t.length = uint16(2*8 + 2*4*segments)
+	t.language = language
+	t.segCountX2 = uint16(segments * 2)
+	t.searchRange = 2 * uint16(math.Pow(2, math.Floor(math.Log2(float64(segments)))))
+	t.entrySelector = uint16(math.Log2(float64(t.searchRange) / 2.0))
+	t.rangeShift = uint16(segments*2) - t.searchRange
+	return t
+}
+
+// makeCmapFormat12 generates a format 12 subtable representing the mappings in `charcodeToGID`.
+func makeCmapFormat12(charcodeToGID map[CharCode]GlyphIndex, language uint32) cmapSubtableFormat12 {
+	charcodes := make([]CharCode, 0, len(charcodeToGID))
+	for cc := range charcodeToGID {
+		charcodes = append(charcodes, cc)
+	}
+	sort.Slice(charcodes, func(i, j int) bool {
+		return charcodes[i] < charcodes[j]
+	})
+
+	t := cmapSubtableFormat12{}
+	i := 0
+	for i < len(charcodes) {
+		j := i + 1
+		for ; j < len(charcodes); j++ {
+			if int(charcodes[j]-charcodes[i]) != j-i ||
+				int(charcodeToGID[charcodes[j]])-int(charcodeToGID[charcodes[i]]) != j-i {
+				break
+			}
+		}
+		// from i:j-1 maps to charcodes[i]:charcodes[i]+j-i-1
+		group := sequentialMapGroup{
+			startCharCode: uint32(charcodes[i]),
+			endCharCode:   uint32(charcodes[i]) + uint32(j-i-1),
+			startGlyphID:  uint32(charcodeToGID[charcodes[i]]),
+		}
+		t.groups = append(t.groups, group)
+		i = j
+	}
+
+	t.length = uint32(2*2 + 3*4 + len(t.groups)*3*4)
+	t.language = language
+	t.numGroups = uint32(len(t.groups))
+	return t
+}
+
+// newUnicodeCmap returns a cmap table with the mappings of `runeToGID`: a (3,1) format 4 subtable of the runes
+// in the BMP and, if any rune is beyond the BMP, a (3,10) format 12 subtable of all runes.
+// An error is returned if the format 4 subtable exceeds its maximum length.
+func newUnicodeCmap(runeToGID map[rune]GlyphIndex) (*cmapTable, error) {
+	bmp := map[CharCode]GlyphIndex{}
+	full := map[CharCode]GlyphIndex{}
+	for r, gid := range runeToGID {
+		if r <= 0xFFFF {
+			bmp[CharCode(r)] = gid
+		}
+		full[CharCode(r)] = gid
+	}
+
+	t := &cmapTable{subtables: map[string]*cmapSubtable{}}
+	add := func(format, platformID, encodingID int, ctx interface{}, charcodeToGID map[CharCode]GlyphIndex) {
+		key := fmt.Sprintf("%d,%d,%d", format, platformID, encodingID)
+		t.subtables[key] = newCmapSubtable(format, platformID, encodingID, ctx, charcodeToGID,
+			getCharcodeDecoder(platformID, encodingID))
+		t.subtableKeys = append(t.subtableKeys, key)
+	}
+
+	format4 := makeCmapFormat4(bmp, 0)
+	if segments := len(format4.endCode); 16+8*segments > 0xFFFF {
+		return nil, fmt.Errorf("cmap format 4 subtable too long (%d segments)", segments)
+	}
+	add(4, platformIDWindows, 1, format4, bmp)
+	if len(full) > len(bmp) {
+		add(12, platformIDWindows, 10, makeCmapFormat12(full, 0), full)
+	}
+	t.numTables = uint16(len(t.subtables))
+	return t, nil
+}
+
+// EnsureCmap synthesizes a cmap table for `f` if it has none, as is common for subsetted fonts extracted from
+// PDF documents where the encoding is supplied by the document. If `identityForGIDs` is set, the table has a
+// (3,1) format 4 subtable mapping the code points equal to the glyph indices to the glyphs, skipping notdef
+// and the surrogate code points, for looking up the glyphs of an Identity encoding. Otherwise the table has an
+// empty (3,0) symbol subtable. To build the cmap from a known mapping of runes to glyphs, use SetCmapFromMap.
+// Returns true if the table was synthesized.
+// An ErrRequiredTableMissing error is returned if `f` has no maxp table.
+func (f *Font) EnsureCmap(identityForGIDs bool) (bool, error) {
+	if f.cmap != nil {
+		return false, nil
+	}
+	if f.maxp == nil {
+		return false, ErrRequiredTableMissing{Tag: "maxp"}
+	}
+
+	if identityForGIDs {
+		runeToGID := map[rune]GlyphIndex{}
+		for gid := 1; gid < int(f.maxp.numGlyphs); gid++ {
+			if gid >= 0xD800 && gid <= 0xDFFF {
+				continue
+			}
+			runeToGID[rune(gid)] = GlyphIndex(gid)
+		}
+		err := f.SetCmapFromMap(runeToGID)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	empty := map[CharCode]GlyphIndex{}
+	key := fmt.Sprintf("%d,%d,%d", 4, platformIDWindows, 0)
+	f.cmap = &cmapTable{
+		numTables: 1,
+		subtables: map[string]*cmapSubtable{
+			key: newCmapSubtable(4, platformIDWindows, 0, makeCmapFormat4(empty, 0), empty,
+				getCharcodeDecoder(platformIDWindows, 0)),
+		},
+		subtableKeys: []string{key},
+	}
+	f.markDirty("cmap")
+	f.resetRuneLookupMap()
+	return true, nil
+}
+
+// remap returns a copy of the cmap table `t` with the glyph indices mapped through `oldnew`.
+// Mappings to glyphs that are not in `oldnew` are dropped.
+func (t *cmapTable) remap(oldnew map[GlyphIndex]GlyphIndex) *cmapTable {
+	newt := &cmapTable{
+		version:   t.version,
+		subtables: map[string]*cmapSubtable{},
+	}
+	for _, key := range t.subtableKeys {
+		subt, has := t.subtables[key]
+		if !has {
+			continue
+		}
+		newt.subtableKeys = append(newt.subtableKeys, key)
+		newt.subtables[key] = subt.remap(oldnew)
+	}
+	newt.numTables = uint16(len(newt.subtables))
+
+	// Default variation sequences refer to the glyphs of the base characters in the Unicode
+	// subtables, drop the ones for base characters that are no longer mapped.
+	for _, key := range newt.subtableKeys {
+		if st, ok := t.subtables[key].ctx.(cmapSubtableFormat14); ok {
+			newt.subtables[key].ctx = st.remap(oldnew, newt.hasRune)
+		}
+	}
+	return newt
+}
+
+// hasRune returns true if `r` is mapped to a glyph other than notdef in any of the subtables of `t`.
+func (t *cmapTable) hasRune(r rune) bool {
+	for _, subt := range t.subtables {
+		if gid, has := subt.cmap[r]; has && gid != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// remap returns a copy of the cmap subtable `subt` with the glyph indices mapped through `oldnew`.
+// Mappings to glyphs that are not in `oldnew` are dropped.
+func (subt *cmapSubtable) remap(oldnew map[GlyphIndex]GlyphIndex) *cmapSubtable {
+	news := &cmapSubtable{
+		format:              subt.format,
+		platformID:          subt.platformID,
+		encodingID:          subt.encodingID,
+		cmap:                map[rune]GlyphIndex{},
+		charcodeToGID:       map[CharCode]GlyphIndex{},
+		runeToCharcodeBytes: map[rune][]byte{},
+	}
+
+	for r, gid := range subt.cmap {
+		if newgid, has := oldnew[gid]; has {
+			news.cmap[r] = newgid
+			news.runes = append(news.runes, r)
+			if b, has := subt.runeToCharcodeBytes[r]; has {
+				news.runeToCharcodeBytes[r] = b
+			}
+		}
+	}
+	sort.Slice(news.runes, func(i, j int) bool {
+		return news.runes[i] < news.runes[j]
+	})
+	for cc, gid := range subt.charcodeToGID {
+		if newgid, has := oldnew[gid]; has {
+			news.charcodes = append(news.charcodes, cc)
+			news.charcodeToGID[cc] = newgid
+		}
+	}
+	sort.Slice(news.charcodes, func(i, j int) bool {
+		return news.charcodes[i] < news.charcodes[j]
+	})
+
+	switch t := subt.ctx.(type) {
+	case cmapSubtableFormat0:
+		newt := t
+		newt.glyphIDArray = make([]uint8, len(t.glyphIDArray))
+		for i, gid := range t.glyphIDArray {
+			if newgid, has := oldnew[GlyphIndex(gid)]; has && newgid <= 0xFF {
+				newt.glyphIDArray[i] = uint8(newgid)
+			}
+		}
+		news.ctx = newt
+	case cmapSubtableFormat2:
+		news.ctx = makeCmapFormat2(news.charcodeToGID, t.language)
+	case cmapSubtableFormat4:
+		news.ctx = makeCmapFormat4(news.charcodeToGID, t.language)
+	case cmapSubtableFormat6:
+		newt := t
+		newt.glyphIDArray = make([]uint16, len(t.glyphIDArray))
+		for i, gid := range t.glyphIDArray {
+			if newgid, has := oldnew[GlyphIndex(gid)]; has {
+				newt.glyphIDArray[i] = uint16(newgid)
+			}
+		}
+		news.ctx = newt
+	case cmapSubtableFormat12:
+		news.ctx = makeCmapFormat12(news.charcodeToGID, t.language)
+	case cmapSubtableFormat8:
+		newt := t
+		newt.groups = makeCmapFormat12(news.charcodeToGID, t.language).groups
+		newt.numGroups = uint32(len(newt.groups))
+		news.ctx = newt
+	case cmapSubtableFormat10:
+		newt := t
+		newt.glyphs = make([]uint16, len(t.glyphs))
+		for i, gid := range t.glyphs {
+			if newgid, has := oldnew[GlyphIndex(gid)]; has {
+				newt.glyphs[i] = uint16(newgid)
+			}
+		}
+		news.ctx = newt
+	case cmapSubtableFormat13:
+		newt := t
+		newt.groups = nil
+		for _, group := range t.groups {
+			if newgid, has := oldnew[GlyphIndex(group.startGlyphID)]; has && group.startGlyphID <= 0xFFFF {
+				group.startGlyphID = uint32(newgid)
+				newt.groups = append(newt.groups, group)
+			}
+		}
+		newt.numGroups = uint32(len(newt.groups))
+		news.ctx = newt
+	case cmapSubtableFormat14:
+		news.ctx = t.remap(oldnew, nil)
+	default:
+		news.ctx = subt.ctx
+	}
+	return news
+}
+
+// cmapPreference lists the platform and encoding IDs of the cmap subtables usable for rune lookup
+// in the order of preference: Unicode BMP, Macintosh Roman and Windows Symbol.
+var cmapPreference = []struct {
+	platformID int
+	encodingID int
+}{
+	{3, 1}, {0, 3}, {0, 4}, {0, 6}, {3, 10}, {0, 2}, {0, 1}, {0, 0}, {1, 0}, {3, 0},
+}
+
+// cmapPreferenceFull lists the full repertoire Unicode subtables, which are preferred when they cover
+// supplementary planes.
+var cmapPreferenceFull = []struct {
+	platformID int
+	encodingID int
+}{
+	{3, 10}, {0, 6}, {0, 4},
+}
+
+// getCmapSubtable returns the first cmap subtable with `platformID` and `encodingID` or nil if not found.
+func (f *font) getCmapSubtable(platformID, encodingID int) *cmapSubtable {
+	if f.cmap == nil {
+		return nil
+	}
+	for _, key := range f.cmap.subtableKeys {
+		subt, has := f.cmap.subtables[key]
+		if !has || subt.format == 14 {
+			continue
+		}
+		if subt.platformID == platformID && subt.encodingID == encodingID {
+			return subt
+		}
+	}
+	return nil
+}
+
+// cmapSubtablesByPreference returns the cmap subtables usable for rune lookup in order of preference.
+// See GetBestCmap.
+func (f *font) cmapSubtablesByPreference() []*cmapSubtable {
+	var subts []*cmapSubtable
+	seen := map[*cmapSubtable]bool{}
+	add := func(subt *cmapSubtable) {
+		if subt != nil && len(subt.cmap) > 0 && !seen[subt] {
+			seen[subt] = true
+			subts = append(subts, subt)
+		}
+	}
+
+	for _, pref := range cmapPreferenceFull {
+		subt := f.getCmapSubtable(pref.platformID, pref.encodingID)
+		if subt == nil {
+			continue
+		}
+		for r := range subt.cmap {
+			if r > 0xFFFF {
+				add(subt)
+				break
+			}
+		}
+	}
+	for _, pref := range cmapPreference {
+		add(f.getCmapSubtable(pref.platformID, pref.encodingID))
+	}
+	return subts
+}
+
+// cmapSubtablesAll returns all cmap subtables usable for rune lookup, the preferred ones first (see
+// cmapSubtablesByPreference) followed by the remaining subtables in the order they were parsed.
+func (f *font) cmapSubtablesAll() []*cmapSubtable {
+	subts := f.cmapSubtablesByPreference()
+	if f.cmap == nil {
+		return subts
+	}
+
+	seen := map[*cmapSubtable]bool{}
+	for _, subt := range subts {
+		seen[subt] = true
+	}
+	for _, key := range f.cmap.subtableKeys {
+		subt, has := f.cmap.subtables[key]
+		if !has || subt.format == 14 || len(subt.cmap) == 0 || seen[subt] {
+			continue
+		}
+		seen[subt] = true
+		subts = append(subts, subt)
+	}
+	return subts
+}
@@ -7,6 +7,7 @@ package unitype
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"testing"
 
@@ -178,7 +179,7 @@ func TestCmapTableReadWrite(t *testing.T) {
 			// Write, read back and repeat checks.
 			var buf bytes.Buffer
 			bw := newByteWriter(&buf)
-			err = fnt.write(bw)
+			err = fnt.write(bw, nil)
 			require.NoError(t, err)
 			err = bw.flush()
 			require.NoError(t, err)
@@ -211,3 +212,412 @@ func TestCmapTableReadWrite(t *testing.T) {
 		})
 	}
 }
+
+func TestCmapFormat14(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	gids, _ := fnt.LookupRunes([]rune("abcxyz"))
+	uvs := cmapSubtableFormat14{
+		varSelectors: []variationSelector{
+			{
+				varSelector: 0xFE00,
+				defaultUVS:  []unicodeRange{{startUnicodeValue: 'a'}},
+				nonDefaultUVS: []uvsMapping{
+					{unicodeValue: 'b', glyphID: uint16(gids[2])},
+				},
+			},
+			{
+				varSelector: 0xFE01,
+				defaultUVS:  []unicodeRange{{startUnicodeValue: 'x', additionalCount: 2}},
+			},
+		},
+	}
+	fnt.cmap.subtables["14,0,5"] = &cmapSubtable{format: 14, platformID: 0, encodingID: 5, ctx: uvs}
+	fnt.cmap.subtableKeys = append(fnt.cmap.subtableKeys, "14,0,5")
+	fnt.cmap.numTables++
+
+	var buf bytes.Buffer
+	err = fnt.Write(&buf)
+	require.NoError(t, err)
+	err = ValidateBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	fnt, err = parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	require.Contains(t, fnt.cmap.subtables, "14,0,5")
+
+	testcases := []struct {
+		base, selector rune
+		gid            GlyphIndex
+		found          bool
+	}{
+		{'a', 0xFE00, gids[0], true},
+		{'b', 0xFE00, gids[2], true},
+		{'c', 0xFE00, 0, false},
+		{'y', 0xFE01, gids[4], true},
+		{'a', 0xFE01, 0, false},
+		{'a', 0xFE0F, 0, false},
+	}
+	for _, tcase := range testcases {
+		gid, found := fnt.GetVariationGlyph(tcase.base, tcase.selector)
+		assert.Equal(t, tcase.found, found, "%c %X", tcase.base, tcase.selector)
+		assert.Equal(t, tcase.gid, gid, "%c %X", tcase.base, tcase.selector)
+	}
+
+	// Subsetting drops the variation sequences of pruned glyphs.
+	indices, _ := fnt.LookupRunes([]rune("ac"))
+	subfnt, oldnew, err := fnt.Subset(indices)
+	require.NoError(t, err)
+	buf.Reset()
+	err = subfnt.Write(&buf)
+	require.NoError(t, err)
+	subfnt, err = parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	gid, found := subfnt.GetVariationGlyph('a', 0xFE00)
+	assert.True(t, found)
+	assert.Equal(t, oldnew[gids[0]], gid)
+	gid, found = subfnt.GetVariationGlyph('b', 0xFE00)
+	assert.True(t, found)
+	assert.Equal(t, oldnew[gids[2]], gid)
+	_, found = subfnt.GetVariationGlyph('y', 0xFE01)
+	assert.False(t, found)
+	uvs = subfnt.cmap.subtables["14,0,5"].ctx.(cmapSubtableFormat14)
+	assert.Len(t, uvs.varSelectors, 1)
+}
+
+func TestCmapFormat2(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	// Handcrafted Shift-JIS subtable with a single-byte subHeader and a subHeader for lead byte 0x81.
+	var buf bytes.Buffer
+	w := newByteWriter(&buf)
+	subHeaderKeys := make([]uint16, 256)
+	subHeaderKeys[0x81] = 8
+	require.NoError(t, w.write(uint16(3*2+256*2+2*8+4*2), uint16(0)))
+	require.NoError(t, w.writeSlice(subHeaderKeys))
+	require.NoError(t, w.write(uint16(0x20), uint16(2), int16(0), uint16(2*8-6)))
+	require.NoError(t, w.write(uint16(0x40), uint16(2), int16(5), uint16(2*8+2*2-14)))
+	require.NoError(t, w.writeSlice([]uint16{3, 0, 10, 11}))
+	require.NoError(t, w.flush())
+
+	subt, err := fnt.parseCmapSubtableFormat2(newByteReader(bytes.NewReader(buf.Bytes())), 3, 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[CharCode]GlyphIndex{0x20: 3, 0x8140: 15, 0x8141: 16}, subt.charcodeToGID)
+	assert.Equal(t, map[rune]GlyphIndex{' ': 3, '　': 15, '、': 16}, subt.cmap)
+
+	// Regenerated subtable survives a write and parse round trip.
+	subt.ctx = makeCmapFormat2(subt.charcodeToGID, 0)
+	fnt.cmap.subtables["2,3,2"] = subt
+	fnt.cmap.subtableKeys = append(fnt.cmap.subtableKeys, "2,3,2")
+	fnt.cmap.numTables++
+
+	buf.Reset()
+	err = fnt.Write(&buf)
+	require.NoError(t, err)
+	err = ValidateBytes(buf.Bytes())
+	require.NoError(t, err)
+	fnt, err = parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[rune]GlyphIndex{' ': 3, '　': 15, '、': 16}, fnt.GetCmap(3, 2))
+	assert.Equal(t, subt.ctx, fnt.cmap.subtables["2,3,2"].ctx)
+
+	subfnt, oldnew, err := fnt.Subset([]GlyphIndex{15})
+	require.NoError(t, err)
+	assert.Equal(t, map[rune]GlyphIndex{'　': oldnew[15]}, subfnt.GetCmap(3, 2))
+}
+
+func TestCmapFormats8To13(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	is32 := make([]uint8, 8192)
+	is32[0xD83D/8] |= 1 << (7 - 0xD83D%8)
+	subtables := map[string]*cmapSubtable{
+		"8,3,1": {format: 8, platformID: 3, encodingID: 1, ctx: cmapSubtableFormat8{
+			is32: is32,
+			groups: []sequentialMapGroup{
+				{startCharCode: 'a', endCharCode: 'c', startGlyphID: 70},
+				{startCharCode: 0xD83DDE00, endCharCode: 0xD83DDE00, startGlyphID: 5},
+			},
+		}},
+		"10,3,10": {format: 10, platformID: 3, encodingID: 10, ctx: cmapSubtableFormat10{
+			startCharCode: 0x1F600,
+			glyphs:        []uint16{70, 0, 72},
+		}},
+		"13,0,6": {format: 13, platformID: 0, encodingID: 6, ctx: cmapSubtableFormat13{
+			groups: []sequentialMapGroup{
+				{startCharCode: 0x0000, endCharCode: 0x00FF, startGlyphID: 1},
+				{startCharCode: 0x1F600, endCharCode: 0x1F64F, startGlyphID: 2},
+			},
+		}},
+		// Unsupported subtables are not written out.
+		"99,3,1": {format: 99, platformID: 3, encodingID: 1},
+	}
+	for key, subt := range subtables {
+		fnt.cmap.subtables[key] = subt
+		fnt.cmap.subtableKeys = append(fnt.cmap.subtableKeys, key)
+		fnt.cmap.numTables++
+	}
+
+	var buf bytes.Buffer
+	err = fnt.Write(&buf)
+	require.NoError(t, err)
+	err = ValidateBytes(buf.Bytes())
+	require.NoError(t, err)
+	fnt, err = parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 6, int(fnt.cmap.numTables))
+	assert.NotContains(t, fnt.cmap.subtables, "99,3,1")
+
+	assert.Equal(t, map[rune]GlyphIndex{'a': 70, 'b': 71, 'c': 72, 0x1F600: 5}, fnt.cmap.subtables["8,3,1"].cmap)
+	assert.Equal(t, map[rune]GlyphIndex{0x1F600: 70, 0x1F602: 72}, fnt.cmap.subtables["10,3,10"].cmap)
+	cmap13 := fnt.cmap.subtables["13,0,6"].cmap
+	assert.Len(t, cmap13, 256+80)
+	assert.Equal(t, GlyphIndex(1), cmap13['A'])
+	assert.Equal(t, GlyphIndex(2), cmap13[0x1F64F])
+
+	assert.Equal(t, subtables["8,3,1"].ctx.(cmapSubtableFormat8).groups,
+		fnt.cmap.subtables["8,3,1"].ctx.(cmapSubtableFormat8).groups)
+	assert.Equal(t, is32, fnt.cmap.subtables["8,3,1"].ctx.(cmapSubtableFormat8).is32)
+	assert.Equal(t, subtables["10,3,10"].ctx.(cmapSubtableFormat10).glyphs,
+		fnt.cmap.subtables["10,3,10"].ctx.(cmapSubtableFormat10).glyphs)
+	assert.Equal(t, subtables["13,0,6"].ctx.(cmapSubtableFormat13).groups,
+		fnt.cmap.subtables["13,0,6"].ctx.(cmapSubtableFormat13).groups)
+
+	// Subsetting remaps the glyph indices.
+	subfnt, oldnew, err := fnt.Subset([]GlyphIndex{2, 72})
+	require.NoError(t, err)
+	assert.Equal(t, map[rune]GlyphIndex{'c': oldnew[72]}, subfnt.cmap.subtables["8,3,1"].cmap)
+	assert.Equal(t, map[rune]GlyphIndex{0x1F602: oldnew[72]}, subfnt.cmap.subtables["10,3,10"].cmap)
+	assert.Len(t, subfnt.cmap.subtables["13,0,6"].cmap, 80)
+	buf.Reset()
+	err = subfnt.Write(&buf)
+	require.NoError(t, err)
+	err = ValidateBytes(buf.Bytes())
+	require.NoError(t, err)
+}
+
+func TestCmapOverlappingSegments(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	// writeFormat4 returns a format 4 subtable with segments from `startCode` to `endCode` and deltas `idDelta`.
+	writeFormat4 := func(startCode, endCode, idDelta []uint16) []byte {
+		var buf bytes.Buffer
+		w := newByteWriter(&buf)
+		segCount := len(startCode)
+		require.NoError(t, w.write(uint16(16+8*segCount), uint16(0), uint16(2*segCount), uint16(0), uint16(0),
+			uint16(0)))
+		require.NoError(t, w.writeSlice(endCode))
+		require.NoError(t, w.write(uint16(0)))
+		require.NoError(t, w.writeSlice(startCode))
+		require.NoError(t, w.writeSlice(idDelta))
+		require.NoError(t, w.writeSlice(make([]uint16, segCount)))
+		require.NoError(t, w.flush())
+		return buf.Bytes()
+	}
+
+	// Segments ending at 0xFFFF other than the last one looped forever.
+	b := writeFormat4([]uint16{0xFFFF, 0xFFFF}, []uint16{0xFFFF, 0xFFFF}, []uint16{1, 1})
+	subt, err := fnt.parseCmapSubtableFormat4(newByteReader(bytes.NewReader(b)), 3, 1)
+	require.NoError(t, err)
+	assert.Empty(t, subt.cmap)
+
+	// Overlapping segments mapping the same codes over and over.
+	var startCode, endCode, idDelta []uint16
+	for i := 0; i < 100; i++ {
+		startCode = append(startCode, 0)
+		endCode = append(endCode, 0xE00)
+		idDelta = append(idDelta, 0)
+	}
+	b = writeFormat4(append(startCode, 0xFFFF), append(endCode, 0xFFFF), append(idDelta, 1))
+	_, err = fnt.parseCmapSubtableFormat4(newByteReader(bytes.NewReader(b)), 3, 1)
+	assert.Equal(t, errRangeCheck, err)
+
+	var buf bytes.Buffer
+	w := newByteWriter(&buf)
+
+	// Format 13 groups spanning all of Unicode.
+	numGroups := 1000
+	require.NoError(t, w.write(uint16(0), uint32(16+12*numGroups), uint32(0), uint32(numGroups)))
+	for i := 0; i < numGroups; i++ {
+		require.NoError(t, w.write(uint32(0), uint32(0xFFFFFFFF), uint32(1)))
+	}
+	require.NoError(t, w.flush())
+	_, err = fnt.parseCmapSubtableFormat13(newByteReader(bytes.NewReader(buf.Bytes())), 0, 6)
+	assert.Equal(t, errRangeCheck, err)
+
+	// Format 12 group count beyond the limit.
+	buf.Reset()
+	require.NoError(t, w.write(uint16(0), uint32(0xFFFFFFFF), uint32(0), uint32(0xFFFFFFF0)))
+	require.NoError(t, w.flush())
+	_, err = fnt.parseCmapSubtableFormat12(newByteReader(bytes.NewReader(buf.Bytes())), 3, 10)
+	assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+}
+
+func TestSetCmapFromMap(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	var indices []GlyphIndex
+	for _, r := range "Hello wörld" {
+		gid, has := fnt.LookupRune(r)
+		require.True(t, has)
+		indices = append(indices, gid)
+	}
+	subfnt, oldnew, err := fnt.Subset(indices)
+	require.NoError(t, err)
+
+	runeToGID := map[rune]GlyphIndex{}
+	for _, r := range "Hello wörld" {
+		gid, _ := fnt.LookupRune(r)
+		runeToGID[r] = oldnew[gid]
+	}
+	runeToGID[0x1F600] = oldnew[indices[0]]
+	require.NoError(t, subfnt.SetCmapFromMap(runeToGID))
+	assert.Equal(t, oldnew[indices[1]], subfnt.runeLookupMap()['e'])
+
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	parsed, err := ParseBytes(data)
+	require.NoError(t, err)
+	require.Len(t, parsed.cmap.encodingRecords, 2)
+	assert.Equal(t, encodingRecord{platformID: 3, encodingID: 1, offset: 20}, parsed.cmap.encodingRecords[0])
+	assert.EqualValues(t, 3, parsed.cmap.encodingRecords[1].platformID)
+	assert.EqualValues(t, 10, parsed.cmap.encodingRecords[1].encodingID)
+
+	bmp := parsed.GetCmap(3, 1)
+	delete(runeToGID, 0x1F600)
+	assert.Equal(t, runeToGID, bmp)
+	full := parsed.GetCmap(3, 10)
+	assert.Len(t, full, len(runeToGID)+1)
+	assert.Equal(t, oldnew[indices[0]], full[0x1F600])
+
+	// The binary search fields of the format 4 subtable.
+	format4 := parsed.cmap.subtables["4,3,1"].ctx.(cmapSubtableFormat4)
+	segments := int(format4.segCountX2) / 2
+	assert.Equal(t, len(format4.endCode), segments)
+	assert.EqualValues(t, 0xFFFF, format4.endCode[segments-1])
+	for i := 1; i < segments; i++ {
+		assert.True(t, format4.endCode[i-1] < format4.startCode[i])
+	}
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= segments {
+		entrySelector++
+	}
+	assert.EqualValues(t, entrySelector, format4.entrySelector)
+	assert.EqualValues(t, 2<<uint(entrySelector), format4.searchRange)
+	assert.EqualValues(t, 2*segments-2<<uint(entrySelector), format4.rangeShift)
+
+	// BMP only.
+	require.NoError(t, subfnt.SetCmapFromMap(runeToGID))
+	assert.Equal(t, []string{"4,3,1"}, subfnt.cmap.subtableKeys)
+
+	err = subfnt.SetCmapFromMap(map[rune]GlyphIndex{0xD800: 1})
+	assert.EqualError(t, err, "invalid rune U+D800")
+	err = subfnt.SetCmapFromMap(map[rune]GlyphIndex{'a': 100})
+	assert.Error(t, err)
+}
+
+func TestCmapSymbol(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	assert.False(t, fnt.IsSymbolic())
+
+	// A symbol font mapping the codes 0x20-0x7E at 0xF020-0xF07E.
+	charcodeToGID := map[CharCode]GlyphIndex{}
+	for code := rune(0x20); code < 0x7F; code++ {
+		gid, has := fnt.LookupRune(code)
+		require.True(t, has)
+		charcodeToGID[CharCode(0xF000+code)] = gid
+	}
+	symfnt := &Font{font: fnt.font.clone()}
+	symfnt.cmap = &cmapTable{
+		numTables:    1,
+		subtables:    map[string]*cmapSubtable{},
+		subtableKeys: []string{"4,3,0"},
+	}
+	symfnt.cmap.subtables["4,3,0"] = newCmapSubtable(4, 3, 0, makeCmapFormat4(charcodeToGID, 0), charcodeToGID,
+		getCharcodeDecoder(3, 0))
+	data, err := symfnt.Bytes()
+	require.NoError(t, err)
+	symfnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	assert.True(t, symfnt.IsSymbolic())
+
+	gidA, _ := fnt.LookupRune('A')
+	gid, has := symfnt.LookupRune(0x41)
+	assert.True(t, has)
+	assert.Equal(t, gidA, gid)
+	gid, has = symfnt.LookupRune(0xF041)
+	assert.True(t, has)
+	assert.Equal(t, gidA, gid)
+	_, has = symfnt.LookupRune(0x90)
+	assert.False(t, has)
+
+	var codes []rune
+	for code := rune(0x20); code < 0x7F; code++ {
+		codes = append(codes, code)
+	}
+	subfnt, err := symfnt.SubsetKeepRunesStrict(codes)
+	require.NoError(t, err)
+	for _, code := range codes {
+		gid, has := subfnt.LookupRune(code)
+		require.True(t, has)
+		assert.Equal(t, charcodeToGID[CharCode(0xF000+code)], gid)
+	}
+	assert.True(t, subfnt.IsSymbolic())
+}
+
+func TestEnsureCmap(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	subfnt, err := fnt.SubsetFirst(50)
+	require.NoError(t, err)
+
+	synthesized, err := subfnt.EnsureCmap(true)
+	require.NoError(t, err)
+	assert.False(t, synthesized)
+
+	written := func(f *Font) *Font {
+		data, err := f.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		parsed, err := ParseBytes(data)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	// Empty symbol subtable.
+	subfnt.cmap = nil
+	synthesized, err = subfnt.EnsureCmap(false)
+	require.NoError(t, err)
+	require.True(t, synthesized)
+	assert.Equal(t, []string{"4,3,0"}, subfnt.cmap.subtableKeys)
+	parsed := written(subfnt)
+	require.Len(t, parsed.cmap.encodingRecords, 1)
+	assert.EqualValues(t, 3, parsed.cmap.encodingRecords[0].platformID)
+	assert.EqualValues(t, 0, parsed.cmap.encodingRecords[0].encodingID)
+	assert.Empty(t, parsed.GetCmap(3, 0))
+	_, has := parsed.LookupRune('A')
+	assert.False(t, has)
+
+	// Identity mapping of the glyph indices.
+	subfnt.cmap = nil
+	synthesized, err = subfnt.EnsureCmap(true)
+	require.NoError(t, err)
+	require.True(t, synthesized)
+	parsed = written(subfnt)
+	cmap := parsed.GetCmap(3, 1)
+	assert.Len(t, cmap, 49)
+	for gid := 1; gid < 50; gid++ {
+		assert.Equal(t, GlyphIndex(gid), cmap[rune(gid)])
+	}
+	_, has = cmap[0]
+	assert.False(t, has)
+}
@@ -0,0 +1,187 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"sort"
+)
+
+// colrTable represents the color (COLR) table version 0, defining color glyphs as a stack of layer glyphs,
+// each drawn with a color of the CPAL palette. The table itself is preserved as a raw table and written out
+// verbatim, unless the glyphs are subsetted in which case it is re-encoded from the model.
+// COLR version 1 tables are not modelled and carried along as other raw tables.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/colr
+type colrTable struct {
+	baseGlyphs []colrBaseGlyph // sorted by glyphID.
+	layers     []colrLayer
+}
+
+type colrBaseGlyph struct {
+	glyphID         GlyphIndex
+	firstLayerIndex uint16
+	numLayers       uint16
+}
+
+type colrLayer struct {
+	glyphID      GlyphIndex
+	paletteIndex uint16 // 0xFFFF for the text foreground color.
+}
+
+// parseColr parses the COLR table from the data of the raw COLR table, if present.
+// Malformed or unsupported COLR tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseColr() *colrTable {
+	data := f.rawTableData("COLR")
+	if data == nil {
+		logger.Debugf("COLR table absent")
+		return nil
+	}
+
+	t, err := parseColrData(data)
+	if err != nil {
+		logger.Debugf("Error parsing COLR table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseColrData parses COLR table `data`.
+func parseColrData(data []byte) (*colrTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var version, numBaseGlyphRecords, numLayerRecords uint16
+	var baseGlyphRecordsOffset, layerRecordsOffset offset32
+	err := r.read(&version, &numBaseGlyphRecords, &baseGlyphRecordsOffset, &layerRecordsOffset, &numLayerRecords)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 {
+		logger.Debugf("Unsupported COLR version %d", version)
+		return nil, errRangeCheck
+	}
+	if int64(baseGlyphRecordsOffset)+6*int64(numBaseGlyphRecords) > int64(len(data)) ||
+		int64(layerRecordsOffset)+4*int64(numLayerRecords) > int64(len(data)) {
+		logger.Debugf("COLR records out of range")
+		return nil, errRangeCheck
+	}
+
+	t := &colrTable{}
+	err = r.SeekTo(int64(baseGlyphRecordsOffset))
+	if err != nil {
+		return nil, err
+	}
+	t.baseGlyphs = make([]colrBaseGlyph, numBaseGlyphRecords)
+	for i := range t.baseGlyphs {
+		bg := &t.baseGlyphs[i]
+		var glyphID uint16
+		err = r.read(&glyphID, &bg.firstLayerIndex, &bg.numLayers)
+		if err != nil {
+			return nil, err
+		}
+		bg.glyphID = GlyphIndex(glyphID)
+		if int(bg.firstLayerIndex)+int(bg.numLayers) > int(numLayerRecords) {
+			logger.Debugf("COLR layers of glyph %d out of range", bg.glyphID)
+			return nil, errRangeCheck
+		}
+	}
+
+	err = r.SeekTo(int64(layerRecordsOffset))
+	if err != nil {
+		return nil, err
+	}
+	t.layers = make([]colrLayer, numLayerRecords)
+	for i := range t.layers {
+		var glyphID uint16
+		err = r.read(&glyphID, &t.layers[i].paletteIndex)
+		if err != nil {
+			return nil, err
+		}
+		t.layers[i].glyphID = GlyphIndex(glyphID)
+	}
+	return t, nil
+}
+
+// encode returns the data of `t` as a COLR version 0 table.
+func (t *colrTable) encode() []byte {
+	const headerSize = 14
+	layerRecordsOffset := headerSize + 6*len(t.baseGlyphs)
+	b := make([]byte, 0, layerRecordsOffset+4*len(t.layers))
+	b = appendUint16(b, 0, uint16(len(t.baseGlyphs)))
+	b = appendUint32(b, headerSize, uint32(layerRecordsOffset))
+	b = appendUint16(b, uint16(len(t.layers)))
+	for _, bg := range t.baseGlyphs {
+		b = appendUint16(b, uint16(bg.glyphID), bg.firstLayerIndex, bg.numLayers)
+	}
+	for _, l := range t.layers {
+		b = appendUint16(b, uint16(l.glyphID), l.paletteIndex)
+	}
+	return b
+}
+
+// glyphLayers returns the layers of the color glyph `gid`, or nil if `gid` is not a color glyph.
+func (t *colrTable) glyphLayers(gid GlyphIndex) []colrLayer {
+	i := sort.Search(len(t.baseGlyphs), func(i int) bool {
+		return t.baseGlyphs[i].glyphID >= gid
+	})
+	if i == len(t.baseGlyphs) || t.baseGlyphs[i].glyphID != gid {
+		return nil
+	}
+	bg := t.baseGlyphs[i]
+	return t.layers[bg.firstLayerIndex : int(bg.firstLayerIndex)+int(bg.numLayers)]
+}
+
+// closure returns `indices` with the layer glyphs of the color glyphs among `indices` appended.
+func (t *colrTable) closure(indices []GlyphIndex) []GlyphIndex {
+	n := len(indices)
+	for _, gid := range indices[:n] {
+		for _, l := range t.glyphLayers(gid) {
+			indices = append(indices, l.glyphID)
+		}
+	}
+	return indices
+}
+
+// selectGlyphs returns a copy of `t` with only the color glyphs in `oldnew`, renumbered as per `oldnew`.
+// Color glyphs with layer glyphs missing from `oldnew` are dropped, so that they are rendered without color
+// rather than incompletely.
+func (t *colrTable) selectGlyphs(oldnew map[GlyphIndex]GlyphIndex) *colrTable {
+	newt := &colrTable{}
+	for _, bg := range t.baseGlyphs {
+		newgid, has := oldnew[bg.glyphID]
+		if !has {
+			continue
+		}
+		layers := t.glyphLayers(bg.glyphID)
+		newLayers := make([]colrLayer, len(layers))
+		for i, l := range layers {
+			newLayers[i].glyphID, has = oldnew[l.glyphID]
+			if !has {
+				logger.Debugf("Dropping color glyph %d as layer glyph %d is not kept", bg.glyphID, l.glyphID)
+				break
+			}
+			newLayers[i].paletteIndex = l.paletteIndex
+		}
+		if !has {
+			continue
+		}
+		newt.baseGlyphs = append(newt.baseGlyphs, colrBaseGlyph{
+			glyphID:         newgid,
+			firstLayerIndex: uint16(len(newt.layers)),
+			numLayers:       uint16(len(newLayers)),
+		})
+		newt.layers = append(newt.layers, newLayers...)
+	}
+	sort.Slice(newt.baseGlyphs, func(i, j int) bool {
+		return newt.baseGlyphs[i].glyphID < newt.baseGlyphs[j].glyphID
+	})
+	return newt
+}
+
+// setColr sets the COLR table of `f` to `t` and replaces the raw COLR table by the encoding of `t`.
+func (f *font) setColr(t *colrTable) {
+	f.setRawTableData("COLR", t.encode())
+	f.colr = t
+}
@@ -0,0 +1,171 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestColrFont returns FreeSans with the color glyphs exclamdown (101), a composite glyph, with the layers
+// 50 and 60, and 30 with the layer 31 drawn in the foreground color, and two palettes of two colors.
+func buildTestColrFont(t *testing.T) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	colr := &colrTable{
+		baseGlyphs: []colrBaseGlyph{
+			{glyphID: 30, firstLayerIndex: 2, numLayers: 1},
+			{glyphID: 101, firstLayerIndex: 0, numLayers: 2},
+		},
+		layers: []colrLayer{
+			{glyphID: 50, paletteIndex: 0},
+			{glyphID: 60, paletteIndex: 1},
+			{glyphID: 31, paletteIndex: ForegroundPaletteIndex},
+		},
+	}
+	cpal := &cpalTable{
+		numPaletteEntries: 2,
+		palettes: [][]cpalColor{
+			{{blue: 0, green: 0, red: 255, alpha: 255}, {blue: 255, green: 0, red: 0, alpha: 128}},
+			{{blue: 0, green: 255, red: 0, alpha: 255}, {blue: 10, green: 20, red: 30, alpha: 40}},
+		},
+	}
+	fnt.rawTables = append(fnt.rawTables,
+		&rawTable{tableTag: makeTag("COLR"), data: colr.encode()},
+		&rawTable{tableTag: makeTag("CPAL"), data: cpal.encode()},
+	)
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, fnt.colr)
+	require.NotNil(t, fnt.cpal)
+	return fnt
+}
+
+func TestColorLayers(t *testing.T) {
+	fnt := buildTestColrFont(t)
+
+	assert.Equal(t, []ColorLayer{{50, 0}, {60, 1}}, fnt.ColorLayers(101))
+	assert.Equal(t, []ColorLayer{{31, ForegroundPaletteIndex}}, fnt.ColorLayers(30))
+	assert.Nil(t, fnt.ColorLayers(50))
+	assert.Nil(t, fnt.ColorLayers(1000))
+
+	assert.Equal(t, [][]color.NRGBA{
+		{{R: 255, G: 0, B: 0, A: 255}, {R: 0, G: 0, B: 255, A: 128}},
+		{{R: 0, G: 255, B: 0, A: 255}, {R: 30, G: 20, B: 10, A: 40}},
+	}, fnt.ColorPalettes())
+
+	static, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	assert.Nil(t, static.ColorLayers(101))
+	assert.Nil(t, static.ColorPalettes())
+}
+
+func TestColrSubset(t *testing.T) {
+	fnt := buildTestColrFont(t)
+
+	t.Run("Subset", func(t *testing.T) {
+		subfnt, oldnew, err := fnt.Subset([]GlyphIndex{101})
+		require.NoError(t, err)
+		// notdef, the component exclam and the layer glyphs are kept.
+		assert.Len(t, oldnew, 5)
+		for _, gid := range []GlyphIndex{0, 6, 50, 60, 101} {
+			assert.Contains(t, oldnew, gid)
+		}
+
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+		assert.Equal(t, []ColorLayer{{oldnew[50], 0}, {oldnew[60], 1}}, subfnt.ColorLayers(oldnew[101]))
+		assert.Nil(t, subfnt.ColorLayers(oldnew[50]))
+		assert.Equal(t, fnt.ColorPalettes(), subfnt.ColorPalettes())
+	})
+
+	t.Run("SubsetKeepIndices", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{101})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		assert.Equal(t, []ColorLayer{{50, 0}, {60, 1}}, subfnt.ColorLayers(101))
+		assert.Nil(t, subfnt.ColorLayers(30))
+		for _, gid := range []GlyphIndex{50, 60} {
+			assert.NotEmpty(t, subfnt.glyf.descs[gid].raw, "%d", gid)
+		}
+		assert.Empty(t, subfnt.glyf.descs[31].raw)
+	})
+
+	t.Run("SubsetFirst", func(t *testing.T) {
+		// The layers of exclamdown are within the first glyphs but the base glyph is not.
+		subfnt, err := fnt.SubsetFirst(70)
+		require.NoError(t, err)
+		assert.Equal(t, []ColorLayer{{31, ForegroundPaletteIndex}}, subfnt.ColorLayers(30))
+		assert.Nil(t, subfnt.ColorLayers(101))
+		assert.Len(t, subfnt.colr.baseGlyphs, 1)
+
+		// Color glyphs with layers beyond the first glyphs are dropped.
+		subfnt, err = fnt.SubsetFirst(55)
+		require.NoError(t, err)
+		assert.Len(t, subfnt.colr.baseGlyphs, 1)
+		assert.Len(t, subfnt.colr.layers, 1)
+	})
+}
+
+func TestColrParseErrors(t *testing.T) {
+	colr := &colrTable{
+		baseGlyphs: []colrBaseGlyph{{glyphID: 3, firstLayerIndex: 0, numLayers: 2}},
+		layers:     []colrLayer{{glyphID: 4, paletteIndex: 0}, {glyphID: 5, paletteIndex: 1}},
+	}
+	data := colr.encode()
+	parsed, err := parseColrData(data)
+	require.NoError(t, err)
+	assert.Equal(t, colr, parsed)
+
+	_, err = parseColrData(data[:len(data)-1])
+	assert.Error(t, err)
+
+	// Layers out of range.
+	bad := append([]byte(nil), data...)
+	bad[19] = 3
+	_, err = parseColrData(bad)
+	assert.Error(t, err)
+
+	// COLR version 1 is not modelled.
+	bad = append([]byte(nil), data...)
+	bad[1] = 1
+	_, err = parseColrData(bad)
+	assert.Error(t, err)
+}
+
+func TestCpalVersion1(t *testing.T) {
+	cpal := &cpalTable{
+		version:           1,
+		numPaletteEntries: 1,
+		palettes: [][]cpalColor{
+			{{blue: 1, green: 2, red: 3, alpha: 4}},
+			{{blue: 5, green: 6, red: 7, alpha: 8}},
+		},
+		paletteTypes:       []uint32{1, 2},
+		paletteEntryLabels: []uint16{300},
+	}
+	data := cpal.encode()
+	parsed, err := parseCpalData(data)
+	require.NoError(t, err)
+	assert.Equal(t, cpal, parsed)
+
+	_, err = parseCpalData(data[:len(data)-2])
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// cpalTable represents the color palette (CPAL) table, defining the palettes of colors referenced by
+// the layers of the COLR table. The table does not reference glyphs and is preserved as a raw table and
+// written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/cpal
+type cpalTable struct {
+	version           uint16
+	numPaletteEntries uint16
+	palettes          [][]cpalColor // numPaletteEntries colors per palette.
+
+	// Version 1 only, nil if not present.
+	paletteTypes       []uint32
+	paletteLabels      []uint16 // name table IDs, 0xFFFF if none.
+	paletteEntryLabels []uint16 // name table IDs, 0xFFFF if none.
+}
+
+// cpalColor represents a color record in sRGB with straight (not premultiplied) alpha.
+type cpalColor struct {
+	blue, green, red, alpha uint8
+}
+
+// parseCpal parses the CPAL table from the data of the raw CPAL table, if present.
+// Malformed CPAL tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseCpal() *cpalTable {
+	data := f.rawTableData("CPAL")
+	if data == nil {
+		logger.Debugf("CPAL table absent")
+		return nil
+	}
+
+	t, err := parseCpalData(data)
+	if err != nil {
+		logger.Debugf("Error parsing CPAL table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseCpalData parses CPAL table `data`.
+func parseCpalData(data []byte) (*cpalTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	t := &cpalTable{}
+	var numPalettes, numColorRecords uint16
+	var colorRecordsArrayOffset offset32
+	err := r.read(&t.version, &t.numPaletteEntries, &numPalettes, &numColorRecords, &colorRecordsArrayOffset)
+	if err != nil {
+		return nil, err
+	}
+	if t.version > 1 {
+		logger.Debugf("Unsupported CPAL version %d", t.version)
+		return nil, errRangeCheck
+	}
+	var colorRecordIndices []uint16
+	err = r.readSlice(&colorRecordIndices, int(numPalettes))
+	if err != nil {
+		return nil, err
+	}
+	var paletteTypesArrayOffset, paletteLabelsArrayOffset, paletteEntryLabelsArrayOffset offset32
+	if t.version == 1 {
+		err = r.read(&paletteTypesArrayOffset, &paletteLabelsArrayOffset, &paletteEntryLabelsArrayOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if int64(colorRecordsArrayOffset)+4*int64(numColorRecords) > int64(len(data)) {
+		logger.Debugf("CPAL color records out of range")
+		return nil, errRangeCheck
+	}
+	err = r.SeekTo(int64(colorRecordsArrayOffset))
+	if err != nil {
+		return nil, err
+	}
+	colors := make([]cpalColor, numColorRecords)
+	for i := range colors {
+		c := &colors[i]
+		err = r.read(&c.blue, &c.green, &c.red, &c.alpha)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.palettes = make([][]cpalColor, numPalettes)
+	for i, index := range colorRecordIndices {
+		if int(index)+int(t.numPaletteEntries) > len(colors) {
+			logger.Debugf("CPAL palette %d out of range", i)
+			return nil, errRangeCheck
+		}
+		t.palettes[i] = colors[index : int(index)+int(t.numPaletteEntries)]
+	}
+
+	if paletteTypesArrayOffset != 0 {
+		err = r.SeekTo(int64(paletteTypesArrayOffset))
+		if err == nil {
+			err = r.readSlice(&t.paletteTypes, int(numPalettes))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if paletteLabelsArrayOffset != 0 {
+		err = r.SeekTo(int64(paletteLabelsArrayOffset))
+		if err == nil {
+			err = r.readSlice(&t.paletteLabels, int(numPalettes))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if paletteEntryLabelsArrayOffset != 0 {
+		err = r.SeekTo(int64(paletteEntryLabelsArrayOffset))
+		if err == nil {
+			err = r.readSlice(&t.paletteEntryLabels, int(t.numPaletteEntries))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// encode returns the data of `t` as a CPAL table. The colors of each palette are stored separately.
+func (t *cpalTable) encode() []byte {
+	headerSize := 12 + 2*len(t.palettes)
+	if t.version == 1 {
+		headerSize += 12
+	}
+	numColorRecords := len(t.palettes) * int(t.numPaletteEntries)
+	offset := headerSize + 4*numColorRecords
+
+	b := make([]byte, 0, offset)
+	b = appendUint16(b, t.version, t.numPaletteEntries, uint16(len(t.palettes)), uint16(numColorRecords))
+	b = appendUint32(b, uint32(headerSize))
+	for i := range t.palettes {
+		b = appendUint16(b, uint16(i*int(t.numPaletteEntries)))
+	}
+	if t.version == 1 {
+		// Offsets of the optional arrays, which follow the color records.
+		for _, size := range []int{4 * len(t.paletteTypes), 2 * len(t.paletteLabels), 2 * len(t.paletteEntryLabels)} {
+			if size == 0 {
+				b = appendUint32(b, 0)
+				continue
+			}
+			b = appendUint32(b, uint32(offset))
+			offset += size
+		}
+	}
+	for _, palette := range t.palettes {
+		for _, c := range palette {
+			b = append(b, c.blue, c.green, c.red, c.alpha)
+		}
+	}
+	if t.version == 1 {
+		b = appendUint32(b, t.paletteTypes...)
+		b = appendUint16(b, t.paletteLabels...)
+		b = appendUint16(b, t.paletteEntryLabels...)
+	}
+	return b
+}
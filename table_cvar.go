@@ -0,0 +1,28 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// parseCvarData parses the tuple variations of the control value (cvt) table from cvar table `data` for a
+// font with `axisCount` axes and `numValues` control values. The cvar table is parsed on demand when
+// instancing variable fonts, otherwise it is preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/cvar
+func parseCvarData(data []byte, axisCount, numValues int) ([]tupleVariation, error) {
+	r := newByteReader(bytes.NewReader(data))
+	var majorVersion, minorVersion uint16
+	err := r.read(&majorVersion, &minorVersion)
+	if err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 {
+		logger.Debugf("Unsupported cvar version %d.%d", majorVersion, minorVersion)
+		return nil, errRangeCheck
+	}
+	return parseTupleVariations(data, 4, axisCount, nil, numValues, false)
+}
@@ -5,10 +5,6 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 // cvtTable represents the Control Value Table (cvt).
 // This table contains a list of values that can be referenced by instructions.
 // TODO: For subsetting/optimization it would be good to know what glyphs need each value, so non-used values can be removed.
@@ -17,13 +13,21 @@ type cvtTable struct {
 	controlValues []int16 //fword
 }
 
+// Clone returns a deep copy of `t`.
+func (t *cvtTable) Clone() *cvtTable {
+	if t == nil {
+		return nil
+	}
+	return &cvtTable{controlValues: append([]int16(nil), t.controlValues...)}
+}
+
 func (f *font) parseCvt(r *byteReader) (*cvtTable, error) {
 	tr, has, err := f.seekToTable(r, "cvt")
 	if err != nil {
 		return nil, err
 	}
 	if !has || tr == nil {
-		logrus.Debug("cvt table absent")
+		logger.Debugf("cvt table absent")
 		return nil, nil
 	}
 
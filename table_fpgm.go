@@ -5,22 +5,26 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 // fpgmTable represents font program instructions and is needed by fonts that are instructed.
 type fpgmTable struct {
 	instructions []uint8
 }
 
+// Clone returns a deep copy of `t`.
+func (t *fpgmTable) Clone() *fpgmTable {
+	if t == nil {
+		return nil
+	}
+	return &fpgmTable{instructions: append([]uint8(nil), t.instructions...)}
+}
+
 func (f *font) parseFpgm(r *byteReader) (*fpgmTable, error) {
 	tr, has, err := f.seekToTable(r, "fpgm")
 	if err != nil {
 		return nil, err
 	}
 	if !has || tr == nil {
-		logrus.Debug("fpgm table absent")
+		logger.Debugf("fpgm table absent")
 		return nil, nil
 	}
 
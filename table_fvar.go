@@ -0,0 +1,130 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// fvarTable represents the font variations (fvar) table, defining the design variation axes and the named
+// instances of variable fonts. The table itself is preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/fvar
+type fvarTable struct {
+	axes      []fvarAxis
+	instances []fvarInstance
+}
+
+type fvarAxis struct {
+	axisTag      tag
+	minValue     float64
+	defaultValue float64
+	maxValue     float64
+	flags        uint16
+	axisNameID   uint16
+}
+
+type fvarInstance struct {
+	subfamilyNameID  uint16
+	flags            uint16
+	coordinates      []float64 // user-space coordinate per axis.
+	postScriptNameID uint16    // 0xFFFF if not specified.
+}
+
+// fvarAxisHidden is the axis flag indicating that the axis should not be exposed in user interfaces.
+const fvarAxisHidden = 0x0001
+
+// parseFvar parses the fvar table from the data of the raw fvar table, if present.
+// Malformed fvar tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseFvar() *fvarTable {
+	data := f.rawTableData("fvar")
+	if data == nil {
+		logger.Debugf("fvar table absent")
+		return nil
+	}
+
+	t, err := parseFvarData(data)
+	if err != nil {
+		logger.Debugf("Error parsing fvar table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseFvarData parses fvar table `data`.
+func parseFvarData(data []byte) (*fvarTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var majorVersion, minorVersion, axesArrayOffset, reserved uint16
+	var axisCount, axisSize, instanceCount, instanceSize uint16
+	err := r.read(&majorVersion, &minorVersion, &axesArrayOffset, &reserved, &axisCount, &axisSize,
+		&instanceCount, &instanceSize)
+	if err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 {
+		logger.Debugf("Unsupported fvar version %d.%d", majorVersion, minorVersion)
+		return nil, errRangeCheck
+	}
+	if axisSize < 20 || instanceSize < 4+4*axisCount {
+		logger.Debugf("Invalid fvar record sizes: %d, %d", axisSize, instanceSize)
+		return nil, errRangeCheck
+	}
+	instancesOffset := int64(axesArrayOffset) + int64(axisCount)*int64(axisSize)
+	if instancesOffset+int64(instanceCount)*int64(instanceSize) > int64(len(data)) {
+		logger.Debugf("fvar records out of range")
+		return nil, errRangeCheck
+	}
+
+	t := &fvarTable{}
+	t.axes = make([]fvarAxis, axisCount)
+	for i := range t.axes {
+		err = r.SeekTo(int64(axesArrayOffset) + int64(i)*int64(axisSize))
+		if err != nil {
+			return nil, err
+		}
+		axis := &t.axes[i]
+		var minValue, defaultValue, maxValue fixed
+		err = r.read(&axis.axisTag, &minValue, &defaultValue, &maxValue, &axis.flags, &axis.axisNameID)
+		if err != nil {
+			return nil, err
+		}
+		axis.minValue = minValue.Float64()
+		axis.defaultValue = defaultValue.Float64()
+		axis.maxValue = maxValue.Float64()
+	}
+
+	// The PostScript name ID is present if the instance records are large enough.
+	hasPostScriptNameID := instanceSize >= 6+4*axisCount
+	t.instances = make([]fvarInstance, instanceCount)
+	for i := range t.instances {
+		err = r.SeekTo(instancesOffset + int64(i)*int64(instanceSize))
+		if err != nil {
+			return nil, err
+		}
+		inst := &t.instances[i]
+		err = r.read(&inst.subfamilyNameID, &inst.flags)
+		if err != nil {
+			return nil, err
+		}
+		inst.coordinates = make([]float64, axisCount)
+		for j := range inst.coordinates {
+			var v fixed
+			err = r.read(&v)
+			if err != nil {
+				return nil, err
+			}
+			inst.coordinates[j] = v.Float64()
+		}
+		inst.postScriptNameID = 0xFFFF
+		if hasPostScriptNameID {
+			err = r.read(&inst.postScriptNameID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
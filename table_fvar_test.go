@@ -0,0 +1,143 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWriter returns a buffer and a function writing `vals` to it in big endian.
+func testWriter() (*bytes.Buffer, func(vals ...interface{})) {
+	var buf bytes.Buffer
+	return &buf, func(vals ...interface{}) {
+		for _, v := range vals {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+	}
+}
+
+// buildTestFvar returns an fvar table with a weight axis (100-400-900) and a hidden width axis (75-100-100),
+// and the named instances Regular and Bold. The instance records include the PostScript name ID if
+// `withPostScriptNameID` is set.
+func buildTestFvar(withPostScriptNameID bool) []byte {
+	instanceSize := 12
+	if withPostScriptNameID {
+		instanceSize = 14
+	}
+	buf, write := testWriter()
+	write(uint16(1), uint16(0), uint16(16), uint16(2), uint16(2), uint16(20), uint16(2), uint16(instanceSize))
+	write(makeTag("wght"), int32(100<<16), int32(400<<16), int32(900<<16), uint16(0), uint16(256))
+	write(makeTag("wdth"), int32(75<<16), int32(100<<16), int32(100<<16), uint16(fvarAxisHidden), uint16(257))
+	for _, inst := range []struct {
+		subfamilyNameID, postScriptNameID uint16
+		wght, wdth                        int32 // 16.16 fixed.
+	}{
+		{258, 259, 400 << 16, 100 << 16},
+		{260, 261, 700 << 16, 87<<16 | 0x8000},
+	} {
+		write(inst.subfamilyNameID, uint16(0), inst.wght, inst.wdth)
+		if withPostScriptNameID {
+			write(inst.postScriptNameID)
+		}
+	}
+	return buf.Bytes()
+}
+
+// buildTestVariableFont builds a variable font from the first `numGlyphs` glyphs of FreeSans with fvar,
+// avar and gvar tables. Glyphs 1 and 3 have variations (see buildTestGlyphVariationData).
+func buildTestVariableFont(t *testing.T, numGlyphs int) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err = fnt.SubsetFirst(numGlyphs)
+	require.NoError(t, err)
+
+	glyphData := make([][]byte, numGlyphs)
+	glyphData[1] = buildTestGlyphVariationData()
+	glyphData[3] = buildTestGlyphVariationData()
+	gvar := &gvarTable{
+		axisCount:    2,
+		sharedTuples: [][]f2dot14{{0x4000, 0}, {0, -0x4000}},
+		glyphData:    glyphData,
+	}
+
+	fnt.rawTables = append(fnt.rawTables,
+		&rawTable{tableTag: makeTag("fvar"), data: buildTestFvar(true)},
+		&rawTable{tableTag: makeTag("avar"), data: buildTestAvar()},
+		&rawTable{tableTag: makeTag("gvar"), data: gvar.encode()},
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	fnt, err = Parse(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.NotNil(t, fnt.fvar)
+	require.NotNil(t, fnt.avar)
+	require.NotNil(t, fnt.gvar)
+	return fnt
+}
+
+func TestFvarTable(t *testing.T) {
+	for _, withPostScriptNameID := range []bool{false, true} {
+		fvar, err := parseFvarData(buildTestFvar(withPostScriptNameID))
+		require.NoError(t, err)
+		require.Len(t, fvar.axes, 2)
+		assert.Equal(t, fvarAxis{makeTag("wght"), 100, 400, 900, 0, 256}, fvar.axes[0])
+		assert.Equal(t, fvarAxis{makeTag("wdth"), 75, 100, 100, 1, 257}, fvar.axes[1])
+		require.Len(t, fvar.instances, 2)
+		assert.Equal(t, []float64{700, 87.5}, fvar.instances[1].coordinates)
+		if withPostScriptNameID {
+			assert.Equal(t, uint16(261), fvar.instances[1].postScriptNameID)
+		} else {
+			assert.Equal(t, uint16(0xFFFF), fvar.instances[1].postScriptNameID)
+		}
+	}
+
+	data := buildTestFvar(true)
+	_, err := parseFvarData(data[:len(data)-1])
+	assert.Error(t, err)
+	data[0] = 2
+	_, err = parseFvarData(data)
+	assert.Error(t, err)
+}
+
+func TestVariableFont(t *testing.T) {
+	fnt := buildTestVariableFont(t, 10)
+
+	assert.Equal(t, []VariationAxis{
+		{Tag: "wght", Min: 100, Default: 400, Max: 900, NameID: 256},
+		{Tag: "wdth", Min: 75, Default: 100, Max: 100, NameID: 257, Hidden: true},
+	}, fnt.Axes())
+	assert.Equal(t, []NamedInstance{
+		{SubfamilyNameID: 258, PostScriptNameID: 259, Coords: map[string]float64{"wght": 400, "wdth": 100}},
+		{SubfamilyNameID: 260, PostScriptNameID: 261, Coords: map[string]float64{"wght": 700, "wdth": 87.5}},
+	}, fnt.NamedInstances())
+
+	// The variation tables are preserved exactly.
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt2, err := ParseBytes(data)
+	require.NoError(t, err)
+	for _, name := range []string{"fvar", "avar", "gvar"} {
+		assert.Equal(t, fnt.rawTableData(name), fnt2.rawTableData(name), name)
+	}
+
+	require.NoError(t, fnt2.PruneTables("fvar", "avar", "gvar"))
+	assert.Nil(t, fnt2.Axes())
+	assert.Nil(t, fnt2.NamedInstances())
+	assert.Nil(t, fnt2.avar)
+	assert.Nil(t, fnt2.gvar)
+
+	// Static fonts.
+	fnt, err = ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	assert.Nil(t, fnt.Axes())
+	assert.Nil(t, fnt.NamedInstances())
+}
@@ -7,9 +7,11 @@ package unitype
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
-
-	"github.com/sirupsen/logrus"
+	"fmt"
+	"math"
+	"sync"
 )
 
 // glyfTable represents the Glyph Data table (glyf).
@@ -30,67 +32,239 @@ type glyfTable struct {
 	descs []*glyphDescription
 }
 
+// Clone returns a deep copy of `t`.
+func (t *glyfTable) Clone() *glyfTable {
+	if t == nil {
+		return nil
+	}
+	dup := &glyfTable{descs: make([]*glyphDescription, len(t.descs))}
+	for i, desc := range t.descs {
+		dup.descs[i] = desc.Clone()
+	}
+	return dup
+}
+
+// loadAll reads the glyph data of the descriptions of `t` loaded lazily, see ParseOptions.LazyGlyphs.
+func (t *glyfTable) loadAll() error {
+	if t == nil {
+		return nil
+	}
+	for gid, desc := range t.descs {
+		err := desc.load()
+		if err != nil {
+			logger.Debugf("Error loading glyph %d: %v", gid, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// glyfSource is the font data the glyph descriptions of a glyf table parsed with ParseOptions.LazyGlyphs are
+// read from on first access.
+type glyfSource struct {
+	mu     *sync.Mutex // guards br, see byteReader.readAt.
+	br     *byteReader
+	offset int64 // offset of the glyf table.
+}
+
+// lazyGlyph is the location of the data of a glyph description in the glyf table of a glyfSource.
+type lazyGlyph struct {
+	src    *glyfSource
+	offset int64
+	length int64
+
+	mu     sync.Mutex
+	loaded bool // guarded by mu.
+}
+
+// load reads the glyph data of `gd` from its source if loaded lazily and not read yet. Safe for concurrent use.
+func (gd *glyphDescription) load() error {
+	if gd == nil || gd.lazy == nil {
+		return nil
+	}
+	l := gd.lazy
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.loaded {
+		return nil
+	}
+	raw, err := l.src.br.readAt(l.src.mu, l.src.offset+l.offset, int(l.length))
+	if err != nil {
+		return err
+	}
+	gd.raw = raw
+	l.loaded = true
+	return nil
+}
+
+// size returns the length of the glyph data of `gd` in bytes, without reading the data if loaded lazily.
+func (gd *glyphDescription) size() int {
+	if gd == nil {
+		return 0
+	}
+	if gd.lazy != nil {
+		return int(gd.lazy.length)
+	}
+	return len(gd.raw)
+}
+
 func (f *font) parseGlyf(r *byteReader) (*glyfTable, error) {
-	if f.maxp == nil || f.loca == nil {
-		logrus.Debug("required field missing (glyf)")
-		return nil, errRequiredField
+	if _, has := f.trec.trMap["glyf"]; !has {
+		// Not present in fonts with CFF outlines.
+		logger.Debugf("glyf table absent")
+		return nil, nil
+	}
+	if f.maxp == nil {
+		logger.Debugf("maxp table missing (glyf)")
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
+	}
+	if f.loca == nil {
+		logger.Debugf("loca table missing (glyf)")
+		return nil, ErrRequiredTableMissing{Tag: "loca"}
 	}
 
 	tr, has, err := f.seekToTable(r, "glyf")
 	if err != nil {
-		logrus.Debugf("ERROR: %v", err)
+		logger.Debugf("ERROR: %v", err)
 		return nil, err
 	}
 	if !has {
 		return nil, nil // table not found.
 	}
 
-	glyf := &glyfTable{}
+	glyfLen := int64(tr.length)
+	if !f.opts.RepairLoca {
+		err = f.validateLoca(glyfLen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	glyf := &glyfTable{descs: make([]*glyphDescription, 0, f.maxp.numGlyphs)}
+	var src *glyfSource
+	if f.opts.LazyGlyphs {
+		src = &glyfSource{mu: &sync.Mutex{}, br: r, offset: int64(tr.offset)}
+	}
+	// The locations of the glyph data, read at once unless loaded lazily.
+	locs := make([][2]int64, 0, f.maxp.numGlyphs)
+	var dataLen int64
 
-	logrus.Debug("parsing glyfs")
-	logrus.Debugf("Number of glyphs: %d", f.maxp.numGlyphs)
-	logrus.Debugf("Loca offset format: %d", f.head.indexToLocFormat)
+	logger.Debugf("parsing glyfs")
+	logger.Debugf("Number of glyphs: %d", f.maxp.numGlyphs)
+	logger.Debugf("Loca offset format: %d", f.head.indexToLocFormat)
 
+	repaired := false
 	for i := 0; i < int(f.maxp.numGlyphs); i++ {
 		gid := GlyphIndex(i)
 		gdOffset, gdLen, err := f.GetGlyphDataOffset(gid)
 		if err != nil {
-			logrus.Debugf("ERROR: %v", err)
+			logger.Debugf("ERROR: %v", err)
 			return nil, err
 		}
 
-		if gdOffset > int64(tr.length) {
-			logrus.Debugf("gid: %d, gdOffset: %d, tr len: %d, gd len: %d", gid, gdOffset, tr.length, gdLen)
-			logrus.Debugf("Range check error (glyf): %d > %d", gdOffset, tr.length)
-			return nil, errRangeCheck
+		if gdLen < 0 || gdOffset+gdLen > glyfLen {
+			// Offsets beyond the glyf table are clamped and glyphs with decreasing offsets are empty.
+			logger.Debugf("Repairing loca offsets of glyph %d: %d (%d) in %d", gid, gdOffset, gdLen, glyfLen)
+			repaired = true
+			end := gdOffset + gdLen
+			if end > glyfLen {
+				end = glyfLen
+			}
+			if gdOffset > glyfLen {
+				gdOffset = glyfLen
+			}
+			gdLen = end - gdOffset
+			if gdLen < 0 {
+				gdLen = 0
+			}
+		}
+
+		if src != nil {
+			lazy := &lazyGlyph{src: src, offset: gdOffset, length: gdLen}
+			glyf.descs = append(glyf.descs, &glyphDescription{lazy: lazy})
+			continue
+		}
+
+		locs = append(locs, [2]int64{gdOffset, gdLen})
+		if gdOffset+gdLen > dataLen {
+			dataLen = gdOffset + gdLen
 		}
+	}
 
-		err = r.SeekTo(int64(tr.offset) + gdOffset)
+	if src == nil {
+		err = r.SeekTo(int64(tr.offset))
+		if err != nil {
+			logger.Debugf("ERROR: %v", err)
+			return nil, err
+		}
+		var data []byte
+		err = r.readBytes(&data, int(dataLen))
 		if err != nil {
-			logrus.Debugf("ERROR: %v", err)
+			logger.Debugf("ERROR: %v", err)
 			return nil, err
 		}
+		descs := make([]glyphDescription, len(locs))
+		for i, loc := range locs {
+			start, end := loc[0], loc[0]+loc[1]
+			descs[i].raw = data[start:end:end]
+			glyf.descs = append(glyf.descs, &descs[i])
+		}
+	}
 
-		var desc glyphDescription
-		desc.raw = make([]byte, gdLen)
-		err = r.readBytes(&desc.raw, int(gdLen))
+	if repaired {
+		f.locaRepaired = true
+		// Regenerate the loca table from the glyph data, in the long format if the short format cannot
+		// represent the offsets of the repaired glyphs.
+		err = glyf.loadAll()
 		if err != nil {
-			logrus.Debugf("ERROR: %v", err)
 			return nil, err
 		}
-		glyf.descs = append(glyf.descs, &desc)
+		f.glyf = glyf
+		err = f.updateLoca()
+		if err != nil {
+			f.head.indexToLocFormat = 1
+			err = f.updateLoca()
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return glyf, nil
 }
 
 type glyphDescription struct {
-	raw []byte
+	raw  []byte
+	lazy *lazyGlyph // location of the data not read yet, see ParseOptions.LazyGlyphs.
 
+	mu        sync.Mutex // guards the parsing of header and composite.
 	header    *glyphHeader
 	composite *compositeGlyph
 }
 
+// Clone returns a copy of `gd` with its own glyph data. The parsed header and components are not copied as
+// they are parsed from the data on demand.
+func (gd *glyphDescription) Clone() *glyphDescription {
+	if gd == nil {
+		return nil
+	}
+	if gd.lazy != nil {
+		gd.lazy.mu.Lock()
+		defer gd.lazy.mu.Unlock()
+		if !gd.lazy.loaded {
+			// The copy reads the data from the same source on first access.
+			lazy := &lazyGlyph{src: gd.lazy.src, offset: gd.lazy.offset, length: gd.lazy.length}
+			return &glyphDescription{lazy: lazy}
+		}
+	}
+	dup := &glyphDescription{}
+	if gd.raw != nil {
+		dup.raw = make([]byte, len(gd.raw))
+		copy(dup.raw, gd.raw)
+	}
+	return dup
+}
+
 type glyphHeader struct {
 	numberOfContours int16
 	xMin             int16
@@ -99,22 +273,28 @@ type glyphHeader struct {
 	yMax             int16
 }
 
-// parse deserializes the glyph description data.
+// parse deserializes the glyph description data. Safe for concurrent use.
 func (gd *glyphDescription) parse() error {
+	err := gd.load()
+	if err != nil {
+		return err
+	}
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
 	if gd.header != nil {
 		// Already loaded.
 		return nil
 	}
 
 	r := newByteReader(bytes.NewReader(gd.raw))
-	err := gd.parseHeader(r)
+	err = gd.parseHeader(r)
 	if err != nil {
-		logrus.Debugf("ERROR parsing header: %v", err)
-		logrus.Debugf("Raw data: %d bytes", len(gd.raw))
+		logger.Debugf("ERROR parsing header: %v", err)
+		logger.Debugf("Raw data: %d bytes", len(gd.raw))
 		return err
 	}
 
-	if gd.IsSimple() {
+	if gd.header.numberOfContours >= 0 {
 		// TODO: Currently not loading the simple glyph description.
 		//  Example code can be found lower in this file (commented out).
 		return nil
@@ -189,12 +369,12 @@ func (gd *glyphDescription) parseComposite(r *byteReader) error {
 	if instructionsFollow {
 		instructionLen := int64(len(gd.raw)) - r.Offset()
 		if instructionLen <= 0 {
-			logrus.Debug("Read more than length in loca table showed")
+			logger.Debugf("Read more than length in loca table showed")
 			return errors.New("no room for instructions")
 		}
 		err := r.readSlice(&composite.instructions, int(instructionLen))
 		if err != nil {
-			logrus.Debug("Failed to read instructions")
+			logger.Debugf("Failed to read instructions")
 			return err
 		}
 	}
@@ -246,30 +426,28 @@ func (f compositeGlyphFlag) IsSet(flag compositeGlyphFlag) bool {
 // Returns list of glyphs that `gid` depends on (other than itself).
 func (glyf *glyfTable) GetComponents(gid GlyphIndex) ([]GlyphIndex, error) {
 	if int(gid) >= len(glyf.descs) {
-		logrus.Debugf("GID not accessible (%d > %d)", gid, len(glyf.descs))
+		logger.Debugf("GID not accessible (%d > %d)", gid, len(glyf.descs))
 		return nil, nil
 	}
 
 	var components []GlyphIndex
 	gdesc := glyf.descs[int(gid)]
 
-	if gdesc.header == nil {
-		if len(gdesc.raw) == 0 {
-			// No glyph data.
-			return nil, nil
-		}
-		err := gdesc.parse()
-		if err != nil {
-			logrus.Debugf("ERROR parsing header: %v", err)
-			return nil, err
-		}
+	if gdesc.size() == 0 {
+		// No glyph data.
+		return nil, nil
+	}
+	err := gdesc.parse()
+	if err != nil {
+		logger.Debugf("ERROR parsing header: %v", err)
+		return nil, err
 	}
 
 	if gdesc.IsSimple() {
 		return components, nil
 	}
 	if gdesc.composite == nil {
-		logrus.Debugf("composite is nil")
+		logger.Debugf("composite is nil")
 		return components, nil
 	}
 
@@ -280,26 +458,851 @@ func (glyf *glyfTable) GetComponents(gid GlyphIndex) ([]GlyphIndex, error) {
 	return components, nil
 }
 
-func (gd glyphDescription) IsSimple() bool {
-	if gd.header == nil {
-		err := gd.parse()
+// maxComponentDepth is the maximum nesting depth of composite glyphs followed when resolving
+// components. Guards against cycles and excessive nesting in malformed fonts.
+const maxComponentDepth = 16
+
+// componentClosure returns the set of glyph indices consisting of `indices` and all the glyphs
+// that they depend on as components of composite glyphs, followed recursively. Glyph indices
+// outside of the glyf table are ignored. A limit error is returned if the components are nested
+// deeper than maxComponentDepth.
+func (glyf *glyfTable) componentClosure(indices []GlyphIndex) (map[GlyphIndex]struct{}, error) {
+	gidIncludedMap := make(map[GlyphIndex]struct{}, len(indices))
+	toscan := make([]GlyphIndex, 0, len(indices))
+	for _, gid := range indices {
+		if int(gid) >= len(glyf.descs) {
+			logger.Debugf("GID out of range (%d >= %d) - ignoring", gid, len(glyf.descs))
+			continue
+		}
+		if _, has := gidIncludedMap[gid]; !has {
+			gidIncludedMap[gid] = struct{}{}
+			toscan = append(toscan, gid)
+		}
+	}
+
+	// Find dependencies of core sets of glyph, and expand until have all relations.
+	for depth := 0; len(toscan) > 0; depth++ {
+		if depth > maxComponentDepth {
+			logger.Debugf("Composite glyph nesting too deep (> %d)", maxComponentDepth)
+			return nil, newLimitError("composite glyph nesting depth exceeds %d", maxComponentDepth)
+		}
+
+		var newgids []GlyphIndex
+		for _, gid := range toscan {
+			components, err := glyf.GetComponents(gid)
+			if err != nil {
+				logger.Debugf("Error getting components for %d", gid)
+				return nil, err
+			}
+			for _, gid := range components {
+				if int(gid) >= len(glyf.descs) {
+					logger.Debugf("Component GID out of range (%d >= %d) - ignoring", gid, len(glyf.descs))
+					continue
+				}
+				if _, has := gidIncludedMap[gid]; !has {
+					gidIncludedMap[gid] = struct{}{}
+					newgids = append(newgids, gid)
+				}
+			}
+		}
+		toscan = newgids
+	}
+	return gidIncludedMap, nil
+}
+
+// GlyphComponents returns the glyphs referenced directly by the components of the composite glyph `gid`, in
+// the order of the component records, or an empty slice if `gid` is a simple or empty glyph. Glyphs referenced
+// by several components are listed for each. Useful for custom subsetting, see GlyphDependencyGraph for the
+// components of all glyphs.
+// An error is returned if `f` has no glyf table, if `gid` or a component is out of range, if the glyph data
+// cannot be parsed or if the components of `gid` refer back to a glyph they are part of (a cycle).
+func (f *Font) GlyphComponents(gid GlyphIndex) ([]GlyphIndex, error) {
+	if f.glyf == nil {
+		return nil, ErrRequiredTableMissing{Tag: "glyf"}
+	}
+	if int(gid) >= len(f.glyf.descs) {
+		logger.Debugf("GID out of range: %d >= %d", gid, len(f.glyf.descs))
+		return nil, errRangeCheck
+	}
+
+	// Depth first search with the glyphs on the current path being visited and the ones fully explored done.
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[GlyphIndex]int{}
+	var visit func(gid GlyphIndex) error
+	visit = func(gid GlyphIndex) error {
+		state[gid] = visiting
+		components, err := f.glyf.GetComponents(gid)
+		if err != nil {
+			return err
+		}
+		for _, comp := range components {
+			if int(comp) >= len(f.glyf.descs) {
+				return fmt.Errorf("glyph %d: component glyph %d out of range (%d glyphs)", gid, comp,
+					len(f.glyf.descs))
+			}
+			switch state[comp] {
+			case visiting:
+				return fmt.Errorf("glyph %d: component cycle through glyph %d", gid, comp)
+			case done:
+				continue
+			}
+			err = visit(comp)
+			if err != nil {
+				return err
+			}
+		}
+		state[gid] = done
+		return nil
+	}
+	err := visit(gid)
+	if err != nil {
+		return nil, err
+	}
+
+	components, err := f.glyf.GetComponents(gid)
+	if err != nil {
+		return nil, err
+	}
+	return append([]GlyphIndex{}, components...), nil
+}
+
+// GlyphDependencyGraph returns the glyphs referenced directly by the components of each composite glyph of
+// `f`, as GlyphComponents, keyed by the composite glyph. Simple and empty glyphs are not included. The graph
+// is returned as found in the font, so the components of malformed fonts may be out of range or form cycles,
+// which GlyphComponents reports. Glyphs whose data cannot be parsed are left out.
+// Returns nil if `f` has no glyf table.
+func (f *Font) GlyphDependencyGraph() map[GlyphIndex][]GlyphIndex {
+	if f.glyf == nil {
+		return nil
+	}
+	graph := map[GlyphIndex][]GlyphIndex{}
+	for i := range f.glyf.descs {
+		components, err := f.glyf.GetComponents(GlyphIndex(i))
+		if err != nil {
+			logger.Debugf("Unable to get components of glyph %d: %v - skipping", i, err)
+			continue
+		}
+		if len(components) > 0 {
+			graph[GlyphIndex(i)] = components
+		}
+	}
+	return graph
+}
+
+// glyphBounds represents a glyph bounding box in font design units.
+type glyphBounds struct {
+	xMin, yMin, xMax, yMax float64
+}
+
+// union returns the bounding box enclosing both `b` and `o`.
+func (b glyphBounds) union(o glyphBounds) glyphBounds {
+	return glyphBounds{
+		xMin: math.Min(b.xMin, o.xMin),
+		yMin: math.Min(b.yMin, o.yMin),
+		xMax: math.Max(b.xMax, o.xMax),
+		yMax: math.Max(b.yMax, o.yMax),
+	}
+}
+
+// rounded returns the bounds of `b` rounded outwards to integer font design units.
+func (b glyphBounds) rounded() (xMin, yMin, xMax, yMax int16) {
+	toInt16 := func(v float64) int16 {
+		return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, v)))
+	}
+	return toInt16(math.Floor(b.xMin)), toInt16(math.Floor(b.yMin)),
+		toInt16(math.Ceil(b.xMax)), toInt16(math.Ceil(b.yMax))
+}
+
+// transform returns the bounding box of `b` transformed by the matrix [a b c d] and translated by (dx,dy),
+// i.e. x' = a*x + c*y + dx and y' = b*x + d*y + dy.
+func (b glyphBounds) transform(ma, mb, mc, md, dx, dy float64) glyphBounds {
+	xs := []float64{b.xMin, b.xMax, b.xMin, b.xMax}
+	ys := []float64{b.yMin, b.yMin, b.yMax, b.yMax}
+
+	var t glyphBounds
+	for i := range xs {
+		x := ma*xs[i] + mc*ys[i] + dx
+		y := mb*xs[i] + md*ys[i] + dy
+		if i == 0 {
+			t = glyphBounds{xMin: x, yMin: y, xMax: x, yMax: y}
+			continue
+		}
+		t = t.union(glyphBounds{xMin: x, yMin: y, xMax: x, yMax: y})
+	}
+	return t
+}
+
+// matrix returns the transformation matrix [a b c d] of the component.
+func (comp compositeComponent) matrix() (float64, float64, float64, float64) {
+	switch {
+	case comp.scale != nil:
+		return comp.scale.Float64(), 0, 0, comp.scale.Float64()
+	case comp.scaleX != nil && comp.scaleY != nil:
+		return comp.scaleX.Float64(), 0, 0, comp.scaleY.Float64()
+	case comp.a != nil && comp.b != nil && comp.c != nil && comp.d != nil:
+		return comp.a.Float64(), comp.b.Float64(), comp.c.Float64(), comp.d.Float64()
+	}
+	return 1, 0, 0, 1
+}
+
+// offset returns the x and y offsets of the component. Returns false if the arguments are point numbers
+// for point matching rather than offsets.
+func (comp compositeComponent) offset() (float64, float64, bool) {
+	flag := compositeGlyphFlag(comp.flags)
+	if !flag.IsSet(argsAreXYValues) {
+		return 0, 0, false
+	}
+	if flag.IsSet(arg1And2AreWords) {
+		return float64(int16(comp.argument1)), float64(int16(comp.argument2)), true
+	}
+	return float64(int8(comp.argument1)), float64(int8(comp.argument2)), true
+}
+
+// bounds returns the bounding box of glyph `gid`. Composite glyphs are resolved by combining the bounding
+// boxes of their components, transformed as specified by the component records. Where the components are
+// positioned by point matching, the bounding box of the composite glyph header is used.
+// Returns false if the glyph has no outline.
+func (glyf *glyfTable) bounds(gid GlyphIndex, depth int) (glyphBounds, bool, error) {
+	if int(gid) >= len(glyf.descs) {
+		logger.Debugf("GID out of range (%d >= %d)", gid, len(glyf.descs))
+		return glyphBounds{}, false, errRangeCheck
+	}
+	if depth > maxComponentDepth {
+		logger.Debugf("Composite glyph nesting too deep (> %d)", maxComponentDepth)
+		return glyphBounds{}, false, errRangeCheck
+	}
+
+	gd := glyf.descs[gid]
+	if gd.size() == 0 {
+		return glyphBounds{}, false, nil
+	}
+	err := gd.parse()
+	if err != nil {
+		return glyphBounds{}, false, err
+	}
+
+	h := gd.header
+	headerBounds := glyphBounds{
+		xMin: float64(h.xMin),
+		yMin: float64(h.yMin),
+		xMax: float64(h.xMax),
+		yMax: float64(h.yMax),
+	}
+	if gd.IsSimple() {
+		return headerBounds, h.numberOfContours > 0, nil
+	}
+	if gd.composite == nil {
+		return headerBounds, true, nil
+	}
+
+	var b glyphBounds
+	nonEmpty := false
+	for _, comp := range gd.composite.components {
+		dx, dy, isOffset := comp.offset()
+		if !isOffset {
+			logger.Debugf("Composite glyph %d uses point matching - using header bounds", gid)
+			return headerBounds, true, nil
+		}
+
+		cb, has, err := glyf.bounds(GlyphIndex(comp.glyphIndex), depth+1)
+		if err != nil {
+			return glyphBounds{}, false, err
+		}
+		if !has {
+			continue
+		}
+
+		ma, mb, mc, md := comp.matrix()
+		flag := compositeGlyphFlag(comp.flags)
+		if flag.IsSet(scaledComponentOffset) && !flag.IsSet(unscaledComponentOffset) {
+			dx, dy = ma*dx+mc*dy, mb*dx+md*dy
+		}
+		cb = cb.transform(ma, mb, mc, md, dx, dy)
+
+		if !nonEmpty {
+			b, nonEmpty = cb, true
+			continue
+		}
+		b = b.union(cb)
+	}
+	return b, nonEmpty, nil
+}
+
+// numPoints returns the number of points in the outline of the simple glyph `gd`.
+func (gd *glyphDescription) numPoints() (int, error) {
+	err := gd.parse()
+	if err != nil {
+		return 0, err
+	}
+	numContours := int(gd.header.numberOfContours)
+	if numContours <= 0 {
+		return 0, nil
+	}
+
+	r := newByteReader(bytes.NewReader(gd.raw))
+	err = r.Skip(10 + 2*(numContours-1))
+	if err != nil {
+		return 0, err
+	}
+	var lastEndPt uint16
+	err = r.read(&lastEndPt)
+	if err != nil {
+		return 0, err
+	}
+	return int(lastEndPt) + 1, nil
+}
+
+// dataLen returns the length of the glyph description data in `gd.raw` excluding any trailing
+// padding bytes. The raw data is scanned without fully decoding the outline.
+func (gd *glyphDescription) dataLen() (int, error) {
+	err := gd.load()
+	if err != nil {
+		return 0, err
+	}
+	if len(gd.raw) == 0 {
+		return 0, nil
+	}
+
+	r := newByteReader(bytes.NewReader(gd.raw))
+	var numberOfContours int16
+	err = r.read(&numberOfContours)
+	if err != nil {
+		return 0, err
+	}
+	err = r.Skip(4 * 2)
+	if err != nil {
+		return 0, err
+	}
+	length := 10
+
+	if numberOfContours == 0 {
+		// No outline data to scan, keep as is.
+		return len(gd.raw), nil
+	}
+
+	if numberOfContours < 0 {
+		// Composite glyph.
+		hasInstructions := false
+		for {
+			var flags, glyphIndex uint16
+			err = r.read(&flags, &glyphIndex)
+			if err != nil {
+				return 0, err
+			}
+			length += 4
+
+			flag := compositeGlyphFlag(flags)
+			argsLen := 2
+			if flag.IsSet(arg1And2AreWords) {
+				argsLen = 4
+			}
+			if flag.IsSet(weHaveAScale) {
+				argsLen += 2
+			} else if flag.IsSet(weHaveAnXAndYScale) {
+				argsLen += 4
+			} else if flag.IsSet(weHaveATwoByTwo) {
+				argsLen += 8
+			}
+			err = r.Skip(argsLen)
+			if err != nil {
+				return 0, err
+			}
+			length += argsLen
+
+			if flag.IsSet(weHaveInstructions) {
+				hasInstructions = true
+			}
+			if !flag.IsSet(moreComponents) {
+				break
+			}
+		}
+		if hasInstructions {
+			var numInstructions uint16
+			err = r.read(&numInstructions)
+			if err != nil {
+				return 0, err
+			}
+			length += 2 + int(numInstructions)
+		}
+		if length > len(gd.raw) {
+			return 0, errRangeCheck
+		}
+		return length, nil
+	}
+
+	// Simple glyph.
+	var endPtsOfContours []uint16
+	err = r.readSlice(&endPtsOfContours, int(numberOfContours))
+	if err != nil {
+		return 0, err
+	}
+	var instructionLength uint16
+	err = r.read(&instructionLength)
+	if err != nil {
+		return 0, err
+	}
+	err = r.Skip(int(instructionLength))
+	if err != nil {
+		return 0, err
+	}
+	length += 2*int(numberOfContours) + 2 + int(instructionLength)
+
+	numPoints := int(endPtsOfContours[len(endPtsOfContours)-1]) + 1
+	var xLen, yLen int
+	for numFlags := 0; numFlags < numPoints; {
+		var flag uint8
+		err = r.read(&flag)
+		if err != nil {
+			return 0, err
+		}
+		length++
+
+		repeats := 1
+		sflag := simpleGlyphFlag(flag)
+		if sflag&repeatFlag != 0 {
+			var n uint8
+			err = r.read(&n)
+			if err != nil {
+				return 0, err
+			}
+			length++
+			repeats += int(n)
+		}
+
+		if sflag&xShortVector != 0 {
+			xLen += repeats
+		} else if sflag&xIsSameOrPositiveVector == 0 {
+			xLen += 2 * repeats
+		}
+		if sflag&yShortVector != 0 {
+			yLen += repeats
+		} else if sflag&yIsSameOrPositiveVector == 0 {
+			yLen += 2 * repeats
+		}
+		numFlags += repeats
+	}
+	length += xLen + yLen
+
+	if length > len(gd.raw) {
+		return 0, errRangeCheck
+	}
+	return length, nil
+}
+
+// remapComponents returns a copy of the glyph data of `gd` with the glyph indices of the components
+// mapped through `oldnew`. The data of simple glyphs is copied as is.
+func (gd *glyphDescription) remapComponents(oldnew map[GlyphIndex]GlyphIndex) ([]byte, error) {
+	err := gd.load()
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, len(gd.raw))
+	copy(raw, gd.raw)
+	if len(raw) < 10 || int16(binary.BigEndian.Uint16(raw)) >= 0 {
+		return raw, nil
+	}
+
+	offset := 10
+	for {
+		if offset+4 > len(raw) {
+			return nil, errRangeCheck
+		}
+		flag := compositeGlyphFlag(binary.BigEndian.Uint16(raw[offset:]))
+		gid := GlyphIndex(binary.BigEndian.Uint16(raw[offset+2:]))
+		newgid, has := oldnew[gid]
+		if !has {
+			logger.Debugf("Component glyph %d not in subset", gid)
+			return nil, errRangeCheck
+		}
+		binary.BigEndian.PutUint16(raw[offset+2:], uint16(newgid))
+		offset += 4
+
+		if flag.IsSet(arg1And2AreWords) {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		if flag.IsSet(weHaveAScale) {
+			offset += 2
+		} else if flag.IsSet(weHaveAnXAndYScale) {
+			offset += 4
+		} else if flag.IsSet(weHaveATwoByTwo) {
+			offset += 8
+		}
+		if !flag.IsSet(moreComponents) {
+			break
+		}
+	}
+	if offset > len(raw) {
+		return nil, errRangeCheck
+	}
+	return raw, nil
+}
+
+// stripInstructions returns a copy of the glyph data of `gd` without the TrueType instructions. The instruction
+// length of simple glyphs is set to 0, while composite glyphs have the WE_HAVE_INSTRUCTIONS flag cleared and
+// the instructions removed.
+func (gd *glyphDescription) stripInstructions() ([]byte, error) {
+	err := gd.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(gd.raw) < 10 {
+		return gd.raw, nil
+	}
+
+	numberOfContours := int(int16(binary.BigEndian.Uint16(gd.raw)))
+	if numberOfContours == 0 {
+		return gd.raw, nil
+	}
+
+	if numberOfContours > 0 {
+		// Simple glyph: header, endPtsOfContours, instructionLength, instructions and outline data.
+		offset := 10 + 2*numberOfContours
+		if offset+2 > len(gd.raw) {
+			return nil, errRangeCheck
+		}
+		instructionLength := int(binary.BigEndian.Uint16(gd.raw[offset:]))
+		end := offset + 2 + instructionLength
+		if end > len(gd.raw) {
+			return nil, errRangeCheck
+		}
+
+		raw := make([]byte, 0, len(gd.raw)-instructionLength)
+		raw = append(raw, gd.raw[:offset]...)
+		raw = append(raw, 0, 0)
+		return append(raw, gd.raw[end:]...), nil
+	}
+
+	raw := make([]byte, len(gd.raw))
+	copy(raw, gd.raw)
+
+	offset := 10
+	for {
+		if offset+4 > len(raw) {
+			return nil, errRangeCheck
+		}
+		flag := compositeGlyphFlag(binary.BigEndian.Uint16(raw[offset:]))
+		binary.BigEndian.PutUint16(raw[offset:], uint16(flag&^weHaveInstructions))
+		offset += 4
+
+		if flag.IsSet(arg1And2AreWords) {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		if flag.IsSet(weHaveAScale) {
+			offset += 2
+		} else if flag.IsSet(weHaveAnXAndYScale) {
+			offset += 4
+		} else if flag.IsSet(weHaveATwoByTwo) {
+			offset += 8
+		}
+		if !flag.IsSet(moreComponents) {
+			break
+		}
+	}
+	if offset > len(raw) {
+		return nil, errRangeCheck
+	}
+	return raw[:offset], nil
+}
+
+// simpleGlyphFlag represents a flag data representation of a point in a simple glyph.
+type simpleGlyphFlag uint8
+
+const (
+	onCurvePoint simpleGlyphFlag = (1 << iota)
+	xShortVector
+	yShortVector
+	repeatFlag
+	xIsSameOrPositiveVector
+	yIsSameOrPositiveVector
+	overlapSimple
+)
+
+// glyphPoint represents a point of a simple glyph outline in font design units.
+type glyphPoint struct {
+	x       int
+	y       int
+	onCurve bool
+}
+
+// simpleGlyph represents the decoded outline of a simple glyph.
+type simpleGlyph struct {
+	header       glyphHeader
+	endPts       []uint16 // index of the last point of each contour.
+	points       []glyphPoint
+	instructions []byte
+	overlap      bool // OVERLAP_SIMPLE flag set on the first point.
+}
+
+// decodeSimpleGlyph decodes the simple glyph description `data`.
+func decodeSimpleGlyph(data []byte) (*simpleGlyph, error) {
+	r := newByteReader(bytes.NewReader(data))
+	g := &simpleGlyph{}
+	h := &g.header
+	err := r.read(&h.numberOfContours, &h.xMin, &h.yMin, &h.xMax, &h.yMax)
+	if err != nil {
+		return nil, err
+	}
+	if h.numberOfContours <= 0 {
+		logger.Debugf("Not a simple glyph (%d contours)", h.numberOfContours)
+		return nil, errTypeCheck
+	}
+	err = r.readSlice(&g.endPts, int(h.numberOfContours))
+	if err != nil {
+		return nil, err
+	}
+	var instructionLength uint16
+	err = r.read(&instructionLength)
+	if err != nil {
+		return nil, err
+	}
+	err = r.readBytes(&g.instructions, int(instructionLength))
+	if err != nil {
+		return nil, err
+	}
+
+	numPoints := int(g.endPts[len(g.endPts)-1]) + 1
+	flags := make([]simpleGlyphFlag, 0, numPoints)
+	for len(flags) < numPoints {
+		var flag uint8
+		err = r.read(&flag)
+		if err != nil {
+			return nil, err
+		}
+		repeats := 1
+		if simpleGlyphFlag(flag)&repeatFlag != 0 {
+			var n uint8
+			err = r.read(&n)
+			if err != nil {
+				return nil, err
+			}
+			repeats += int(n)
+		}
+		for i := 0; i < repeats && len(flags) < numPoints; i++ {
+			flags = append(flags, simpleGlyphFlag(flag))
+		}
+	}
+	g.overlap = flags[0]&overlapSimple != 0
+
+	readCoord := func(flag, short, sameOrPositive simpleGlyphFlag) (int, error) {
+		switch {
+		case flag&short != 0:
+			var v uint8
+			err := r.read(&v)
+			if flag&sameOrPositive == 0 {
+				return -int(v), err
+			}
+			return int(v), err
+		case flag&sameOrPositive != 0:
+			return 0, nil
+		}
+		var v int16
+		err := r.read(&v)
+		return int(v), err
+	}
+
+	g.points = make([]glyphPoint, numPoints)
+	x, y := 0, 0
+	for i, flag := range flags {
+		dx, err := readCoord(flag, xShortVector, xIsSameOrPositiveVector)
+		if err != nil {
+			return nil, err
+		}
+		x += dx
+		g.points[i] = glyphPoint{x: x, onCurve: flag&onCurvePoint != 0}
+	}
+	for i, flag := range flags {
+		dy, err := readCoord(flag, yShortVector, yIsSameOrPositiveVector)
+		if err != nil {
+			return nil, err
+		}
+		y += dy
+		g.points[i].y = y
+	}
+	return g, nil
+}
+
+// bounds returns the bounding box of the points of `g`.
+func (g *simpleGlyph) bounds() (xMin, yMin, xMax, yMax int16) {
+	if len(g.points) == 0 {
+		return 0, 0, 0, 0
+	}
+	p := g.points[0]
+	b := glyphBounds{xMin: float64(p.x), yMin: float64(p.y), xMax: float64(p.x), yMax: float64(p.y)}
+	for _, p := range g.points[1:] {
+		b = b.union(glyphBounds{xMin: float64(p.x), yMin: float64(p.y), xMax: float64(p.x), yMax: float64(p.y)})
+	}
+	return b.rounded()
+}
+
+// encode returns the glyph description data of `g`. Flags are compressed with repeats and coordinates
+// are stored as short vectors where possible.
+func (g *simpleGlyph) encode() []byte {
+	var buf bytes.Buffer
+	bw := newByteWriter(&buf)
+	h := g.header
+	bw.write(h.numberOfContours, h.xMin, h.yMin, h.xMax, h.yMax)
+	bw.writeSlice(g.endPts)
+	bw.write(uint16(len(g.instructions)))
+	bw.writeBytes(g.instructions)
+
+	flags := make([]simpleGlyphFlag, len(g.points))
+	var xs, ys []byte
+	prevX, prevY := 0, 0
+	for i, p := range g.points {
+		var flag simpleGlyphFlag
+		if p.onCurve {
+			flag |= onCurvePoint
+		}
+		if g.overlap && i == 0 {
+			flag |= overlapSimple
+		}
+
+		dx, dy := p.x-prevX, p.y-prevY
+		prevX, prevY = p.x, p.y
+		switch {
+		case dx == 0:
+			flag |= xIsSameOrPositiveVector
+		case dx >= -255 && dx <= 255:
+			flag |= xShortVector
+			if dx > 0 {
+				flag |= xIsSameOrPositiveVector
+			} else {
+				dx = -dx
+			}
+			xs = append(xs, byte(dx))
+		default:
+			xs = append(xs, byte(uint16(dx)>>8), byte(dx))
+		}
+		switch {
+		case dy == 0:
+			flag |= yIsSameOrPositiveVector
+		case dy >= -255 && dy <= 255:
+			flag |= yShortVector
+			if dy > 0 {
+				flag |= yIsSameOrPositiveVector
+			} else {
+				dy = -dy
+			}
+			ys = append(ys, byte(dy))
+		default:
+			ys = append(ys, byte(uint16(dy)>>8), byte(dy))
+		}
+		flags[i] = flag
+	}
+
+	for i := 0; i < len(flags); {
+		repeats := 0
+		for i+repeats+1 < len(flags) && flags[i+repeats+1] == flags[i] && repeats < 255 {
+			repeats++
+		}
+		if repeats > 1 {
+			bw.write(uint8(flags[i]|repeatFlag), uint8(repeats))
+		} else {
+			repeats = 0
+			bw.write(uint8(flags[i]))
+		}
+		i += repeats + 1
+	}
+	bw.writeBytes(xs)
+	bw.writeBytes(ys)
+	bw.flush()
+	return buf.Bytes()
+}
+
+// encode returns the glyph description data of the composite glyph `g` with header `h`. The arguments are
+// stored as bytes where they fit and the MORE_COMPONENTS and WE_HAVE_INSTRUCTIONS flags are set as needed.
+// The instructions are written as is, including their length.
+func (g *compositeGlyph) encode(h glyphHeader) []byte {
+	var buf bytes.Buffer
+	bw := newByteWriter(&buf)
+	bw.write(h.numberOfContours, h.xMin, h.yMin, h.xMax, h.yMax)
+	for i, comp := range g.components {
+		flag := compositeGlyphFlag(comp.flags) &^ (arg1And2AreWords | moreComponents | weHaveInstructions)
+		var words bool
+		if flag.IsSet(argsAreXYValues) {
+			fits := func(v uint16) bool {
+				return int16(v) >= math.MinInt8 && int16(v) <= math.MaxInt8
+			}
+			words = !fits(comp.argument1) || !fits(comp.argument2)
+		} else {
+			words = comp.argument1 > math.MaxUint8 || comp.argument2 > math.MaxUint8
+		}
+		if words {
+			flag |= arg1And2AreWords
+		}
+		if i < len(g.components)-1 {
+			flag |= moreComponents
+		} else if len(g.instructions) > 0 {
+			flag |= weHaveInstructions
+		}
+
+		bw.write(uint16(flag), comp.glyphIndex)
+		if words {
+			bw.write(comp.argument1, comp.argument2)
+		} else {
+			bw.write(uint8(comp.argument1), uint8(comp.argument2))
+		}
+		switch {
+		case flag.IsSet(weHaveAScale):
+			bw.write(int16(*comp.scale))
+		case flag.IsSet(weHaveAnXAndYScale):
+			bw.write(int16(*comp.scaleX), int16(*comp.scaleY))
+		case flag.IsSet(weHaveATwoByTwo):
+			bw.write(int16(*comp.a), int16(*comp.b), int16(*comp.c), int16(*comp.d))
+		}
+	}
+	bw.writeBytes(g.instructions)
+	bw.flush()
+	return buf.Bytes()
+}
+
+// trimGlyphPadding removes trailing padding bytes from the glyph descriptions of `f`, keeping
+// the data lengths even as required by the short loca format.
+func (f *font) trimGlyphPadding() {
+	if f.glyf == nil {
+		return
+	}
+
+	for gid, gd := range f.glyf.descs {
+		length, err := gd.dataLen()
 		if err != nil {
-			logrus.Debugf("ERROR parsing header: %v", err)
-			return true
+			logger.Debugf("Unable to determine glyph data length (%d): %v", gid, err)
+			continue
+		}
+		if length%2 != 0 {
+			length++
+		}
+		if length < len(gd.raw) {
+			gd.raw = gd.raw[:length]
 		}
 	}
+}
+
+func (gd *glyphDescription) IsSimple() bool {
+	err := gd.parse()
+	if err != nil || gd.header == nil {
+		logger.Debugf("ERROR parsing header: %v", err)
+		return true
+	}
 
 	return gd.header.numberOfContours > -1
 }
 
 func (f *font) writeGlyf(w *byteWriter) error {
 	if f.glyf == nil || f.maxp == nil || f.loca == nil {
-		logrus.Debugf("glyf: required field missing (write)")
+		logger.Debugf("glyf: required field missing (write)")
 		return errRequiredField
 	}
 
 	if int(f.maxp.numGlyphs) != len(f.glyf.descs) {
-		logrus.Debugf("Incorrect number of glyph descriptions")
+		logger.Debugf("Incorrect number of glyph descriptions")
 		return errRangeCheck
 	}
 
@@ -308,22 +1311,34 @@ func (f *font) writeGlyf(w *byteWriter) error {
 		if err != nil {
 			return err
 		}
+		if len(gd.raw)%2 != 0 {
+			err = w.writeBytes([]byte{0})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// paddedGlyphLen returns the length of glyph data `raw` as written to the glyf table, padded to an even length
+// as required by the short loca format.
+func paddedGlyphLen(raw []byte) int64 {
+	return (int64(len(raw)) + 1) &^ 1
+}
+
 // The code below parses the glyph descriptions. Should be re-engineered so it can read from the raw data.
 // The raw data processing enables quick processing of fonts without diving into the font details.
 /*
 func (f *font) writeGlyf(w *byteWriter) error {
 	if f.glyf == nil || f.maxp == nil || f.loca == nil {
-		logrus.Debug("glyf: required field missing (write)")
+		logger.Debugf("glyf: required field missing (write)")
 		return errRequiredField
 	}
 
 	if int(f.maxp.numGlyphs) != len(f.glyf.descs) {
-		logrus.Debug("Incorrect number of glyph descriptions")
+		logger.Debugf("Incorrect number of glyph descriptions")
 		return errRangeCheck
 	}
 
@@ -361,10 +1376,10 @@ func (f *font) parseGlyphDescription(r *byteReader, gdLen int64) (*glyphDescript
 	if err != nil {
 		return nil, err
 	}
-	logrus.Tracef("gh: %+v", gh)
+	logger.Tracef("gh: %+v", gh)
 
 	if gh.numberOfContours >= 0 {
-		logrus.Tracef("simple glyph data, contours: %d", gh.numberOfContours)
+		logger.Tracef("simple glyph data, contours: %d", gh.numberOfContours)
 		// Simple glyph.
 		sgd, err := f.parseSimpleGlyphDescription(r, int(gh.numberOfContours))
 		if err != nil {
@@ -377,7 +1392,7 @@ func (f *font) parseGlyphDescription(r *byteReader, gdLen int64) (*glyphDescript
 		}, nil
 	}
 
-	logrus.Trace("composite glyph data")
+	logger.Tracef("composite glyph data")
 	// Composite/compound glyph.
 	cgd, err := f.parseCompositeGlyphDescription(r, gdLen)
 	if err != nil {
@@ -485,7 +1500,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 	}
 
 	if f.loca == nil {
-		logrus.Debug("loca not set")
+		logger.Debugf("loca not set")
 		return nil, errRequiredField
 	}
 
@@ -508,7 +1523,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 	// total number of points (all contours).
 	numPoints := int(d.endPtsOfContours[numContours-1]) + 1
 
-	logrus.Trace("GID data - Number of points: %d", numPoints)
+	logger.Tracef("GID data - Number of points: %d", numPoints)
 
 	// flags (one for each point).
 	numFlags := 0
@@ -518,7 +1533,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 		if err != nil {
 			return nil, err
 		}
-		logrus.Trace("flag: %d (%s)", flag, simpleGlyphFlag(flag).String())
+		logger.Tracef("flag: %d (%s)", flag, simpleGlyphFlag(flag).String())
 
 		d.flags = append(d.flags, flag)
 		numFlags++
@@ -530,7 +1545,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 			if err != nil {
 				return nil, err
 			}
-			logrus.Trace("Repeats: %d", repeats)
+			logger.Tracef("Repeats: %d", repeats)
 			for i := 0; i < int(repeats); i++ {
 				d.flags = append(d.flags, flag)
 				numFlags++
@@ -538,15 +1553,15 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 		}
 	}
 	if numFlags != numPoints {
-		logrus.Debug("Number of flags != number of points (%d != %d)", numFlags, numPoints)
+		logger.Debugf("Number of flags != number of points (%d != %d)", numFlags, numPoints)
 		return nil, errors.New("numflags != numpoints")
 	}
-	logrus.Trace("Number of flags: %d", numFlags)
-	logrus.Trace("Flags: % d\n", d.flags)
-	logrus.Trace("@Offset: %d", r.Offset())
+	logger.Tracef("Number of flags: %d", numFlags)
+	logger.Tracef("Flags: % d\n", d.flags)
+	logger.Tracef("@Offset: %d", r.Offset())
 
 	// x coordinates.
-	logrus.Trace("X Coordinates")
+	logger.Tracef("X Coordinates")
 	var xLast uint16
 	for _, flag := range d.flags {
 		sflag := simpleGlyphFlag(flag)
@@ -556,12 +1571,12 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 			if err != nil {
 				return nil, err
 			}
-			logrus.Trace("Short data - x=%d", x)
+			logger.Tracef("Short data - x=%d", x)
 			d.xCoordinates = append(d.xCoordinates, uint16(x))
 			xLast = uint16(x)
 		} else {
 			if sflag&xIsSameOrPositiveVector != 0 {
-				logrus.Trace("Long data - same as last")
+				logger.Tracef("Long data - same as last")
 				d.xCoordinates = append(d.xCoordinates, xLast)
 			} else {
 				var x uint16
@@ -569,7 +1584,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 				if err != nil {
 					return nil, err
 				}
-				logrus.Trace("Long data - x=%d", x)
+				logger.Tracef("Long data - x=%d", x)
 				d.xCoordinates = append(d.xCoordinates, x)
 				xLast = x
 			}
@@ -577,7 +1592,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 	}
 
 	// y coordinates.
-	logrus.Trace("Y Coordinates")
+	logger.Tracef("Y Coordinates")
 	var yLast uint16
 	for _, flag := range d.flags {
 		sflag := simpleGlyphFlag(flag)
@@ -587,12 +1602,12 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 			if err != nil {
 				return nil, err
 			}
-			logrus.Trace("Short data - y=%d", y)
+			logger.Tracef("Short data - y=%d", y)
 			d.yCoordinates = append(d.yCoordinates, uint16(y))
 			yLast = uint16(y)
 		} else {
 			if sflag&yIsSameOrPositiveVector != 0 {
-				logrus.Trace("Long data - same as last")
+				logger.Tracef("Long data - same as last")
 				d.yCoordinates = append(d.yCoordinates, yLast)
 			} else {
 				var y uint16
@@ -600,7 +1615,7 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 				if err != nil {
 					return nil, err
 				}
-				logrus.Trace("Long data - y=%d", y)
+				logger.Tracef("Long data - y=%d", y)
 				d.yCoordinates = append(d.yCoordinates, y)
 				yLast = y
 			}
@@ -612,11 +1627,11 @@ func (f *font) parseSimpleGlyphDescription(r *byteReader, numContours int) (*sim
 
 func (d *simpleGlyphDescription) Write(w *byteWriter, f *font, numContours int) error {
 	if f == nil || f.loca == nil {
-		logrus.Debug("sgd: required field missing (write)")
+		logger.Debugf("sgd: required field missing (write)")
 		return errRequiredField
 	}
 	if len(d.endPtsOfContours) != numContours {
-		logrus.Debugf("len(endPtsOfContours) != numContours (%d != %d)", len(d.endPtsOfContours), numContours)
+		logger.Debugf("len(endPtsOfContours) != numContours (%d != %d)", len(d.endPtsOfContours), numContours)
 		return errRangeCheck
 	}
 
@@ -636,13 +1651,13 @@ func (d *simpleGlyphDescription) Write(w *byteWriter, f *font, numContours int)
 	}
 
 	if numContours > len(d.endPtsOfContours) {
-		logrus.Debugf("range check error (numContours)")
+		logger.Debugf("range check error (numContours)")
 		return errRangeCheck
 	}
 
 	numPoints := int(d.endPtsOfContours[numContours-1]) + 1
 	if len(d.flags) != numPoints {
-		logrus.Debugf("#flags != #points (%d/%d)", len(d.flags), numPoints)
+		logger.Debugf("#flags != #points (%d/%d)", len(d.flags), numPoints)
 		return errRangeCheck
 	}
 
@@ -872,13 +1887,13 @@ func (f *font) parseCompositeGlyphDescription(r *byteReader, gdLen int64) (*comp
 	if instructionsFollow {
 		instructionLen := int64(gdLen) - len
 		if instructionLen < 0 {
-			logrus.Debug("Read more than length in loca table showed")
+			logger.Debugf("Read more than length in loca table showed")
 			return nil, errors.New("read too far")
 		}
 
 		err := r.readSlice(&cgd.instructions, int(instructionLen))
 		if err != nil {
-			logrus.Debug("Failed to read instructions")
+			logger.Debugf("Failed to read instructions")
 			return nil, err
 		}
 	}
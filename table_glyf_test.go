@@ -2,9 +2,12 @@ package unitype
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -78,3 +81,201 @@ func TestGlyfReadWrite(t *testing.T) {
 		})
 	}
 }
+
+// compositeGlyphData returns the glyph data of a composite glyph with a single component `gid`.
+func compositeGlyphData(gid uint16) []byte {
+	return []byte{
+		0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0, // header, numberOfContours = -1.
+		0, 0, byte(gid >> 8), byte(gid), 0, 0, // flags, glyphIndex, arg1, arg2.
+	}
+}
+
+func TestComponentClosure(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		glyf := &glyfTable{
+			descs: []*glyphDescription{
+				{raw: nil},
+				{raw: compositeGlyphData(2)},
+				{raw: compositeGlyphData(1)},
+				{raw: compositeGlyphData(99)},
+			},
+		}
+		included, err := glyf.componentClosure([]GlyphIndex{1, 3, 100})
+		require.NoError(t, err)
+		assert.Equal(t, map[GlyphIndex]struct{}{1: {}, 2: {}, 3: {}}, included)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		glyf := &glyfTable{}
+		for i := 0; i < 2*maxComponentDepth; i++ {
+			glyf.descs = append(glyf.descs, &glyphDescription{raw: compositeGlyphData(uint16(i + 1))})
+		}
+		_, err := glyf.componentClosure([]GlyphIndex{0})
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+
+		// Nesting up to maxComponentDepth is followed.
+		included, err := glyf.componentClosure([]GlyphIndex{maxComponentDepth - 1})
+		require.NoError(t, err)
+		assert.Len(t, included, maxComponentDepth+1)
+	})
+}
+
+func TestGlyphComponents(t *testing.T) {
+	composite := []byte{
+		0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0, // header, numberOfContours = -1.
+		0x00, 0x21, 0, 1, 0xFF, 0xF6, 0, 20, // ARG_1_AND_2_ARE_WORDS | MORE_COMPONENTS, glyph 1, args.
+		0x00, 0x28, 0, 2, 5, 6, 0x20, 0x00, // WE_HAVE_A_SCALE | MORE_COMPONENTS, glyph 2, args, scale.
+		0x00, 0x60, 0, 3, 5, 6, 0x20, 0x00, 0x40, 0x00, // WE_HAVE_AN_X_AND_Y_SCALE | MORE_COMPONENTS, glyph 3.
+		0x00, 0x81, 0, 1, 0, 1, 0, 2, 0x40, 0, 0, 0, 0, 0, 0x40, 0, // WE_HAVE_A_TWO_BY_TWO | ARG_1_AND_2_ARE_WORDS.
+	}
+	fnt := &Font{font: &font{glyf: &glyfTable{
+		descs: []*glyphDescription{
+			{raw: nil},
+			{raw: nil},
+			{raw: nil},
+			{raw: nil},
+			{raw: composite},
+			{raw: compositeGlyphData(4)},
+			{raw: compositeGlyphData(7)},
+			{raw: compositeGlyphData(6)},
+			{raw: compositeGlyphData(6)},
+			{raw: compositeGlyphData(99)},
+		},
+	}}}
+
+	components, err := fnt.GlyphComponents(4)
+	require.NoError(t, err)
+	assert.Equal(t, []GlyphIndex{1, 2, 3, 1}, components)
+	components, err = fnt.GlyphComponents(5)
+	require.NoError(t, err)
+	assert.Equal(t, []GlyphIndex{4}, components)
+	components, err = fnt.GlyphComponents(1)
+	require.NoError(t, err)
+	assert.NotNil(t, components)
+	assert.Empty(t, components)
+
+	_, err = fnt.GlyphComponents(6)
+	assert.EqualError(t, err, "glyph 7: component cycle through glyph 6")
+	_, err = fnt.GlyphComponents(8)
+	assert.EqualError(t, err, "glyph 7: component cycle through glyph 6")
+	_, err = fnt.GlyphComponents(9)
+	assert.EqualError(t, err, "glyph 9: component glyph 99 out of range (10 glyphs)")
+	_, err = fnt.GlyphComponents(10)
+	assert.Equal(t, errRangeCheck, err)
+
+	expected := map[GlyphIndex][]GlyphIndex{4: {1, 2, 3, 1}, 5: {4}, 6: {7}, 7: {6}, 8: {6}, 9: {99}}
+	assert.Equal(t, expected, fnt.GlyphDependencyGraph())
+
+	fnt.glyf = nil
+	_, err = fnt.GlyphComponents(0)
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "glyf"}, err)
+	assert.Nil(t, fnt.GlyphDependencyGraph())
+
+	// Real font.
+	fnt, err = ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	gid, _ := fnt.LookupRune('é')
+	components, err = fnt.GlyphComponents(gid)
+	require.NoError(t, err)
+	require.Len(t, components, 2)
+	graph := fnt.GlyphDependencyGraph()
+	assert.Equal(t, components, graph[gid])
+	for gid, components := range graph {
+		direct, err := fnt.GlyphComponents(gid)
+		require.NoError(t, err)
+		assert.Equal(t, direct, components)
+	}
+}
+
+func TestLazyGlyphs(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	eager, err := ParseBytes(data)
+	require.NoError(t, err)
+	fnt, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{LazyGlyphs: true})
+	require.NoError(t, err)
+
+	numLoaded := func(f *Font) int {
+		n := 0
+		for _, desc := range f.glyf.descs {
+			if desc.lazy == nil || desc.lazy.loaded {
+				n++
+			}
+		}
+		return n
+	}
+	require.Len(t, fnt.glyf.descs, len(eager.glyf.descs))
+	assert.Equal(t, 0, numLoaded(fnt))
+
+	// The glyph data and the table data are read from the same source, concurrently.
+	gidH, _ := fnt.LookupRune('H')
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, fnt.glyf.descs[gidH].load())
+			_, err := fnt.TableBytes("head")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, eager.glyf.descs[gidH].raw, fnt.glyf.descs[gidH].raw)
+	assert.Equal(t, 1, numLoaded(fnt))
+
+	// Glyphs are read on first access. Å is a composite of A and the ring.
+	gidA, _ := fnt.LookupRune('Å')
+	o, err := fnt.GlyphOutline(gidA)
+	require.NoError(t, err)
+	expected, err := eager.GlyphOutline(gidA)
+	require.NoError(t, err)
+	assert.Equal(t, expected, o)
+	assert.Equal(t, 4, numLoaded(fnt))
+
+	// Subsetting reads only the glyphs kept.
+	subfnt, err := fnt.SubsetKeepRunes([]rune("Hello"))
+	require.NoError(t, err)
+	assert.True(t, numLoaded(fnt) < 10, numLoaded(fnt))
+	eagerSubfnt, err := eager.SubsetKeepRunes([]rune("Hello"))
+	require.NoError(t, err)
+	subData, err := subfnt.Bytes()
+	require.NoError(t, err)
+	eagerSubData, err := eagerSubfnt.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, eagerSubData, subData)
+
+	// Writing reads all glyphs.
+	written, err := fnt.Bytes()
+	require.NoError(t, err)
+	eagerWritten, err := eager.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, eagerWritten, written)
+	assert.Equal(t, len(fnt.glyf.descs), numLoaded(fnt))
+}
+
+func benchmarkSubset(b *testing.B, opts ParseOptions) {
+	data, err := ioutil.ReadFile("./testdata/wts11.ttf")
+	require.NoError(b, err)
+	runes := make([]rune, 0, 100)
+	for r := rune(0x4E00); len(runes) < 100; r++ {
+		runes = append(runes, r)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fnt, err := ParseWithOptions(bytes.NewReader(data), opts)
+		require.NoError(b, err)
+		subfnt, err := fnt.SubsetKeepRunes(runes)
+		require.NoError(b, err)
+		_, err = subfnt.Bytes()
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkSubset(b *testing.B) {
+	benchmarkSubset(b, ParseOptions{})
+}
+
+func BenchmarkSubsetLazyGlyphs(b *testing.B) {
+	benchmarkSubset(b, ParseOptions{LazyGlyphs: true})
+}
@@ -0,0 +1,336 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// gposTable represents the kerning of the glyph positioning (GPOS) table. Only the pair adjustment
+// lookups (format 1 and 2) of the 'kern' feature in the default script are modelled, other lookups are
+// skipped. The table itself is preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/gpos
+type gposTable struct {
+	kernLookups [][]*pairPosSubtable // pair adjustment subtables of the 'kern' lookups in LookupList order.
+}
+
+// pairPosSubtable represents a pair adjustment positioning subtable (lookup type 2). Only the horizontal
+// advance adjustment of the first glyph is retained as that is how kerning is specified.
+type pairPosSubtable struct {
+	format   uint16
+	coverage coverage
+
+	// Format 1: adjustments by second glyph, per coverage index of the first glyph.
+	pairSets []map[GlyphIndex]int16
+
+	// Format 2: adjustments by class of the first and second glyph.
+	classDef1   classDef
+	classDef2   classDef
+	class1Count uint16
+	class2Count uint16
+	values      []int16 // indexed by class1*class2Count + class2, nil if no advance adjustments.
+}
+
+const (
+	gposPairAdjustment = 2
+	gposExtension      = 9
+
+	valueXAdvance = 0x0004
+)
+
+// parseGPOS parses the kerning of the GPOS table from the data of the raw GPOS table, if present.
+// Malformed GPOS tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseGPOS() *gposTable {
+	data := f.rawTableData("GPOS")
+	if data == nil {
+		logger.Debugf("GPOS table absent")
+		return nil
+	}
+
+	t, err := parseGPOSData(data)
+	if err != nil {
+		logger.Debugf("Error parsing GPOS table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseGPOSData parses GPOS table `data`.
+func parseGPOSData(data []byte) (*gposTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	h, err := parseLayoutHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &gposTable{}
+
+	indices, err := featureLookupIndices(r, h, "kern")
+	if err != nil {
+		return nil, err
+	}
+	lookups, err := parseLookups(r, h, indices, gposExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range lookups {
+		if l.lookupType != gposPairAdjustment {
+			logger.Debugf("GPOS lookup type %d not supported - skipping", l.lookupType)
+			continue
+		}
+		var subtables []*pairPosSubtable
+		for _, offset := range l.subtables {
+			st, err := parsePairPos(r, offset, int64(len(data)))
+			if err != nil {
+				return nil, err
+			}
+			if st != nil {
+				subtables = append(subtables, st)
+			}
+		}
+		t.kernLookups = append(t.kernLookups, subtables)
+	}
+	return t, nil
+}
+
+// valueRecordSize returns the size in bytes of a value record with format `valueFormat`.
+func valueRecordSize(valueFormat uint16) int {
+	size := 0
+	for bit := uint16(1); bit < 0x100; bit <<= 1 {
+		if valueFormat&bit != 0 {
+			size += 2
+		}
+	}
+	return size
+}
+
+// readXAdvance reads a value record with format `valueFormat` from `r` and returns its horizontal advance
+// adjustment.
+func readXAdvance(r *byteReader, valueFormat uint16) (int16, error) {
+	var xAdvance int16
+	for bit := uint16(1); bit < 0x100; bit <<= 1 {
+		if valueFormat&bit == 0 {
+			continue
+		}
+		var val int16
+		err := r.read(&val)
+		if err != nil {
+			return 0, err
+		}
+		if bit == valueXAdvance {
+			xAdvance = val
+		}
+	}
+	return xAdvance, nil
+}
+
+// parsePairPos parses the pair adjustment subtable at `offset` in a table of `size` bytes.
+// Returns nil if the subtable format is not supported.
+func parsePairPos(r *byteReader, offset, size int64) (*pairPosSubtable, error) {
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	st := &pairPosSubtable{}
+	var coverageOffset offset16
+	var valueFormat1, valueFormat2 uint16
+	err = r.read(&st.format, &coverageOffset, &valueFormat1, &valueFormat2)
+	if err != nil {
+		return nil, err
+	}
+
+	switch st.format {
+	case 1:
+		var pairSetCount uint16
+		err = r.read(&pairSetCount)
+		if err != nil {
+			return nil, err
+		}
+		var pairSetOffsets []offset16
+		err = r.readSlice(&pairSetOffsets, int(pairSetCount))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pso := range pairSetOffsets {
+			err = r.SeekTo(offset + int64(pso))
+			if err != nil {
+				return nil, err
+			}
+			var pairValueCount uint16
+			err = r.read(&pairValueCount)
+			if err != nil {
+				return nil, err
+			}
+			pairs := make(map[GlyphIndex]int16, pairValueCount)
+			for i := 0; i < int(pairValueCount); i++ {
+				var second uint16
+				err = r.read(&second)
+				if err != nil {
+					return nil, err
+				}
+				value, err := readXAdvance(r, valueFormat1)
+				if err != nil {
+					return nil, err
+				}
+				err = r.Skip(valueRecordSize(valueFormat2))
+				if err != nil {
+					return nil, err
+				}
+				if _, has := pairs[GlyphIndex(second)]; !has {
+					pairs[GlyphIndex(second)] = value
+				}
+			}
+			st.pairSets = append(st.pairSets, pairs)
+		}
+	case 2:
+		var classDef1Offset, classDef2Offset offset16
+		err = r.read(&classDef1Offset, &classDef2Offset, &st.class1Count, &st.class2Count)
+		if err != nil {
+			return nil, err
+		}
+
+		size1 := valueRecordSize(valueFormat1)
+		recordSize := int64(size1 + valueRecordSize(valueFormat2))
+		numRecords := int64(st.class1Count) * int64(st.class2Count)
+		if r.Offset()+numRecords*recordSize > size {
+			logger.Debugf("GPOS class pair records out of range")
+			return nil, errRangeCheck
+		}
+		if valueFormat1&valueXAdvance != 0 {
+			st.values = make([]int16, numRecords)
+			for i := range st.values {
+				st.values[i], err = readXAdvance(r, valueFormat1)
+				if err != nil {
+					return nil, err
+				}
+				err = r.Skip(int(recordSize) - size1)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		st.classDef1, err = parseClassDef(r, offset+int64(classDef1Offset))
+		if err != nil {
+			return nil, err
+		}
+		st.classDef2, err = parseClassDef(r, offset+int64(classDef2Offset))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		logger.Debugf("Unsupported pair adjustment format: %d - skipping", st.format)
+		return nil, nil
+	}
+
+	st.coverage, err = parseCoverage(r, offset+int64(coverageOffset))
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// lookup returns the horizontal advance adjustment of the pair `left`, `right` in `st`.
+// The bool `applies` indicates whether the subtable applies to the pair, and `found` whether the
+// subtable specifies an adjustment for it. Class pairs without adjustment apply but are not found.
+func (st *pairPosSubtable) lookup(left, right GlyphIndex) (value int16, applies, found bool) {
+	ci, has := st.coverage[left]
+	if !has {
+		return 0, false, false
+	}
+
+	if st.format == 1 {
+		if ci >= len(st.pairSets) {
+			return 0, false, false
+		}
+		value, found = st.pairSets[ci][right]
+		return value, found, found
+	}
+
+	class1 := st.classDef1[left]
+	class2 := st.classDef2[right]
+	if class1 >= st.class1Count || class2 >= st.class2Count {
+		return 0, false, false
+	}
+	if st.values == nil {
+		return 0, true, false
+	}
+	value = st.values[int(class1)*int(st.class2Count)+int(class2)]
+	return value, true, value != 0
+}
+
+// lookup returns the horizontal kerning value of the pair `left`, `right` accumulated over the 'kern'
+// lookups of `t`. Within a lookup only the first subtable that applies to the pair is used.
+// Returns false if the pair is not kerned.
+func (t *gposTable) lookup(left, right GlyphIndex) (int16, bool) {
+	var value int16
+	found := false
+	for _, subtables := range t.kernLookups {
+		for _, st := range subtables {
+			v, applies, has := st.lookup(left, right)
+			if !applies {
+				continue
+			}
+			if has {
+				value += v
+				found = true
+			}
+			break
+		}
+	}
+	return value, found
+}
+
+// pairs returns all the kerned pairs of `t` with the kerning values accumulated over the lookups.
+// Class based adjustments for glyphs in the second class 0 (glyphs not assigned a class) are resolved
+// against the glyphs up to `numGlyphs`.
+func (t *gposTable) pairs(numGlyphs int) map[[2]GlyphIndex]int16 {
+	candidates := map[[2]GlyphIndex]bool{}
+	for _, subtables := range t.kernLookups {
+		for _, st := range subtables {
+			for left, ci := range st.coverage {
+				if st.format == 1 {
+					if ci < len(st.pairSets) {
+						for right := range st.pairSets[ci] {
+							candidates[[2]GlyphIndex{left, right}] = true
+						}
+					}
+					continue
+				}
+				if st.values == nil {
+					continue
+				}
+				class1 := st.classDef1[left]
+				if class1 >= st.class1Count {
+					continue
+				}
+				row := st.values[int(class1)*int(st.class2Count) : int(class1+1)*int(st.class2Count)]
+				for right, class2 := range st.classDef2 {
+					if class2 < st.class2Count && row[class2] != 0 {
+						candidates[[2]GlyphIndex{left, right}] = true
+					}
+				}
+				if len(row) > 0 && row[0] != 0 {
+					for gid := 0; gid < numGlyphs; gid++ {
+						if _, has := st.classDef2[GlyphIndex(gid)]; !has {
+							candidates[[2]GlyphIndex{left, GlyphIndex(gid)}] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	values := make(map[[2]GlyphIndex]int16, len(candidates))
+	for key := range candidates {
+		if value, found := t.lookup(key[0], key[1]); found {
+			values[key] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPOSKerning(t *testing.T) {
+	testcases := []struct {
+		fontPath    string
+		numLookups  int
+		left, right rune
+		expected    int16
+		numPairs    int
+	}{
+		{"./testdata/FreeSans.ttf", 2, 'A', 'V', -75, 997},
+		{"./testdata/FreeSans.ttf", 2, 'T', 'o', -92, 997},
+		// Class based kerning (format 2).
+		{"./testdata/roboto/Roboto-Bold.ttf", 1, 'A', 'V', -77, 69246},
+		{"./testdata/roboto/Roboto-Bold.ttf", 1, 'T', 'o', -208, 69246},
+	}
+
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+			require.NotNil(t, fnt.gpos)
+			assert.Len(t, fnt.gpos.kernLookups, tcase.numLookups)
+
+			left, ok := fnt.LookupRune(tcase.left)
+			require.True(t, ok)
+			right, ok := fnt.LookupRune(tcase.right)
+			require.True(t, ok)
+
+			value, found := fnt.KernPair(left, right)
+			assert.True(t, found)
+			assert.Equal(t, tcase.expected, value)
+
+			_, found = fnt.KernPair(right, right)
+			assert.False(t, found)
+
+			pairs := fnt.AllKernPairs()
+			assert.Len(t, pairs, tcase.numPairs)
+			assert.Contains(t, pairs, KerningPair{Left: left, Right: right, Value: tcase.expected})
+
+			// Kerning retained in subset as GIDs are maintained.
+			subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{left, right})
+			require.NoError(t, err)
+			value, _ = subfnt.KernPair(left, right)
+			assert.Equal(t, tcase.expected, value)
+		})
+	}
+}
+
+func TestGPOSReadWrite(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	orig := fnt.rawTableData("GPOS")
+	require.NotNil(t, orig)
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, orig, newfnt.rawTableData("GPOS"))
+
+	left, _ := newfnt.LookupRune('A')
+	right, _ := newfnt.LookupRune('V')
+	value, found := newfnt.KernPair(left, right)
+	assert.True(t, found)
+	assert.Equal(t, int16(-77), value)
+
+	require.NoError(t, newfnt.PruneTables("GPOS"))
+	_, found = newfnt.KernPair(left, right)
+	assert.False(t, found)
+	assert.Nil(t, newfnt.AllKernPairs())
+}
@@ -0,0 +1,336 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"sort"
+)
+
+// gsubTable represents the glyph substitutions of the glyph substitution (GSUB) table.
+// The single, multiple, alternate and ligature substitution lookups are modelled to the extent needed
+// to determine which glyphs can be substituted for which. Contextual lookups are not modelled, as
+// the lookups they invoke are part of the LookupList and are thus accounted for regardless.
+// The table itself is preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/gsub
+type gsubTable struct {
+	subtables []*gsubSubtable // supported substitution subtables of all lookups in LookupList order.
+}
+
+// gsubSubtable represents a single, multiple, alternate or ligature substitution subtable.
+type gsubSubtable struct {
+	lookupType uint16
+
+	// Single, multiple and alternate substitution: glyphs that can replace each covered glyph.
+	substitutes map[GlyphIndex][]GlyphIndex
+
+	// Ligature substitution: ligatures by first component glyph.
+	ligatures map[GlyphIndex][]gsubLigature
+}
+
+// gsubLigature represents a ligature substituted for a sequence of component glyphs.
+type gsubLigature struct {
+	glyph      GlyphIndex
+	components []GlyphIndex // components following the first one.
+}
+
+const (
+	gsubSingleSubst    = 1
+	gsubMultipleSubst  = 2
+	gsubAlternateSubst = 3
+	gsubLigatureSubst  = 4
+	gsubExtension      = 7
+)
+
+// parseGSUB parses the substitutions of the GSUB table from the data of the raw GSUB table, if present.
+// Malformed GSUB tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseGSUB() *gsubTable {
+	data := f.rawTableData("GSUB")
+	if data == nil {
+		logger.Debugf("GSUB table absent")
+		return nil
+	}
+
+	t, err := parseGSUBData(data)
+	if err != nil {
+		logger.Debugf("Error parsing GSUB table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseGSUBData parses GSUB table `data`.
+func parseGSUBData(data []byte) (*gsubTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	h, err := parseLayoutHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	lookups, err := parseAllLookups(r, h, gsubExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &gsubTable{}
+	for _, l := range lookups {
+		switch l.lookupType {
+		case gsubSingleSubst, gsubMultipleSubst, gsubAlternateSubst, gsubLigatureSubst:
+		default:
+			logger.Debugf("GSUB lookup type %d not modelled - skipping", l.lookupType)
+			continue
+		}
+		for _, offset := range l.subtables {
+			st, err := parseGSUBSubtable(r, l.lookupType, offset)
+			if err != nil {
+				return nil, err
+			}
+			if st != nil {
+				t.subtables = append(t.subtables, st)
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseGSUBSubtable parses the substitution subtable of type `lookupType` at `offset`.
+// Returns nil if the subtable format is not supported.
+func parseGSUBSubtable(r *byteReader, lookupType uint16, offset int64) (*gsubSubtable, error) {
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var format uint16
+	var coverageOffset offset16
+	err = r.read(&format, &coverageOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &gsubSubtable{lookupType: lookupType}
+	var deltaGlyphID int16
+	var indexed [][]GlyphIndex // substitutes by coverage index.
+
+	switch {
+	case lookupType == gsubSingleSubst && format == 1:
+		err = r.read(&deltaGlyphID)
+	case lookupType == gsubSingleSubst && format == 2:
+		var glyphCount uint16
+		err = r.read(&glyphCount)
+		if err != nil {
+			return nil, err
+		}
+		var gids []uint16
+		err = r.readSlice(&gids, int(glyphCount))
+		for _, gid := range gids {
+			indexed = append(indexed, []GlyphIndex{GlyphIndex(gid)})
+		}
+	case (lookupType == gsubMultipleSubst || lookupType == gsubAlternateSubst) && format == 1:
+		// Sequence and AlternateSet tables have the same structure.
+		indexed, err = parseGlyphSequences(r, offset)
+	case lookupType == gsubLigatureSubst && format == 1:
+		st.ligatures = map[GlyphIndex][]gsubLigature{}
+	default:
+		logger.Debugf("Unsupported GSUB subtable (type %d, format %d) - skipping", lookupType, format)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if st.ligatures != nil {
+		return st, parseLigatureSets(r, offset, coverageOffset, st)
+	}
+
+	cov, err := parseCoverage(r, offset+int64(coverageOffset))
+	if err != nil {
+		return nil, err
+	}
+	st.substitutes = make(map[GlyphIndex][]GlyphIndex, len(cov))
+	for gid, ci := range cov {
+		if lookupType == gsubSingleSubst && format == 1 {
+			st.substitutes[gid] = []GlyphIndex{GlyphIndex(int(gid) + int(deltaGlyphID))}
+			continue
+		}
+		if ci < len(indexed) {
+			st.substitutes[gid] = indexed[ci]
+		}
+	}
+	return st, nil
+}
+
+// parseGlyphSequences parses the offset array to glyph sequences that follows the current position of `r`,
+// with offsets relative to `offset`.
+func parseGlyphSequences(r *byteReader, offset int64) ([][]GlyphIndex, error) {
+	var count uint16
+	err := r.read(&count)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []offset16
+	err = r.readSlice(&offsets, int(count))
+	if err != nil {
+		return nil, err
+	}
+
+	sequences := make([][]GlyphIndex, len(offsets))
+	for i, off := range offsets {
+		err = r.SeekTo(offset + int64(off))
+		if err != nil {
+			return nil, err
+		}
+		var glyphCount uint16
+		err = r.read(&glyphCount)
+		if err != nil {
+			return nil, err
+		}
+		var gids []uint16
+		err = r.readSlice(&gids, int(glyphCount))
+		if err != nil {
+			return nil, err
+		}
+		for _, gid := range gids {
+			sequences[i] = append(sequences[i], GlyphIndex(gid))
+		}
+	}
+	return sequences, nil
+}
+
+// parseLigatureSets parses the ligature sets of the ligature substitution subtable at `offset` into `st`.
+func parseLigatureSets(r *byteReader, offset int64, coverageOffset offset16, st *gsubSubtable) error {
+	var ligatureSetCount uint16
+	err := r.read(&ligatureSetCount)
+	if err != nil {
+		return err
+	}
+	var setOffsets []offset16
+	err = r.readSlice(&setOffsets, int(ligatureSetCount))
+	if err != nil {
+		return err
+	}
+
+	sets := make([][]gsubLigature, len(setOffsets))
+	for i, so := range setOffsets {
+		set := offset + int64(so)
+		err = r.SeekTo(set)
+		if err != nil {
+			return err
+		}
+		var ligatureCount uint16
+		err = r.read(&ligatureCount)
+		if err != nil {
+			return err
+		}
+		var ligOffsets []offset16
+		err = r.readSlice(&ligOffsets, int(ligatureCount))
+		if err != nil {
+			return err
+		}
+
+		for _, lo := range ligOffsets {
+			err = r.SeekTo(set + int64(lo))
+			if err != nil {
+				return err
+			}
+			var glyph, componentCount uint16
+			err = r.read(&glyph, &componentCount)
+			if err != nil {
+				return err
+			}
+			lig := gsubLigature{glyph: GlyphIndex(glyph)}
+			if componentCount > 1 {
+				var gids []uint16
+				err = r.readSlice(&gids, int(componentCount)-1)
+				if err != nil {
+					return err
+				}
+				for _, gid := range gids {
+					lig.components = append(lig.components, GlyphIndex(gid))
+				}
+			}
+			sets[i] = append(sets[i], lig)
+		}
+	}
+
+	cov, err := parseCoverage(r, offset+int64(coverageOffset))
+	if err != nil {
+		return err
+	}
+	for gid, ci := range cov {
+		if ci < len(sets) {
+			st.ligatures[gid] = sets[ci]
+		}
+	}
+	return nil
+}
+
+// closure expands the glyph set `gids` in place with all glyphs reachable through the substitutions of `t`.
+// Ligatures are included when all of their components are in the set.
+func (t *gsubTable) closure(gids map[GlyphIndex]bool) {
+	for changed := true; changed; {
+		changed = false
+		add := func(gid GlyphIndex) {
+			if !gids[gid] {
+				gids[gid] = true
+				changed = true
+			}
+		}
+
+		for _, st := range t.subtables {
+			for gid, subs := range st.substitutes {
+				if !gids[gid] {
+					continue
+				}
+				for _, sub := range subs {
+					add(sub)
+				}
+			}
+			for gid, ligs := range st.ligatures {
+				if !gids[gid] {
+					continue
+				}
+				for _, lig := range ligs {
+					if gids[lig.glyph] {
+						continue
+					}
+					all := true
+					for _, c := range lig.components {
+						if !gids[c] {
+							all = false
+							break
+						}
+					}
+					if all {
+						add(lig.glyph)
+					}
+				}
+			}
+		}
+	}
+}
+
+// GlyphClosure returns the glyphs `indices` expanded with all glyphs reachable from them through the
+// substitutions of the GSUB table, such as alternates, contextual forms and ligatures whose components
+// are all in the set. The glyphs are returned sorted and without duplicates.
+// Components of composite glyphs are not included, those are resolved when subsetting.
+func (f *Font) GlyphClosure(indices []GlyphIndex) []GlyphIndex {
+	gids := make(map[GlyphIndex]bool, len(indices))
+	for _, gid := range indices {
+		gids[gid] = true
+	}
+	if f.gsub != nil {
+		f.gsub.closure(gids)
+	}
+
+	closure := make([]GlyphIndex, 0, len(gids))
+	for gid := range gids {
+		closure = append(closure, gid)
+	}
+	sort.Slice(closure, func(i, j int) bool {
+		return closure[i] < closure[j]
+	})
+	return closure
+}
@@ -0,0 +1,45 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlyphClosure(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	require.NotNil(t, fnt.gsub)
+
+	// f (75), i (78) expand to dotlessi (245) and the ligatures ff (2754), fi (2755) and ffi (2757).
+	// The ligature fl (2756) is not reachable without l.
+	closure := fnt.GlyphClosure([]GlyphIndex{78, 75, 78})
+	assert.Equal(t, []GlyphIndex{75, 78, 245, 2754, 2755, 2757}, closure)
+
+	subfnt, err := fnt.SubsetKeepRunesWithClosure([]rune("fi"))
+	require.NoError(t, err)
+	_, _, _, _, empty, err := subfnt.GlyphBBox(2755)
+	require.NoError(t, err)
+	assert.False(t, empty)
+	_, _, _, _, empty, err = subfnt.GlyphBBox(2756)
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	// Without the closure the ligatures are pruned (ffi is kept so that the glyph count is retained).
+	fnt, err = ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	subfnt, err = fnt.SubsetKeepIndices([]GlyphIndex{75, 78, 2757})
+	require.NoError(t, err)
+	_, _, _, _, empty, err = subfnt.GlyphBBox(2755)
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	require.NoError(t, fnt.PruneTables("GSUB"))
+	assert.Equal(t, []GlyphIndex{75, 78}, fnt.GlyphClosure([]GlyphIndex{78, 75}))
+}
@@ -0,0 +1,466 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"math"
+)
+
+// gvarTable represents the glyph variations (gvar) table of variable fonts with TrueType outlines.
+// The variation data is associated with each glyph and decoded on demand. The table itself is preserved
+// as a raw table and written out verbatim, unless the glyphs are subsetted in which case it is re-encoded
+// from the model.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/gvar
+type gvarTable struct {
+	axisCount    int
+	sharedTuples [][]f2dot14 // peak tuples referenced by index from the tuple variation headers.
+	glyphData    [][]byte    // GlyphVariationData per glyph, empty if the glyph has no variations.
+}
+
+// tupleVariation represents the variation deltas of a glyph, or of the control values in the cvar table,
+// for a region of the design space.
+type tupleVariation struct {
+	peak  []float64 // normalized peak coordinate per axis.
+	start []float64 // intermediate region start per axis, nil if not specified.
+	end   []float64 // intermediate region end per axis, nil if not specified.
+
+	points  []uint16 // point numbers the deltas apply to, nil for all points.
+	deltasX []int16
+	deltasY []int16 // nil for cvar deltas.
+}
+
+// Flags of the gvar table, GlyphVariationData and tuple variation headers.
+const (
+	gvarLongOffsets         = 0x0001
+	gvarSharedPointNumbers  = 0x8000
+	gvarTupleCountMask      = 0x0FFF
+	gvarEmbeddedPeakTuple   = 0x8000
+	gvarIntermediateRegion  = 0x4000
+	gvarPrivatePointNumbers = 0x2000
+	gvarTupleIndexMask      = 0x0FFF
+	gvarPointsAreWords      = 0x80
+	gvarPointRunCountMask   = 0x7F
+	gvarDeltasAreZero       = 0x80
+	gvarDeltasAreWords      = 0x40
+	gvarDeltaRunCountMask   = 0x3F
+)
+
+// parseGvar parses the gvar table from the data of the raw gvar table, if present.
+// Malformed gvar tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseGvar() *gvarTable {
+	data := f.rawTableData("gvar")
+	if data == nil {
+		logger.Debugf("gvar table absent")
+		return nil
+	}
+
+	t, err := parseGvarData(data)
+	if err != nil {
+		logger.Debugf("Error parsing gvar table: %v - ignoring", err)
+		return nil
+	}
+	if f.maxp != nil && int(f.maxp.numGlyphs) != len(t.glyphData) {
+		logger.Debugf("gvar glyph count mismatch: %d != %d", len(t.glyphData), f.maxp.numGlyphs)
+	}
+	return t
+}
+
+// parseGvarData parses gvar table `data`.
+func parseGvarData(data []byte) (*gvarTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var majorVersion, minorVersion, axisCount, sharedTupleCount uint16
+	var sharedTuplesOffset offset32
+	var glyphCount, flags uint16
+	var glyphVariationDataArrayOffset offset32
+	err := r.read(&majorVersion, &minorVersion, &axisCount, &sharedTupleCount, &sharedTuplesOffset,
+		&glyphCount, &flags, &glyphVariationDataArrayOffset)
+	if err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 {
+		logger.Debugf("Unsupported gvar version %d.%d", majorVersion, minorVersion)
+		return nil, errRangeCheck
+	}
+
+	offsets := make([]int64, int(glyphCount)+1)
+	for i := range offsets {
+		if flags&gvarLongOffsets != 0 {
+			var offset offset32
+			err = r.read(&offset)
+			offsets[i] = int64(offset)
+		} else {
+			var offset offset16
+			err = r.read(&offset)
+			offsets[i] = 2 * int64(offset)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t := &gvarTable{
+		axisCount: int(axisCount),
+	}
+	if int64(sharedTuplesOffset)+2*int64(sharedTupleCount)*int64(axisCount) > int64(len(data)) {
+		logger.Debugf("gvar shared tuples out of range")
+		return nil, errRangeCheck
+	}
+	err = r.SeekTo(int64(sharedTuplesOffset))
+	if err != nil {
+		return nil, err
+	}
+	t.sharedTuples = make([][]f2dot14, sharedTupleCount)
+	for i := range t.sharedTuples {
+		t.sharedTuples[i] = make([]f2dot14, axisCount)
+		for j := range t.sharedTuples[i] {
+			err = r.read(&t.sharedTuples[i][j])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	base := int64(glyphVariationDataArrayOffset)
+	t.glyphData = make([][]byte, glyphCount)
+	for i := range t.glyphData {
+		start, end := base+offsets[i], base+offsets[i+1]
+		if end < start || end > int64(len(data)) {
+			logger.Debugf("gvar data of glyph %d out of range", i)
+			return nil, errRangeCheck
+		}
+		t.glyphData[i] = data[start:end]
+	}
+	return t, nil
+}
+
+// glyphVariations decodes the tuple variations of glyph `gid` with `numPoints` points, including the
+// phantom points. Returns nil if the glyph has no variations.
+func (t *gvarTable) glyphVariations(gid GlyphIndex, numPoints int) ([]tupleVariation, error) {
+	if int(gid) >= len(t.glyphData) {
+		logger.Debugf("GID out of range: %d >= %d", gid, len(t.glyphData))
+		return nil, errRangeCheck
+	}
+	data := t.glyphData[gid]
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return parseTupleVariations(data, 0, t.axisCount, t.sharedTuples, numPoints, true)
+}
+
+// parseTupleVariations decodes the tuple variation store in `data` with the tuple variation count at
+// `start` and the data offset relative to the start of `data`, as used by the gvar and cvar tables.
+// The deltas apply to `numPoints` points and have y deltas if `hasY` is true.
+func parseTupleVariations(data []byte, start int, axisCount int, sharedTuples [][]f2dot14, numPoints int,
+	hasY bool) ([]tupleVariation, error) {
+	r := newByteReader(bytes.NewReader(data))
+	err := r.SeekTo(int64(start))
+	if err != nil {
+		return nil, err
+	}
+	var tupleVariationCount uint16
+	var dataOffset offset16
+	err = r.read(&tupleVariationCount, &dataOffset)
+	if err != nil {
+		return nil, err
+	}
+	if int(dataOffset) > len(data) {
+		logger.Debugf("Tuple variation serialized data out of range")
+		return nil, errRangeCheck
+	}
+
+	serialized := data[dataOffset:]
+	var sharedPoints []uint16
+	if tupleVariationCount&gvarSharedPointNumbers != 0 {
+		var n int
+		sharedPoints, n, err = parsePackedPointNumbers(serialized)
+		if err != nil {
+			return nil, err
+		}
+		serialized = serialized[n:]
+	}
+
+	count := int(tupleVariationCount & gvarTupleCountMask)
+	variations := make([]tupleVariation, count)
+	for i := range variations {
+		tv := &variations[i]
+		var variationDataSize, tupleIndex uint16
+		err = r.read(&variationDataSize, &tupleIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		readTuple := func() ([]float64, error) {
+			tuple := make([]float64, axisCount)
+			for j := range tuple {
+				var v f2dot14
+				err := r.read(&v)
+				if err != nil {
+					return nil, err
+				}
+				tuple[j] = v.Float64()
+			}
+			return tuple, nil
+		}
+		if tupleIndex&gvarEmbeddedPeakTuple != 0 {
+			tv.peak, err = readTuple()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			index := int(tupleIndex & gvarTupleIndexMask)
+			if index >= len(sharedTuples) {
+				logger.Debugf("Shared tuple index out of range: %d", index)
+				return nil, errRangeCheck
+			}
+			tv.peak = make([]float64, axisCount)
+			for j, v := range sharedTuples[index] {
+				tv.peak[j] = v.Float64()
+			}
+		}
+		if tupleIndex&gvarIntermediateRegion != 0 {
+			tv.start, err = readTuple()
+			if err != nil {
+				return nil, err
+			}
+			tv.end, err = readTuple()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if int(variationDataSize) > len(serialized) {
+			logger.Debugf("Tuple variation data out of range")
+			return nil, errRangeCheck
+		}
+		vdata := serialized[:variationDataSize]
+		serialized = serialized[variationDataSize:]
+
+		tv.points = sharedPoints
+		if tupleIndex&gvarPrivatePointNumbers != 0 {
+			var n int
+			tv.points, n, err = parsePackedPointNumbers(vdata)
+			if err != nil {
+				return nil, err
+			}
+			vdata = vdata[n:]
+		}
+		numDeltas := numPoints
+		if tv.points != nil {
+			numDeltas = len(tv.points)
+		}
+		if !hasY {
+			tv.deltasX, _, err = parsePackedDeltas(vdata, numDeltas)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		deltas, _, err := parsePackedDeltas(vdata, 2*numDeltas)
+		if err != nil {
+			return nil, err
+		}
+		tv.deltasX = deltas[:numDeltas]
+		tv.deltasY = deltas[numDeltas:]
+	}
+	return variations, nil
+}
+
+// region returns the region of the design space of `tv`. Without explicit intermediate coordinates the
+// region spans from 0 to the peak along each axis.
+func (tv *tupleVariation) region() []regionAxis {
+	region := make([]regionAxis, len(tv.peak))
+	for i, peak := range tv.peak {
+		ra := regionAxis{start: math.Min(peak, 0), peak: peak, end: math.Max(peak, 0)}
+		if tv.start != nil && tv.end != nil && i < len(tv.start) && i < len(tv.end) {
+			ra.start, ra.end = tv.start[i], tv.end[i]
+		}
+		region[i] = ra
+	}
+	return region
+}
+
+// parsePackedPointNumbers parses the packed point numbers at the start of `data`. Returns nil for all
+// points and the number of bytes consumed.
+func parsePackedPointNumbers(data []byte) ([]uint16, int, error) {
+	if len(data) < 1 {
+		return nil, 0, errRangeCheck
+	}
+	count := int(data[0])
+	i := 1
+	if count&gvarPointsAreWords != 0 {
+		if len(data) < 2 {
+			return nil, 0, errRangeCheck
+		}
+		count = (count&gvarPointRunCountMask)<<8 | int(data[1])
+		i = 2
+	}
+	if count == 0 {
+		return nil, i, nil
+	}
+
+	points := make([]uint16, 0, count)
+	var point uint16
+	for len(points) < count {
+		if i >= len(data) {
+			return nil, 0, errRangeCheck
+		}
+		control := data[i]
+		i++
+		runCount := int(control&gvarPointRunCountMask) + 1
+		for j := 0; j < runCount && len(points) < count; j++ {
+			if control&gvarPointsAreWords != 0 {
+				if i+2 > len(data) {
+					return nil, 0, errRangeCheck
+				}
+				point += uint16(data[i])<<8 | uint16(data[i+1])
+				i += 2
+			} else {
+				if i >= len(data) {
+					return nil, 0, errRangeCheck
+				}
+				point += uint16(data[i])
+				i++
+			}
+			points = append(points, point)
+		}
+	}
+	return points, i, nil
+}
+
+// parsePackedDeltas parses `count` packed deltas at the start of `data`. Returns the deltas and the
+// number of bytes consumed.
+func parsePackedDeltas(data []byte, count int) ([]int16, int, error) {
+	deltas := make([]int16, 0, count)
+	i := 0
+	for len(deltas) < count {
+		if i >= len(data) {
+			logger.Debugf("Packed deltas out of range")
+			return nil, 0, errRangeCheck
+		}
+		control := data[i]
+		i++
+		runCount := int(control&gvarDeltaRunCountMask) + 1
+		for j := 0; j < runCount && len(deltas) < count; j++ {
+			switch {
+			case control&gvarDeltasAreZero != 0:
+				deltas = append(deltas, 0)
+			case control&gvarDeltasAreWords != 0:
+				if i+2 > len(data) {
+					return nil, 0, errRangeCheck
+				}
+				deltas = append(deltas, int16(uint16(data[i])<<8|uint16(data[i+1])))
+				i += 2
+			default:
+				if i >= len(data) {
+					return nil, 0, errRangeCheck
+				}
+				deltas = append(deltas, int16(int8(data[i])))
+				i++
+			}
+		}
+	}
+	return deltas, i, nil
+}
+
+// encode returns the data of gvar table `t`. The glyph variation data is kept as is, padded to an even
+// length so that short offsets can be used when the data is small enough.
+func (t *gvarTable) encode() []byte {
+	size := 0
+	for _, gd := range t.glyphData {
+		size += len(gd) + len(gd)%2
+	}
+	long := size/2 > 0xFFFF
+	offsetSize := 2
+	var flags uint16
+	if long {
+		offsetSize = 4
+		flags = gvarLongOffsets
+	}
+
+	sharedTuplesOffset := 20 + offsetSize*(len(t.glyphData)+1)
+	dataArrayOffset := sharedTuplesOffset + 2*t.axisCount*len(t.sharedTuples)
+
+	b := make([]byte, 0, dataArrayOffset+size)
+	b = appendUint16(b, 1, 0, uint16(t.axisCount), uint16(len(t.sharedTuples)))
+	b = appendUint32(b, uint32(sharedTuplesOffset))
+	b = appendUint16(b, uint16(len(t.glyphData)), flags)
+	b = appendUint32(b, uint32(dataArrayOffset))
+	offset := 0
+	appendOffset := func() {
+		if long {
+			b = appendUint32(b, uint32(offset))
+		} else {
+			b = appendUint16(b, uint16(offset/2))
+		}
+	}
+	appendOffset()
+	for _, gd := range t.glyphData {
+		offset += len(gd) + len(gd)%2
+		appendOffset()
+	}
+	for _, tuple := range t.sharedTuples {
+		for _, v := range tuple {
+			b = appendUint16(b, uint16(v))
+		}
+	}
+	for _, gd := range t.glyphData {
+		b = append(b, gd...)
+		if len(gd)%2 != 0 {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// selectGlyphs returns a copy of `t` with only the variation data of the glyphs `gids` in that order.
+// Glyphs out of range get no variations.
+func (t *gvarTable) selectGlyphs(gids []GlyphIndex) *gvarTable {
+	newt := *t
+	newt.glyphData = make([][]byte, len(gids))
+	for i, gid := range gids {
+		if int(gid) < len(t.glyphData) {
+			newt.glyphData[i] = t.glyphData[gid]
+		}
+	}
+	return &newt
+}
+
+// stubGlyphs returns a copy of `t` without the variations of the glyphs for which `keep` returns false.
+// The GIDs are maintained.
+func (t *gvarTable) stubGlyphs(keep func(gid GlyphIndex) bool) *gvarTable {
+	newt := *t
+	newt.glyphData = make([][]byte, len(t.glyphData))
+	for i, gd := range t.glyphData {
+		if keep(GlyphIndex(i)) {
+			newt.glyphData[i] = gd
+		}
+	}
+	return &newt
+}
+
+// setGvar sets the gvar table of `f` to `t` and replaces the raw gvar table by the encoding of `t`.
+func (f *font) setGvar(t *gvarTable) {
+	f.setRawTableData("gvar", t.encode())
+	f.gvar = t
+}
+
+// appendUint16 appends the big endian encoding of `values` to `b`.
+func appendUint16(b []byte, values ...uint16) []byte {
+	for _, v := range values {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// appendUint32 appends the big endian encoding of `values` to `b`.
+func appendUint32(b []byte, values ...uint32) []byte {
+	for _, v := range values {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return b
+}
@@ -0,0 +1,140 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestGlyphVariationData returns the GlyphVariationData of a glyph with two tuple variations for two
+// axes: the first uses shared tuple 0 and the shared points 0, 2 and 3, the second has an embedded peak,
+// an intermediate region and private point numbers denoting all points (see testGlyphVariations).
+func buildTestGlyphVariationData() []byte {
+	sharedPoints := []byte{3, 0x02, 0, 2, 1}
+	deltas1 := []byte{0x01, 10, 0xFB, 0x40, 0x01, 0x2C, 0x82}
+	deltas2 := []byte{0, 0x03, 1, 2, 3, 0xFC, 0x83}
+
+	buf, write := testWriter()
+	write(uint16(gvarSharedPointNumbers|2), uint16(4+4+16))
+	write(uint16(len(deltas1)), uint16(0))
+	write(uint16(len(deltas2)), uint16(gvarEmbeddedPeakTuple|gvarIntermediateRegion|gvarPrivatePointNumbers))
+	write(int16(0x2000), int16(0x4000), int16(0), int16(0), int16(0x4000), int16(0x4000))
+	write(sharedPoints, deltas1, deltas2)
+	return buf.Bytes()
+}
+
+// testGlyphVariations are the variations of buildTestGlyphVariationData for a glyph with 4 points.
+var testGlyphVariations = []tupleVariation{
+	{
+		peak:    []float64{1, 0},
+		points:  []uint16{0, 2, 3},
+		deltasX: []int16{10, -5, 300},
+		deltasY: []int16{0, 0, 0},
+	},
+	{
+		peak:    []float64{0.5, 1},
+		start:   []float64{0, 0},
+		end:     []float64{1, 1},
+		deltasX: []int16{1, 2, 3, -4},
+		deltasY: []int16{0, 0, 0, 0},
+	},
+}
+
+func TestGvarTable(t *testing.T) {
+	gvar := &gvarTable{
+		axisCount:    2,
+		sharedTuples: [][]f2dot14{{0x4000, 0}, {0, -0x4000}},
+		glyphData:    [][]byte{nil, buildTestGlyphVariationData(), nil, {0, 0, 0, 4}},
+	}
+	parsed, err := parseGvarData(gvar.encode())
+	require.NoError(t, err)
+	assert.Equal(t, 2, parsed.axisCount)
+	assert.Equal(t, gvar.sharedTuples, parsed.sharedTuples)
+	require.Len(t, parsed.glyphData, 4)
+	assert.Empty(t, parsed.glyphData[0])
+
+	tvs, err := parsed.glyphVariations(1, 4)
+	require.NoError(t, err)
+	assert.Equal(t, testGlyphVariations, tvs)
+	tvs, err = parsed.glyphVariations(0, 4)
+	require.NoError(t, err)
+	assert.Nil(t, tvs)
+	tvs, err = parsed.glyphVariations(3, 4)
+	require.NoError(t, err)
+	assert.Empty(t, tvs)
+	_, err = parsed.glyphVariations(4, 4)
+	assert.Error(t, err)
+
+	// Too many points for the deltas.
+	_, err = parsed.glyphVariations(1, 5)
+	assert.Error(t, err)
+
+	// Long offsets for large data.
+	gvar.glyphData = append(gvar.glyphData, make([]byte, 0x20000))
+	data := gvar.encode()
+	assert.Equal(t, uint16(gvarLongOffsets), uint16(data[15]))
+	parsed, err = parseGvarData(data)
+	require.NoError(t, err)
+	assert.Len(t, parsed.glyphData[4], 0x20000)
+	tvs, err = parsed.glyphVariations(1, 4)
+	require.NoError(t, err)
+	assert.Equal(t, testGlyphVariations, tvs)
+
+	_, err = parseGvarData(data[:len(data)-1])
+	assert.Error(t, err)
+}
+
+func TestPackedPointNumbers(t *testing.T) {
+	testcases := []struct {
+		data     []byte
+		expected []uint16
+		n        int
+	}{
+		{[]byte{0}, nil, 1},
+		{[]byte{2, 0x01, 3, 4}, []uint16{3, 7}, 4},
+		{[]byte{0x80, 3, 0x80, 0x01, 0x00, 0x01, 5, 1}, []uint16{256, 261, 262}, 8},
+	}
+	for i, tcase := range testcases {
+		points, n, err := parsePackedPointNumbers(tcase.data)
+		require.NoError(t, err, "case %d", i)
+		assert.Equal(t, tcase.expected, points, "case %d", i)
+		assert.Equal(t, tcase.n, n, "case %d", i)
+	}
+	_, _, err := parsePackedPointNumbers([]byte{2, 0x01, 3})
+	assert.Error(t, err)
+}
+
+func TestSubsetVariableFont(t *testing.T) {
+	fnt := buildTestVariableFont(t, 10)
+
+	subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{3})
+	require.NoError(t, err)
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	subfnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, subfnt.gvar)
+	require.Len(t, subfnt.gvar.glyphData, 4)
+	assert.Empty(t, subfnt.gvar.glyphData[1])
+	assert.Equal(t, fnt.gvar.glyphData[3], subfnt.gvar.glyphData[3])
+	assert.Equal(t, fnt.Axes(), subfnt.Axes())
+
+	subfnt, oldnew, err := fnt.Subset([]GlyphIndex{1, 5})
+	require.NoError(t, err)
+	data, err = subfnt.Bytes()
+	require.NoError(t, err)
+	subfnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, subfnt.gvar)
+	require.Len(t, subfnt.gvar.glyphData, 3)
+	assert.Equal(t, fnt.gvar.glyphData[1], subfnt.gvar.glyphData[oldnew[1]])
+	assert.Empty(t, subfnt.gvar.glyphData[oldnew[5]])
+	assert.Equal(t, fnt.Axes(), subfnt.Axes())
+	assert.Equal(t, fnt.rawTableData("avar"), subfnt.rawTableData("avar"))
+}
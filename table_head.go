@@ -7,8 +7,7 @@ package unitype
 
 import (
 	"errors"
-
-	"github.com/sirupsen/logrus"
+	"fmt"
 )
 
 // Font header.
@@ -34,10 +33,19 @@ type headTable struct {
 	glyphDataFormat    int16
 }
 
+// Clone returns a copy of `t`.
+func (t *headTable) Clone() *headTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	return &dup
+}
+
 // parse the font's *head* table from `r` in the context of `f`.
 // TODO(gunnsth): Read the table as bytes first and then process? Probably easier in terms of checksumming etc.
 func (f *font) parseHead(r *byteReader) (*headTable, error) {
-	_, has, err := f.seekToTable(r, "head")
+	tr, has, err := f.seekToTable(r, "head")
 	if err != nil {
 		return nil, err
 	}
@@ -57,8 +65,13 @@ func (f *font) parseHead(r *byteReader) (*headTable, error) {
 		return nil, err
 	}
 	if t.magicNumber != 0x5F0F3CF5 {
-		logrus.Debugf("Error: got magic number 0x%X", t.magicNumber)
-		return nil, errors.New("magic number mismatch")
+		logger.Debugf("Error: got magic number 0x%X", t.magicNumber)
+		if !f.opts.Lenient {
+			return nil, errors.New("magic number mismatch")
+		}
+		// Tolerated as the table is required, see Font.Repair.
+		f.parseWarnings = append(f.parseWarnings, ParseWarning{Tag: "head",
+			Err: wrapParseError("head", int64(tr.offset)+12, fmt.Errorf("magic number mismatch (0x%X)", t.magicNumber))})
 	}
 
 	err = r.read(&t.flags, &t.unitsPerEm, &t.created, &t.modified)
@@ -91,3 +104,36 @@ func (f *font) writeHead(w *byteWriter) error {
 
 	return w.write(t.macStyle, t.lowestRecPPEM, t.fontDirectionHint, t.indexToLocFormat, t.glyphDataFormat)
 }
+
+// updateHeadBBox recomputes the global bounding box in the head table from the glyphs in the glyf table.
+// Composite glyphs are resolved from their components. Glyphs that cannot be parsed are skipped.
+// If no glyph has an outline, the bounding box is set to (0,0,0,0).
+func (f *font) updateHeadBBox() {
+	if f.head == nil || f.glyf == nil {
+		return
+	}
+
+	var bbox glyphBounds
+	nonEmpty := false
+	for i := range f.glyf.descs {
+		b, has, err := f.glyf.bounds(GlyphIndex(i), 0)
+		if err != nil {
+			logger.Debugf("Unable to get bounds of glyph %d: %v - skipping", i, err)
+			continue
+		}
+		if !has {
+			continue
+		}
+		if !nonEmpty {
+			bbox, nonEmpty = b, true
+			continue
+		}
+		bbox = bbox.union(b)
+	}
+
+	if !nonEmpty {
+		f.head.xMin, f.head.yMin, f.head.xMax, f.head.yMax = 0, 0, 0, 0
+		return
+	}
+	f.head.xMin, f.head.yMin, f.head.xMax, f.head.yMax = bbox.rounded()
+}
@@ -5,10 +5,6 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 // hheaTable represents the horizontal header table (hhea).
 // This table contains information for horizontal layout.
 // https://docs.microsoft.com/en-us/typography/opentype/spec/hhea
@@ -29,13 +25,22 @@ type hheaTable struct {
 	numberOfHMetrics    uint16 // Number of hMetric entries in 'hmtx' table.
 }
 
+// Clone returns a copy of `t`.
+func (t *hheaTable) Clone() *hheaTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	return &dup
+}
+
 func (f *font) parseHhea(r *byteReader) (*hheaTable, error) {
 	_, has, err := f.seekToTable(r, "hhea")
 	if err != nil {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("hhea table absent")
+		logger.Debugf("hhea table absent")
 		return nil, nil
 	}
 
@@ -71,7 +76,7 @@ func (f *font) parseHhea(r *byteReader) (*hheaTable, error) {
 
 func (f *font) writeHhea(w *byteWriter) error {
 	if f.hhea == nil {
-		logrus.Debug("hhea is nil - nothing to write")
+		logger.Debugf("hhea is nil - nothing to write")
 		return nil
 	}
 
@@ -102,5 +107,93 @@ func (f *font) writeHhea(w *byteWriter) error {
 		return err
 	}
 
-	return w.write(t.metricDataFormat, t.numberOfHMetrics)
+	// The number of metrics is that of the hmtx table written, which may have been optimized since.
+	numberOfHMetrics := t.numberOfHMetrics
+	if f.hmtx != nil {
+		numberOfHMetrics = uint16(len(f.hmtx.hMetrics))
+	}
+	return w.write(t.metricDataFormat, numberOfHMetrics)
+}
+
+// hheaAggregates holds the values of the hhea table that are aggregated from the hmtx and glyf tables.
+type hheaAggregates struct {
+	advanceWidthMax     ufword
+	minLeftSideBearing  fword
+	minRightSideBearing fword
+	xMaxExtent          fword
+}
+
+// computeHheaAggregates computes the aggregate values of the hhea table from the horizontal metrics and the
+// glyph bounding boxes. Only glyphs with contours are accounted for in the side bearings and extent.
+// Returns false if the hmtx table is missing. When the glyf table is missing, only the maximum advance width
+// is computed and the other values are taken from the current hhea table.
+func (f *font) computeHheaAggregates() (hheaAggregates, bool) {
+	if f.hmtx == nil {
+		return hheaAggregates{}, false
+	}
+
+	var agg hheaAggregates
+	if f.hhea != nil {
+		agg.minLeftSideBearing = f.hhea.minLeftSideBearing
+		agg.minRightSideBearing = f.hhea.minRightSideBearing
+		agg.xMaxExtent = f.hhea.xMaxExtent
+	}
+	if f.glyf != nil {
+		agg.minLeftSideBearing, agg.minRightSideBearing, agg.xMaxExtent = 0, 0, 0
+	}
+
+	hasContours := false
+	for i := 0; i < f.hmtx.numGlyphs(); i++ {
+		gid := GlyphIndex(i)
+		lhm := f.hmtx.getMetric(gid)
+		if ufword(lhm.advanceWidth) > agg.advanceWidthMax {
+			agg.advanceWidthMax = ufword(lhm.advanceWidth)
+		}
+		if f.glyf == nil || i >= len(f.glyf.descs) {
+			continue
+		}
+
+		b, has, err := f.glyf.bounds(gid, 0)
+		if err != nil {
+			logger.Debugf("Unable to get bounds of glyph %d: %v - skipping", gid, err)
+			continue
+		}
+		if !has {
+			continue
+		}
+		xMin, _, xMax, _ := b.rounded()
+		lsb := int(lhm.lsb)
+		rsb := int(lhm.advanceWidth) - (lsb + int(xMax) - int(xMin))
+		extent := lsb + int(xMax) - int(xMin)
+		if !hasContours {
+			agg.minLeftSideBearing, agg.minRightSideBearing, agg.xMaxExtent = fword(lsb), fword(rsb), fword(extent)
+			hasContours = true
+			continue
+		}
+		if fword(lsb) < agg.minLeftSideBearing {
+			agg.minLeftSideBearing = fword(lsb)
+		}
+		if fword(rsb) < agg.minRightSideBearing {
+			agg.minRightSideBearing = fword(rsb)
+		}
+		if fword(extent) > agg.xMaxExtent {
+			agg.xMaxExtent = fword(extent)
+		}
+	}
+	return agg, true
+}
+
+// recomputeHhea updates the aggregate values of the hhea table from the hmtx and glyf tables.
+func (f *font) recomputeHhea() {
+	if f.hhea == nil {
+		return
+	}
+	agg, ok := f.computeHheaAggregates()
+	if !ok {
+		return
+	}
+	f.hhea.advanceWidthMax = agg.advanceWidthMax
+	f.hhea.minLeftSideBearing = agg.minLeftSideBearing
+	f.hhea.minRightSideBearing = agg.minRightSideBearing
+	f.hhea.xMaxExtent = agg.xMaxExtent
 }
@@ -5,24 +5,35 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 type hmtxTable struct {
 	hMetrics         []longHorMetric // length is numberOfHMetrics from hhea table.
 	leftSideBearings []int16         // length is (numGlyphs - numberOfHmetrics) from maxp and hhea tables.
 }
 
+// Clone returns a deep copy of `t`.
+func (t *hmtxTable) Clone() *hmtxTable {
+	if t == nil {
+		return nil
+	}
+	return &hmtxTable{
+		hMetrics:         append([]longHorMetric(nil), t.hMetrics...),
+		leftSideBearings: append([]int16(nil), t.leftSideBearings...),
+	}
+}
+
 type longHorMetric struct {
 	advanceWidth uint16
 	lsb          int16
 }
 
 func (f *font) parseHmtx(r *byteReader) (*hmtxTable, error) {
-	if f.maxp == nil || f.hhea == nil {
-		logrus.Debug("maxp or hhea table missing")
-		return nil, errRequiredField
+	if f.maxp == nil {
+		logger.Debugf("maxp table missing")
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
+	}
+	if f.hhea == nil {
+		logger.Debugf("hhea table missing")
+		return nil, ErrRequiredTableMissing{Tag: "hhea"}
 	}
 
 	_, has, err := f.seekToTable(r, "hmtx")
@@ -30,7 +41,7 @@ func (f *font) parseHmtx(r *byteReader) (*hmtxTable, error) {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("hmtx table absent")
+		logger.Debugf("hmtx table absent")
 		return nil, nil
 	}
 
@@ -60,6 +71,9 @@ func (f *font) parseHmtx(r *byteReader) (*hmtxTable, error) {
 
 // optimizeHmtx optimizes the htmx table.
 func (f *font) optimizeHmtx() {
+	if f.hmtx == nil || f.hhea == nil {
+		return
+	}
 	i := len(f.hmtx.hMetrics) - 1
 	if i <= 0 {
 		return
@@ -83,6 +97,20 @@ func (f *font) optimizeHmtx() {
 	f.hmtx.hMetrics = f.hmtx.hMetrics[0 : j+2]
 }
 
+// expandHmtx stores the advance width of every glyph of `f` in hMetrics, undoing optimizeHmtx, for consumers that
+// mishandle glyphs sharing the advance width of the last entry.
+func (f *font) expandHmtx() {
+	if f.hmtx == nil || f.hhea == nil {
+		return
+	}
+	hMetrics := make([]longHorMetric, f.hmtx.numGlyphs())
+	for i := range hMetrics {
+		hMetrics[i] = f.hmtx.getMetric(GlyphIndex(i))
+	}
+	f.hmtx = &hmtxTable{hMetrics: hMetrics}
+	f.hhea.numberOfHMetrics = uint16(len(hMetrics))
+}
+
 // writeHmtx writes the font's hmtx table  to `w`.
 func (f *font) writeHmtx(w *byteWriter) error {
 	if f.hmtx == nil || f.hhea == nil {
@@ -98,3 +126,25 @@ func (f *font) writeHmtx(w *byteWriter) error {
 
 	return w.writeSlice(f.hmtx.leftSideBearings)
 }
+
+// getMetric returns the horizontal metric of glyph `gid`. Glyphs beyond numberOfHMetrics share the
+// advance width of the last entry in hMetrics.
+func (t *hmtxTable) getMetric(gid GlyphIndex) longHorMetric {
+	if int(gid) < len(t.hMetrics) {
+		return t.hMetrics[gid]
+	}
+
+	var lhm longHorMetric
+	if len(t.hMetrics) > 0 {
+		lhm.advanceWidth = t.hMetrics[len(t.hMetrics)-1].advanceWidth
+	}
+	if i := int(gid) - len(t.hMetrics); i < len(t.leftSideBearings) {
+		lhm.lsb = t.leftSideBearings[i]
+	}
+	return lhm
+}
+
+// numGlyphs returns the number of glyphs covered by the hmtx table.
+func (t *hmtxTable) numGlyphs() int {
+	return len(t.hMetrics) + len(t.leftSideBearings)
+}
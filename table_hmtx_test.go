@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOptimizeHmtxTable(t *testing.T) {
@@ -128,3 +129,66 @@ func TestOptimizeHmtxTable(t *testing.T) {
 		assert.Equal(t, tcase.exphMetrics, tcase.fnt.hmtx.hMetrics)
 	}
 }
+
+func TestSubsetHmtxRoundTrip(t *testing.T) {
+	testcases := []struct {
+		fontPath string
+		runes    []rune
+	}{
+		{"./testdata/FreeSans.ttf", []rune("Héllo wörld ÅŒ")},
+		{"./testdata/roboto/Roboto-BoldItalic.ttf", []rune("Héllo wörld ÅŒ")},
+		{"./testdata/wts11.ttf", []rune("中文字体")},
+	}
+	for _, tcase := range testcases {
+		t.Run(tcase.fontPath, func(t *testing.T) {
+			fnt, err := ParseFile(tcase.fontPath)
+			require.NoError(t, err)
+			gids, _ := fnt.LookupRunes(tcase.runes)
+
+			for _, opts := range []SubsetOptions{
+				{},
+				{NoHmtxOptimization: true},
+				{RetainGIDs: true, IncludeNotdef: true},
+				{RetainGIDs: true, IncludeNotdef: true, NoHmtxOptimization: true},
+			} {
+				subfnt, oldnew, err := fnt.SubsetWithOptions(gids, opts)
+				require.NoError(t, err)
+				data, err := subfnt.Bytes()
+				require.NoError(t, err)
+				written, err := ParseBytes(data)
+				require.NoError(t, err)
+
+				numGlyphs := int(written.maxp.numGlyphs)
+				assert.Equal(t, len(written.hmtx.hMetrics), int(written.hhea.numberOfHMetrics))
+				if opts.NoHmtxOptimization {
+					assert.Equal(t, numGlyphs, int(written.hhea.numberOfHMetrics))
+				}
+				// The advances of all glyphs are unchanged, including those of the glyphs emptied.
+				for oldgid, newgid := range oldnew {
+					assert.Equal(t, advanceWidth(fnt.font, int(oldgid)), advanceWidth(written.font, int(newgid)))
+				}
+				if opts.RetainGIDs {
+					for gid := 0; gid < numGlyphs; gid++ {
+						assert.Equal(t, advanceWidth(fnt.font, gid), advanceWidth(written.font, gid))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteHheaNumberOfHMetrics(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	// The number of metrics written is that of the hmtx table regardless of hhea.
+	fnt.hhea.numberOfHMetrics = 1
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	written, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(fnt.hmtx.hMetrics), int(written.hhea.numberOfHMetrics))
+	for gid := 0; gid < int(fnt.maxp.numGlyphs); gid++ {
+		assert.Equal(t, advanceWidth(fnt.font, gid), advanceWidth(written.font, gid))
+	}
+}
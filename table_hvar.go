@@ -0,0 +1,76 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// hvarTable represents the horizontal metrics variations (HVAR) table, or the vertical metrics variations
+// (VVAR) table which starts out the same, holding the variation deltas of the glyph advances. Only the
+// advance deltas are modelled. The table is parsed on demand when instancing variable fonts, otherwise it
+// is preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/hvar
+type hvarTable struct {
+	store      *itemVariationStore
+	advanceMap *deltaSetIndexMap // nil if the glyph IDs map directly to the items of the first delta set.
+}
+
+// parseHvar parses the raw HVAR or VVAR table `name` of `f`. Returns nil if the table is absent.
+func (f *font) parseHvar(name string) (*hvarTable, error) {
+	data := f.rawTableData(name)
+	if data == nil {
+		return nil, nil
+	}
+	t, err := parseHvarData(name, data)
+	if err != nil {
+		logger.Debugf("Error parsing %s table: %v", name, err)
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseHvarData parses the data `data` of the HVAR or VVAR table `name`.
+func parseHvarData(name string, data []byte) (*hvarTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var majorVersion, minorVersion uint16
+	var storeOffset, advanceMapOffset offset32
+	err := r.read(&majorVersion, &minorVersion, &storeOffset, &advanceMapOffset)
+	if err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 {
+		logger.Debugf("Unsupported HVAR/VVAR version %d.%d", majorVersion, minorVersion)
+		return nil, errRangeCheck
+	}
+	if storeOffset == 0 {
+		logger.Debugf("%s without ItemVariationStore", name)
+		return nil, ErrRequiredTableMissing{Tag: name}
+	}
+
+	t := &hvarTable{}
+	t.store, err = parseItemVariationStore(data, int64(storeOffset))
+	if err != nil {
+		return nil, err
+	}
+	if advanceMapOffset != 0 {
+		t.advanceMap, err = parseDeltaSetIndexMap(data, int64(advanceMapOffset))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// advanceDelta returns the delta of the advance of glyph `gid` at the normalized coordinates `coords`.
+func (t *hvarTable) advanceDelta(gid GlyphIndex, coords []float64) float64 {
+	outer, inner := uint16(0), uint16(gid)
+	if t.advanceMap != nil {
+		outer, inner = t.advanceMap.lookup(int(gid))
+	}
+	return t.store.delta(outer, inner, coords)
+}
@@ -0,0 +1,262 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// kernTable represents the legacy kerning (kern) table.
+// Both the Microsoft (version 0) and the Apple (version 1.0) table headers are supported. Only format 0
+// subtables are decoded, subtables of other formats are kept as raw data. The table itself is preserved
+// as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/kern
+// https://developer.apple.com/fonts/TrueType-Reference-Manual/RM06/Chap6kern.html
+type kernTable struct {
+	version   uint32 // 0 (Microsoft) or 0x00010000 (Apple).
+	subtables []*kernSubtable
+}
+
+type kernSubtable struct {
+	format      uint8
+	horizontal  bool
+	minimum     bool // values are minimums rather than kerning values.
+	crossStream bool
+	override    bool // value replaces the accumulated value rather than adding to it.
+	variation   bool // Apple variation kerning, requires a tuple index.
+
+	pairs []kernPair // format 0, sorted by left and right glyph.
+	raw   []byte     // subtable data including header.
+}
+
+type kernPair struct {
+	left  GlyphIndex
+	right GlyphIndex
+	value int16
+}
+
+// parseKern parses the kern table from the data of the raw kern table, if present.
+// Malformed kern tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseKern() *kernTable {
+	data := f.rawTableData("kern")
+	if data == nil {
+		logger.Debugf("kern table absent")
+		return nil
+	}
+
+	t, err := parseKernData(data)
+	if err != nil {
+		logger.Debugf("Error parsing kern table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseKernData parses kern table `data`.
+func parseKernData(data []byte) (*kernTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var version uint16
+	err := r.read(&version)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &kernTable{}
+	var numTables uint32
+	var headerLen int64
+	switch version {
+	case 0:
+		var n uint16
+		err = r.read(&n)
+		numTables = uint32(n)
+		headerLen = 6
+	case 1:
+		var minor uint16
+		err = r.read(&minor, &numTables)
+		t.version = 0x00010000
+		headerLen = 8
+	default:
+		logger.Debugf("Unsupported kern table version: %d", version)
+		return nil, errRangeCheck
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	offset := r.Offset()
+	for i := 0; i < int(numTables); i++ {
+		if offset+headerLen > int64(len(data)) {
+			logger.Debugf("kern subtable %d out of range", i)
+			return nil, errRangeCheck
+		}
+		err = r.SeekTo(offset)
+		if err != nil {
+			return nil, err
+		}
+
+		st := &kernSubtable{}
+		var length int64
+		if t.version == 0 {
+			var stversion, stlength, coverage uint16
+			err = r.read(&stversion, &stlength, &coverage)
+			length = int64(stlength)
+			st.format = uint8(coverage >> 8)
+			st.horizontal = coverage&0x01 != 0
+			st.minimum = coverage&0x02 != 0
+			st.crossStream = coverage&0x04 != 0
+			st.override = coverage&0x08 != 0
+		} else {
+			var stlength uint32
+			var coverage, tupleIndex uint16
+			err = r.read(&stlength, &coverage, &tupleIndex)
+			length = int64(stlength)
+			st.format = uint8(coverage)
+			st.horizontal = coverage&0x8000 == 0
+			st.crossStream = coverage&0x4000 != 0
+			st.variation = coverage&0x2000 != 0
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if st.format == 0 {
+			var nPairs, searchRange, entrySelector, rangeShift uint16
+			err = r.read(&nPairs, &searchRange, &entrySelector, &rangeShift)
+			if err != nil {
+				return nil, err
+			}
+			// The 16-bit length of Microsoft subtables overflows for large subtables, the number of
+			// pairs is more reliable.
+			length = headerLen + 8 + 6*int64(nPairs)
+			if offset+length > int64(len(data)) {
+				logger.Debugf("kern subtable %d pairs out of range", i)
+				return nil, errRangeCheck
+			}
+
+			st.pairs = make([]kernPair, nPairs)
+			for j := range st.pairs {
+				var left, right uint16
+				var value int16
+				err = r.read(&left, &right, &value)
+				if err != nil {
+					return nil, err
+				}
+				st.pairs[j] = kernPair{left: GlyphIndex(left), right: GlyphIndex(right), value: value}
+			}
+			sort.Slice(st.pairs, func(i, j int) bool {
+				return st.pairs[i].less(st.pairs[j])
+			})
+		} else {
+			logger.Debugf("kern subtable format %d not supported - keeping as is", st.format)
+		}
+
+		if length < headerLen || offset+length > int64(len(data)) {
+			logger.Debugf("kern subtable %d length out of range", i)
+			return nil, errRangeCheck
+		}
+		st.raw = data[offset : offset+length]
+		t.subtables = append(t.subtables, st)
+		offset += length
+	}
+	return t, nil
+}
+
+// scaledData returns the data of `t` with the values of the format 0 subtables mapped by `scale`. The other
+// subtables are kept as is.
+func (t *kernTable) scaledData(scale func(v int16) int16) []byte {
+	var buf bytes.Buffer
+	w := newByteWriter(&buf)
+	subtableHeaderLen := 6
+	if t.version == 0 {
+		w.write(uint16(0), uint16(len(t.subtables)))
+	} else {
+		w.write(t.version, uint32(len(t.subtables)))
+		subtableHeaderLen = 8
+	}
+	w.flush()
+
+	for _, st := range t.subtables {
+		raw := append([]byte(nil), st.raw...)
+		if st.format == 0 {
+			for i := 0; i < len(st.pairs); i++ {
+				offset := subtableHeaderLen + 8 + 6*i + 4
+				value := int16(binary.BigEndian.Uint16(raw[offset:]))
+				binary.BigEndian.PutUint16(raw[offset:], uint16(scale(value)))
+			}
+		}
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+func (p kernPair) less(o kernPair) bool {
+	if p.left != o.left {
+		return p.left < o.left
+	}
+	return p.right < o.right
+}
+
+// isKerning returns true if `st` contains regular horizontal kerning values.
+func (st *kernSubtable) isKerning() bool {
+	return st.format == 0 && st.horizontal && !st.minimum && !st.crossStream && !st.variation
+}
+
+// lookup returns the kerning value of the pair `left`, `right` in `st`.
+func (st *kernSubtable) lookup(left, right GlyphIndex) (int16, bool) {
+	p := kernPair{left: left, right: right}
+	i := sort.Search(len(st.pairs), func(i int) bool {
+		return !st.pairs[i].less(p)
+	})
+	if i < len(st.pairs) && st.pairs[i].left == left && st.pairs[i].right == right {
+		return st.pairs[i].value, true
+	}
+	return 0, false
+}
+
+// lookup returns the horizontal kerning value of the pair `left`, `right` accumulated over the subtables
+// of `t`. Returns false if the pair is not kerned.
+func (t *kernTable) lookup(left, right GlyphIndex) (int16, bool) {
+	var value int16
+	found := false
+	for _, st := range t.subtables {
+		if !st.isKerning() {
+			continue
+		}
+		v, has := st.lookup(left, right)
+		if !has {
+			continue
+		}
+		if st.override {
+			value = v
+		} else {
+			value += v
+		}
+		found = true
+	}
+	return value, found
+}
+
+// pairs returns all the kerned pairs of `t` with the horizontal kerning values accumulated over the subtables.
+func (t *kernTable) pairs() map[[2]GlyphIndex]int16 {
+	values := map[[2]GlyphIndex]int16{}
+	for _, st := range t.subtables {
+		if !st.isKerning() {
+			continue
+		}
+		for _, p := range st.pairs {
+			key := [2]GlyphIndex{p.left, p.right}
+			if st.override {
+				values[key] = p.value
+			} else {
+				values[key] += p.value
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,115 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// kernFormat0Data returns the data of a Microsoft kern subtable of format 0 with `coverage` flags and `pairs`.
+func kernFormat0Data(coverage uint16, pairs []kernPair) []byte {
+	var buf bytes.Buffer
+	write := func(vals ...interface{}) {
+		for _, v := range vals {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+	}
+	write(uint16(0), uint16(14+6*len(pairs)), coverage)
+	write(uint16(len(pairs)), uint16(0), uint16(0), uint16(0))
+	for _, p := range pairs {
+		write(uint16(p.left), uint16(p.right), p.value)
+	}
+	return buf.Bytes()
+}
+
+func TestKernTable(t *testing.T) {
+	unsupported := []byte{0, 0, 0, 8, 0x02, 0x01, 0xAB, 0xCD} // format 2 subtable, kept as is.
+
+	var data []byte
+	data = append(data, 0, 0, 0, 4) // version 0, 4 subtables.
+	data = append(data, kernFormat0Data(0x0001, []kernPair{{3, 4, -50}, {1, 2, -100}, {5, 6, 10}})...)
+	data = append(data, kernFormat0Data(0x0001, []kernPair{{1, 2, -20}, {7, 8, 30}})...)
+	data = append(data, kernFormat0Data(0x0009, []kernPair{{5, 6, -5}})...) // override.
+	data = append(data, unsupported...)
+
+	kern, err := parseKernData(data)
+	require.NoError(t, err)
+	require.Len(t, kern.subtables, 4)
+	assert.Equal(t, uint8(2), kern.subtables[3].format)
+	assert.Equal(t, unsupported, kern.subtables[3].raw)
+
+	fnt := &Font{font: &font{kern: kern}}
+	testcases := []struct {
+		left, right GlyphIndex
+		value       int16
+		found       bool
+	}{
+		{1, 2, -120, true},
+		{3, 4, -50, true},
+		{5, 6, -5, true},
+		{7, 8, 30, true},
+		{2, 1, 0, false},
+		{9, 9, 0, false},
+	}
+	for _, tcase := range testcases {
+		value, found := fnt.KernPair(tcase.left, tcase.right)
+		assert.Equal(t, tcase.found, found, "%d %d", tcase.left, tcase.right)
+		assert.Equal(t, tcase.value, value, "%d %d", tcase.left, tcase.right)
+	}
+	assert.Equal(t, []KerningPair{
+		{1, 2, -120},
+		{3, 4, -50},
+		{5, 6, -5},
+		{7, 8, 30},
+	}, fnt.AllKernPairs())
+
+	// Apple kern table header.
+	apple := []byte{0, 1, 0, 0, 0, 0, 0, 1} // version 1.0, 1 subtable.
+	apple = append(apple, 0, 0, 0, 22, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 2, 0xFF, 0x9C)
+	kern, err = parseKernData(apple)
+	require.NoError(t, err)
+	value, found := kern.lookup(1, 2)
+	assert.True(t, found)
+	assert.Equal(t, int16(-100), value)
+
+	_, err = parseKernData([]byte{0, 0, 0, 1, 0, 0})
+	assert.Error(t, err)
+}
+
+func TestKernReadWrite(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	require.Nil(t, fnt.kern)
+	// GPOS kerning takes precedence over the kern table.
+	require.NoError(t, fnt.PruneTables("GPOS"))
+
+	data := append([]byte{0, 0, 0, 1}, kernFormat0Data(0x0001, []kernPair{{36, 57, -74}})...)
+	fnt.rawTables = append(fnt.rawTables, &rawTable{tableTag: makeTag("kern"), data: data})
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+
+	value, found := newfnt.KernPair(36, 57)
+	assert.True(t, found)
+	assert.Equal(t, int16(-74), value)
+	assert.Contains(t, newfnt.UnmodelledTables(), "kern")
+
+	subfnt, err := newfnt.SubsetKeepIndices([]GlyphIndex{36, 57})
+	require.NoError(t, err)
+	value, _ = subfnt.KernPair(36, 57)
+	assert.Equal(t, int16(-74), value)
+
+	require.NoError(t, newfnt.PruneTables("kern"))
+	_, found = newfnt.KernPair(36, 57)
+	assert.False(t, found)
+}
@@ -7,8 +7,7 @@ package unitype
 
 import (
 	"errors"
-
-	"github.com/sirupsen/logrus"
+	"fmt"
 )
 
 // locaTable represents the Index to Location (loca) table.
@@ -19,15 +18,30 @@ type locaTable struct {
 	offsetsLong  []offset32 // long format. (numGlyphs+1 entries).
 }
 
+// Clone returns a deep copy of `t`.
+func (t *locaTable) Clone() *locaTable {
+	if t == nil {
+		return nil
+	}
+	return &locaTable{
+		offsetsShort: append([]offset16(nil), t.offsetsShort...),
+		offsetsLong:  append([]offset32(nil), t.offsetsLong...),
+	}
+}
+
 // GetGlyphDataOffset returns offset for glyph index `gid`. The offset is relative to
 // the beginning of the glyf table.
 func (f *font) GetGlyphDataOffset(gid GlyphIndex) (offset int64, len int64, err error) {
-	if f.loca == nil || f.head == nil {
-		logrus.Debug("loca or head missing")
-		return 0, 0, errRequiredField
+	if f.loca == nil {
+		logger.Debugf("loca missing")
+		return 0, 0, ErrRequiredTableMissing{Tag: "loca"}
+	}
+	if f.head == nil {
+		logger.Debugf("head missing")
+		return 0, 0, ErrRequiredTableMissing{Tag: "head"}
 	}
 	if gid < 0 || int(gid) >= int(f.maxp.numGlyphs) {
-		logrus.Debug("invalid range")
+		logger.Debugf("invalid range")
 		return 0, 0, errRangeCheck
 	}
 
@@ -43,23 +57,63 @@ func (f *font) GetGlyphDataOffset(gid GlyphIndex) (offset int64, len int64, err
 	return offset1, offset2 - offset1, nil
 }
 
+// locaOffsets returns the glyph data offsets of the loca table in bytes (numGlyphs+1 entries).
+func (f *font) locaOffsets() []int64 {
+	if f.head.indexToLocFormat == 0 {
+		offsets := make([]int64, len(f.loca.offsetsShort))
+		for i, offset := range f.loca.offsetsShort {
+			offsets[i] = 2 * int64(offset)
+		}
+		return offsets
+	}
+	offsets := make([]int64, len(f.loca.offsetsLong))
+	for i, offset := range f.loca.offsetsLong {
+		offsets[i] = int64(offset)
+	}
+	return offsets
+}
+
+// validateLoca checks that the loca offsets of `f` are non-decreasing and within the glyf table of length
+// `glyfLen`. A loca table ending before the end of the glyf table is tolerated as glyf tables are often padded.
+func (f *font) validateLoca(glyfLen int64) error {
+	if f.loca == nil || f.head == nil {
+		return errRequiredField
+	}
+	offsets := f.locaOffsets()
+	for i, offset := range offsets {
+		if offset > glyfLen {
+			logger.Debugf("loca offset %d of glyph %d beyond the glyf table (%d)", offset, i, glyfLen)
+			return newOffsetError("loca offset %d of glyph %d beyond the glyf table (%d)", offset, i, glyfLen)
+		}
+		if i > 0 && offset < offsets[i-1] {
+			logger.Debugf("loca offsets of glyph %d decrease (%d < %d)", i-1, offset, offsets[i-1])
+			return newOffsetError("loca offsets of glyph %d decrease (%d < %d)", i-1, offset, offsets[i-1])
+		}
+	}
+	return nil
+}
+
 func (f *font) parseLoca(r *byteReader) (*locaTable, error) {
-	if f.head == nil || f.maxp == nil {
-		logrus.Debug("head or maxp not set - required missing")
-		return nil, errRequiredField
+	if f.head == nil {
+		logger.Debugf("head not set - required missing")
+		return nil, ErrRequiredTableMissing{Tag: "head"}
+	}
+	if f.maxp == nil {
+		logger.Debugf("maxp not set - required missing")
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
 	}
 
-	_, has, err := f.seekToTable(r, "loca")
+	tr, has, err := f.seekToTable(r, "loca")
 	if err != nil {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("loca table not present")
+		logger.Debugf("loca table not present")
 		return nil, nil
 	}
 
 	if f.head.indexToLocFormat < 0 || f.head.indexToLocFormat > 1 {
-		logrus.Debug("Invalid index to loca value")
+		logger.Debugf("Invalid index to loca value")
 		return nil, errRangeCheck
 	}
 
@@ -68,27 +122,51 @@ func (f *font) parseLoca(r *byteReader) (*locaTable, error) {
 	numGlyphs := int(f.maxp.numGlyphs)
 	isShort := f.head.indexToLocFormat == 0
 
+	// Cross-check the number of glyphs, which is not limited by the size of the font otherwise.
+	entrySize := 4
+	if isShort {
+		entrySize = 2
+	}
+	numEntries := numGlyphs + 1
+	if int(tr.length) < entrySize*numEntries {
+		logger.Debugf("loca table too short for %d glyphs (%d bytes)", numGlyphs, tr.length)
+		if !f.opts.RepairLoca || int(tr.length) < 2*entrySize {
+			return nil, newOffsetError("table too short for %d glyphs", numGlyphs)
+		}
+		// Load the glyphs not covered as empty glyphs, see Font.Repair.
+		numEntries = int(tr.length) / entrySize
+		f.shortLocaGlyphs = numEntries - 1
+	}
+
 	if isShort {
-		err := r.readSlice(&loca.offsetsShort, numGlyphs+1)
+		err := r.readSlice(&loca.offsetsShort, numEntries)
 		if err != nil {
 			return nil, err
 		}
+		last := loca.offsetsShort[numEntries-1]
+		for len(loca.offsetsShort) < numGlyphs+1 {
+			loca.offsetsShort = append(loca.offsetsShort, last)
+		}
 		return loca, nil
 	}
 
-	err = r.readSlice(&loca.offsetsLong, numGlyphs+1)
+	err = r.readSlice(&loca.offsetsLong, numEntries)
 	if err != nil {
 		return nil, err
 	}
+	last := loca.offsetsLong[numEntries-1]
+	for len(loca.offsetsLong) < numGlyphs+1 {
+		loca.offsetsLong = append(loca.offsetsLong, last)
+	}
 	for i := 0; i < numGlyphs; i++ {
 		offset := loca.offsetsLong[i]
 		len := loca.offsetsLong[i+1] - loca.offsetsLong[i]
 		if offset < 0 {
-			logrus.Debug("Invalid offset")
+			logger.Debugf("Invalid offset")
 			return nil, errors.New("invalid indexToLoca offset")
 		}
 		if len < 0 {
-			logrus.Debug("Invalid length")
+			logger.Debugf("Invalid length")
 			return nil, errors.New("invalid indexToLoca len")
 		}
 
@@ -107,9 +185,73 @@ func (f *font) writeLoca(w *byteWriter) error {
 	t := f.loca
 	if isShort {
 		if numGlyphs+1 != len(t.offsetsShort) {
-			logrus.Debug("Unexpected length")
+			logger.Debugf("Unexpected length")
 		}
 		return w.writeSlice(t.offsetsShort)
 	}
 	return w.writeSlice(t.offsetsLong)
 }
+
+// updateLoca regenerates the loca offsets from the glyph descriptions in the glyf table, padded as written,
+// using the offset format specified by head.indexToLocFormat.
+func (f *font) updateLoca() error {
+	if f.glyf == nil || f.head == nil {
+		return errRequiredField
+	}
+
+	isShort := f.head.indexToLocFormat == 0
+	loca := &locaTable{}
+	if isShort {
+		loca.offsetsShort = make([]offset16, len(f.glyf.descs)+1)
+	} else {
+		loca.offsetsLong = make([]offset32, len(f.glyf.descs)+1)
+	}
+
+	var offset int64
+	for i, desc := range f.glyf.descs {
+		offset += paddedGlyphLen(desc.raw)
+		if isShort {
+			if offset%2 != 0 || offset/2 > 0xFFFF {
+				logger.Debugf("Glyph data offset not representable in short loca format (%d)", offset)
+				return errRangeCheck
+			}
+			loca.offsetsShort[i+1] = offset16(offset / 2)
+		} else {
+			if offset > 0xFFFFFFFF {
+				return errRangeCheck
+			}
+			loca.offsetsLong[i+1] = offset32(offset)
+		}
+	}
+
+	f.loca = loca
+	return nil
+}
+
+// updateLocaFormat selects the loca format from the glyph data in the glyf table, the short format if it can
+// represent the offsets and the long format otherwise, and regenerates the loca table accordingly.
+// Returns an error if the glyph data is too large for the long format.
+func (f *font) updateLocaFormat() error {
+	if f.glyf == nil || f.head == nil {
+		return nil
+	}
+	err := f.glyf.loadAll()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, desc := range f.glyf.descs {
+		total += paddedGlyphLen(desc.raw)
+	}
+	if total > 0xFFFFFFFF {
+		return fmt.Errorf("glyph data too large for the loca table: %d bytes", total)
+	}
+
+	if total/2 <= 0xFFFF {
+		f.head.indexToLocFormat = 0
+	} else {
+		f.head.indexToLocFormat = 1
+	}
+	return f.updateLoca()
+}
@@ -0,0 +1,123 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocaRepair(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.Equal(t, int16(1), fnt.head.indexToLocFormat)
+	loca := fnt.trec.trMap["loca"]
+	glyfLen := fnt.trec.trMap["glyf"].length
+	offsets := fnt.locaOffsets()
+
+	// The offset of glyph 5 is beyond its end, so glyph 4 ends after glyph 5 and glyph 5 has a negative
+	// length, and the offset of glyph 8 is beyond the glyf table.
+	bad := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(bad[loca.offset+5*4:], uint32(offsets[6]+10))
+	binary.BigEndian.PutUint32(bad[loca.offset+8*4:], glyfLen+100)
+
+	_, err = ParseBytes(bad)
+	assert.Error(t, err)
+	assert.Error(t, ValidateBytes(bad))
+
+	repaired, err := ParseWithOptions(bytes.NewReader(bad), ParseOptions{RepairLoca: true})
+	require.NoError(t, err)
+	descs := repaired.glyf.descs
+	assert.Equal(t, fnt.glyf.descs[3], descs[3])
+	assert.Equal(t, int(offsets[6]+10-offsets[4]), len(descs[4].raw))
+	assert.Empty(t, descs[5].raw)
+	assert.Equal(t, fnt.glyf.descs[6], descs[6])
+	assert.Equal(t, int(int64(glyfLen)-offsets[7]), len(descs[7].raw))
+	assert.Empty(t, descs[8].raw)
+	assert.Equal(t, fnt.glyf.descs[9], descs[9])
+
+	// The loca table is regenerated.
+	var total int64
+	for _, desc := range descs {
+		total += int64(len(desc.raw))
+	}
+	require.NoError(t, repaired.validateLoca(total))
+	data, err = repaired.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+}
+
+func TestLocaFormatSelection(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	subfnt, err := fnt.SubsetFirst(20)
+	require.NoError(t, err)
+
+	written := func(f *Font) *Font {
+		data, err := f.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		parsed, err := ParseBytes(data)
+		require.NoError(t, err)
+		for i, desc := range parsed.glyf.descs {
+			assert.Equal(t, f.glyf.descs[i].raw, desc.raw, "%d", i)
+		}
+		return parsed
+	}
+
+	// The short format is used for small glyph data.
+	subfnt.head.indexToLocFormat = 1
+	parsed := written(subfnt)
+	assert.Equal(t, int16(0), parsed.head.indexToLocFormat)
+
+	// The long format is required for large glyph data.
+	parsed.glyf.descs[5] = &glyphDescription{raw: make([]byte, 0x20000)}
+	parsed = written(parsed)
+	assert.Equal(t, int16(1), parsed.head.indexToLocFormat)
+	assert.Equal(t, 0x20000, len(parsed.glyf.descs[5].raw))
+
+}
+
+func TestGlyphPadding(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	require.Equal(t, int16(0), fnt.head.indexToLocFormat)
+
+	// Glyph data of odd length, with a trailing byte.
+	raw := append(append([]byte(nil), fnt.glyf.descs[40].raw...), 7)
+	fnt.glyf.descs[40] = &glyphDescription{raw: raw}
+	original := make([][]byte, len(fnt.glyf.descs))
+	for i, desc := range fnt.glyf.descs {
+		original[i] = desc.raw
+	}
+
+	subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{39, 40, 41})
+	require.NoError(t, err)
+	data, err := subfnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	parsed, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, int16(0), parsed.head.indexToLocFormat)
+	assert.Equal(t, original[39], parsed.glyf.descs[39].raw)
+	assert.Equal(t, append(raw, 0), parsed.glyf.descs[40].raw)
+	assert.Equal(t, original[41], parsed.glyf.descs[41].raw)
+	require.NotEmpty(t, original[38])
+	assert.Empty(t, parsed.glyf.descs[38].raw)
+
+	// The glyphs of the original font are left as is.
+	for i, desc := range fnt.glyf.descs {
+		assert.Equal(t, original[i], desc.raw, "%d", i)
+	}
+}
@@ -5,10 +5,6 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 // maxpTable represents the Maximum Profile (maxp) table.
 // This table establishes the memory requirements for the font.
 type maxpTable struct {
@@ -32,13 +28,22 @@ type maxpTable struct {
 	maxComponentDepth     uint16
 }
 
+// Clone returns a copy of `t`.
+func (t *maxpTable) Clone() *maxpTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	return &dup
+}
+
 func (f *font) parseMaxp(r *byteReader) (*maxpTable, error) {
 	_, has, err := f.seekToTable(r, "maxp")
 	if err != nil {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("maxp table not present")
+		logger.Debugf("maxp table not present")
 		return nil, nil
 	}
 
@@ -49,8 +54,16 @@ func (f *font) parseMaxp(r *byteReader) (*maxpTable, error) {
 		return nil, err
 	}
 
+	if int(t.numGlyphs) > f.opts.maxNumGlyphs() {
+		return nil, newLimitError("number of glyphs %d exceeds %d", t.numGlyphs, f.opts.maxNumGlyphs())
+	}
+
+	if t.version == 0x00005000 {
+		// Version 0.5 for fonts with CFF outlines only has the number of glyphs.
+		return t, nil
+	}
 	if t.version < 0x00010000 {
-		logrus.Debug("Range check error")
+		logger.Debugf("Range check error")
 		return nil, errRangeCheck
 	}
 
@@ -77,8 +90,11 @@ func (f *font) writeMaxp(w *byteWriter) error {
 		return err
 	}
 
+	if t.version == 0x00005000 {
+		return nil
+	}
 	if t.version < 0x00010000 {
-		logrus.Debug("Range check error")
+		logger.Debugf("Range check error")
 		return errRangeCheck
 	}
 
@@ -94,3 +110,97 @@ func (f *font) writeMaxp(w *byteWriter) error {
 
 	return w.write(t.maxStackElements, t.maxSizeOfInstructions, t.maxComponentElements, t.maxComponentDepth)
 }
+
+// glyphProfile represents the complexity of a glyph as accounted for in the maxp table. Composite glyphs
+// are flattened, i.e. the points and contours of all the simple glyphs they consist of are summed up.
+type glyphProfile struct {
+	points   int
+	contours int
+	depth    int // levels of composite recursion, 0 for simple glyphs.
+}
+
+// recomputeMaxp recomputes the glyph related maximums of the maxp table from the glyphs in the glyf table:
+// maxPoints, maxContours, maxCompositePoints, maxCompositeContours, maxComponentElements and
+// maxComponentDepth. Glyphs that cannot be parsed are skipped.
+func (f *font) recomputeMaxp() {
+	if f.maxp == nil || f.glyf == nil || f.maxp.version < 0x00010000 {
+		return
+	}
+
+	profiles := make(map[GlyphIndex]glyphProfile, len(f.glyf.descs))
+	var getProfile func(gid GlyphIndex, depth int) (glyphProfile, error)
+	getProfile = func(gid GlyphIndex, depth int) (glyphProfile, error) {
+		if p, has := profiles[gid]; has {
+			return p, nil
+		}
+		if int(gid) >= len(f.glyf.descs) || depth > maxComponentDepth {
+			logger.Debugf("Invalid component %d at depth %d", gid, depth)
+			return glyphProfile{}, errRangeCheck
+		}
+
+		var p glyphProfile
+		gd := f.glyf.descs[gid]
+		if gd.size() == 0 {
+			profiles[gid] = p
+			return p, nil
+		}
+		err := gd.parse()
+		if err != nil {
+			return glyphProfile{}, err
+		}
+
+		if gd.IsSimple() {
+			p.points, err = gd.numPoints()
+			if err != nil {
+				return glyphProfile{}, err
+			}
+			p.contours = int(gd.header.numberOfContours)
+		} else if gd.composite != nil {
+			for _, comp := range gd.composite.components {
+				cp, err := getProfile(GlyphIndex(comp.glyphIndex), depth+1)
+				if err != nil {
+					return glyphProfile{}, err
+				}
+				p.points += cp.points
+				p.contours += cp.contours
+				if cp.depth+1 > p.depth {
+					p.depth = cp.depth + 1
+				}
+			}
+		}
+		profiles[gid] = p
+		return p, nil
+	}
+
+	var maxPoints, maxContours, maxCompositePoints, maxCompositeContours, maxElements, maxDepth int
+	for i, gd := range f.glyf.descs {
+		p, err := getProfile(GlyphIndex(i), 0)
+		if err != nil {
+			logger.Debugf("Unable to get profile of glyph %d: %v - skipping", i, err)
+			continue
+		}
+		if gd.composite == nil {
+			maxPoints = maxInt(maxPoints, p.points)
+			maxContours = maxInt(maxContours, p.contours)
+			continue
+		}
+		maxCompositePoints = maxInt(maxCompositePoints, p.points)
+		maxCompositeContours = maxInt(maxCompositeContours, p.contours)
+		maxElements = maxInt(maxElements, len(gd.composite.components))
+		maxDepth = maxInt(maxDepth, p.depth)
+	}
+
+	f.maxp.maxPoints = uint16(maxPoints)
+	f.maxp.maxContours = uint16(maxContours)
+	f.maxp.maxCompositePoints = uint16(maxCompositePoints)
+	f.maxp.maxCompositeContours = uint16(maxCompositeContours)
+	f.maxp.maxComponentElements = uint16(maxElements)
+	f.maxp.maxComponentDepth = uint16(maxDepth)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
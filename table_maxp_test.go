@@ -58,3 +58,62 @@ func TestMaxpTable(t *testing.T) {
 		})
 	}
 }
+
+func TestRecomputeMaxp(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	// Recomputing the full font gives the original values.
+	orig := *fnt.maxp
+	require.NoError(t, fnt.RecomputeMaxp())
+	assert.Equal(t, orig, *fnt.maxp)
+
+	// Subsets only account for the retained glyphs.
+	gid, _ := fnt.LookupRune('.')
+	subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{gid})
+	require.NoError(t, err)
+	expPoints := 0
+	for _, g := range []GlyphIndex{0, gid} {
+		n, err := fnt.glyf.descs[g].numPoints()
+		require.NoError(t, err)
+		expPoints = maxInt(expPoints, n)
+	}
+	assert.Equal(t, expPoints, int(subfnt.maxp.maxPoints))
+	assert.True(t, subfnt.maxp.maxPoints < orig.maxPoints)
+	assert.Equal(t, 0, int(subfnt.maxp.maxCompositePoints))
+	assert.Equal(t, 0, int(subfnt.maxp.maxComponentDepth))
+
+	// Keeping the last glyph, which keeps all the GIDs, with and without the outline of the notdef glyph.
+	last := GlyphIndex(fnt.maxp.numGlyphs - 1)
+	lastPoints, err := fnt.glyf.descs[last].numPoints()
+	require.NoError(t, err)
+	notdefPoints, err := fnt.glyf.descs[0].numPoints()
+	require.NoError(t, err)
+	subfnt, err = fnt.SubsetKeepIndices([]GlyphIndex{last})
+	require.NoError(t, err)
+	assert.Equal(t, orig.numGlyphs, subfnt.maxp.numGlyphs)
+	assert.Equal(t, maxInt(lastPoints, notdefPoints), int(subfnt.maxp.maxPoints))
+	subfnt, _, err = fnt.SubsetWithOptions([]GlyphIndex{last}, SubsetOptions{RetainGIDs: true})
+	require.NoError(t, err)
+	assert.Equal(t, lastPoints, int(subfnt.maxp.maxPoints))
+
+	// Nested composite glyphs.
+	fnt.glyf = &glyfTable{
+		descs: []*glyphDescription{
+			{raw: nil},
+			{raw: []byte{0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 9}}, // simple glyph, 2 contours, 10 points.
+			{raw: compositeGlyphData(1)},
+			{raw: compositeGlyphData(2)},
+		},
+	}
+	require.NoError(t, fnt.RecomputeMaxp())
+	assert.Equal(t, 10, int(fnt.maxp.maxPoints))
+	assert.Equal(t, 2, int(fnt.maxp.maxContours))
+	assert.Equal(t, 10, int(fnt.maxp.maxCompositePoints))
+	assert.Equal(t, 2, int(fnt.maxp.maxCompositeContours))
+	assert.Equal(t, 1, int(fnt.maxp.maxComponentElements))
+	assert.Equal(t, 2, int(fnt.maxp.maxComponentDepth))
+
+	fnt.maxp = nil
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "maxp"}, fnt.RecomputeMaxp())
+}
@@ -0,0 +1,82 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// mvarTable represents the metrics variations (MVAR) table, holding the variation deltas of font-wide
+// metrics such as the ascender or x-height in the OS/2, hhea, vhea and post tables. It is parsed on demand
+// when instancing variable fonts, otherwise the table is preserved as a raw table and written out verbatim.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/mvar
+type mvarTable struct {
+	records []mvarValueRecord
+	store   *itemVariationStore
+}
+
+type mvarValueRecord struct {
+	valueTag tag
+	outer    uint16 // delta set outer index.
+	inner    uint16 // delta set inner index.
+}
+
+// parseMvarData parses MVAR table `data`.
+func parseMvarData(data []byte) (*mvarTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var majorVersion, minorVersion, reserved, valueRecordSize, valueRecordCount uint16
+	var storeOffset offset16
+	err := r.read(&majorVersion, &minorVersion, &reserved, &valueRecordSize, &valueRecordCount, &storeOffset)
+	if err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 {
+		logger.Debugf("Unsupported MVAR version %d.%d", majorVersion, minorVersion)
+		return nil, errRangeCheck
+	}
+	if valueRecordCount == 0 {
+		return &mvarTable{}, nil
+	}
+	if valueRecordSize < 8 || 12+int64(valueRecordCount)*int64(valueRecordSize) > int64(len(data)) {
+		logger.Debugf("MVAR value records out of range")
+		return nil, errRangeCheck
+	}
+
+	t := &mvarTable{
+		records: make([]mvarValueRecord, valueRecordCount),
+	}
+	for i := range t.records {
+		err = r.SeekTo(12 + int64(i)*int64(valueRecordSize))
+		if err != nil {
+			return nil, err
+		}
+		rec := &t.records[i]
+		err = r.read(&rec.valueTag, &rec.outer, &rec.inner)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if storeOffset == 0 {
+		logger.Debugf("MVAR without ItemVariationStore")
+		return nil, ErrRequiredTableMissing{Tag: "MVAR"}
+	}
+	t.store, err = parseItemVariationStore(data, int64(storeOffset))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// deltas returns the rounded deltas of the metrics of `t` by value tag at the normalized coordinates
+// `coords`.
+func (t *mvarTable) deltas(coords []float64) map[string]int {
+	deltas := make(map[string]int, len(t.records))
+	for _, rec := range t.records {
+		deltas[rec.valueTag.String()] = otRound(t.store.delta(rec.outer, rec.inner, coords))
+	}
+	return deltas
+}
@@ -7,11 +7,10 @@ package unitype
 
 import (
 	"bytes"
+	"fmt"
+	"sort"
 	"strconv"
 	"unicode"
-	"unicode/utf8"
-
-	"github.com/sirupsen/logrus"
 
 	"golang.org/x/text/encoding/charmap"
 
@@ -33,6 +32,27 @@ type nameTable struct {
 	langTagRecords []*langTagRecord // len = langTagCount
 }
 
+// Clone returns a deep copy of `t`.
+func (t *nameTable) Clone() *nameTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	dup.nameRecords = make([]*nameRecord, len(t.nameRecords))
+	for i, nr := range t.nameRecords {
+		nrdup := *nr
+		nrdup.data = append([]byte(nil), nr.data...)
+		dup.nameRecords[i] = &nrdup
+	}
+	dup.langTagRecords = make([]*langTagRecord, len(t.langTagRecords))
+	for i, ltr := range t.langTagRecords {
+		ltrdup := *ltr
+		ltrdup.data = append([]byte(nil), ltr.data...)
+		dup.langTagRecords[i] = &ltrdup
+	}
+	return &dup
+}
+
 type langTagRecord struct {
 	length uint16
 	offset offset16
@@ -54,7 +74,7 @@ type nameRecord struct {
 // An empty string is returned otherwise (nothing found).
 func (f *font) GetNameByID(nameID int) string {
 	if f == nil || f.name == nil {
-		logrus.Debug("ERROR: Font or name not set")
+		logger.Debugf("ERROR: Font or name not set")
 		return ""
 	}
 	for _, nr := range f.name.nameRecords {
@@ -90,52 +110,286 @@ func makePrintable(str string) string {
 }
 
 // Decoded attempts to decode the underlying data and convert to a string.
-// NOTE: Works in many cases but often has some -garbage- around texts.
+// Unprintable runes are quoted.
 func (nr nameRecord) Decoded() string {
-	switch nr.platformID {
-	case 0: // unicode
-		// TODO(gunnsth): Untested as have not encountered this yet.
-		dup := make([]byte, len(nr.data))
-		copy(dup, nr.data)
-		var decoded bytes.Buffer
-
-		for len(dup) > 0 {
-			r, size := utf8.DecodeRune(dup)
-			dup = dup[size:]
-			decoded.WriteRune(r)
-		}
+	return makePrintable(nr.value())
+}
 
-		return makePrintable(decoded.String())
+// value returns the data of `nr` decoded as per its platform: UTF-16BE for the Unicode and Windows platforms
+// and Mac Roman for the Macintosh Roman encoding. Data of other encodings is returned as is.
+func (nr nameRecord) value() string {
+	switch nr.platformID {
+	case 0, 3: // unicode, windows
+		// All strings of the Unicode and Windows platforms are encoded in UTF-16BE, including those of the
+		// Windows symbol encoding (https://docs.microsoft.com/en-us/typography/opentype/spec/name).
+		return strutils.UTF16ToString(nr.data)
 	case 1: // macintosh
+		if nr.encodingID != 0 {
+			break
+		}
 		var decoded bytes.Buffer
 		for _, val := range nr.data {
 			decoded.WriteRune(charmap.Macintosh.DecodeByte(val))
 		}
-		macs := decoded.String()
+		return decoded.String()
+	}
+	return string(nr.data)
+}
+
+// NameRecord represents a record of the name table: a string such as the family or PostScript name of the
+// font for a platform, encoding and language.
+type NameRecord struct {
+	PlatformID uint16
+	EncodingID uint16
+	LanguageID uint16
+	NameID     uint16
+	Value      string // decoded UTF-8 string.
+}
+
+// NameRecords returns the records of the name table of `f` in order, with the strings decoded as per their
+// platform. Returns nil if `f` has no name table.
+func (f *Font) NameRecords() []NameRecord {
+	if f.name == nil {
+		return nil
+	}
+	records := make([]NameRecord, len(f.name.nameRecords))
+	for i, nr := range f.name.nameRecords {
+		records[i] = NameRecord{
+			PlatformID: nr.platformID,
+			EncodingID: nr.encodingID,
+			LanguageID: nr.languageID,
+			NameID:     nr.nameID,
+			Value:      nr.value(),
+		}
+	}
+	return records
+}
+
+// PostScriptName returns the PostScript name of `f` (name ID 6), or an empty string if not set.
+func (f *Font) PostScriptName() string {
+	return f.englishName(6)
+}
+
+// FamilyName returns the family name of `f` (name ID 1), or an empty string if not set.
+func (f *Font) FamilyName() string {
+	return f.englishName(1)
+}
 
-		// Following may be needed in rare cases:
-		/*
-			utf16s := strutils.UTF16ToString([]byte(macs))
-			if numPrintables(utf16s) > numPrintables(macs) {
-				return makePrintable(utf16s)
+// SubfamilyName returns the subfamily (style) name of `f` (name ID 2), e.g. "Bold Italic", or an empty string
+// if not set.
+func (f *Font) SubfamilyName() string {
+	return f.englishName(2)
+}
+
+// FullName returns the full name of `f` (name ID 4), or an empty string if not set.
+func (f *Font) FullName() string {
+	return f.englishName(4)
+}
+
+// englishName returns the name `nameID` of `f` as per nameTable.englishName.
+func (f *Font) englishName(nameID uint16) string {
+	if f.name == nil {
+		return ""
+	}
+	return f.name.englishName(nameID)
+}
+
+// englishName returns the name `nameID` of `t`, in order of preference from the Windows English (United
+// States) record, any other Windows record, the Macintosh English record or any other record.
+// An empty string is returned if there is no such name.
+func (t *nameTable) englishName(nameID uint16) string {
+	var best *nameRecord
+	bestRank := 0
+	for _, nr := range t.nameRecords {
+		if nr.nameID != nameID {
+			continue
+		}
+		rank := 1
+		switch {
+		case nr.platformID == 3 && nr.languageID == 0x409:
+			return nr.value()
+		case nr.platformID == 3:
+			rank = 3
+		case nr.platformID == 1 && nr.languageID == 0:
+			rank = 2
+		}
+		if rank > bestRank {
+			best, bestRank = nr, rank
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.value()
+}
+
+// setName sets the name `nameID` of `t` to `value` in all records with that name ID, encoded as required
+// by their platform. A Windows English (United States) record is added if there is none. The records are
+// replaced rather than modified in place, so they may be shared with other fonts.
+func (t *nameTable) setName(nameID uint16, value string) {
+	records := make([]*nameRecord, 0, len(t.nameRecords)+1)
+	found := false
+	for _, nr := range t.nameRecords {
+		if nr.nameID == nameID {
+			dup := *nr
+			dup.data = encodeName(nr.platformID, value)
+			nr = &dup
+			found = true
+		}
+		records = append(records, nr)
+	}
+	if !found {
+		records = append(records, &nameRecord{
+			platformID: 3,
+			encodingID: 1,
+			languageID: 0x409,
+			nameID:     nameID,
+			data:       encodeName(3, value),
+		})
+		sortNameRecords(records)
+	}
+	t.nameRecords = records
+}
+
+// setRecord sets the name `nameID` of the record of `t` for the platform, encoding and language to `value`,
+// adding the record if there is none. The record is replaced rather than modified in place.
+func (t *nameTable) setRecord(platformID, encodingID, languageID, nameID uint16, value string) {
+	nr := &nameRecord{
+		platformID: platformID,
+		encodingID: encodingID,
+		languageID: languageID,
+		nameID:     nameID,
+		data:       encodeName(platformID, value),
+	}
+	records := make([]*nameRecord, 0, len(t.nameRecords)+1)
+	for _, old := range t.nameRecords {
+		if old.platformID == platformID && old.encodingID == encodingID && old.languageID == languageID &&
+			old.nameID == nameID {
+			continue
+		}
+		records = append(records, old)
+	}
+	records = append(records, nr)
+	sortNameRecords(records)
+	t.nameRecords = records
+}
+
+// sortNameRecords sorts `records` by platform, encoding, language and name IDs as required by the spec.
+func sortNameRecords(records []*nameRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.platformID != b.platformID {
+			return a.platformID < b.platformID
+		}
+		if a.encodingID != b.encodingID {
+			return a.encodingID < b.encodingID
+		}
+		if a.languageID != b.languageID {
+			return a.languageID < b.languageID
+		}
+		return a.nameID < b.nameID
+	})
+}
+
+// SetNameRecord sets the name `nameID` of `f` to `value` in the Windows English (United States) and the
+// Macintosh English records, adding the records if not present. Other records of `nameID` are left as is.
+// The Macintosh record is encoded in Mac Roman, with the runes not supported replaced by '?'.
+func (f *Font) SetNameRecord(nameID uint16, value string) {
+	if f.name == nil {
+		f.name = &nameTable{}
+	}
+	f.name.setRecord(1, 0, 0, nameID, value)
+	f.name.setRecord(3, 1, 0x409, nameID, value)
+	f.markDirty("name")
+}
+
+// subsetPrefixNameIDs are the IDs of the names prefixed by the subset tag.
+var subsetPrefixNameIDs = []uint16{1, 3, 4, 6}
+
+// ApplySubsetPrefix prefixes the family (1), unique (3), full (4) and PostScript (6) names of `f` with the
+// subset `tag`, e.g. "ABCDEF+", as is conventional for fonts subset for embedding in PDF. The tag must
+// consist of six uppercase ASCII letters followed by '+'. Names already prefixed with a tag have their tag
+// replaced. Returns an error if the tag is invalid or `f` has no name table.
+func (f *Font) ApplySubsetPrefix(tag string) error {
+	if !isSubsetTag(tag) {
+		return fmt.Errorf("invalid subset tag %q, expecting six uppercase letters followed by '+'", tag)
+	}
+	if f.name == nil {
+		logger.Debugf("ApplySubsetPrefix requires a name table")
+		return ErrRequiredTableMissing{Tag: "name"}
+	}
+
+	records := make([]*nameRecord, len(f.name.nameRecords))
+	for i, nr := range f.name.nameRecords {
+		records[i] = nr
+		for _, nameID := range subsetPrefixNameIDs {
+			if nr.nameID != nameID {
+				continue
 			}
-		*/
-		return makePrintable(macs)
-
-	case 3: // windows
-		// When building a Unicode font for Windows, the platform ID should be 3 and the encoding ID should be 1,
-		// and the referenced string data must be encoded in UTF-16BE. When building a symbol font for Windows,
-		// the platform ID should be 3 and the encoding ID should be 0, and the referenced string data must be
-		// encoded in UTF-16BE. (https://docs.microsoft.com/en-us/typography/opentype/spec/name).
-		if nr.encodingID == 0 || nr.encodingID == 1 {
-			if len(nr.data) > 0 {
-				decoded := strutils.UTF16ToString(nr.data)
-				return makePrintable(decoded)
+			value := nr.value()
+			if len(value) > len(tag) && isSubsetTag(value[:len(tag)]) {
+				value = value[len(tag):]
 			}
+			dup := *nr
+			dup.data = dup.encode(tag + value)
+			records[i] = &dup
+		}
+	}
+	f.name.nameRecords = records
+	f.markDirty("name")
+	return nil
+}
+
+// isSubsetTag returns true if `tag` is a subset tag: six uppercase ASCII letters followed by '+'.
+func isSubsetTag(tag string) bool {
+	if len(tag) != 7 || tag[6] != '+' {
+		return false
+	}
+	for i := 0; i < 6; i++ {
+		if tag[i] < 'A' || tag[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// removeName removes all records of the name `nameID` from `t`.
+func (t *nameTable) removeName(nameID uint16) {
+	records := make([]*nameRecord, 0, len(t.nameRecords))
+	for _, nr := range t.nameRecords {
+		if nr.nameID != nameID {
+			records = append(records, nr)
 		}
 	}
+	t.nameRecords = records
+}
 
-	return makePrintable(string(nr.data))
+// encode encodes `value` for `nr`, the reverse of value.
+func (nr nameRecord) encode(value string) []byte {
+	if nr.platformID == 1 && nr.encodingID != 0 {
+		return []byte(value)
+	}
+	return encodeName(nr.platformID, value)
+}
+
+// encodeName encodes `value` for a name record of platform `platformID`: UTF-16BE for the Unicode and
+// Windows platforms and Mac Roman for the Macintosh platform, with unsupported runes replaced by '?'.
+func encodeName(platformID uint16, value string) []byte {
+	switch platformID {
+	case 0, 3:
+		return []byte(strutils.StringToUTF16(value))
+	case 1:
+		data := make([]byte, 0, len(value))
+		for _, r := range value {
+			b, ok := charmap.Macintosh.EncodeRune(r)
+			if !ok {
+				b = '?'
+			}
+			data = append(data, b)
+		}
+		return data
+	}
+	return []byte(value)
 }
 
 func (f *font) parseNameTable(r *byteReader) (*nameTable, error) {
@@ -146,18 +400,18 @@ func (f *font) parseNameTable(r *byteReader) (*nameTable, error) {
 	if !has {
 		return nil, nil
 	}
-	logrus.Debugf("TR: %+v", tr)
+	logger.Debugf("TR: %+v", tr)
 
 	t := &nameTable{}
 	err = r.read(&t.format, &t.count, &t.stringOffset)
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("format/count/stringOffset: %v/%v/%v", t.format, t.count, t.stringOffset)
-	logrus.Debugf("-- name string offset: %d", t.stringOffset)
+	logger.Debugf("format/count/stringOffset: %v/%v/%v", t.format, t.count, t.stringOffset)
+	logger.Debugf("-- name string offset: %d", t.stringOffset)
 
 	if t.format > 1 {
-		logrus.Debugf("ERROR: format > 1 (%d)", t.format)
+		logger.Debugf("ERROR: format > 1 (%d)", t.format)
 		return nil, errRangeCheck
 	}
 
@@ -167,7 +421,7 @@ func (f *font) parseNameTable(r *byteReader) (*nameTable, error) {
 		if err != nil {
 			return nil, err
 		}
-		logrus.Debugf("name record %d: %v/%v/%v/%v/%v/%v", i, nr.platformID, nr.encodingID, nr.languageID, nr.nameID,
+		logger.Debugf("name record %d: %v/%v/%v/%v/%v/%v", i, nr.platformID, nr.encodingID, nr.languageID, nr.nameID,
 			nr.length, nr.offset)
 		t.nameRecords = append(t.nameRecords, &nr)
 	}
@@ -183,7 +437,7 @@ func (f *font) parseNameTable(r *byteReader) (*nameTable, error) {
 			if err != nil {
 				return nil, err
 			}
-			logrus.Debugf("ltr name record %d: %v/%v", i, ltr.offset, ltr.length)
+			logger.Debugf("ltr name record %d: %v/%v", i, ltr.offset, ltr.length)
 			t.langTagRecords = append(t.langTagRecords, &ltr)
 		}
 	}
@@ -191,45 +445,45 @@ func (f *font) parseNameTable(r *byteReader) (*nameTable, error) {
 	// Get the actual string data.
 	for _, nr := range t.nameRecords {
 		if int(t.stringOffset)+int(nr.offset)+int(nr.length) > int(tr.length) {
-			logrus.Debugf("%v> %v", int(t.stringOffset)+int(nr.offset)+int(nr.length), int(tr.length))
-			logrus.Debug("name string offset outside table")
-			return nil, errRangeCheck
+			logger.Debugf("%v> %v", int(t.stringOffset)+int(nr.offset)+int(nr.length), int(tr.length))
+			logger.Debugf("name string offset outside table")
+			return nil, newOffsetError("string of name record %d outside table", nr.nameID)
 		}
 
 		err = r.SeekTo(int64(t.stringOffset) + int64(tr.offset) + int64(nr.offset))
 		if err != nil {
-			logrus.Debugf("Error: %v", err)
+			logger.Debugf("Error: %v", err)
 			return nil, err
 		}
 
 		err = r.readBytes(&nr.data, int(nr.length))
 		if err != nil {
-			logrus.Debugf("Error: %v", err)
+			logger.Debugf("Error: %v", err)
 			return nil, err
 		}
 	}
 
 	for _, ltr := range t.langTagRecords {
 		if int(t.stringOffset)+int(ltr.offset)+int(ltr.length) > int(tr.length) {
-			logrus.Debug("lang tag string offset outside table")
-			return nil, errRangeCheck
+			logger.Debugf("lang tag string offset outside table")
+			return nil, newOffsetError("lang tag string outside table")
 		}
 
 		err = r.SeekTo(int64(t.stringOffset) + int64(tr.offset) + int64(ltr.offset))
 		if err != nil {
-			logrus.Debugf("Error: %v", err)
+			logger.Debugf("Error: %v", err)
 			return nil, err
 		}
 		err = r.readBytes(&ltr.data, int(ltr.length))
 		if err != nil {
-			logrus.Debugf("Error: %v", err)
+			logger.Debugf("Error: %v", err)
 			return nil, err
 		}
 	}
 
-	logrus.Debugf("Name records: %d", len(t.nameRecords))
+	logger.Debugf("Name records: %d", len(t.nameRecords))
 	for _, nr := range t.nameRecords {
-		logrus.Debugf("%d %d %d - '%s' (%d)", nr.platformID, nr.encodingID, nr.nameID, nr.Decoded(), len(nr.data))
+		logger.Debugf("%d %d %d - '%s' (%d)", nr.platformID, nr.encodingID, nr.nameID, nr.Decoded(), len(nr.data))
 	}
 
 	return t, nil
@@ -237,7 +491,7 @@ func (f *font) parseNameTable(r *byteReader) (*nameTable, error) {
 
 func (f *font) writeNameTable(w *byteWriter) error {
 	if f.name == nil {
-		logrus.Debug("name is nil")
+		logger.Debugf("name is nil")
 		return nil
 	}
 	t := f.name
@@ -247,6 +501,10 @@ func (f *font) writeNameTable(w *byteWriter) error {
 	{
 		bufw := newByteWriter(&buf)
 		for _, nr := range t.nameRecords {
+			if bufw.bufferedLen() > 0xFFFF {
+				logger.Debugf("name string storage exceeds 64K")
+				return errRangeCheck
+			}
 			nr.offset = offset16(bufw.bufferedLen())
 			nr.length = uint16(len(nr.data))
 			err := bufw.writeSlice(nr.data)
@@ -267,7 +525,7 @@ func (f *font) writeNameTable(w *byteWriter) error {
 			return err
 		}
 	}
-	logrus.Debugf("Buffer length: %d", buf.Len())
+	logger.Debugf("Buffer length: %d", buf.Len())
 
 	// Update count and stringOffsets (calculated).
 	t.count = uint16(len(t.nameRecords))
@@ -279,7 +537,7 @@ func (f *font) writeNameTable(w *byteWriter) error {
 		t.stringOffset += 2 + offset16(t.langTagCount)*4
 	}
 
-	logrus.Debugf("w @ %d", w.bufferedLen())
+	logger.Debugf("w @ %d", w.bufferedLen())
 	err := w.write(t.format, t.count, t.stringOffset)
 	if err != nil {
 		return err
@@ -291,7 +549,7 @@ func (f *font) writeNameTable(w *byteWriter) error {
 			return err
 		}
 	}
-	logrus.Debugf("w @ %d", w.bufferedLen())
+	logger.Debugf("w @ %d", w.bufferedLen())
 
 	if t.format == 1 {
 		err = w.write(t.langTagCount)
@@ -306,13 +564,13 @@ func (f *font) writeNameTable(w *byteWriter) error {
 		}
 	}
 
-	logrus.Debugf("w @ %d", w.bufferedLen())
+	logger.Debugf("w @ %d", w.bufferedLen())
 	// Write the buffered data.
 	err = w.writeBytes(buf.Bytes())
 	if err != nil {
 		return err
 	}
-	logrus.Debugf("w @ %d", w.bufferedLen())
+	logger.Debugf("w @ %d", w.bufferedLen())
 
 	return nil
 }
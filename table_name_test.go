@@ -87,3 +87,90 @@ func TestNameTable(t *testing.T) {
 		})
 	}
 }
+
+func TestNameRecords(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-BoldItalic.ttf")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Roboto-BoldItalic", fnt.PostScriptName())
+	assert.Equal(t, "Roboto", fnt.FamilyName())
+	assert.Equal(t, "Bold Italic", fnt.SubfamilyName())
+	assert.Equal(t, "Roboto Bold Italic", fnt.FullName())
+
+	records := fnt.NameRecords()
+	require.Len(t, records, 26)
+	found := false
+	for _, nr := range records {
+		if nr.PlatformID == 3 && nr.LanguageID == 0x409 && nr.NameID == 6 {
+			assert.Equal(t, uint16(1), nr.EncodingID)
+			assert.Equal(t, "Roboto-BoldItalic", nr.Value)
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	testcases := []struct {
+		record   nameRecord
+		expected string
+	}{
+		{nameRecord{platformID: 0, encodingID: 3, data: []byte{0, 'A', 0xD8, 0x3D, 0xDE, 0x00}}, "A\U0001F600"},
+		{nameRecord{platformID: 3, encodingID: 10, data: []byte{0, 'B', 0, 'c'}}, "Bc"},
+		{nameRecord{platformID: 1, encodingID: 0, data: []byte{'C', 0x8E}}, "Cé"},
+	}
+	for _, tcase := range testcases {
+		assert.Equal(t, tcase.expected, tcase.record.value())
+	}
+
+	// The Windows English name is preferred to the Macintosh name.
+	name := &nameTable{nameRecords: []*nameRecord{
+		{platformID: 1, encodingID: 0, languageID: 0, nameID: 1, data: []byte("Mac")},
+		{platformID: 3, encodingID: 1, languageID: 0x407, nameID: 1, data: encodeName(3, "German")},
+		{platformID: 3, encodingID: 1, languageID: 0x409, nameID: 1, data: encodeName(3, "English")},
+		{platformID: 1, encodingID: 0, languageID: 0, nameID: 2, data: []byte("Regular")},
+	}}
+	assert.Equal(t, "English", name.englishName(1))
+	assert.Equal(t, "Regular", name.englishName(2))
+	assert.Equal(t, "", name.englishName(4))
+	name.nameRecords = name.nameRecords[:2]
+	assert.Equal(t, "German", name.englishName(1))
+}
+
+func TestSetNameRecord(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	fnt.SetNameRecord(6, "Free-Sanső")
+	require.NoError(t, fnt.ApplySubsetPrefix("ABCDEF+"))
+	// Applying another tag replaces the tag.
+	require.NoError(t, fnt.ApplySubsetPrefix("GHIJKL+"))
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "GHIJKL+Free-Sanső", fnt.PostScriptName())
+	assert.Equal(t, "GHIJKL+FreeSans", fnt.FamilyName())
+	assert.Equal(t, "Medium", fnt.SubfamilyName())
+	assert.Equal(t, "GHIJKL+Free Sans", fnt.FullName())
+
+	var mac, win []string
+	for _, nr := range fnt.NameRecords() {
+		if nr.NameID != 6 {
+			continue
+		}
+		switch {
+		case nr.PlatformID == 1 && nr.EncodingID == 0 && nr.LanguageID == 0:
+			mac = append(mac, nr.Value)
+		case nr.PlatformID == 3 && nr.EncodingID == 1 && nr.LanguageID == 0x409:
+			win = append(win, nr.Value)
+		}
+	}
+	assert.Equal(t, []string{"GHIJKL+Free-Sans?"}, mac)
+	assert.Equal(t, []string{"GHIJKL+Free-Sanső"}, win)
+
+	for _, tag := range []string{"ABCDEF", "abcdef+", "ABCDE1+", "ABCDEFG+", ""} {
+		assert.Error(t, fnt.ApplySubsetPrefix(tag), tag)
+	}
+}
@@ -13,6 +13,32 @@ type offsetTable struct {
 	rangeShift    uint16
 }
 
+// Clone returns a copy of `t`.
+func (t *offsetTable) Clone() *offsetTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	return &dup
+}
+
+// newOffsetTable returns the offset table of an sfnt font with version `sfntVersion` and `numTables` tables,
+// with the binary search fields computed from the number of tables.
+func newOffsetTable(sfntVersion uint32, numTables int) *offsetTable {
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << uint(entrySelector)) * 16
+	return &offsetTable{
+		sfntVersion:   sfntVersion,
+		numTables:     uint16(numTables),
+		searchRange:   uint16(searchRange),
+		entrySelector: uint16(entrySelector),
+		rangeShift:    uint16(numTables*16 - searchRange),
+	}
+}
+
 // Size returns size of `t` in bytes.
 func (t *offsetTable) Size() int64 {
 	return 4 + 4*2 // 4+8=12
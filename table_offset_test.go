@@ -9,8 +9,6 @@ import (
 	"bytes"
 	"testing"
 
-	"github.com/sirupsen/logrus"
-
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -60,7 +58,7 @@ func TestOffsetTableReadWrite(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, tcase.expected, *fnt.ot)
 
-		logrus.Debug("Write offset table")
+		logger.Debugf("Write offset table")
 		// Marshall to buffer.
 		var buf bytes.Buffer
 		bw := newByteWriter(&buf)
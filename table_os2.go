@@ -5,10 +5,6 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 // os2Table represents the OS/2 metrics table. It consists of metrics and other data that are required.
 type os2Table struct {
 	// Version 0+
@@ -59,13 +55,23 @@ type os2Table struct {
 	usUpperOpticalPointSize uint16
 }
 
+// Clone returns a deep copy of `t`.
+func (t *os2Table) Clone() *os2Table {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	dup.panose10 = append([]uint8(nil), t.panose10...)
+	return &dup
+}
+
 func (f *font) parseOS2Table(r *byteReader) (*os2Table, error) {
 	_, has, err := f.seekToTable(r, "OS/2")
 	if err != nil {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("OS/2 table not present")
+		logger.Debugf("OS/2 table not present")
 		return nil, nil
 	}
 
@@ -76,7 +82,7 @@ func (f *font) parseOS2Table(r *byteReader) (*os2Table, error) {
 	}
 
 	if t.version > 10 {
-		logrus.Debug("OS/2 table version range error")
+		logger.Debugf("OS/2 table version range error")
 		return nil, errRangeCheck
 	}
 
@@ -213,3 +219,321 @@ func (f *font) writeOS2(w *byteWriter) error {
 	// version >= 5.
 	return w.write(t.usLowerOpticalPointSize, t.usUpperOpticalPointSize)
 }
+
+// os2UnicodeRange represents a Unicode block assigned to a bit of the OS/2 ulUnicodeRange fields.
+type os2UnicodeRange struct {
+	bit    uint
+	lo, hi rune
+}
+
+// os2UnicodeRanges lists the Unicode blocks for each ulUnicodeRange bit (OS/2 version 4+).
+// https://docs.microsoft.com/en-us/typography/opentype/spec/os2#ur
+var os2UnicodeRanges = []os2UnicodeRange{
+	{0, 0x0000, 0x007F}, {1, 0x0080, 0x00FF}, {2, 0x0100, 0x017F}, {3, 0x0180, 0x024F},
+	{4, 0x0250, 0x02AF}, {4, 0x1D00, 0x1D7F}, {4, 0x1D80, 0x1DBF},
+	{5, 0x02B0, 0x02FF}, {5, 0xA700, 0xA71F},
+	{6, 0x0300, 0x036F}, {6, 0x1DC0, 0x1DFF},
+	{7, 0x0370, 0x03FF}, {8, 0x2C80, 0x2CFF},
+	{9, 0x0400, 0x04FF}, {9, 0x0500, 0x052F}, {9, 0x2DE0, 0x2DFF}, {9, 0xA640, 0xA69F},
+	{10, 0x0530, 0x058F}, {11, 0x0590, 0x05FF}, {12, 0xA500, 0xA63F},
+	{13, 0x0600, 0x06FF}, {13, 0x0750, 0x077F},
+	{14, 0x07C0, 0x07FF}, {15, 0x0900, 0x097F}, {16, 0x0980, 0x09FF}, {17, 0x0A00, 0x0A7F},
+	{18, 0x0A80, 0x0AFF}, {19, 0x0B00, 0x0B7F}, {20, 0x0B80, 0x0BFF}, {21, 0x0C00, 0x0C7F},
+	{22, 0x0C80, 0x0CFF}, {23, 0x0D00, 0x0D7F}, {24, 0x0E00, 0x0E7F}, {25, 0x0E80, 0x0EFF},
+	{26, 0x10A0, 0x10FF}, {26, 0x2D00, 0x2D2F},
+	{27, 0x1B00, 0x1B7F}, {28, 0x1100, 0x11FF},
+	{29, 0x1E00, 0x1EFF}, {29, 0x2C60, 0x2C7F}, {29, 0xA720, 0xA7FF},
+	{30, 0x1F00, 0x1FFF},
+	{31, 0x2000, 0x206F}, {31, 0x2E00, 0x2E7F},
+	{32, 0x2070, 0x209F}, {33, 0x20A0, 0x20CF}, {34, 0x20D0, 0x20FF}, {35, 0x2100, 0x214F},
+	{36, 0x2150, 0x218F},
+	{37, 0x2190, 0x21FF}, {37, 0x27F0, 0x27FF}, {37, 0x2900, 0x297F}, {37, 0x2B00, 0x2BFF},
+	{38, 0x2200, 0x22FF}, {38, 0x2A00, 0x2AFF}, {38, 0x27C0, 0x27EF}, {38, 0x2980, 0x29FF},
+	{39, 0x2300, 0x23FF}, {40, 0x2400, 0x243F}, {41, 0x2440, 0x245F}, {42, 0x2460, 0x24FF},
+	{43, 0x2500, 0x257F}, {44, 0x2580, 0x259F}, {45, 0x25A0, 0x25FF}, {46, 0x2600, 0x26FF},
+	{47, 0x2700, 0x27BF}, {48, 0x3000, 0x303F}, {49, 0x3040, 0x309F},
+	{50, 0x30A0, 0x30FF}, {50, 0x31F0, 0x31FF},
+	{51, 0x3100, 0x312F}, {51, 0x31A0, 0x31BF},
+	{52, 0x3130, 0x318F}, {53, 0xA840, 0xA87F}, {54, 0x3200, 0x32FF}, {55, 0x3300, 0x33FF},
+	{56, 0xAC00, 0xD7AF}, {57, 0x10000, 0x10FFFF}, {58, 0x10900, 0x1091F},
+	{59, 0x4E00, 0x9FFF}, {59, 0x2E80, 0x2EFF}, {59, 0x2F00, 0x2FDF}, {59, 0x2FF0, 0x2FFF},
+	{59, 0x3400, 0x4DBF}, {59, 0x20000, 0x2A6DF}, {59, 0x3190, 0x319F},
+	{60, 0xE000, 0xF8FF},
+	{61, 0x31C0, 0x31EF}, {61, 0xF900, 0xFAFF}, {61, 0x2F800, 0x2FA1F},
+	{62, 0xFB00, 0xFB4F}, {63, 0xFB50, 0xFDFF}, {64, 0xFE20, 0xFE2F},
+	{65, 0xFE10, 0xFE1F}, {65, 0xFE30, 0xFE4F},
+	{66, 0xFE50, 0xFE6F}, {67, 0xFE70, 0xFEFF}, {68, 0xFF00, 0xFFEF}, {69, 0xFFF0, 0xFFFF},
+	{70, 0x0F00, 0x0FFF}, {71, 0x0700, 0x074F}, {72, 0x0780, 0x07BF}, {73, 0x0D80, 0x0DFF},
+	{74, 0x1000, 0x109F},
+	{75, 0x1200, 0x137F}, {75, 0x1380, 0x139F}, {75, 0x2D80, 0x2DDF},
+	{76, 0x13A0, 0x13FF}, {77, 0x1400, 0x167F}, {78, 0x1680, 0x169F}, {79, 0x16A0, 0x16FF},
+	{80, 0x1780, 0x17FF}, {80, 0x19E0, 0x19FF},
+	{81, 0x1800, 0x18AF}, {82, 0x2800, 0x28FF},
+	{83, 0xA000, 0xA48F}, {83, 0xA490, 0xA4CF},
+	{84, 0x1700, 0x171F}, {84, 0x1720, 0x173F}, {84, 0x1740, 0x175F}, {84, 0x1760, 0x177F},
+	{85, 0x10300, 0x1032F}, {86, 0x10330, 0x1034F}, {87, 0x10400, 0x1044F},
+	{88, 0x1D000, 0x1D0FF}, {88, 0x1D100, 0x1D1FF}, {88, 0x1D200, 0x1D24F},
+	{89, 0x1D400, 0x1D7FF},
+	{90, 0xF0000, 0xFFFFD}, {90, 0x100000, 0x10FFFD},
+	{91, 0xFE00, 0xFE0F}, {91, 0xE0100, 0xE01EF},
+	{92, 0xE0000, 0xE007F}, {93, 0x1900, 0x194F}, {94, 0x1950, 0x197F}, {95, 0x1980, 0x19DF},
+	{96, 0x1A00, 0x1A1F}, {97, 0x2C00, 0x2C5F}, {98, 0x2D30, 0x2D7F}, {99, 0x4DC0, 0x4DFF},
+	{100, 0xA800, 0xA82F},
+	{101, 0x10000, 0x1007F}, {101, 0x10080, 0x100FF}, {101, 0x10100, 0x1013F},
+	{102, 0x10140, 0x1018F}, {103, 0x10380, 0x1039F}, {104, 0x103A0, 0x103DF},
+	{105, 0x10450, 0x1047F}, {106, 0x10480, 0x104AF}, {107, 0x10800, 0x1083F},
+	{108, 0x10A00, 0x10A5F}, {109, 0x1D300, 0x1D35F},
+	{110, 0x12000, 0x123FF}, {110, 0x12400, 0x1247F},
+	{111, 0x1D360, 0x1D37F}, {112, 0x1B80, 0x1BBF}, {113, 0x1C00, 0x1C4F}, {114, 0x1C50, 0x1C7F},
+	{115, 0xA880, 0xA8DF}, {116, 0xA900, 0xA92F}, {117, 0xA930, 0xA95F}, {118, 0xAA00, 0xAA5F},
+	{119, 0x10190, 0x101CF}, {120, 0x101D0, 0x101FF},
+	{121, 0x102A0, 0x102DF}, {121, 0x10280, 0x1029F}, {121, 0x10920, 0x1093F},
+	{122, 0x1F030, 0x1F09F}, {122, 0x1F000, 0x1F02F},
+}
+
+// os2CodePageRange represents characters that are characteristic for a code page assigned to
+// a bit of the OS/2 ulCodePageRange fields.
+type os2CodePageRange struct {
+	bit    uint
+	lo, hi rune
+}
+
+// os2CodePageRanges lists characteristic characters for each ulCodePageRange bit.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/os2#cpr
+var os2CodePageRanges = []os2CodePageRange{
+	{0, 0x00C0, 0x00FF},  // 1252 Latin 1.
+	{1, 0x0100, 0x017F},  // 1250 Latin 2: Eastern Europe.
+	{2, 0x0400, 0x045F},  // 1251 Cyrillic.
+	{3, 0x0384, 0x03CE},  // 1253 Greek.
+	{4, 0x011E, 0x011F},  // 1254 Turkish.
+	{4, 0x0130, 0x0131},  // 1254 Turkish.
+	{4, 0x015E, 0x015F},  // 1254 Turkish.
+	{5, 0x05D0, 0x05EA},  // 1255 Hebrew.
+	{6, 0x0621, 0x064A},  // 1256 Arabic.
+	{7, 0x0100, 0x017F},  // 1257 Windows Baltic.
+	{8, 0x01A0, 0x01B0},  // 1258 Vietnamese.
+	{8, 0x20AB, 0x20AB},  // 1258 Vietnamese.
+	{16, 0x0E01, 0x0E5B}, // 874 Thai.
+	{17, 0x3040, 0x30FF}, // 932 JIS/Japan.
+	{18, 0x4E00, 0x9FFF}, // 936 Chinese: Simplified chars.
+	{19, 0xAC00, 0xD7A3}, // 949 Korean Wansung.
+	{20, 0x4E00, 0x9FFF}, // 950 Chinese: Traditional chars.
+	{21, 0xAC00, 0xD7A3}, // 1361 Korean Johab.
+	{29, 0x0020, 0x007E}, // Macintosh Character Set (US Roman).
+	{30, 0x2500, 0x257F}, // OEM Character Set.
+	{31, 0xF020, 0xF0FF}, // Symbol Character Set.
+	{48, 0x0384, 0x03CE}, // 869 IBM Greek.
+	{49, 0x0400, 0x045F}, // 866 MS-DOS Russian.
+	{50, 0x00C0, 0x00FF}, // 865 MS-DOS Nordic.
+	{51, 0x0621, 0x064A}, // 864 Arabic.
+	{52, 0x00C0, 0x00FF}, // 863 MS-DOS Canadian French.
+	{53, 0x05D0, 0x05EA}, // 862 Hebrew.
+	{54, 0x00C0, 0x00FF}, // 861 MS-DOS Icelandic.
+	{55, 0x00C0, 0x00FF}, // 860 MS-DOS Portuguese.
+	{56, 0x011E, 0x015F}, // 857 IBM Turkish.
+	{57, 0x0400, 0x045F}, // 855 IBM Cyrillic.
+	{58, 0x0100, 0x017F}, // 852 Latin 2.
+	{59, 0x0100, 0x017F}, // 775 MS-DOS Baltic.
+	{60, 0x0384, 0x03CE}, // 737 Greek.
+	{61, 0x0621, 0x064A}, // 708 Arabic; ASMO 708.
+	{62, 0x00C0, 0x00FF}, // 850 WE/Latin 1.
+	{63, 0x2500, 0x257F}, // 437 US.
+}
+
+// setBit sets bit `bit` in the 128 bit field represented by `fields`.
+func setBit(fields *[4]uint32, bit uint) {
+	fields[bit/32] |= 1 << (bit % 32)
+}
+
+// updateOS2Ranges updates the usFirstCharIndex, usLastCharIndex, ulUnicodeRange and ulCodePageRange
+// fields of the OS/2 table based on the runes that are mapped in the cmap to glyphs for which `keep`
+// returns true. The range bits are set for the blocks and code pages with at least one rune mapped and
+// cleared for the others, including bits the original font did not advertise.
+func (f *font) updateOS2Ranges(keep func(gid GlyphIndex) bool) {
+	if f.os2 == nil || f.cmap == nil {
+		return
+	}
+	t := f.os2
+
+	runes := f.mappedRunes(keep)
+
+	var covered [4]uint32
+	var first, last rune = -1, -1
+	for _, r := range runes {
+		if first < 0 || r < first {
+			first = r
+		}
+		if r > last {
+			last = r
+		}
+		for _, ur := range os2UnicodeRanges {
+			if r >= ur.lo && r <= ur.hi {
+				setBit(&covered, ur.bit)
+			}
+		}
+	}
+
+	if first < 0 {
+		t.usFirstCharIndex, t.usLastCharIndex = 0, 0
+	} else {
+		if first > 0xFFFF {
+			first = 0xFFFF
+		}
+		if last > 0xFFFF {
+			last = 0xFFFF
+		}
+		t.usFirstCharIndex, t.usLastCharIndex = uint16(first), uint16(last)
+	}
+
+	t.ulUnicodeRange1 = covered[0]
+	t.ulUnicodeRange2 = covered[1]
+	t.ulUnicodeRange3 = covered[2]
+	t.ulUnicodeRange4 = covered[3]
+
+	if t.version < 1 {
+		return
+	}
+	var codePages [4]uint32
+	for _, r := range runes {
+		for _, cpr := range os2CodePageRanges {
+			if r >= cpr.lo && r <= cpr.hi {
+				setBit(&codePages, cpr.bit)
+			}
+		}
+	}
+	t.ulCodePageRange1 = codePages[0]
+	t.ulCodePageRange2 = codePages[1]
+}
+
+// EnsureOS2 synthesizes a version 4 OS/2 table for `f` if it has none, as is common for old Macintosh TrueType
+// fonts, since PDF viewers, Windows and Descriptor rely on its metrics. The fields are derived from the
+// available data: usWeightClass and fsSelection from the macStyle of the head table (normal width), the
+// typographic metrics from the hhea table, usWinAscent and usWinDescent from the bounding box of the head
+// table, the Unicode and code page ranges and the first and last character from the cmap table, xAvgCharWidth
+// from the hmtx table and sxHeight and sCapHeight from the outlines (see EstimateXHeight). The embedding is
+// unrestricted (fsType 0), as implied by a missing OS/2 table. Returns true if the table was synthesized.
+// An ErrRequiredTableMissing error is returned if `f` has no head table.
+func (f *Font) EnsureOS2() (bool, error) {
+	if f.os2 != nil {
+		return false, nil
+	}
+	if f.head == nil {
+		return false, ErrRequiredTableMissing{Tag: "head"}
+	}
+	upem := float64(f.head.unitsPerEm)
+	em := func(fraction float64) int16 {
+		return int16(otRound(fraction * upem))
+	}
+
+	t := &os2Table{
+		version:             4,
+		usWeightClass:       400,
+		usWidthClass:        5,
+		ySubscriptXSize:     em(0.65),
+		ySubscriptYSize:     em(0.6),
+		ySubscriptYOffset:   em(0.075),
+		ySuperscriptXSize:   em(0.65),
+		ySuperscriptYSize:   em(0.6),
+		ySuperscriptYOffset: em(0.35),
+		yStrikeoutSize:      em(0.05),
+		yStrikeoutPosition:  em(0.25),
+		panose10:            make([]uint8, 10),
+		achVendID:           makeTag("NONE"),
+		usBreakChar:         0x20,
+	}
+	if f.post != nil && f.post.underlineThickness > 0 {
+		t.yStrikeoutSize = int16(f.post.underlineThickness)
+	}
+
+	// Bit 0 of macStyle is bold and bit 1 italic, bit 0 of fsSelection is italic, bit 5 bold and bit 6 regular.
+	if f.head.macStyle&0x1 != 0 {
+		t.usWeightClass = 700
+		t.fsSelection |= 1 << 5
+	}
+	if f.head.macStyle&0x2 != 0 {
+		t.fsSelection |= 1 << 0
+	}
+	if t.fsSelection == 0 {
+		t.fsSelection = 1 << 6
+	}
+
+	if f.hhea != nil {
+		t.sTypoAscender = int16(f.hhea.ascender)
+		t.sTypoDescender = int16(f.hhea.descender)
+		t.sTypoLineGap = int16(f.hhea.lineGap)
+	}
+	if f.head.yMax > 0 {
+		t.usWinAscent = uint16(f.head.yMax)
+	}
+	if f.head.yMin < 0 {
+		t.usWinDescent = uint16(-int(f.head.yMin))
+	}
+
+	f.os2 = t
+	f.updateOS2Ranges(func(gid GlyphIndex) bool {
+		return true
+	})
+	f.updateAvgCharWidth()
+
+	t.sxHeight = int16(f.EstimateXHeight())
+	t.sCapHeight = int16(f.EstimateCapHeight())
+
+	f.markDirty("OS/2")
+	return true, nil
+}
+
+// EmbeddingPermissions are the embedding licensing rights of a font as specified by the fsType field of the
+// OS/2 table. Exactly one of Installable, Editable, PreviewAndPrint and RestrictedLicense is set.
+type EmbeddingPermissions struct {
+	// Installable fonts may be embedded and permanently installed on the remote system.
+	Installable bool
+	// Editable fonts may be embedded in documents and temporarily loaded for viewing, printing and editing.
+	Editable bool
+	// PreviewAndPrint fonts may be embedded in documents and temporarily loaded for viewing and printing only.
+	PreviewAndPrint bool
+	// RestrictedLicense fonts must not be embedded without permission of the legal owner.
+	RestrictedLicense bool
+	// NoSubsetting fonts must not be subsetted prior to embedding.
+	NoSubsetting bool
+	// BitmapOnly fonts may only be embedded as bitmaps, not as outlines.
+	BitmapOnly bool
+}
+
+// The bits of the fsType field of the OS/2 table.
+const (
+	fsTypeRestrictedLicense = 0x0002
+	fsTypePreviewAndPrint   = 0x0004
+	fsTypeEditable          = 0x0008
+	fsTypeNoSubsetting      = 0x0100
+	fsTypeBitmapOnly        = 0x0200
+)
+
+// EmbeddingPermissions returns the embedding permissions of `f` from the fsType field of the OS/2 table, to be
+// checked before embedding `f` in PDF documents or web fonts. If several of the usage permission bits are set,
+// as is invalid but found in old fonts, the least restrictive permission takes precedence as the specification
+// requires. Fonts without OS/2 table are Installable.
+func (f *Font) EmbeddingPermissions() EmbeddingPermissions {
+	if f.os2 == nil {
+		return EmbeddingPermissions{Installable: true}
+	}
+
+	fsType := f.os2.fsType
+	p := EmbeddingPermissions{
+		NoSubsetting: fsType&fsTypeNoSubsetting != 0,
+		BitmapOnly:   fsType&fsTypeBitmapOnly != 0,
+	}
+	switch {
+	case fsType&0x000F == 0:
+		p.Installable = true
+	case fsType&fsTypeEditable != 0:
+		p.Editable = true
+	case fsType&fsTypePreviewAndPrint != 0:
+		p.PreviewAndPrint = true
+	case fsType&fsTypeRestrictedLicense != 0:
+		p.RestrictedLicense = true
+	default:
+		// Only the reserved bit 0 is set.
+		p.Installable = true
+	}
+	return p
+}
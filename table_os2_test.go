@@ -0,0 +1,176 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubsetOS2Ranges(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	require.NotNil(t, fnt.os2)
+
+	// Original font advertises Latin, Greek and Cyrillic among others.
+	assert.NotZero(t, fnt.os2.ulUnicodeRange1&(1<<7))
+	assert.NotZero(t, fnt.os2.ulUnicodeRange1&(1<<9))
+
+	subfnt, err := fnt.SubsetKeepRunes([]rune("Hello"))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint16('H'), subfnt.os2.usFirstCharIndex)
+	assert.Equal(t, uint16('o'), subfnt.os2.usLastCharIndex)
+	assert.Equal(t, uint32(1), subfnt.os2.ulUnicodeRange1) // Basic Latin only.
+	assert.Zero(t, subfnt.os2.ulUnicodeRange2)
+	assert.Zero(t, subfnt.os2.ulUnicodeRange3)
+	assert.Zero(t, subfnt.os2.ulUnicodeRange4)
+	assert.Zero(t, subfnt.os2.ulCodePageRange1&^(1<<29))
+
+	// Original is unchanged.
+	assert.NotZero(t, fnt.os2.ulUnicodeRange1&(1<<9))
+
+	subfnt, err = fnt.SubsetKeepRunes([]rune("aπ"))
+	require.NoError(t, err)
+	assert.Equal(t, uint16('a'), subfnt.os2.usFirstCharIndex)
+	assert.Equal(t, uint16('π'), subfnt.os2.usLastCharIndex)
+	assert.Equal(t, uint32(1|1<<7), subfnt.os2.ulUnicodeRange1)
+}
+
+func TestSubsetOS2RangesAdded(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	// Source font not advertising any range.
+	fnt.os2.ulUnicodeRange1, fnt.os2.ulUnicodeRange2, fnt.os2.ulUnicodeRange3, fnt.os2.ulUnicodeRange4 = 0, 0, 0, 0
+	fnt.os2.ulCodePageRange1, fnt.os2.ulCodePageRange2 = 0, 0
+
+	subfnt, err := fnt.SubsetKeepRunes([]rune("aπж"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1|1<<7|1<<9), subfnt.os2.ulUnicodeRange1) // Basic Latin, Greek and Cyrillic.
+	assert.Zero(t, subfnt.os2.ulUnicodeRange2)
+	assert.Equal(t, uint32(1<<2|1<<3|1<<29), subfnt.os2.ulCodePageRange1&(1<<2|1<<3|1<<29))
+	assert.Zero(t, subfnt.os2.ulCodePageRange1&(1<<0|1<<1))
+}
+
+func TestRecomputeOS2Ranges(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+
+	// Manual cmap edit leaving only Greek letters.
+	subt := fnt.getCmapSubtable(3, 1)
+	require.NotNil(t, subt)
+	for _, key := range fnt.cmap.subtableKeys {
+		s := fnt.cmap.subtables[key]
+		if s == subt {
+			continue
+		}
+		delete(fnt.cmap.subtables, key)
+	}
+	fnt.cmap.subtableKeys = []string{"4,3,1"}
+	subt.cmap = map[rune]GlyphIndex{'α': subt.cmap['α'], 'ω': subt.cmap['ω']}
+
+	require.NoError(t, fnt.RecomputeOS2Ranges())
+	assert.Equal(t, uint16('α'), fnt.os2.usFirstCharIndex)
+	assert.Equal(t, uint16('ω'), fnt.os2.usLastCharIndex)
+	assert.Equal(t, uint32(1<<7), fnt.os2.ulUnicodeRange1)
+	assert.Zero(t, fnt.os2.ulUnicodeRange2)
+
+	fnt.os2 = nil
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "OS/2"}, fnt.RecomputeOS2Ranges())
+}
+
+func TestEmbeddingPermissions(t *testing.T) {
+	testcases := []struct {
+		fsType   uint16
+		expected EmbeddingPermissions
+	}{
+		{0x0000, EmbeddingPermissions{Installable: true}},
+		{0x0002, EmbeddingPermissions{RestrictedLicense: true}},
+		{0x0004, EmbeddingPermissions{PreviewAndPrint: true}},
+		{0x0008, EmbeddingPermissions{Editable: true}},
+		// The least restrictive permission takes precedence.
+		{0x000E, EmbeddingPermissions{Editable: true}},
+		{0x0006, EmbeddingPermissions{PreviewAndPrint: true}},
+		{0x0302, EmbeddingPermissions{RestrictedLicense: true, NoSubsetting: true, BitmapOnly: true}},
+		{0x0100, EmbeddingPermissions{Installable: true, NoSubsetting: true}},
+	}
+	for _, tcase := range testcases {
+		fnt := &Font{font: &font{os2: &os2Table{fsType: tcase.fsType}}}
+		assert.Equal(t, tcase.expected, fnt.EmbeddingPermissions(), "fsType 0x%04X", tcase.fsType)
+	}
+	assert.Equal(t, EmbeddingPermissions{Installable: true}, (&Font{font: &font{}}).EmbeddingPermissions())
+
+	fnt, err := ParseFile("./testdata/wts11.ttf")
+	require.NoError(t, err)
+	assert.Equal(t, EmbeddingPermissions{PreviewAndPrint: true}, fnt.EmbeddingPermissions())
+
+	fnt, err = ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt = &Font{font: fnt.font.clone()}
+	fnt.os2.fsType = 0x0104
+	_, err = fnt.SubsetKeepRunes([]rune("AB"))
+	assert.Equal(t, ErrSubsettingNotAllowed{FsType: 0x0104}, err)
+	_, _, err = fnt.Subset([]GlyphIndex{0, 1})
+	assert.Equal(t, ErrSubsettingNotAllowed{FsType: 0x0104}, err)
+
+	subfnt, _, err := fnt.SubsetWithOptions([]GlyphIndex{0, 1}, SubsetOptions{IgnoreEmbeddingPermissions: true})
+	require.NoError(t, err)
+	assert.True(t, subfnt.EmbeddingPermissions().NoSubsetting)
+}
+
+func TestEnsureOS2(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	orig := fnt.os2
+
+	// Fonts with an OS/2 table are left alone.
+	synthesized, err := fnt.EnsureOS2()
+	require.NoError(t, err)
+	assert.False(t, synthesized)
+	assert.Equal(t, orig, fnt.os2)
+
+	fnt.os2 = nil
+	synthesized, err = fnt.EnsureOS2()
+	require.NoError(t, err)
+	require.True(t, synthesized)
+	os2 := fnt.os2
+	assert.Equal(t, uint16(4), os2.version)
+	assert.Equal(t, uint16(400), os2.usWeightClass)
+	assert.Equal(t, uint16(5), os2.usWidthClass)
+	assert.Equal(t, uint16(1<<6), os2.fsSelection)
+	assert.Equal(t, int16(fnt.hhea.ascender), os2.sTypoAscender)
+	assert.Equal(t, int16(fnt.hhea.descender), os2.sTypoDescender)
+	assert.Equal(t, fnt.head.yMax, int16(os2.usWinAscent))
+	assert.Equal(t, -fnt.head.yMin, int16(os2.usWinDescent))
+	assert.Equal(t, orig.usLastCharIndex, os2.usLastCharIndex)
+	assert.True(t, os2.xAvgCharWidth > 0 && int(os2.xAvgCharWidth) < int(fnt.head.unitsPerEm))
+	assert.NotZero(t, os2.ulUnicodeRange1&(1<<0), "Basic Latin")
+	assert.NotZero(t, os2.ulUnicodeRange1&(1<<7), "Greek")
+	assert.NotZero(t, os2.ulUnicodeRange1&(1<<9), "Cyrillic")
+	assert.Zero(t, os2.ulUnicodeRange2&(1<<(59-32)), "CJK")
+	assert.NotZero(t, os2.ulCodePageRange1&(1<<0), "Latin 1")
+	assert.Equal(t, fnt.EstimateCapHeight(), int(os2.sCapHeight))
+	assert.Equal(t, EmbeddingPermissions{Installable: true}, fnt.EmbeddingPermissions())
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	written, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(96), written.trec.trMap["OS/2"].length)
+	assert.Equal(t, os2, written.os2)
+
+	// Bold italic from the head table.
+	fnt.os2 = nil
+	fnt.head.macStyle = 0x3
+	_, err = fnt.EnsureOS2()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(700), fnt.os2.usWeightClass)
+	assert.Equal(t, uint16(1<<5|1<<0), fnt.os2.fsSelection)
+}
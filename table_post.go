@@ -7,8 +7,7 @@ package unitype
 
 import (
 	"errors"
-
-	"github.com/sirupsen/logrus"
+	"math"
 )
 
 // postTable represents a PostScript (post) table.
@@ -45,6 +44,29 @@ type postTable struct {
 	glyphNames []GlyphName // len = glyphNames, index is GlyphID (GID), glyphNames[GlyphID] -> GlyphName.
 }
 
+// Clone returns a deep copy of `t`.
+func (t *postTable) Clone() *postTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	dup.glyphNameIndex = append([]uint16(nil), t.glyphNameIndex...)
+	dup.offsets = append([]int8(nil), t.offsets...)
+	dup.glyphNames = append([]GlyphName(nil), t.glyphNames...)
+	return &dup
+}
+
+// withoutNames returns a copy of `t` as a version 3.0 table, with the header fields but without glyph names.
+func (t *postTable) withoutNames() *postTable {
+	dup := *t
+	dup.version = 0x00030000
+	dup.numGlyphs = 0
+	dup.glyphNameIndex = nil
+	dup.offsets = nil
+	dup.glyphNames = nil
+	return &dup
+}
+
 /*
  See https://developer.apple.com/fonts/TrueType-Reference-Manual/RM06/Chap6post.html
  and https://docs.microsoft.com/en-us/typography/opentype/spec/post
@@ -52,12 +74,12 @@ type postTable struct {
 */
 
 func (f *font) parsePost(r *byteReader) (*postTable, error) {
-	logrus.Debug("Parsing post table")
+	logger.Debugf("Parsing post table")
 	if f.maxp == nil {
 		// maxp table required for numGlyphs check. Could probably be omitted, can consider
 		// if run into those cases where post is present and maxp is not (and all other information present).
-		logrus.Debug("Required maxp table missing")
-		return nil, errRequiredField
+		logger.Debugf("Required maxp table missing")
+		return nil, ErrRequiredTableMissing{Tag: "maxp"}
 	}
 
 	tr, has, err := f.seekToTable(r, "post")
@@ -65,7 +87,7 @@ func (f *font) parsePost(r *byteReader) (*postTable, error) {
 		return nil, err
 	}
 	if !has {
-		logrus.Debug("Post table not present")
+		logger.Debugf("Post table not present")
 		return nil, nil
 	}
 
@@ -81,49 +103,50 @@ func (f *font) parsePost(r *byteReader) (*postTable, error) {
 		return nil, err
 	}
 
-	logrus.Debugf("Version: %v %v 0x%X", t.version, t.version.Float64(), t.version)
+	logger.Debugf("Version: %v %v 0x%X", t.version, t.version.Float64(), t.version)
 	switch uint32(t.version) {
 	case 0x00010000: // 1.0 - font files contains exactly the 258 standard Macintosh glyphs.
-		if t.numGlyphs != 258 {
-			logrus.Debug("Should have the mac number of glyph names")
+		if f.maxp.numGlyphs != 258 {
+			logger.Debugf("Should have the mac number of glyph names")
 			// TODO(gunnsth): If this is too strict, can just set the first 258 glyphnames.
 			return nil, errRangeCheck
 		}
-		t.glyphNames = make([]GlyphName, int(t.numGlyphs))
+		t.glyphNames = make([]GlyphName, len(macGlyphNames))
 		for i := range macGlyphNames {
 			t.glyphNames[i] = macGlyphNames[i]
 		}
 
 	case 0x00020000: // 2.0
-		logrus.Trace("Version: 2.0")
+		logger.Tracef("Version: 2.0")
 		err = r.read(&t.numGlyphs)
 		if err != nil {
 			return nil, err
 		}
-		logrus.Debugf("numGlyphs: %d", t.numGlyphs)
+		logger.Debugf("numGlyphs: %d", t.numGlyphs)
 		if t.numGlyphs != f.maxp.numGlyphs {
-			logrus.Debugf("post numGlyphs != maxp.numGlyphs (%d != %d)", t.numGlyphs, f.maxp.numGlyphs)
+			logger.Debugf("post numGlyphs != maxp.numGlyphs (%d != %d)", t.numGlyphs, f.maxp.numGlyphs)
 			return nil, errRangeCheck
 		}
 		err = r.readSlice(&t.glyphNameIndex, int(t.numGlyphs))
 		if err != nil {
 			return nil, err
 		}
+		// The number of names in the string pool is given by the highest referenced index.
 		newGlyphs := 0
 		for _, ni := range t.glyphNameIndex {
-			if ni >= 258 && ni <= 32767 {
-				newGlyphs++
+			if ni >= 258 && ni <= 32767 && int(ni)-257 > newGlyphs {
+				newGlyphs = int(ni) - 257
 			}
 		}
-		logrus.Tracef("newGlyphs: %d", newGlyphs)
+		logger.Tracef("newGlyphs: %d", newGlyphs)
 		var names []string
 		for i := 0; i < newGlyphs; i++ {
 			if r.Offset()-start >= int64(tr.length) {
-				logrus.Debug("ERROR: Reading outside post table")
-				logrus.Debugf("%d > %d", r.Offset()-start, tr.length)
+				logger.Debugf("ERROR: Reading outside post table")
+				logger.Debugf("%d > %d", r.Offset()-start, tr.length)
 				return nil, errors.New("reading outside table")
 			}
-			var numChars int8
+			var numChars uint8
 			err = r.read(&numChars)
 			if err != nil {
 				return nil, err
@@ -135,14 +158,14 @@ func (f *font) parsePost(r *byteReader) (*postTable, error) {
 			name := make([]byte, numChars)
 			err = r.readBytes(&name, int(numChars))
 			if err != nil {
-				logrus.Debugf("ERROR: %v", err)
+				logger.Debugf("ERROR: %v", err)
 				return nil, err
 			}
 
 			names = append(names, string(name))
 		}
 		if len(names) != newGlyphs {
-			logrus.Debugf("newGlyphs != len(names) (%d != %d)", len(names), newGlyphs)
+			logger.Debugf("newGlyphs != len(names) (%d != %d)", len(names), newGlyphs)
 			return nil, errors.New("mismatching number of names loaded")
 		}
 
@@ -156,25 +179,25 @@ func (f *font) parsePost(r *byteReader) (*postTable, error) {
 			} else if ni <= 32767 {
 				ni -= 258
 				if int(ni) >= len(names) {
-					logrus.Debugf("ERROR: Glyph %d referring to outside name list (%d)", i, ni)
+					logger.Debugf("ERROR: Glyph %d referring to outside name list (%d)", i, ni)
 					// Let's be strict initially and slack if we find that it is needed.
 					return nil, errRangeCheck
 				}
 				name = GlyphName(names[ni])
 			}
-			logrus.Tracef("GID %d -> '%s'", i, name)
+			logger.Tracef("GID %d -> '%s'", i, name)
 			t.glyphNames[i] = name
 		}
-		logrus.Debugf("len(names) = %d", len(names))
+		logger.Debugf("len(names) = %d", len(names))
 
 	case 0x00025000: // 2.5
-		logrus.Trace("Version: 2.5")
+		logger.Tracef("Version: 2.5")
 		err = r.read(&t.numGlyphs)
 		if err != nil {
 			return nil, err
 		}
 		if t.numGlyphs != f.maxp.numGlyphs {
-			logrus.Debugf("post numGlyphs != maxp.numGlyphs (%d != %d)", t.numGlyphs, f.maxp.numGlyphs)
+			logger.Debugf("post numGlyphs != maxp.numGlyphs (%d != %d)", t.numGlyphs, f.maxp.numGlyphs)
 			return nil, errRangeCheck
 		}
 		err = r.readSlice(&t.offsets, int(t.numGlyphs))
@@ -185,17 +208,17 @@ func (f *font) parsePost(r *byteReader) (*postTable, error) {
 		for i := 0; i < int(t.numGlyphs); i++ {
 			nameIndex := i + 1 + int(t.offsets[i])
 			if nameIndex < 0 || nameIndex > 257 {
-				logrus.Debugf("ERROR: name index outside range (%d)", nameIndex)
+				logger.Debugf("ERROR: name index outside range (%d)", nameIndex)
 				continue
 			}
 			t.glyphNames[i] = macGlyphNames[nameIndex]
-			logrus.Tracef("2.5 I: %d -> %s", i, t.glyphNames[i])
+			logger.Tracef("2.5 I: %d -> %s", i, t.glyphNames[i])
 		}
 
 	case 0x00030000: // 3.0
-		logrus.Debug("Version 3.0 - no postscript data")
+		logger.Debugf("Version 3.0 - no postscript data")
 	default:
-		logrus.Debugf("Unsupported version of post (%d) - no post data loaded", t.version)
+		logger.Debugf("Unsupported version of post (%d) - no post data loaded", t.version)
 	}
 
 	return t, nil
@@ -207,16 +230,18 @@ func (f *font) writePost(w *byteWriter) error {
 	}
 	t := f.post
 
-	// TODO(gunnsth): Write out with v1.0 or v2.0.
 	version := t.version
-	if version != 0x00010000 {
+	switch {
+	case version == 0x00010000 && (f.maxp == nil || int(f.maxp.numGlyphs) == len(macGlyphNames)):
+	case (version == 0x00010000 || version == 0x00020000 || version == 0x00025000) && len(t.glyphNames) > 0:
+		// Glyph names are written out in the 2.0 format (2.5 is deprecated).
+		version = 0x00020000
+	default:
 		// Include no postscript data.
-		// TODO(gunnsth): support writing v2.0.
 		version = 0x00030000
-		t.version = version
 	}
 
-	err := w.write(t.version, t.italicAngle, t.underlinePosition, t.underlineThickness, t.isFixedPitch)
+	err := w.write(version, t.italicAngle, t.underlinePosition, t.underlineThickness, t.isFixedPitch)
 	if err != nil {
 		return err
 	}
@@ -225,5 +250,150 @@ func (f *font) writePost(w *byteWriter) error {
 		return err
 	}
 
+	if uint32(version) != 0x00020000 {
+		return nil
+	}
+
+	return f.writePostNames(w)
+}
+
+// writePostNames writes the glyph name index and string pool of a version 2.0 post table.
+// The index and pool are regenerated from the glyph names, so that names are only stored once
+// and standard Macintosh names are referenced by index. The post table of `f` is left unchanged.
+func (f *font) writePostNames(w *byteWriter) error {
+	t := f.post
+
+	numGlyphs := len(t.glyphNames)
+	if f.maxp != nil {
+		numGlyphs = int(f.maxp.numGlyphs)
+	}
+
+	macIndex := make(map[GlyphName]uint16, len(macGlyphNames))
+	for i, name := range macGlyphNames {
+		macIndex[name] = uint16(i)
+	}
+
+	poolIndex := map[GlyphName]uint16{}
+	var pool []GlyphName
+	glyphNameIndex := make([]uint16, numGlyphs)
+	for i := 0; i < numGlyphs && i < len(t.glyphNames); i++ {
+		name := t.glyphNames[i]
+		if len(name) == 0 {
+			continue
+		}
+		if ind, has := macIndex[name]; has {
+			glyphNameIndex[i] = ind
+			continue
+		}
+		ind, has := poolIndex[name]
+		if !has {
+			if len(name) > 255 || 258+len(pool) > 32767 {
+				logger.Debugf("Unable to store glyph name (%d) '%s'", i, name)
+				continue
+			}
+			ind = uint16(258 + len(pool))
+			poolIndex[name] = ind
+			pool = append(pool, name)
+		}
+		glyphNameIndex[i] = ind
+	}
+
+	err := w.write(uint16(numGlyphs))
+	if err != nil {
+		return err
+	}
+	err = w.writeSlice(glyphNameIndex)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range pool {
+		err = w.write(uint8(len(name)))
+		if err != nil {
+			return err
+		}
+		err = w.writeBytes([]byte(name))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// optimizePost trims the glyph names of the post table to the number of glyphs in the font and
+// selects the most compact version able to represent them.
+func (f *font) optimizePost() {
+	if f.post == nil {
+		return
+	}
+	t := f.post
+
+	if f.maxp != nil && len(t.glyphNames) > int(f.maxp.numGlyphs) {
+		t.glyphNames = t.glyphNames[:f.maxp.numGlyphs]
+	}
+	t.offsets = nil
+
+	hasNames := false
+	isMacOrdering := len(t.glyphNames) == len(macGlyphNames)
+	for i, name := range t.glyphNames {
+		if len(name) > 0 {
+			hasNames = true
+		}
+		if isMacOrdering && name != macGlyphNames[i] {
+			isMacOrdering = false
+		}
+	}
+
+	switch {
+	case !hasNames:
+		t.version = 0x00030000
+		t.glyphNames = nil
+		t.glyphNameIndex = nil
+	case isMacOrdering:
+		t.version = 0x00010000
+		t.glyphNameIndex = nil
+	default:
+		t.version = 0x00020000
+	}
+}
+
+// EnsurePost synthesizes a version 3.0 post table without glyph names for `f` if it has none, as is common for
+// subsetted fonts extracted from PDF documents. The italicAngle is derived from the caret slope of the hhea
+// table, the underline from the strikeout of the OS/2 table or else defaults of 1/20 em thick at 1/10 em below
+// the baseline, and isFixedPitch from IsMonospace. Returns true if the table was synthesized.
+// An ErrRequiredTableMissing error is returned if `f` has no head table.
+func (f *Font) EnsurePost() (bool, error) {
+	if f.post != nil {
+		return false, nil
+	}
+	if f.head == nil {
+		return false, ErrRequiredTableMissing{Tag: "head"}
+	}
+	f.post = f.synthesizePost()
+	f.markDirty("post")
+	f.resetGlyphNameMap()
+	return true, nil
+}
+
+// synthesizePost returns a version 3.0 post table for `f`, see EnsurePost. Requires the head table.
+func (f *Font) synthesizePost() *postTable {
+	upem := float64(f.head.unitsPerEm)
+	t := &postTable{
+		version:            0x00030000,
+		underlinePosition:  fword(-math.Floor(upem/10 + 0.5)),
+		underlineThickness: fword(math.Floor(upem/20 + 0.5)),
+	}
+	if f.hhea != nil && f.hhea.caretSlopeRise != 0 && f.hhea.caretSlopeRun != 0 {
+		// Slanted to the right for a positive run, i.e. a negative angle counter-clockwise from the vertical.
+		angle := -math.Atan(float64(f.hhea.caretSlopeRun)/float64(f.hhea.caretSlopeRise)) * 180 / math.Pi
+		t.italicAngle = fixed(math.Floor(angle*65536 + 0.5))
+	}
+	if f.os2 != nil && f.os2.yStrikeoutSize > 0 {
+		t.underlineThickness = fword(f.os2.yStrikeoutSize)
+	}
+	if f.IsMonospace() {
+		t.isFixedPitch = 1
+	}
+	return t
+}
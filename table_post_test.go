@@ -0,0 +1,85 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsurePost(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	orig := fnt.post
+
+	synthesized, err := fnt.EnsurePost()
+	require.NoError(t, err)
+	assert.False(t, synthesized)
+	assert.Equal(t, orig, fnt.post)
+
+	fnt.post = nil
+	synthesized, err = fnt.EnsurePost()
+	require.NoError(t, err)
+	require.True(t, synthesized)
+	assert.Equal(t, fixed(0x00030000), fnt.post.version)
+	assert.Equal(t, fixed(0), fnt.post.italicAngle)
+	assert.True(t, fnt.post.underlinePosition < 0)
+	assert.True(t, fnt.post.underlineThickness > 0)
+	assert.False(t, fnt.PostIsFixedPitch())
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	require.NoError(t, ValidateBytes(data))
+	written, err := ParseBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(32), written.trec.trMap["post"].length)
+	assert.Equal(t, fnt.post.underlinePosition, written.post.underlinePosition)
+
+	// The italic angle follows the caret slope.
+	fnt.post = nil
+	fnt.hhea.caretSlopeRise, fnt.hhea.caretSlopeRun = 1000, 212
+	_, err = fnt.EnsurePost()
+	require.NoError(t, err)
+	assert.InDelta(t, -11.97, fnt.post.italicAngle.Float64(), 0.01)
+}
+
+func TestWritePostUnchanged(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt, err = fnt.SubsetFirst(100)
+	require.NoError(t, err)
+	// Written as version 2.0 with the name index regenerated.
+	fnt.post.version = 0x00025000
+	fnt.post.glyphNameIndex = nil
+	orig := fnt.post.Clone()
+
+	// Fonts can be written concurrently.
+	outputs := make([][]byte, 4)
+	var wg sync.WaitGroup
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := fnt.Bytes()
+			assert.NoError(t, err)
+			outputs[i] = data
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, orig, fnt.post)
+	for _, data := range outputs[1:] {
+		assert.Equal(t, outputs[0], data)
+	}
+
+	written, err := ParseBytes(outputs[0])
+	require.NoError(t, err)
+	assert.Equal(t, fixed(0x00020000), written.post.version)
+	assert.Len(t, written.post.glyphNameIndex, 100)
+	assert.Equal(t, fnt.post.glyphNames, written.post.glyphNames)
+}
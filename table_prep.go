@@ -5,10 +5,6 @@
 
 package unitype
 
-import (
-	"github.com/sirupsen/logrus"
-)
-
 // prepTable represents a Control Value Program table (prep).
 // Consists of a set of TrueType instructions that will be executed whenever the font or point size
 // or transformation matrix change and before each glyph is interpreted.
@@ -18,13 +14,21 @@ type prepTable struct {
 	instructions []uint8
 }
 
+// Clone returns a deep copy of `t`.
+func (t *prepTable) Clone() *prepTable {
+	if t == nil {
+		return nil
+	}
+	return &prepTable{instructions: append([]uint8(nil), t.instructions...)}
+}
+
 func (f *font) parsePrep(r *byteReader) (*prepTable, error) {
 	tr, has, err := f.seekToTable(r, "prep")
 	if err != nil {
 		return nil, err
 	}
 	if !has || tr == nil {
-		logrus.Debug("prep table absent")
+		logger.Debugf("prep table absent")
 		return nil, nil
 	}
 
@@ -0,0 +1,211 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+// rawTable represents a font table that is not modelled, such as GSUB, GPOS or gasp.
+// The table data is kept as is and written out verbatim.
+type rawTable struct {
+	tableTag tag
+	data     []byte
+	checksum uint32 // original checksum from the table record.
+}
+
+// modelledTables are the tables that are parsed into a data model and written out from it.
+var modelledTables = map[string]bool{
+	"head": true,
+	"maxp": true,
+	"hhea": true,
+	"hmtx": true,
+	"vhea": true,
+	"vmtx": true,
+	"loca": true,
+	"glyf": true,
+	"prep": true,
+	"cvt":  true,
+	"fpgm": true,
+	"name": true,
+	"OS/2": true,
+	"post": true,
+	"cmap": true,
+}
+
+// glyphCountTables are tables not modelled that contain an array of data per glyph and thus become invalid
+// when the number of glyphs changes.
+var glyphCountTables = map[string]bool{
+	"hdmx": true,
+	"LTSH": true,
+}
+
+// glyphIndependentTables are tables not modelled that do not reference glyphs and thus remain valid when the
+// glyphs are renumbered.
+var glyphIndependentTables = map[string]bool{
+	"fvar": true,
+	"avar": true,
+	"STAT": true,
+	"MVAR": true,
+	"cvar": true,
+	"CPAL": true,
+}
+
+// parseRawTables loads the data of all tables in `r` that are not modelled, in the order of the table records.
+func (f *font) parseRawTables(r *byteReader) ([]*rawTable, error) {
+	var tables []*rawTable
+	for _, tr := range f.trec.list {
+		name := tr.tableTag.String()
+		if modelledTables[name] {
+			continue
+		}
+
+		logger.Debugf("Loading raw table %s (%d bytes)", name, tr.length)
+		t, err := f.parseRawTable(r, tr)
+		if err != nil {
+			err = f.tolerateParseError(name, wrapParseError(name, r.Offset(), err))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// parseRawTable loads the data of the table of record `tr` in `r`.
+func (f *font) parseRawTable(r *byteReader, tr *tableRecord) (*rawTable, error) {
+	f.traceTable(tr)
+	err := f.checkTableRecord(r, tr)
+	if err != nil {
+		return nil, err
+	}
+	err = r.SeekTo(int64(tr.offset))
+	if err != nil {
+		return nil, err
+	}
+	t := &rawTable{
+		tableTag: tr.tableTag,
+		checksum: tr.checksum,
+	}
+	err = r.readBytes(&t.data, int(tr.length))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// writeRawTable writes raw table `t` to `w`.
+func (f *font) writeRawTable(w *byteWriter, t *rawTable) error {
+	return w.writeBytes(t.data)
+}
+
+// pruneRawTable removes the raw table `name` from `f`. Returns true if the table was found.
+func (f *font) pruneRawTable(name string) bool {
+	for i, t := range f.rawTables {
+		if t.tableTag.String() == name {
+			f.rawTables = append(f.rawTables[:i:i], f.rawTables[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// pruneGlyphCountTables removes the tables depending on the number of glyphs, the glyphCountTables and sbix, for
+// adding glyphs to `f`.
+func (f *font) pruneGlyphCountTables() {
+	for name := range glyphCountTables {
+		if f.pruneRawTable(name) {
+			logger.Debugf("Dropping %s table as glyphs are added", name)
+		}
+	}
+	if f.sbix != nil {
+		logger.Debugf("Dropping sbix table as glyphs are added")
+		f.pruneRawTable("sbix")
+		f.sbix = nil
+	}
+}
+
+// hasTable returns true if `f` contains the table `tag`, modelled or not.
+func (f *font) hasTable(tag string) bool {
+	switch tag {
+	case "head":
+		return f.head != nil
+	case "maxp":
+		return f.maxp != nil
+	case "hhea":
+		return f.hhea != nil
+	case "hmtx":
+		return f.hmtx != nil
+	case "vhea":
+		return f.vhea != nil
+	case "vmtx":
+		return f.vmtx != nil
+	case "loca":
+		return f.loca != nil
+	case "glyf":
+		return f.glyf != nil
+	case "prep":
+		return f.prep != nil
+	case "cvt":
+		return f.cvt != nil
+	case "fpgm":
+		return f.fpgm != nil
+	case "name":
+		return f.name != nil
+	case "OS/2":
+		return f.os2 != nil
+	case "post":
+		return f.post != nil
+	case "cmap":
+		return f.cmap != nil
+	}
+	for _, t := range f.rawTables {
+		if t.tableTag.String() == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tableTags returns the tags of the tables of `f`, modelled or not, in no particular order.
+func (f *font) tableTags() []string {
+	var tags []string
+	for tag := range modelledTables {
+		if f.hasTable(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, t := range f.rawTables {
+		tags = append(tags, t.tableTag.String())
+	}
+	return tags
+}
+
+// rawTableData returns the data of the raw table `name` in `f`, or nil if not present.
+func (f *font) rawTableData(name string) []byte {
+	for _, t := range f.rawTables {
+		if t.tableTag.String() == name {
+			return t.data
+		}
+	}
+	return nil
+}
+
+// setRawTableData sets the data of the raw table `name` in `f` to `data`, adding the table if not present.
+// The raw tables are not modified in place, so they may be shared with other fonts.
+func (f *font) setRawTableData(name string, data []byte) {
+	tables := make([]*rawTable, 0, len(f.rawTables)+1)
+	replaced := false
+	for _, t := range f.rawTables {
+		if t.tableTag.String() == name {
+			t = &rawTable{tableTag: t.tableTag, data: data}
+			replaced = true
+		}
+		tables = append(tables, t)
+	}
+	if !replaced {
+		tables = append(tables, &rawTable{tableTag: makeTag(name), data: data})
+	}
+	f.rawTables = tables
+}
@@ -0,0 +1,57 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawTablesReadWrite(t *testing.T) {
+	fnt, err := ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GDEF", "GPOS", "GSUB", "gasp", "hdmx"}, fnt.UnmodelledTables())
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, newfnt.rawTables, len(fnt.rawTables))
+	for i, rt := range fnt.rawTables {
+		name := rt.tableTag.String()
+		assert.Equal(t, rt.data, newfnt.rawTables[i].data, name)
+		assert.Equal(t, rt.checksum, newfnt.trec.trMap[name].checksum, name)
+	}
+
+	// Carried along when GIDs are maintained, except tables depending on the number of glyphs.
+	subfnt, err := fnt.SubsetKeepRunes([]rune("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GDEF", "GPOS", "GSUB", "gasp"}, subfnt.UnmodelledTables())
+
+	// Dropped when glyphs are renumbered.
+	gid, _ := fnt.LookupRune('a')
+	subfnt, _, err = fnt.Subset([]GlyphIndex{gid})
+	require.NoError(t, err)
+	assert.Empty(t, subfnt.UnmodelledTables())
+
+	// Explicit pruning.
+	fnt, err = ParseFile("./testdata/roboto/Roboto-Bold.ttf")
+	require.NoError(t, err)
+	require.NoError(t, fnt.PruneTables("GPOS", "gasp"))
+	assert.Equal(t, []string{"GDEF", "GSUB", "hdmx"}, fnt.UnmodelledTables())
+	buf.Reset()
+	require.NoError(t, fnt.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	newfnt, err = parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.False(t, newfnt.trec.HasTable("GPOS"))
+	assert.True(t, newfnt.trec.HasTable("GSUB"))
+}
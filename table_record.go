@@ -8,9 +8,8 @@ package unitype
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
-
-	"github.com/sirupsen/logrus"
 )
 
 // tableRecord represents table records, including name (tag) and file offset, size
@@ -37,6 +36,23 @@ type tableRecords struct {
 	trMap map[string]*tableRecord
 }
 
+// Clone returns a deep copy of `trs`.
+func (trs *tableRecords) Clone() *tableRecords {
+	if trs == nil {
+		return nil
+	}
+	dup := &tableRecords{
+		list:  make([]*tableRecord, len(trs.list)),
+		trMap: make(map[string]*tableRecord, len(trs.trMap)),
+	}
+	for i, tr := range trs.list {
+		trdup := *tr
+		dup.list[i] = &trdup
+		dup.trMap[tr.tableTag.String()] = &trdup
+	}
+	return dup
+}
+
 func (trs *tableRecords) Set(table string, offset int64, length int, checksum uint32) {
 	if trs.trMap == nil {
 		trs.trMap = map[string]*tableRecord{}
@@ -61,12 +77,23 @@ func (trs *tableRecords) Set(table string, offset int64, length int, checksum ui
 	trs.trMap[table] = newRec
 }
 
+// Remove removes the record of `table` from `trs`.
+func (trs *tableRecords) Remove(table string) {
+	for i := range trs.list {
+		if trs.list[i].tableTag.String() == table {
+			trs.list = append(trs.list[:i:i], trs.list[i+1:]...)
+			break
+		}
+	}
+	delete(trs.trMap, table)
+}
+
 func (f *font) parseTableRecords(r *byteReader) (*tableRecords, error) {
 	trs := &tableRecords{}
 
 	numTables := int(f.ot.numTables)
 	if numTables < 0 {
-		logrus.Debug("Invalid number of tables")
+		logger.Debugf("Invalid number of tables")
 		return nil, errRangeCheck
 	}
 
@@ -96,6 +123,11 @@ func (f *font) seekToTable(r *byteReader, tableName string) (tr *tableRecord, ha
 	if !has {
 		return tr, false, nil
 	}
+	f.traceTable(tr)
+	err = f.checkTableRecord(r, tr)
+	if err != nil {
+		return tr, false, err
+	}
 
 	err = r.SeekTo(int64(tr.offset))
 	if err != nil {
@@ -105,15 +137,37 @@ func (f *font) seekToTable(r *byteReader, tableName string) (tr *tableRecord, ha
 	return tr, true, nil
 }
 
+// traceTable records the location of the table of record `tr` as parsed, see Font.ParseTrace.
+func (f *font) traceTable(tr *tableRecord) {
+	f.parseTrace = append(f.parseTrace, TableTrace{
+		Tag:    tr.tableTag.String(),
+		Offset: int64(tr.offset),
+		Length: int64(tr.length),
+	})
+}
+
+// checkTableRecord returns an error if the table of record `tr` exceeds the maximum table size or the data of `r`.
+func (f *font) checkTableRecord(r *byteReader, tr *tableRecord) error {
+	if int64(tr.length) > f.opts.maxTableSize() {
+		return newLimitError("table size %d exceeds %d", tr.length, f.opts.maxTableSize())
+	}
+	if r.size >= 0 && int64(tr.offset)+int64(tr.length) > r.size {
+		logger.Debugf("%s table (offset %d, length %d) outside data (%d bytes)", tr.tableTag.String(), tr.offset,
+			tr.length, r.size)
+		return newOffsetError("table at offset 0x%x with length %d outside data", tr.offset, tr.length)
+	}
+	return nil
+}
+
 func (f *font) writeTableRecords(w *byteWriter) error {
 	if f.trec == nil {
-		logrus.Debug("Table records not set")
+		logger.Debugf("Table records not set")
 		return errRequiredField
 	}
 
-	logrus.Debugf("Writing (len:%d):", len(f.trec.list))
+	logger.Debugf("Writing (len:%d):", len(f.trec.list))
 	for _, tr := range f.trec.list {
-		logrus.Debugf("%s - off: %d (len: %d)", tr.tableTag.String(), tr.offset, tr.length)
+		logger.Debugf("%s - off: %d (len: %d)", tr.tableTag.String(), tr.offset, tr.length)
 		err := tr.write(w)
 		if err != nil {
 			return err
@@ -136,3 +190,10 @@ func (trs *tableRecords) String() string {
 	}
 	return buf.String()
 }
+
+// sortTableRecords sorts the table records of `trs` by tag, as required in the table directory.
+func sortTableRecords(trs *tableRecords) {
+	sort.Slice(trs.list, func(i, j int) bool {
+		return bytes.Compare(trs.list[i].tableTag[:], trs.list[j].tableTag[:]) < 0
+	})
+}
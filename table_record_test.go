@@ -9,8 +9,6 @@ import (
 	"bytes"
 	"testing"
 
-	"github.com/sirupsen/logrus"
-
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -133,7 +131,7 @@ func TestTableRecordsReadWrite(t *testing.T) {
 		}
 		assert.Equal(t, tcase.expected, fnt.trec.list)
 
-		logrus.Debug("Write table records")
+		logger.Debugf("Write table records")
 		// Marshall to buffer.
 		var buf bytes.Buffer
 		bw := newByteWriter(&buf)
@@ -0,0 +1,214 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// sbixTable represents the standard bitmap graphics (sbix) table, holding images such as PNGs per glyph in
+// strikes of different sizes, as used by Apple color emoji fonts. The table itself is preserved as a raw table
+// and written out verbatim, unless the glyphs are subsetted in which case it is re-encoded from the model.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/sbix
+type sbixTable struct {
+	version uint16
+	flags   uint16
+	strikes []sbixStrike
+}
+
+type sbixStrike struct {
+	ppem   uint16
+	ppi    uint16
+	glyphs [][]byte // glyph data record per glyph (origin offsets, graphic type and data), empty if none.
+}
+
+// sbixGlyphHeaderSize is the size of the origin offsets and graphic type preceding the data of the glyph
+// data records.
+const sbixGlyphHeaderSize = 8
+
+// parseSbix parses the sbix table from the data of the raw sbix table, if present.
+// Malformed sbix tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseSbix() *sbixTable {
+	data := f.rawTableData("sbix")
+	if data == nil {
+		logger.Debugf("sbix table absent")
+		return nil
+	}
+	if f.maxp == nil {
+		logger.Debugf("sbix table requires maxp - ignoring")
+		return nil
+	}
+
+	t, err := parseSbixData(data, int(f.maxp.numGlyphs))
+	if err != nil {
+		logger.Debugf("Error parsing sbix table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseSbixData parses sbix table `data` of a font with `numGlyphs` glyphs.
+func parseSbixData(data []byte, numGlyphs int) (*sbixTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	t := &sbixTable{}
+	var numStrikes uint32
+	err := r.read(&t.version, &t.flags, &numStrikes)
+	if err != nil {
+		return nil, err
+	}
+	if t.version != 1 {
+		logger.Debugf("Unsupported sbix version %d", t.version)
+		return nil, errRangeCheck
+	}
+	if 8+4*int64(numStrikes) > int64(len(data)) {
+		logger.Debugf("sbix strikes out of range")
+		return nil, errRangeCheck
+	}
+	var strikeOffsets []offset32
+	err = r.readSlice(&strikeOffsets, int(numStrikes))
+	if err != nil {
+		return nil, err
+	}
+
+	t.strikes = make([]sbixStrike, numStrikes)
+	for i, strikeOffset := range strikeOffsets {
+		err = r.SeekTo(int64(strikeOffset))
+		if err != nil {
+			return nil, err
+		}
+		s := &t.strikes[i]
+		err = r.read(&s.ppem, &s.ppi)
+		if err != nil {
+			return nil, err
+		}
+		if r.Offset()+4*int64(numGlyphs+1) > int64(len(data)) {
+			logger.Debugf("sbix strike %d out of range", i)
+			return nil, errRangeCheck
+		}
+		var glyphDataOffsets []offset32
+		err = r.readSlice(&glyphDataOffsets, numGlyphs+1)
+		if err != nil {
+			return nil, err
+		}
+
+		s.glyphs = make([][]byte, numGlyphs)
+		for gid := range s.glyphs {
+			start := int64(strikeOffset) + int64(glyphDataOffsets[gid])
+			end := int64(strikeOffset) + int64(glyphDataOffsets[gid+1])
+			if start == end {
+				continue
+			}
+			if end < start+sbixGlyphHeaderSize || end > int64(len(data)) {
+				logger.Debugf("sbix glyph data of glyph %d out of range", gid)
+				return nil, errRangeCheck
+			}
+			s.glyphs[gid] = data[start:end]
+		}
+	}
+	return t, nil
+}
+
+// encode returns the data of `t` as an sbix table.
+func (t *sbixTable) encode() []byte {
+	offset := 8 + 4*len(t.strikes)
+	b := appendUint16(nil, t.version, t.flags)
+	b = appendUint32(b, uint32(len(t.strikes)))
+	for _, s := range t.strikes {
+		b = appendUint32(b, uint32(offset))
+		offset += 4 + 4*(len(s.glyphs)+1)
+		for _, gd := range s.glyphs {
+			offset += len(gd)
+		}
+	}
+	for _, s := range t.strikes {
+		b = appendUint16(b, s.ppem, s.ppi)
+		glyphOffset := 4 + 4*(len(s.glyphs)+1)
+		b = appendUint32(b, uint32(glyphOffset))
+		for _, gd := range s.glyphs {
+			glyphOffset += len(gd)
+			b = appendUint32(b, uint32(glyphOffset))
+		}
+		for _, gd := range s.glyphs {
+			b = append(b, gd...)
+		}
+	}
+	return b
+}
+
+// sbixGraphicType returns the graphic type of the glyph data record `gd`, such as "png " or "dupe".
+func sbixGraphicType(gd []byte) string {
+	return string(gd[4:sbixGlyphHeaderSize])
+}
+
+// sbixDupeTarget returns the glyph whose image is reused by the glyph data record `gd` of graphic type "dupe".
+// Returns false if `gd` is not a valid dupe record.
+func sbixDupeTarget(gd []byte) (GlyphIndex, bool) {
+	if len(gd) < sbixGlyphHeaderSize+2 || sbixGraphicType(gd) != "dupe" {
+		return 0, false
+	}
+	return GlyphIndex(binary.BigEndian.Uint16(gd[sbixGlyphHeaderSize:])), true
+}
+
+// glyphData returns the glyph data record of glyph `gid` in `s`, resolving dupe records to the record of
+// the glyph referenced. Returns nil if `gid` has no image in `s`.
+func (s *sbixStrike) glyphData(gid GlyphIndex) []byte {
+	if int(gid) >= len(s.glyphs) {
+		return nil
+	}
+	gd := s.glyphs[gid]
+	if target, ok := sbixDupeTarget(gd); ok {
+		if int(target) >= len(s.glyphs) || target == gid {
+			return nil
+		}
+		gd = s.glyphs[target]
+		if _, ok := sbixDupeTarget(gd); ok {
+			logger.Debugf("Chained sbix dupe of glyph %d - ignoring", gid)
+			return nil
+		}
+	}
+	return gd
+}
+
+// selectGlyphs returns a copy of `t` with `numGlyphs` glyphs, with the images of the glyphs in `oldnew`
+// renumbered as per `oldnew`. Dupe records referencing glyphs that are not kept are replaced by a copy of
+// the image referenced.
+func (t *sbixTable) selectGlyphs(oldnew map[GlyphIndex]GlyphIndex, numGlyphs int) *sbixTable {
+	newt := &sbixTable{
+		version: t.version,
+		flags:   t.flags,
+		strikes: make([]sbixStrike, len(t.strikes)),
+	}
+	for i, s := range t.strikes {
+		ns := &newt.strikes[i]
+		ns.ppem = s.ppem
+		ns.ppi = s.ppi
+		ns.glyphs = make([][]byte, numGlyphs)
+		for oldgid, newgid := range oldnew {
+			if int(oldgid) >= len(s.glyphs) || int(newgid) >= numGlyphs {
+				continue
+			}
+			gd := s.glyphs[oldgid]
+			if target, ok := sbixDupeTarget(gd); ok {
+				if newtarget, has := oldnew[target]; has {
+					gd = append([]byte(nil), gd...)
+					binary.BigEndian.PutUint16(gd[sbixGlyphHeaderSize:], uint16(newtarget))
+				} else {
+					gd = s.glyphData(oldgid)
+				}
+			}
+			ns.glyphs[newgid] = gd
+		}
+	}
+	return newt
+}
+
+// setSbix sets the sbix table of `f` to `t` and replaces the raw sbix table by the encoding of `t`.
+func (f *font) setSbix(t *sbixTable) {
+	f.setRawTableData("sbix", t.encode())
+	f.sbix = t
+}
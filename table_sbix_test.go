@@ -0,0 +1,161 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sbixTestRecord returns an sbix glyph data record of `graphicType` with `data`.
+func sbixTestRecord(graphicType string, data ...byte) []byte {
+	return append([]byte{0, 1, 0, 2, graphicType[0], graphicType[1], graphicType[2], graphicType[3]}, data...)
+}
+
+// buildTestSbixFont returns FreeSans with an sbix table with strikes of 20 and 40 ppem: glyph 5 has images
+// in both strikes, glyph 6 reuses the image of glyph 5 and glyph 7 has a JPEG image in the larger strike.
+func buildTestSbixFont(t *testing.T) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	numGlyphs := int(fnt.maxp.numGlyphs)
+
+	small := make([][]byte, numGlyphs)
+	small[5] = sbixTestRecord("png ", 20, 20)
+	small[6] = sbixTestRecord("dupe", 0, 5)
+	large := make([][]byte, numGlyphs)
+	large[5] = sbixTestRecord("png ", 40, 40, 40)
+	large[6] = sbixTestRecord("dupe", 0, 5)
+	large[7] = sbixTestRecord("jpg ", 41)
+	sbix := &sbixTable{
+		version: 1,
+		flags:   1,
+		strikes: []sbixStrike{{ppem: 20, ppi: 72, glyphs: small}, {ppem: 40, ppi: 72, glyphs: large}},
+	}
+	fnt.rawTables = append(fnt.rawTables, &rawTable{tableTag: makeTag("sbix"), data: sbix.encode()})
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, fnt.sbix)
+	return fnt
+}
+
+func TestSbixGlyphBitmap(t *testing.T) {
+	fnt := buildTestSbixFont(t)
+
+	testcases := []struct {
+		gid      GlyphIndex
+		ppem     uint16
+		expected []byte
+		format   string
+	}{
+		{5, 10, []byte{20, 20}, "png"},
+		{5, 20, []byte{20, 20}, "png"},
+		{5, 21, []byte{40, 40, 40}, "png"},
+		{5, 100, []byte{40, 40, 40}, "png"},
+		{6, 12, []byte{20, 20}, "png"},
+		{7, 12, []byte{41}, "jpg"},
+		{8, 12, nil, ""},
+		{10000, 12, nil, ""},
+	}
+	for _, tcase := range testcases {
+		img, format, err := fnt.GlyphBitmap(tcase.gid, tcase.ppem)
+		require.NoError(t, err)
+		assert.Equal(t, tcase.expected, img, "%d %d", tcase.gid, tcase.ppem)
+		assert.Equal(t, tcase.format, format)
+	}
+
+	static, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	_, _, err = static.GlyphBitmap(5, 12)
+	assert.Error(t, err)
+}
+
+func TestSbixSubset(t *testing.T) {
+	fnt := buildTestSbixFont(t)
+
+	t.Run("Subset", func(t *testing.T) {
+		// The dupe is kept along with the glyph referenced.
+		subfnt, oldnew, err := fnt.Subset([]GlyphIndex{5, 6})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+		require.Len(t, subfnt.sbix.strikes, 2)
+		assert.Len(t, subfnt.sbix.strikes[0].glyphs, 3)
+		assert.Equal(t, sbixTestRecord("dupe", 0, byte(oldnew[5])), subfnt.sbix.strikes[1].glyphs[oldnew[6]])
+		img, _, err := subfnt.GlyphBitmap(oldnew[6], 40)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{40, 40, 40}, img)
+
+		// The dupe is replaced by the image of the glyph referenced if not kept.
+		subfnt, oldnew, err = fnt.Subset([]GlyphIndex{6})
+		require.NoError(t, err)
+		assert.Len(t, oldnew, 2)
+		assert.Equal(t, sbixTestRecord("png ", 20, 20), subfnt.sbix.strikes[0].glyphs[oldnew[6]])
+	})
+
+	t.Run("SubsetKeepIndices", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{7})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		img, _, err := subfnt.GlyphBitmap(7, 40)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{41}, img)
+		for _, gid := range []GlyphIndex{5, 6} {
+			img, _, err = subfnt.GlyphBitmap(gid, 40)
+			require.NoError(t, err)
+			assert.Nil(t, img)
+		}
+	})
+
+	t.Run("SubsetFirst", func(t *testing.T) {
+		subfnt, err := fnt.SubsetFirst(7)
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		require.NotNil(t, subfnt.sbix)
+		assert.Len(t, subfnt.sbix.strikes[1].glyphs, 7)
+		img, _, err := subfnt.GlyphBitmap(6, 40)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{40, 40, 40}, img)
+	})
+}
+
+func TestSbixParseErrors(t *testing.T) {
+	sbix := &sbixTable{
+		version: 1,
+		strikes: []sbixStrike{{ppem: 20, ppi: 72, glyphs: [][]byte{nil, sbixTestRecord("png ", 1, 2)}}},
+	}
+	data := sbix.encode()
+	parsed, err := parseSbixData(data, 2)
+	require.NoError(t, err)
+	assert.Equal(t, sbix, parsed)
+
+	_, err = parseSbixData(data[:len(data)-1], 2)
+	assert.Error(t, err)
+	_, err = parseSbixData(data, 3)
+	assert.Error(t, err)
+
+	// Glyph data records shorter than the header.
+	sbix.strikes[0].glyphs[1] = []byte{0, 0, 0}
+	_, err = parseSbixData(sbix.encode(), 2)
+	assert.Error(t, err)
+}
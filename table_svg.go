@@ -0,0 +1,234 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// svgTable represents the SVG table, holding SVG documents that define the color glyphs of ranges of glyphs.
+// The table itself is preserved as a raw table and written out verbatim, unless the glyphs are subsetted in
+// which case it is re-encoded from the model.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/svg
+type svgTable struct {
+	records []svgDocumentRecord // sorted by startGlyphID.
+	docs    [][]byte            // SVG documents, plain or gzip compressed.
+}
+
+// svgDocumentRecord associates a range of glyphs with a document. Records may share documents.
+type svgDocumentRecord struct {
+	startGlyphID GlyphIndex
+	endGlyphID   GlyphIndex
+	doc          int // index in docs.
+}
+
+const (
+	svgHeaderSize       = 10
+	svgDocumentRecSize  = 12
+	svgDocumentListSize = 2
+)
+
+// parseSVG parses the SVG table from the data of the raw SVG table, if present.
+// Malformed SVG tables are ignored as they are carried along verbatim regardless.
+func (f *font) parseSVG() *svgTable {
+	data := f.rawTableData("SVG")
+	if data == nil {
+		logger.Debugf("SVG table absent")
+		return nil
+	}
+
+	t, err := parseSVGData(data)
+	if err != nil {
+		logger.Debugf("Error parsing SVG table: %v - ignoring", err)
+		return nil
+	}
+	return t
+}
+
+// parseSVGData parses SVG table `data`.
+func parseSVGData(data []byte) (*svgTable, error) {
+	r := newByteReader(bytes.NewReader(data))
+
+	var version, numEntries uint16
+	var svgDocumentListOffset offset32
+	err := r.read(&version, &svgDocumentListOffset)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 {
+		logger.Debugf("Unsupported SVG table version %d", version)
+		return nil, errRangeCheck
+	}
+	listOffset := int64(svgDocumentListOffset)
+	err = r.SeekTo(listOffset)
+	if err != nil {
+		return nil, err
+	}
+	err = r.read(&numEntries)
+	if err != nil {
+		return nil, err
+	}
+	if r.Offset()+svgDocumentRecSize*int64(numEntries) > int64(len(data)) {
+		logger.Debugf("SVG document records out of range")
+		return nil, errRangeCheck
+	}
+
+	t := &svgTable{}
+	docIndex := map[[2]uint32]int{}
+	t.records = make([]svgDocumentRecord, numEntries)
+	for i := range t.records {
+		var startGlyphID, endGlyphID uint16
+		var svgDocOffset offset32
+		var svgDocLength uint32
+		err = r.read(&startGlyphID, &endGlyphID, &svgDocOffset, &svgDocLength)
+		if err != nil {
+			return nil, err
+		}
+		if endGlyphID < startGlyphID {
+			logger.Debugf("Invalid SVG document record range %d-%d", startGlyphID, endGlyphID)
+			return nil, errRangeCheck
+		}
+		start := listOffset + int64(svgDocOffset)
+		if start+int64(svgDocLength) > int64(len(data)) {
+			logger.Debugf("SVG document of glyphs %d-%d out of range", startGlyphID, endGlyphID)
+			return nil, errRangeCheck
+		}
+
+		key := [2]uint32{uint32(svgDocOffset), svgDocLength}
+		index, has := docIndex[key]
+		if !has {
+			index = len(t.docs)
+			docIndex[key] = index
+			t.docs = append(t.docs, data[start:start+int64(svgDocLength)])
+		}
+		t.records[i] = svgDocumentRecord{
+			startGlyphID: GlyphIndex(startGlyphID),
+			endGlyphID:   GlyphIndex(endGlyphID),
+			doc:          index,
+		}
+	}
+	return t, nil
+}
+
+// encode returns the data of `t` as an SVG table.
+func (t *svgTable) encode() []byte {
+	b := appendUint16(nil, 0)
+	b = appendUint32(b, svgHeaderSize, 0)
+	b = appendUint16(b, uint16(len(t.records)))
+
+	// The documents follow the records, offsets are relative to the document list.
+	docOffsets := make([]int, len(t.docs))
+	offset := svgDocumentListSize + svgDocumentRecSize*len(t.records)
+	for i, doc := range t.docs {
+		docOffsets[i] = offset
+		offset += len(doc)
+	}
+	for _, rec := range t.records {
+		b = appendUint16(b, uint16(rec.startGlyphID), uint16(rec.endGlyphID))
+		b = appendUint32(b, uint32(docOffsets[rec.doc]), uint32(len(t.docs[rec.doc])))
+	}
+	for _, doc := range t.docs {
+		b = append(b, doc...)
+	}
+	return b
+}
+
+// glyphDoc returns the document defining glyph `gid`, or nil if `gid` is not an SVG glyph.
+func (t *svgTable) glyphDoc(gid GlyphIndex) []byte {
+	i := sort.Search(len(t.records), func(i int) bool {
+		return t.records[i].endGlyphID >= gid
+	})
+	if i == len(t.records) || t.records[i].startGlyphID > gid {
+		return nil
+	}
+	return t.docs[t.records[i].doc]
+}
+
+// svgGlyphID matches the ids of the glyph elements of SVG documents, e.g. id="glyph12".
+var svgGlyphID = regexp.MustCompile(`\bid\s*=\s*(["'])glyph(\d+)(["'])`)
+
+// selectGlyphs returns a copy of `t` with only the SVG glyphs in `oldnew`, renumbered as per `oldnew`.
+// The ranges of the document records are split where glyphs are not kept and documents without kept glyphs
+// are dropped. The glyph ids in documents with renumbered glyphs are rewritten, in which case the document
+// is stored uncompressed, and the ids of glyphs not kept are renamed.
+func (t *svgTable) selectGlyphs(oldnew map[GlyphIndex]GlyphIndex) (*svgTable, error) {
+	newt := &svgTable{}
+	newDocIndex := make(map[int]int, len(t.docs))
+	renumbered := make(map[int]bool)
+	for _, rec := range t.records {
+		for gid := int(rec.startGlyphID); gid <= int(rec.endGlyphID); gid++ {
+			newgid, has := oldnew[GlyphIndex(gid)]
+			if !has {
+				continue
+			}
+			if int(newgid) != gid {
+				renumbered[rec.doc] = true
+			}
+			index, has := newDocIndex[rec.doc]
+			if !has {
+				index = len(newt.docs)
+				newDocIndex[rec.doc] = index
+				newt.docs = append(newt.docs, t.docs[rec.doc])
+			}
+			n := len(newt.records)
+			if n > 0 && newt.records[n-1].doc == index && newt.records[n-1].endGlyphID+1 == newgid {
+				newt.records[n-1].endGlyphID = newgid
+				continue
+			}
+			newt.records = append(newt.records, svgDocumentRecord{startGlyphID: newgid, endGlyphID: newgid, doc: index})
+		}
+	}
+	sort.SliceStable(newt.records, func(i, j int) bool {
+		return newt.records[i].startGlyphID < newt.records[j].startGlyphID
+	})
+
+	for old := range renumbered {
+		index := newDocIndex[old]
+		doc, err := svgDecompress(t.docs[old])
+		if err != nil {
+			return nil, err
+		}
+		newt.docs[index] = svgGlyphID.ReplaceAllFunc(doc, func(m []byte) []byte {
+			sub := svgGlyphID.FindSubmatch(m)
+			gid, err := strconv.Atoi(string(sub[2]))
+			if err != nil || gid > 0xFFFF {
+				return m
+			}
+			newgid, has := oldnew[GlyphIndex(gid)]
+			if !has {
+				// Renamed so as not to clash with the renumbered glyphs.
+				return []byte("id=" + string(sub[1]) + "unused-glyph" + string(sub[2]) + string(sub[3]))
+			}
+			return []byte("id=" + string(sub[1]) + "glyph" + strconv.Itoa(int(newgid)) + string(sub[3]))
+		})
+	}
+	return newt, nil
+}
+
+// svgDecompress returns `doc` decompressed if gzip compressed, otherwise `doc` as is.
+func svgDecompress(doc []byte) ([]byte, error) {
+	if !bytes.HasPrefix(doc, []byte{0x1f, 0x8b}) {
+		return doc, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(doc))
+	if err != nil {
+		logger.Debugf("Error decompressing SVG document: %v", err)
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// setSVG sets the SVG table of `f` to `t` and replaces the raw SVG table by the encoding of `t`.
+func (f *font) setSVG(t *svgTable) {
+	f.setRawTableData("SVG", t.encode())
+	f.svg = t
+}
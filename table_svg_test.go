@@ -0,0 +1,153 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSVGDoc0 = `<svg xmlns="http://www.w3.org/2000/svg"><path id="glyph5" d="M0 0h10v10z"/>` +
+		`<path id='glyph6' d="M0 0h20v20z"/><path id="glyph7" d="M0 0h30v30z"/></svg>`
+	testSVGDoc1 = `<svg xmlns="http://www.w3.org/2000/svg"><g id="glyph10"><use href="#p"/></g></svg>`
+)
+
+// buildTestSVG returns an SVG table with a document defining the glyphs 5-7 and a gzip compressed document
+// defining glyph 10.
+func buildTestSVG(t *testing.T) *svgTable {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(testSVGDoc1))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return &svgTable{
+		records: []svgDocumentRecord{
+			{startGlyphID: 5, endGlyphID: 7, doc: 0},
+			{startGlyphID: 10, endGlyphID: 10, doc: 1},
+		},
+		docs: [][]byte{[]byte(testSVGDoc0), buf.Bytes()},
+	}
+}
+
+// buildTestSVGFont returns FreeSans with the SVG table of buildTestSVG.
+func buildTestSVGFont(t *testing.T) *Font {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	fnt.rawTables = append(fnt.rawTables, &rawTable{tableTag: makeTag("SVG"), data: buildTestSVG(t).encode()})
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	require.NotNil(t, fnt.svg)
+	return fnt
+}
+
+func TestGlyphSVG(t *testing.T) {
+	fnt := buildTestSVGFont(t)
+
+	testcases := []struct {
+		gid      GlyphIndex
+		expected string
+	}{
+		{5, testSVGDoc0},
+		{7, testSVGDoc0},
+		{10, testSVGDoc1},
+		{4, ""},
+		{8, ""},
+		{11, ""},
+	}
+	for _, tcase := range testcases {
+		doc, err := fnt.GlyphSVG(tcase.gid)
+		require.NoError(t, err)
+		assert.Equal(t, tcase.expected, string(doc), "%d", tcase.gid)
+	}
+
+	static, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	_, err = static.GlyphSVG(5)
+	assert.Error(t, err)
+}
+
+func TestSVGSubset(t *testing.T) {
+	fnt := buildTestSVGFont(t)
+
+	t.Run("Subset", func(t *testing.T) {
+		subfnt, oldnew, err := fnt.Subset([]GlyphIndex{6, 10})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		require.NoError(t, ValidateBytes(data))
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		require.Equal(t, []svgDocumentRecord{
+			{startGlyphID: oldnew[6], endGlyphID: oldnew[6], doc: 0},
+			{startGlyphID: oldnew[10], endGlyphID: oldnew[10], doc: 1},
+		}, subfnt.svg.records)
+
+		// The glyph ids are rewritten and the ids of the glyphs not kept renamed.
+		doc, err := subfnt.GlyphSVG(oldnew[6])
+		require.NoError(t, err)
+		assert.Equal(t, `<svg xmlns="http://www.w3.org/2000/svg"><path id="unused-glyph5" d="M0 0h10v10z"/>`+
+			`<path id='glyph1' d="M0 0h20v20z"/><path id="unused-glyph7" d="M0 0h30v30z"/></svg>`, string(doc))
+		doc, err = subfnt.GlyphSVG(oldnew[10])
+		require.NoError(t, err)
+		assert.Equal(t, `<svg xmlns="http://www.w3.org/2000/svg"><g id="glyph2"><use href="#p"/></g></svg>`, string(doc))
+	})
+
+	t.Run("SubsetKeepIndices", func(t *testing.T) {
+		subfnt, err := fnt.SubsetKeepIndices([]GlyphIndex{5, 7})
+		require.NoError(t, err)
+		data, err := subfnt.Bytes()
+		require.NoError(t, err)
+		subfnt, err = ParseBytes(data)
+		require.NoError(t, err)
+
+		// The range is split and the document of glyph 10 is dropped.
+		assert.Equal(t, &svgTable{
+			records: []svgDocumentRecord{
+				{startGlyphID: 5, endGlyphID: 5, doc: 0},
+				{startGlyphID: 7, endGlyphID: 7, doc: 0},
+			},
+			docs: [][]byte{[]byte(testSVGDoc0)},
+		}, subfnt.svg)
+	})
+
+	t.Run("SubsetFirst", func(t *testing.T) {
+		subfnt, err := fnt.SubsetFirst(7)
+		require.NoError(t, err)
+		assert.Equal(t, &svgTable{
+			records: []svgDocumentRecord{{startGlyphID: 5, endGlyphID: 6, doc: 0}},
+			docs:    [][]byte{[]byte(testSVGDoc0)},
+		}, subfnt.svg)
+	})
+}
+
+func TestSVGParseErrors(t *testing.T) {
+	svg := buildTestSVG(t)
+	// Records sharing a document.
+	svg.records = append(svg.records, svgDocumentRecord{startGlyphID: 12, endGlyphID: 13, doc: 0})
+	data := svg.encode()
+	parsed, err := parseSVGData(data)
+	require.NoError(t, err)
+	assert.Equal(t, svg, parsed)
+
+	_, err = parseSVGData(data[:len(data)-1])
+	assert.Error(t, err)
+
+	// Invalid glyph range.
+	bad := append([]byte(nil), data...)
+	bad[15] = 4
+	_, err = parseSVGData(bad)
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+// vheaTable represents the vertical header table (vhea).
+// This table contains information for vertical layout and is the vertical counterpart of hhea.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/vhea
+type vheaTable struct {
+	version              fixed // 0x00010000 or 0x00011000.
+	vertTypoAscender     fword // ascent in version 1.0.
+	vertTypoDescender    fword // descent in version 1.0.
+	vertTypoLineGap      fword // lineGap in version 1.0.
+	advanceHeightMax     ufword
+	minTopSideBearing    fword
+	minBottomSideBearing fword
+	yMaxExtent           fword
+	caretSlopeRise       int16
+	caretSlopeRun        int16
+	caretOffset          int16
+	metricDataFormat     int16
+	numOfLongVerMetrics  uint16 // Number of vMetric entries in 'vmtx' table.
+}
+
+// Clone returns a copy of `t`.
+func (t *vheaTable) Clone() *vheaTable {
+	if t == nil {
+		return nil
+	}
+	dup := *t
+	return &dup
+}
+
+func (f *font) parseVhea(r *byteReader) (*vheaTable, error) {
+	_, has, err := f.seekToTable(r, "vhea")
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		logger.Debugf("vhea table absent")
+		return nil, nil
+	}
+
+	t := &vheaTable{}
+	err = r.read(&t.version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.read(&t.vertTypoAscender, &t.vertTypoDescender, &t.vertTypoLineGap)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.read(&t.advanceHeightMax, &t.minTopSideBearing, &t.minBottomSideBearing, &t.yMaxExtent)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.read(&t.caretSlopeRise, &t.caretSlopeRun, &t.caretOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip over reserved bytes.
+	err = r.Skip(4 * 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, r.read(&t.metricDataFormat, &t.numOfLongVerMetrics)
+}
+
+func (f *font) writeVhea(w *byteWriter) error {
+	if f.vhea == nil {
+		logger.Debugf("vhea is nil - nothing to write")
+		return nil
+	}
+
+	t := f.vhea
+	err := w.write(t.version)
+	if err != nil {
+		return err
+	}
+
+	err = w.write(t.vertTypoAscender, t.vertTypoDescender, t.vertTypoLineGap)
+	if err != nil {
+		return err
+	}
+
+	err = w.write(t.advanceHeightMax, t.minTopSideBearing, t.minBottomSideBearing, t.yMaxExtent)
+	if err != nil {
+		return err
+	}
+
+	err = w.write(t.caretSlopeRise, t.caretSlopeRun, t.caretOffset)
+	if err != nil {
+		return err
+	}
+
+	reserved := int16(0)
+	err = w.write(reserved, reserved, reserved, reserved)
+	if err != nil {
+		return err
+	}
+
+	return w.write(t.metricDataFormat, t.numOfLongVerMetrics)
+}
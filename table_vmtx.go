@@ -0,0 +1,133 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+// vmtxTable represents the vertical metrics table (vmtx), the vertical counterpart of hmtx.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/vmtx
+type vmtxTable struct {
+	vMetrics        []longVerMetric // length is numOfLongVerMetrics from vhea table.
+	topSideBearings []int16         // length is (numGlyphs - numOfLongVerMetrics) from maxp and vhea tables.
+}
+
+// Clone returns a deep copy of `t`.
+func (t *vmtxTable) Clone() *vmtxTable {
+	if t == nil {
+		return nil
+	}
+	return &vmtxTable{
+		vMetrics:        append([]longVerMetric(nil), t.vMetrics...),
+		topSideBearings: append([]int16(nil), t.topSideBearings...),
+	}
+}
+
+type longVerMetric struct {
+	advanceHeight uint16
+	tsb           int16
+}
+
+func (f *font) parseVmtx(r *byteReader) (*vmtxTable, error) {
+	_, has, err := f.seekToTable(r, "vmtx")
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		logger.Debugf("vmtx table absent")
+		return nil, nil
+	}
+	if f.maxp == nil || f.vhea == nil {
+		logger.Debugf("maxp or vhea table missing - ignoring vmtx")
+		return nil, nil
+	}
+
+	t := &vmtxTable{}
+
+	numOfLongVerMetrics := int(f.vhea.numOfLongVerMetrics)
+	for i := 0; i < numOfLongVerMetrics; i++ {
+		var lvm longVerMetric
+		err := r.read(&lvm.advanceHeight, &lvm.tsb)
+		if err != nil {
+			return nil, err
+		}
+
+		t.vMetrics = append(t.vMetrics, lvm)
+	}
+
+	tsbLen := int(f.maxp.numGlyphs) - numOfLongVerMetrics
+	if tsbLen > 0 {
+		err = r.readSlice(&t.topSideBearings, tsbLen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// optimizeVmtx optimizes the vmtx table by dropping trailing advance heights that are equal.
+func (f *font) optimizeVmtx() {
+	if f.vmtx == nil || f.vhea == nil {
+		return
+	}
+	i := len(f.vmtx.vMetrics) - 1
+	if i <= 0 {
+		return
+	}
+	lastHeight := f.vmtx.vMetrics[i].advanceHeight
+	j := i - 1
+	for j >= 0 && f.vmtx.vMetrics[j].advanceHeight == lastHeight {
+		j--
+	}
+	numStrip := i - j - 1
+	if numStrip == 0 {
+		return
+	}
+
+	f.vhea.numOfLongVerMetrics = uint16(j + 2)
+	var tsbPrepend []int16
+	for k := j + 2; k <= i; k++ {
+		tsbPrepend = append(tsbPrepend, f.vmtx.vMetrics[k].tsb)
+	}
+	f.vmtx.topSideBearings = append(tsbPrepend, f.vmtx.topSideBearings...)
+	f.vmtx.vMetrics = f.vmtx.vMetrics[0 : j+2]
+}
+
+// writeVmtx writes the font's vmtx table to `w`.
+func (f *font) writeVmtx(w *byteWriter) error {
+	if f.vmtx == nil || f.vhea == nil {
+		return nil
+	}
+
+	for _, lvm := range f.vmtx.vMetrics {
+		err := w.write(lvm.advanceHeight, lvm.tsb)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.writeSlice(f.vmtx.topSideBearings)
+}
+
+// getMetric returns the vertical metric of glyph `gid`. Glyphs beyond numOfLongVerMetrics share the
+// advance height of the last entry in vMetrics.
+func (t *vmtxTable) getMetric(gid GlyphIndex) longVerMetric {
+	if int(gid) < len(t.vMetrics) {
+		return t.vMetrics[gid]
+	}
+
+	var lvm longVerMetric
+	if len(t.vMetrics) > 0 {
+		lvm.advanceHeight = t.vMetrics[len(t.vMetrics)-1].advanceHeight
+	}
+	if i := int(gid) - len(t.vMetrics); i < len(t.topSideBearings) {
+		lvm.tsb = t.topSideBearings[i]
+	}
+	return lvm
+}
+
+// numGlyphs returns the number of glyphs covered by the vmtx table.
+func (t *vmtxTable) numGlyphs() int {
+	return len(t.vMetrics) + len(t.topSideBearings)
+}
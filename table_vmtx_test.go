@@ -0,0 +1,106 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTestVerticalMetrics adds vertical metrics to `fnt` with a full metric for the first 10 glyphs.
+func addTestVerticalMetrics(fnt *Font) {
+	numGlyphs := int(fnt.maxp.numGlyphs)
+	fnt.vhea = &vheaTable{
+		version:             0x00011000,
+		vertTypoAscender:    500,
+		vertTypoDescender:   -500,
+		advanceHeightMax:    1000,
+		caretSlopeRun:       1,
+		numOfLongVerMetrics: 10,
+	}
+	fnt.vmtx = &vmtxTable{}
+	for i := 0; i < 10; i++ {
+		fnt.vmtx.vMetrics = append(fnt.vmtx.vMetrics, longVerMetric{advanceHeight: uint16(900 + i), tsb: int16(i)})
+	}
+	for i := 10; i < numGlyphs; i++ {
+		fnt.vmtx.topSideBearings = append(fnt.vmtx.topSideBearings, int16(i))
+	}
+}
+
+func TestVerticalMetrics(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	require.Nil(t, fnt.vhea)
+	require.Nil(t, fnt.vmtx)
+
+	_, err = fnt.GlyphVerticalAdvance(1)
+	assert.Equal(t, ErrRequiredTableMissing{Tag: "vmtx"}, err)
+
+	addTestVerticalMetrics(fnt)
+
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	require.NoError(t, ValidateBytes(buf.Bytes()))
+	newfnt, err := parseTestBytes(buf.Bytes())
+	require.NoError(t, err)
+	require.NotNil(t, newfnt.vhea)
+	assert.Equal(t, *fnt.vhea, *newfnt.vhea)
+	assert.Equal(t, fnt.vmtx, newfnt.vmtx)
+	assert.NotContains(t, newfnt.UnmodelledTables(), "vmtx")
+
+	testcases := []struct {
+		gid     GlyphIndex
+		advance uint16
+		tsb     int16
+	}{
+		{0, 900, 0},
+		{9, 909, 9},
+		{10, 909, 10},
+		{200, 909, 200},
+	}
+	for _, tcase := range testcases {
+		advance, err := newfnt.GlyphVerticalAdvance(tcase.gid)
+		require.NoError(t, err)
+		assert.Equal(t, tcase.advance, advance)
+		tsb, err := newfnt.GlyphTSB(tcase.gid)
+		require.NoError(t, err)
+		assert.Equal(t, tcase.tsb, tsb)
+	}
+	_, err = newfnt.GlyphVerticalAdvance(GlyphIndex(newfnt.maxp.numGlyphs))
+	assert.Equal(t, errRangeCheck, err)
+
+	t.Run("SubsetFirst", func(t *testing.T) {
+		subfnt, err := newfnt.SubsetFirst(5)
+		require.NoError(t, err)
+		assert.Equal(t, 5, subfnt.vmtx.numGlyphs())
+		assert.Equal(t, uint16(5), subfnt.vhea.numOfLongVerMetrics)
+		advance, err := subfnt.GlyphVerticalAdvance(4)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(904), advance)
+
+		subfnt, err = newfnt.SubsetFirst(20)
+		require.NoError(t, err)
+		assert.Equal(t, 20, subfnt.vmtx.numGlyphs())
+		tsb, err := subfnt.GlyphTSB(19)
+		require.NoError(t, err)
+		assert.Equal(t, int16(19), tsb)
+	})
+
+	t.Run("Subset", func(t *testing.T) {
+		subfnt, _, err := newfnt.Subset([]GlyphIndex{0, 3, 50})
+		require.NoError(t, err)
+		assert.Equal(t, 3, subfnt.vmtx.numGlyphs())
+		assert.Equal(t, longVerMetric{advanceHeight: 903, tsb: 3}, subfnt.vmtx.getMetric(1))
+		assert.Equal(t, longVerMetric{advanceHeight: 909, tsb: 50}, subfnt.vmtx.getMetric(2))
+	})
+
+	require.NoError(t, newfnt.PruneTables("vmtx"))
+	assert.Nil(t, newfnt.vhea)
+	assert.Nil(t, newfnt.vmtx)
+}
@@ -5,8 +5,10 @@ import (
 	"os"
 
 	"github.com/sirupsen/logrus"
-
 	"github.com/spf13/cobra"
+
+	"github.com/unidoc/unitype"
+	"github.com/unidoc/unitype/logrusadapter"
 )
 
 const appName = "truecli"
@@ -20,14 +22,18 @@ var rootCmd = &cobra.Command{
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		ll, _ := cmd.Flags().GetString("loglevel")
 		switch ll {
-		case "debug":
+		case "debug", "trace":
 			logrus.SetFormatter(&logrus.TextFormatter{
 				ForceColors:            true,
 				FullTimestamp:          true,
 				DisableLevelTruncation: true,
 			})
 			logrus.SetLevel(logrus.DebugLevel)
+			if ll == "trace" {
+				logrus.SetLevel(logrus.TraceLevel)
+			}
 			logrus.SetOutput(os.Stdout)
+			unitype.SetLogger(logrusadapter.New(logrus.StandardLogger()))
 		}
 	},
 }
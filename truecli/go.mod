@@ -3,10 +3,14 @@ module github.com/unidoc/unitype/truecli
 go 1.11
 
 require (
-	github.com/unidoc/unitype v0.0.0-20200419001631-11c8f668ac91
 	github.com/sirupsen/logrus v1.5.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/unidoc/unitype v0.0.0-20200419001631-11c8f668ac91
+	github.com/unidoc/unitype/logrusadapter v0.0.0-00010101000000-000000000000
 )
 
-replace github.com/unidoc/unitype => ../
+replace (
+	github.com/unidoc/unitype => ../
+	github.com/unidoc/unitype/logrusadapter => ../logrusadapter
+)
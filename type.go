@@ -46,6 +46,7 @@ Offset16  Short offset to a table, same as uint16, NULL offset = 0x0000
 Offset32  Long offset to a table, same as uint32, NULL offset = 0x00000000
 */
 
+type uint24 uint32
 type fixed int32
 type fword int16
 type ufword uint16
@@ -76,6 +77,25 @@ func (f fixed) Float64() float64 {
 	return integral + fraction
 }
 
+// Float64 returns `f` as a float64.
+func (f f2dot14) Float64() float64 {
+	return float64(f) / 16384.0
+}
+
+// validTableTag returns true if `s` is a valid table tag: 1 to 4 printable ASCII characters, padded with
+// trailing spaces.
+func validTableTag(s string) bool {
+	if len(s) == 0 || len(s) > 4 || s[0] == ' ' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
 func makeTag(s string) tag {
 	bb := []byte(s[:])
 	if len(bb) > 4 {
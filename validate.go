@@ -7,118 +7,574 @@ package unitype
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+)
+
+// Severity represents the severity of a validation finding.
+type Severity int
 
-	"github.com/sirupsen/logrus"
+// Severities of validation findings. Fonts with error findings are rejected by ValidateBytes and ValidateFile.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
 )
 
-// validate font data model `f` in `r`. Checks if required tables are present and whether
-// table checksums are correct.
-func (f *font) validate(r *byteReader) error {
-	if f.trec == nil {
-		logrus.Debug("Table records missing")
-		return errRequiredField
+// String returns the name of `s`: "info", "warning" or "error".
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
 	}
-	if f.ot == nil {
-		logrus.Debug("Offsets table missing")
-		return errRequiredField
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// The codes of the validation findings. The codes are stable and can be relied upon, unlike the messages.
+const (
+	CodeRequiredTableMissing       = "required-table-missing"
+	CodeChecksumMismatch           = "checksum-mismatch"
+	CodeChecksumAdjustmentMismatch = "checksum-adjustment-mismatch"
+	CodeLocaOffsetOutOfRange       = "loca-offset-out-of-range"
+	CodeLocaOffsetsDecreasing      = "loca-offsets-decreasing"
+	CodeLocaLengthMismatch         = "loca-length-mismatch"
+	CodeGlyfPadding                = "glyf-padding"
+	CodeCmapSubtableOutOfRange     = "cmap-subtable-out-of-range"
+	CodeCmapSegmentsUnordered      = "cmap-segments-unordered"
+	CodeCmapSegmentInvalid         = "cmap-segment-invalid"
+	CodeCmapMissingFinalSegment    = "cmap-missing-final-segment"
+	CodeHmtxCountMismatch          = "hmtx-count-mismatch"
+	CodeHmtxLengthMismatch         = "hmtx-length-mismatch"
+	CodeNameRecordsOutOfRange      = "name-records-out-of-range"
+	CodeNameStringOutOfRange       = "name-string-out-of-range"
+)
+
+// Finding represents a problem or a notable property of a font found by validation.
+type Finding struct {
+	Tag      string // tag of the table concerned, e.g. "cmap".
+	Severity Severity
+	Offset   int64  // byte offset in the font data the finding relates to, or -1 if not applicable.
+	Code     string // kind of finding, one of the Code constants.
+	Message  string
+}
+
+// String returns a description of `fd`, e.g. "error: cmap at 0x1a3c: ...".
+func (fd Finding) String() string {
+	if fd.Offset < 0 {
+		return fmt.Sprintf("%s: %s: %s", fd.Severity, fd.Tag, fd.Message)
 	}
-	if f.head == nil {
-		logrus.Debug("head table missing")
-		return errRequiredField
+	return fmt.Sprintf("%s: %s at 0x%x: %s", fd.Severity, fd.Tag, fd.Offset, fd.Message)
+}
+
+// err returns the error corresponding to `fd`.
+func (fd Finding) err() error {
+	switch fd.Code {
+	case CodeRequiredTableMissing:
+		return ErrRequiredTableMissing{Tag: fd.Tag}
+	case CodeChecksumAdjustmentMismatch:
+		return ErrChecksumMismatch{}
+	case CodeChecksumMismatch:
+		return ErrChecksumMismatch{Tag: fd.Tag}
+	case CodeLocaOffsetOutOfRange, CodeLocaOffsetsDecreasing, CodeLocaLengthMismatch, CodeCmapSubtableOutOfRange,
+		CodeNameRecordsOutOfRange, CodeNameStringOutOfRange:
+		return newOffsetError("%s: %s", fd.Tag, fd.Message)
 	}
+	return errors.New(fd.Tag + ": " + fd.Message)
+}
 
-	// Validate the font.
-	logrus.Debug("Validating entire font")
-	{
-		err := r.SeekTo(0)
-		if err != nil {
-			return err
-		}
+// ValidationReport represents the result of validating a font: the checksums of the tables and the findings of
+// the structural checks. Checksum mismatches are reported as error findings, which are only returned as errors
+// by ValidateBytes and ValidateFile, as stale checksums are common in fonts in the wild and do not prevent using
+// the font.
+type ValidationReport struct {
+	// Tables holds the checksum validation of each table in the order of the table records.
+	Tables []TableValidation
+
+	// ChecksumAdjustment is the checksumAdjustment field of the head table and ExpectedChecksumAdjustment the
+	// value computed from the whole font.
+	ChecksumAdjustment         uint32
+	ExpectedChecksumAdjustment uint32
+
+	// Findings holds the findings of the validation, including the checksum mismatches.
+	Findings []Finding
+}
+
+// TableValidation represents the checksum validation of a table.
+type TableValidation struct {
+	Tag              string
+	Offset           uint32
+	Length           uint32
+	Checksum         uint32 // as recorded in the table record.
+	ComputedChecksum uint32 // computed from the table data.
+}
 
-		var buf bytes.Buffer
-		_, err = io.Copy(&buf, r.reader)
-		if err != nil {
-			return err
+// ChecksumValid returns true if the recorded checksum of the table matches its data.
+func (tv TableValidation) ChecksumValid() bool {
+	return tv.Checksum == tv.ComputedChecksum
+}
+
+// ChecksumMismatches returns the tags of the tables whose checksums do not match their data.
+func (r *ValidationReport) ChecksumMismatches() []string {
+	var tags []string
+	for _, tv := range r.Tables {
+		if !tv.ChecksumValid() {
+			tags = append(tags, tv.Tag)
 		}
+	}
+	return tags
+}
 
-		data := buf.Bytes()
+// ChecksumAdjustmentValid returns true if the checksumAdjustment of the head table is correct.
+func (r *ValidationReport) ChecksumAdjustmentValid() bool {
+	return r.ChecksumAdjustment == r.ExpectedChecksumAdjustment
+}
 
-		headRec, ok := f.trec.trMap["head"]
-		if !ok {
-			logrus.Debug("head not set")
-			return errRequiredField
+// FindingsOf returns the findings of `r` with severity `severity`.
+func (r *ValidationReport) FindingsOf(severity Severity) []Finding {
+	var findings []Finding
+	for _, fd := range r.Findings {
+		if fd.Severity == severity {
+			findings = append(findings, fd)
 		}
-		hoff := headRec.offset
+	}
+	return findings
+}
 
-		// set checksumAdjustment data to 0 in the head table.
-		data[hoff+8] = 0
-		data[hoff+9] = 0
-		data[hoff+10] = 0
-		data[hoff+11] = 0
+// Valid returns true if there are no error findings, in particular if all the checksums are correct.
+func (r *ValidationReport) Valid() bool {
+	return len(r.FindingsOf(SeverityError)) == 0
+}
 
-		bw := newByteWriter(&bytes.Buffer{})
-		bw.buffer.Write(data)
+// addf adds a finding to `r`.
+func (r *ValidationReport) addf(severity Severity, tag string, offset int64, code string, format string,
+	a ...interface{}) {
+	r.Findings = append(r.Findings, Finding{
+		Tag:      tag,
+		Severity: severity,
+		Offset:   offset,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
 
-		checksum := bw.checksum()
-		adjustment := 0xB1B0AFBA - checksum
-		if f.head.checksumAdjustment != adjustment {
-			return errors.New("file checksum mismatch")
+// validate font data model `f` in `r`. Checks if required tables are present and whether
+// table checksums are correct. Returns the error of the first error finding.
+func (f *font) validate(r *byteReader) error {
+	report, err := f.validateDetailed(r)
+	if err != nil {
+		return err
+	}
+	for _, fd := range report.Findings {
+		if fd.Severity == SeverityError {
+			logger.Debugf("Validation failed: %s", fd)
+			return fd.err()
 		}
 	}
+	return nil
+}
 
-	// Validate each table.
-	logrus.Debug("Validating font tables")
-	for _, tr := range f.trec.list {
-		logrus.Debugf("Validating %s", tr.tableTag.String())
-		logrus.Debugf("%+v", tr)
+// validateDetailed validates font data model `f` parsed from `r` and returns the validation report.
+// An error is returned if the data cannot be read.
+func (f *font) validateDetailed(r *byteReader) (*ValidationReport, error) {
+	// Without table directory none of the tables are present, starting with the head table.
+	if f.trec == nil {
+		logger.Debugf("Table records missing")
+		return nil, ErrRequiredTableMissing{Tag: "head"}
+	}
+	if f.ot == nil {
+		logger.Debugf("Offsets table missing")
+		return nil, ErrRequiredTableMissing{Tag: "head"}
+	}
 
-		bw := newByteWriter(&bytes.Buffer{})
+	err := r.SeekTo(0)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, r.reader)
+	if err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
 
-		if tr.offset < 0 || tr.length < 0 {
-			logrus.Debug("Range check error")
-			return errRangeCheck
-		}
+	report := &ValidationReport{}
+	f.validateRequiredTables(report)
+	err = f.validateChecksums(data, report)
+	if err != nil {
+		return nil, err
+	}
+	f.validateLocaData(data, report)
+	f.validateCmapData(data, report)
+	f.validateHmtxLength(report)
+	f.validateNameData(data, report)
+	return report, nil
+}
+
+// requiredTables are the tables required by the OpenType specification, mapped to whether fonts are unusable
+// without them. Fonts embedded in PDF documents are commonly missing the others.
+var requiredTables = []struct {
+	tag      string
+	critical bool
+}{
+	{"head", true},
+	{"maxp", true},
+	{"hhea", true},
+	{"hmtx", true},
+	{"cmap", false},
+	{"name", false},
+	{"OS/2", false},
+	{"post", false},
+}
 
-		logrus.Debugf("Seeking to %d, to read %d bytes", tr.offset, tr.length)
-		err := r.SeekTo(int64(tr.offset))
-		if err != nil {
-			return err
+// validateRequiredTables adds findings for the required tables missing in `f` to `report`.
+func (f *font) validateRequiredTables(report *ValidationReport) {
+	for _, req := range requiredTables {
+		if _, has := f.trec.trMap[req.tag]; has {
+			continue
 		}
-		logrus.Debugf("Offset: %d", r.Offset())
+		severity := SeverityWarning
+		if req.critical {
+			severity = SeverityError
+		}
+		report.addf(severity, req.tag, -1, CodeRequiredTableMissing, "required table missing")
+	}
 
-		b := make([]byte, tr.length)
-		_, err = io.ReadFull(r.reader, b)
-		if err != nil {
-			return err
+	_, hasLoca := f.trec.trMap["loca"]
+	_, hasGlyf := f.trec.trMap["glyf"]
+	switch {
+	case hasLoca && !hasGlyf:
+		report.addf(SeverityError, "glyf", -1, CodeRequiredTableMissing, "glyf table missing while loca is present")
+	case hasGlyf && !hasLoca:
+		report.addf(SeverityError, "loca", -1, CodeRequiredTableMissing, "loca table missing while glyf is present")
+	}
+}
+
+// validateChecksums validates the checksums of the tables of font data model `f` in font data `data` and adds
+// them to `report` along with findings for the mismatches. The checksum adjustment of the head table is
+// zeroed in `data`. An error is returned if tables are out of range.
+func (f *font) validateChecksums(data []byte, report *ValidationReport) error {
+	// Validate each table.
+	logger.Debugf("Validating font tables")
+	var mismatches []Finding
+	for _, tr := range f.trec.list {
+		name := tr.tableTag.String()
+		logger.Debugf("Validating %s: %+v", name, tr)
+		end := int64(tr.offset) + int64(tr.length)
+		if end > int64(len(data)) {
+			logger.Debugf("Table %s out of range (%d > %d)", name, end, len(data))
+			return newOffsetError("%s table out of range (%d > %d)", name, end, len(data))
 		}
-		logrus.Debugf("Read (%d)", len(b))
-		// TODO(gunnsth): Validate head.
-		if tr.tableTag.String() == "head" {
+
+		b := data[tr.offset:end]
+		if name == "head" {
 			// Set the checksumAdjustment to 0 so that head checksum is valid.
 			if len(b) < 12 {
-				return errors.New("head too short")
+				return newOffsetError("head table too short (%d bytes)", len(b))
 			}
+			b = append([]byte(nil), b...)
 			b[8], b[9], b[10], b[11] = 0, 0, 0, 0
 		}
+		tv := TableValidation{
+			Tag:              name,
+			Offset:           uint32(tr.offset),
+			Length:           tr.length,
+			Checksum:         tr.checksum,
+			ComputedChecksum: tableChecksum(b),
+		}
+		report.Tables = append(report.Tables, tv)
+		if !tv.ChecksumValid() {
+			mismatches = append(mismatches, Finding{
+				Tag:      name,
+				Severity: SeverityError,
+				Offset:   int64(tr.offset),
+				Code:     CodeChecksumMismatch,
+				Message:  fmt.Sprintf("checksum 0x%08X does not match the data (0x%08X)", tv.Checksum, tv.ComputedChecksum),
+			})
+		}
+	}
 
-		_, err = bw.buffer.Write(b)
-		if err != nil {
-			return err
+	// Validate the font.
+	logger.Debugf("Validating entire font")
+	headRec, ok := f.trec.trMap["head"]
+	if !ok || f.head == nil {
+		logger.Debugf("head not set")
+		report.Findings = append(report.Findings, mismatches...)
+		return nil
+	}
+	// The checksum is computed with the checksumAdjustment set to 0 in the head table.
+	report.ChecksumAdjustment = f.head.checksumAdjustment
+	hoff := headRec.offset
+	data[hoff+8], data[hoff+9], data[hoff+10], data[hoff+11] = 0, 0, 0, 0
+	report.ExpectedChecksumAdjustment = 0xB1B0AFBA - tableChecksum(data)
+	if !report.ChecksumAdjustmentValid() {
+		report.addf(SeverityError, "head", int64(hoff)+8, CodeChecksumAdjustmentMismatch,
+			"checksumAdjustment 0x%08X does not match the font data (0x%08X)",
+			report.ChecksumAdjustment, report.ExpectedChecksumAdjustment)
+	}
+	report.Findings = append(report.Findings, mismatches...)
+	return nil
+}
+
+// tableData returns the data of table `name` of `f` in font data `data` and its offset, or nil if absent or out
+// of range.
+func (f *font) tableData(data []byte, name string) ([]byte, int64) {
+	tr, has := f.trec.trMap[name]
+	if !has {
+		return nil, 0
+	}
+	end := int64(tr.offset) + int64(tr.length)
+	if end > int64(len(data)) {
+		return nil, 0
+	}
+	return data[tr.offset:end], int64(tr.offset)
+}
+
+// validateLocaData adds findings for the glyph data offsets of the loca table in font data `data` that are out of
+// the glyf table or decreasing, and for loca tables of the wrong length, to `report`.
+func (f *font) validateLocaData(data []byte, report *ValidationReport) {
+	loca, locaOffset := f.tableData(data, "loca")
+	glyf, glyfOffset := f.tableData(data, "glyf")
+	if loca == nil || glyf == nil || f.head == nil || f.maxp == nil {
+		return
+	}
+
+	entrySize := 2
+	if f.head.indexToLocFormat == 1 {
+		entrySize = 4
+	}
+	numGlyphs := int(f.maxp.numGlyphs)
+	numEntries := len(loca) / entrySize
+	if numEntries < numGlyphs+1 {
+		report.addf(SeverityError, "loca", locaOffset, CodeLocaLengthMismatch,
+			"%d offsets for %d glyphs, expecting %d", numEntries, numGlyphs, numGlyphs+1)
+	} else if numEntries > numGlyphs+1 {
+		report.addf(SeverityWarning, "loca", locaOffset, CodeLocaLengthMismatch,
+			"%d offsets for %d glyphs, expecting %d", numEntries, numGlyphs, numGlyphs+1)
+		numEntries = numGlyphs + 1
+	}
+
+	var prev int64
+	for i := 0; i < numEntries; i++ {
+		var offset int64
+		if entrySize == 2 {
+			offset = 2 * int64(binary.BigEndian.Uint16(loca[2*i:]))
+		} else {
+			offset = int64(binary.BigEndian.Uint32(loca[4*i:]))
 		}
+		entryOffset := locaOffset + int64(i*entrySize)
+		if offset > int64(len(glyf)) {
+			report.addf(SeverityError, "loca", entryOffset, CodeLocaOffsetOutOfRange,
+				"offset %d of glyph %d beyond the glyf table (%d bytes)", offset, i, len(glyf))
+		} else if offset < prev {
+			report.addf(SeverityError, "loca", entryOffset, CodeLocaOffsetsDecreasing,
+				"offset %d of glyph %d before the offset of the previous glyph (%d)", offset, i, prev)
+		}
+		prev = offset
+	}
+	if numEntries == numGlyphs+1 && prev < int64(len(glyf)) {
+		report.addf(SeverityInfo, "glyf", glyfOffset+prev, CodeGlyfPadding,
+			"%d bytes after the last glyph", int64(len(glyf))-prev)
+	}
+}
 
-		checksum := bw.checksum()
-		if tr.checksum != checksum {
-			logrus.Debugf("Invalid checksum (%d != %d)", checksum, tr.checksum)
-			return errors.New("checksum incorrect")
+// validateCmapData adds findings for the format 4 and 12 cmap subtables in font data `data` that are out of range
+// or have segments that are not in increasing order, to `report`.
+func (f *font) validateCmapData(data []byte, report *ValidationReport) {
+	cmap, cmapOffset := f.tableData(data, "cmap")
+	if len(cmap) < 4 {
+		return
+	}
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	if 4+8*numTables > len(cmap) {
+		report.addf(SeverityError, "cmap", cmapOffset, CodeCmapSubtableOutOfRange,
+			"%d encoding records beyond the table (%d bytes)", numTables, len(cmap))
+		return
+	}
+
+	checked := map[uint32]bool{}
+	for i := 0; i < numTables; i++ {
+		subtableOffset := binary.BigEndian.Uint32(cmap[4+8*i+4:])
+		if checked[subtableOffset] {
+			continue
+		}
+		checked[subtableOffset] = true
+		abs := cmapOffset + int64(subtableOffset)
+		if int64(subtableOffset)+4 > int64(len(cmap)) {
+			report.addf(SeverityError, "cmap", abs, CodeCmapSubtableOutOfRange,
+				"subtable at offset %d beyond the table (%d bytes)", subtableOffset, len(cmap))
+			continue
 		}
+		st := cmap[subtableOffset:]
+		switch format := binary.BigEndian.Uint16(st); format {
+		case 4:
+			validateCmapFormat4(st, abs, report)
+		case 12, 13:
+			validateCmapFormat12(st, abs, format, report)
+		}
+	}
+}
+
+// validateCmapFormat4 adds findings for the format 4 cmap subtable `st` at offset `offset` to `report`.
+func validateCmapFormat4(st []byte, offset int64, report *ValidationReport) {
+	if len(st) < 14 {
+		report.addf(SeverityError, "cmap", offset, CodeCmapSubtableOutOfRange, "format 4 subtable truncated")
+		return
+	}
+	segCount := int(binary.BigEndian.Uint16(st[6:])) / 2
+	if 16+8*segCount > len(st) {
+		report.addf(SeverityError, "cmap", offset, CodeCmapSubtableOutOfRange,
+			"format 4 subtable: %d segments beyond the table", segCount)
+		return
+	}
+	if segCount == 0 {
+		report.addf(SeverityError, "cmap", offset, CodeCmapSegmentInvalid, "format 4 subtable: segment count 0")
+		return
+	}
 
-		if int(tr.length) != bw.bufferedLen() {
-			logrus.Debug("Length mismatch")
-			return errRangeCheck
+	endCodes := st[14:]
+	startCodes := st[16+2*segCount:]
+	var prevEnd int
+	for i := 0; i < segCount; i++ {
+		end := int(binary.BigEndian.Uint16(endCodes[2*i:]))
+		start := int(binary.BigEndian.Uint16(startCodes[2*i:]))
+		if start > end {
+			report.addf(SeverityError, "cmap", offset+16+2*int64(segCount+i), CodeCmapSegmentInvalid,
+				"format 4 subtable: segment %d starts after its end (%d > %d)", i, start, end)
 		}
+		if i > 0 && start <= prevEnd {
+			report.addf(SeverityError, "cmap", offset+14+2*int64(i), CodeCmapSegmentsUnordered,
+				"format 4 subtable: segment %d (%d-%d) not after the previous segment (ending %d)", i, start, end,
+				prevEnd)
+		}
+		prevEnd = end
+	}
+	if prevEnd != 0xFFFF {
+		report.addf(SeverityWarning, "cmap", offset+14+2*int64(segCount-1), CodeCmapMissingFinalSegment,
+			"format 4 subtable: last segment ends at %d rather than 0xFFFF", prevEnd)
 	}
+}
 
+// validateCmapFormat12 adds findings for the format 12 or 13 cmap subtable `st` at offset `offset` to `report`.
+func validateCmapFormat12(st []byte, offset int64, format uint16, report *ValidationReport) {
+	if len(st) < 16 {
+		report.addf(SeverityError, "cmap", offset, CodeCmapSubtableOutOfRange, "format %d subtable truncated", format)
+		return
+	}
+	numGroups := int64(binary.BigEndian.Uint32(st[12:]))
+	if 16+12*numGroups > int64(len(st)) {
+		report.addf(SeverityError, "cmap", offset, CodeCmapSubtableOutOfRange,
+			"format %d subtable: %d groups beyond the table", format, numGroups)
+		return
+	}
+	var prevEnd uint32
+	for i := int64(0); i < numGroups; i++ {
+		group := st[16+12*i:]
+		start := binary.BigEndian.Uint32(group)
+		end := binary.BigEndian.Uint32(group[4:])
+		if start > end {
+			report.addf(SeverityError, "cmap", offset+16+12*i, CodeCmapSegmentInvalid,
+				"format %d subtable: group %d starts after its end (%d > %d)", format, i, start, end)
+		}
+		if i > 0 && start <= prevEnd {
+			report.addf(SeverityError, "cmap", offset+16+12*i, CodeCmapSegmentsUnordered,
+				"format %d subtable: group %d (%d-%d) not after the previous group (ending %d)", format, i, start,
+				end, prevEnd)
+		}
+		prevEnd = end
+	}
+}
+
+// validateHmtxLength adds findings for a number of horizontal metrics in the hhea table inconsistent with the
+// number of glyphs in the maxp table, and for an hmtx table length that does not match them, to `report`.
+func (f *font) validateHmtxLength(report *ValidationReport) {
+	tr, has := f.trec.trMap["hmtx"]
+	if !has || f.hhea == nil || f.maxp == nil {
+		return
+	}
+	numHMetrics := int(f.hhea.numberOfHMetrics)
+	numGlyphs := int(f.maxp.numGlyphs)
+	if numHMetrics == 0 || numHMetrics > numGlyphs {
+		report.addf(SeverityError, "hhea", -1, CodeHmtxCountMismatch,
+			"numberOfHMetrics %d inconsistent with numGlyphs %d", numHMetrics, numGlyphs)
+		return
+	}
+
+	expected := 4*numHMetrics + 2*(numGlyphs-numHMetrics)
+	switch {
+	case int(tr.length) < expected:
+		report.addf(SeverityError, "hmtx", int64(tr.offset), CodeHmtxLengthMismatch,
+			"length %d shorter than the %d bytes of the metrics of %d glyphs", tr.length, expected, numGlyphs)
+	case int(tr.length) > expected:
+		report.addf(SeverityInfo, "hmtx", int64(tr.offset), CodeHmtxLengthMismatch,
+			"length %d longer than the %d bytes of the metrics of %d glyphs", tr.length, expected, numGlyphs)
+	}
+}
+
+// validateNameData adds findings for the name records and strings of the name table in font data `data` that
+// are beyond the end of the table to `report`.
+func (f *font) validateNameData(data []byte, report *ValidationReport) {
+	name, nameOffset := f.tableData(data, "name")
+	if len(name) < 6 {
+		return
+	}
+	count := int(binary.BigEndian.Uint16(name[2:]))
+	storageOffset := int64(binary.BigEndian.Uint16(name[4:]))
+	if 6+12*count > len(name) {
+		report.addf(SeverityError, "name", nameOffset, CodeNameRecordsOutOfRange,
+			"%d name records beyond the table (%d bytes)", count, len(name))
+		return
+	}
+	if storageOffset > int64(len(name)) {
+		report.addf(SeverityError, "name", nameOffset+4, CodeNameRecordsOutOfRange,
+			"string storage offset %d beyond the table (%d bytes)", storageOffset, len(name))
+		return
+	}
+	for i := 0; i < count; i++ {
+		rec := name[6+12*i:]
+		nameID := binary.BigEndian.Uint16(rec[6:])
+		length := int64(binary.BigEndian.Uint16(rec[8:]))
+		offset := int64(binary.BigEndian.Uint16(rec[10:]))
+		if storageOffset+offset+length > int64(len(name)) {
+			report.addf(SeverityError, "name", nameOffset+6+12*int64(i), CodeNameStringOutOfRange,
+				"string of name record %d (name ID %d) at %d+%d beyond the table (%d bytes)", i, nameID,
+				storageOffset+offset, length, len(name))
+		}
+	}
+}
+
+// validateHhea checks whether the aggregate values of the hhea table agree with the actual contents of the
+// hmtx and glyf tables.
+func (f *font) validateHhea() error {
+	if f.hhea == nil {
+		logger.Debugf("hhea table missing")
+		return ErrRequiredTableMissing{Tag: "hhea"}
+	}
+	if f.hmtx == nil {
+		logger.Debugf("hmtx table missing")
+		return ErrRequiredTableMissing{Tag: "hmtx"}
+	}
+
+	agg, _ := f.computeHheaAggregates()
+	checks := []struct {
+		name             string
+		stored, computed int
+	}{
+		{"advanceWidthMax", int(f.hhea.advanceWidthMax), int(agg.advanceWidthMax)},
+		{"minLeftSideBearing", int(f.hhea.minLeftSideBearing), int(agg.minLeftSideBearing)},
+		{"minRightSideBearing", int(f.hhea.minRightSideBearing), int(agg.minRightSideBearing)},
+		{"xMaxExtent", int(f.hhea.xMaxExtent), int(agg.xMaxExtent)},
+	}
+	for _, c := range checks {
+		if c.stored != c.computed {
+			logger.Debugf("hhea %s mismatch: %d != %d", c.name, c.stored, c.computed)
+			return fmt.Errorf("hhea %s mismatch: %d (computed %d)", c.name, c.stored, c.computed)
+		}
+	}
 	return nil
 }
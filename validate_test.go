@@ -6,11 +6,14 @@
 package unitype
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFontValidation(t *testing.T) {
@@ -31,7 +34,7 @@ func TestFontValidation(t *testing.T) {
 	for _, tcase := range testcases {
 		t.Logf("%s", tcase.fontPath)
 		fmt.Printf("==== %s\n", tcase.fontPath)
-		logrus.Debugf("==== %s", tcase.fontPath)
+		logger.Debugf("==== %s", tcase.fontPath)
 		start := time.Now()
 		err := ValidateFile(tcase.fontPath)
 		if err != nil {
@@ -42,3 +45,150 @@ func TestFontValidation(t *testing.T) {
 	}
 
 }
+
+func TestValidateBytesDetailed(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+
+	report, err := ValidateBytesDetailed(data)
+	require.NoError(t, err)
+	assert.True(t, report.Valid())
+	assert.Len(t, report.Tables, len(fnt.trec.list))
+
+	// Stale checksums of the name and post tables.
+	written, err := ParseBytes(data)
+	require.NoError(t, err)
+	bad := append([]byte(nil), data...)
+	for _, tag := range []string{"name", "post"} {
+		tr := written.trec.trMap[tag]
+		bad[int(tr.offset)+int(tr.length)-1]++
+	}
+	report, err = ValidateBytesDetailed(bad)
+	require.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.False(t, report.ChecksumAdjustmentValid())
+	assert.Equal(t, []string{"name", "post"}, report.ChecksumMismatches())
+	assert.Error(t, ValidateBytes(bad))
+
+	// Only the checksum adjustment is invalid.
+	bad = append([]byte(nil), data...)
+	bad[written.trec.trMap["head"].offset+11]++
+	report, err = ValidateBytesDetailed(bad)
+	require.NoError(t, err)
+	assert.Empty(t, report.ChecksumMismatches())
+	assert.False(t, report.ChecksumAdjustmentValid())
+
+	// Invalid structure.
+	_, err = ValidateBytesDetailed(data[:len(data)/2])
+	assert.Error(t, err)
+}
+
+// findingCodes returns the codes of the findings of `report` with severity `severity`.
+func findingCodes(report *ValidationReport, severity Severity) []string {
+	var codes []string
+	for _, fd := range report.FindingsOf(severity) {
+		codes = append(codes, fd.Code)
+	}
+	return codes
+}
+
+func TestValidateDetailed(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	report, err := fnt.ValidateDetailed()
+	require.NoError(t, err)
+	assert.True(t, report.Valid())
+	assert.Empty(t, report.Findings)
+
+	data, err := fnt.Bytes()
+	require.NoError(t, err)
+	fnt, err = ParseBytes(data)
+	require.NoError(t, err)
+	offset := func(tag string) int {
+		return int(fnt.trec.trMap[tag].offset)
+	}
+
+	t.Run("loca", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		binary.BigEndian.PutUint32(bad[offset("loca")+8:], 0xFFFFFF)
+		report, err := ValidateBytesDetailed(bad)
+		require.NoError(t, err)
+		assert.Equal(t, []string{CodeChecksumAdjustmentMismatch, CodeChecksumMismatch, CodeLocaOffsetOutOfRange,
+			CodeLocaOffsetsDecreasing}, findingCodes(report, SeverityError))
+		fd := report.FindingsOf(SeverityError)[2]
+		assert.Equal(t, "loca", fd.Tag)
+		assert.Equal(t, int64(offset("loca")+8), fd.Offset)
+		assert.False(t, report.Valid())
+	})
+
+	t.Run("cmap", func(t *testing.T) {
+		// Swap the end codes of the first two segments of the format 4 subtable.
+		bad := append([]byte(nil), data...)
+		cmap := bad[offset("cmap"):]
+		var st []byte
+		for i := 0; i < int(binary.BigEndian.Uint16(cmap[2:])); i++ {
+			st = cmap[binary.BigEndian.Uint32(cmap[4+8*i+4:]):]
+			if binary.BigEndian.Uint16(st) == 4 {
+				break
+			}
+		}
+		require.Equal(t, uint16(4), binary.BigEndian.Uint16(st))
+		st[14], st[15], st[16], st[17] = st[16], st[17], st[14], st[15]
+
+		report := &ValidationReport{}
+		fnt.validateCmapData(bad, report)
+		require.NotEmpty(t, report.Findings)
+		for _, fd := range report.Findings {
+			assert.Equal(t, "cmap", fd.Tag)
+			assert.Equal(t, SeverityError, fd.Severity)
+			assert.Contains(t, []string{CodeCmapSegmentInvalid, CodeCmapSegmentsUnordered}, fd.Code)
+		}
+	})
+
+	t.Run("hmtx", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		binary.BigEndian.PutUint16(bad[offset("hhea")+34:], fnt.maxp.numGlyphs+1)
+		report, err := ValidateBytesDetailed(bad)
+		require.NoError(t, err)
+		assert.Contains(t, findingCodes(report, SeverityError), CodeHmtxCountMismatch)
+		assert.Error(t, ValidateBytes(bad))
+	})
+
+	t.Run("name", func(t *testing.T) {
+		bad := append([]byte(nil), data...)
+		binary.BigEndian.PutUint16(bad[offset("name")+6+12+8:], 0xFFFF)
+		report := &ValidationReport{}
+		fnt.validateNameData(bad, report)
+		require.Len(t, report.Findings, 1)
+		assert.Equal(t, Finding{
+			Tag:      "name",
+			Severity: SeverityError,
+			Offset:   int64(offset("name") + 6 + 12),
+			Code:     CodeNameStringOutOfRange,
+			Message:  report.Findings[0].Message,
+		}, report.Findings[0])
+		assert.True(t, errors.Is(report.Findings[0].err(), ErrInvalidOffset))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		// Rename the post and hmtx table records.
+		bad := append([]byte(nil), data...)
+		for i, tr := range fnt.trec.list {
+			if tag := tr.tableTag.String(); tag == "post" || tag == "hmtx" {
+				bad[12+16*i] = 'x'
+			}
+		}
+		report, err := ValidateBytesDetailed(bad)
+		require.NoError(t, err)
+		assert.Equal(t, []string{CodeRequiredTableMissing}, findingCodes(report, SeverityWarning))
+		missing := report.FindingsOf(SeverityError)
+		require.NotEmpty(t, missing)
+		assert.Equal(t, "hmtx", missing[0].Tag)
+		assert.Equal(t, "error: hmtx: required table missing", missing[0].String())
+
+		err = ValidateBytes(bad)
+		assert.Equal(t, ErrRequiredTableMissing{Tag: "hmtx"}, err)
+	})
+}
@@ -0,0 +1,336 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+)
+
+// VariationAxis represents a design variation axis of a variable font, such as weight ("wght") or
+// width ("wdth"). The values are in user-space coordinates.
+type VariationAxis struct {
+	Tag     string
+	Min     float64
+	Default float64
+	Max     float64
+	NameID  uint16 // name table ID of the axis name.
+	Hidden  bool   // the axis should not be exposed in user interfaces.
+}
+
+// NamedInstance represents a named instance of a variable font, a predefined position in the design space
+// such as "Bold" or "Condensed Light".
+type NamedInstance struct {
+	SubfamilyNameID  uint16             // name table ID of the subfamily name, e.g. "Bold".
+	PostScriptNameID uint16             // name table ID of the PostScript name, 0xFFFF if not specified.
+	Coords           map[string]float64 // user-space coordinates by axis tag.
+}
+
+// Axes returns the variation axes of `f` in the order of the fvar table. Returns nil if `f` is not a
+// variable font.
+func (f *Font) Axes() []VariationAxis {
+	if f.fvar == nil {
+		return nil
+	}
+	axes := make([]VariationAxis, len(f.fvar.axes))
+	for i, axis := range f.fvar.axes {
+		axes[i] = VariationAxis{
+			Tag:     axis.axisTag.String(),
+			Min:     axis.minValue,
+			Default: axis.defaultValue,
+			Max:     axis.maxValue,
+			NameID:  axis.axisNameID,
+			Hidden:  axis.flags&fvarAxisHidden != 0,
+		}
+	}
+	return axes
+}
+
+// NamedInstances returns the named instances of `f` in the order of the fvar table. Returns nil if `f` is
+// not a variable font.
+func (f *Font) NamedInstances() []NamedInstance {
+	if f.fvar == nil {
+		return nil
+	}
+	instances := make([]NamedInstance, len(f.fvar.instances))
+	for i, inst := range f.fvar.instances {
+		coords := make(map[string]float64, len(inst.coordinates))
+		for j, v := range inst.coordinates {
+			coords[f.fvar.axes[j].axisTag.String()] = v
+		}
+		instances[i] = NamedInstance{
+			SubfamilyNameID:  inst.subfamilyNameID,
+			PostScriptNameID: inst.postScriptNameID,
+			Coords:           coords,
+		}
+	}
+	return instances
+}
+
+// regionAxis represents the extent of a variation region along one axis in normalized coordinates.
+type regionAxis struct {
+	start, peak, end float64
+}
+
+// itemVariationStore represents an ItemVariationStore as used by the MVAR, HVAR, VVAR and GDEF tables,
+// holding sets of deltas for the variation regions of the design space.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otvarcommonformats#item-variation-store
+type itemVariationStore struct {
+	regions [][]regionAxis // variation regions, with the extent along each axis.
+	data    []itemVariationData
+}
+
+type itemVariationData struct {
+	regionIndexes []uint16
+	deltaSets     [][]int32 // deltas per item, one per region index.
+}
+
+// Flags of the ItemVariationData subtables.
+const (
+	ivsLongWords      = 0x8000
+	ivsWordCountMask  = 0x7FFF
+	ivsNoVariationIdx = 0xFFFF
+)
+
+// parseItemVariationStore parses the ItemVariationStore at `offset` in `data`.
+func parseItemVariationStore(data []byte, offset int64) (*itemVariationStore, error) {
+	r := newByteReader(bytes.NewReader(data))
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var format, dataCount uint16
+	var regionListOffset offset32
+	err = r.read(&format, &regionListOffset, &dataCount)
+	if err != nil {
+		return nil, err
+	}
+	if format != 1 {
+		logger.Debugf("Unsupported ItemVariationStore format %d", format)
+		return nil, errRangeCheck
+	}
+	dataOffsets := make([]offset32, dataCount)
+	for i := range dataOffsets {
+		err = r.read(&dataOffsets[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &itemVariationStore{}
+	err = r.SeekTo(offset + int64(regionListOffset))
+	if err != nil {
+		return nil, err
+	}
+	var axisCount, regionCount uint16
+	err = r.read(&axisCount, &regionCount)
+	if err != nil {
+		return nil, err
+	}
+	if r.Offset()+6*int64(axisCount)*int64(regionCount) > int64(len(data)) {
+		logger.Debugf("Variation region list out of range")
+		return nil, errRangeCheck
+	}
+	s.regions = make([][]regionAxis, regionCount)
+	for i := range s.regions {
+		s.regions[i] = make([]regionAxis, axisCount)
+		for j := range s.regions[i] {
+			var start, peak, end f2dot14
+			err = r.read(&start, &peak, &end)
+			if err != nil {
+				return nil, err
+			}
+			s.regions[i][j] = regionAxis{start: start.Float64(), peak: peak.Float64(), end: end.Float64()}
+		}
+	}
+
+	s.data = make([]itemVariationData, dataCount)
+	for i, dataOffset := range dataOffsets {
+		err = r.SeekTo(offset + int64(dataOffset))
+		if err != nil {
+			return nil, err
+		}
+		var itemCount, wordDeltaCount, regionIndexCount uint16
+		err = r.read(&itemCount, &wordDeltaCount, &regionIndexCount)
+		if err != nil {
+			return nil, err
+		}
+		d := &s.data[i]
+		err = r.readSlice(&d.regionIndexes, int(regionIndexCount))
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range d.regionIndexes {
+			if int(index) >= len(s.regions) {
+				logger.Debugf("Variation region index out of range: %d", index)
+				return nil, errRangeCheck
+			}
+		}
+
+		wordCount := int(wordDeltaCount & ivsWordCountMask)
+		longWords := wordDeltaCount&ivsLongWords != 0
+		if wordCount > int(regionIndexCount) {
+			logger.Debugf("Invalid word delta count: %d > %d", wordCount, regionIndexCount)
+			return nil, errRangeCheck
+		}
+		rowSize := wordCount + int(regionIndexCount)
+		if longWords {
+			rowSize *= 2
+		}
+		if r.Offset()+int64(itemCount)*int64(rowSize) > int64(len(data)) {
+			logger.Debugf("Delta sets out of range")
+			return nil, errRangeCheck
+		}
+		d.deltaSets = make([][]int32, itemCount)
+		for j := range d.deltaSets {
+			deltas := make([]int32, regionIndexCount)
+			for k := range deltas {
+				switch {
+				case longWords && k < wordCount:
+					err = r.read(&deltas[k])
+				case longWords, k < wordCount:
+					var v int16
+					err = r.read(&v)
+					deltas[k] = int32(v)
+				default:
+					var v int8
+					err = r.read(&v)
+					deltas[k] = int32(v)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			d.deltaSets[j] = deltas
+		}
+	}
+	return s, nil
+}
+
+// delta returns the interpolated delta of the item `inner` of the delta set `outer` at the normalized
+// coordinates `coords`. Unknown items have no variation.
+func (s *itemVariationStore) delta(outer, inner uint16, coords []float64) float64 {
+	if outer == ivsNoVariationIdx && inner == ivsNoVariationIdx {
+		return 0
+	}
+	if int(outer) >= len(s.data) || int(inner) >= len(s.data[outer].deltaSets) {
+		logger.Debugf("Delta set index out of range: %d/%d", outer, inner)
+		return 0
+	}
+	d := s.data[outer]
+	var delta float64
+	for i, index := range d.regionIndexes {
+		scalar := regionScalar(s.regions[index], coords)
+		if scalar != 0 {
+			delta += scalar * float64(d.deltaSets[inner][i])
+		}
+	}
+	return delta
+}
+
+// deltaSetIndexMap maps glyph IDs or other item indices to delta set indices of an ItemVariationStore.
+// https://docs.microsoft.com/en-us/typography/opentype/spec/otvarcommonformats#associating-target-items-to-variation-data
+type deltaSetIndexMap struct {
+	outer []uint16
+	inner []uint16
+}
+
+// Format flags of DeltaSetIndexMap tables.
+const (
+	deltaSetInnerIndexBitCountMask = 0x0F
+	deltaSetMapEntrySizeMask       = 0x30
+)
+
+// parseDeltaSetIndexMap parses the DeltaSetIndexMap at `offset` in `data`.
+func parseDeltaSetIndexMap(data []byte, offset int64) (*deltaSetIndexMap, error) {
+	r := newByteReader(bytes.NewReader(data))
+	err := r.SeekTo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var format, entryFormat uint8
+	err = r.read(&format, &entryFormat)
+	if err != nil {
+		return nil, err
+	}
+	var mapCount uint32
+	switch format {
+	case 0:
+		var count uint16
+		err = r.read(&count)
+		mapCount = uint32(count)
+	case 1:
+		err = r.read(&mapCount)
+	default:
+		logger.Debugf("Unsupported DeltaSetIndexMap format %d", format)
+		return nil, errRangeCheck
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entrySize := int((entryFormat&deltaSetMapEntrySizeMask)>>4) + 1
+	innerBits := uint(entryFormat&deltaSetInnerIndexBitCountMask) + 1
+	if r.Offset()+int64(mapCount)*int64(entrySize) > int64(len(data)) {
+		logger.Debugf("DeltaSetIndexMap out of range")
+		return nil, errRangeCheck
+	}
+	m := &deltaSetIndexMap{
+		outer: make([]uint16, mapCount),
+		inner: make([]uint16, mapCount),
+	}
+	for i := range m.outer {
+		var entry uint32
+		for j := 0; j < entrySize; j++ {
+			var b uint8
+			err = r.read(&b)
+			if err != nil {
+				return nil, err
+			}
+			entry = entry<<8 | uint32(b)
+		}
+		m.outer[i] = uint16(entry >> innerBits)
+		m.inner[i] = uint16(entry & (1<<innerBits - 1))
+	}
+	return m, nil
+}
+
+// lookup returns the delta set index of item `i`. Items beyond the end of the map use the last entry.
+func (m *deltaSetIndexMap) lookup(i int) (outer, inner uint16) {
+	if len(m.outer) == 0 {
+		return ivsNoVariationIdx, ivsNoVariationIdx
+	}
+	if i >= len(m.outer) {
+		i = len(m.outer) - 1
+	}
+	return m.outer[i], m.inner[i]
+}
+
+// regionScalar returns the scalar by which the deltas of the variation `region` are weighted at the
+// normalized coordinates `coords`: 1 at the peak, falling off linearly to 0 at the region boundaries.
+// Axes with a zero peak or an invalid extent do not constrain the region.
+func regionScalar(region []regionAxis, coords []float64) float64 {
+	scalar := 1.0
+	for i, ra := range region {
+		if ra.peak == 0 || ra.start > ra.peak || ra.peak > ra.end || (ra.start < 0 && ra.end > 0) {
+			continue
+		}
+		var v float64
+		if i < len(coords) {
+			v = coords[i]
+		}
+		switch {
+		case v == ra.peak:
+			continue
+		case v <= ra.start || v >= ra.end:
+			return 0
+		case v < ra.peak:
+			scalar *= (v - ra.start) / (ra.peak - ra.start)
+		default:
+			scalar *= (ra.end - v) / (ra.end - ra.peak)
+		}
+	}
+	return scalar
+}
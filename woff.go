@@ -0,0 +1,439 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// woffHeader represents the header of a WOFF 1.0 file.
+// WOFF wraps the tables of an sfnt font, each table compressed separately with zlib.
+// https://www.w3.org/TR/WOFF/
+type woffHeader struct {
+	signature      uint32
+	flavor         uint32 // sfnt version of the wrapped font.
+	length         uint32
+	numTables      uint16
+	reserved       uint16
+	totalSfntSize  uint32
+	majorVersion   uint16
+	minorVersion   uint16
+	metaOffset     uint32
+	metaLength     uint32
+	metaOrigLength uint32
+	privOffset     uint32
+	privLength     uint32
+}
+
+// woffTableEntry represents an entry of the WOFF table directory.
+type woffTableEntry struct {
+	tableTag     tag
+	offset       uint32
+	compLength   uint32
+	origLength   uint32
+	origChecksum uint32
+}
+
+// ParseWOFF parses the WOFF 1.0 font from `rs` and returns a new Font. The tables are decompressed and the
+// font is loaded from the reconstructed sfnt data, so that it behaves like a font loaded by Parse.
+// The extended metadata and private data blocks of the WOFF file are available through WOFFMetadata and
+// WOFFPrivateData.
+func ParseWOFF(rs io.ReadSeeker) (*Font, error) {
+	data, err := ioutil.ReadAll(rs)
+	if err != nil {
+		return nil, err
+	}
+	return parseWOFFData(data, ParseOptions{})
+}
+
+// parseWOFFData parses the WOFF font file `data` with options `opts`.
+func parseWOFFData(data []byte, opts ParseOptions) (*Font, error) {
+	r := newByteReader(bytes.NewReader(data))
+	h, err := parseWOFFHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.signature != signatureWOFF {
+		return nil, fmt.Errorf("invalid WOFF signature 0x%08X", h.signature)
+	}
+	if h.reserved != 0 {
+		logger.Debugf("WOFF reserved field not zero: %d", h.reserved)
+		return nil, errRangeCheck
+	}
+	if h.length != uint32(len(data)) {
+		logger.Debugf("WOFF length mismatch: %d != %d", h.length, len(data))
+		return nil, errRangeCheck
+	}
+	switch format := sniffFormat(h.flavor); format {
+	case fontFormatTrueType, fontFormatCFF:
+	case fontFormatUnknown:
+		return nil, newUnsupportedSfntVersionError(h.flavor)
+	default:
+		return nil, fmt.Errorf("unsupported font format in WOFF: %s", format)
+	}
+
+	entries := make([]woffTableEntry, h.numTables)
+	for i := range entries {
+		e := &entries[i]
+		err = r.read(&e.tableTag, &e.offset, &e.compLength, &e.origLength, &e.origChecksum)
+		if err != nil {
+			return nil, err
+		}
+		if int64(e.origLength) > opts.maxTableSize() {
+			return nil, &contextError{context: e.tableTag.String(),
+				err: newLimitError("table size %d exceeds %d", e.origLength, opts.maxTableSize())}
+		}
+	}
+
+	sfnt, err := woffToSfnt(data, h, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	br := newByteReader(bytes.NewReader(sfnt))
+	fnt, err := parseFontWithOptions(br, opts)
+	if err != nil {
+		return nil, err
+	}
+	f := newParsedFont(br, fnt)
+
+	if h.metaLength > 0 {
+		// The metadata is always compressed.
+		block, err := woffBlock(data, h.metaOffset, h.metaLength)
+		if err == nil {
+			f.woffMetadata, err = woffInflate(block, h.metaOrigLength)
+		}
+		if err != nil {
+			logger.Debugf("Invalid WOFF metadata: %v", err)
+			return nil, err
+		}
+	}
+	if h.privLength > 0 {
+		f.woffPrivateData, err = woffBlock(data, h.privOffset, h.privLength)
+		if err != nil {
+			logger.Debugf("Invalid WOFF private data: %v", err)
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// ParseWOFFFile parses the WOFF 1.0 font from file given by path.
+func ParseWOFFFile(filePath string) (*Font, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return ParseWOFF(f)
+}
+
+// WOFFMetadata returns the decompressed extended metadata (XML) of the WOFF or WOFF2 file `f` was loaded from.
+// Returns nil if there is no metadata or `f` was not loaded from a WOFF or WOFF2 file.
+func (f *Font) WOFFMetadata() []byte {
+	return f.woffMetadata
+}
+
+// WOFFPrivateData returns the private data block of the WOFF or WOFF2 file `f` was loaded from.
+// Returns nil if there is no private data or `f` was not loaded from a WOFF or WOFF2 file.
+func (f *Font) WOFFPrivateData() []byte {
+	return f.woffPrivateData
+}
+
+func parseWOFFHeader(r *byteReader) (*woffHeader, error) {
+	h := &woffHeader{}
+	err := r.read(&h.signature, &h.flavor, &h.length, &h.numTables, &h.reserved, &h.totalSfntSize)
+	if err != nil {
+		return nil, err
+	}
+	return h, r.read(&h.majorVersion, &h.minorVersion, &h.metaOffset, &h.metaLength, &h.metaOrigLength,
+		&h.privOffset, &h.privLength)
+}
+
+// woffToSfnt reconstructs the sfnt font data from the tables `entries` of WOFF file `data`.
+func woffToSfnt(data []byte, h *woffHeader, entries []woffTableEntry) ([]byte, error) {
+	// Table data in the same order as in the WOFF file, table records sorted by tag.
+	tables := make([][]byte, len(entries))
+	for i, e := range entries {
+		var err error
+		tables[i], err = woffTable(data, e)
+		if err != nil {
+			logger.Debugf("Invalid WOFF table %s: %v", e.tableTag.String(), err)
+			return nil, err
+		}
+	}
+
+	numTables := len(entries)
+	ot := newOffsetTable(h.flavor, numTables)
+
+	trec := &tableRecords{}
+	offset := int64(12 + 16*numTables)
+	for i, e := range entries {
+		trec.Set(e.tableTag.String(), offset, len(tables[i]), e.origChecksum)
+		offset += int64(len(tables[i]))
+		offset = (offset + 3) &^ 3
+	}
+	if uint32(offset) != h.totalSfntSize {
+		logger.Debugf("WOFF totalSfntSize mismatch: %d != %d", h.totalSfntSize, offset)
+	}
+	sortTableRecords(trec)
+
+	var buf bytes.Buffer
+	bw := newByteWriter(&buf)
+	mockf := &font{ot: ot, trec: trec}
+	err := mockf.writeOffsetTable(bw)
+	if err != nil {
+		return nil, err
+	}
+	err = mockf.writeTableRecords(bw)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		err = bw.writeBytes(t)
+		if err != nil {
+			return nil, err
+		}
+		for bw.len%4 != 0 {
+			err = bw.writeBytes([]byte{0})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = bw.flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// woffTable returns the data of table `e` of WOFF file `data`, decompressed if stored compressed.
+func woffTable(data []byte, e woffTableEntry) ([]byte, error) {
+	block, err := woffBlock(data, e.offset, e.compLength)
+	if err != nil {
+		return nil, err
+	}
+	if e.compLength > e.origLength {
+		logger.Debugf("WOFF compressed length exceeds original length: %d > %d", e.compLength, e.origLength)
+		return nil, errRangeCheck
+	}
+	if e.compLength == e.origLength {
+		// Stored uncompressed.
+		return block, nil
+	}
+	return woffInflate(block, e.origLength)
+}
+
+// woffBlock returns the block of `length` bytes at `offset` of WOFF file `data`.
+func woffBlock(data []byte, offset, length uint32) ([]byte, error) {
+	if int64(offset)+int64(length) > int64(len(data)) {
+		logger.Debugf("WOFF block out of range: %d+%d > %d", offset, length, len(data))
+		return nil, errRangeCheck
+	}
+	return data[offset : offset+length], nil
+}
+
+// woffInflate decompresses the zlib compressed `block` to `origLength` bytes.
+func woffInflate(block []byte, origLength uint32) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// Limit to guard against compressed data expanding beyond the declared length.
+	b, err := ioutil.ReadAll(io.LimitReader(zr, int64(origLength)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != int(origLength) {
+		logger.Debugf("WOFF decompressed length mismatch: %d != %d", len(b), origLength)
+		return nil, errRangeCheck
+	}
+	return b, nil
+}
+
+// WOFFOptions represents options for writing a font as WOFF.
+type WOFFOptions struct {
+	// Metadata is the extended metadata XML block, compressed when written. Omitted if empty.
+	Metadata []byte
+
+	// PrivateData is the private data block, written as is. Omitted if empty.
+	PrivateData []byte
+
+	// MajorVersion and MinorVersion specify the version of the WOFF file.
+	MajorVersion uint16
+	MinorVersion uint16
+}
+
+// WriteWOFF writes `f` to `w` as a WOFF 1.0 font. The extended metadata and private data blocks of the WOFF
+// file `f` was loaded from, if any, are retained.
+func (f *Font) WriteWOFF(w io.Writer) error {
+	return f.WriteWOFFWithOptions(w, &WOFFOptions{
+		Metadata:    f.woffMetadata,
+		PrivateData: f.woffPrivateData,
+	})
+}
+
+// WriteWOFFWithOptions writes `f` to `w` as a WOFF 1.0 font with options `opts`.
+// Each table is compressed with zlib, unless that does not reduce its size.
+func (f *Font) WriteWOFFWithOptions(w io.Writer, opts *WOFFOptions) error {
+	if opts == nil {
+		opts = &WOFFOptions{}
+	}
+
+	sfnt, err := f.writeSfnt()
+	if err != nil {
+		return err
+	}
+
+	// The table directory is sorted by tag.
+	recs := append([]*tableRecord(nil), sfnt.trec.list...)
+	sort.Slice(recs, func(i, j int) bool {
+		return bytes.Compare(recs[i].tableTag[:], recs[j].tableTag[:]) < 0
+	})
+
+	h := &woffHeader{
+		signature:     signatureWOFF,
+		flavor:        sfnt.ot.sfntVersion,
+		numTables:     uint16(len(recs)),
+		totalSfntSize: uint32(12 + 16*len(recs)),
+		majorVersion:  opts.MajorVersion,
+		minorVersion:  opts.MinorVersion,
+	}
+
+	offset := uint32(44 + 20*len(recs))
+	entries := make([]woffTableEntry, len(recs))
+	blocks := make([][]byte, len(recs))
+	for i, tr := range recs {
+		data := sfnt.tableData(tr)
+		block, err := zlibCompress(data)
+		if err != nil {
+			return err
+		}
+		if len(block) >= len(data) {
+			block = data
+		}
+		entries[i] = woffTableEntry{
+			tableTag:     tr.tableTag,
+			offset:       offset,
+			compLength:   uint32(len(block)),
+			origLength:   tr.length,
+			origChecksum: tr.checksum,
+		}
+		blocks[i] = block
+		offset += (uint32(len(block)) + 3) &^ 3
+		h.totalSfntSize += (tr.length + 3) &^ 3
+	}
+
+	var meta []byte
+	if len(opts.Metadata) > 0 {
+		meta, err = zlibCompress(opts.Metadata)
+		if err != nil {
+			return err
+		}
+		h.metaOffset = offset
+		h.metaLength = uint32(len(meta))
+		h.metaOrigLength = uint32(len(opts.Metadata))
+		offset += uint32(len(meta))
+	}
+	if len(opts.PrivateData) > 0 {
+		// The private data block starts on a 4-byte boundary.
+		offset = (offset + 3) &^ 3
+		h.privOffset = offset
+		h.privLength = uint32(len(opts.PrivateData))
+		offset += h.privLength
+	}
+	h.length = offset
+
+	bw := newByteWriter(w)
+	err = bw.write(h.signature, h.flavor, h.length, h.numTables, h.reserved, h.totalSfntSize)
+	if err != nil {
+		return err
+	}
+	err = bw.write(h.majorVersion, h.minorVersion, h.metaOffset, h.metaLength, h.metaOrigLength,
+		h.privOffset, h.privLength)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		err = bw.write(e.tableTag, e.offset, e.compLength, e.origLength, e.origChecksum)
+		if err != nil {
+			return err
+		}
+	}
+
+	pad := func() error {
+		for bw.len%4 != 0 {
+			err := bw.writeBytes([]byte{0})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, block := range blocks {
+		err = bw.writeBytes(block)
+		if err != nil {
+			return err
+		}
+		err = pad()
+		if err != nil {
+			return err
+		}
+	}
+	if meta != nil {
+		err = bw.writeBytes(meta)
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.PrivateData) > 0 {
+		err = pad()
+		if err != nil {
+			return err
+		}
+		err = bw.writeBytes(opts.PrivateData)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.flush()
+}
+
+// WriteWOFFFile writes `f` as a WOFF 1.0 font to `outPath`.
+func (f *Font) WriteWOFFFile(outPath string) error {
+	of, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer of.Close()
+
+	return f.WriteWOFF(of)
+}
+
+// zlibCompress returns `data` compressed with zlib.
+func zlibCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
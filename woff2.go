@@ -0,0 +1,1281 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+)
+
+// woff2Header represents the header of a WOFF2 file.
+// WOFF2 stores the tables of an sfnt font in a single Brotli compressed stream, with the glyf and loca
+// tables (and optionally hmtx) transformed into a more compressible representation.
+// https://www.w3.org/TR/WOFF2/
+type woff2Header struct {
+	signature           uint32
+	flavor              uint32 // sfnt version of the wrapped font.
+	length              uint32
+	numTables           uint16
+	reserved            uint16
+	totalSfntSize       uint32
+	totalCompressedSize uint32
+	majorVersion        uint16
+	minorVersion        uint16
+	metaOffset          uint32
+	metaLength          uint32
+	metaOrigLength      uint32
+	privOffset          uint32
+	privLength          uint32
+}
+
+// woff2TableEntry represents an entry of the WOFF2 table directory.
+type woff2TableEntry struct {
+	tableTag        tag
+	transform       uint8 // transformation version.
+	origLength      uint32
+	transformLength uint32 // length of the transformed table, if transformed.
+}
+
+// woff2KnownTags are the table tags that are referenced by index in the WOFF2 table directory.
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post", "cvt ", "fpgm", "glyf", "loca", "prep",
+	"CFF ", "VORG", "EBDT", "EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea", "vmtx", "BASE",
+	"GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH", "CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt",
+	"avar", "bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar", "gvar", "hsty", "just", "lcar",
+	"mort", "morx", "opbd", "prop", "trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// isTransformed returns true if the data of table `e` is stored transformed. For glyf and loca, version 0
+// is the glyf transform and version 3 the null transform, for other tables version 0 is the null transform.
+func (e woff2TableEntry) isTransformed() bool {
+	switch e.tableTag.String() {
+	case "glyf", "loca":
+		return e.transform != 3
+	}
+	return e.transform != 0
+}
+
+// storedLength returns the length of the data of table `e` in the decompressed stream.
+func (e woff2TableEntry) storedLength() uint32 {
+	if e.isTransformed() {
+		return e.transformLength
+	}
+	return e.origLength
+}
+
+// ParseWOFF2 parses the WOFF2 font from `rs` and returns a new Font. The font data is decompressed and
+// the glyf, loca and hmtx tables reconstructed from their transformed representation, and the font loaded
+// from the reconstructed sfnt data so that it behaves like a font loaded by Parse.
+// The extended metadata and private data blocks are available through WOFFMetadata and WOFFPrivateData.
+// WOFF2 collections are not supported.
+func ParseWOFF2(rs io.ReadSeeker) (*Font, error) {
+	data, err := ioutil.ReadAll(rs)
+	if err != nil {
+		return nil, err
+	}
+	return parseWOFF2Data(data, ParseOptions{})
+}
+
+// parseWOFF2Data parses the WOFF2 font file `data` with options `opts`.
+func parseWOFF2Data(data []byte, opts ParseOptions) (*Font, error) {
+	r := newByteReader(bytes.NewReader(data))
+	h, err := parseWOFF2Header(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.signature != signatureWOFF2 {
+		return nil, fmt.Errorf("invalid WOFF2 signature 0x%08X", h.signature)
+	}
+	if h.length != uint32(len(data)) {
+		logger.Debugf("WOFF2 length mismatch: %d != %d", h.length, len(data))
+		return nil, errRangeCheck
+	}
+	switch format := sniffFormat(h.flavor); format {
+	case fontFormatTrueType, fontFormatCFF:
+	case fontFormatUnknown:
+		return nil, newUnsupportedSfntVersionError(h.flavor)
+	default:
+		return nil, fmt.Errorf("unsupported font format in WOFF2: %s", format)
+	}
+
+	entries := make([]woff2TableEntry, h.numTables)
+	var streamLen int64
+	for i := range entries {
+		entries[i], err = parseWOFF2TableEntry(r)
+		if err != nil {
+			return nil, err
+		}
+		if int64(entries[i].origLength) > opts.maxTableSize() || int64(entries[i].storedLength()) > opts.maxTableSize() {
+			return nil, &contextError{context: entries[i].tableTag.String(),
+				err: newLimitError("table size %d exceeds %d", entries[i].origLength, opts.maxTableSize())}
+		}
+		streamLen += int64(entries[i].storedLength())
+	}
+
+	start := r.Offset()
+	if start+int64(h.totalCompressedSize) > int64(len(data)) {
+		logger.Debugf("WOFF2 compressed data out of range")
+		return nil, errRangeCheck
+	}
+	stream, err := brotliDecompress(data[start:start+int64(h.totalCompressedSize)], streamLen)
+	if err != nil {
+		logger.Debugf("Invalid WOFF2 font data: %v", err)
+		return nil, err
+	}
+
+	tables := make([][]byte, len(entries))
+	var offset int64
+	for i, e := range entries {
+		tables[i] = stream[offset : offset+int64(e.storedLength())]
+		offset += int64(e.storedLength())
+	}
+	err = woff2ReconstructTables(entries, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	sfnt, err := buildSfnt(h.flavor, entries, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	br := newByteReader(bytes.NewReader(sfnt))
+	fnt, err := parseFontWithOptions(br, opts)
+	if err != nil {
+		return nil, err
+	}
+	f := newParsedFont(br, fnt)
+
+	if h.metaLength > 0 {
+		// The metadata is always compressed.
+		block, err := woffBlock(data, h.metaOffset, h.metaLength)
+		if err == nil {
+			f.woffMetadata, err = brotliDecompress(block, int64(h.metaOrigLength))
+		}
+		if err != nil {
+			logger.Debugf("Invalid WOFF2 metadata: %v", err)
+			return nil, err
+		}
+	}
+	if h.privLength > 0 {
+		f.woffPrivateData, err = woffBlock(data, h.privOffset, h.privLength)
+		if err != nil {
+			logger.Debugf("Invalid WOFF2 private data: %v", err)
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// ParseWOFF2File parses the WOFF2 font from file given by path.
+func ParseWOFF2File(filePath string) (*Font, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return ParseWOFF2(f)
+}
+
+func parseWOFF2Header(r *byteReader) (*woff2Header, error) {
+	h := &woff2Header{}
+	err := r.read(&h.signature, &h.flavor, &h.length, &h.numTables, &h.reserved)
+	if err != nil {
+		return nil, err
+	}
+	err = r.read(&h.totalSfntSize, &h.totalCompressedSize, &h.majorVersion, &h.minorVersion)
+	if err != nil {
+		return nil, err
+	}
+	return h, r.read(&h.metaOffset, &h.metaLength, &h.metaOrigLength, &h.privOffset, &h.privLength)
+}
+
+func parseWOFF2TableEntry(r *byteReader) (woff2TableEntry, error) {
+	var e woff2TableEntry
+	var flags uint8
+	err := r.read(&flags)
+	if err != nil {
+		return e, err
+	}
+	if index := flags & 0x3F; index == 0x3F {
+		err = r.read(&e.tableTag)
+	} else {
+		e.tableTag = makeTag(woff2KnownTags[index])
+	}
+	if err != nil {
+		return e, err
+	}
+	e.transform = flags >> 6
+
+	e.origLength, err = readUIntBase128(r)
+	if err != nil {
+		return e, err
+	}
+	if e.isTransformed() {
+		e.transformLength, err = readUIntBase128(r)
+		if err != nil {
+			return e, err
+		}
+		if e.tableTag.String() == "loca" && e.transformLength != 0 {
+			logger.Debugf("WOFF2 transformed loca with non-zero length: %d", e.transformLength)
+			return e, errRangeCheck
+		}
+	}
+	return e, nil
+}
+
+// readUIntBase128 reads a variable-length UIntBase128 encoded value from `r`.
+func readUIntBase128(r *byteReader) (uint32, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		var b uint8
+		err := r.read(&b)
+		if err != nil {
+			return 0, err
+		}
+		// No leading zeros or overflow.
+		if (i == 0 && b == 0x80) || value&0xFE000000 != 0 {
+			logger.Debugf("Invalid UIntBase128 value")
+			return 0, errRangeCheck
+		}
+		value = value<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	logger.Debugf("UIntBase128 value exceeds 5 bytes")
+	return 0, errRangeCheck
+}
+
+// brotliDecompress decompresses the Brotli compressed `data`, which is expected to decompress to
+// `length` bytes.
+func brotliDecompress(data []byte, length int64) ([]byte, error) {
+	br := brotli.NewReader(bytes.NewReader(data))
+	// Limit to guard against compressed data expanding beyond the declared length.
+	b, err := ioutil.ReadAll(io.LimitReader(br, length+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != length {
+		logger.Debugf("Brotli decompressed length mismatch: %d != %d", len(b), length)
+		return nil, errRangeCheck
+	}
+	return b, nil
+}
+
+// woff2ReconstructTables reverses the transforms of the tables `tables` with directory entries `entries`.
+func woff2ReconstructTables(entries []woff2TableEntry, tables [][]byte) error {
+	index := map[string]int{}
+	for i, e := range entries {
+		index[e.tableTag.String()] = i
+	}
+
+	var xMins []int16
+	if i, has := index["glyf"]; has && entries[i].isTransformed() {
+		j, has := index["loca"]
+		if !has || !entries[j].isTransformed() {
+			logger.Debugf("WOFF2 transformed glyf without transformed loca")
+			return errRequiredField
+		}
+
+		glyf, loca, mins, err := decodeWOFF2Glyf(tables[i])
+		if err != nil {
+			logger.Debugf("Invalid WOFF2 transformed glyf: %v", err)
+			return err
+		}
+		if uint32(len(loca)) != entries[j].origLength {
+			logger.Debugf("WOFF2 loca length mismatch: %d != %d", len(loca), entries[j].origLength)
+			return errRangeCheck
+		}
+		tables[i], tables[j], xMins = glyf, loca, mins
+	} else if j, has := index["loca"]; has && entries[j].isTransformed() {
+		logger.Debugf("WOFF2 transformed loca without transformed glyf")
+		return errRequiredField
+	}
+
+	for i, e := range entries {
+		if !e.isTransformed() {
+			if uint32(len(tables[i])) != e.origLength {
+				return errRangeCheck
+			}
+			continue
+		}
+		switch e.tableTag.String() {
+		case "glyf", "loca":
+			// Already reconstructed.
+		case "hmtx":
+			j, has := index["hhea"]
+			if !has || len(tables[j]) < 36 || xMins == nil || e.transform != 1 {
+				logger.Debugf("WOFF2 transformed hmtx requires hhea and transformed glyf")
+				return errRequiredField
+			}
+			numHMetrics := int(binary.BigEndian.Uint16(tables[j][34:]))
+			hmtx, err := decodeWOFF2Hmtx(tables[i], numHMetrics, xMins)
+			if err != nil {
+				logger.Debugf("Invalid WOFF2 transformed hmtx: %v", err)
+				return err
+			}
+			tables[i] = hmtx
+		default:
+			logger.Debugf("Unsupported WOFF2 transform %d of table %s", e.transform, e.tableTag.String())
+			return errRangeCheck
+		}
+	}
+	return nil
+}
+
+// woff2Stream is a cursor over one of the data streams of the transformed glyf table.
+type woff2Stream struct {
+	data []byte
+	pos  int
+}
+
+func (s *woff2Stream) bytes(n int) ([]byte, error) {
+	if n < 0 || s.pos+n > len(s.data) {
+		return nil, errRangeCheck
+	}
+	b := s.data[s.pos : s.pos+n]
+	s.pos += n
+	return b, nil
+}
+
+func (s *woff2Stream) uint8() (uint8, error) {
+	b, err := s.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (s *woff2Stream) uint16() (uint16, error) {
+	b, err := s.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// read255UInt16 reads a variable-length 255UInt16 encoded value.
+func (s *woff2Stream) read255UInt16() (uint16, error) {
+	code, err := s.uint8()
+	if err != nil {
+		return 0, err
+	}
+	switch code {
+	case 253: // wordCode
+		return s.uint16()
+	case 254: // oneMoreByteCode2
+		b, err := s.uint8()
+		return 253*2 + uint16(b), err
+	case 255: // oneMoreByteCode1
+		b, err := s.uint8()
+		return 253 + uint16(b), err
+	}
+	return uint16(code), nil
+}
+
+// decodeWOFF2Glyf reconstructs the glyf and loca table data from the transformed glyf table `data`.
+// The minimum x of each glyph is returned for reconstructing the hmtx table.
+func decodeWOFF2Glyf(data []byte) (glyf, loca []byte, xMins []int16, err error) {
+	const headerLen = 36
+	if len(data) < headerLen {
+		return nil, nil, nil, errRangeCheck
+	}
+	optionFlags := binary.BigEndian.Uint16(data[2:])
+	numGlyphs := int(binary.BigEndian.Uint16(data[4:]))
+	indexFormat := binary.BigEndian.Uint16(data[6:])
+	if indexFormat > 1 {
+		logger.Debugf("Invalid loca index format: %d", indexFormat)
+		return nil, nil, nil, errRangeCheck
+	}
+
+	// The nContour, nPoints, flag, glyph, composite, bbox and instruction streams.
+	streams := make([]*woff2Stream, 7)
+	offset := int64(headerLen)
+	for i := range streams {
+		size := int64(binary.BigEndian.Uint32(data[8+4*i:]))
+		if offset+size > int64(len(data)) {
+			logger.Debugf("WOFF2 glyf stream %d out of range", i)
+			return nil, nil, nil, errRangeCheck
+		}
+		streams[i] = &woff2Stream{data: data[offset : offset+size]}
+		offset += size
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream := streams[0], streams[1], streams[2], streams[3]
+	compositeStream, bboxStream, instructionStream := streams[4], streams[5], streams[6]
+
+	bboxBitmap, err := bboxStream.bytes(4 * ((numGlyphs + 31) / 32))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var overlapBitmap []byte
+	if optionFlags&0x0001 != 0 {
+		overlapBitmap = data[offset:]
+		if len(overlapBitmap) < (numGlyphs+7)/8 {
+			return nil, nil, nil, errRangeCheck
+		}
+	}
+
+	xMins = make([]int16, numGlyphs)
+	offsets := make([]uint32, numGlyphs+1)
+	var buf bytes.Buffer
+	for i := 0; i < numGlyphs; i++ {
+		v, err := nContourStream.uint16()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		h := glyphHeader{numberOfContours: int16(v)}
+		hasBBox := bboxBitmap[i>>3]&(0x80>>uint(i&7)) != 0
+		if hasBBox {
+			b, err := bboxStream.bytes(8)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			h.xMin = int16(binary.BigEndian.Uint16(b))
+			h.yMin = int16(binary.BigEndian.Uint16(b[2:]))
+			h.xMax = int16(binary.BigEndian.Uint16(b[4:]))
+			h.yMax = int16(binary.BigEndian.Uint16(b[6:]))
+		}
+
+		var gd []byte
+		switch {
+		case h.numberOfContours == 0:
+			if hasBBox {
+				logger.Debugf("WOFF2 empty glyph %d with bounding box", i)
+				return nil, nil, nil, errRangeCheck
+			}
+		case h.numberOfContours == -1:
+			if !hasBBox {
+				logger.Debugf("WOFF2 composite glyph %d without bounding box", i)
+				return nil, nil, nil, errRangeCheck
+			}
+			gd, err = decodeWOFF2Composite(h, compositeStream, glyphStream, instructionStream)
+		case h.numberOfContours > 0:
+			overlap := overlapBitmap != nil && overlapBitmap[i>>3]&(0x80>>uint(i&7)) != 0
+			gd, err = decodeWOFF2Simple(h, hasBBox, overlap, nPointsStream, flagStream, glyphStream,
+				instructionStream)
+		default:
+			logger.Debugf("WOFF2 invalid number of contours %d of glyph %d", h.numberOfContours, i)
+			return nil, nil, nil, errRangeCheck
+		}
+		if err != nil {
+			logger.Debugf("Error decoding WOFF2 glyph %d: %v", i, err)
+			return nil, nil, nil, err
+		}
+		if len(gd) >= 10 {
+			xMins[i] = int16(binary.BigEndian.Uint16(gd[2:]))
+		}
+
+		buf.Write(gd)
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+		offsets[i+1] = uint32(buf.Len())
+	}
+
+	var locaBuf bytes.Buffer
+	for _, off := range offsets {
+		if indexFormat == 0 {
+			if off/2 > 0xFFFF {
+				logger.Debugf("WOFF2 glyf too large for short loca format")
+				return nil, nil, nil, errRangeCheck
+			}
+			binary.Write(&locaBuf, binary.BigEndian, uint16(off/2))
+		} else {
+			binary.Write(&locaBuf, binary.BigEndian, off)
+		}
+	}
+	return buf.Bytes(), locaBuf.Bytes(), xMins, nil
+}
+
+// decodeWOFF2Simple decodes a simple glyph with header `h` from the WOFF2 glyf streams. The bounding box
+// is computed from the points unless `hasBBox` is set.
+func decodeWOFF2Simple(h glyphHeader, hasBBox, overlap bool, nPointsStream, flagStream, glyphStream,
+	instructionStream *woff2Stream) ([]byte, error) {
+	endPts := make([]uint16, h.numberOfContours)
+	numPoints := 0
+	for i := range endPts {
+		n, err := nPointsStream.read255UInt16()
+		if err != nil {
+			return nil, err
+		}
+		numPoints += int(n)
+		if numPoints == 0 || numPoints > 0xFFFF {
+			return nil, errRangeCheck
+		}
+		endPts[i] = uint16(numPoints - 1)
+	}
+
+	flags, err := flagStream.bytes(numPoints)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]glyphPoint, numPoints)
+	x, y := 0, 0
+	for i, flag := range flags {
+		dx, dy, err := decodeWOFF2Triplet(flag&0x7F, glyphStream)
+		if err != nil {
+			return nil, err
+		}
+		x, y = x+dx, y+dy
+		points[i] = glyphPoint{x: x, y: y, onCurve: flag&0x80 == 0}
+	}
+
+	instructionLength, err := glyphStream.read255UInt16()
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := instructionStream.bytes(int(instructionLength))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &simpleGlyph{header: h, endPts: endPts, points: points, instructions: instructions, overlap: overlap}
+	if !hasBBox {
+		g.header.xMin, g.header.yMin, g.header.xMax, g.header.yMax = g.bounds()
+	}
+	return g.encode(), nil
+}
+
+// decodeWOFF2Triplet decodes the coordinate deltas of a point with flag `flag` (without the on-curve bit)
+// from the triplet encoded data in `s`.
+func decodeWOFF2Triplet(flag uint8, s *woff2Stream) (dx, dy int, err error) {
+	withSign := func(flag uint8, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+
+	var n int
+	switch {
+	case flag < 84:
+		n = 1
+	case flag < 120:
+		n = 2
+	case flag < 124:
+		n = 3
+	default:
+		n = 4
+	}
+	b, err := s.bytes(n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	f := int(flag)
+	switch {
+	case flag < 10:
+		dy = withSign(flag, (f&14)<<7+int(b[0]))
+	case flag < 20:
+		dx = withSign(flag, ((f-10)&14)<<7+int(b[0]))
+	case flag < 84:
+		b0 := f - 20
+		dx = withSign(flag, 1+(b0&0x30)+int(b[0]>>4))
+		dy = withSign(flag>>1, 1+(b0&0x0C)<<2+int(b[0]&0x0F))
+	case flag < 120:
+		b0 := f - 84
+		dx = withSign(flag, 1+(b0/12)<<8+int(b[0]))
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int(b[1]))
+	case flag < 124:
+		dx = withSign(flag, int(b[0])<<4+int(b[1]>>4))
+		dy = withSign(flag>>1, int(b[1]&0x0F)<<8+int(b[2]))
+	default:
+		dx = withSign(flag, int(b[0])<<8+int(b[1]))
+		dy = withSign(flag>>1, int(b[2])<<8+int(b[3]))
+	}
+	return dx, dy, nil
+}
+
+// decodeWOFF2Composite decodes a composite glyph with header `h` from the WOFF2 glyf streams.
+func decodeWOFF2Composite(h glyphHeader, compositeStream, glyphStream, instructionStream *woff2Stream) ([]byte, error) {
+	n, hasInstructions, err := compositeComponentsLen(compositeStream.data[compositeStream.pos:])
+	if err != nil {
+		return nil, err
+	}
+	components, err := compositeStream.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []int16{h.numberOfContours, h.xMin, h.yMin, h.xMax, h.yMax})
+	buf.Write(components)
+	if hasInstructions {
+		instructionLength, err := glyphStream.read255UInt16()
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := instructionStream.bytes(int(instructionLength))
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, instructionLength)
+		buf.Write(instructions)
+	}
+	return buf.Bytes(), nil
+}
+
+// compositeComponentsLen returns the length of the component records at the start of `data`, and whether
+// the composite glyph has instructions.
+func compositeComponentsLen(data []byte) (int, bool, error) {
+	length := 0
+	hasInstructions := false
+	for {
+		if length+4 > len(data) {
+			return 0, false, errRangeCheck
+		}
+		flag := compositeGlyphFlag(binary.BigEndian.Uint16(data[length:]))
+		length += 4 // flags and glyph index.
+		if flag.IsSet(arg1And2AreWords) {
+			length += 4
+		} else {
+			length += 2
+		}
+		if flag.IsSet(weHaveAScale) {
+			length += 2
+		} else if flag.IsSet(weHaveAnXAndYScale) {
+			length += 4
+		} else if flag.IsSet(weHaveATwoByTwo) {
+			length += 8
+		}
+		if flag.IsSet(weHaveInstructions) {
+			hasInstructions = true
+		}
+		if !flag.IsSet(moreComponents) {
+			break
+		}
+	}
+	if length > len(data) {
+		return 0, false, errRangeCheck
+	}
+	return length, hasInstructions, nil
+}
+
+// decodeWOFF2Hmtx reconstructs the hmtx table from the transformed hmtx table `data`, with `numHMetrics`
+// full metrics and the left side bearings omitted from `data` taken from the glyph minimum x `xMins`.
+func decodeWOFF2Hmtx(data []byte, numHMetrics int, xMins []int16) ([]byte, error) {
+	s := &woff2Stream{data: data}
+	flags, err := s.uint8()
+	if err != nil {
+		return nil, err
+	}
+	if flags&0xFC != 0 || flags&0x03 == 0 || numHMetrics > len(xMins) || numHMetrics == 0 {
+		logger.Debugf("Invalid transformed hmtx (flags 0x%X, %d metrics)", flags, numHMetrics)
+		return nil, errRangeCheck
+	}
+
+	numGlyphs := len(xMins)
+	advances := make([]uint16, numHMetrics)
+	for i := range advances {
+		advances[i], err = s.uint16()
+		if err != nil {
+			return nil, err
+		}
+	}
+	lsbs := make([]int16, numGlyphs)
+	for i := range lsbs {
+		if (i < numHMetrics && flags&0x01 != 0) || (i >= numHMetrics && flags&0x02 != 0) {
+			lsbs[i] = xMins[i]
+			continue
+		}
+		v, err := s.uint16()
+		if err != nil {
+			return nil, err
+		}
+		lsbs[i] = int16(v)
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < numGlyphs; i++ {
+		if i < numHMetrics {
+			binary.Write(&buf, binary.BigEndian, advances[i])
+		}
+		binary.Write(&buf, binary.BigEndian, lsbs[i])
+	}
+	return buf.Bytes(), nil
+}
+
+// buildSfnt builds the data of an sfnt font with version `sfntVersion` from the tables `tables` with directory
+// entries `entries`. The table records are sorted by tag and the table checksums and the checksum adjustment
+// in the head table are computed.
+func buildSfnt(sfntVersion uint32, entries []woff2TableEntry, tables [][]byte) ([]byte, error) {
+	numTables := len(entries)
+	ot := newOffsetTable(sfntVersion, numTables)
+
+	trec := &tableRecords{}
+	offset := int64(12 + 16*numTables)
+	headOffset := int64(-1)
+	for i, e := range entries {
+		data := tables[i]
+		name := e.tableTag.String()
+		if name == "head" {
+			if len(data) < 12 {
+				logger.Debugf("head table too short")
+				return nil, errRangeCheck
+			}
+			// The checksum is computed with a zero checksum adjustment.
+			data = append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(data[8:], 0)
+			tables[i] = data
+			headOffset = offset
+		}
+
+		bw := newByteWriter(nil)
+		bw.writeBytes(data)
+		trec.Set(name, offset, len(data), bw.checksum())
+		offset += (int64(len(data)) + 3) &^ 3
+	}
+	sortTableRecords(trec)
+
+	var buf bytes.Buffer
+	bw := newByteWriter(&buf)
+	mockf := &font{ot: ot, trec: trec}
+	err := mockf.writeOffsetTable(bw)
+	if err != nil {
+		return nil, err
+	}
+	err = mockf.writeTableRecords(bw)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		err = bw.writeBytes(t)
+		if err != nil {
+			return nil, err
+		}
+		for bw.len%4 != 0 {
+			err = bw.writeBytes([]byte{0})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if headOffset >= 0 {
+		data := bw.buffer.Bytes()
+		binary.BigEndian.PutUint32(data[headOffset+8:], 0xB1B0AFBA-bw.checksum())
+	}
+	err = bw.flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteWOFF2 writes `f` to `w` as a WOFF2 font. The extended metadata and private data blocks of the WOFF or
+// WOFF2 file `f` was loaded from, if any, are retained.
+func (f *Font) WriteWOFF2(w io.Writer) error {
+	return f.WriteWOFF2WithOptions(w, &WOFFOptions{
+		Metadata:    f.woffMetadata,
+		PrivateData: f.woffPrivateData,
+	})
+}
+
+// WriteWOFF2WithOptions writes `f` to `w` as a WOFF2 font with options `opts`.
+// The glyf and loca tables are transformed, as is the hmtx table when its left side bearings match the
+// glyph bounding boxes, and all table data is compressed as a single Brotli stream.
+func (f *Font) WriteWOFF2WithOptions(w io.Writer, opts *WOFFOptions) error {
+	if opts == nil {
+		opts = &WOFFOptions{}
+	}
+
+	sfnt, err := f.writeSfnt()
+	if err != nil {
+		return err
+	}
+
+	// The table directory is sorted by tag, except that loca directly follows glyf.
+	var recs []*tableRecord
+	var loca *tableRecord
+	tables := map[string]*tableRecord{}
+	for _, tr := range sfnt.trec.list {
+		tables[tr.tableTag.String()] = tr
+	}
+	for _, tr := range sfnt.trec.list {
+		if tr.tableTag.String() == "loca" && tables["glyf"] != nil {
+			loca = tr
+			continue
+		}
+		recs = append(recs, tr)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return bytes.Compare(recs[i].tableTag[:], recs[j].tableTag[:]) < 0
+	})
+	if loca != nil {
+		for i, tr := range recs {
+			if tr.tableTag.String() == "glyf" {
+				recs = append(recs[:i+1], append([]*tableRecord{loca}, recs[i+1:]...)...)
+				break
+			}
+		}
+	}
+
+	transformed := map[string][]byte{}
+	var headData []byte
+	var locaLength uint32
+	if glyf, head, maxp := tables["glyf"], tables["head"], tables["maxp"]; glyf != nil && loca != nil &&
+		head != nil && head.length >= 54 && maxp != nil && maxp.length >= 6 {
+		indexFormat := int16(binary.BigEndian.Uint16(sfnt.tableData(head)[50:]))
+		numGlyphs := int(binary.BigEndian.Uint16(sfnt.tableData(maxp)[4:]))
+		glyfData, xMins, locaFormat, err := encodeWOFF2Glyf(sfnt.tableData(glyf), sfnt.tableData(loca), numGlyphs,
+			indexFormat)
+		if err != nil {
+			logger.Debugf("Error transforming glyf: %v", err)
+			return err
+		}
+		transformed["glyf"] = glyfData
+		transformed["loca"] = []byte{}
+		locaLength = uint32(2 * (numGlyphs + 1))
+		if locaFormat == 1 {
+			locaLength *= 2
+		}
+		if locaFormat != indexFormat {
+			// The reconstructed glyphs are padded to 4 bytes, which can exceed the range of the short format.
+			headData = append([]byte(nil), sfnt.tableData(head)...)
+			binary.BigEndian.PutUint16(headData[50:], uint16(locaFormat))
+		}
+
+		if hhea, hmtx := tables["hhea"], tables["hmtx"]; hhea != nil && hhea.length >= 36 && hmtx != nil {
+			numHMetrics := int(binary.BigEndian.Uint16(sfnt.tableData(hhea)[34:]))
+			hmtxData := encodeWOFF2Hmtx(sfnt.tableData(hmtx), numHMetrics, xMins)
+			if hmtxData != nil {
+				transformed["hmtx"] = hmtxData
+			}
+		}
+	}
+
+	h := &woff2Header{
+		signature:     signatureWOFF2,
+		flavor:        sfnt.ot.sfntVersion,
+		numTables:     uint16(len(recs)),
+		totalSfntSize: uint32(12 + 16*len(recs)),
+		majorVersion:  opts.MajorVersion,
+		minorVersion:  opts.MinorVersion,
+	}
+
+	var dir, stream []byte
+	for _, tr := range recs {
+		name := tr.tableTag.String()
+		index := uint8(0x3F)
+		for i, known := range woff2KnownTags {
+			if makeTag(known) == tr.tableTag {
+				index = uint8(i)
+				break
+			}
+		}
+
+		data, isTransformed := transformed[name]
+		origLength := tr.length
+		if name == "loca" && isTransformed {
+			origLength = locaLength
+		}
+		flags := index
+		switch {
+		case (name == "glyf" || name == "loca") && !isTransformed:
+			flags |= 3 << 6 // null transform.
+		case name == "hmtx" && isTransformed:
+			flags |= 1 << 6
+		}
+		dir = append(dir, flags)
+		if index == 0x3F {
+			dir = append(dir, tr.tableTag[:]...)
+		}
+		dir = appendUIntBase128(dir, origLength)
+		switch {
+		case isTransformed:
+			dir = appendUIntBase128(dir, uint32(len(data)))
+		case name == "head" && headData != nil:
+			data = headData
+		default:
+			data = sfnt.tableData(tr)
+		}
+		stream = append(stream, data...)
+		h.totalSfntSize += (origLength + 3) &^ 3
+	}
+
+	compressed, err := brotliCompress(stream)
+	if err != nil {
+		return err
+	}
+	h.totalCompressedSize = uint32(len(compressed))
+
+	// The compressed data is padded to a 4-byte boundary.
+	offset := (uint32(48+len(dir)+len(compressed)) + 3) &^ 3
+	var meta []byte
+	if len(opts.Metadata) > 0 {
+		meta, err = brotliCompress(opts.Metadata)
+		if err != nil {
+			return err
+		}
+		h.metaOffset = offset
+		h.metaLength = uint32(len(meta))
+		h.metaOrigLength = uint32(len(opts.Metadata))
+		offset += uint32(len(meta))
+	}
+	if len(opts.PrivateData) > 0 {
+		// The private data block starts on a 4-byte boundary.
+		offset = (offset + 3) &^ 3
+		h.privOffset = offset
+		h.privLength = uint32(len(opts.PrivateData))
+		offset += h.privLength
+	}
+	h.length = offset
+
+	bw := newByteWriter(w)
+	err = bw.write(h.signature, h.flavor, h.length, h.numTables, h.reserved, h.totalSfntSize,
+		h.totalCompressedSize)
+	if err != nil {
+		return err
+	}
+	err = bw.write(h.majorVersion, h.minorVersion, h.metaOffset, h.metaLength, h.metaOrigLength,
+		h.privOffset, h.privLength)
+	if err != nil {
+		return err
+	}
+	err = bw.writeBytes(dir)
+	if err != nil {
+		return err
+	}
+	err = bw.writeBytes(compressed)
+	if err != nil {
+		return err
+	}
+
+	pad := func(offset uint32) error {
+		for bw.len < int64(offset) {
+			err := bw.writeBytes([]byte{0})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if meta != nil {
+		err = pad(h.metaOffset)
+		if err == nil {
+			err = bw.writeBytes(meta)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if h.privLength > 0 {
+		err = pad(h.privOffset)
+		if err == nil {
+			err = bw.writeBytes(opts.PrivateData)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = pad(h.length)
+	if err != nil {
+		return err
+	}
+	return bw.flush()
+}
+
+// WriteWOFF2File writes `f` as a WOFF2 font to file `filePath`.
+func (f *Font) WriteWOFF2File(filePath string) error {
+	of, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer of.Close()
+
+	return f.WriteWOFF2(of)
+}
+
+// appendUIntBase128 appends the UIntBase128 encoding of `v` to `b`.
+func appendUIntBase128(b []byte, v uint32) []byte {
+	n := 1
+	for v>>uint(7*n) != 0 && n < 5 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := byte(v>>uint(7*i)) & 0x7F
+		if i > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// append255UInt16 appends the 255UInt16 encoding of `v` to `b`.
+func append255UInt16(b []byte, v uint16) []byte {
+	switch {
+	case v < 253:
+		return append(b, byte(v))
+	case v < 253*2:
+		return append(b, 255, byte(v-253))
+	case v < 253*3:
+		return append(b, 254, byte(v-253*2))
+	}
+	return append(b, 253, byte(v>>8), byte(v))
+}
+
+// brotliCompress compresses `data` with Brotli at the highest compression level.
+func brotliCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	_, err := bw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = bw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeWOFF2Glyf applies the WOFF2 glyf transform to the glyf table `glyf` with loca table `loca` in
+// format `indexFormat`. The minimum x of each glyph is returned for transforming the hmtx table, along with
+// the loca format of the reconstructed font. Decoders pad each reconstructed glyph to 4 bytes, so the long
+// format is used when the padded glyf table exceeds the range of the short format.
+func encodeWOFF2Glyf(glyf, loca []byte, numGlyphs int, indexFormat int16) ([]byte, []int16, int16, error) {
+	offsets := make([]uint32, numGlyphs+1)
+	for i := range offsets {
+		if indexFormat == 0 {
+			if 2*i+2 > len(loca) {
+				return nil, nil, 0, errRangeCheck
+			}
+			offsets[i] = 2 * uint32(binary.BigEndian.Uint16(loca[2*i:]))
+		} else {
+			if 4*i+4 > len(loca) {
+				return nil, nil, 0, errRangeCheck
+			}
+			offsets[i] = binary.BigEndian.Uint32(loca[4*i:])
+		}
+	}
+
+	var nContourStream, nPointsStream, flagStream, glyphStream, compositeStream, bboxStream,
+		instructionStream []byte
+	bboxBitmap := make([]byte, 4*((numGlyphs+31)/32))
+	overlapBitmap := make([]byte, (numGlyphs+7)/8)
+	hasOverlap := false
+	xMins := make([]int16, numGlyphs)
+	// Size of the reconstructed glyf table.
+	var size int64
+
+	for i := 0; i < numGlyphs; i++ {
+		start, end := offsets[i], offsets[i+1]
+		if start > end || int64(end) > int64(len(glyf)) {
+			logger.Debugf("Glyph %d out of range", i)
+			return nil, nil, 0, errRangeCheck
+		}
+		data := glyf[start:end]
+		if len(data) == 0 {
+			nContourStream = append(nContourStream, 0, 0)
+			continue
+		}
+		if len(data) < 10 {
+			return nil, nil, 0, errRangeCheck
+		}
+		numberOfContours := int16(binary.BigEndian.Uint16(data))
+		nContourStream = append(nContourStream, data[0], data[1])
+		if numberOfContours != 0 {
+			xMins[i] = int16(binary.BigEndian.Uint16(data[2:]))
+		}
+
+		switch {
+		case numberOfContours == 0:
+			// Glyph without an outline, stored as an empty glyph.
+		case numberOfContours < 0:
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			bboxStream = append(bboxStream, data[2:10]...)
+			n, hasInstructions, err := compositeComponentsLen(data[10:])
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			compositeStream = append(compositeStream, data[10:10+n]...)
+			length := 10 + n
+			if hasInstructions {
+				pos := 10 + n
+				if pos+2 > len(data) {
+					return nil, nil, 0, errRangeCheck
+				}
+				instructionLength := int(binary.BigEndian.Uint16(data[pos:]))
+				if pos+2+instructionLength > len(data) {
+					return nil, nil, 0, errRangeCheck
+				}
+				glyphStream = append255UInt16(glyphStream, uint16(instructionLength))
+				instructionStream = append(instructionStream, data[pos+2:pos+2+instructionLength]...)
+				length += 2 + instructionLength
+			}
+			size += int64(length+3) &^ 3
+		default:
+			g, err := decodeSimpleGlyph(data)
+			if err != nil {
+				logger.Debugf("Error decoding glyph %d: %v", i, err)
+				return nil, nil, 0, err
+			}
+			prev := -1
+			for _, endPt := range g.endPts {
+				if int(endPt) <= prev {
+					logger.Debugf("Glyph %d with invalid contour end points", i)
+					return nil, nil, 0, errRangeCheck
+				}
+				nPointsStream = append255UInt16(nPointsStream, uint16(int(endPt)-prev))
+				prev = int(endPt)
+			}
+			x, y := 0, 0
+			for _, p := range g.points {
+				var flag uint8
+				flag, glyphStream = appendWOFF2Triplet(glyphStream, p.x-x, p.y-y)
+				if !p.onCurve {
+					flag |= 0x80
+				}
+				flagStream = append(flagStream, flag)
+				x, y = p.x, p.y
+			}
+			glyphStream = append255UInt16(glyphStream, uint16(len(g.instructions)))
+			instructionStream = append(instructionStream, g.instructions...)
+			size += int64(len(g.encode())+3) &^ 3
+
+			xMin, yMin, xMax, yMax := g.bounds()
+			h := g.header
+			if h.xMin != xMin || h.yMin != yMin || h.xMax != xMax || h.yMax != yMax {
+				bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+				bboxStream = append(bboxStream, data[2:10]...)
+			}
+			if g.overlap {
+				overlapBitmap[i>>3] |= 0x80 >> uint(i&7)
+				hasOverlap = true
+			}
+		}
+	}
+
+	if size/2 > 0xFFFF {
+		indexFormat = 1
+	}
+
+	var optionFlags uint16
+	if hasOverlap {
+		optionFlags |= 0x0001
+	}
+	bboxStream = append(bboxBitmap, bboxStream...)
+	streams := [][]byte{nContourStream, nPointsStream, flagStream, glyphStream, compositeStream, bboxStream,
+		instructionStream}
+
+	var buf bytes.Buffer
+	bw := newByteWriter(&buf)
+	err := bw.write(uint16(0), optionFlags, uint16(numGlyphs), uint16(indexFormat))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for _, s := range streams {
+		err = bw.write(uint32(len(s)))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	for _, s := range streams {
+		err = bw.writeBytes(s)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	if hasOverlap {
+		err = bw.writeBytes(overlapBitmap)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	err = bw.flush()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return buf.Bytes(), xMins, indexFormat, nil
+}
+
+// appendWOFF2Triplet appends the triplet encoding of the coordinate deltas `dx`, `dy` to `b` with the
+// shortest encoding. Returns the flag for the point without the on-curve bit.
+func appendWOFF2Triplet(b []byte, dx, dy int) (uint8, []byte) {
+	x, y := dx, dy
+	var xSign, ySign uint8
+	if x < 0 {
+		x = -x
+	} else {
+		xSign = 1
+	}
+	if y < 0 {
+		y = -y
+	} else {
+		ySign = 1
+	}
+	signs := xSign + 2*ySign
+
+	switch {
+	case x == 0 && y < 1280:
+		return uint8((y&0xF00)>>7) + ySign, append(b, byte(y))
+	case y == 0 && x < 1280:
+		return 10 + uint8((x&0xF00)>>7) + xSign, append(b, byte(x))
+	case x < 65 && y < 65:
+		x, y = x-1, y-1
+		return 20 + uint8(x&0x30) + uint8((y&0x30)>>2) + signs, append(b, byte((x&0x0F)<<4|y&0x0F))
+	case x < 769 && y < 769:
+		x, y = x-1, y-1
+		return 84 + 12*uint8((x&0x300)>>8) + uint8((y&0x300)>>6) + signs, append(b, byte(x), byte(y))
+	case x < 4096 && y < 4096:
+		return 120 + signs, append(b, byte(x>>4), byte((x&0x0F)<<4|y>>8), byte(y))
+	}
+	return 124 + signs, append(b, byte(x>>8), byte(x), byte(y>>8), byte(y))
+}
+
+// encodeWOFF2Hmtx applies the WOFF2 hmtx transform to the hmtx table `data` with `numHMetrics` full metrics.
+// The left side bearings are omitted where they match the glyph minimum x `xMins`. Returns nil if no left
+// side bearings can be omitted.
+func encodeWOFF2Hmtx(data []byte, numHMetrics int, xMins []int16) []byte {
+	numGlyphs := len(xMins)
+	if numHMetrics == 0 || numHMetrics > numGlyphs || len(data) < 2*numHMetrics+2*numGlyphs {
+		return nil
+	}
+
+	lsb := func(i int) int16 {
+		if i < numHMetrics {
+			return int16(binary.BigEndian.Uint16(data[4*i+2:]))
+		}
+		return int16(binary.BigEndian.Uint16(data[4*numHMetrics+2*(i-numHMetrics):]))
+	}
+	flags := uint8(0x03)
+	for i := 0; i < numGlyphs; i++ {
+		if lsb(i) == xMins[i] {
+			continue
+		}
+		if i < numHMetrics {
+			flags &^= 0x01
+		} else {
+			flags &^= 0x02
+		}
+	}
+	if flags == 0 {
+		return nil
+	}
+
+	b := []byte{flags}
+	for i := 0; i < numHMetrics; i++ {
+		b = append(b, data[4*i], data[4*i+1])
+	}
+	for i := 0; i < numGlyphs; i++ {
+		if (i < numHMetrics && flags&0x01 != 0) || (i >= numHMetrics && flags&0x02 != 0) {
+			continue
+		}
+		v := uint16(lsb(i))
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
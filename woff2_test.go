@@ -0,0 +1,342 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestWOFF2 builds a WOFF2 file from the sfnt font file `sfnt` with the null transform applied to
+// all tables.
+func buildTestWOFF2(t *testing.T, sfnt, metadata, private []byte) []byte {
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:6]))
+	var dir, stream []byte
+	totalSfntSize := 12 + 16*numTables
+	for i := 0; i < numTables; i++ {
+		rec := sfnt[12+16*i : 12+16*(i+1)]
+		toff := binary.BigEndian.Uint32(rec[8:12])
+		tlen := binary.BigEndian.Uint32(rec[12:16])
+		totalSfntSize += int(tlen+3) &^ 3
+
+		flags := byte(63)
+		for j, known := range woff2KnownTags {
+			if known == string(rec[0:4]) {
+				flags = byte(j)
+			}
+		}
+		if tableTag := string(rec[0:4]); tableTag == "glyf" || tableTag == "loca" {
+			flags |= 3 << 6
+		}
+		dir = append(dir, flags)
+		if flags == 63 {
+			dir = append(dir, rec[0:4]...)
+		}
+		dir = appendUIntBase128(dir, tlen)
+		stream = append(stream, sfnt[toff:toff+tlen]...)
+	}
+
+	compressed, err := brotliCompress(stream)
+	require.NoError(t, err)
+	var compMeta []byte
+	if metadata != nil {
+		compMeta, err = brotliCompress(metadata)
+		require.NoError(t, err)
+	}
+
+	metaOffset := (48 + len(dir) + len(compressed) + 3) &^ 3
+	privOffset := (metaOffset + len(compMeta) + 3) &^ 3
+	length := privOffset + len(private)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint32{signatureWOFF2, binary.BigEndian.Uint32(sfnt[0:4]),
+		uint32(length)})
+	binary.Write(&buf, binary.BigEndian, []uint16{uint16(numTables), 0})
+	binary.Write(&buf, binary.BigEndian, []uint32{uint32(totalSfntSize), uint32(len(compressed))})
+	binary.Write(&buf, binary.BigEndian, []uint16{1, 0})
+	binary.Write(&buf, binary.BigEndian, []uint32{uint32(metaOffset), uint32(len(compMeta)),
+		uint32(len(metadata)), uint32(privOffset), uint32(len(private))})
+	buf.Write(dir)
+	buf.Write(compressed)
+	for buf.Len() < metaOffset {
+		buf.WriteByte(0)
+	}
+	buf.Write(compMeta)
+	for buf.Len() < privOffset {
+		buf.WriteByte(0)
+	}
+	buf.Write(private)
+	return buf.Bytes()
+}
+
+// alignTestSideBearings sets the left side bearings of the sfnt font `sfnt` to the glyph minimum x values.
+func alignTestSideBearings(t *testing.T, sfnt []byte) []byte {
+	fnt, err := Parse(bytes.NewReader(sfnt))
+	require.NoError(t, err)
+	numHMetrics := len(fnt.hmtx.hMetrics)
+	for i, gd := range fnt.glyf.descs {
+		var xMin int16
+		if len(gd.raw) >= 10 && int16(binary.BigEndian.Uint16(gd.raw)) != 0 {
+			xMin = int16(binary.BigEndian.Uint16(gd.raw[2:]))
+		}
+		if i < numHMetrics {
+			fnt.hmtx.hMetrics[i].lsb = xMin
+		} else {
+			fnt.hmtx.leftSideBearings[i-numHMetrics] = xMin
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, fnt.Write(&buf))
+	return buf.Bytes()
+}
+
+// assertSameGlyphs checks that the glyphs of `fnt` have the same outlines as the glyphs of `orig`.
+// Simple glyphs are compared decoded as they are re-encoded in transformed WOFF2 fonts.
+func assertSameGlyphs(t *testing.T, orig, fnt *Font) {
+	require.Equal(t, len(orig.glyf.descs), len(fnt.glyf.descs))
+	for i, gd := range orig.glyf.descs {
+		raw := fnt.glyf.descs[i].raw
+		if len(gd.raw) == 0 || int16(binary.BigEndian.Uint16(gd.raw)) <= 0 {
+			// Compare without padding.
+			assert.Equal(t, bytes.TrimRight(gd.raw, "\x00"), bytes.TrimRight(raw, "\x00"), "glyph %d", i)
+			continue
+		}
+		g1, err := decodeSimpleGlyph(gd.raw)
+		require.NoError(t, err)
+		g2, err := decodeSimpleGlyph(raw)
+		require.NoError(t, err)
+		assert.Equal(t, g1, g2, "glyph %d", i)
+	}
+}
+
+func TestParseWOFF2(t *testing.T) {
+	fontFiles := []string{
+		"./testdata/FreeSans.ttf",
+		"./testdata/roboto/Roboto-Bold.ttf",
+	}
+	metadata := []byte(`<?xml version="1.0" encoding="UTF-8"?><metadata version="1.0"></metadata>`)
+	private := []byte{1, 2, 3, 4, 5}
+
+	for _, fontFile := range fontFiles {
+		t.Run(fontFile, func(t *testing.T) {
+			sfnt, err := ioutil.ReadFile(fontFile)
+			require.NoError(t, err)
+			orig, err := Parse(bytes.NewReader(sfnt))
+			require.NoError(t, err)
+
+			woff2 := buildTestWOFF2(t, sfnt, metadata, private)
+			require.True(t, len(woff2) < len(sfnt))
+
+			fnt, err := Parse(bytes.NewReader(woff2))
+			require.NoError(t, err)
+			require.NoError(t, fnt.validate(fnt.br))
+			assert.Equal(t, metadata, fnt.WOFFMetadata())
+			assert.Equal(t, private, fnt.WOFFPrivateData())
+			assert.Equal(t, orig.hmtx, fnt.hmtx)
+			assert.Equal(t, orig.cmap, fnt.cmap)
+			assert.Equal(t, orig.name, fnt.name)
+			assertSameGlyphs(t, orig, fnt)
+		})
+	}
+}
+
+func TestWriteWOFF2(t *testing.T) {
+	fontFiles := []string{
+		"./testdata/FreeSans.ttf",
+		"./testdata/roboto/Roboto-Bold.ttf",
+	}
+	metadata := []byte(`<?xml version="1.0" encoding="UTF-8"?><metadata version="1.0"></metadata>`)
+	private := []byte{1, 2, 3, 4, 5}
+
+	for _, fontFile := range fontFiles {
+		t.Run(fontFile, func(t *testing.T) {
+			sfnt, err := ioutil.ReadFile(fontFile)
+			require.NoError(t, err)
+
+			// Left side bearings matching the glyph minimum x allow transforming hmtx.
+			for _, data := range [][]byte{sfnt, alignTestSideBearings(t, sfnt)} {
+				orig, err := Parse(bytes.NewReader(data))
+				require.NoError(t, err)
+
+				var buf bytes.Buffer
+				err = orig.WriteWOFF2WithOptions(&buf, &WOFFOptions{Metadata: metadata, PrivateData: private})
+				require.NoError(t, err)
+				woff2 := buf.Bytes()
+
+				var woff bytes.Buffer
+				require.NoError(t, orig.WriteWOFF(&woff))
+				assert.True(t, len(woff2) < woff.Len())
+
+				fnt, err := Parse(bytes.NewReader(woff2))
+				require.NoError(t, err)
+				require.NoError(t, fnt.validate(fnt.br))
+				assert.Equal(t, metadata, fnt.WOFFMetadata())
+				assert.Equal(t, private, fnt.WOFFPrivateData())
+				assert.Equal(t, orig.hmtx, fnt.hmtx)
+				assertSameGlyphs(t, orig, fnt)
+
+				// Metadata and private data are retained.
+				buf.Reset()
+				require.NoError(t, fnt.WriteWOFF2(&buf))
+				fnt, err = Parse(bytes.NewReader(buf.Bytes()))
+				require.NoError(t, err)
+				assert.Equal(t, metadata, fnt.WOFFMetadata())
+				assert.Equal(t, private, fnt.WOFFPrivateData())
+			}
+		})
+	}
+}
+
+func TestWriteWOFF2RoundTrip(t *testing.T) {
+	var fontFiles []string
+	for _, pattern := range []string{"./testdata/*.ttf", "./testdata/roboto/*.ttf"} {
+		matches, err := filepath.Glob(pattern)
+		require.NoError(t, err)
+		for _, match := range matches {
+			// Large fonts such as wts11.ttf take minutes to compress.
+			info, err := os.Stat(match)
+			require.NoError(t, err)
+			if info.Size() > 1<<20 {
+				continue
+			}
+			// Roboto-LightItalic needs the long loca format once the glyphs are padded to 4 bytes.
+			if testing.Short() && filepath.Base(match) != "FreeSans.ttf" &&
+				filepath.Base(match) != "Roboto-LightItalic.ttf" {
+				continue
+			}
+			fontFiles = append(fontFiles, match)
+		}
+	}
+	require.NotEmpty(t, fontFiles)
+
+	for _, fontFile := range fontFiles {
+		t.Run(fontFile, func(t *testing.T) {
+			orig, err := ParseFile(fontFile)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, orig.WriteWOFF2(&buf))
+			fnt, err := ParseWOFF2(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			require.NoError(t, fnt.validate(fnt.br))
+			assertSameGlyphs(t, orig, fnt)
+
+			data, err := fnt.Bytes()
+			require.NoError(t, err)
+			require.NoError(t, ValidateBytes(data))
+		})
+	}
+}
+
+func TestWriteWOFF2Subset(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	subfnt, err := fnt.SubsetKeepRunes([]rune("The quick brown fox jumps over the lazy dog"))
+	require.NoError(t, err)
+
+	var sfnt, woff2 bytes.Buffer
+	require.NoError(t, subfnt.Write(&sfnt))
+	require.NoError(t, subfnt.WriteWOFF2(&woff2))
+	assert.True(t, woff2.Len() < sfnt.Len()/2)
+
+	wfnt, err := Parse(bytes.NewReader(woff2.Bytes()))
+	require.NoError(t, err)
+	orig, err := Parse(bytes.NewReader(sfnt.Bytes()))
+	require.NoError(t, err)
+	assertSameGlyphs(t, orig, wfnt)
+	for _, r := range "The quick brown fox" {
+		gid1, has1 := orig.LookupRune(r)
+		gid2, has2 := wfnt.LookupRune(r)
+		assert.True(t, has1 && has2)
+		assert.Equal(t, gid1, gid2)
+	}
+}
+
+func TestParseWOFF2Invalid(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, fnt.WriteWOFF2(&buf))
+	woff2 := buf.Bytes()
+
+	_, err = ParseWOFF2(bytes.NewReader(woff2[:len(woff2)-1]))
+	assert.Error(t, err)
+
+	// Corrupted compressed data.
+	corrupt := append([]byte(nil), woff2...)
+	for i := 200; i < 300; i++ {
+		corrupt[i] ^= 0xFF
+	}
+	_, err = ParseWOFF2(bytes.NewReader(corrupt))
+	assert.Error(t, err)
+
+	// Collection flavor.
+	ttc := append([]byte(nil), woff2...)
+	binary.BigEndian.PutUint32(ttc[4:], signatureCollection)
+	_, err = ParseWOFF2(bytes.NewReader(ttc))
+	assert.EqualError(t, err, "unsupported font format in WOFF2: TrueType collection")
+
+	_, err = ParseWOFF2(bytes.NewReader([]byte("wOF2\x00\x01\x00\x00")))
+	assert.Error(t, err)
+}
+
+func TestReadUIntBase128(t *testing.T) {
+	testcases := []struct {
+		data  []byte
+		value uint32
+		valid bool
+	}{
+		{[]byte{0x00}, 0, true},
+		{[]byte{0x3F}, 63, true},
+		{[]byte{0x81, 0x00}, 128, true},
+		{[]byte{0x8F, 0xFF, 0xFF, 0xFF, 0x7F}, 0xFFFFFFFF, true},
+		{[]byte{0x80, 0x01}, 0, false},                   // leading zero.
+		{[]byte{0x90, 0x80, 0x80, 0x80, 0x00}, 0, false}, // overflow.
+		{[]byte{0x81, 0x81, 0x81, 0x81, 0x81, 0x01}, 0, false},
+		{[]byte{0x81}, 0, false},
+	}
+
+	for i, tcase := range testcases {
+		v, err := readUIntBase128(newByteReader(bytes.NewReader(tcase.data)))
+		if !tcase.valid {
+			assert.Error(t, err, "case %d", i)
+			continue
+		}
+		require.NoError(t, err, "case %d", i)
+		assert.Equal(t, tcase.value, v, "case %d", i)
+		assert.Equal(t, tcase.data, appendUIntBase128(nil, v), "case %d", i)
+	}
+}
+
+func TestWOFF2Encodings(t *testing.T) {
+	for _, v := range []uint16{0, 252, 253, 505, 506, 758, 759, 762, 0xFFFF} {
+		s := &woff2Stream{data: append255UInt16(nil, v)}
+		decoded, err := s.read255UInt16()
+		require.NoError(t, err)
+		assert.Equal(t, v, decoded)
+		assert.Equal(t, len(s.data), s.pos)
+	}
+
+	deltas := []int{0, 1, -1, 63, 64, 65, -65, 255, 256, 768, 769, -1279, 1280, 4095, 4096, -32768, 32767}
+	for _, dx := range deltas {
+		for _, dy := range deltas {
+			flag, b := appendWOFF2Triplet(nil, dx, dy)
+			require.True(t, flag < 128)
+			s := &woff2Stream{data: b}
+			x, y, err := decodeWOFF2Triplet(flag, s)
+			require.NoError(t, err)
+			assert.Equal(t, [2]int{dx, dy}, [2]int{x, y})
+			assert.Equal(t, len(b), s.pos)
+		}
+	}
+}
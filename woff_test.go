@@ -0,0 +1,150 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package unitype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestWOFF wraps the sfnt font `sfnt` in a WOFF file with `metadata` and `private` data blocks.
+// Tables are stored uncompressed when compression does not reduce the size.
+func buildTestWOFF(sfnt, metadata, private []byte) []byte {
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:6]))
+	var dir, body bytes.Buffer
+	offset := 44 + 20*numTables
+	totalSfntSize := 12 + 16*numTables
+	for i := 0; i < numTables; i++ {
+		rec := sfnt[12+16*i : 12+16*(i+1)]
+		toff := binary.BigEndian.Uint32(rec[8:12])
+		tlen := binary.BigEndian.Uint32(rec[12:16])
+		data := sfnt[toff : toff+tlen]
+		comp, _ := zlibCompress(data)
+		if len(comp) >= len(data) {
+			comp = data
+		}
+		dir.Write(rec[0:4])
+		binary.Write(&dir, binary.BigEndian, []uint32{uint32(offset + body.Len()), uint32(len(comp)), tlen})
+		dir.Write(rec[4:8])
+		body.Write(comp)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+		totalSfntSize += int(tlen+3) &^ 3
+	}
+
+	metaOffset := offset + body.Len()
+	compMeta, _ := zlibCompress(metadata)
+	body.Write(compMeta)
+	for body.Len()%4 != 0 {
+		body.WriteByte(0)
+	}
+	privOffset := offset + body.Len()
+	body.Write(private)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint32{signatureWOFF, binary.BigEndian.Uint32(sfnt[0:4]),
+		uint32(offset + body.Len())})
+	binary.Write(&buf, binary.BigEndian, []uint16{uint16(numTables), 0})
+	binary.Write(&buf, binary.BigEndian, uint32(totalSfntSize))
+	binary.Write(&buf, binary.BigEndian, []uint16{1, 0})
+	binary.Write(&buf, binary.BigEndian, []uint32{uint32(metaOffset), uint32(len(compMeta)),
+		uint32(len(metadata)), uint32(privOffset), uint32(len(private))})
+	buf.Write(dir.Bytes())
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func TestParseWOFF(t *testing.T) {
+	sfnt, err := ioutil.ReadFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	metadata := []byte(`<?xml version="1.0" encoding="UTF-8"?><metadata version="1.0"></metadata>`)
+	private := []byte{1, 2, 3, 4, 5}
+	woff := buildTestWOFF(sfnt, metadata, private)
+	require.True(t, len(woff) < len(sfnt))
+
+	fnt, err := ParseWOFF(bytes.NewReader(woff))
+	require.NoError(t, err)
+	assert.Equal(t, metadata, fnt.WOFFMetadata())
+	assert.Equal(t, private, fnt.WOFFPrivateData())
+
+	orig, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	assert.Nil(t, orig.WOFFMetadata())
+	assert.Nil(t, orig.WOFFPrivateData())
+
+	var expected, actual bytes.Buffer
+	require.NoError(t, orig.Write(&expected))
+	require.NoError(t, fnt.Write(&actual))
+	assert.Equal(t, expected.Bytes(), actual.Bytes())
+
+	// Parse identifies WOFF from the signature.
+	fnt, err = Parse(bytes.NewReader(woff))
+	require.NoError(t, err)
+	numGlyphs, _ := fnt.NumGlyphs()
+	assert.Equal(t, 3726, numGlyphs)
+
+	// Compressed length of first table exceeding its original length.
+	invalid := append([]byte(nil), woff...)
+	binary.BigEndian.PutUint32(invalid[44+8:44+12], binary.BigEndian.Uint32(invalid[44+12:44+16])+1)
+	_, err = ParseWOFF(bytes.NewReader(invalid))
+	assert.Equal(t, errRangeCheck, err)
+
+	// Original length not matching the decompressed data.
+	invalid = append([]byte(nil), woff...)
+	binary.BigEndian.PutUint32(invalid[44+12:44+16], binary.BigEndian.Uint32(invalid[44+12:44+16])+1)
+	_, err = ParseWOFF(bytes.NewReader(invalid))
+	assert.Error(t, err)
+
+	// Truncated.
+	_, err = ParseWOFF(bytes.NewReader(woff[:len(woff)-1]))
+	assert.Equal(t, errRangeCheck, err)
+}
+
+func TestWriteWOFF(t *testing.T) {
+	fnt, err := ParseFile("./testdata/FreeSans.ttf")
+	require.NoError(t, err)
+	var expected bytes.Buffer
+	require.NoError(t, fnt.Write(&expected))
+
+	metadata := []byte(`<?xml version="1.0" encoding="UTF-8"?><metadata version="1.0"></metadata>`)
+	testcases := []struct {
+		opts     *WOFFOptions
+		metadata []byte
+		private  []byte
+	}{
+		{nil, nil, nil},
+		{&WOFFOptions{Metadata: metadata}, metadata, nil},
+		{&WOFFOptions{Metadata: metadata, PrivateData: []byte{1, 2, 3}}, metadata, []byte{1, 2, 3}},
+		{&WOFFOptions{PrivateData: []byte{1}}, nil, []byte{1}},
+	}
+
+	for i, tcase := range testcases {
+		var buf bytes.Buffer
+		require.NoError(t, fnt.WriteWOFFWithOptions(&buf, tcase.opts), "case %d", i)
+		woff := buf.Bytes()
+		assert.True(t, len(woff) < expected.Len(), "case %d", i)
+
+		wfnt, err := ParseWOFF(bytes.NewReader(woff))
+		require.NoError(t, err, "case %d", i)
+		assert.Equal(t, tcase.metadata, wfnt.WOFFMetadata(), "case %d", i)
+		assert.Equal(t, tcase.private, wfnt.WOFFPrivateData(), "case %d", i)
+
+		var actual bytes.Buffer
+		require.NoError(t, wfnt.Write(&actual))
+		assert.Equal(t, expected.Bytes(), actual.Bytes(), "case %d", i)
+
+		// The blocks are retained when written back out.
+		buf.Reset()
+		require.NoError(t, wfnt.WriteWOFF(&buf))
+		assert.Equal(t, woff, buf.Bytes(), "case %d", i)
+	}
+}